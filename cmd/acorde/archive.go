@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/amaydixit11/acorde/internal/cli"
+	"github.com/amaydixit11/acorde/pkg/engine"
+)
+
+func cmdArchive(c *cli.Context, e engine.Engine) error {
+	return setArchived(c, e, true)
+}
+
+func cmdUnarchive(c *cli.Context, e engine.Engine) error {
+	return setArchived(c, e, false)
+}
+
+// setArchived archives or unarchives the entries named on the command
+// line, in one bulk operation
+func setArchived(c *cli.Context, e engine.Engine, archive bool) error {
+	ids, err := entryIDArgs(c, e)
+	if err != nil {
+		return err
+	}
+	// Look every entry up first, so that a bad ID changes nothing
+	for _, id := range ids {
+		if _, err := e.GetEntry(id); err != nil {
+			return err
+		}
+	}
+
+	verb := "Unarchived"
+	if archive {
+		verb = "Archived"
+	}
+	err = e.Bulk(func(b engine.Batch) error {
+		set := b.UnarchiveEntry
+		if archive {
+			set = b.ArchiveEntry
+		}
+		for _, id := range ids {
+			if err := set(id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if c.Bool("json") {
+		out := make([]archivedJSON, len(ids))
+		for i, id := range ids {
+			out[i] = archivedJSON{ID: id.String(), Archived: archive}
+		}
+		if len(out) == 1 {
+			return printJSON(out[0])
+		}
+		return printJSON(out)
+	}
+	if len(ids) == 1 {
+		fmt.Printf("%s.\n", verb)
+	} else {
+		fmt.Printf("%s %d entries.\n", verb, len(ids))
+	}
+	return nil
+}
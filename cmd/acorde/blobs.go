@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/amaydixit11/acorde/internal/blob"
+	"github.com/amaydixit11/acorde/internal/cli"
+	"github.com/amaydixit11/acorde/pkg/engine"
+)
+
+// missingBlobs returns a sync.Config.WantBlobs that lists the blobs (and
+// thumbnails) of File entries not in blobs yet, e.g. synced from a peer
+func missingBlobs(e engine.Engine, blobs *blob.Store) func() []blob.CID {
+	fileType := engine.File
+	return func() []blob.CID {
+		entries, err := e.ListEntries(engine.ListFilter{Type: &fileType, Archived: true})
+		if err != nil {
+			log.Printf("[ERROR] failed to list file entries: %v", err)
+			return nil
+		}
+		var want []blob.CID
+		for _, entry := range entries {
+			fc, err := engine.ParseFileContent(entry.Content)
+			if err != nil {
+				continue
+			}
+			for _, cid := range []blob.CID{fc.CID, fc.Thumbnail} {
+				if cid != "" && !blobs.Has(cid) {
+					want = append(want, cid)
+				}
+			}
+		}
+		return want
+	}
+}
+
+// cmdBlobstoreShow prints where the vault's blobs are stored
+func cmdBlobstoreShow(c *cli.Context) error {
+	dir, err := resolveDataDir(c)
+	if err != nil {
+		return err
+	}
+	cfg, err := blob.LoadConfig(dir)
+	if err != nil {
+		return err
+	}
+	out := blobstoreJSON{Backend: "local"}
+	if cfg.Backend == "s3" {
+		out = blobstoreJSON{
+			Backend:     "s3",
+			Endpoint:    cfg.S3.Endpoint,
+			Region:      cfg.S3.Region,
+			Bucket:      cfg.S3.Bucket,
+			Prefix:      cfg.S3.Prefix,
+			CacheBytes:  cfg.CacheBytes,
+			Credentials: "environment",
+		}
+		if out.CacheBytes == 0 {
+			out.CacheBytes = blob.DefaultCacheBytes
+		}
+		if cfg.S3.AccessKey != "" {
+			out.Credentials = "config"
+		}
+	}
+
+	if c.Bool("json") {
+		return printJSON(out)
+	}
+	if out.Backend == "local" {
+		fmt.Printf("Blobs are stored locally in %s\n", filepath.Join(dir, "blobs"))
+		return nil
+	}
+	fmt.Printf("Blobs are stored in s3 bucket %s at %s\n", out.Bucket, out.Endpoint)
+	if out.Prefix != "" {
+		fmt.Printf("  Prefix:      %s\n", out.Prefix)
+	}
+	fmt.Printf("  Local cache: %s\n", formatBytes(out.CacheBytes))
+	fmt.Printf("  Credentials: %s\n", out.Credentials)
+	return nil
+}
+
+// cmdBlobstoreS3 switches the vault's blobs to an S3 bucket, checking
+// that it can be reached and uploading the blobs stored so far
+func cmdBlobstoreS3(c *cli.Context) error {
+	dir, err := resolveDataDir(c)
+	if err != nil {
+		return err
+	}
+	cfg := blob.Config{
+		Backend: "s3",
+		S3: &blob.S3Config{
+			Endpoint:  c.String("endpoint"),
+			Region:    c.String("region"),
+			Bucket:    c.String("bucket"),
+			Prefix:    c.String("prefix"),
+			AccessKey: c.String("access-key"),
+			SecretKey: c.String("secret-key"),
+		},
+		CacheBytes: int64(c.Int("cache-mb")) << 20,
+	}
+	if cfg.S3.Endpoint == "" || cfg.S3.Bucket == "" {
+		return cli.Usagef("--endpoint and --bucket are required")
+	}
+	if (cfg.S3.AccessKey == "") != (cfg.S3.SecretKey == "") {
+		return cli.Usagef("--access-key and --secret-key go together")
+	}
+
+	remote, err := blob.NewS3Backend(*cfg.S3)
+	if err != nil {
+		return err
+	}
+	if _, err := remote.List(); err != nil {
+		return fmt.Errorf("cannot reach bucket %s: %w", cfg.S3.Bucket, err)
+	}
+	store, err := blob.NewStoreWithBackend(dir, remote, cfg.CacheBytes)
+	if err != nil {
+		return err
+	}
+	uploaded, err := store.Upload()
+	if err != nil {
+		return fmt.Errorf("uploaded %d blobs, then: %w", uploaded, err)
+	}
+	if err := blob.SaveConfig(dir, cfg); err != nil {
+		return err
+	}
+	fmt.Printf("Blobs are now stored in s3 bucket %s (%d uploaded). Restart a running daemon to use it.\n", cfg.S3.Bucket, uploaded)
+	return nil
+}
+
+// cmdBlobstoreLocal switches the vault's blobs back to the local disk,
+// downloading those not cached
+func cmdBlobstoreLocal(c *cli.Context) error {
+	dir, err := resolveDataDir(c)
+	if err != nil {
+		return err
+	}
+	cfg, err := blob.LoadConfig(dir)
+	if err != nil {
+		return err
+	}
+	if cfg.Backend != "s3" {
+		fmt.Println("Blobs are already stored locally.")
+		return nil
+	}
+
+	// Read every blob through the store so it lands on disk, with a cache
+	// big enough to keep them all
+	remote, err := blob.NewS3Backend(*cfg.S3)
+	if err != nil {
+		return err
+	}
+	store, err := blob.NewStoreWithBackend(dir, remote, math.MaxInt64)
+	if err != nil {
+		return err
+	}
+	cids, err := store.List()
+	if err != nil {
+		return err
+	}
+	for _, cid := range cids {
+		if _, err := store.Get(cid); err != nil {
+			return err
+		}
+	}
+	if err := os.Remove(filepath.Join(dir, blob.ConfigFile)); err != nil {
+		return err
+	}
+	fmt.Printf("Blobs are now stored locally (%d downloaded). The bucket is left as it is.\n", len(cids))
+	return nil
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/amaydixit11/acorde/internal/cli"
+	"github.com/amaydixit11/acorde/internal/sync"
+	"github.com/amaydixit11/acorde/pkg/crypto"
+	"github.com/amaydixit11/acorde/pkg/engine"
+	p2pcrypto "github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// bundleVault is an open vault with the keys bundles need
+type bundleVault struct {
+	engine.Engine
+	dataDir  string
+	key      p2pcrypto.PrivKey // Signs bundles
+	self     peer.ID
+	vaultKey *crypto.EpochKey  // Encrypts bundles (nil if the vault is not)
+	retired  []crypto.EpochKey // Keys of earlier epochs, for older bundles
+}
+
+// openBundleVault opens the vault, unlocking it if encrypted
+func openBundleVault(c *cli.Context) (*bundleVault, error) {
+	dataDir, err := resolveDataDir(c)
+	if err != nil {
+		return nil, err
+	}
+	key, self, err := loadOrGenerateKey(dataDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load identity key: %w", err)
+	}
+	cfg, _, keys, err := unlockKeyring(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	e, err := engine.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	v := &bundleVault{Engine: e, dataDir: dataDir, key: key, self: self}
+	if len(keys) > 0 {
+		v.vaultKey, v.retired = &keys[len(keys)-1], keys[:len(keys)-1]
+	}
+	return v, nil
+}
+
+// keys decrypts bundles sealed with the vault key of any epoch
+func (v *bundleVault) keys() sync.BundleOpener {
+	opener := sync.BundleOpener{RetiredKeys: v.retired}
+	if v.vaultKey != nil {
+		opener.VaultKey = &v.vaultKey.Key
+	}
+	return opener
+}
+
+// addBundlePeerFlag registers --peer for import and apply
+func addBundlePeerFlag(fs *flag.FlagSet) {
+	fs.String("peer", "", "Also accept bundles signed by these peer IDs (comma-separated)")
+}
+
+// opener accepts bundles signed by trusted devices (in peers.json and not
+// revoked) or by the peers given with --peer
+func (v *bundleVault) opener(c *cli.Context) (sync.BundleOpener, error) {
+	allowlist, err := sync.NewAllowlist(v.dataDir, false)
+	if err != nil {
+		return sync.BundleOpener{}, err
+	}
+	extra := make(map[peer.ID]bool)
+	for _, s := range strings.Split(c.String("peer"), ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		id, err := peer.Decode(s)
+		if err != nil {
+			return sync.BundleOpener{}, cli.Usagef("invalid peer ID %q", s)
+		}
+		extra[id] = true
+	}
+
+	opener := v.keys()
+	opener.Trusted = func(id peer.ID) bool {
+		if allowlist.IsRevoked(id) {
+			return false
+		}
+		_, paired := allowlist.Get(id)
+		return paired || extra[id]
+	}
+	return opener, nil
+}
+
+func cmdBundleExport(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return cli.Usagef("expected a folder")
+	}
+	v, err := openBundleVault(c)
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	t := sync.NewDirTransport(c.Arg(0), v.self)
+	b, err := sync.SendBundle(t, &syncableEngine{v}, v.key, v.vaultKey, c.Bool("full"))
+	if err != nil {
+		return fmt.Errorf("failed to export bundle: %w", err)
+	}
+	return printBundleWritten(c, v, b, t.Path())
+}
+
+func cmdBundleCreate(c *cli.Context) error {
+	out := c.String("out")
+	if out == "" {
+		return cli.Usagef("--out is required")
+	}
+	v, err := openBundleVault(c)
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	since := c.Uint64("since")
+	state := (&syncableEngine{v}).GetSyncDelta(since)
+	opts := sync.BundleOptions{Since: since}
+	if v.vaultKey != nil {
+		opts.VaultKey, opts.KeyEpoch = &v.vaultKey.Key, v.vaultKey.Epoch
+	}
+	b, err := sync.NewBundle(state, v.key, opts)
+	if err != nil {
+		return err
+	}
+	if err := sync.WriteBundle(out, b); err != nil {
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+	return printBundleWritten(c, v, b, out)
+}
+
+// printBundleWritten reports a bundle written by export or create
+func printBundleWritten(c *cli.Context, v *bundleVault, b *sync.Bundle, path string) error {
+	out, err := describeBundle(b, path, v.keys())
+	if err != nil {
+		return err
+	}
+	if c.Bool("json") {
+		return printJSON(out)
+	}
+
+	what := fmt.Sprintf("changes since %d", b.Since)
+	if b.Since == 0 {
+		what = "the whole vault"
+	}
+	fmt.Printf("📦 Wrote %d entries (%s) to %s\n", out.Entries, what, path)
+	if !b.Encrypted() {
+		fmt.Fprintln(os.Stderr, "⚠️  The vault is not encrypted, so neither is the bundle")
+	}
+	fmt.Printf("   Signed by %s; next time use --since %d\n", b.Peer, b.Clock)
+	return nil
+}
+
+func cmdBundleImport(c *cli.Context) error {
+	if c.NArg() == 0 {
+		return cli.Usagef("expected a folder or bundle file")
+	}
+	return mergeBundles(c, true)
+}
+
+func cmdBundleApply(c *cli.Context) error {
+	if c.NArg() == 0 {
+		return cli.Usagef("expected a bundle file")
+	}
+	return mergeBundles(c, false)
+}
+
+// mergeBundles merges the bundle files given as arguments, and with dirs
+// the bundles other devices left in folders given as arguments
+func mergeBundles(c *cli.Context, dirs bool) error {
+	v, err := openBundleVault(c)
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+	opener, err := v.opener(c)
+	if err != nil {
+		return err
+	}
+
+	target := &syncableEngine{v}
+	out := []bundleJSON{}
+	for _, path := range c.Args {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		var bundles []*sync.Bundle
+		switch {
+		case fi.IsDir() && dirs:
+			bundles, err = sync.ReceiveBundles(sync.NewDirTransport(path, v.self), target, opener)
+		case fi.IsDir():
+			return cli.Usagef("%s is a folder: use 'acorde bundle import' for folders", path)
+		default:
+			bundles, err = applyBundleFile(path, v.self, target, opener)
+		}
+		if err != nil {
+			return err
+		}
+		for _, b := range bundles {
+			desc, err := describeBundle(b, path, v.keys())
+			if err != nil {
+				return err
+			}
+			out = append(out, desc)
+		}
+	}
+
+	if c.Bool("json") {
+		return printJSON(out)
+	}
+	if len(out) == 0 {
+		fmt.Println("No bundles from other devices found.")
+		return nil
+	}
+	for _, b := range out {
+		fmt.Printf("📥 Merged %d entries from %s (%s)\n", b.Entries, shortID(b.Peer), b.Created)
+	}
+	return nil
+}
+
+// applyBundleFile verifies and merges a bundle file, unless self created it
+func applyBundleFile(path string, self peer.ID, target sync.Syncable, opener sync.BundleOpener) ([]*sync.Bundle, error) {
+	b, err := sync.ReadBundle(path)
+	if err != nil {
+		return nil, err
+	}
+	if b.Peer == self.String() {
+		return nil, nil
+	}
+	state, err := opener.Open(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := sync.MergeBundleState(target, b, state); err != nil {
+		return nil, fmt.Errorf("failed to merge bundle: %w", err)
+	}
+	return []*sync.Bundle{b}, nil
+}
+
+// describeBundle summarizes a bundle for output
+func describeBundle(b *sync.Bundle, path string, keys sync.BundleOpener) (bundleJSON, error) {
+	state, err := b.ReplicaState(keys.KeyFor(b))
+	if err != nil {
+		return bundleJSON{}, err
+	}
+	return bundleJSON{
+		Path:      path,
+		Peer:      b.Peer,
+		Created:   formatTime(b.Created),
+		Since:     b.Since,
+		Clock:     b.Clock,
+		Entries:   len(state.Entries),
+		Encrypted: b.Encrypted(),
+	}, nil
+}
@@ -0,0 +1,19 @@
+//go:build !dev
+
+package main
+
+import (
+	"flag"
+
+	"github.com/amaydixit11/acorde/internal/cli"
+	"github.com/amaydixit11/acorde/internal/sync"
+)
+
+// addChaosFlag is a no-op outside dev builds, so release daemons never
+// inject sync faults
+func addChaosFlag(fs *flag.FlagSet) {}
+
+// chaosConfig is always nil outside dev builds
+func chaosConfig(c *cli.Context) (*sync.ChaosConfig, error) {
+	return nil, nil
+}
@@ -0,0 +1,32 @@
+//go:build dev
+
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/amaydixit11/acorde/internal/cli"
+	"github.com/amaydixit11/acorde/internal/sync"
+)
+
+// addChaosFlag registers --chaos on dev builds (go build -tags dev). It
+// injects faults into sync traffic, e.g.
+// --chaos drop=0.1,dup=0.05,reorder=0.2,delay=10ms-200ms
+func addChaosFlag(fs *flag.FlagSet) {
+	fs.String("chaos", "", "Inject sync faults: drop=P,dup=P,reorder=P,delay=MIN-MAX,seed=N (dev builds only)")
+}
+
+// chaosConfig parses --chaos, or returns nil when it is not set
+func chaosConfig(c *cli.Context) (*sync.ChaosConfig, error) {
+	spec := c.String("chaos")
+	if spec == "" {
+		return nil, nil
+	}
+	cfg, err := sync.ParseChaosConfig(spec)
+	if err != nil {
+		return nil, cli.Usagef("invalid --chaos: %v", err)
+	}
+	log.Printf("⚠️  Chaos injection enabled: %s", spec)
+	return cfg, nil
+}
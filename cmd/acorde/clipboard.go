@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/amaydixit11/acorde/internal/cli"
+	"github.com/amaydixit11/acorde/pkg/engine"
+)
+
+// defaultClearAfter is how long get --copy leaves a value on the clipboard
+const defaultClearAfter = 45 * time.Second
+
+// clipboardTool is a command that writes its stdin to the clipboard, and
+// one that prints the clipboard
+type clipboardTool struct {
+	copy  []string
+	paste []string
+}
+
+// findClipboard picks the system clipboard tool
+func findClipboard() (clipboardTool, error) {
+	var candidates []clipboardTool
+	switch runtime.GOOS {
+	case "darwin":
+		candidates = []clipboardTool{{copy: []string{"pbcopy"}, paste: []string{"pbpaste"}}}
+	case "windows":
+		candidates = []clipboardTool{{
+			copy:  []string{"powershell", "-NoProfile", "-Command", "$input | Set-Clipboard"},
+			paste: []string{"powershell", "-NoProfile", "-Command", "Get-Clipboard -Raw"},
+		}}
+	default:
+		if os.Getenv("WAYLAND_DISPLAY") != "" {
+			candidates = append(candidates, clipboardTool{copy: []string{"wl-copy"}, paste: []string{"wl-paste", "--no-newline"}})
+		}
+		candidates = append(candidates,
+			clipboardTool{copy: []string{"xclip", "-selection", "clipboard"}, paste: []string{"xclip", "-selection", "clipboard", "-o"}},
+			clipboardTool{copy: []string{"xsel", "--clipboard", "--input"}, paste: []string{"xsel", "--clipboard", "--output"}},
+		)
+	}
+	for _, tool := range candidates {
+		if _, err := exec.LookPath(tool.copy[0]); err == nil {
+			return tool, nil
+		}
+	}
+	return clipboardTool{}, errors.New("no clipboard tool found (install wl-clipboard, xclip or xsel)")
+}
+
+func (t clipboardTool) write(value string) error {
+	// No output pipes: xclip and wl-copy fork to serve the selection, and
+	// would hold them open
+	cmd := exec.Command(t.copy[0], t.copy[1:]...)
+	cmd.Stdin = strings.NewReader(value)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to copy to clipboard: %w", err)
+	}
+	return nil
+}
+
+func (t clipboardTool) read() (string, error) {
+	out, err := exec.Command(t.paste[0], t.paste[1:]...).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to read clipboard: %w", err)
+	}
+	return string(out), nil
+}
+
+// clipboardMatch identifies a copied value without holding on to it: an
+// HMAC under a random key, so the hash of a short secret can't be
+// brute-forced by whoever sees it
+type clipboardMatch struct {
+	key []byte
+	mac []byte
+}
+
+func newClipboardMatch(value string) (clipboardMatch, error) {
+	m := clipboardMatch{key: make([]byte, 32)}
+	if _, err := rand.Read(m.key); err != nil {
+		return clipboardMatch{}, err
+	}
+	m.mac = m.sum(value)
+	return m, nil
+}
+
+func (m clipboardMatch) sum(value string) []byte {
+	h := hmac.New(sha256.New, m.key)
+	h.Write([]byte(value))
+	return h.Sum(nil)
+}
+
+// holds reports whether the clipboard content is the copied value
+// (ignoring a trailing newline some paste tools add)
+func (m clipboardMatch) holds(current string) bool {
+	return hmac.Equal(m.sum(current), m.mac) || hmac.Equal(m.sum(strings.TrimRight(current, "\r\n")), m.mac)
+}
+
+// String encodes the match as sent to clipboard-clear on its stdin
+func (m clipboardMatch) String() string {
+	return hex.EncodeToString(m.key) + " " + hex.EncodeToString(m.mac) + "\n"
+}
+
+// readClipboardMatch decodes a match sent by clearClipboardLater
+func readClipboardMatch(f *os.File) (clipboardMatch, error) {
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil {
+		return clipboardMatch{}, err
+	}
+	keyHex, macHex, ok := strings.Cut(strings.TrimSpace(line), " ")
+	if !ok {
+		return clipboardMatch{}, errors.New("malformed clipboard match")
+	}
+	var m clipboardMatch
+	if m.key, err = hex.DecodeString(keyHex); err != nil {
+		return clipboardMatch{}, err
+	}
+	if m.mac, err = hex.DecodeString(macHex); err != nil {
+		return clipboardMatch{}, err
+	}
+	return m, nil
+}
+
+// copyField returns what get --copy copies from an entry: a field of JSON
+// object content (for credentials, the password by default), or all of
+// the content
+func copyField(entry engine.Entry, field string) (string, string, error) {
+	if field == "" && entry.Type == engine.Credential {
+		field = "password"
+	}
+	if field == "" {
+		return "content", string(entry.Content), nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(entry.Content, &fields); err != nil {
+		return "", "", fmt.Errorf("--field needs JSON object content: %w", err)
+	}
+	raw, ok := fields[field]
+	if !ok {
+		return "", "", fmt.Errorf("entry %s has no field %q", entry.ID, field)
+	}
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		value = string(raw) // Numbers and such, as written
+	}
+	if value == "" {
+		return "", "", fmt.Errorf("field %q of entry %s is empty", field, entry.ID)
+	}
+	return field, value, nil
+}
+
+// cmdGetCopy copies an entry field to the clipboard without printing it,
+// and starts a background process to clear it
+func cmdGetCopy(c *cli.Context, entry engine.Entry) error {
+	field, value, err := copyField(entry, c.String("field"))
+	if err != nil {
+		return err
+	}
+	clearAfter := c.Duration("clear-after")
+	if clearAfter < 0 {
+		return cli.Usagef("--clear-after must not be negative")
+	}
+
+	tool, err := findClipboard()
+	if err != nil {
+		return err
+	}
+	if err := tool.write(value); err != nil {
+		return err
+	}
+	if clearAfter > 0 {
+		if err := clearClipboardLater(clearAfter, value); err != nil {
+			tool.write("")
+			return fmt.Errorf("failed to schedule clipboard clearing (cleared now): %w", err)
+		}
+	}
+
+	if c.Bool("json") {
+		return printJSON(copiedJSON{ID: entry.ID.String(), Field: field, ClearAfter: clearAfter.Seconds()})
+	}
+	if clearAfter > 0 {
+		fmt.Printf("📋 Copied %s of %s to the clipboard; clearing in %s\n", field, entry.ID, clearAfter)
+	} else {
+		fmt.Printf("📋 Copied %s of %s to the clipboard\n", field, entry.ID)
+	}
+	return nil
+}
+
+// clearClipboardLater starts a detached "acorde clipboard-clear" to clear
+// the clipboard after a delay if it still holds the copied value. What
+// identifies the value goes through a pipe on the child's stdin, never
+// its command line, which other local users can read.
+func clearClipboardLater(after time.Duration, value string) error {
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	match, err := newClipboardMatch(value)
+	if err != nil {
+		return err
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	// Fits the pipe buffer: written in full before the child starts
+	_, err = w.WriteString(match.String())
+	w.Close()
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(self, "clipboard-clear", "--after", after.String(), "--match-stdin")
+	cmd.Stdin = r
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	return cmd.Process.Release()
+}
+
+func cmdClipboardClear(c *cli.Context) error {
+	var match *clipboardMatch
+	if c.Bool("match-stdin") {
+		m, err := readClipboardMatch(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("failed to read clipboard match: %w", err)
+		}
+		match = &m
+	}
+	time.Sleep(c.Duration("after"))
+	tool, err := findClipboard()
+	if err != nil {
+		return err
+	}
+	if match != nil {
+		// Leave anything copied since alone; clear if unsure
+		current, err := tool.read()
+		if err == nil && !match.holds(current) {
+			return nil
+		}
+	}
+	return tool.write("")
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/amaydixit11/acorde/internal/cli"
+	"github.com/amaydixit11/acorde/pkg/engine"
+	"github.com/google/uuid"
+)
+
+func cmdCollectionsCreate(c *cli.Context, e engine.Engine) error {
+	if c.NArg() != 1 {
+		return cli.Usagef("expected a collection path")
+	}
+	// Create the missing collections along the path
+	parent := engine.Collection{Path: "/"}
+	created := false
+	for _, name := range strings.Split(c.Arg(0), "/") {
+		if name == "" {
+			continue
+		}
+		next, err := e.ResolveCollection(strings.TrimSuffix(parent.Path, "/") + "/" + name)
+		if errors.Is(err, engine.ErrCollectionNotFound) {
+			next, err = e.CreateCollection(name, parent.ID)
+			created = true
+		}
+		if err != nil {
+			return err
+		}
+		parent = next
+	}
+	if parent.ID == uuid.Nil {
+		return cli.Usagef("expected a collection path")
+	}
+	if !created {
+		return fmt.Errorf("%w: %s", engine.ErrCollectionExists, parent.Path)
+	}
+	if c.Bool("json") {
+		return printJSON(toCollectionJSON(parent))
+	}
+	fmt.Printf("Created %s\n", parent.Path)
+	return nil
+}
+
+func cmdCollectionsList(c *cli.Context, e engine.Engine) error {
+	collections, err := e.ListCollections()
+	if err != nil {
+		return err
+	}
+	if c.Bool("json") {
+		out := make([]collectionJSON, len(collections))
+		for i, collection := range collections {
+			out[i] = toCollectionJSON(collection)
+		}
+		return printJSON(out)
+	}
+	if len(collections) == 0 {
+		fmt.Println("No collections.")
+		return nil
+	}
+	for _, collection := range collections {
+		fmt.Println(collection.Path)
+	}
+	return nil
+}
+
+// cmdCollectionsAdd files entries in a collection ("/" = in none)
+func cmdCollectionsAdd(c *cli.Context, e engine.Engine) error {
+	if c.NArg() < 2 {
+		return cli.Usagef("expected a collection path and at least one entry ID")
+	}
+	collection, err := e.ResolveCollection(c.Arg(0))
+	if err != nil {
+		return err
+	}
+	ids := make([]uuid.UUID, 0, c.NArg()-1)
+	for _, arg := range c.Args[1:] {
+		id, err := parseEntryID(e, arg)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, id)
+	}
+	out := make([]filedJSON, 0, len(ids))
+	for _, id := range ids {
+		if err := e.MoveEntry(id, collection.ID); err != nil {
+			return err
+		}
+		out = append(out, filedJSON{ID: id.String(), Collection: collection.Path})
+	}
+	if c.Bool("json") {
+		return printJSON(out)
+	}
+	fmt.Printf("Filed %d entries in %s\n", len(ids), collection.Path)
+	return nil
+}
+
+func cmdCollectionsMove(c *cli.Context, e engine.Engine) error {
+	if c.NArg() != 2 {
+		return cli.Usagef("expected a collection path and the path of its new parent")
+	}
+	collection, err := resolveCollectionArg(e, c.Arg(0))
+	if err != nil {
+		return err
+	}
+	parent, err := e.ResolveCollection(c.Arg(1))
+	if err != nil {
+		return err
+	}
+	moved, err := e.MoveCollection(collection.ID, parent.ID)
+	if err != nil {
+		return err
+	}
+	if c.Bool("json") {
+		return printJSON(toCollectionJSON(moved))
+	}
+	fmt.Printf("Moved to %s\n", moved.Path)
+	return nil
+}
+
+func cmdCollectionsRename(c *cli.Context, e engine.Engine) error {
+	if c.NArg() != 2 {
+		return cli.Usagef("expected a collection path and a new name")
+	}
+	collection, err := resolveCollectionArg(e, c.Arg(0))
+	if err != nil {
+		return err
+	}
+	renamed, err := e.RenameCollection(collection.ID, c.Arg(1))
+	if err != nil {
+		return err
+	}
+	if c.Bool("json") {
+		return printJSON(toCollectionJSON(renamed))
+	}
+	fmt.Printf("Renamed to %s\n", renamed.Path)
+	return nil
+}
+
+func cmdCollectionsDelete(c *cli.Context, e engine.Engine) error {
+	if c.NArg() != 1 {
+		return cli.Usagef("expected a collection path")
+	}
+	collection, err := resolveCollectionArg(e, c.Arg(0))
+	if err != nil {
+		return err
+	}
+	if err := e.DeleteCollection(collection.ID); err != nil {
+		return err
+	}
+	if c.Bool("json") {
+		return printJSON(deletedCollectionJSON{Path: collection.Path, Deleted: true})
+	}
+	fmt.Println("Deleted.")
+	return nil
+}
+
+// resolveCollectionArg resolves a path naming a collection, rather than
+// the top level
+func resolveCollectionArg(e engine.Engine, path string) (engine.Collection, error) {
+	collection, err := e.ResolveCollection(path)
+	if err == nil && collection.ID == uuid.Nil {
+		err = cli.Usagef("expected a collection path, not the top level")
+	}
+	return collection, err
+}
+
+// collectionPaths returns the paths of the vault's collections by ID
+func collectionPaths(e engine.Engine) (map[uuid.UUID]string, error) {
+	collections, err := e.ListCollections()
+	if err != nil {
+		return nil, err
+	}
+	paths := make(map[uuid.UUID]string, len(collections))
+	for _, collection := range collections {
+		paths[collection.ID] = collection.Path
+	}
+	return paths, nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/amaydixit11/acorde/internal/cli"
+)
+
+// envFlags are the flags environment variables set, overriding the config
+// file but not the command line
+var envFlags = map[string]string{
+	"data":      "ACORDE_DATA_DIR",
+	"api-token": "ACORDE_API_TOKEN",
+}
+
+// secretFlags are masked by config show
+var secretFlags = map[string]bool{
+	"api-token":        true,
+	"namespace-tokens": true,
+}
+
+// maskedValue replaces secrets in config output, like masked credentials
+const maskedValue = "********"
+
+// configFile returns the config file of flag defaults: --config, or
+// acorde/config.json in the user's config directory ($XDG_CONFIG_HOME or
+// ~/.config on Linux)
+func configFile(c *cli.Context) (string, error) {
+	if path := c.String("config"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", nil // No home directory: no config file
+	}
+	return filepath.Join(dir, "acorde", "config.json"), nil
+}
+
+// expandHome expands a leading ~/ in paths from the config file or the
+// environment, where no shell does
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[2:])
+}
+
+// loadConfig opens the command line's config file
+func loadConfig(c *cli.Context) (*cli.Config, error) {
+	path, err := configFile(c)
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		return nil, fmt.Errorf("no config directory: use --config")
+	}
+	return cli.LoadConfig(path)
+}
+
+func cmdConfigShow(c *cli.Context) error {
+	config, err := loadConfig(c)
+	if err != nil {
+		return err
+	}
+	out := toConfigJSON(config)
+	if c.Bool("json") {
+		return printJSON(out)
+	}
+
+	fmt.Printf("Config file: %s\n", out.Path)
+	if len(out.Settings) == 0 {
+		fmt.Println("  (no settings)")
+	}
+	printSettings(out.Settings)
+	if len(out.Env) > 0 {
+		fmt.Println("Environment (overrides the config file):")
+		printSettings(out.Env)
+	}
+	return nil
+}
+
+// printSettings lists key = value lines, sorted
+func printSettings(settings map[string]string) {
+	keys := make([]string, 0, len(settings))
+	width := 0
+	for k := range settings {
+		keys = append(keys, k)
+		width = max(width, len(k))
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Printf("  %-*s = %s\n", width, k, settings[k])
+	}
+}
+
+func cmdConfigSet(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return cli.Usagef("expected a key and a value, e.g. daemon.port 4001")
+	}
+	key, value := c.Arg(0), c.Arg(1)
+	typed, err := c.App.ConfigValue(key, value)
+	if err != nil {
+		return cli.Usagef("%v", err)
+	}
+	config, err := loadConfig(c)
+	if err != nil {
+		return err
+	}
+	config.Set(key, typed)
+	if err := config.Save(); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+
+	if c.Bool("json") {
+		return printJSON(toConfigJSON(config))
+	}
+	if secretFlags[lastKeyPart(key)] {
+		value = maskedValue
+	}
+	fmt.Printf("✓ Set %s = %s in %s\n", key, value, config.Path)
+	return nil
+}
+
+func cmdConfigUnset(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return cli.Usagef("expected a key")
+	}
+	config, err := loadConfig(c)
+	if err != nil {
+		return err
+	}
+	key := c.Arg(0)
+	if !config.Unset(key) {
+		return fmt.Errorf("%s is not set in %s", key, config.Path)
+	}
+	if err := config.Save(); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+
+	if c.Bool("json") {
+		return printJSON(toConfigJSON(config))
+	}
+	fmt.Printf("✓ Unset %s in %s\n", key, config.Path)
+	return nil
+}
+
+func toConfigJSON(config *cli.Config) configJSON {
+	out := configJSON{Path: config.Path, Settings: config.Settings(), Env: map[string]string{}}
+	for key := range out.Settings {
+		if secretFlags[lastKeyPart(key)] {
+			out.Settings[key] = maskedValue
+		}
+	}
+	for name, env := range envFlags {
+		if value := os.Getenv(env); value != "" {
+			if secretFlags[name] {
+				value = maskedValue
+			}
+			out.Env[env] = value
+		}
+	}
+	return out
+}
+
+// lastKeyPart returns the flag name of a config key
+func lastKeyPart(key string) string {
+	return key[strings.LastIndex(key, ".")+1:]
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/amaydixit11/acorde/internal/cli"
+	"github.com/amaydixit11/acorde/pkg/engine"
+	"golang.org/x/term"
+)
+
+// confirmAbove is the number of entries a destructive command changes
+// without asking for confirmation
+const confirmAbove = 10
+
+// addConfirmFlags registers --dry-run and --yes
+func addConfirmFlags(fs *flag.FlagSet) {
+	fs.Bool("dry-run", false, "Print what would change without changing anything")
+	fs.Bool("yes", false, "Do not ask for confirmation")
+}
+
+// confirmChanges decides whether a command changing n entries goes ahead.
+// Up to confirmAbove entries, or with --yes, it does. Otherwise the user
+// is asked; without a terminal to ask on, the command fails.
+func confirmChanges(c *cli.Context, verb string, n int) (bool, error) {
+	if n <= confirmAbove {
+		return true, nil
+	}
+	return askChanges(c, verb, n)
+}
+
+// askChanges is confirmChanges for any number of entries: unless --yes
+// is given, the user is always asked
+func askChanges(c *cli.Context, verb string, n int) (bool, error) {
+	if c.Bool("yes") {
+		return true, nil
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return false, fmt.Errorf("refusing to %s %d entries without confirmation: rerun with --yes, or --dry-run to review them", verb, n)
+	}
+	return confirm(fmt.Sprintf("%s %d entries? [y/N] ", capitalize(verb), n), false), nil
+}
+
+// confirm asks a yes/no question on stderr and reads the answer from
+// stdin. An empty answer is def; no input at all (EOF) is no.
+func confirm(prompt string, def bool) bool {
+	fmt.Fprint(os.Stderr, prompt)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && answer == "" {
+		fmt.Fprintln(os.Stderr)
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	case "n", "no":
+		return false
+	}
+	return def
+}
+
+// describe summarizes an entry on one line, as list prints it (masked)
+func describe(entry engine.Entry) string {
+	content := entry.Content
+	if entry.Type == engine.Credential {
+		content = engine.MaskCredential(content)
+	}
+	return fmt.Sprintf("%s [%s] %s", entry.ID, entry.Type, string(content)[:min(40, len(content))])
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/amaydixit11/acorde/internal/cli"
+	"github.com/amaydixit11/acorde/pkg/engine"
+)
+
+func cmdDoctor(c *cli.Context, e engine.Engine) error {
+	report, err := e.VerifyIntegrity()
+	if err != nil {
+		return err
+	}
+
+	if c.Bool("json") {
+		if err := printJSON(report); err != nil {
+			return err
+		}
+	} else {
+		fmt.Printf("Checked %d entries and %d versions.\n", report.Entries, report.Versions)
+		for _, corrupt := range report.Corrupt {
+			where := "content"
+			if corrupt.Version != 0 {
+				where = fmt.Sprintf("version %d", corrupt.Version)
+			}
+			fmt.Printf("  %s [%s] %s: %s\n", corrupt.ID, corrupt.Type, where, corrupt.Error)
+		}
+	}
+
+	if n := len(report.Corrupt); n > 0 {
+		return fmt.Errorf("found %d corrupt entries or versions", n)
+	}
+	if !c.Bool("json") {
+		fmt.Println("No problems found.")
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/amaydixit11/acorde/internal/cli"
+	"github.com/amaydixit11/acorde/pkg/engine"
+)
+
+func cmdEdit(c *cli.Context, e engine.Engine) error {
+	id, err := entryIDArg(c, e)
+	if err != nil {
+		return err
+	}
+	entry, err := e.GetEntry(id)
+	if err != nil {
+		return err
+	}
+	if entry.Type == engine.File {
+		return fmt.Errorf("file entries reference a blob; replace it with 'acorde update %s --content-file <path>'", id)
+	}
+
+	// The decrypted content lives only in a private directory (0700) that
+	// is removed when the editor is done
+	dir, err := os.MkdirTemp("", "acorde-edit-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, id.String()+editExt(entry))
+	if err := os.WriteFile(path, entry.Content, 0600); err != nil {
+		return err
+	}
+	defer wipe(path)
+
+	for {
+		if err := runEditor(path); err != nil {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(content, entry.Content) {
+			fmt.Fprintln(info(c), "No changes.")
+			if c.Bool("json") {
+				return printJSON(toEntryJSON(masked(c, entry)))
+			}
+			return nil
+		}
+
+		err = e.UpdateEntry(id, engine.UpdateEntryInput{Content: &content})
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, engine.ErrSchemaValidation) {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		if !confirm("Edit again? [Y/n] ", true) {
+			return fmt.Errorf("changes discarded: %w", err)
+		}
+	}
+
+	if c.Bool("json") {
+		entry, err := e.GetEntry(id)
+		if err != nil {
+			return err
+		}
+		return printJSON(toEntryJSON(masked(c, entry)))
+	}
+	fmt.Println("Updated.")
+	return nil
+}
+
+// editExt picks a file extension so that the editor highlights content
+func editExt(entry engine.Entry) string {
+	switch {
+	case json.Valid(entry.Content) && len(bytes.TrimSpace(entry.Content)) > 0:
+		return ".json"
+	case entry.Type == engine.Note:
+		return ".md"
+	}
+	return ".txt"
+}
+
+// runEditor opens path in $VISUAL or $EDITOR, which may include arguments
+// (e.g. "code --wait"), and waits for it to exit
+func runEditor(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+		if runtime.GOOS == "windows" {
+			editor = "notepad"
+		}
+	}
+	args := strings.Fields(editor)
+	cmd := exec.Command(args[0], append(args[1:], path)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("editor %q failed: %w", editor, err)
+	}
+	return nil
+}
+
+// wipe overwrites a file with zeros before it is removed. Editors may
+// have written other copies (swap and backup files), which go with the
+// temporary directory.
+func wipe(path string) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return
+	}
+	f.Write(make([]byte, fi.Size()))
+	f.Close()
+}
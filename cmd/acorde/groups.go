@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/amaydixit11/acorde/internal/cli"
+	"github.com/amaydixit11/acorde/pkg/engine"
+)
+
+func cmdGroupsCreate(c *cli.Context, e engine.Engine) error {
+	if c.NArg() < 1 {
+		return cli.Usagef("missing group name")
+	}
+	group, err := e.CreateGroup(c.Arg(0), c.Args[1:])
+	if err != nil {
+		return err
+	}
+	if c.Bool("json") {
+		return printJSON(toGroupJSON(group))
+	}
+	fmt.Printf("Created group %s (%d member(s))\n", group.Name, len(group.Members))
+	return nil
+}
+
+func cmdGroupsList(c *cli.Context, e engine.Engine) error {
+	groups, err := e.ListGroups()
+	if err != nil {
+		return err
+	}
+	if c.Bool("json") {
+		out := make([]groupJSON, len(groups))
+		for i, group := range groups {
+			out[i] = toGroupJSON(group)
+		}
+		return printJSON(out)
+	}
+	if len(groups) == 0 {
+		fmt.Println("No groups.")
+		return nil
+	}
+	for _, group := range groups {
+		fmt.Printf("%s (%d): %s\n", group.Name, len(group.Members), strings.Join(group.Members, ", "))
+	}
+	return nil
+}
+
+func cmdGroupsShow(c *cli.Context, e engine.Engine) error {
+	if c.NArg() != 1 {
+		return cli.Usagef("expected a group name")
+	}
+	group, err := e.GetGroup(c.Arg(0))
+	if err != nil {
+		return err
+	}
+	if c.Bool("json") {
+		return printJSON(toGroupJSON(group))
+	}
+	fmt.Printf("%s\n", group.Name)
+	for _, member := range group.Members {
+		fmt.Printf("  %s\n", member)
+	}
+	return nil
+}
+
+// cmdGroupsMembers returns the run function of groups add (add = true)
+// and groups remove
+func cmdGroupsMembers(add bool) func(*cli.Context, engine.Engine) error {
+	return func(c *cli.Context, e engine.Engine) error {
+		if c.NArg() < 2 {
+			return cli.Usagef("expected a group name and at least one peer ID")
+		}
+		var group engine.Group
+		var err error
+		if add {
+			group, err = e.UpdateGroup(c.Arg(0), c.Args[1:], nil)
+		} else {
+			group, err = e.UpdateGroup(c.Arg(0), nil, c.Args[1:])
+		}
+		if err != nil {
+			return err
+		}
+		if c.Bool("json") {
+			return printJSON(toGroupJSON(group))
+		}
+		fmt.Printf("Group %s has %d member(s).\n", group.Name, len(group.Members))
+		return nil
+	}
+}
+
+func cmdGroupsDelete(c *cli.Context, e engine.Engine) error {
+	if c.NArg() != 1 {
+		return cli.Usagef("expected a group name")
+	}
+	if err := e.DeleteGroup(c.Arg(0)); err != nil {
+		return err
+	}
+	if c.Bool("json") {
+		return printJSON(deletedGroupJSON{Name: c.Arg(0), Deleted: true})
+	}
+	fmt.Println("Deleted.")
+	return nil
+}
+
+func cmdGroupsGrant(c *cli.Context, e engine.Engine) error {
+	if c.NArg() != 2 {
+		return cli.Usagef("expected an entry ID and a group name")
+	}
+	id, err := entryIDArg(c, e)
+	if err != nil {
+		return err
+	}
+	write := c.Bool("write")
+	if err := e.GrantGroup(id, c.Arg(1), write); err != nil {
+		return err
+	}
+	access := "read"
+	if write {
+		access = "write"
+	}
+	if c.Bool("json") {
+		return printJSON(groupGrantJSON{ID: id.String(), Group: c.Arg(1), Access: access})
+	}
+	fmt.Printf("Group %s can now %s the entry.\n", c.Arg(1), access)
+	return nil
+}
+
+func cmdGroupsRevoke(c *cli.Context, e engine.Engine) error {
+	if c.NArg() != 2 {
+		return cli.Usagef("expected an entry ID and a group name")
+	}
+	id, err := entryIDArg(c, e)
+	if err != nil {
+		return err
+	}
+	if err := e.RevokeGroup(id, c.Arg(1)); err != nil {
+		return err
+	}
+	if c.Bool("json") {
+		return printJSON(groupGrantJSON{ID: id.String(), Group: c.Arg(1), Access: "none"})
+	}
+	fmt.Println("Revoked.")
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/amaydixit11/acorde/internal/sync"
+	"github.com/amaydixit11/acorde/pkg/api"
+	"github.com/amaydixit11/acorde/pkg/crypto"
+	"github.com/amaydixit11/acorde/pkg/engine"
+)
+
+// vaultCheck fails when the vault is encrypted but was opened without
+// its key
+func vaultCheck(dataDir string, cfg engine.Config) api.ReadinessCheck {
+	return api.ReadinessCheck{Name: "vault", Critical: true, Check: func() error {
+		if cfg.EncryptionKey == nil && crypto.NewFileKeyStore(dataDir).IsInitialized() {
+			return errors.New("vault is locked")
+		}
+		return nil
+	}}
+}
+
+// syncCheck fails unless the sync service is running
+func syncCheck(running *atomic.Bool) api.ReadinessCheck {
+	return api.ReadinessCheck{Name: "sync", Critical: true, Check: func() error {
+		if !running.Load() {
+			return errors.New("sync service is not running")
+		}
+		return nil
+	}}
+}
+
+// peersCheck degrades readiness when every known peer is backing off or
+// quarantined, so sync is not getting anywhere
+func peersCheck(svc sync.SyncService) api.ReadinessCheck {
+	return api.ReadinessCheck{Name: "peers", Check: func() error {
+		health := svc.PeerHealth()
+		for _, h := range health {
+			if h.Status == sync.PeerOK {
+				return nil
+			}
+		}
+		if len(health) > 0 {
+			return fmt.Errorf("all %d known peers are backing off or quarantined", len(health))
+		}
+		return nil
+	}}
+}
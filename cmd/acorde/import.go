@@ -0,0 +1,124 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/amaydixit11/acorde/internal/cli"
+	"github.com/amaydixit11/acorde/pkg/engine"
+)
+
+// addFilterFlags registers the entry selection flags shared by export and
+// import
+func addFilterFlags(fs *flag.FlagSet) {
+	fs.String("type", "", "Only entries of these types (comma-separated)")
+	fs.String("tag", "", "Only entries with any of these tags (comma-separated)")
+	fs.String("since", "", "Only entries created on or after this date (YYYY-MM-DD or RFC 3339)")
+	fs.String("until", "", "Only entries created before this date (YYYY-MM-DD or RFC 3339)")
+}
+
+// filterFlags builds the filter given by the flags from addFilterFlags
+func filterFlags(c *cli.Context) (engine.ExportFilter, error) {
+	filter := engine.ExportFilter{
+		Types: splitTags(c.String("type")),
+		Tags:  splitTags(c.String("tag")),
+	}
+	for _, t := range filter.Types {
+		if !engine.EntryType(t).IsValid() {
+			return filter, cli.Usagef("invalid --type %q", t)
+		}
+	}
+	var err error
+	if filter.Since, err = parseDate("since", c.String("since")); err != nil {
+		return filter, err
+	}
+	if filter.Until, err = parseDate("until", c.String("until")); err != nil {
+		return filter, err
+	}
+	if !filter.Since.IsZero() && !filter.Until.IsZero() && !filter.Since.Before(filter.Until) {
+		return filter, cli.Usagef("--since must be before --until")
+	}
+	return filter, nil
+}
+
+// parseDate parses a date flag: a local day (YYYY-MM-DD, meaning its
+// start) or an RFC 3339 time. An empty value is the zero time.
+func parseDate(name, s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation(time.DateOnly, s, time.Local); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, cli.Usagef("invalid --%s %q (use YYYY-MM-DD or RFC 3339)", name, s)
+	}
+	return t, nil
+}
+
+func cmdImport(c *cli.Context, e engine.Engine) error {
+	if c.NArg() != 1 {
+		return cli.Usagef("expected a file to import")
+	}
+	path := c.Arg(0)
+	filter, err := filterFlags(c)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	importer := engine.NewImporter()
+	var entries []engine.ExportEntry
+	if from := c.String("from"); from != "" {
+		format := engine.PasswordFormat(from)
+		if from == "auto" {
+			format = ""
+		}
+		entries, err = importer.ImportPasswords(f, format)
+	} else if strings.EqualFold(filepath.Ext(path), ".csv") {
+		entries, err = importer.ImportFromCSV(f)
+	} else {
+		entries, err = importer.ImportFromJSON(f)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	dryRun := c.Bool("dry-run")
+	result, err := engine.ImportEntries(e, entries, engine.ImportOptions{
+		Filter:      filter,
+		OnCollision: engine.CollisionPolicy(c.String("on-conflict")),
+		OnDuplicate: engine.CollisionPolicy(c.String("on-duplicate")),
+		DryRun:      dryRun,
+	})
+	if err != nil {
+		return err
+	}
+
+	if c.Bool("json") {
+		return printJSON(importJSON{File: path, DryRun: dryRun, ImportResult: result})
+	}
+	verb := "Imported"
+	if dryRun {
+		verb = "Would import"
+	}
+	fmt.Printf("✅ %s %d of %d entries from %s (%d skipped, %d merged, %d failed)\n",
+		verb, result.Imported, result.TotalRead, path, result.Skipped, result.Merged, result.Failed)
+	if matched := result.MatchedByID + result.MatchedByContent; matched > 0 {
+		fmt.Printf("  %d already in the vault: %d by ID, %d by content\n", matched, result.MatchedByID, result.MatchedByContent)
+	}
+	for _, msg := range result.Errors {
+		fmt.Fprintf(os.Stderr, "  %s\n", msg)
+	}
+	return nil
+}
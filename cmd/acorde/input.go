@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"unicode/utf8"
+
+	"github.com/amaydixit11/acorde/internal/cli"
+	"github.com/amaydixit11/acorde/pkg/engine"
+)
+
+// blobThreshold is the content size above which add stores content in the
+// blob store and creates a file entry referencing it
+const blobThreshold = 1 << 20
+
+// contentInput is entry content read from the command line
+type contentInput struct {
+	Data []byte
+	Name string // File name, if read from --content-file
+	Raw  bool   // Read from a file or stdin rather than --content
+}
+
+// readContent reads content from --content, --content-file, or stdin when
+// the positional argument at stdinArg is "-". ok is false if none is given.
+func readContent(c *cli.Context, stdinArg int) (in contentInput, ok bool, err error) {
+	path := c.String("content-file")
+	stdin := c.Arg(stdinArg) == "-"
+
+	sources := 0
+	for _, given := range []bool{c.IsSet("content"), path != "", stdin} {
+		if given {
+			sources++
+		}
+	}
+	switch {
+	case sources > 1:
+		return in, false, cli.Usagef("use only one of --content, --content-file and - (stdin)")
+	case path != "":
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return in, false, err
+		}
+		return contentInput{Data: data, Name: filepath.Base(path), Raw: true}, true, nil
+	case stdin:
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return in, false, fmt.Errorf("failed to read stdin: %w", err)
+		}
+		return contentInput{Data: data, Raw: true}, true, nil
+	}
+	return contentInput{Data: []byte(c.String("content"))}, sources == 1, nil
+}
+
+// useBlob reports whether content read from a file or stdin goes to the
+// blob store, as a file entry: when a file entry is asked for, or when the
+// content is large or binary and no type is asked for
+func useBlob(in contentInput, entryType engine.EntryType, typeSet bool) bool {
+	if !in.Raw {
+		return false
+	}
+	if typeSet {
+		return entryType == engine.File
+	}
+	return len(in.Data) > blobThreshold || !utf8.Valid(in.Data)
+}
+
+// storeBlob stores content in the vault's blob store, with its MIME type
+// and a thumbnail for images, and returns the content of a file entry
+// referencing it. Encrypted vaults seal the blobs (see Engine.StoreFile).
+func storeBlob(e engine.Engine, in contentInput) ([]byte, error) {
+	fc, err := e.StoreFile(in.Name, in.Data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(fc)
+}
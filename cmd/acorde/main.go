@@ -1,21 +1,30 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/signal"
+	"slices"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 	"path/filepath"
+	"strconv"
 
 	"golang.org/x/term"
 
+	"github.com/amaydixit11/acorde/internal/blob"
+	"github.com/amaydixit11/acorde/internal/cli"
 	"github.com/amaydixit11/acorde/internal/crdt"
+	"github.com/amaydixit11/acorde/internal/sharing"
 	"github.com/amaydixit11/acorde/internal/sync"
 	"github.com/amaydixit11/acorde/pkg/api"
 	"github.com/amaydixit11/acorde/pkg/crypto"
@@ -27,149 +36,927 @@ import (
 )
 
 func main() {
-	if len(os.Args) < 2 {
-		printUsage()
-		os.Exit(1)
-	}
-
-	cmd := os.Args[1]
-	args := os.Args[2:]
-
-	switch cmd {
-	case "daemon":
-		cmdDaemon(args)
-	case "invite":
-		cmdInvite(args)
-	case "pair":
-		cmdPair(args)
-	case "init":
-		cmdInit(args)
-	case "status":
-		cmdStatus(args)
-	case "export":
-		cmdExport(args)
-	case "serve":
-		cmdServe(args)
-	case "add", "get", "list", "update", "delete":
-		runWithEngine(cmd, args)
-	case "help":
-		printUsage()
-	default:
-		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", cmd)
-		printUsage()
-		os.Exit(1)
+	app := &cli.App{
+		Name:     "acorde",
+		Short:    "acorde - Local-first data engine with P2P sync",
+		Flags:    globalFlags,
+		Commands: commands(),
+
+		// Flags not given default to the environment, then the config file
+		ConfigFile: configFile,
+		Env:        envFlags,
 	}
+	app.Main()
 }
 
-func printUsage() {
-	fmt.Println(`acorde - Local-first data engine with P2P sync
-
-Usage: acorde <command> [options]
-
-Commands:
-  daemon   Start sync daemon (auto-discovers peers on LAN)
-  serve    Start REST API server (--port 7331)
-  status   Show vault status (entry count, sync state)
-  export   Export all entries to JSON
-  add      Add a new entry
-  get      Get an entry by ID  
-  list     List entries
-  update   Update an entry
-  delete   Delete an entry
-  help     Show this help
-
-Encryption:
-  acorde init   Initialize new encrypted vault
+// globalFlags are accepted by every command, before or after its name
+func globalFlags(fs *flag.FlagSet) {
+	fs.String("data", "", "Data directory (default: $ACORDE_DATA_DIR or ~/.acorde)")
+	fs.String("config", "", "Config file of flag defaults (default: acorde/config.json in $XDG_CONFIG_HOME or ~/.config)")
+	fs.String("vault", "", "Named vault inside the data directory")
+	fs.Bool("json", false, "Print the result as JSON (all commands but daemon and serve)")
+}
 
-Daemon Mode:
+func commands() []*cli.Command {
+	return []*cli.Command{
+		{
+			Name:  "daemon",
+			Short: "Start sync daemon (auto-discovers peers on LAN)",
+			Long: `Examples:
   acorde daemon --name node1 --data ~/.acorde-node1
-  acorde daemon --name node2 --data ~/.acorde-node2
-
-Entry Commands:
+  acorde daemon --name node2 --data ~/.acorde-node2 --api-port 7331`,
+			Flags: func(fs *flag.FlagSet) {
+				fs.String("name", "acorde", "Node name for logging")
+				fs.Int("port", 0, "Port to listen on (0 = random)")
+				fs.Int("api-port", 0, "Port for REST API (0 = disabled)")
+				addAPITokenFlag(fs)
+				addNamespaceTokensFlag(fs)
+				fs.String("namespaces", "", "Comma-separated namespaces to sync with peers (\"default\" = entries added without one; default all)")
+				fs.Int("blob-rate", 0, "Bytes per second the REST API serves file attachments at, in total (0 = unlimited)")
+				fs.Bool("dht", false, "Enable DHT for global peer discovery")
+				fs.Bool("mdns", true, "Enable mDNS for local discovery")
+				fs.Bool("pex", false, "Exchange peer lists with paired devices, so address changes spread (with --strict, only paired devices are dialed)")
+				fs.String("power-mode", "normal", "normal, or low to batch syncs every --low-power-interval without DHT (battery, metered networks)")
+				fs.Duration("low-power-interval", sync.DefaultLowPowerInterval, "Sync interval in low power mode")
+				fs.Bool("strict", false, "Only connect to paired devices (others can connect only to redeem an invite)")
+				fs.Int("state-budget", sync.DefaultStateBudget, "Bytes of a peer's state held in memory at once while syncing (larger states are streamed in chunks)")
+				fs.Int("sync-log", 0, "Record the last N sync sessions for 'acorde sync log' (0 = off)")
+				fs.Duration("slow-merge", sync.DefaultSlowMerge, "Log merges of peer states taking longer than this (negative = never)")
+				fs.Bool("verbose", false, "Enable verbose logging")
+				fs.Bool("acks", false, "Acknowledge entries received from peers")
+				fs.String("clock", "lamport", "Clock for timestamping changes: lamport or hybrid (wall time + counter)")
+				fs.Duration("max-clock-skew", engine.DefaultMaxClockSkew, "Quarantine synced changes timestamped further ahead of this device's clock (0 = off)")
+				addChaosFlag(fs)
+			},
+			Run: cmdDaemon,
+		},
+		{
+			Name:  "serve",
+			Short: "Start REST API server",
+			Flags: func(fs *flag.FlagSet) {
+				fs.Int("port", 7331, "Port for REST API")
+				fs.Bool("lazy", false, "Load entries into memory as they are used, not at startup")
+				addAPITokenFlag(fs)
+				addNamespaceTokensFlag(fs)
+				fs.Int("blob-rate", 0, "Bytes per second file attachments are served at, in total (0 = unlimited)")
+			},
+			Run: cmdServe,
+		},
+		{
+			Name:  "namespaces",
+			Short: "List namespaces and their entry counts",
+			Long: `Entries belong to the namespace they were added in (acorde add
+--namespace), or to the default one. The REST API can bind tokens to a
+namespace (--namespace-tokens) and the daemon can sync only some
+namespaces (--namespaces).`,
+			Run: withEngine(cmdNamespaces),
+		},
+		{
+			Name:  "status",
+			Short: "Show vault status (entry count, sync state)",
+			Run:   cmdStatus,
+		},
+		{
+			Name:  "doctor",
+			Short: "Check that every entry and version decrypts",
+			Long: `Reads every entry, archived ones included, and its version history from
+storage and lists those whose content does not decrypt with the vault's
+keys. Exits with an error if any are found.`,
+			Run: withEngine(cmdDoctor),
+		},
+		{
+			Name:  "export",
+			Short: "Export entries to JSON or a static HTML site",
+			Long: `With --format html, entries are written to --out as a static site that
+needs no server: an index with client-side search, a tag index and a page
+per entry, with notes rendered from Markdown. Credentials and files are
+never included in the site.
+
+Examples:
+  acorde export --file backup.json
+  acorde export --format html --out site/ --tag blog`,
+			Flags: func(fs *flag.FlagSet) {
+				fs.String("format", "json", "Export format: json or html")
+				fs.String("file", "acorde-export.json", "Output file (json)")
+				fs.String("out", "acorde-site", "Output directory (html)")
+				fs.String("title", "acorde", "Site title (html)")
+				fs.Bool("raw", false, "Include logical clock times (json)")
+				addFilterFlags(fs)
+			},
+			Run: cmdExport,
+		},
+		{
+			Name:  "import",
+			Args:  "<file>",
+			Short: "Import entries from a JSON or CSV export",
+			Long: `Imported entries get new IDs. An entry whose ID is already in the vault
+is handled by --on-conflict; otherwise one with the same type and content
+as a vault entry (e.g. from re-importing an export whose IDs were
+regenerated) is handled by --on-duplicate. Either can skip the entry,
+overwrite the vault's entry, merge its tags into the vault's entry, or
+add it as a duplicate anyway.
+
+With --from, the file is a password manager export (Bitwarden CSV or
+unencrypted JSON, 1Password CSV, KeePass CSV) and its logins become
+credential entries, tagged with the format and their folder. Use
+--from auto to detect the format.`,
+			Flags: func(fs *flag.FlagSet) {
+				addFilterFlags(fs)
+				fs.String("from", "", "Password manager export: bitwarden, 1password, keepass or auto")
+				fs.String("on-conflict", "skip", "Entries whose ID is in the vault: skip, overwrite, merge-tags or duplicate")
+				fs.String("on-duplicate", "skip", "Entries whose type and content are in the vault: skip, overwrite, merge-tags or duplicate")
+				fs.Bool("dry-run", false, "Show what would be imported without changing the vault")
+			},
+			Run: withEngine(cmdImport),
+		},
+		{
+			Name:  "add",
+			Args:  "[-]",
+			Short: "Add a new entry",
+			Long: `Content comes from --content, --content-file, or stdin with "-". Large
+or binary content from a file or stdin is kept in the blob store and
+added as a file entry (sealed with a per-file key in encrypted vaults).
+
+With --template, the type, content and tags come from a template (see
+acorde templates), and --tags are added to its own. Its variables are
+taken from --vars; on a terminal, those not given are asked for.
+
+Examples:
   acorde add --type note --content "Hello World" --tags work,important
-  acorde list --type note
-  acorde get <uuid>
-  acorde update <uuid> --content "Updated"
-  acorde delete <uuid>`)
-}
-
-func runWithEngine(cmd string, args []string) {
-	// 1. Determine data dir
-	// We need to parse args manually or peek at them because flag.Parse consumes them
-	// For simplicity, we assume default data dir if not specified, 
-	// OR we enforce standard flag usage. Let's stick to default.
-	home, _ := os.UserHomeDir()
-	dataDir := filepath.Join(home, ".acorde") 
-	
-	// Check for custom data dir in args (simple check)
-	for i, arg := range args {
-		if arg == "--data" && i+1 < len(args) {
-			dataDir = args[i+1]
-			break
-		}
+  acorde add --type note - < meeting.md
+  acorde add --content-file photo.jpg
+  acorde add --template meeting --vars title=Standup
+  acorde add --type task --content-file task.json --validate`,
+			Flags: func(fs *flag.FlagSet) {
+				fs.String("type", "note", "Entry type")
+				fs.String("content", "", "Entry content")
+				fs.String("content-file", "", "Read content from a file")
+				fs.String("tags", "", "Comma-separated tags")
+				fs.Bool("public", false, "Make entry public (readable by everyone)")
+				fs.String("template", "", "Create the entry from this template")
+				fs.String("vars", "", "Comma-separated name=value template variables")
+				fs.String("namespace", "", "Namespace the entry belongs to (\"default\" = none)")
+				fs.Bool("validate", false, "Only check the content against the type's schema, without adding it")
+			},
+			Run: withEngine(cmdAdd),
+		},
+		{
+			Name:  "get",
+			Args:  "<uuid>",
+			Short: "Get an entry by ID",
+			Long: `Like every command taking an entry <uuid>, get also takes a unique ID
+prefix (8f3a), title:<text> for the entry titled, or else the one title
+containing, text, or tag:<tag> for the one entry so tagged. Any other text
+that is not hex is looked up as a title. An ambiguous reference lists the
+matching entries.
+
+With --copy, a field of the entry is copied to the system clipboard
+instead of being printed, and cleared from it after --clear-after unless
+something else was copied meanwhile. Credentials copy their password by
+default; other entries copy their whole content unless --field names a
+field of JSON content.
+
+Examples:
+  acorde get title:"groceries"
+  acorde get <ID> --copy
+  acorde get <ID> --copy --field username --clear-after 0`,
+			Flags: func(fs *flag.FlagSet) {
+				fs.Bool("raw", false, "Show logical clock times instead of dates")
+				fs.Bool("reveal", false, "Show credential passwords and TOTP secrets")
+				fs.Bool("copy", false, "Copy to the clipboard instead of printing")
+				fs.String("field", "", "With --copy, the JSON field to copy")
+				fs.Duration("clear-after", defaultClearAfter, "With --copy, clear the clipboard after this long (0 = never)")
+			},
+			Run: withEngine(cmdGet),
+		},
+		{
+			Name:  "list",
+			Short: "List entries",
+			Flags: func(fs *flag.FlagSet) {
+				fs.String("type", "", "Filter by type")
+				fs.String("tag", "", "Filter by tag")
+				fs.String("namespace", "", "Only entries of this namespace (\"default\" = added without one)")
+				fs.Bool("archived", false, "Include archived entries")
+				fs.Bool("only-archived", false, "Only list archived entries")
+				fs.String("collection", "", "Only entries filed in this collection path (\"/\" = in none)")
+				fs.Bool("recursive", false, "With --collection, also entries in collections below it")
+				fs.Bool("raw", false, "Show logical clock times instead of dates")
+				fs.Bool("reveal", false, "Show credential passwords and TOTP secrets")
+				fs.Bool("count", false, "Only print how many entries match (counted without decrypting)")
+				fs.Bool("no-content", false, "List metadata only, without reading or decrypting content")
+				fs.String("sort", "", "Order by updated_at (default), created_at or title")
+				fs.Bool("asc", false, "Oldest first, or A to Z by title")
+			},
+			Run: withEngine(cmdList),
+		},
+		{
+			Name:  "stats",
+			Short: "Count or total entries per hour, day, week or month",
+			Long: `Groups entries by local creation time. With --agg sum, avg, min or max,
+--field names a numeric field of JSON content (dots for nested fields).`,
+			Flags: func(fs *flag.FlagSet) {
+				fs.String("type", "", "Filter by type")
+				fs.String("tag", "", "Filter by tag")
+				fs.String("since", "", "Only entries created on or after this date")
+				fs.String("until", "", "Only entries created before this date")
+				fs.String("bucket", string(engine.BucketDay), "Bucket width: hour, day, week or month")
+				fs.String("agg", string(engine.AggCount), "Aggregate: count, sum, avg, min or max")
+				fs.String("field", "", "JSON field to aggregate")
+			},
+			Run: withEngine(cmdStats),
+			Commands: []*cli.Command{
+				{
+					Name:  "overview",
+					Short: "Summarize the vault: entries, activity, storage, versions, peers",
+					Long: `Counts entries by type and tag, draws the entries created each day of the
+last 30 days, and shows disk usage, version history and the health of the
+peers the daemon syncs with. Same data as GET /stats.`,
+					Run: withEngine(cmdStatsOverview),
+				},
+			},
+		},
+		{
+			Name:  "timeline",
+			Short: "Show recent creates, updates and deletions across the vault",
+			Long: `Lists changes to every entry, most recent first, with the device that
+made them: those made here and those merged from other devices, at the
+time they were made there. Creates and updates come from version
+history, so those pruned from it are not shown.
+
+Examples:
+  acorde timeline
+  acorde timeline --since 2026-10-01 --type task -n 0`,
+			Flags: func(fs *flag.FlagSet) {
+				fs.String("type", "", "Only changes to entries of this type")
+				fs.String("author", "", "Only changes made by this peer ID")
+				fs.String("since", "", "Only changes on or after this date")
+				fs.String("until", "", "Only changes before this date")
+				fs.Int("n", 50, "Show the last N changes (0 = all)")
+			},
+			Run: withEngine(cmdTimeline),
+		},
+		{
+			Name:  "update",
+			Args:  "<uuid> [-]",
+			Short: "Update an entry",
+			Long: `New content comes from --content, --content-file, or stdin with "-".
+With --validate, it is only checked against the schema of the entry's
+type (see acorde schema), and each error is listed with the field it is
+about.`,
+			Flags: func(fs *flag.FlagSet) {
+				fs.String("content", "", "New content")
+				fs.String("content-file", "", "Read new content from a file")
+				fs.Bool("validate", false, "Only check the new content against the type's schema, without saving it")
+			},
+			Run: withEngine(cmdUpdate),
+		},
+		{
+			Name:  "edit",
+			Args:  "<uuid>",
+			Short: "Edit an entry's content in $EDITOR",
+			Long: `Opens the decrypted content in $VISUAL or $EDITOR (default vi) from a
+private temporary file, which is removed afterwards. On save the content
+is checked against the schema registered for the entry type; if it does
+not match, the editor can be reopened to fix it.`,
+			Run: withEngine(cmdEdit),
+		},
+		{
+			Name:  "delete",
+			Args:  "<uuid>... | --query <query>",
+			Short: "Delete entries",
+			Long: `Deleting more than 10 entries asks for confirmation, or needs --yes
+when stdin is not a terminal. --dry-run lists what would be deleted.
+
+--query deletes the entries a query matches, such as
+  acorde delete --query 'type = "log" AND updated_at < 1700000000' --yes
+and always asks for confirmation (or --yes).`,
+			Flags: func(fs *flag.FlagSet) {
+				addConfirmFlags(fs)
+				fs.String("query", "", "Delete the entries matching a query")
+			},
+			Run:   withEngine(cmdDelete),
+		},
+		{
+			Name:  "archive",
+			Args:  "<uuid>...",
+			Short: "Archive entries",
+			Long: `Archived entries are kept and synced but left out of list and search
+unless asked for (list --archived). Unarchive brings them back.`,
+			Run: withEngine(cmdArchive),
+		},
+		{
+			Name:  "unarchive",
+			Args:  "<uuid>...",
+			Short: "Unarchive entries",
+			Run:   withEngine(cmdUnarchive),
+		},
+		{
+			Name:  "mv",
+			Args:  "<uuid>... (--to-vault <name> | --to-data <dir>)",
+			Short: "Move entries to another vault",
+			Long: `Entries move with their version history, ACL and file blobs, under the
+same IDs, and are re-encrypted with the destination vault's key (its
+password is asked for if it is encrypted). The source vault is --vault,
+or the --data directory itself. Sharing with other devices does not carry
+over. An entry that fails to move stays where it was.
+
+Examples:
+  acorde mv <uuid> --to-vault personal
+  acorde --vault work mv <uuid> <uuid> --to-data ~/.acorde`,
+			Flags: addTransferFlags,
+			Run:   withEngine(cmdMove),
+		},
+		{
+			Name:  "cp",
+			Args:  "<uuid>... (--to-vault <name> | --to-data <dir>)",
+			Short: "Copy entries to another vault",
+			Long: `Like mv, but the entries are kept in the source vault too.`,
+			Flags: addTransferFlags,
+			Run:   withEngine(cmdCopy),
+		},
+		{
+			Name:  "tag",
+			Args:  "[<uuid>...]",
+			Short: "Add or remove tags on several entries",
+			Long: `Entries are selected by ID, or by --type and/or --tag. Changing more
+than 10 entries asks for confirmation, or needs --yes when stdin is not
+a terminal. --dry-run lists the new tags without changing anything.
+
+Examples:
+  acorde tag --tag inbox --add archive --remove inbox
+  acorde tag <uuid> <uuid> --add work --dry-run`,
+			Flags: func(fs *flag.FlagSet) {
+				fs.String("add", "", "Comma-separated tags to add")
+				fs.String("remove", "", "Comma-separated tags to remove")
+				fs.String("type", "", "Select entries of this type")
+				fs.String("tag", "", "Select entries with this tag")
+				addConfirmFlags(fs)
+			},
+			Run: withEngine(cmdTag),
+		},
+		{
+			Name:  "share",
+			Args:  "<uuid> <peer-id>...",
+			Short: "Share an entry with paired devices",
+			Run:   withEngine(cmdShare),
+		},
+		{
+			Name:  "init",
+			Short: "Initialize new encrypted vault",
+			Long: `Use --key-protection hardware to also seal the key to this machine's TPM
+(Linux and Windows; macOS has no TPM).
+
+The password must be estimated at --min-entropy bits or more. Argon2id is
+tuned so unlocking takes about --argon2-target here; set --argon2-time to
+choose the passes yourself. The parameters are stored in the key file.
+
+Use --recovery-shares N --recovery-threshold K to also split the key into N
+recovery shares, printed as words, any K of which restore access with
+'acorde recover' if the password is forgotten. Keep them apart.`,
+			Flags: func(fs *flag.FlagSet) {
+				fs.String("key-protection", "password", "Key protection: password or hardware (TPM 2.0)")
+				fs.Int("recovery-shares", 0, "Number of recovery shares to print (0 = none)")
+				fs.Int("recovery-threshold", 0, "Recovery shares needed to recover the key")
+				fs.Bool("recovery-qr", false, "Also print each recovery share as a QR code")
+				addPasswordFlags(fs)
+			},
+			Run: cmdInit,
+		},
+		{
+			Name:  "recover",
+			Short: "Set a new password using recovery shares",
+			Long: `Reads recovery shares, one per line, until enough are given, then asks for
+a new password. Also rebuilds a lost key file.`,
+			Flags: addPasswordFlags,
+			Run:   cmdRecover,
+		},
+		{
+			Name:  "invite",
+			Short: "Create an invite code for another device",
+			Flags: func(fs *flag.FlagSet) {
+				fs.Duration("expiry", 24*time.Hour, "Invite expiry duration")
+				fs.Int("port", 0, "Port to listen/advertise (0 = random)")
+				fs.Bool("one-time", true, "Invite can be redeemed only once")
+				fs.Bool("pin", true, "Require a PIN, shown here, to be entered on the joining device")
+				fs.Bool("embed-key", false, "Embed the vault key in the invite code (legacy, not recommended)")
+				fs.Bool("include-peers", false, "Embed the trusted devices in the full code, for the joiner to trust too")
+				fs.String("png", "", "Also write the QR code as a PNG to this file")
+				fs.String("qr-level", "low", "QR error correction: low, medium, high or highest")
+				fs.Bool("qr-invert", false, "Invert the terminal QR code (for light backgrounds)")
+				fs.Bool("verbose", false, "Enable verbose logging")
+			},
+			Run: cmdInvite,
+		},
+		{
+			Name:  "pair",
+			Args:  "<invite-code>",
+			Short: "Pair with a device using its invite code",
+			Flags: func(fs *flag.FlagSet) {
+				fs.String("pin", "", "PIN shown on the inviting device (prompted if required)")
+				fs.Bool("verbose", false, "Enable verbose logging")
+			},
+			Run: cmdPair,
+		},
+		{
+			Name:  "collections",
+			Short: "Manage the collection tree entries are filed in",
+			Long: `Collections are folders, addressed by paths such as /work/projects. An
+entry is filed in at most one collection, independent of its tags. The
+tree is stored as config entries and syncs to every device of the vault;
+moving an entry on one device and editing it on another keeps both.
+
+Examples:
+  acorde collections create work/projects
+  acorde collections add work/projects <uuid>
+  acorde list --collection work --recursive`,
+			Commands: []*cli.Command{
+				{
+					Name:  "create",
+					Args:  "<path>",
+					Short: "Create a collection, and any missing parents",
+					Run:   withEngine(cmdCollectionsCreate),
+				},
+				{
+					Name:  "list",
+					Short: "List collections by path",
+					Run:   withEngine(cmdCollectionsList),
+				},
+				{
+					Name:  "add",
+					Args:  "<path> <uuid>...",
+					Short: "File entries in a collection (\"/\" takes them out of any)",
+					Run:   withEngine(cmdCollectionsAdd),
+				},
+				{
+					Name:  "mv",
+					Args:  "<path> <parent-path>",
+					Short: "Move a collection into another (\"/\" = to the top)",
+					Run:   withEngine(cmdCollectionsMove),
+				},
+				{
+					Name:  "rename",
+					Args:  "<path> <name>",
+					Short: "Rename a collection",
+					Run:   withEngine(cmdCollectionsRename),
+				},
+				{
+					Name:  "delete",
+					Args:  "<path>",
+					Short: "Delete an empty collection",
+					Run:   withEngine(cmdCollectionsDelete),
+				},
+			},
+		},
+		{
+			Name:  "groups",
+			Short: "Manage ACL groups of peers",
+			Long: `Groups are named sets of peer IDs, such as "family" or "work-team". Granting
+a group access to an entry grants all its members; membership is resolved
+when access is checked, so the grant follows changes to the group. Groups
+are stored as config entries and sync to every device of the vault.`,
+			Commands: []*cli.Command{
+				{
+					Name:  "create",
+					Args:  "<name> [peer-id...]",
+					Short: "Create a group",
+					Run:   withEngine(cmdGroupsCreate),
+				},
+				{
+					Name:  "list",
+					Short: "List groups",
+					Run:   withEngine(cmdGroupsList),
+				},
+				{
+					Name:  "show",
+					Args:  "<name>",
+					Short: "Show a group's members",
+					Run:   withEngine(cmdGroupsShow),
+				},
+				{
+					Name:  "add",
+					Args:  "<name> <peer-id>...",
+					Short: "Add members to a group",
+					Run:   withEngine(cmdGroupsMembers(true)),
+				},
+				{
+					Name:  "remove",
+					Args:  "<name> <peer-id>...",
+					Short: "Remove members from a group",
+					Run:   withEngine(cmdGroupsMembers(false)),
+				},
+				{
+					Name:  "delete",
+					Args:  "<name>",
+					Short: "Delete a group",
+					Run:   withEngine(cmdGroupsDelete),
+				},
+				{
+					Name:  "grant",
+					Args:  "<uuid> <name>",
+					Short: "Let a group read (or --write) an entry",
+					Flags: func(fs *flag.FlagSet) {
+						fs.Bool("write", false, "Also let the group write the entry")
+					},
+					Run: withEngine(cmdGroupsGrant),
+				},
+				{
+					Name:  "revoke",
+					Args:  "<uuid> <name>",
+					Short: "Remove a group's access to an entry",
+					Run:   withEngine(cmdGroupsRevoke),
+				},
+			},
+		},
+		{
+			Name:  "rules",
+			Short: "Manage auto-tagging rules",
+			Long: `Rules add tags to, and fill in fields of, entries that match them when
+they are added or updated. They are stored as config entries and sync to
+every device of the vault.`,
+			Commands: []*cli.Command{
+				{
+					Name:  "add",
+					Short: "Add a rule",
+					Long: `A rule needs at least one condition (--type, --tag, --pattern) and one
+action (--add-tags, --set). --pattern is a regular expression matched
+against the content, or against a top-level field of JSON content with
+--field. --set fills in fields missing from JSON object content.
+
+Examples:
+  acorde rules add --type log --pattern '(?i)error' --add-tags errors
+  acorde rules add --field url --pattern 'github\.com' --add-tags code --set source=github`,
+					Flags: func(fs *flag.FlagSet) {
+						fs.String("name", "", "Rule name (rules apply in name order)")
+						fs.String("type", "", "Match entries of this type")
+						fs.String("tag", "", "Match entries with this tag")
+						fs.String("pattern", "", "Match content (or --field) against this regexp")
+						fs.String("field", "", "Top-level JSON content field to match --pattern against")
+						fs.String("add-tags", "", "Comma-separated tags to add")
+						fs.String("set", "", "Comma-separated field=value pairs to fill in")
+					},
+					Run: withEngine(cmdRulesAdd),
+				},
+				{
+					Name:  "list",
+					Short: "List rules",
+					Run:   withEngine(cmdRulesList),
+				},
+				{
+					Name:  "rm",
+					Args:  "<rule-id>",
+					Short: "Remove a rule",
+					Run:   withEngine(cmdRulesRemove),
+				},
+			},
+		},
+		{
+			Name:  "templates",
+			Short: "Manage entry templates",
+			Long: `Templates are named skeletons for new entries: a type, content and tags,
+used with acorde add --template. They are stored as config entries and
+sync to every device of the vault. Content and tags may hold
+{{variables}}: {{date}}, {{time}}, {{datetime}} and {{weekday}} are
+filled in from the current time, any other, such as {{title}}, is given
+when the template is used.`,
+			Commands: []*cli.Command{
+				{
+					Name:  "save",
+					Args:  "<name> [-]",
+					Short: "Create or replace a template",
+					Long: `Content comes from --content, --content-file, or stdin with "-".
+
+Examples:
+  acorde templates save meeting --content "# {{title}}" --tags meeting
+  acorde templates save daily --type log - < daily.md`,
+					Flags: func(fs *flag.FlagSet) {
+						fs.String("type", "note", "Type of the entries made from the template")
+						fs.String("content", "", "Template content")
+						fs.String("content-file", "", "Read template content from a file")
+						fs.String("tags", "", "Comma-separated tags of the entries made from the template")
+					},
+					Run: withEngine(cmdTemplatesSave),
+				},
+				{
+					Name:  "list",
+					Short: "List templates",
+					Run:   withEngine(cmdTemplatesList),
+				},
+				{
+					Name:  "show",
+					Args:  "<name>",
+					Short: "Show a template",
+					Run:   withEngine(cmdTemplatesShow),
+				},
+				{
+					Name:  "rm",
+					Args:  "<name>",
+					Short: "Remove a template",
+					Run:   withEngine(cmdTemplatesRemove),
+				},
+			},
+		},
+		{
+			Name:  "schema",
+			Short: "Manage the JSON schemas entry types must match",
+			Long: `An entry type's schema is a JSON Schema that the content of its entries
+must match when they are added or updated: content that does not is
+refused, with the fields at fault. Schemas are stored as config entries
+and sync to every device of the vault. Config, file and credential
+entries cannot have one.
+
+Use add --validate and update --validate to check content without
+saving it.`,
+			Commands: []*cli.Command{
+				{
+					Name:  "add",
+					Args:  "<type> [-]",
+					Short: "Create or replace the schema of an entry type",
+					Long: `The schema comes from --file, or stdin with "-".
+
+Examples:
+  acorde schema add note --file note.schema.json
+  acorde schema add event - < event.schema.json`,
+					Flags: func(fs *flag.FlagSet) {
+						fs.String("file", "", "Read the schema from a file")
+					},
+					Run: withEngine(cmdSchemaAdd),
+				},
+				{
+					Name:  "list",
+					Short: "List the entry types with a saved schema",
+					Run:   withEngine(cmdSchemaList),
+				},
+				{
+					Name:  "show",
+					Args:  "<type>",
+					Short: "Show the schema of an entry type",
+					Run:   withEngine(cmdSchemaShow),
+				},
+				{
+					Name:  "rm",
+					Args:  "<type>",
+					Short: "Remove the schema of an entry type",
+					Run:   withEngine(cmdSchemaRemove),
+				},
+			},
+		},
+		{
+			Name:  "blobstore",
+			Short: "Choose where file attachments are stored",
+			Commands: []*cli.Command{
+				{
+					Name:  "show",
+					Short: "Show where blobs are stored",
+					Run:   cmdBlobstoreShow,
+				},
+				{
+					Name:  "s3",
+					Short: "Store blobs in an S3-compatible bucket, caching recent ones locally",
+					Long: `Blobs stored so far are uploaded. Entry metadata stays in the local
+database. Credentials left out are read from $AWS_ACCESS_KEY_ID and
+$AWS_SECRET_ACCESS_KEY when the vault is opened; given here, they are
+saved in the data directory (readable by you only).
+
+Examples:
+  acorde blobstore s3 --endpoint https://s3.eu-west-1.amazonaws.com --region eu-west-1 --bucket my-vault
+  acorde blobstore s3 --endpoint http://localhost:9000 --bucket acorde --access-key minio --secret-key minio123`,
+					Flags: func(fs *flag.FlagSet) {
+						fs.String("endpoint", "", "Service URL, e.g. https://s3.eu-west-1.amazonaws.com or http://localhost:9000 (required)")
+						fs.String("region", "us-east-1", "Bucket region")
+						fs.String("bucket", "", "Bucket name (required)")
+						fs.String("prefix", "", "Key prefix, to share a bucket between vaults")
+						fs.String("access-key", "", "Access key ID (default $AWS_ACCESS_KEY_ID)")
+						fs.String("secret-key", "", "Secret access key (default $AWS_SECRET_ACCESS_KEY)")
+						fs.Int("cache-mb", blob.DefaultCacheBytes>>20, "Megabytes of recently used blobs kept on local disk")
+					},
+					Run: cmdBlobstoreS3,
+				},
+				{
+					Name:  "local",
+					Short: "Store blobs on local disk again, downloading them from the bucket",
+					Run:   cmdBlobstoreLocal,
+				},
+			},
+		},
+		{
+			Name:  "device",
+			Short: "Manage trusted devices",
+			Commands: []*cli.Command{
+				{
+					Name:  "list",
+					Short: "List trusted devices",
+					Run:   cmdDeviceList,
+				},
+				{
+					Name:  "revoke",
+					Args:  "<peer-id>",
+					Short: "Revoke a device and rotate the vault key (stop the daemon first)",
+					Run:   cmdDeviceRevoke,
+				},
+				{
+					Name:  "export",
+					Short: "Write a signed list of the trusted devices",
+					Long: `Importing the list on a new device paired with this one trusts every
+device this one trusts, instead of pairing with each of them. Without
+--out, the list is written to stdout.`,
+					Flags: func(fs *flag.FlagSet) {
+						fs.String("out", "", "File to write")
+					},
+					Run: cmdDeviceExport,
+				},
+				{
+					Name:  "import",
+					Args:  "<file>",
+					Short: "Trust the devices of a list written by device export (- for stdin)",
+					Run:   cmdDeviceImport,
+				},
+			},
+		},
+		{
+			Name:  "peers",
+			Short: "Show the sync health of peers",
+			Commands: []*cli.Command{
+				{
+					Name:  "list",
+					Short: "List peers with their sync successes, failures and backoff",
+					Long: `Peers that keep failing to sync are retried less and less often, then
+quarantined for an hour. The list is published by a running daemon.`,
+					Run: cmdPeersList,
+				},
+			},
+		},
+		{
+			Name:  "quarantine",
+			Short: "Inspect changes rejected by sync",
+			Commands: []*cli.Command{
+				{
+					Name:  "list",
+					Short: "List quarantined entry versions and ACL changes",
+					Long: `A peer with a broken clock can send changes timestamped far in the future,
+which would win every conflict. The daemon quarantines them instead
+(see 'acorde daemon --max-clock-skew'); the entries keep their local versions.
+
+Once entries are shared, changes to an entry from a peer its ACL doesn't
+let write it are quarantined too, as are ACL changes from a peer that
+doesn't own the entry (listed with type acl).`,
+					Run: withEngine(cmdQuarantineList),
+				},
+				{
+					Name:  "clear",
+					Short: "Forget quarantined entry versions",
+					Run:   withEngine(cmdQuarantineClear),
+				},
+			},
+		},
+		{
+			Name:  "sync",
+			Short: "Debug sync with peers",
+			Commands: []*cli.Command{
+				{
+					Name:  "log",
+					Short: "Show recorded sync sessions",
+					Long: `Sessions are recorded by a daemon started with --sync-log N, which keeps
+the last N: the messages exchanged, the state hash before and after, the
+entries applied and the duration.
+
+Examples:
+  acorde sync log
+  acorde sync log --peer 12D3KooW --verbose`,
+					Flags: func(fs *flag.FlagSet) {
+						fs.String("peer", "", "Only sessions with this peer (ID or prefix)")
+						fs.Int("n", 20, "Show the last N sessions (0 = all)")
+						fs.Bool("verbose", false, "Show each session's messages")
+					},
+					Run: cmdSyncLog,
+				},
+			},
+		},
+		{
+			Name:  "bundle",
+			Short: "Sync offline with signed, encrypted bundle files",
+			Long: `For devices that are never on the same network, or air-gapped: carry a
+USB stick between them. A bundle holds the vault's changes, signed with
+this device's identity key and, if the vault is encrypted, encrypted with
+the vault key.
+
+Bundles are only merged from devices paired with this one (see
+'acorde pair') or given with --peer; an altered or forged bundle is refused.
+
+export and import keep a folder as a mailbox: each device leaves its
+changes there and merges the bundles the others left. create and apply
+work on single files, with the changes given by --since.
+
+Examples:
+  acorde bundle export /media/usb/acorde
+  acorde bundle import /media/usb/acorde
+  acorde bundle create --since 1042 --out /media/usb/changes.acorde
+  acorde bundle apply --peer 12D3KooW... /media/usb/changes.acorde`,
+			Commands: []*cli.Command{
+				{
+					Name:  "export",
+					Args:  "<dir>",
+					Short: "Write a bundle of local changes into a folder",
+					Long: `Each bundle holds the changes made since this device's last bundle in
+the folder. Changes merged from other devices with older timestamps are
+only in a full bundle (--full).`,
+					Flags: func(fs *flag.FlagSet) {
+						fs.Bool("full", false, "Include the whole vault, not only changes since the last bundle")
+					},
+					Run: cmdBundleExport,
+				},
+				{
+					Name:  "import",
+					Args:  "<dir|file>...",
+					Short: "Merge the bundles other devices left in a folder",
+					Long: `Every bundle must verify, come from a trusted device and decrypt with the
+vault key, or nothing is merged.`,
+					Flags: addBundlePeerFlag,
+					Run:   cmdBundleImport,
+				},
+				{
+					Name:  "create",
+					Short: "Write a bundle of the changes after a clock time to a file",
+					Long: `--since takes the clock time printed when the previous bundle was
+created (0, the default, for the whole vault).`,
+					Flags: func(fs *flag.FlagSet) {
+						fs.Uint64("since", 0, "Only changes after this clock time")
+						fs.String("out", "", "Bundle file to write")
+					},
+					Run: cmdBundleCreate,
+				},
+				{
+					Name:  "apply",
+					Args:  "<file>...",
+					Short: "Verify and merge bundle files",
+					Flags: addBundlePeerFlag,
+					Run:   cmdBundleApply,
+				},
+			},
+		},
+		{
+			Name:  "config",
+			Short: "Manage the config file of flag defaults",
+			Long: `Settings are flag defaults for every command. A key names a flag, or a
+command and a flag for that command only. Environment variables
+($ACORDE_DATA_DIR, $ACORDE_API_TOKEN) override the config file, and
+flags on the command line override both.
+
+Examples:
+  acorde config set data ~/notes
+  acorde config set daemon.port 4001
+  acorde config set daemon.dht true
+  acorde config unset daemon.port`,
+			Commands: []*cli.Command{
+				{
+					Name:  "show",
+					Short: "Show the config file and environment overrides",
+					Run:   cmdConfigShow,
+				},
+				{
+					Name:  "set",
+					Args:  "<key> <value>",
+					Short: "Set a flag default",
+					Run:   cmdConfigSet,
+				},
+				{
+					Name:  "unset",
+					Args:  "<key>",
+					Short: "Remove a flag default",
+					Run:   cmdConfigUnset,
+				},
+			},
+		},
+		{
+			Name:   "clipboard-clear",
+			Short:  "Clear the clipboard after a delay (started by get --copy)",
+			Hidden: true,
+			Flags: func(fs *flag.FlagSet) {
+				fs.Duration("after", defaultClearAfter, "Delay")
+				fs.Bool("match-stdin", false, "Only clear if the clipboard still holds the value identified on stdin")
+			},
+			Run: cmdClipboardClear,
+		},
 	}
+}
 
-	cfg := engine.Config{DataDir: dataDir}
-
-	// 2. Unlock if needed
-	keyStore := crypto.NewFileKeyStore(dataDir)
-	if keyStore.IsInitialized() {
-		fmt.Printf("🔒 Vault is encrypted. Enter password: ")
-		password, err := readPassword() // implemented below
+// withEngine opens the vault's engine for the duration of an entry command
+func withEngine(run func(c *cli.Context, e engine.Engine) error) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+		dataDir, err := resolveDataDir(c)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "\nError reading password: %v\n", err)
-			os.Exit(1)
+			return err
 		}
-		key, err := keyStore.Unlock(password)
+		cfg, err := unlockConfig(dataDir)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "\nError: %v\n", err)
-			os.Exit(1)
-		}
-		cfg.EncryptionKey = &key
-		fmt.Println("") 
-	}
-
-	e, err := engine.New(cfg)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
-	}
-	defer e.Close()
-
-	// 3. Filter global flags from args before passing to subcommands
-	subArgs := filterGlobalFlags(args)
-
-	switch cmd {
-	case "add":
-		cmdAdd(e, subArgs)
-	case "get":
-		cmdGet(e, subArgs)
-	case "list":
-		cmdList(e, subArgs)
-	case "update":
-		cmdUpdate(e, subArgs)
-	case "delete":
-		cmdDelete(e, subArgs)
-	}
-}
-
-// filterGlobalFlags removes global flags (like --data) and their values from args
-func filterGlobalFlags(args []string) []string {
-	var filtered []string
-	for i := 0; i < len(args); i++ {
-		arg := args[i]
-		if arg == "--data" {
-			// Skip flag and its value
-			i++ 
-			continue
+			return err
 		}
-		if strings.HasPrefix(arg, "--data=") {
-			// Skip flag with value attached
-			continue
+		e, err := engine.New(cfg)
+		if err != nil {
+			return err
 		}
-		filtered = append(filtered, arg)
+		defer e.Close()
+		return run(c, e)
 	}
-	return filtered
 }
 
 // syncableEngine wraps pkg/engine.Engine to implement sync.Syncable
@@ -184,11 +971,43 @@ func (s *syncableEngine) GetSyncState() crdt.ReplicaState {
 	return state
 }
 
+func (s *syncableEngine) GetSyncDelta(since uint64) crdt.ReplicaState {
+	payload, _ := s.Engine.GetSyncDelta(since)
+	var state crdt.ReplicaState
+	json.Unmarshal(payload, &state)
+	return state
+}
+
 func (s *syncableEngine) ApplySyncState(state crdt.ReplicaState) error {
 	payload, _ := json.Marshal(state)
 	return s.ApplyRemotePayload(payload)
 }
 
+func (s *syncableEngine) MergeSyncState(state crdt.ReplicaState) (crdt.MergeStats, error) {
+	payload, _ := json.Marshal(state)
+	return s.MergeRemotePayload(payload)
+}
+
+func (s *syncableEngine) MergeSyncStateFrom(from string, state crdt.ReplicaState) (crdt.MergeStats, error) {
+	payload, _ := json.Marshal(state)
+	return s.MergeRemotePayloadFrom(from, payload)
+}
+
+// engineSyncEvent converts a sync lifecycle event to the engine event of
+// the same name
+func engineSyncEvent(event sync.Event) engine.Event {
+	out := engine.Event{
+		Type:      engine.EventType(event.Type),
+		Timestamp: event.Time,
+		PeerID:    event.Peer.String(),
+		Count:     event.Changed,
+	}
+	if event.Err != nil {
+		out.Error = event.Err.Error()
+	}
+	return out
+}
+
 type sysLogger struct {
 	label string
 	verbose bool
@@ -208,21 +1027,36 @@ func (l *sysLogger) Errorf(format string, v ...interface{}) {
 	log.Printf("[ERROR] "+format, v...)
 }
 
-func cmdDaemon(args []string) {
-	fs := flag.NewFlagSet("daemon", flag.ExitOnError)
-	name := fs.String("name", "acorde", "Node name for logging")
-	dataDir := fs.String("data", "", "Data directory (default: ~/.acorde)")
-	port := fs.Int("port", 0, "Port to listen on (0 = random)")
-	apiPort := fs.Int("api-port", 0, "Port for REST API (0 = disabled)")
-	enableDHT := fs.Bool("dht", false, "Enable DHT for global peer discovery")
-	enableMDNS := fs.Bool("mdns", true, "Enable mDNS for local discovery")
-	verbose := fs.Bool("verbose", false, "Enable verbose logging")
-	fs.Parse(args)
+func cmdDaemon(c *cli.Context) error {
+	dataDir, err := resolveDataDir(c)
+	if err != nil {
+		return err
+	}
+	log.Printf("🚀 Starting acorde daemon [%s]...", c.String("name"))
 
-	log.Printf("🚀 Starting acorde daemon [%s]...", *name)
+	// Load or generate identity key first: it writes the node ID the
+	// engine records as author and owner, which peers check our changes
+	// against
+	privKey, _, err := loadOrGenerateKey(dataDir)
+	if err != nil {
+		return fmt.Errorf("failed to load identity key: %w", err)
+	}
 
-	// Create engine
-	cfg := engine.Config{DataDir: *dataDir}
+	// Create engine. The sync service and the API server share this single
+	// instance (and its event bus), so only one process opens the database.
+	cfg, err := unlockConfig(dataDir)
+	if err != nil {
+		return err
+	}
+	cfg.EnableAcks = c.Bool("acks")
+	cfg.Clock = engine.ClockKind(c.String("clock"))
+	cfg.MaxClockSkew = c.Duration("max-clock-skew")
+	if cfg.MaxClockSkew == 0 {
+		cfg.MaxClockSkew = -1 // Off
+	}
+	cfg.OnQuarantine = func(q engine.QuarantinedEntry) {
+		log.Printf("⚠️  Quarantined %s %s from sync: %s", q.EntryType, q.EntryID, q.Reason)
+	}
 	e, err := engine.New(cfg)
 	if err != nil {
 		log.Fatalf("Failed to create engine: %v", err)
@@ -231,18 +1065,57 @@ func cmdDaemon(args []string) {
 
 	// Create sync service
 	syncCfg := sync.DefaultConfig()
-	if *port > 0 {
-		syncCfg.ListenAddrs = []string{fmt.Sprintf("/ip4/0.0.0.0/tcp/%d", *port)}
-	}
-	syncCfg.Logger = &sysLogger{label: "sync", verbose: *verbose}
-	syncCfg.EnableDHT = *enableDHT
-	syncCfg.EnableMDNS = *enableMDNS
-
-	// Load or generate identity key
-	privKey, _, err := loadOrGenerateKey(cfg.DataDir)
+	if port := c.Int("port"); port > 0 {
+		syncCfg.ListenAddrs = []string{fmt.Sprintf("/ip4/0.0.0.0/tcp/%d", port)}
+	}
+	syncCfg.Logger = &sysLogger{label: "sync", verbose: c.Bool("verbose")}
+	syncCfg.EnableDHT = c.Bool("dht")
+	syncCfg.EnableMDNS = c.Bool("mdns")
+	if syncCfg.PowerMode, err = sync.ParsePowerMode(c.String("power-mode")); err != nil {
+		return cli.Usagef("%v", err)
+	}
+	syncCfg.LowPowerInterval = c.Duration("low-power-interval")
+	syncCfg.InvitesPath = cfg.DataDir // Redeem invites from 'acorde invite'
+	syncCfg.AllowlistPath = cfg.DataDir
+	syncCfg.StrictAllowlist = c.Bool("strict")
+	syncCfg.EnablePEX = c.Bool("pex")
+	syncCfg.HealthPath = cfg.DataDir // For 'acorde peers list'
+	syncCfg.StateBudget = c.Int("state-budget")
+	syncCfg.SessionLog = c.Int("sync-log")
+	syncCfg.SlowMerge = c.Duration("slow-merge")
+	if syncCfg.Namespaces, err = syncNamespaces(c); err != nil {
+		return err
+	}
+	tokens, err := namespaceTokens(c)
 	if err != nil {
-		log.Fatalf("Failed to load identity key: %v", err)
+		return err
+	}
+	syncCfg.SessionLogPath = cfg.DataDir // For 'acorde sync log'
+	syncCfg.GrantsPath = cfg.DataDir // Deliver keys from 'acorde device revoke'
+	if syncCfg.DeviceKey, err = loadDeviceKey(cfg.DataDir); err != nil {
+		return err
+	}
+	if syncCfg.Chaos, err = chaosConfig(c); err != nil {
+		return err
+	}
+	syncCfg.OnEvent = func(event sync.Event) {
+		e.PublishSyncEvent(engineSyncEvent(event)) // For /events and hooks
+	}
+	if blobs, err := blob.NewStore(cfg.DataDir); err == nil {
+		syncCfg.Blobs = blobs // Fetch file attachments from peers
+		syncCfg.WantBlobs = missingBlobs(e, blobs)
+	} else {
+		log.Printf("⚠️  Blob sync disabled: %v", err)
+	}
+	if cfg.EncryptionKey != nil {
+		syncCfg.VaultKey = cfg.EncryptionKey[:]
+		syncCfg.VaultKeyEpoch = cfg.KeyEpoch
+		syncCfg.OnKeyGrant = func(from peer.ID, key crypto.EpochKey) error {
+			log.Printf("🔑 Vault key rotated by %s, re-encrypting...", from.String()[:8])
+			return e.AdoptKey(key)
+		}
 	}
+
 	syncCfg.PrivateKey = privKey
 
 	adapter := sync.NewEngineAdapter(&syncableEngine{e})
@@ -256,6 +1129,8 @@ func cmdDaemon(args []string) {
 	if err := svc.Start(ctx); err != nil {
 		log.Fatalf("Failed to start sync: %v", err)
 	}
+	var syncRunning atomic.Bool // For GET /readyz
+	syncRunning.Store(true)
 
 	log.Printf("✅ Daemon started! Discovering peers on LAN...")
 	log.Printf("📋 Add entries in another terminal:")
@@ -268,18 +1143,48 @@ func cmdDaemon(args []string) {
 			peers := svc.Peers()
 			metrics := svc.Metrics()
 			if len(peers) > 0 {
-				log.Printf("👥 Connected peers: %d | Syncs: %d success, %d failed",
-					len(peers), metrics.SyncSuccesses, metrics.SyncFailures)
+				log.Printf("👥 Connected peers: %d | Syncs: %d success, %d failed | Merges: %d (%d slow, longest %s)",
+					len(peers), metrics.SyncSuccesses, metrics.SyncFailures,
+					metrics.Merges.Merges, metrics.Merges.SlowMerges, metrics.Merges.MaxDuration.Round(time.Millisecond))
 			}
 		}
 	}()
 
 	// Start API server if requested
-	if *apiPort > 0 {
-		apiServer := api.New(e, func() int { return len(svc.Peers()) })
+	if apiPort := c.Int("api-port"); apiPort > 0 {
+		apiServer := api.New(e, func() api.SyncStatus {
+			metrics := svc.Metrics()
+			return api.SyncStatus{
+				PeerCount:     len(svc.Peers()),
+				SyncAttempts:  metrics.SyncAttempts,
+				SyncSuccesses: metrics.SyncSuccesses,
+				SyncFailures:  metrics.SyncFailures,
+				GatedDials:    metrics.GatedDials,
+				GatedAccepts:  metrics.GatedAccepts,
+				PeerHealth:    peerHealthCounts(svc.PeerHealth()),
+				Merges:        apiMergeStatus(metrics.Merges),
+			}
+		})
+		if blobs, err := engine.NewBlobStore(dataDir); err == nil {
+			apiServer.SetBlobStore(blobs)
+			apiServer.SetBlobRateLimit(c.Int("blob-rate"))
+		}
+		apiServer.SetAuthToken(c.String("api-token"))
+		for token, namespace := range tokens {
+			apiServer.SetNamespaceToken(token, namespace)
+		}
+		apiServer.SetPairing(&daemonPairing{svc: svc, dataDir: dataDir, encrypted: cfg.EncryptionKey != nil})
+		if syncCfg.SessionLog != 0 {
+			apiServer.SetSyncSessions(func() []api.SyncSession {
+				return apiSessions(svc.Sessions())
+			})
+		}
+		apiServer.AddReadinessCheck(vaultCheck(dataDir, cfg))
+		apiServer.AddReadinessCheck(syncCheck(&syncRunning))
+		apiServer.AddReadinessCheck(peersCheck(svc))
 		go func() {
-			log.Printf("🚀 Starting API server on http://localhost:%d", *apiPort)
-			if err := apiServer.ListenAndServe(fmt.Sprintf(":%d", *apiPort)); err != nil {
+			log.Printf("🚀 Starting API server on http://localhost:%d", apiPort)
+			if err := apiServer.ListenAndServe(fmt.Sprintf(":%d", apiPort)); err != nil {
 				log.Printf("API Server error: %v", err)
 			}
 		}()
@@ -291,141 +1196,528 @@ func cmdDaemon(args []string) {
 	<-sigCh
 
 	log.Printf("🛑 Shutting down...")
+	syncRunning.Store(false)
 	cancel()
 	svc.Stop()
 	log.Printf("👋 Goodbye!")
+	return nil
 }
 
-func cmdAdd(e engine.Engine, args []string) {
-	fs := flag.NewFlagSet("add", flag.ExitOnError)
-	typeStr := fs.String("type", "note", "Entry type")
-	content := fs.String("content", "", "Entry content")
-	tagsStr := fs.String("tags", "", "Comma-separated tags")
-	public := fs.Bool("public", false, "Make entry public (readable by everyone)")
-	fs.Parse(args)
+func cmdAdd(c *cli.Context, e engine.Engine) error {
+	if c.String("template") != "" {
+		if c.Bool("validate") {
+			return cli.Usagef("--validate checks given content: drop --template")
+		}
+		return cmdAddTemplate(c, e)
+	}
+	if c.IsSet("vars") {
+		return cli.Usagef("--vars needs --template")
+	}
+	in, _, err := readContent(c, 0)
+	if err != nil {
+		return err
+	}
+	entryType := engine.EntryType(c.String("type"))
+	if c.Bool("validate") {
+		return validateContent(c, e, entryType, in.Data)
+	}
+	if useBlob(in, entryType, c.IsSet("type")) {
+		entryType = engine.File
+		if in.Data, err = storeBlob(e, in); err != nil {
+			return err
+		}
+	}
 
 	var tags []string
-	if *tagsStr != "" {
-		tags = strings.Split(*tagsStr, ",")
+	if tagsStr := c.String("tags"); tagsStr != "" {
+		tags = strings.Split(tagsStr, ",")
 		for i, t := range tags {
 			tags[i] = strings.TrimSpace(t)
 		}
 	}
 
-	entryType := engine.EntryType(*typeStr)
 	entry, err := e.AddEntry(engine.AddEntryInput{
-		Type:    entryType,
-		Content: []byte(*content),
-		Tags:    tags,
-		Public:  *public,
+		Type:      entryType,
+		Content:   in.Data,
+		Tags:      tags,
+		Public:    c.Bool("public"),
+		Namespace: namespaceArg(c.String("namespace")),
 	})
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		return err
 	}
-	printEntry(entry)
+	printEntry(c, entry, "", false)
+	return nil
 }
 
-func cmdGet(e engine.Engine, args []string) {
-	if len(args) < 1 {
-		fmt.Fprintln(os.Stderr, "Usage: acorde get <uuid>")
-		os.Exit(1)
-	}
-	id, err := uuid.Parse(args[0])
+func cmdGet(c *cli.Context, e engine.Engine) error {
+	id, err := entryIDArg(c, e)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: invalid UUID %q\n", args[0])
-		os.Exit(1)
+		return err
 	}
 	entry, err := e.GetEntry(id)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		return err
+	}
+	if c.Bool("copy") {
+		return cmdGetCopy(c, entry)
+	}
+	if c.IsSet("field") || c.IsSet("clear-after") {
+		return cli.Usagef("--field and --clear-after need --copy")
+	}
+	path := ""
+	if entry.Collection != uuid.Nil {
+		paths, err := collectionPaths(e)
+		if err != nil {
+			return err
+		}
+		path = paths[entry.Collection]
 	}
-	printEntry(entry)
+	printEntry(c, entry, path, c.Bool("raw"))
+	return nil
 }
 
-func cmdList(e engine.Engine, args []string) {
-	fs := flag.NewFlagSet("list", flag.ExitOnError)
-	typeStr := fs.String("type", "", "Filter by type")
-	tag := fs.String("tag", "", "Filter by tag")
-	fs.Parse(args)
-
+func cmdList(c *cli.Context, e engine.Engine) error {
 	filter := engine.ListFilter{}
-	if *typeStr != "" {
-		t := engine.EntryType(*typeStr)
+	if typeStr := c.String("type"); typeStr != "" {
+		t := engine.EntryType(typeStr)
 		filter.Type = &t
 	}
-	if *tag != "" {
-		filter.Tag = tag
+	if tag := c.String("tag"); tag != "" {
+		filter.Tag = &tag
+	}
+	if c.IsSet("namespace") {
+		namespace := namespaceArg(c.String("namespace"))
+		filter.Namespace = &namespace
+	}
+	filter.Archived = c.Bool("archived")
+	filter.OnlyArchived = c.Bool("only-archived")
+	filter.WithoutContent = c.Bool("no-content")
+	switch sort := engine.SortField(c.String("sort")); sort {
+	case "", engine.SortUpdatedAt, engine.SortCreatedAt, engine.SortTitle:
+		filter.Sort = sort
+	default:
+		return cli.Usagef("invalid --sort %q (use updated_at, created_at or title)", sort)
+	}
+	filter.Ascending = c.Bool("asc")
+	if path := c.String("collection"); path != "" {
+		collection, err := e.ResolveCollection(path)
+		if err != nil {
+			return err
+		}
+		filter.Collection = &collection.ID
+		filter.Subcollections = c.Bool("recursive")
+	} else if c.Bool("recursive") {
+		return cli.Usagef("--recursive needs --collection")
+	}
+
+	if c.Bool("count") {
+		n, err := e.Count(filter)
+		if err != nil {
+			return err
+		}
+		if c.Bool("json") {
+			return printJSON(countJSON{Count: n})
+		}
+		fmt.Println(n)
+		return nil
 	}
 
-	entries, err := e.ListEntries(filter)
+	listed, err := e.ListEntriesChecked(filter)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		return err
+	}
+	paths, err := collectionPaths(e)
+	if err != nil {
+		return err
+	}
+	entries := listed.Entries
+	if n := len(listed.Corrupt); n > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: skipped %d entries that do not decrypt (run acorde doctor)\n", n)
 	}
 
+	if c.Bool("json") {
+		out := make([]entryJSON, len(entries))
+		for i, entry := range entries {
+			out[i] = toEntryJSON(masked(c, entry))
+			out[i].Collection = paths[entry.Collection]
+		}
+		return printJSON(out)
+	}
 	if len(entries) == 0 {
 		fmt.Println("No entries found.")
-		return
+		return nil
 	}
 	for _, entry := range entries {
-		fmt.Printf("%s [%s] %s\n", entry.ID.String(), entry.Type, string(entry.Content)[:min(40, len(entry.Content))])
+		entry = masked(c, entry)
+		archived := ""
+		if entry.Archived {
+			archived = " (archived)"
+		}
+		if path := paths[entry.Collection]; path != "" {
+			archived = "  " + path + archived
+		}
+		preview := entry.Title
+		if preview == "" {
+			preview = string(entry.Content)[:min(40, len(entry.Content))]
+		}
+		fmt.Printf("%s [%s] %s%s%s\n", entry.ID.String(), entry.Type, preview, formatUpdated(entry, c.Bool("raw")), archived)
 	}
+	return nil
 }
 
-func cmdUpdate(e engine.Engine, args []string) {
-	if len(args) < 1 {
-		fmt.Fprintln(os.Stderr, "Usage: acorde update <uuid> --content <new>")
-		os.Exit(1)
+func cmdUpdate(c *cli.Context, e engine.Engine) error {
+	id, err := entryIDArg(c, e)
+	if err != nil {
+		return err
 	}
-	id, err := uuid.Parse(args[0])
+
+	in, ok, err := readContent(c, 1)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: invalid UUID %q\n", args[0])
-		os.Exit(1)
+		return err
+	}
+
+	if c.Bool("validate") {
+		if !ok {
+			return cli.Usagef("--validate needs new content")
+		}
+		entry, err := e.GetEntry(id)
+		if err != nil {
+			return err
+		}
+		return validateContent(c, e, entry.Type, in.Data)
 	}
-	fs := flag.NewFlagSet("update", flag.ExitOnError)
-	content := fs.String("content", "", "New content")
-	fs.Parse(args[1:])
 
 	input := engine.UpdateEntryInput{}
-	if *content != "" {
-		c := []byte(*content)
-		input.Content = &c
+	if ok {
+		// File entries keep referencing a blob
+		entry, err := e.GetEntry(id)
+		if err != nil {
+			return err
+		}
+		if useBlob(in, entry.Type, true) {
+			if in.Data, err = storeBlob(e, in); err != nil {
+				return err
+			}
+		}
+		input.Content = &in.Data
 	}
 	if err := e.UpdateEntry(id, input); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		return err
+	}
+	if c.Bool("json") {
+		entry, err := e.GetEntry(id)
+		if err != nil {
+			return err
+		}
+		return printJSON(toEntryJSON(masked(c, entry)))
 	}
 	fmt.Println("Updated.")
+	return nil
+}
+
+func cmdDelete(c *cli.Context, e engine.Engine) error {
+	var entries []engine.Entry
+	query := c.String("query")
+	if query != "" {
+		if c.NArg() > 0 {
+			return cli.Usagef("give entry IDs or --query, not both")
+		}
+		result, err := e.Query(query)
+		if err != nil {
+			return err
+		}
+		for _, entry := range result.Entries {
+			if !entry.Deleted {
+				entries = append(entries, entry)
+			}
+		}
+	} else {
+		ids, err := entryIDArgs(c, e)
+		if err != nil {
+			return err
+		}
+		// Look every entry up first, so that a bad ID deletes nothing
+		entries = make([]engine.Entry, len(ids))
+		for i, id := range ids {
+			if entries[i], err = e.GetEntry(id); err != nil {
+				return err
+			}
+		}
+	}
+	ids := make([]uuid.UUID, len(entries))
+	for i, entry := range entries {
+		ids[i] = entry.ID
+	}
+
+	dryRun := c.Bool("dry-run")
+	if dryRun {
+		for _, entry := range entries {
+			fmt.Fprintf(info(c), "Would delete %s\n", describe(entry))
+		}
+	} else if len(ids) > 0 {
+		confirm := confirmChanges
+		if query != "" {
+			// A query may match more than meant: always confirm
+			confirm = askChanges
+		}
+		ok, err := confirm(c, "delete", len(ids))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("aborted")
+		}
+		if _, err := e.DeleteEntries(ids); err != nil {
+			return err
+		}
+	}
+
+	if c.Bool("json") {
+		out := make([]deletedJSON, len(ids))
+		for i, id := range ids {
+			out[i] = deletedJSON{ID: id.String(), Deleted: !dryRun, DryRun: dryRun}
+		}
+		if len(out) == 1 && query == "" {
+			return printJSON(out[0])
+		}
+		return printJSON(out)
+	}
+	switch {
+	case dryRun:
+		fmt.Printf("Dry run: %d entries would be deleted.\n", len(ids))
+	case len(ids) == 1:
+		fmt.Println("Deleted.")
+	default:
+		fmt.Printf("Deleted %d entries.\n", len(ids))
+	}
+	return nil
+}
+
+func cmdTag(c *cli.Context, e engine.Engine) error {
+	add, remove := splitTags(c.String("add")), splitTags(c.String("remove"))
+	if len(add) == 0 && len(remove) == 0 {
+		return cli.Usagef("nothing to do: use --add and/or --remove")
+	}
+
+	var entries []engine.Entry
+	switch {
+	case c.NArg() > 0:
+		if c.IsSet("type") || c.IsSet("tag") {
+			return cli.Usagef("give entry IDs or --type/--tag, not both")
+		}
+		ids, err := entryIDArgs(c, e)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			entry, err := e.GetEntry(id)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+		}
+	case c.IsSet("type") || c.IsSet("tag"):
+		filter := engine.ListFilter{}
+		if typeStr := c.String("type"); typeStr != "" {
+			t := engine.EntryType(typeStr)
+			filter.Type = &t
+		}
+		if tag := c.String("tag"); tag != "" {
+			filter.Tag = &tag
+		}
+		var err error
+		if entries, err = e.ListEntries(filter); err != nil {
+			return err
+		}
+	default:
+		return cli.Usagef("select entries by ID or with --type/--tag")
+	}
+
+	// Only entries whose tags actually change are updated
+	var ids []uuid.UUID
+	var changed []taggedJSON
+	for _, entry := range entries {
+		if tags, ok := retag(entry.Tags, add, remove); ok {
+			ids = append(ids, entry.ID)
+			changed = append(changed, taggedJSON{ID: entry.ID.String(), Tags: tags})
+		}
+	}
+
+	dryRun := c.Bool("dry-run")
+	if dryRun {
+		for i := range changed {
+			changed[i].DryRun = true
+			fmt.Fprintf(info(c), "Would tag %s: %s\n", changed[i].ID, strings.Join(changed[i].Tags, ","))
+		}
+	} else {
+		ok, err := confirmChanges(c, "retag", len(changed))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("aborted")
+		}
+		err = e.Bulk(func(b engine.Batch) error {
+			for i, id := range ids {
+				if err := b.UpdateEntry(id, engine.UpdateEntryInput{Tags: &changed[i].Tags}); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.Bool("json") {
+		if changed == nil {
+			changed = []taggedJSON{}
+		}
+		return printJSON(changed)
+	}
+	if dryRun {
+		fmt.Printf("Dry run: %d of %d entries would change.\n", len(changed), len(entries))
+	} else {
+		fmt.Printf("Retagged %d of %d entries.\n", len(changed), len(entries))
+	}
+	return nil
+}
+
+// retag applies tag additions and removals, keeping the existing order.
+// ok is false if the tags do not change.
+func retag(tags, add, remove []string) (result []string, ok bool) {
+	drop := make(map[string]bool, len(remove))
+	for _, t := range remove {
+		drop[t] = true
+	}
+	seen := make(map[string]bool)
+	result = []string{}
+	for _, t := range append(append([]string{}, tags...), add...) {
+		if drop[t] || seen[t] {
+			continue
+		}
+		seen[t] = true
+		result = append(result, t)
+	}
+	return result, !slices.Equal(result, tags)
+}
+
+// splitTags parses a comma-separated tag list
+func splitTags(s string) []string {
+	var tags []string
+	for _, t := range strings.Split(s, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	return tags
 }
 
-func cmdDelete(e engine.Engine, args []string) {
-	if len(args) < 1 {
-		fmt.Fprintln(os.Stderr, "Usage: acorde delete <uuid>")
-		os.Exit(1)
+func cmdShare(c *cli.Context, e engine.Engine) error {
+	if c.NArg() < 2 {
+		return cli.Usagef("expected an entry ID and at least one peer ID")
 	}
-	id, err := uuid.Parse(args[0])
+	id, err := entryIDArg(c, e)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: invalid UUID %q\n", args[0])
-		os.Exit(1)
+		return err
+	}
+	if err := e.ShareEntry(id, c.Args[1:]); err != nil {
+		return err
+	}
+	if c.Bool("json") {
+		return printJSON(sharedJSON{ID: id.String(), SharedWith: c.Args[1:]})
+	}
+	fmt.Printf("Shared with %d device(s). The key is delivered on the next sync.\n", c.NArg()-1)
+	return nil
+}
+
+// entryIDArgs parses the entry IDs given as arguments
+func entryIDArgs(c *cli.Context, e engine.Engine) ([]uuid.UUID, error) {
+	if c.NArg() < 1 {
+		return nil, cli.Usagef("missing entry ID")
+	}
+	ids := make([]uuid.UUID, c.NArg())
+	for i, arg := range c.Args {
+		id, err := parseEntryID(e, arg)
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = id
 	}
-	if err := e.DeleteEntry(id); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+	return ids, nil
+}
+
+// entryIDArg parses the entry ID given as the first argument
+func entryIDArg(c *cli.Context, e engine.Engine) (uuid.UUID, error) {
+	if c.NArg() < 1 {
+		return uuid.Nil, cli.Usagef("missing entry ID")
+	}
+	return parseEntryID(e, c.Arg(0))
+}
+
+// parseEntryID parses an entry ID, or resolves a reference to one: a
+// unique prefix such as 8f3a, title:"groceries" or tag:inbox
+func parseEntryID(e engine.Engine, arg string) (uuid.UUID, error) {
+	id, err := e.Resolve(arg)
+	if err != nil && !errors.Is(err, engine.ErrUnknownID) && !errors.Is(err, engine.ErrAmbiguousID) {
+		return uuid.Nil, cli.Usagef("%v", err)
 	}
-	fmt.Println("Deleted.")
+	return id, err
 }
 
-func printEntry(entry engine.Entry) {
+// printEntry prints an entry as JSON with RFC3339 dates, or with its
+// logical clock times when raw is set, and with the path of the
+// collection it is filed in ("" = none). With --json it prints entryJSON.
+func printEntry(c *cli.Context, entry engine.Entry, collection string, raw bool) {
+	entry = masked(c, entry)
+	if c.Bool("json") {
+		out := toEntryJSON(entry)
+		out.Collection = collection
+		printJSON(out)
+		return
+	}
 	data := map[string]interface{}{
 		"id":      entry.ID.String(),
 		"type":    string(entry.Type),
 		"content": string(entry.Content),
 		"tags":    entry.Tags,
 	}
-	out, _ := json.MarshalIndent(data, "", "  ")
-	fmt.Println(string(out))
+	if collection != "" {
+		data["collection"] = collection
+	}
+	if entry.Namespace != "" {
+		data["namespace"] = entry.Namespace
+	}
+	if raw {
+		data["created_at"] = entry.CreatedAt
+		data["updated_at"] = entry.UpdatedAt
+	} else {
+		if !entry.CreatedTime.IsZero() {
+			data["created"] = formatTime(entry.CreatedTime)
+		}
+		if !entry.UpdatedTime.IsZero() {
+			data["updated"] = formatTime(entry.UpdatedTime)
+		}
+	}
+	printJSON(data)
+}
+
+// formatUpdated renders an entry's last change time for list output
+func formatUpdated(entry engine.Entry, raw bool) string {
+	if raw {
+		return fmt.Sprintf("  (@%d)", entry.UpdatedAt)
+	}
+	if entry.UpdatedTime.IsZero() {
+		return ""
+	}
+	return "  (" + formatTime(entry.UpdatedTime) + ")"
+}
+
+// formatTime renders a wall-clock time as local RFC3339
+func formatTime(t time.Time) string {
+	return t.Local().Format(time.RFC3339)
 }
 
 func min(a, b int) int {
@@ -433,28 +1725,31 @@ func min(a, b int) int {
 	return b
 }
 
-func cmdInvite(args []string) {
-	fs := flag.NewFlagSet("invite", flag.ExitOnError)
-	dataDir := fs.String("data", "", "Data directory")
-	expiry := fs.Duration("expiry", 24*time.Hour, "Invite expiry duration")
-	port := fs.Int("port", 0, "Port to listen/advertise (0 = random)")
-	verbose := fs.Bool("verbose", false, "Enable verbose logging")
-	fs.Parse(args)
+func cmdInvite(c *cli.Context) error {
+	dataDir, err := resolveDataDir(c)
+	if err != nil {
+		return err
+	}
+	oneTime, usePIN := c.Bool("one-time"), c.Bool("pin")
+	qrLevel, err := sync.ParseQRLevel(c.String("qr-level"))
+	if err != nil {
+		return cli.Usagef("%v", err)
+	}
 
-	cfg := engine.Config{DataDir: *dataDir}
+	cfg := engine.Config{DataDir: dataDir, DisableSearch: true}
 	e, err := engine.New(cfg)
 	if err != nil {
-		log.Fatalf("Error: %v", err)
+		return err
 	}
 	defer e.Close()
 
 	// Create sync service just for the host
 	syncCfg := sync.DefaultConfig()
-	if *port > 0 {
-		syncCfg.ListenAddrs = []string{fmt.Sprintf("/ip4/0.0.0.0/tcp/%d", *port)}
+	if port := c.Int("port"); port > 0 {
+		syncCfg.ListenAddrs = []string{fmt.Sprintf("/ip4/0.0.0.0/tcp/%d", port)}
 	}
 	syncCfg.EnableMDNS = false
-	syncCfg.Logger = &sysLogger{label: "sync", verbose: *verbose}
+	syncCfg.Logger = &sysLogger{label: "sync", verbose: c.Bool("verbose")}
 
 	// Load identity key (must match daemon if running)
 	privKey, _, err := loadOrGenerateKey(cfg.DataDir)
@@ -472,30 +1767,69 @@ func cmdInvite(args []string) {
 
 	// Get the host from the service
 	// Use interface method
-	invite, err := sync.CreateInvite(svc.GetHost(), *expiry)
+	invite, err := sync.CreateInviteWithOptions(svc.GetHost(), sync.InviteOptions{
+		Expiry:  c.Duration("expiry"),
+		OneTime: oneTime,
+		PIN:     usePIN,
+	})
 	if err != nil {
 		log.Fatalf("Failed to create invite: %v", err)
 	}
 
-	// If encrypted, include key
 	store := crypto.NewFileKeyStore(cfg.DataDir)
-	if store.IsInitialized() {
-		fmt.Printf("🔒 Vault is encrypted. Enter password to include key in invite: ")
+	encrypted := store.IsInitialized()
+
+	// Legacy: embed the key in the code itself
+	if encrypted && (c.Bool("embed-key") || !invite.IsRedeemable()) {
+		fmt.Fprintf(os.Stderr, "🔒 Vault is encrypted. Enter password to include key in invite: ")
 		password, err := readPassword()
 		if err != nil {
 			log.Fatalf("\nError: %v", err)
 		}
-		fmt.Println("")
-		
+		fmt.Fprintln(os.Stderr)
+
 		key, err := store.Unlock(password)
 		if err != nil {
 			log.Fatalf("Failed to unlock: %v", err)
 		}
-		invite.Key = key[:]
+		invite.Key, invite.KeyEpoch = key[:], store.Epoch()
+	}
+
+	if c.Bool("include-peers") {
+		if invite.Trust, err = trustBundle(cfg.DataDir); err != nil {
+			return fmt.Errorf("failed to export trusted devices: %w", err)
+		}
+	}
+
+	// Register redeemable invites for the daemon to honor
+	pin, err := registerInvite(cfg.DataDir, invite, encrypted)
+	if err != nil {
+		return fmt.Errorf("failed to register invite: %w", err)
+	}
+
+	fullCode, _ := invite.Encode()
+	if path := c.String("png"); path != "" {
+		png, err := invite.ToQRWith(qrLevel, sync.QRSize)
+		if err != nil {
+			return fmt.Errorf("failed to render QR code: %w", err)
+		}
+		if err := os.WriteFile(path, png, 0600); err != nil {
+			return fmt.Errorf("failed to write QR code: %w", err)
+		}
+		fmt.Fprintf(info(c), "QR code written to %s\n", path)
+	}
+	if c.Bool("json") {
+		return printJSON(inviteJSON{
+			Code:      invite.ToMinimalCode(),
+			FullCode:  fullCode,
+			ExpiresAt: formatTime(time.Unix(invite.ExpiresAt, 0)),
+			PIN:       pin,
+			OneTime:   invite.IsRedeemable() && oneTime,
+		})
 	}
 
 	// Print QR code
-	qrStr, err := invite.ToQRString()
+	qrStr, err := invite.ToQRStringWith(qrLevel, c.Bool("qr-invert"))
 	if err == nil {
 		fmt.Println(qrStr)
 	}
@@ -505,38 +1839,54 @@ func cmdInvite(args []string) {
 	fmt.Printf("Expires in: %s\n", invite.ExpiresIn().Round(time.Minute))
 
 	// Also print full code for copy/paste
-	fullCode, _ := invite.Encode()
 	fmt.Printf("\nFull code (for CLI): %s\n", fullCode)
+	if invite.Trust != nil {
+		fmt.Printf("The full code also lists the %d devices this one trusts.\n", len(invite.Trust.Peers))
+	}
+
+	if invite.IsRedeemable() {
+		if pin != "" {
+			fmt.Printf("\n🔢 PIN: %s  (tell it to the other person; do not send it with the code)\n", pin)
+		}
+		if oneTime {
+			fmt.Println("This invite can be used once.")
+		}
+		if encrypted && len(invite.Key) == 0 {
+			fmt.Println("The vault key is sent only after the PIN is confirmed.")
+		}
+		fmt.Println("Keep 'acorde daemon' running so the other device can pair.")
+	}
+	return nil
 }
 
-func cmdPair(args []string) {
-	fs := flag.NewFlagSet("pair", flag.ExitOnError)
-	dataDir := fs.String("data", "", "Data directory")
-	verbose := fs.Bool("verbose", false, "Enable verbose logging")
-	fs.Parse(args)
+func cmdPair(c *cli.Context) error {
+	if c.NArg() < 1 {
+		return cli.Usagef("missing invite code")
+	}
+	inviteCode := c.Arg(0)
+	pin := c.String("pin")
 
-	if fs.NArg() < 1 {
-		fmt.Fprintf(os.Stderr, "Usage: acorde pair [options] <invite-code>\n")
-		// Also support <invite-code> [options] if passed that way, though standard flag requires options first
-		os.Exit(1)
+	dataDir, err := resolveDataDir(c)
+	if err != nil {
+		return err
 	}
-	inviteCode := fs.Arg(0)
-	
+
 	// Load allowlist/engine
-	cfg := engine.Config{DataDir: *dataDir}
+	cfg := engine.Config{DataDir: dataDir, DisableSearch: true}
 	e, err := engine.New(cfg)
 	if err != nil {
-		log.Fatalf("Error: %v", err)
+		return err
 	}
 	defer e.Close()
 
 	// Create sync service
 	syncCfg := sync.DefaultConfig()
-	if *dataDir != "" {
-		syncCfg.AllowlistPath = *dataDir // Use data dir name for peer file location
+	syncCfg.AllowlistPath = cfg.DataDir
+	if syncCfg.DeviceKey, err = loadDeviceKey(cfg.DataDir); err != nil {
+		return err
 	}
-	syncCfg.Logger = &sysLogger{label: "sync", verbose: *verbose}
-	
+	syncCfg.Logger = &sysLogger{label: "sync", verbose: c.Bool("verbose")}
+
 	// Load identity key to ensure we match the daemon's ID
 	privKey, _, err := loadOrGenerateKey(cfg.DataDir)
 	if err != nil {
@@ -550,7 +1900,7 @@ func cmdPair(args []string) {
 		log.Fatalf("Failed to create service: %v", err)
 	}
 	defer svc.Stop()
-	
+
 	// Start service to allow connection
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -564,115 +1914,332 @@ func cmdPair(args []string) {
 		log.Fatalf("Invalid invite: %v", err)
 	}
 
-	// Handle key if present
-	if len(invite.Key) > 0 {
+	if invite.PIN && pin == "" {
+		fmt.Fprintf(os.Stderr, "🔢 Enter the PIN shown on the inviting device: ")
+		entered, err := readPassword()
+		if err != nil {
+			log.Fatalf("\nError: %v", err)
+		}
+		fmt.Fprintln(os.Stderr)
+		pin = strings.TrimSpace(string(entered))
+	}
+
+	fmt.Fprintf(info(c), "Connecting to peer %s...\n", invite.PeerID)
+
+	// Redeem the invite and connect
+	vaultKey, err := svc.Pair(ctx, invite, pin)
+	if err != nil {
+		log.Fatalf("Failed to pair: %v", err)
+	}
+
+	// Handle key if the inviter shared one
+	if vaultKey != nil {
 		store := crypto.NewFileKeyStore(cfg.DataDir)
 		if !store.IsInitialized() {
-			fmt.Printf("🔑 Invite contains encryption key. Set a password to protect it: ")
+			fmt.Fprintf(os.Stderr, "🔑 Received the vault encryption key. Set a password to protect it: ")
 			pass1, err := readPassword()
 			if err != nil {
 				log.Fatalf("\nError: %v", err)
 			}
-			fmt.Printf("\nConfirm password: ")
+			fmt.Fprintf(os.Stderr, "\nConfirm password: ")
 			pass2, err := readPassword()
 			if err != nil {
 				log.Fatalf("\nError: %v", err)
 			}
-			fmt.Println("")
-			
+			fmt.Fprintln(os.Stderr)
+
 			if string(pass1) != string(pass2) {
 				log.Fatalf("Passwords do not match")
 			}
-			
-			var key crypto.Key
-			if len(invite.Key) != crypto.KeySize {
-				log.Fatalf("Invalid key size in invite")
-			}
-			copy(key[:], invite.Key)
-			
-			if err := store.InitializeWithKey(pass1, key); err != nil {
+
+			if err := storeVaultKey(cfg.DataDir, *vaultKey, pass1); err != nil {
 				log.Fatalf("Failed to initialize vault with key: %v", err)
 			}
-			fmt.Println("✅ Vault initialized with imported key.")
+			fmt.Fprintln(info(c), "✅ Vault initialized with imported key.")
 		}
 	}
 
-	fmt.Printf("Connecting to peer %s...\n", invite.PeerID)
-	
-	// Connect
-	if err := svc.ConnectPeer(invite); err != nil {
-		log.Fatalf("Failed to pair: %v", err)
+	trusted := 0
+	if invite.Trust != nil {
+		trusted = len(invite.Trust.Peers)
+	}
+	if c.Bool("json") {
+		return printJSON(pairJSON{PeerID: invite.PeerID, VaultKeyReceived: vaultKey != nil, TrustedPeers: trusted})
 	}
-
 	fmt.Printf("✅ Successfully paired and connected!\n")
+	if trusted > 0 {
+		fmt.Printf("Also trusting the %d devices the inviter trusts.\n", trusted)
+	}
 	fmt.Printf("Peer added to allowlist. Start daemon to begin syncing.\n")
+	return nil
 }
 
-func cmdInit(args []string) {
-	fs := flag.NewFlagSet("init", flag.ExitOnError)
-	dataDir := fs.String("data", "", "Data directory")
-	fs.Parse(args)
+func cmdDeviceList(c *cli.Context) error {
+	dir, err := resolveDataDir(c)
+	if err != nil {
+		return err
+	}
+	allowlist, err := sync.NewAllowlist(dir, false)
+	if err != nil {
+		return fmt.Errorf("failed to load allowlist: %w", err)
+	}
+	pending := make(map[string]bool)
+	if grants, err := sync.NewGrantStore(dir).Outgoing(); err == nil {
+		for _, g := range grants {
+			pending[g.Peer] = true
+		}
+	}
 
-	dir := *dataDir
-	if dir == "" {
-		home, err := os.UserHomeDir()
-		if err != nil {
-			log.Fatalf("Failed to get user home directory: %v", err)
+	peers := allowlist.List()
+	devices := make([]deviceJSON, len(peers))
+	for i, p := range peers {
+		status := "ok"
+		switch {
+		case pending[p.PeerID]:
+			status = "key_update_pending"
+		case len(p.DeviceKey) == 0:
+			status = "no_device_key"
+		}
+		devices[i] = deviceJSON{PeerID: p.PeerID, Status: status}
+	}
+
+	if c.Bool("json") {
+		return printJSON(devices)
+	}
+	if len(devices) == 0 {
+		fmt.Println("No trusted devices. Pair one with 'acorde invite'.")
+		return nil
+	}
+	for _, d := range devices {
+		status := d.Status
+		switch status {
+		case "key_update_pending":
+			status = "key update pending"
+		case "no_device_key":
+			status = "no device key (re-pair to receive key rotations)"
 		}
-		dir = filepath.Join(home, ".acorde")
+		fmt.Printf("%s  %s\n", d.PeerID, status)
+	}
+	return nil
+}
+
+func cmdDeviceRevoke(c *cli.Context) error {
+	if c.NArg() < 1 {
+		return cli.Usagef("missing peer ID")
+	}
+	revoked, err := peer.Decode(c.Arg(0))
+	if err != nil {
+		return cli.Usagef("invalid peer ID: %v", err)
+	}
+
+	dir, err := resolveDataDir(c)
+	if err != nil {
+		return err
+	}
+	if _, self, err := loadOrGenerateKey(dir); err == nil && self == revoked {
+		return fmt.Errorf("cannot revoke this device")
+	}
+
+	// Revoke first, so the device is refused even if rotation fails
+	allowlist, err := sync.NewAllowlist(dir, false)
+	if err != nil {
+		return fmt.Errorf("failed to load allowlist: %w", err)
+	}
+	if err := allowlist.Revoke(revoked); err != nil {
+		return fmt.Errorf("failed to revoke device: %w", err)
 	}
+	grants := sync.NewGrantStore(dir)
+	grants.RemovePeer(revoked.String())
+	fmt.Fprintf(info(c), "🚫 Revoked %s\n", revoked)
 
 	store := crypto.NewFileKeyStore(dir)
-	if store.IsInitialized() {
-		fmt.Println("Vault already initialized.")
-		return
+	if !store.IsInitialized() {
+		if c.Bool("json") {
+			return printJSON(revokeJSON{Revoked: revoked.String(), NoKey: []string{}})
+		}
+		fmt.Println("Vault is not encrypted; no key to rotate.")
+		return nil
+	}
+
+	cfg, password, err := unlockVault(dir)
+	if err != nil {
+		return err
+	}
+	e, err := engine.New(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to open vault: %w", err)
+	}
+	defer e.Close()
+
+	// Rotate: re-encrypt everything, then persist the new key. If the
+	// keystore cannot be updated, rotate back so the vault stays readable.
+	oldKey := *cfg.EncryptionKey
+	newKey, err := crypto.GenerateKey()
+	if err != nil {
+		return fmt.Errorf("failed to generate key: %w", err)
+	}
+	fmt.Fprintln(info(c), "🔑 Rotating vault key and re-encrypting content...")
+	if err := e.RotateKey(newKey); err != nil {
+		return fmt.Errorf("failed to rotate key: %w", err)
+	}
+	if err := store.Rekey(password, newKey); err != nil {
+		if rerr := e.RotateKey(oldKey); rerr != nil {
+			return fmt.Errorf("failed to save new key (%v) and to roll back: %w", err, rerr)
+		}
+		return fmt.Errorf("failed to save new key: %w", err)
 	}
 
-	fmt.Printf("Enter new password: ")
-	pass1, err := readPassword()
+	// Queue the new key for the remaining devices
+	device, err := loadDeviceKey(dir)
 	if err != nil {
-		log.Fatalf("\nError reading password: %v", err)
+		return err
+	}
+	rotationID := uuid.New()
+	var queued []sync.KeyGrant
+	missing := []string{}
+	for _, p := range allowlist.List() {
+		to, err := peer.Decode(p.PeerID)
+		if err != nil {
+			continue
+		}
+		if len(p.DeviceKey) == 0 {
+			missing = append(missing, p.PeerID)
+			continue
+		}
+		grant, err := sync.NewKeyGrant(rotationID, to, crypto.EpochKey{Epoch: store.Epoch(), Key: newKey}, device, p.DeviceKey)
+		if err != nil {
+			return fmt.Errorf("failed to wrap key for %s: %w", p.PeerID, err)
+		}
+		queued = append(queued, grant)
+	}
+	if err := grants.AddOutgoing(queued...); err != nil {
+		return fmt.Errorf("failed to queue key grants: %w", err)
 	}
-	fmt.Printf("\nConfirm password: ")
-	pass2, err := readPassword()
+
+	if c.Bool("json") {
+		return printJSON(revokeJSON{Revoked: revoked.String(), KeyRotated: true, GrantsSent: len(queued), NoKey: missing})
+	}
+	fmt.Println("✅ Vault key rotated.")
+	if len(queued) > 0 {
+		fmt.Printf("The new key will be sent to %d device(s) when 'acorde daemon' next connects to them.\n", len(queued))
+	}
+	for _, id := range missing {
+		fmt.Printf("⚠️  %s has no device key and cannot receive the new key; re-pair it with 'acorde invite'.\n", id)
+	}
+	return nil
+}
+
+func cmdInit(c *cli.Context) error {
+	dir, err := resolveDataDir(c)
 	if err != nil {
-		log.Fatalf("\nError reading password: %v", err)
+		return err
+	}
+
+	var store *crypto.FileKeyStore
+	switch protection := c.String("key-protection"); protection {
+	case "password":
+		store = crypto.NewFileKeyStore(dir)
+	case "hardware":
+		sealer, err := crypto.DefaultSealer()
+		if err != nil {
+			return err
+		}
+		store = crypto.NewHardwareKeyStore(dir, sealer)
+	default:
+		return cli.Usagef("unknown key protection %q (use password or hardware)", protection)
+	}
+	shares, threshold := c.Int("recovery-shares"), c.Int("recovery-threshold")
+	if shares != 0 || threshold != 0 {
+		if threshold < 2 || threshold > shares || shares > 255 {
+			return cli.Usagef("need 2 <= --recovery-threshold <= --recovery-shares <= 255")
+		}
+	}
+	if store.IsInitialized() {
+		if c.Bool("json") {
+			return printJSON(initJSON{DataDir: dir, KeyProtection: store.Protection()})
+		}
+		fmt.Println("Vault already initialized.")
+		return nil
 	}
-	fmt.Println("")
 
-	if string(pass1) != string(pass2) {
-		fmt.Println("Passwords do not match!")
-		os.Exit(1)
+	if err := configureArgon2(c, store, true); err != nil {
+		return err
+	}
+	pass1, err := readNewPassword(c, "Enter new password: ")
+	if err != nil {
+		return err
 	}
 
 	if err := store.Initialize(pass1); err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to initialize: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("failed to initialize: %w", err)
+	}
+	var recovery []crypto.Share
+	if shares > 0 {
+		if recovery, err = store.CreateRecoveryShares(pass1, shares, threshold); err != nil {
+			return fmt.Errorf("failed to create recovery shares: %w", err)
+		}
 	}
 
-	fmt.Printf("✅ Vault initialized at %s\n", dir)
+	if c.Bool("json") {
+		out := initJSON{DataDir: dir, KeyProtection: store.Protection(), Created: true}
+		if params, ok := store.Argon2Params(); ok {
+			out.Argon2 = &params
+		}
+		if len(recovery) > 0 {
+			out.RecoveryThreshold = threshold
+			for _, share := range recovery {
+				out.RecoveryShares = append(out.RecoveryShares, share.Words())
+			}
+		}
+		return printJSON(out)
+	}
+	fmt.Printf("✅ Vault initialized at %s (key protection: %s)\n", dir, store.Protection())
+	if params, ok := store.Argon2Params(); ok {
+		fmt.Printf("   Key derivation: %s\n", params)
+	}
+	if len(recovery) > 0 {
+		printRecoveryShares(recovery, c.Bool("recovery-qr"))
+	}
+	return nil
 }
 
 func readPassword() ([]byte, error) {
-	fd := int(syscall.Stdin)
+	fd := int(os.Stdin.Fd()) // A console handle on Windows
 	if !term.IsTerminal(fd) {
 		// Fallback for non-interactive
-		var password string
-		fmt.Scanln(&password)
-		return []byte(password), nil
+		return readLine(os.Stdin)
 	}
 	return term.ReadPassword(fd)
 }
 
-func cmdStatus(args []string) {
-	home, _ := os.UserHomeDir()
-	dataDir := filepath.Join(home, ".acorde")
-
-	for i, arg := range args {
-		if arg == "--data" && i+1 < len(args) {
-			dataDir = args[i+1]
+// readLine reads one line, without its \n or \r\n, a byte at a time so
+// the rest of r is left for later reads (e.g. content piped after the
+// password)
+func readLine(r io.Reader) ([]byte, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		n, err := r.Read(b)
+		if n > 0 {
+			if b[0] == '\n' {
+				break
+			}
+			line = append(line, b[0])
+		}
+		if err == io.EOF {
 			break
 		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return bytes.TrimSuffix(line, []byte("\r")), nil
+}
+
+func cmdStatus(c *cli.Context) error {
+	dataDir, err := resolveDataDir(c)
+	if err != nil {
+		return err
 	}
 
 	cfg := engine.Config{DataDir: dataDir}
@@ -680,18 +2247,18 @@ func cmdStatus(args []string) {
 	// Try to unlock if encrypted
 	store := crypto.NewFileKeyStore(dataDir)
 	if store.IsInitialized() {
-		fmt.Print("🔒 Vault is encrypted. Enter password: ")
+		fmt.Fprint(os.Stderr, "🔒 Vault is encrypted. Enter password: ")
 		password, err := readPassword()
 		if err != nil {
 			log.Fatal(err)
 		}
-		fmt.Println()
+		fmt.Fprintln(os.Stderr)
 
 		key, err := store.Unlock(password)
 		if err != nil {
 			log.Fatalf("Failed to unlock: %v", err)
 		}
-		cfg.EncryptionKey = &key
+		cfg.EncryptionKey, cfg.KeyEpoch = &key, store.Epoch()
 	}
 
 	e, err := engine.New(cfg)
@@ -700,45 +2267,59 @@ func cmdStatus(args []string) {
 	}
 	defer e.Close()
 
-	entries, _ := e.ListEntries(engine.ListFilter{})
+	count, _ := e.Count(engine.ListFilter{})
+
+	if c.Bool("json") {
+		status := statusJSON{DataDir: dataDir, Encrypted: store.IsInitialized(), Entries: count}
+		if status.Encrypted {
+			status.KeyProtection = store.Protection()
+		}
+		return printJSON(status)
+	}
 
 	fmt.Println("📊 Vault Status")
 	fmt.Println("───────────────")
 	fmt.Printf("  Data Dir:    %s\n", dataDir)
 	fmt.Printf("  Encrypted:   %v\n", store.IsInitialized())
-	fmt.Printf("  Entries:     %d\n", len(entries))
+	if store.IsInitialized() {
+		fmt.Printf("  Key:         %s\n", store.Protection())
+	}
+	fmt.Printf("  Entries:     %d\n", count)
+	return nil
 }
 
-func cmdExport(args []string) {
-	home, _ := os.UserHomeDir()
-	dataDir := filepath.Join(home, ".acorde")
-	outputFile := "acorde-export.json"
-
-	for i, arg := range args {
-		if arg == "--data" && i+1 < len(args) {
-			dataDir = args[i+1]
-		}
-		if arg == "--file" && i+1 < len(args) {
-			outputFile = args[i+1]
-		}
+func cmdExport(c *cli.Context) error {
+	dataDir, err := resolveDataDir(c)
+	if err != nil {
+		return err
+	}
+	outputFile := c.String("file")
+	raw := c.Bool("raw")
+	format := c.String("format")
+	if format != "json" && format != "html" {
+		return cli.Usagef("invalid --format %q (use json or html)", format)
+	}
+	filter, err := filterFlags(c)
+	if err != nil {
+		return err
 	}
 
 	cfg := engine.Config{DataDir: dataDir}
 	
 	store := crypto.NewFileKeyStore(dataDir)
 	if store.IsInitialized() {
-		fmt.Print("🔒 Vault is encrypted. Enter password: ")
+		fmt.Fprint(os.Stderr, "🔒 Vault is encrypted. Enter password: ")
 		password, err := readPassword()
 		if err != nil {
 			log.Fatal(err)
 		}
-		fmt.Println()
+		fmt.Fprintln(os.Stderr)
 
 		key, err := store.Unlock(password)
 		if err != nil {
 			log.Fatalf("Failed to unlock: %v", err)
 		}
-		cfg.EncryptionKey = &key
+		cfg.EncryptionKey, cfg.KeyEpoch = &key, store.Epoch()
 	}
 
 	e, err := engine.New(cfg)
@@ -747,27 +2328,44 @@ func cmdExport(args []string) {
 	}
 	defer e.Close()
 
-	entries, _ := e.ListEntries(engine.ListFilter{})
+	entries, err := engine.ExportEntries(e, filter)
+	if err != nil {
+		return err
+	}
+	if format == "html" {
+		return exportSite(c, entries)
+	}
 
-	// Export as JSON
+	// Export as JSON. Logical clock times are only useful for debugging,
+	// so they are included with --raw.
 	type exportEntry struct {
 		ID        string   `json:"id"`
 		Type      string   `json:"type"`
 		Content   string   `json:"content"`
 		Tags      []string `json:"tags"`
-		CreatedAt uint64   `json:"created_at"`
-		UpdatedAt uint64   `json:"updated_at"`
+		Created   string   `json:"created,omitempty"`
+		Updated   string   `json:"updated,omitempty"`
+		CreatedAt uint64   `json:"created_at,omitempty"`
+		UpdatedAt uint64   `json:"updated_at,omitempty"`
 	}
 
 	export := make([]exportEntry, len(entries))
 	for i, e := range entries {
 		export[i] = exportEntry{
-			ID:        e.ID.String(),
-			Type:      string(e.Type),
-			Content:   string(e.Content),
-			Tags:      e.Tags,
-			CreatedAt: e.CreatedAt,
-			UpdatedAt: e.UpdatedAt,
+			ID:      e.ID,
+			Type:    e.Type,
+			Content: e.Content,
+			Tags:    e.Tags,
+		}
+		if !e.Created.IsZero() {
+			export[i].Created = formatTime(e.Created)
+		}
+		if !e.Updated.IsZero() {
+			export[i].Updated = formatTime(e.Updated)
+		}
+		if raw {
+			export[i].CreatedAt = e.CreatedAt
+			export[i].UpdatedAt = e.UpdatedAt
 		}
 	}
 
@@ -776,40 +2374,29 @@ func cmdExport(args []string) {
 		log.Fatalf("Failed to write export: %v", err)
 	}
 
+	if c.Bool("json") {
+		return printJSON(exportJSON{File: outputFile, Entries: len(entries)})
+	}
 	fmt.Printf("✅ Exported %d entries to %s\n", len(entries), outputFile)
+	return nil
 }
 
-func cmdServe(args []string) {
-	home, _ := os.UserHomeDir()
-	dataDir := filepath.Join(home, ".acorde")
-	port := "7331"
-
-	for i, arg := range args {
-		if arg == "--data" && i+1 < len(args) {
-			dataDir = args[i+1]
-		}
-		if arg == "--port" && i+1 < len(args) {
-			port = args[i+1]
-		}
+func cmdServe(c *cli.Context) error {
+	dataDir, err := resolveDataDir(c)
+	if err != nil {
+		return err
+	}
+	port := strconv.Itoa(c.Int("port"))
+	tokens, err := namespaceTokens(c)
+	if err != nil {
+		return err
 	}
 
-	cfg := engine.Config{DataDir: dataDir}
-	
-	store := crypto.NewFileKeyStore(dataDir)
-	if store.IsInitialized() {
-		fmt.Print("🔒 Vault is encrypted. Enter password: ")
-		password, err := readPassword()
-		if err != nil {
-			log.Fatal(err)
-		}
-		fmt.Println()
-
-		key, err := store.Unlock(password)
-		if err != nil {
-			log.Fatalf("Failed to unlock: %v", err)
-		}
-		cfg.EncryptionKey = &key
+	cfg, err := unlockConfig(dataDir)
+	if err != nil {
+		return err
 	}
+	cfg.LazyLoad = c.Bool("lazy")
 
 	e, err := engine.New(cfg)
 	if err != nil {
@@ -819,6 +2406,15 @@ func cmdServe(args []string) {
 
 	// Import api package
 	apiServer := api.New(e, nil)
+	if blobs, err := engine.NewBlobStore(dataDir); err == nil {
+		apiServer.SetBlobStore(blobs)
+		apiServer.SetBlobRateLimit(c.Int("blob-rate"))
+	}
+	apiServer.SetAuthToken(c.String("api-token"))
+	for token, namespace := range tokens {
+		apiServer.SetNamespaceToken(token, namespace)
+	}
+	apiServer.AddReadinessCheck(vaultCheck(dataDir, cfg))
 
 	fmt.Printf("🚀 Starting API server on http://localhost:%s\n", port)
 	fmt.Printf("   GET    /entries\n")
@@ -826,12 +2422,171 @@ func cmdServe(args []string) {
 	fmt.Printf("   GET    /entries/:id\n")
 	fmt.Printf("   PUT    /entries/:id\n")
 	fmt.Printf("   DELETE /entries/:id\n")
+	fmt.Printf("   GET    /entries/:id/blob, /entries/:id/thumbnail\n")
 	fmt.Printf("   GET    /status\n")
 	fmt.Printf("   GET    /events (SSE)\n")
+	fmt.Printf("   GET    /healthz, /readyz (no token needed)\n")
+
+	fmt.Printf("   (API only - use 'acorde daemon --api-port %s' to sync in the same process)\n", port)
 
 	if err := apiServer.ListenAndServe(":" + port); err != nil {
 		log.Fatalf("Server error: %v", err)
 	}
+	return nil
+}
+
+// resolveDataDir returns the data directory given by --data (default
+// ~/.acorde), or with --vault the directory of that named vault in it
+func resolveDataDir(c *cli.Context) (string, error) {
+	return vaultDataDir(c, c.String("vault"))
+}
+
+// vaultDataDir returns the directory of the named vault in the --data
+// directory, or the --data directory itself for ""
+func vaultDataDir(c *cli.Context, name string) (string, error) {
+	dataDir := expandHome(c.String("data"))
+	if dataDir == "" {
+		var err error
+		if dataDir, err = engine.DefaultDataDir(); err != nil {
+			return "", err
+		}
+	}
+
+	if name == "" {
+		return dataDir, nil
+	}
+	vaults, err := engine.NewVaultManager(dataDir)
+	if err != nil {
+		return "", err
+	}
+	v, err := vaults.Get(name)
+	if err != nil {
+		return "", err
+	}
+	return v.DataDir, nil
+}
+
+// unlockConfig builds an engine config for dataDir, prompting for the
+// vault password if the vault is encrypted.
+func unlockConfig(dataDir string) (engine.Config, error) {
+	cfg, _, err := unlockVault(dataDir)
+	return cfg, err
+}
+
+// unlockVault is unlockConfig that also returns the password (nil if the
+// vault is not encrypted)
+func unlockVault(dataDir string) (engine.Config, []byte, error) {
+	cfg, password, _, err := unlockKeyring(dataDir)
+	return cfg, password, err
+}
+
+// unlockKeyring is unlockVault that also returns the vault's keys, oldest
+// epoch first (see crypto.FileKeyStore.Keyring). Key grants received from
+// other devices since the last unlock are applied: the keystore is
+// updated to the rotated key, keeping the old one. Keys of earlier epochs
+// are passed as retired keys.
+func unlockKeyring(dataDir string) (engine.Config, []byte, []crypto.EpochKey, error) {
+	cfg := engine.Config{DataDir: dataDir, PeerKeys: allowlistPeerKeys(dataDir)}
+	cfg.IDs = engine.IDKind(os.Getenv("ACORDE_IDS")) // New entry IDs: uuid4, uuid7 or ulid
+
+	store := crypto.NewFileKeyStore(dataDir)
+	if !store.IsInitialized() {
+		return cfg, nil, nil, nil
+	}
+
+	fmt.Fprint(os.Stderr, "🔒 Vault is encrypted. Enter password: ")
+	password, err := readPassword()
+	if err != nil {
+		return cfg, nil, nil, err
+	}
+	fmt.Fprintln(os.Stderr)
+
+	keys, err := store.Keyring(password)
+	if err != nil {
+		return cfg, nil, nil, fmt.Errorf("failed to unlock: %w", err)
+	}
+	rotated, err := applyKeyGrants(store, password, dataDir, keys[len(keys)-1].Key)
+	if err != nil {
+		return cfg, nil, nil, fmt.Errorf("failed to apply rotated vault key: %w", err)
+	}
+	if rotated {
+		if keys, err = store.Keyring(password); err != nil {
+			return cfg, nil, nil, fmt.Errorf("failed to unlock: %w", err)
+		}
+	}
+
+	current := keys[len(keys)-1]
+	cfg.EncryptionKey, cfg.KeyEpoch = &current.Key, current.Epoch
+	cfg.RetiredKeys = keys[:len(keys)-1]
+	return cfg, password, keys, nil
+}
+
+// applyKeyGrants switches the keystore to the newest key received from a
+// still-trusted device, one epoch per key. Reports whether it did.
+func applyKeyGrants(store *crypto.FileKeyStore, password []byte, dataDir string, current crypto.Key) (bool, error) {
+	grants := sync.NewGrantStore(dataDir)
+	incoming, err := grants.Incoming()
+	if err != nil || len(incoming) == 0 {
+		return false, err
+	}
+
+	allowlist, err := sync.NewAllowlist(dataDir, false)
+	if err != nil {
+		return false, err
+	}
+	device, err := loadDeviceKey(dataDir)
+	if err != nil {
+		return false, err
+	}
+
+	rotated := false
+	for _, grant := range incoming {
+		from, err := peer.Decode(grant.Peer)
+		if err != nil || !allowlist.IsAllowed(from) {
+			continue
+		}
+		if p, ok := allowlist.Get(from); !ok || string(p.DeviceKey) != string(grant.SenderKey) {
+			continue
+		}
+		key, err := grant.Open(device)
+		if err != nil || key.Key == current {
+			continue
+		}
+		if err := store.AdoptKey(password, key); err != nil {
+			return rotated, err
+		}
+		current, rotated = key.Key, true
+		fmt.Fprintf(os.Stderr, "🔑 Applying vault key rotated by %s\n", from.String()[:8])
+	}
+	return rotated, grants.ClearIncoming()
+}
+
+// allowlistPeerKeys resolves peers' device keys recorded at pairing
+func allowlistPeerKeys(dataDir string) func(string) ([]byte, error) {
+	return func(peerID string) ([]byte, error) {
+		id, err := peer.Decode(peerID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid peer ID: %w", err)
+		}
+		allowlist, err := sync.NewAllowlist(dataDir, false)
+		if err != nil {
+			return nil, err
+		}
+		p, ok := allowlist.Get(id)
+		if !ok || len(p.DeviceKey) == 0 {
+			return nil, fmt.Errorf("not paired (or paired without a device key)")
+		}
+		return p.DeviceKey, nil
+	}
+}
+
+// loadDeviceKey loads this device's X25519 key for key grants
+func loadDeviceKey(dataDir string) (*sharing.KeyPair, error) {
+	kp, err := sharing.LoadOrCreateKeyPair(filepath.Join(dataDir, "device.key"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load device key: %w", err)
+	}
+	return kp, nil
 }
 
 // loadOrGenerateKey loads the private key from disk or generates a new one.
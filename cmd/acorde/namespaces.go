@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/amaydixit11/acorde/internal/cli"
+	"github.com/amaydixit11/acorde/pkg/engine"
+)
+
+// addNamespaceTokensFlag registers --namespace-tokens, the bearer tokens
+// limiting REST API requests to a namespace
+func addNamespaceTokensFlag(fs *flag.FlagSet) {
+	fs.String("namespace-tokens", "", "Comma-separated namespace=token pairs: requests with the token only reach the namespace's entries")
+}
+
+// namespaceArg is the namespace named on the command line, where
+// "default" is the default namespace
+func namespaceArg(name string) string {
+	if name == "default" {
+		return ""
+	}
+	return name
+}
+
+// namespaceTokens parses --namespace-tokens into the namespaces of tokens
+func namespaceTokens(c *cli.Context) (map[string]string, error) {
+	tokens := make(map[string]string)
+	pairs := c.String("namespace-tokens")
+	if pairs == "" {
+		return tokens, nil
+	}
+	for _, pair := range strings.Split(pairs, ",") {
+		namespace, token, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || token == "" {
+			return nil, cli.Usagef("invalid --namespace-tokens pair %q (use namespace=token)", pair)
+		}
+		namespace = namespaceArg(namespace)
+		if err := engine.ValidateNamespace(namespace); err != nil {
+			return nil, cli.Usagef("--namespace-tokens: %v", err)
+		}
+		if token == c.String("api-token") {
+			return nil, cli.Usagef("--namespace-tokens: the token of %q is the --api-token", namespace)
+		}
+		tokens[token] = namespace
+	}
+	return tokens, nil
+}
+
+// syncNamespaces parses the daemon's --namespaces: nil (all) unless set
+func syncNamespaces(c *cli.Context) ([]string, error) {
+	if !c.IsSet("namespaces") {
+		return nil, nil
+	}
+	namespaces := []string{}
+	for _, namespace := range strings.Split(c.String("namespaces"), ",") {
+		namespace = namespaceArg(strings.TrimSpace(namespace))
+		if err := engine.ValidateNamespace(namespace); err != nil {
+			return nil, cli.Usagef("--namespaces: %v", err)
+		}
+		namespaces = append(namespaces, namespace)
+	}
+	return namespaces, nil
+}
+
+func cmdNamespaces(c *cli.Context, e engine.Engine) error {
+	counts, err := e.Namespaces()
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if c.Bool("json") {
+		out := make([]namespaceJSON, len(names))
+		for i, name := range names {
+			out[i] = namespaceJSON{Namespace: name, Entries: counts[name]}
+		}
+		return printJSON(out)
+	}
+	if len(names) == 0 {
+		fmt.Println("No entries found.")
+		return nil
+	}
+	for _, name := range names {
+		label := name
+		if label == "" {
+			label = "(default)"
+		}
+		fmt.Printf("%-24s %d\n", label, counts[name])
+	}
+	return nil
+}
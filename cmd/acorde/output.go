@@ -0,0 +1,415 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/amaydixit11/acorde/internal/cli"
+	"github.com/amaydixit11/acorde/pkg/crypto"
+	"github.com/amaydixit11/acorde/pkg/engine"
+	"github.com/google/uuid"
+)
+
+// With --json, each command prints exactly one JSON value to stdout, using
+// the types below. Their field names are a stable interface for scripts:
+// add fields, never rename or remove them. Progress messages go to stderr.
+
+// entryJSON is an entry. Content is text; times are RFC3339 and omitted
+// when unknown.
+type entryJSON struct {
+	ID         string   `json:"id"`
+	Type       string   `json:"type"`
+	Title      string   `json:"title,omitempty"`
+	Namespace  string   `json:"namespace,omitempty"`
+	Content    string   `json:"content"`
+	Tags       []string `json:"tags"`
+	Owner      string   `json:"owner,omitempty"`
+	Archived   bool     `json:"archived,omitempty"`
+	Collection string   `json:"collection,omitempty"` // Path of the collection the entry is filed in
+	Created    string   `json:"created,omitempty"`
+	Updated    string   `json:"updated,omitempty"`
+	CreatedAt  uint64   `json:"created_at"` // Logical clock
+	UpdatedAt  uint64   `json:"updated_at"` // Logical clock
+}
+
+func toEntryJSON(e engine.Entry) entryJSON {
+	out := entryJSON{
+		ID:        e.ID.String(),
+		Type:      string(e.Type),
+		Title:     e.Title,
+		Namespace: e.Namespace,
+		Content:   string(e.Content),
+		Tags:      e.Tags,
+		Owner:     e.Owner,
+		Archived:  e.Archived,
+		CreatedAt: e.CreatedAt,
+		UpdatedAt: e.UpdatedAt,
+	}
+	if out.Tags == nil {
+		out.Tags = []string{}
+	}
+	if !e.CreatedTime.IsZero() {
+		out.Created = formatTime(e.CreatedTime)
+	}
+	if !e.UpdatedTime.IsZero() {
+		out.Updated = formatTime(e.UpdatedTime)
+	}
+	return out
+}
+
+// masked hides the secrets of a credential entry unless the command was
+// given --reveal
+func masked(c *cli.Context, entry engine.Entry) engine.Entry {
+	if entry.Type != engine.Credential || c.Flags.Lookup("reveal") != nil && c.Bool("reveal") {
+		return entry
+	}
+	entry.Content = engine.MaskCredential(entry.Content)
+	return entry
+}
+
+// countJSON is the result of list --count
+type countJSON struct {
+	Count int `json:"count"`
+}
+
+// namespaceJSON is an element of the result of namespaces
+type namespaceJSON struct {
+	Namespace string `json:"namespace"` // "" = the default namespace
+	Entries   int    `json:"entries"`
+}
+
+// deletedJSON is the result of delete: one object for one ID, an array
+// for several or for --query
+type deletedJSON struct {
+	ID      string `json:"id"`
+	Deleted bool   `json:"deleted"`
+	DryRun  bool   `json:"dry_run,omitempty"`
+}
+
+// archivedJSON is the result of archive and unarchive: one object for one
+// ID, an array for several
+type archivedJSON struct {
+	ID       string `json:"id"`
+	Archived bool   `json:"archived"`
+}
+
+// transferredJSON is an entry copied or moved by cp or mv
+type transferredJSON struct {
+	ID    string `json:"id"`
+	To    string `json:"to"` // Destination data directory
+	Moved bool   `json:"moved"`
+}
+
+// taggedJSON is an entry changed by tag, with its new tags
+type taggedJSON struct {
+	ID     string   `json:"id"`
+	Tags   []string `json:"tags"`
+	DryRun bool     `json:"dry_run,omitempty"`
+}
+
+// sharedJSON is the result of share
+type sharedJSON struct {
+	ID         string   `json:"id"`
+	SharedWith []string `json:"shared_with"`
+}
+
+// groupJSON is an ACL group
+type groupJSON struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Members []string `json:"members"`
+}
+
+func toGroupJSON(g engine.Group) groupJSON {
+	members := g.Members
+	if members == nil {
+		members = []string{}
+	}
+	return groupJSON{ID: g.ID.String(), Name: g.Name, Members: members}
+}
+
+// deletedGroupJSON is the result of groups delete
+type deletedGroupJSON struct {
+	Name    string `json:"name"`
+	Deleted bool   `json:"deleted"`
+}
+
+// groupGrantJSON is the result of groups grant and revoke
+type groupGrantJSON struct {
+	ID     string `json:"id"`
+	Group  string `json:"group"`
+	Access string `json:"access"` // read, write or none
+}
+
+// collectionJSON is a collection
+type collectionJSON struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Parent string `json:"parent,omitempty"` // ID; none at the top level
+	Path   string `json:"path"`
+}
+
+func toCollectionJSON(c engine.Collection) collectionJSON {
+	out := collectionJSON{ID: c.ID.String(), Name: c.Name, Path: c.Path}
+	if c.Parent != uuid.Nil {
+		out.Parent = c.Parent.String()
+	}
+	return out
+}
+
+// filedJSON is one entry filed by collections add
+type filedJSON struct {
+	ID         string `json:"id"`
+	Collection string `json:"collection"` // Path, "/" for none
+}
+
+// deletedCollectionJSON is the result of collections delete
+type deletedCollectionJSON struct {
+	Path    string `json:"path"`
+	Deleted bool   `json:"deleted"`
+}
+
+// templateJSON is an entry template
+type templateJSON struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Type      string   `json:"type"`
+	Content   string   `json:"content"`
+	Tags      []string `json:"tags"`
+	Variables []string `json:"variables"`
+}
+
+func toTemplateJSON(t engine.Template) templateJSON {
+	out := templateJSON{
+		ID:        t.ID.String(),
+		Name:      t.Name,
+		Type:      t.Type,
+		Content:   t.Content,
+		Tags:      t.Tags,
+		Variables: t.Variables(),
+	}
+	if out.Tags == nil {
+		out.Tags = []string{}
+	}
+	if out.Variables == nil {
+		out.Variables = []string{}
+	}
+	return out
+}
+
+// deletedTemplateJSON is the result of templates rm
+type deletedTemplateJSON struct {
+	Name    string `json:"name"`
+	Deleted bool   `json:"deleted"`
+}
+
+// schemaJSON is an entry type's schema saved in the vault
+type schemaJSON struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Definition json.RawMessage `json:"definition"`
+}
+
+func toSchemaJSON(s engine.StoredSchema) schemaJSON {
+	return schemaJSON{ID: s.ID.String(), Type: s.Type, Definition: s.Definition}
+}
+
+// deletedSchemaJSON is the result of schema rm
+type deletedSchemaJSON struct {
+	Type    string `json:"type"`
+	Deleted bool   `json:"deleted"`
+}
+
+// ruleJSON is an auto-tagging rule
+type ruleJSON struct {
+	ID      string                 `json:"id"`
+	Name    string                 `json:"name,omitempty"`
+	Type    string                 `json:"type,omitempty"`
+	Tag     string                 `json:"tag,omitempty"`
+	Pattern string                 `json:"pattern,omitempty"`
+	Field   string                 `json:"field,omitempty"`
+	AddTags []string               `json:"add_tags"`
+	Set     map[string]interface{} `json:"set,omitempty"`
+}
+
+func toRuleJSON(r engine.Rule) ruleJSON {
+	out := ruleJSON{
+		ID:      r.ID.String(),
+		Name:    r.Name,
+		Type:    r.Type,
+		Tag:     r.Tag,
+		Pattern: r.Pattern,
+		Field:   r.Field,
+		AddTags: r.AddTags,
+		Set:     r.Set,
+	}
+	if out.AddTags == nil {
+		out.AddTags = []string{}
+	}
+	return out
+}
+
+// copiedJSON is the result of get --copy. The value itself is never
+// printed.
+type copiedJSON struct {
+	ID         string  `json:"id"`
+	Field      string  `json:"field"`
+	ClearAfter float64 `json:"clear_after"` // Seconds (0 = never)
+}
+
+// statsJSON is the result of stats
+type statsJSON struct {
+	Bucket  string                   `json:"bucket"`
+	Agg     string                   `json:"agg"`
+	Field   string                   `json:"field,omitempty"`
+	Buckets []engine.AggregateBucket `json:"buckets"`
+}
+
+// statsOverviewJSON is the result of stats overview
+type statsOverviewJSON struct {
+	engine.VaultStats
+	PeerHealth map[string]int `json:"peer_health,omitempty"` // Peers by health status
+}
+
+// statusJSON is the result of status
+type statusJSON struct {
+	DataDir       string `json:"data_dir"`
+	Encrypted     bool   `json:"encrypted"`
+	KeyProtection string `json:"key_protection,omitempty"`
+	Entries       int    `json:"entries"`
+}
+
+// exportJSON is the result of export
+type exportJSON struct {
+	File    string `json:"file,omitempty"`
+	Dir     string `json:"dir,omitempty"` // With --format html
+	Entries int    `json:"entries"`
+}
+
+// importJSON is the result of import
+type importJSON struct {
+	File   string `json:"file"`
+	DryRun bool   `json:"dry_run,omitempty"`
+	engine.ImportResult
+}
+
+// initJSON is the result of init
+type initJSON struct {
+	DataDir       string `json:"data_dir"`
+	KeyProtection string `json:"key_protection"`
+	Created       bool   `json:"created"` // False if already initialized
+
+	Argon2            *crypto.Argon2Params `json:"argon2,omitempty"`
+	RecoveryShares    []string             `json:"recovery_shares,omitempty"` // Share words
+	RecoveryThreshold int                  `json:"recovery_threshold,omitempty"`
+}
+
+// recoverJSON is the result of recover
+type recoverJSON struct {
+	DataDir       string `json:"data_dir"`
+	KeyProtection string `json:"key_protection"`
+	Shares        int    `json:"shares_used"`
+}
+
+// bundleJSON is a bundle written by bundle export or merged by bundle
+// import
+type bundleJSON struct {
+	Path      string `json:"path"` // Folder or file
+	Peer      string `json:"peer"` // Device that created it
+	Created   string `json:"created"`
+	Since     uint64 `json:"since,omitempty"` // Holds changes after this clock time
+	Clock     uint64 `json:"clock"`
+	Entries   int    `json:"entries"`
+	Encrypted bool   `json:"encrypted"`
+}
+
+// inviteJSON is the result of invite
+type inviteJSON struct {
+	Code      string `json:"code"`
+	FullCode  string `json:"full_code"`
+	ExpiresAt string `json:"expires_at"`
+	PIN       string `json:"pin,omitempty"`
+	OneTime   bool   `json:"one_time"`
+}
+
+// pairJSON is the result of pair
+type pairJSON struct {
+	PeerID           string `json:"peer_id"`
+	VaultKeyReceived bool   `json:"vault_key_received"`
+	TrustedPeers     int    `json:"trusted_peers,omitempty"` // Devices in the invite's trust bundle
+}
+
+// blobstoreJSON is where a vault's blobs are stored, in blobstore show
+type blobstoreJSON struct {
+	Backend     string `json:"backend"` // local or s3
+	Endpoint    string `json:"endpoint,omitempty"`
+	Region      string `json:"region,omitempty"`
+	Bucket      string `json:"bucket,omitempty"`
+	Prefix      string `json:"prefix,omitempty"`
+	CacheBytes  int64  `json:"cache_bytes,omitempty"`
+	Credentials string `json:"credentials,omitempty"` // config or environment
+}
+
+// configJSON is the config file, in config show, set and unset. Secrets
+// are masked.
+type configJSON struct {
+	Path     string            `json:"path"`
+	Settings map[string]string `json:"settings"` // By key, e.g. "daemon.port"
+	Env      map[string]string `json:"env"`      // Environment variables that override settings
+}
+
+// deviceJSON is a trusted device in device list
+type deviceJSON struct {
+	PeerID string `json:"peer_id"`
+	Status string `json:"status"` // ok, key_update_pending or no_device_key
+}
+
+// trustJSON is a trust bundle written by device export or read by device
+// import
+type trustJSON struct {
+	Signer string `json:"signer"`
+	Peers  int    `json:"peers"`           // Devices in the bundle, besides its signer
+	Path   string `json:"path,omitempty"`  // Export only
+	Added  int    `json:"added,omitempty"` // Import only: devices newly trusted
+}
+
+// peerJSON is a peer's sync health in peers list
+type peerJSON struct {
+	PeerID              string `json:"peer_id"`
+	Status              string `json:"status"` // ok, backing_off or quarantined
+	Successes           int64  `json:"successes"`
+	Failures            int64  `json:"failures"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	LastError           string `json:"last_error,omitempty"`
+	LastSuccess         string `json:"last_success,omitempty"`
+	NextAttempt         string `json:"next_attempt,omitempty"`
+}
+
+// revokeJSON is the result of device revoke
+type revokeJSON struct {
+	Revoked    string   `json:"revoked"`
+	KeyRotated bool     `json:"key_rotated"`
+	GrantsSent int      `json:"grants_queued"`
+	NoKey      []string `json:"no_device_key"` // Devices that cannot receive the new key
+}
+
+// printJSON writes v to stdout as indented JSON
+func printJSON(v interface{}) error {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+	return nil
+}
+
+// info is where a command prints human-readable messages: stdout, or
+// stderr with --json so that stdout holds only the JSON result
+func info(c *cli.Context) io.Writer {
+	if c.Bool("json") {
+		return os.Stderr
+	}
+	return os.Stdout
+}
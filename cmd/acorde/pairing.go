@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/amaydixit11/acorde/internal/sync"
+	"github.com/amaydixit11/acorde/pkg/api"
+	"github.com/amaydixit11/acorde/pkg/crypto"
+)
+
+// addAPITokenFlag registers --api-token, the bearer token the REST API
+// requires (and without which it refuses to pair devices)
+func addAPITokenFlag(fs *flag.FlagSet) {
+	fs.String("api-token", "", "Bearer token required by the REST API; enables the /sync pairing endpoints (default $ACORDE_API_TOKEN)")
+}
+
+// registerInvite records a redeemable invite for the daemon to honor,
+// with a new PIN if the invite needs one. Other invites are left alone.
+func registerInvite(dataDir string, invite *sync.PeerInvite, encrypted bool) (string, error) {
+	if !invite.IsRedeemable() {
+		return "", nil
+	}
+	var pin string
+	if invite.PIN {
+		var err error
+		if pin, err = sync.GeneratePIN(); err != nil {
+			return "", fmt.Errorf("failed to generate PIN: %w", err)
+		}
+	}
+	err := sync.NewInviteRegistry(dataDir).Add(sync.PendingInvite{
+		ID:        invite.ID,
+		ExpiresAt: invite.ExpiresAt,
+		OneTime:   invite.OneTime,
+		PIN:       pin,
+		ShareKey:  encrypted && len(invite.Key) == 0,
+	})
+	return pin, err
+}
+
+// storeVaultKey protects a vault key received when pairing with a
+// password, at the inviter's epoch
+func storeVaultKey(dataDir string, vaultKey crypto.EpochKey, password []byte) error {
+	return crypto.NewFileKeyStore(dataDir).InitializeWithEpochKey(password, vaultKey)
+}
+
+// daemonPairing serves the REST pairing endpoints from the daemon's sync
+// service
+type daemonPairing struct {
+	svc       sync.SyncService
+	dataDir   string
+	encrypted bool
+}
+
+func (p *daemonPairing) Invite(req api.InviteRequest) (api.Invite, error) {
+	opts := sync.InviteOptions{Expiry: sync.DefaultInviteExpiry, OneTime: req.OneTime, PIN: req.PIN}
+	if req.Expiry != "" {
+		expiry, err := time.ParseDuration(req.Expiry)
+		if err != nil {
+			return api.Invite{}, err
+		}
+		opts.Expiry = expiry
+	}
+	qrLevel, err := sync.ParseQRLevel(req.QRLevel)
+	if err != nil {
+		return api.Invite{}, err
+	}
+	qrSize := req.QRSize
+	if qrSize == 0 {
+		qrSize = sync.QRSize
+	}
+
+	// The key of an encrypted vault is only handed out through the pairing
+	// protocol, never embedded in a code sent over HTTP
+	if p.encrypted && !opts.OneTime && !opts.PIN {
+		return api.Invite{}, errors.New("encrypted vaults need a one-time or PIN invite")
+	}
+
+	invite, err := sync.CreateInviteWithOptions(p.svc.GetHost(), opts)
+	if err != nil {
+		return api.Invite{}, fmt.Errorf("failed to create invite: %w", err)
+	}
+	pin, err := registerInvite(p.dataDir, invite, p.encrypted)
+	if err != nil {
+		return api.Invite{}, fmt.Errorf("failed to register invite: %w", err)
+	}
+	fullCode, err := invite.Encode()
+	if err != nil {
+		return api.Invite{}, err
+	}
+	qr, err := invite.ToQRWith(qrLevel, qrSize)
+	if err != nil {
+		return api.Invite{}, fmt.Errorf("failed to render QR code: %w", err)
+	}
+	return api.Invite{
+		Code:      invite.ToMinimalCode(),
+		FullCode:  fullCode,
+		ExpiresAt: time.Unix(invite.ExpiresAt, 0),
+		PIN:       pin,
+		OneTime:   invite.IsRedeemable() && invite.OneTime,
+		QR:        qr,
+	}, nil
+}
+
+func (p *daemonPairing) Pair(ctx context.Context, req api.PairRequest) (api.PairResult, error) {
+	invite, err := sync.ParseInvite(req.Code)
+	if err != nil {
+		return api.PairResult{}, fmt.Errorf("invalid invite: %w", err)
+	}
+	vaultKey, err := p.svc.Pair(ctx, invite, req.PIN)
+	if err != nil {
+		return api.PairResult{}, fmt.Errorf("failed to pair: %w", err)
+	}
+
+	result := api.PairResult{PeerID: invite.PeerID, VaultKeyReceived: vaultKey != nil}
+	if result.VaultKeyReceived && !crypto.NewFileKeyStore(p.dataDir).IsInitialized() {
+		if req.Password == "" {
+			return result, errors.New("paired, but the vault key was dropped: no password was given to protect it")
+		}
+		if err := storeVaultKey(p.dataDir, *vaultKey, []byte(req.Password)); err != nil {
+			return result, fmt.Errorf("paired, but failed to store the vault key: %w", err)
+		}
+		result.VaultKeyStored = true
+	}
+	return result, nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/amaydixit11/acorde/internal/cli"
+	"github.com/amaydixit11/acorde/pkg/crypto"
+	"golang.org/x/term"
+)
+
+// addPasswordFlags registers the password policy and Argon2id flags of
+// commands that set a new password
+func addPasswordFlags(fs *flag.FlagSet) {
+	fs.Int("min-entropy", crypto.MinPasswordEntropy, "Refuse passwords estimated below this many bits (0 = any)")
+	fs.Int("argon2-memory", int(crypto.DefaultArgon2Params.Memory/1024), "Argon2id memory in MiB")
+	fs.Int("argon2-threads", int(crypto.DefaultArgon2Params.Parallelism), "Argon2id parallelism")
+	fs.Int("argon2-time", 0, "Argon2id passes (0 = benchmark to --argon2-target)")
+	fs.Duration("argon2-target", 500*time.Millisecond, "Time to unlock the vault on this machine, when benchmarking")
+}
+
+// readNewPassword asks for a new password twice and checks it against
+// --min-entropy. On a terminal a weak or mismatched password is asked for
+// again.
+func readNewPassword(c *cli.Context, prompt string) ([]byte, error) {
+	interactive := term.IsTerminal(int(os.Stdin.Fd()))
+	for {
+		fmt.Fprint(os.Stderr, prompt)
+		pass1, err := readPassword()
+		if err != nil {
+			return nil, fmt.Errorf("error reading password: %w", err)
+		}
+		fmt.Fprint(os.Stderr, "\nConfirm password: ")
+		pass2, err := readPassword()
+		if err != nil {
+			return nil, fmt.Errorf("error reading password: %w", err)
+		}
+		fmt.Fprintln(os.Stderr)
+
+		if string(pass1) != string(pass2) {
+			err = fmt.Errorf("passwords do not match")
+		} else {
+			var strength crypto.PasswordStrength
+			strength, err = crypto.CheckPassword(pass1, float64(c.Int("min-entropy")))
+			if err == nil {
+				fmt.Fprintf(os.Stderr, "Password strength: %s (about %.0f bits)\n", strengthLabels[strength.Score], strength.Entropy)
+				return pass1, nil
+			}
+			for _, s := range strength.Suggestions {
+				fmt.Fprintf(os.Stderr, "  Tip: %s\n", s)
+			}
+		}
+		if !interactive {
+			return nil, err
+		}
+		fmt.Fprintf(os.Stderr, "%v; try again.\n", err)
+	}
+}
+
+// strengthLabels name PasswordStrength scores
+var strengthLabels = [...]string{"very weak", "weak", "fair", "strong", "very strong"}
+
+// configureArgon2 sets the store's Argon2id parameters from the flags. With
+// tune, or any Argon2 flag given, it benchmarks unless --argon2-time is
+// set; otherwise the store keeps its defaults.
+func configureArgon2(c *cli.Context, store *crypto.FileKeyStore, tune bool) error {
+	set := c.IsSet("argon2-memory") || c.IsSet("argon2-threads") || c.IsSet("argon2-time") || c.IsSet("argon2-target")
+	if !tune && !set {
+		return nil
+	}
+
+	memory, threads := c.Int("argon2-memory"), c.Int("argon2-threads")
+	if memory < 1 || memory > 4*1024*1024 || threads < 1 || threads > 255 {
+		return cli.Usagef("--argon2-memory must be 1 to 4194304 MiB and --argon2-threads 1 to 255")
+	}
+	params := crypto.Argon2Params{
+		Memory:      uint32(memory) * 1024,
+		Iterations:  uint32(max(c.Int("argon2-time"), 0)),
+		Parallelism: uint8(threads),
+	}
+	if params.Iterations == 0 {
+		fmt.Fprintf(info(c), "Tuning Argon2id for %v...\n", c.Duration("argon2-target"))
+		params = crypto.BenchmarkArgon2(c.Duration("argon2-target"), params.Memory, params.Parallelism)
+	}
+	if err := store.SetArgon2Params(params); err != nil {
+		return cli.Usagef("%v", err)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/amaydixit11/acorde/internal/cli"
+	"github.com/amaydixit11/acorde/internal/sync"
+)
+
+func cmdPeersList(c *cli.Context) error {
+	dir, err := resolveDataDir(c)
+	if err != nil {
+		return err
+	}
+	health, err := sync.LoadPeerHealth(dir)
+	if err != nil {
+		return fmt.Errorf("failed to load peer health: %w", err)
+	}
+
+	peers := make([]peerJSON, len(health))
+	for i, h := range health {
+		peers[i] = peerJSON{
+			PeerID:              h.PeerID,
+			Status:              h.Status,
+			Successes:           h.Successes,
+			Failures:            h.Failures,
+			ConsecutiveFailures: h.ConsecutiveFailures,
+			LastError:           h.LastError,
+		}
+		if !h.LastSuccess.IsZero() {
+			peers[i].LastSuccess = formatTime(h.LastSuccess)
+		}
+		if !h.NextAttempt.IsZero() {
+			peers[i].NextAttempt = formatTime(h.NextAttempt)
+		}
+	}
+
+	if c.Bool("json") {
+		return printJSON(peers)
+	}
+	if len(peers) == 0 {
+		fmt.Println("No peers synced with yet (peer health is recorded by 'acorde daemon').")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PEER\tSTATUS\tOK\tFAILED\tRETRY\tLAST ERROR")
+	for i, p := range peers {
+		status, retry := p.Status, "-"
+		switch p.Status {
+		case sync.PeerBackingOff:
+			status = fmt.Sprintf("backing off (%d failures)", p.ConsecutiveFailures)
+		case sync.PeerQuarantined:
+			status = "quarantined"
+		}
+		if next := health[i].NextAttempt; !next.IsZero() {
+			retry = "in " + time.Until(next).Round(time.Second).String()
+			if time.Until(next) <= 0 {
+				retry = "now"
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\t%s\n", p.PeerID, status, p.Successes, p.Failures, retry, p.LastError)
+	}
+	return w.Flush()
+}
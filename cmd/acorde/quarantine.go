@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/amaydixit11/acorde/internal/cli"
+	"github.com/amaydixit11/acorde/pkg/engine"
+)
+
+func cmdQuarantineList(c *cli.Context, e engine.Engine) error {
+	list, err := e.Quarantined()
+	if err != nil {
+		return err
+	}
+	if c.Bool("json") {
+		if list == nil {
+			list = []engine.QuarantinedEntry{}
+		}
+		return printJSON(list)
+	}
+	if len(list) == 0 {
+		fmt.Println("No quarantined changes.")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ENTRY\tTYPE\tTIMES\tLAST SEEN\tREASON")
+	for _, q := range list {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", q.EntryID, q.EntryType, q.Rejections, formatTime(q.LastSeen), q.Reason)
+	}
+	return w.Flush()
+}
+
+func cmdQuarantineClear(c *cli.Context, e engine.Engine) error {
+	if err := e.ClearQuarantine(); err != nil {
+		return err
+	}
+	fmt.Fprintln(info(c), "✅ Quarantine cleared")
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/amaydixit11/acorde/internal/cli"
+	"github.com/amaydixit11/acorde/pkg/crypto"
+	"github.com/skip2/go-qrcode"
+	"golang.org/x/term"
+)
+
+// printRecoveryShares prints recovery shares as words, and as terminal QR
+// codes if asked
+func printRecoveryShares(shares []crypto.Share, qr bool) {
+	fmt.Printf("\n🔑 Recovery shares: any %d of these %d restore access with 'acorde recover'.\n", shares[0].Threshold, len(shares))
+	fmt.Println("   Write them down and keep them in separate places. They are not shown again.")
+	for _, share := range shares {
+		fmt.Printf("\nShare %d:\n  %s\n", share.Index, share.Words())
+		if qr {
+			if code, err := qrcode.New(share.Words(), qrcode.Medium); err == nil {
+				fmt.Println(code.ToSmallString(false))
+			}
+		}
+	}
+}
+
+func cmdRecover(c *cli.Context) error {
+	dir, err := resolveDataDir(c)
+	if err != nil {
+		return err
+	}
+	store := crypto.NewFileKeyStore(dir)
+	if err := configureArgon2(c, store, !store.IsInitialized()); err != nil {
+		return err
+	}
+	if store.IsInitialized() {
+		if _, threshold := store.Recovery(); threshold == 0 {
+			return errors.New("no recovery shares were made for this vault")
+		}
+	}
+
+	shares, err := readShares()
+	if err != nil {
+		return err
+	}
+
+	pass1, err := readNewPassword(c, "Enter new password: ")
+	if err != nil {
+		return err
+	}
+
+	if _, err := store.Recover(shares, pass1); err != nil {
+		return fmt.Errorf("failed to recover: %w", err)
+	}
+
+	if c.Bool("json") {
+		return printJSON(recoverJSON{DataDir: dir, KeyProtection: store.Protection(), Shares: len(shares)})
+	}
+	fmt.Printf("✅ Vault key recovered; new password set (key protection: %s)\n", store.Protection())
+	return nil
+}
+
+// readShares reads recovery shares from stdin, one per line, until the
+// threshold named in them is reached. On a terminal a mistyped share is
+// asked for again.
+func readShares() ([]crypto.Share, error) {
+	interactive := term.IsTerminal(int(os.Stdin.Fd()))
+	var shares []crypto.Share
+	for len(shares) == 0 || len(shares) < shares[0].Threshold {
+		fmt.Fprintf(os.Stderr, "Share %d: ", len(shares)+1)
+		line, err := readLine(os.Stdin)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 {
+			return nil, fmt.Errorf("not enough recovery shares")
+		}
+		share, err := crypto.ParseShare(string(line))
+		if err != nil {
+			if interactive {
+				fmt.Fprintf(os.Stderr, "  %v; try again.\n", err)
+				continue
+			}
+			return nil, err
+		}
+		shares = append(shares, share)
+	}
+	if !interactive {
+		fmt.Fprintln(os.Stderr)
+	}
+	return shares, nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/amaydixit11/acorde/internal/cli"
+	"github.com/amaydixit11/acorde/pkg/engine"
+)
+
+func cmdRulesAdd(c *cli.Context, e engine.Engine) error {
+	rule := engine.Rule{
+		Name:    c.String("name"),
+		Type:    c.String("type"),
+		Tag:     c.String("tag"),
+		Pattern: c.String("pattern"),
+		Field:   c.String("field"),
+		AddTags: splitTags(c.String("add-tags")),
+	}
+	if set := c.String("set"); set != "" {
+		rule.Set = make(map[string]interface{})
+		for _, pair := range strings.Split(set, ",") {
+			field, value, ok := strings.Cut(pair, "=")
+			if field = strings.TrimSpace(field); !ok || field == "" {
+				return cli.Usagef("invalid --set %q: expected field=value", pair)
+			}
+			rule.Set[field] = strings.TrimSpace(value)
+		}
+	}
+
+	rule, err := e.AddRule(rule)
+	if err != nil {
+		return err
+	}
+	if c.Bool("json") {
+		return printJSON(toRuleJSON(rule))
+	}
+	fmt.Printf("Added rule %s\n", rule.ID)
+	return nil
+}
+
+func cmdRulesList(c *cli.Context, e engine.Engine) error {
+	list, err := e.ListRules()
+	if err != nil {
+		return err
+	}
+	if c.Bool("json") {
+		out := make([]ruleJSON, len(list))
+		for i, rule := range list {
+			out[i] = toRuleJSON(rule)
+		}
+		return printJSON(out)
+	}
+	if len(list) == 0 {
+		fmt.Println("No rules.")
+		return nil
+	}
+	for _, rule := range list {
+		fmt.Printf("%s %s\n", rule.ID, describeRule(rule))
+	}
+	return nil
+}
+
+func cmdRulesRemove(c *cli.Context, e engine.Engine) error {
+	id, err := entryIDArg(c, e)
+	if err != nil {
+		return err
+	}
+	if err := e.RemoveRule(id); err != nil {
+		return err
+	}
+	if c.Bool("json") {
+		return printJSON(deletedJSON{ID: id.String(), Deleted: true})
+	}
+	fmt.Println("Removed.")
+	return nil
+}
+
+// describeRule summarizes a rule as "[name] when ... then ..."
+func describeRule(r engine.Rule) string {
+	var when, then []string
+	if r.Type != "" {
+		when = append(when, "type="+r.Type)
+	}
+	if r.Tag != "" {
+		when = append(when, "tag="+r.Tag)
+	}
+	if r.Pattern != "" {
+		target := "content"
+		if r.Field != "" {
+			target = r.Field
+		}
+		when = append(when, fmt.Sprintf("%s~/%s/", target, r.Pattern))
+	}
+	if len(r.AddTags) > 0 {
+		then = append(then, "+"+strings.Join(r.AddTags, " +"))
+	}
+	for _, field := range slices.Sorted(maps.Keys(r.Set)) {
+		then = append(then, fmt.Sprintf("%s=%v", field, r.Set[field]))
+	}
+	s := fmt.Sprintf("when %s then %s", strings.Join(when, " "), strings.Join(then, " "))
+	if r.Name != "" {
+		s = "[" + r.Name + "] " + s
+	}
+	return s
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/amaydixit11/acorde/internal/cli"
+	"github.com/amaydixit11/acorde/pkg/engine"
+)
+
+func cmdSchemaAdd(c *cli.Context, e engine.Engine) error {
+	if c.NArg() < 1 {
+		return cli.Usagef("missing entry type")
+	}
+	var definition []byte
+	var err error
+	switch path := c.String("file"); {
+	case path != "" && c.Arg(1) == "-":
+		return cli.Usagef("use only one of --file and - (stdin)")
+	case path != "":
+		definition, err = os.ReadFile(path)
+	case c.Arg(1) == "-":
+		definition, err = io.ReadAll(os.Stdin)
+	default:
+		return cli.Usagef("missing schema: use --file or - (stdin)")
+	}
+	if err != nil {
+		return err
+	}
+	stored, err := e.SaveSchema(c.Arg(0), definition)
+	if err != nil {
+		return err
+	}
+	if c.Bool("json") {
+		return printJSON(toSchemaJSON(stored))
+	}
+	fmt.Printf("Saved schema for %s entries\n", stored.Type)
+	return nil
+}
+
+func cmdSchemaList(c *cli.Context, e engine.Engine) error {
+	list, err := e.ListSchemas()
+	if err != nil {
+		return err
+	}
+	if c.Bool("json") {
+		out := make([]schemaJSON, len(list))
+		for i, stored := range list {
+			out[i] = toSchemaJSON(stored)
+		}
+		return printJSON(out)
+	}
+	if len(list) == 0 {
+		fmt.Println("No schemas.")
+		return nil
+	}
+	for _, stored := range list {
+		line := stored.Type
+		var def struct {
+			Title    string   `json:"title"`
+			Required []string `json:"required"`
+		}
+		if json.Unmarshal(stored.Definition, &def) == nil {
+			if def.Title != "" {
+				line += " " + def.Title
+			}
+			if len(def.Required) > 0 {
+				line += fmt.Sprintf(" (%d required fields)", len(def.Required))
+			}
+		}
+		fmt.Println(line)
+	}
+	return nil
+}
+
+func cmdSchemaShow(c *cli.Context, e engine.Engine) error {
+	if c.NArg() < 1 {
+		return cli.Usagef("missing entry type")
+	}
+	stored, err := e.GetSchema(c.Arg(0))
+	if err != nil {
+		return err
+	}
+	if c.Bool("json") {
+		return printJSON(toSchemaJSON(stored))
+	}
+	return printJSON(stored.Definition)
+}
+
+func cmdSchemaRemove(c *cli.Context, e engine.Engine) error {
+	if c.NArg() < 1 {
+		return cli.Usagef("missing entry type")
+	}
+	entryType := c.Arg(0)
+	if err := e.DeleteSchema(entryType); err != nil {
+		return err
+	}
+	if c.Bool("json") {
+		return printJSON(deletedSchemaJSON{Type: entryType, Deleted: true})
+	}
+	fmt.Println("Removed.")
+	return nil
+}
+
+// validateContent checks content against the schema of its entry type
+// for add and update --validate, which write nothing. Each error is
+// printed with the path of the field it is about.
+func validateContent(c *cli.Context, e engine.Engine, entryType engine.EntryType, content []byte) error {
+	result, err := e.ValidateContent(string(entryType), content)
+	if err != nil {
+		return err
+	}
+	if c.Bool("json") {
+		if err := printJSON(result); err != nil {
+			return err
+		}
+		if !result.Valid {
+			return fmt.Errorf("invalid %s content", entryType)
+		}
+		return nil
+	}
+	if result.Valid {
+		fmt.Printf("Valid %s content.\n", entryType)
+		return nil
+	}
+	fmt.Printf("Content does not match the %s schema:\n", entryType)
+	for _, verr := range result.Errors {
+		fmt.Printf("  %s: %s\n", verr.Field, verr.Description)
+	}
+	return fmt.Errorf("invalid %s content", entryType)
+}
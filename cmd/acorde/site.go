@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/amaydixit11/acorde/internal/cli"
+	"github.com/amaydixit11/acorde/internal/site"
+	"github.com/amaydixit11/acorde/pkg/engine"
+)
+
+// exportSite writes entries to --out as a static HTML site
+func exportSite(c *cli.Context, entries []engine.ExportEntry) error {
+	dir := c.String("out")
+	pages := make([]site.Entry, len(entries))
+	for i, e := range entries {
+		pages[i] = site.Entry{
+			ID:      e.ID,
+			Type:    e.Type,
+			Content: e.Content,
+			Tags:    e.Tags,
+			Created: e.Created,
+			Updated: e.Updated,
+		}
+	}
+
+	n, err := site.Build(dir, pages, site.Options{Title: c.String("title")})
+	if err != nil {
+		return err
+	}
+	if c.Bool("json") {
+		return printJSON(exportJSON{Dir: dir, Entries: n})
+	}
+	fmt.Printf("✅ Exported %d entries to %s (open %s)\n", n, dir, filepath.Join(dir, "index.html"))
+	return nil
+}
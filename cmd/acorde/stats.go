@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/amaydixit11/acorde/internal/cli"
+	"github.com/amaydixit11/acorde/internal/sync"
+	"github.com/amaydixit11/acorde/pkg/engine"
+)
+
+// statsBarWidth is the width of the longest bar stats draws
+const statsBarWidth = 40
+
+func cmdStats(c *cli.Context, e engine.Engine) error {
+	filter := engine.AggregateFilter{Location: time.Local}
+	if typeStr := c.String("type"); typeStr != "" {
+		t := engine.EntryType(typeStr)
+		filter.Type = &t
+	}
+	if tag := c.String("tag"); tag != "" {
+		filter.Tag = &tag
+	}
+	var err error
+	if filter.Since, err = parseDate("since", c.String("since")); err != nil {
+		return err
+	}
+	if filter.Until, err = parseDate("until", c.String("until")); err != nil {
+		return err
+	}
+
+	bucket := engine.Bucket(c.String("bucket"))
+	agg := engine.Aggregation{
+		Func:  engine.AggregateFunc(c.String("agg")),
+		Field: c.String("field"),
+	}
+	if agg.Func == engine.AggCount && agg.Field != "" {
+		return cli.Usagef("--field needs --agg sum, avg, min or max")
+	}
+	if agg.Func != engine.AggCount && agg.Field == "" {
+		return cli.Usagef("--agg %s needs --field", agg.Func)
+	}
+
+	buckets, err := e.Aggregate(filter, bucket, agg)
+	if err != nil {
+		return cli.Usagef("%v", err)
+	}
+
+	if c.Bool("json") {
+		return printJSON(statsJSON{Bucket: string(bucket), Agg: string(agg.Func), Field: agg.Field, Buckets: buckets})
+	}
+	if len(buckets) == 0 {
+		fmt.Println("No entries found.")
+		return nil
+	}
+
+	var peak float64
+	values := make([]string, len(buckets))
+	width := 0
+	for i, b := range buckets {
+		if b.Count > 0 {
+			values[i] = strconv.FormatFloat(b.Value, 'f', -1, 64)
+			peak = max(peak, b.Value)
+		} else if agg.Func == engine.AggCount {
+			values[i] = "0"
+		} else {
+			values[i] = "-"
+		}
+		width = max(width, len(values[i]))
+	}
+	for i, b := range buckets {
+		bar := 0
+		if peak > 0 && b.Value > 0 {
+			bar = max(1, int(b.Value/peak*statsBarWidth))
+		}
+		fmt.Printf("%s  %*s  %s\n", bucketLabel(b.Start, bucket), width, values[i], strings.Repeat("█", bar))
+	}
+	return nil
+}
+
+// bucketLabel formats the start of a bucket at its precision
+func bucketLabel(start time.Time, bucket engine.Bucket) string {
+	switch bucket {
+	case engine.BucketHour:
+		return start.Format("2006-01-02 15:00")
+	case engine.BucketMonth:
+		return start.Format("2006-01")
+	}
+	return start.Format(time.DateOnly)
+}
+
+// statsTopTags is how many tags stats overview lists
+const statsTopTags = 10
+
+func cmdStatsOverview(c *cli.Context, e engine.Engine) error {
+	stats, err := e.Stats()
+	if err != nil {
+		return fmt.Errorf("failed to gather stats: %w", err)
+	}
+	// Sync health as last published by the daemon
+	var peers map[string]int
+	if dir, err := resolveDataDir(c); err == nil {
+		if health, err := sync.LoadPeerHealth(dir); err == nil {
+			peers = peerHealthCounts(health)
+		}
+	}
+
+	if c.Bool("json") {
+		return printJSON(statsOverviewJSON{VaultStats: stats, PeerHealth: peers})
+	}
+
+	es := stats.Entries
+	fmt.Printf("Entries: %d (%d archived, %d deleted)\n\n", es.Total, es.Archived, es.Deleted)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	if len(es.ByType) > 0 {
+		fmt.Fprintln(w, "TYPE\tENTRIES\tCONTENT")
+		for _, t := range sortedByCount(es.ByType) {
+			fmt.Fprintf(w, "%s\t%d\t%s\n", t, es.ByType[t], formatBytes(stats.Storage.ContentBytes[t]))
+		}
+		fmt.Fprintln(w)
+	}
+	if tags := sortedByCount(es.ByTag); len(tags) > 0 {
+		fmt.Fprintln(w, "TAG\tENTRIES")
+		for i, tag := range tags {
+			if i == statsTopTags {
+				fmt.Fprintf(w, "(%d more)\t\n", len(tags)-statsTopTags)
+				break
+			}
+			fmt.Fprintf(w, "%s\t%d\n", tag, es.ByTag[tag])
+		}
+		fmt.Fprintln(w)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	created := 0
+	for _, b := range stats.Activity {
+		created += b.Count
+	}
+	fmt.Printf("Created, last %d days: %s  (%d)\n\n", engine.StatsActivityDays, sparkline(stats.Activity), created)
+
+	st := stats.Storage
+	fmt.Println("Storage:")
+	fmt.Printf("  Database      %s\n", formatBytes(st.DatabaseBytes))
+	fmt.Printf("  Search index  %s\n", formatBytes(st.IndexBytes))
+	fmt.Printf("  Blobs         %s (%d)\n", formatBytes(st.BlobBytes), st.Blobs)
+	fmt.Printf("\nVersions: %d, of %d entries\n", stats.Versions.Total, stats.Versions.Entries)
+
+	if len(peers) > 0 {
+		fmt.Printf("Peers: %d ok, %d backing off, %d quarantined\n",
+			peers[sync.PeerOK], peers[sync.PeerBackingOff], peers[sync.PeerQuarantined])
+	}
+	return nil
+}
+
+// peerHealthCounts counts peers by health status
+func peerHealthCounts(health []sync.PeerHealth) map[string]int {
+	counts := make(map[string]int)
+	for _, h := range health {
+		counts[h.Status]++
+	}
+	return counts
+}
+
+// sortedByCount returns the keys of counts, largest count first
+func sortedByCount(counts map[string]int) []string {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+// sparkline draws bucket counts as a line of block characters
+func sparkline(buckets []engine.AggregateBucket) string {
+	const ticks = "▁▂▃▄▅▆▇█"
+	levels := []rune(ticks)
+	peak := 0
+	for _, b := range buckets {
+		peak = max(peak, b.Count)
+	}
+	var sb strings.Builder
+	for _, b := range buckets {
+		level := 0
+		if peak > 0 {
+			level = b.Count * (len(levels) - 1) / peak
+		}
+		sb.WriteRune(levels[level])
+	}
+	return sb.String()
+}
+
+// formatBytes formats a size with a binary unit
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/amaydixit11/acorde/internal/cli"
+	"github.com/amaydixit11/acorde/internal/sync"
+	"github.com/amaydixit11/acorde/pkg/api"
+)
+
+func cmdSyncLog(c *cli.Context) error {
+	dir, err := resolveDataDir(c)
+	if err != nil {
+		return err
+	}
+	limit := c.Int("n")
+	if limit < 0 {
+		return cli.Usagef("-n must not be negative")
+	}
+	all, err := sync.LoadSessions(dir)
+	if err != nil {
+		return fmt.Errorf("failed to load sync sessions: %w", err)
+	}
+
+	peerID := c.String("peer")
+	sessions := make([]sync.Session, 0, len(all))
+	for _, s := range all {
+		if peerID == "" || s.Peer == peerID || strings.HasPrefix(s.Peer, peerID) {
+			sessions = append(sessions, s)
+		}
+	}
+	if limit > 0 && len(sessions) > limit {
+		sessions = sessions[len(sessions)-limit:]
+	}
+
+	if c.Bool("json") {
+		return printJSON(sessions)
+	}
+	if len(sessions) == 0 {
+		fmt.Println("No sync sessions recorded (run 'acorde daemon --sync-log N' to record them).")
+		return nil
+	}
+	for _, s := range sessions {
+		way := "←"
+		if s.Outbound {
+			way = "→"
+		}
+		outcome := fmt.Sprintf("%d applied", s.EntriesApplied)
+		if s.Error != "" {
+			outcome = "failed: " + s.Error
+		}
+		fmt.Printf("%s %s %s  %s  %s → %s  %s\n",
+			formatTime(s.Started), way, shortID(s.Peer), s.Duration.Round(time.Millisecond),
+			shortHash(s.HashBefore), shortHash(s.HashAfter), outcome)
+		if !c.Bool("verbose") {
+			continue
+		}
+		for _, m := range s.Messages {
+			arrow := "recv"
+			if m.Sent {
+				arrow = "sent"
+			}
+			fmt.Printf("    +%-8s %s %s", m.At.Sub(s.Started).Round(time.Millisecond), arrow, m.Type)
+			if m.StateHash != "" {
+				fmt.Printf(" hash=%s", shortHash(m.StateHash))
+			}
+			if m.StateSize > 0 {
+				fmt.Printf(" %d bytes", m.StateSize)
+			}
+			if m.Reason != "" {
+				fmt.Printf(" (%s)", m.Reason)
+			}
+			fmt.Println()
+		}
+	}
+	return nil
+}
+
+// shortID abbreviates a peer ID for display
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+// shortHash abbreviates a hex state hash for display
+func shortHash(h string) string {
+	if h == "" {
+		return "-"
+	}
+	if len(h) > 8 {
+		return h[:8]
+	}
+	return h
+}
+
+// apiSessions converts recorded sessions for GET /sync/sessions
+func apiSessions(sessions []sync.Session) []api.SyncSession {
+	result := make([]api.SyncSession, len(sessions))
+	for i, s := range sessions {
+		result[i] = api.SyncSession{
+			ID:             s.ID,
+			Peer:           s.Peer,
+			Outbound:       s.Outbound,
+			Started:        s.Started,
+			Duration:       s.Duration,
+			HashBefore:     s.HashBefore,
+			HashAfter:      s.HashAfter,
+			EntriesApplied: s.EntriesApplied,
+			Messages:       make([]api.SyncMessage, len(s.Messages)),
+			Error:          s.Error,
+		}
+		for j, m := range s.Messages {
+			result[i].Messages[j] = api.SyncMessage(m)
+		}
+	}
+	return result
+}
+
+// apiMergeStatus converts merge metrics for /status
+func apiMergeStatus(m sync.MergeMetrics) api.MergeStatus {
+	return api.MergeStatus{
+		Merges:        m.Merges,
+		SlowMerges:    m.SlowMerges,
+		DurationMS:    m.Duration.Milliseconds(),
+		MaxDurationMS: m.MaxDuration.Milliseconds(),
+		Compared:      m.Compared,
+		Changed:       m.Changed,
+		Tombstones:    m.Tombstones,
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/amaydixit11/acorde/internal/cli"
+	"github.com/amaydixit11/acorde/pkg/engine"
+	"golang.org/x/term"
+)
+
+func cmdTemplatesSave(c *cli.Context, e engine.Engine) error {
+	if c.NArg() < 1 {
+		return cli.Usagef("missing template name")
+	}
+	in, ok, err := readContent(c, 1)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return cli.Usagef("missing template content: use --content, --content-file or - (stdin)")
+	}
+	tmpl, err := e.SaveTemplate(engine.Template{
+		Name:    c.Arg(0),
+		Type:    c.String("type"),
+		Content: string(in.Data),
+		Tags:    splitTags(c.String("tags")),
+	})
+	if err != nil {
+		return err
+	}
+	if c.Bool("json") {
+		return printJSON(toTemplateJSON(tmpl))
+	}
+	fmt.Printf("Saved template %s\n", tmpl.Name)
+	return nil
+}
+
+func cmdTemplatesList(c *cli.Context, e engine.Engine) error {
+	list, err := e.ListTemplates()
+	if err != nil {
+		return err
+	}
+	if c.Bool("json") {
+		out := make([]templateJSON, len(list))
+		for i, tmpl := range list {
+			out[i] = toTemplateJSON(tmpl)
+		}
+		return printJSON(out)
+	}
+	if len(list) == 0 {
+		fmt.Println("No templates.")
+		return nil
+	}
+	for _, tmpl := range list {
+		line := fmt.Sprintf("%s (%s)", tmpl.Name, tmpl.Type)
+		if len(tmpl.Tags) > 0 {
+			line += " +" + strings.Join(tmpl.Tags, " +")
+		}
+		if vars := tmpl.Variables(); len(vars) > 0 {
+			line += " vars: " + strings.Join(vars, ", ")
+		}
+		fmt.Println(line)
+	}
+	return nil
+}
+
+func cmdTemplatesShow(c *cli.Context, e engine.Engine) error {
+	if c.NArg() < 1 {
+		return cli.Usagef("missing template name")
+	}
+	tmpl, err := e.GetTemplate(c.Arg(0))
+	if err != nil {
+		return err
+	}
+	if c.Bool("json") {
+		return printJSON(toTemplateJSON(tmpl))
+	}
+	fmt.Printf("Name: %s\nType: %s\n", tmpl.Name, tmpl.Type)
+	if len(tmpl.Tags) > 0 {
+		fmt.Printf("Tags: %s\n", strings.Join(tmpl.Tags, ", "))
+	}
+	fmt.Printf("\n%s\n", tmpl.Content)
+	return nil
+}
+
+func cmdTemplatesRemove(c *cli.Context, e engine.Engine) error {
+	if c.NArg() < 1 {
+		return cli.Usagef("missing template name")
+	}
+	name := c.Arg(0)
+	if err := e.DeleteTemplate(name); err != nil {
+		return err
+	}
+	if c.Bool("json") {
+		return printJSON(deletedTemplateJSON{Name: name, Deleted: true})
+	}
+	fmt.Println("Removed.")
+	return nil
+}
+
+// cmdAddTemplate adds an entry from the template named by --template,
+// with variables from --vars. Those not given are asked for on a
+// terminal; without one, the engine reports them missing.
+func cmdAddTemplate(c *cli.Context, e engine.Engine) error {
+	if c.IsSet("content") || c.String("content-file") != "" || c.Arg(0) == "-" || c.IsSet("type") {
+		return cli.Usagef("--template gives the type and content: drop --type, --content, --content-file and -")
+	}
+	vars := make(map[string]string)
+	if s := c.String("vars"); s != "" {
+		for _, pair := range strings.Split(s, ",") {
+			name, value, ok := strings.Cut(pair, "=")
+			if name = strings.TrimSpace(name); !ok || name == "" {
+				return cli.Usagef("invalid --vars %q: expected name=value", pair)
+			}
+			vars[name] = strings.TrimSpace(value)
+		}
+	}
+
+	tmpl, err := e.GetTemplate(c.String("template"))
+	if err != nil {
+		return err
+	}
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		stdin := bufio.NewReader(os.Stdin)
+		for _, name := range tmpl.Variables() {
+			if _, ok := vars[name]; ok {
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "%s: ", name)
+			value, err := stdin.ReadString('\n')
+			if err != nil && value == "" {
+				fmt.Fprintln(os.Stderr)
+				break
+			}
+			vars[name] = strings.TrimSpace(value)
+		}
+	}
+
+	entry, err := e.AddFromTemplate(tmpl.Name, vars, splitTags(c.String("tags")))
+	if err != nil {
+		return err
+	}
+	printEntry(c, entry, "", false)
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/amaydixit11/acorde/internal/cli"
+	"github.com/amaydixit11/acorde/pkg/engine"
+)
+
+func cmdTimeline(c *cli.Context, e engine.Engine) error {
+	limit := c.Int("n")
+	if limit < 0 {
+		return cli.Usagef("-n must not be negative")
+	}
+	filter := engine.TimelineFilter{Author: c.String("author")}
+	if typeStr := c.String("type"); typeStr != "" {
+		t := engine.EntryType(typeStr)
+		filter.Type = &t
+	}
+	var err error
+	if filter.Since, err = parseDate("since", c.String("since")); err != nil {
+		return err
+	}
+	if filter.Until, err = parseDate("until", c.String("until")); err != nil {
+		return err
+	}
+
+	events, err := e.Timeline(filter, limit)
+	if err != nil {
+		return err
+	}
+	if c.Bool("json") {
+		if events == nil {
+			events = []engine.TimelineEvent{}
+		}
+		return printJSON(events)
+	}
+	if len(events) == 0 {
+		fmt.Println("No changes.")
+		return nil
+	}
+	for _, ev := range events {
+		at := "(unknown time)"
+		if !ev.Time.IsZero() {
+			at = formatTime(ev.Time)
+		}
+		line := fmt.Sprintf("%s %-6s %s [%s]", at, ev.Action, ev.EntryID.String()[:8], ev.Type)
+		if ev.Title != "" {
+			line += " " + ev.Title
+		}
+		if ev.Author != "" {
+			line += "  by " + shortID(ev.Author)
+		}
+		fmt.Println(line)
+	}
+	return nil
+}
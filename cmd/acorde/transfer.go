@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/amaydixit11/acorde/internal/cli"
+	"github.com/amaydixit11/acorde/pkg/crypto"
+	"github.com/amaydixit11/acorde/pkg/engine"
+)
+
+// addTransferFlags registers the destination flags of mv and cp
+func addTransferFlags(fs *flag.FlagSet) {
+	fs.String("to-vault", "", "Destination: a named vault in the --data directory")
+	fs.String("to-data", "", "Destination: a vault data directory")
+}
+
+func cmdMove(c *cli.Context, e engine.Engine) error {
+	return transferEntries(c, e, true)
+}
+
+func cmdCopy(c *cli.Context, e engine.Engine) error {
+	return transferEntries(c, e, false)
+}
+
+// transferEntries copies or moves the entries given as arguments to the
+// destination vault, stopping at the first that fails
+func transferEntries(c *cli.Context, e engine.Engine, move bool) error {
+	ids, err := entryIDArgs(c, e)
+	if err != nil {
+		return err
+	}
+	dstDir, err := transferDestination(c)
+	if err != nil {
+		return err
+	}
+
+	if crypto.NewFileKeyStore(dstDir).IsInitialized() {
+		fmt.Fprintf(os.Stderr, "Destination vault %s\n", dstDir)
+	}
+	dstCfg, err := unlockConfig(dstDir)
+	if err != nil {
+		return err
+	}
+	dst, err := engine.New(dstCfg)
+	if err != nil {
+		return fmt.Errorf("failed to open destination vault: %w", err)
+	}
+	defer dst.Close()
+
+	transfer, verb := e.CopyEntryTo, "Copied"
+	if move {
+		transfer, verb = e.MoveEntryTo, "Moved"
+	}
+	out := make([]transferredJSON, 0, len(ids))
+	for _, id := range ids {
+		if _, err := transfer(id, dst); err != nil {
+			if errors.Is(err, engine.ErrEntryExists) {
+				err = fmt.Errorf("%s is already in %s", id, dstDir)
+			}
+			return err
+		}
+		out = append(out, transferredJSON{ID: id.String(), To: dstDir, Moved: move})
+		if !c.Bool("json") {
+			fmt.Printf("%s %s to %s\n", verb, id, dstDir)
+		}
+	}
+
+	if c.Bool("json") {
+		if len(out) == 1 {
+			return printJSON(out[0])
+		}
+		return printJSON(out)
+	}
+	return nil
+}
+
+// transferDestination returns the data directory given by --to-vault or
+// --to-data
+func transferDestination(c *cli.Context) (string, error) {
+	toVault, toData := c.String("to-vault"), c.String("to-data")
+	switch {
+	case toVault != "" && toData != "":
+		return "", cli.Usagef("use either --to-vault or --to-data")
+	case toData != "":
+		return filepath.Abs(toData)
+	case toVault != "":
+		return vaultDataDir(c, toVault)
+	}
+	return "", cli.Usagef("missing destination: --to-vault <name> or --to-data <dir>")
+}
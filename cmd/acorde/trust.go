@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/amaydixit11/acorde/internal/cli"
+	"github.com/amaydixit11/acorde/internal/sync"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// trustBundle signs this device's allowlist, and its device key, with
+// its identity key
+func trustBundle(dir string) (*sync.TrustBundle, error) {
+	key, _, err := loadOrGenerateKey(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load identity key: %w", err)
+	}
+	allowlist, err := sync.NewAllowlist(dir, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load allowlist: %w", err)
+	}
+	device, err := loadDeviceKey(dir)
+	if err != nil {
+		return nil, err
+	}
+	return sync.NewTrustBundle(key, device.Public[:], allowlist.List())
+}
+
+func cmdDeviceExport(c *cli.Context) error {
+	dir, err := resolveDataDir(c)
+	if err != nil {
+		return err
+	}
+	bundle, err := trustBundle(dir)
+	if err != nil {
+		return err
+	}
+	data, err := bundle.Encode()
+	if err != nil {
+		return err
+	}
+
+	out := c.String("out")
+	if out == "" {
+		_, err := os.Stdout.Write(append(data, '\n'))
+		return err
+	}
+	if err := os.WriteFile(out, data, 0600); err != nil {
+		return fmt.Errorf("failed to write trust bundle: %w", err)
+	}
+	if c.Bool("json") {
+		return printJSON(trustJSON{Signer: bundle.Signer, Peers: len(bundle.Peers), Path: out})
+	}
+	fmt.Printf("Wrote %d trusted devices to %s.\n", len(bundle.Peers), out)
+	fmt.Printf("Import it on a new device with 'acorde device import %s'.\n", out)
+	return nil
+}
+
+func cmdDeviceImport(c *cli.Context) error {
+	if c.NArg() < 1 {
+		return cli.Usagef("missing trust bundle file (- for stdin)")
+	}
+	dir, err := resolveDataDir(c)
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	if c.Arg(0) == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(c.Arg(0))
+	}
+	if err != nil {
+		return err
+	}
+	bundle, err := sync.ParseTrustBundle(data)
+	if err != nil {
+		return err
+	}
+
+	_, self, err := loadOrGenerateKey(dir)
+	if err != nil {
+		return fmt.Errorf("failed to load identity key: %w", err)
+	}
+	allowlist, err := sync.NewAllowlist(dir, false)
+	if err != nil {
+		return fmt.Errorf("failed to load allowlist: %w", err)
+	}
+	if signer, err := peer.Decode(bundle.Signer); err == nil && allowlist.IsRevoked(signer) {
+		return fmt.Errorf("trust bundle signed by revoked device %s", bundle.Signer)
+	}
+	added, err := allowlist.ImportTrust(bundle, self)
+	if err != nil {
+		return fmt.Errorf("failed to import trust bundle: %w", err)
+	}
+
+	if c.Bool("json") {
+		return printJSON(trustJSON{Signer: bundle.Signer, Peers: len(bundle.Peers), Added: added})
+	}
+	fmt.Printf("✅ Trusted %s and %d of its devices (%d new).\n", bundle.Signer, len(bundle.Peers), added)
+	return nil
+}
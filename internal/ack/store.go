@@ -0,0 +1,76 @@
+// Package ack persists per-entry delivery acknowledgements.
+package ack
+
+import (
+	"database/sql"
+
+	"github.com/amaydixit11/acorde/internal/core"
+	"github.com/google/uuid"
+)
+
+// Store manages delivery acks in SQLite
+type Store struct {
+	db *sql.DB
+}
+
+// NewStore creates a new ack store
+func NewStore(db *sql.DB) (*Store, error) {
+	store := &Store{db: db}
+
+	if err := store.initSchema(); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+func (s *Store) initSchema() error {
+	schema := `
+		CREATE TABLE IF NOT EXISTS entry_acks (
+			entry_id TEXT NOT NULL,
+			peer TEXT NOT NULL,
+			version INTEGER NOT NULL,
+			timestamp INTEGER NOT NULL,
+			received_at INTEGER NOT NULL,
+			PRIMARY KEY (entry_id, peer)
+		);
+	`
+	_, err := s.db.Exec(schema)
+	return err
+}
+
+// Put stores an ack, replacing the peer's previous ack of the entry
+func (s *Store) Put(ack core.Ack) error {
+	_, err := s.db.Exec(`
+		INSERT OR REPLACE INTO entry_acks (entry_id, peer, version, timestamp, received_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, ack.EntryID.String(), ack.Peer, ack.Version, ack.Timestamp, ack.ReceivedAt)
+
+	return err
+}
+
+// List returns all stored acks
+func (s *Store) List() ([]core.Ack, error) {
+	rows, err := s.db.Query(`
+		SELECT entry_id, peer, version, timestamp, received_at
+		FROM entry_acks
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var acks []core.Ack
+	for rows.Next() {
+		var ack core.Ack
+		var entryIDStr string
+
+		if err := rows.Scan(&entryIDStr, &ack.Peer, &ack.Version, &ack.Timestamp, &ack.ReceivedAt); err != nil {
+			return nil, err
+		}
+
+		ack.EntryID, _ = uuid.Parse(entryIDStr)
+		acks = append(acks, ack)
+	}
+	return acks, rows.Err()
+}
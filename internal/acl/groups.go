@@ -0,0 +1,126 @@
+package acl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// GroupTag marks the config entries holding groups
+const GroupTag = "group"
+
+// GroupPrefix marks a group, rather than a peer, in an ACL's readers or
+// writers: "group:family" grants every member of the family group
+const GroupPrefix = "group:"
+
+// groupKind identifies group content among config entries
+const groupKind = "group"
+
+// groupName is what group names may contain
+var groupName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// Group is a named set of peer IDs that ACLs grant access to as a whole.
+// Groups are stored as config entries, so they sync like any other
+// entry, and membership is resolved when access is checked.
+type Group struct {
+	ID      uuid.UUID `json:"-"` // ID of the config entry holding the group
+	Name    string    `json:"name"`
+	Members []string  `json:"members"`
+}
+
+// groupContent is the content of a config entry holding a group
+type groupContent struct {
+	Kind string `json:"kind"`
+	Group
+}
+
+// GroupResolver returns the members of a group (none if there is no such
+// group)
+type GroupResolver func(name string) []string
+
+// ValidateGroupName checks that a group name is non-empty and made of
+// letters, digits, '_', '.' and '-'
+func ValidateGroupName(name string) error {
+	if !groupName.MatchString(name) {
+		return fmt.Errorf("invalid group name %q: use letters, digits, '_', '.' and '-'", name)
+	}
+	return nil
+}
+
+// Validate checks the group's name and members, dropping duplicate
+// members
+func (g *Group) Validate() error {
+	if err := ValidateGroupName(g.Name); err != nil {
+		return err
+	}
+	members := make([]string, 0, len(g.Members))
+	for _, m := range g.Members {
+		if m == "" || strings.HasPrefix(m, GroupPrefix) {
+			return fmt.Errorf("invalid group member %q: groups hold peer IDs", m)
+		}
+		if !slices.Contains(members, m) {
+			members = append(members, m)
+		}
+	}
+	g.Members = members
+	return nil
+}
+
+// EncodeGroup returns the content of a config entry holding the group
+func EncodeGroup(g Group) ([]byte, error) {
+	return json.Marshal(groupContent{Kind: groupKind, Group: g})
+}
+
+// DecodeGroup parses and validates the content of a config entry holding
+// a group
+func DecodeGroup(id uuid.UUID, content []byte) (Group, error) {
+	var gc groupContent
+	if err := json.Unmarshal(content, &gc); err != nil {
+		return Group{}, fmt.Errorf("invalid group: %w", err)
+	}
+	if gc.Kind != groupKind {
+		return Group{}, errors.New("config entry is not a group")
+	}
+	g := gc.Group
+	if err := g.Validate(); err != nil {
+		return Group{}, err
+	}
+	g.ID = id
+	return g, nil
+}
+
+// GroupRef returns the reader or writer that grants a group access
+func GroupRef(name string) string {
+	return GroupPrefix + name
+}
+
+// listed reports whether a readers or writers list names a peer, itself
+// or through a group it is a member of
+func listed(list []string, peerID string, groups GroupResolver) bool {
+	for _, item := range list {
+		if item == peerID {
+			return true
+		}
+		if name, ok := strings.CutPrefix(item, GroupPrefix); ok && groups != nil &&
+			slices.Contains(groups(name), peerID) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetGroupResolver sets how ACL checks resolve the groups readers and
+// writers refer to. Without one, groups grant nobody access.
+func (s *Store) SetGroupResolver(groups GroupResolver) {
+	s.groups = groups
+}
+
+// Groups returns the store's group resolver (nil if none)
+func (s *Store) Groups() GroupResolver {
+	return s.groups
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"sync/atomic"
 
 	"github.com/amaydixit11/acorde/internal/core"
 	"github.com/google/uuid"
@@ -25,6 +26,8 @@ const (
 type Store struct {
 	db      *sql.DB
 	localID string // This peer's ID
+	shared  atomic.Bool
+	groups  GroupResolver // Set before use, see SetGroupResolver
 }
 
 // NewStore creates a new ACL store
@@ -37,6 +40,9 @@ func NewStore(db *sql.DB, localPeerID string) (*Store, error) {
 	if err := store.initSchema(); err != nil {
 		return nil, err
 	}
+	if err := store.loadShared(); err != nil {
+		return nil, err
+	}
 
 	return store, nil
 }
@@ -48,15 +54,87 @@ func (s *Store) initSchema() error {
 			owner TEXT NOT NULL,
 			readers TEXT NOT NULL,
 			writers TEXT NOT NULL,
-			public INTEGER NOT NULL DEFAULT 0
+			public INTEGER NOT NULL DEFAULT 0,
+			sharing TEXT NOT NULL DEFAULT ''
 		);
 	`
-	_, err := s.db.Exec(schema)
+	if _, err := s.db.Exec(schema); err != nil {
+		return err
+	}
+
+	// Databases created before per-entry sharing lack the sharing column
+	var n int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('entry_acl') WHERE name = 'sharing'`).Scan(&n)
+	if err != nil || n > 0 {
+		return err
+	}
+	_, err = s.db.Exec(`ALTER TABLE entry_acl ADD COLUMN sharing TEXT NOT NULL DEFAULT ''`)
+	return err
+}
+
+// loadShared records whether any stored ACL grants access to peers
+func (s *Store) loadShared() error {
+	var shared bool
+	err := s.db.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM entry_acl
+			WHERE readers NOT IN ('null', '[]') OR writers NOT IN ('null', '[]') OR sharing != '')
+	`).Scan(&shared)
+	s.shared.Store(shared)
 	return err
 }
 
+// Shared reports whether any entry grants access to peers, through its
+// readers, writers or per-entry sharing keys. It doesn't query the
+// database.
+func (s *Store) Shared() bool {
+	return s.shared.Load()
+}
+
+// sharingColumn is the stored form of an ACL's per-entry sharing fields
+type sharingColumn struct {
+	OwnerKey  []byte            `json:"owner_key"`
+	SealedKey []byte            `json:"sealed_key,omitempty"`
+	Keys      map[string][]byte `json:"keys"`
+}
+
+// encodeSharing serializes the sharing fields ("" if not shared)
+func encodeSharing(acl core.ACL) string {
+	if !acl.IsShared() {
+		return ""
+	}
+	data, _ := json.Marshal(sharingColumn{OwnerKey: acl.OwnerKey, SealedKey: acl.SealedKey, Keys: acl.Keys})
+	return string(data)
+}
+
+// decodeSharing fills the sharing fields from the stored column
+func decodeSharing(acl *core.ACL, data string) {
+	if data == "" {
+		return
+	}
+	var col sharingColumn
+	if json.Unmarshal([]byte(data), &col) == nil {
+		acl.OwnerKey = col.OwnerKey
+		acl.SealedKey = col.SealedKey
+		acl.Keys = col.Keys
+	}
+}
+
 // SetACL sets the ACL for an entry
 func (s *Store) SetACL(acl core.ACL) error {
+	return s.setACL(s.db, acl)
+}
+
+// SetACLTx sets the ACL for an entry inside tx
+func (s *Store) SetACLTx(tx *sql.Tx, acl core.ACL) error {
+	return s.setACL(tx, acl)
+}
+
+// execer is a *sql.DB or a *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func (s *Store) setACL(db execer, acl core.ACL) error {
 	readersJSON, _ := json.Marshal(acl.Readers)
 	writersJSON, _ := json.Marshal(acl.Writers)
 	public := 0
@@ -64,10 +142,13 @@ func (s *Store) SetACL(acl core.ACL) error {
 		public = 1
 	}
 
-	_, err := s.db.Exec(`
-		INSERT OR REPLACE INTO entry_acl (entry_id, owner, readers, writers, public)
-		VALUES (?, ?, ?, ?, ?)
-	`, acl.EntryID.String(), acl.Owner, readersJSON, writersJSON, public)
+	_, err := db.Exec(`
+		INSERT OR REPLACE INTO entry_acl (entry_id, owner, readers, writers, public, sharing)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, acl.EntryID.String(), acl.Owner, readersJSON, writersJSON, public, encodeSharing(acl))
+	if err == nil && (len(acl.Readers) > 0 || len(acl.Writers) > 0 || acl.IsShared()) {
+		s.shared.Store(true)
+	}
 
 	return err
 }
@@ -78,12 +159,13 @@ func (s *Store) GetACL(entryID uuid.UUID) (*core.ACL, error) {
 	var entryIDStr string
 	var readersJSON, writersJSON []byte
 	var public int
+	var sharing string
 
 	err := s.db.QueryRow(`
-		SELECT entry_id, owner, readers, writers, public
+		SELECT entry_id, owner, readers, writers, public, sharing
 		FROM entry_acl
 		WHERE entry_id = ?
-	`, entryID.String()).Scan(&entryIDStr, &acl.Owner, &readersJSON, &writersJSON, &public)
+	`, entryID.String()).Scan(&entryIDStr, &acl.Owner, &readersJSON, &writersJSON, &public, &sharing)
 
 	if err == sql.ErrNoRows {
 		// No ACL = public access
@@ -101,6 +183,7 @@ func (s *Store) GetACL(entryID uuid.UUID) (*core.ACL, error) {
 	json.Unmarshal(readersJSON, &acl.Readers)
 	json.Unmarshal(writersJSON, &acl.Writers)
 	acl.Public = public == 1
+	decodeSharing(&acl, sharing)
 
 	return &acl, nil
 }
@@ -114,7 +197,7 @@ func (s *Store) DeleteACL(entryID uuid.UUID) error {
 // List returns all ACLs
 func (s *Store) List() ([]core.ACL, error) {
 	rows, err := s.db.Query(`
-		SELECT entry_id, owner, readers, writers, public
+		SELECT entry_id, owner, readers, writers, public, sharing
 		FROM entry_acl
 	`)
 	if err != nil {
@@ -128,8 +211,9 @@ func (s *Store) List() ([]core.ACL, error) {
 		var entryIDStr string
 		var readersJSON, writersJSON []byte
 		var public int
+		var sharing string
 
-		if err := rows.Scan(&entryIDStr, &acl.Owner, &readersJSON, &writersJSON, &public); err != nil {
+		if err := rows.Scan(&entryIDStr, &acl.Owner, &readersJSON, &writersJSON, &public, &sharing); err != nil {
 			return nil, err
 		}
 
@@ -137,6 +221,7 @@ func (s *Store) List() ([]core.ACL, error) {
 		json.Unmarshal(readersJSON, &acl.Readers)
 		json.Unmarshal(writersJSON, &acl.Writers)
 		acl.Public = public == 1
+		decodeSharing(&acl, sharing)
 		
 		acls = append(acls, acl)
 	}
@@ -184,37 +269,24 @@ func (s *Store) canRead(acl *core.ACL, peerID string) bool {
 		return true
 	}
 
-	// Check writers (writers can also read)
-	for _, w := range acl.Writers {
-		if w == peerID {
-			return true
-		}
-	}
-
-	// Check readers
-	for _, r := range acl.Readers {
-		if r == peerID {
-			return true
-		}
-	}
-
-	return false
+	// Check writers (writers can also read), then readers
+	return listed(acl.Writers, peerID, s.groups) || listed(acl.Readers, peerID, s.groups)
 }
 
 func (s *Store) canWrite(acl *core.ACL, peerID string) bool {
+	return CanWrite(acl, peerID, s.groups)
+}
+
+// CanWrite reports whether acl lets a peer write its entry, resolving the
+// groups among its writers with groups (nil = groups grant nobody)
+func CanWrite(acl *core.ACL, peerID string, groups GroupResolver) bool {
 	// Owner can always write
 	if acl.Owner == peerID || acl.Owner == "" {
 		return true
 	}
 
 	// Check writers
-	for _, w := range acl.Writers {
-		if w == peerID {
-			return true
-		}
-	}
-
-	return false
+	return listed(acl.Writers, peerID, groups)
 }
 
 // GrantRead adds a peer to the readers list
@@ -0,0 +1,269 @@
+package blob
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// ErrNotFound is returned by a Backend for a blob it does not hold
+var ErrNotFound = errors.New("blob not found")
+
+// Backend holds complete blobs away from the local disk, such as in an S3
+// bucket. A Store with a backend keeps recently used blobs on disk as a
+// cache and every blob in the backend.
+type Backend interface {
+	// Put stores size bytes read from r as the blob cid
+	Put(cid CID, r io.Reader, size int64) error
+
+	// Get opens the blob cid for reading
+	Get(cid CID) (io.ReadCloser, error)
+
+	// Stat returns the size of the blob cid
+	Stat(cid CID) (int64, error)
+
+	// Delete removes the blob cid; removing a missing blob is no error
+	Delete(cid CID) error
+
+	// List returns every blob held
+	List() ([]Object, error)
+}
+
+// Object is a blob held by a Backend
+type Object struct {
+	CID  CID
+	Size int64
+}
+
+// DefaultCacheBytes is how much of the local disk a Store with a backend
+// uses for cached blobs, unless configured
+const DefaultCacheBytes = 1 << 30
+
+// ConfigFile is the file in a data directory that selects the blob
+// backend. Without it blobs are stored on the local disk only.
+const ConfigFile = "blobstore.json"
+
+// Config selects where a vault's blobs are stored
+type Config struct {
+	Backend    string    `json:"backend"`               // "local" (default) or "s3"
+	S3         *S3Config `json:"s3,omitempty"`          // For the s3 backend
+	CacheBytes int64     `json:"cache_bytes,omitempty"` // Local cache size (0 = DefaultCacheBytes)
+}
+
+// Validate checks that the config selects a usable backend
+func (c Config) Validate() error {
+	switch c.Backend {
+	case "", "local":
+		return nil
+	case "s3":
+		if c.S3 == nil {
+			return fmt.Errorf("s3 blob backend is not configured")
+		}
+		return c.S3.Validate()
+	default:
+		return fmt.Errorf("unknown blob backend %q (use local or s3)", c.Backend)
+	}
+}
+
+// LoadConfig reads the blob config of a data directory. A directory
+// without one stores blobs locally.
+func LoadConfig(dataDir string) (Config, error) {
+	data, err := os.ReadFile(filepath.Join(dataDir, ConfigFile))
+	if os.IsNotExist(err) {
+		return Config{}, nil
+	}
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to read blob config: %w", err)
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return Config{}, fmt.Errorf("invalid blob config: %w", err)
+	}
+	return cfg, cfg.Validate()
+}
+
+// SaveConfig writes the blob config of a data directory. It holds the S3
+// credentials, if any, so it is readable by the owner only.
+func SaveConfig(dataDir string, cfg Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeAtomic(filepath.Join(dataDir, ConfigFile), data)
+}
+
+// newBackend returns the backend a config selects, or nil for local
+// storage
+func newBackend(cfg Config) (Backend, error) {
+	if cfg.Backend != "s3" {
+		return nil, nil
+	}
+	return NewS3Backend(*cfg.S3)
+}
+
+// upload copies a locally stored blob to the backend, unless it holds it
+// already
+func (s *Store) upload(cid CID) error {
+	if _, err := s.remote.Stat(cid); err == nil {
+		return nil
+	}
+	f, err := os.Open(s.blobPath(cid))
+	if err != nil {
+		return fmt.Errorf("failed to read blob: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to read blob: %w", err)
+	}
+	if err := s.remote.Put(cid, f, info.Size()); err != nil {
+		return fmt.Errorf("failed to upload blob %s: %w", cid, err)
+	}
+	return nil
+}
+
+// Upload copies the blobs on the local disk to the backend, e.g. after
+// switching a vault to one, and returns how many it copied
+func (s *Store) Upload() (int, error) {
+	if s.remote == nil {
+		return 0, nil
+	}
+	var cids []CID
+	err := filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == "partial" {
+			return filepath.SkipDir
+		}
+		if !d.IsDir() && len(d.Name()) == 64 {
+			cids = append(cids, CID(d.Name()))
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list blobs: %w", err)
+	}
+	for i, cid := range cids {
+		if err := s.upload(cid); err != nil {
+			return i, err
+		}
+	}
+	s.trimCache("")
+	return len(cids), nil
+}
+
+// fetch copies a blob from the backend into the local cache, checking
+// its content against the CID
+func (s *Store) fetch(cid CID) error {
+	if len(cid) != 64 {
+		return fmt.Errorf("invalid blob CID %q", cid)
+	}
+	body, err := s.remote.Get(cid)
+	if errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("blob not found: %s", cid)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to fetch blob %s: %w", cid, err)
+	}
+	defer body.Close()
+
+	if err := s.ensureSubdir(cid); err != nil {
+		return err
+	}
+	path := s.blobPath(cid)
+	tmpPath := path + ".tmp"
+	out, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to cache blob: %w", err)
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(out, hash), body); err != nil {
+		out.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to fetch blob %s: %w", cid, err)
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to cache blob: %w", err)
+	}
+	if actual := sumCID(hash); actual != cid {
+		os.Remove(tmpPath)
+		return fmt.Errorf("blob integrity check failed: expected %s, got %s", cid, actual)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to cache blob: %w", err)
+	}
+	s.trimCache(cid)
+	return nil
+}
+
+// cached makes sure a blob is on the local disk, fetching it from the
+// backend if need be, and marks it used
+func (s *Store) cached(cid CID) error {
+	if s.remote == nil {
+		return nil
+	}
+	path := s.blobPath(cid)
+	if _, err := os.Stat(path); err == nil {
+		now := time.Now()
+		os.Chtimes(path, now, now)
+		return nil
+	}
+	return s.fetch(cid)
+}
+
+// trimCache removes the least recently used cached blobs, but keep (if
+// any), until the cache fits its size. Every cached blob is in the
+// backend.
+func (s *Store) trimCache(keep CID) {
+	type cachedBlob struct {
+		path string
+		size int64
+		used time.Time
+	}
+	var blobs []cachedBlob
+	var total int64
+	filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() && d.Name() == "partial" {
+			return filepath.SkipDir
+		}
+		if d.IsDir() || len(d.Name()) != 64 || CID(d.Name()) == keep {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			blobs = append(blobs, cachedBlob{path, info.Size(), info.ModTime()})
+			total += info.Size()
+		}
+		return nil
+	})
+	if keep != "" {
+		if info, err := os.Stat(s.blobPath(keep)); err == nil {
+			total += info.Size()
+		}
+	}
+
+	sort.Slice(blobs, func(i, j int) bool { return blobs[i].used.Before(blobs[j].used) })
+	for _, b := range blobs {
+		if total <= s.cacheBytes {
+			break
+		}
+		if os.Remove(b.path) == nil {
+			total -= b.size
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package blob
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// DefaultChunkSize is the size of the chunks blobs are transferred in
+const DefaultChunkSize = 256 << 10
+
+// MaxChunkSize bounds the chunk size a manifest may declare
+const MaxChunkSize = 4 << 20
+
+// Manifest describes a blob as fixed-size chunks, for transferring it
+// in pieces that are verified one by one and survive interruptions
+type Manifest struct {
+	CID       CID      `json:"cid"`
+	Size      int64    `json:"size"`
+	ChunkSize int      `json:"chunk_size"`
+	Chunks    []string `json:"chunks"` // SHA-256 of each chunk, hex
+}
+
+// Validate checks that the chunks cover Size bytes of ChunkSize each
+func (m Manifest) Validate() error {
+	if len(m.CID) != 64 {
+		return fmt.Errorf("invalid blob CID %q", m.CID)
+	}
+	if m.ChunkSize <= 0 || m.ChunkSize > MaxChunkSize {
+		return fmt.Errorf("invalid chunk size %d", m.ChunkSize)
+	}
+	if m.Size < 0 || int64(len(m.Chunks)) != (m.Size+int64(m.ChunkSize)-1)/int64(m.ChunkSize) {
+		return fmt.Errorf("manifest has %d chunks for %d bytes", len(m.Chunks), m.Size)
+	}
+	return nil
+}
+
+// chunkLen returns the length of chunk index
+func (m Manifest) chunkLen(index int) int {
+	if rest := m.Size - int64(index)*int64(m.ChunkSize); rest < int64(m.ChunkSize) {
+		return int(rest)
+	}
+	return m.ChunkSize
+}
+
+// Manifest splits a stored blob into chunks of chunkSize bytes and
+// hashes them
+func (s *Store) Manifest(cid CID, chunkSize int) (Manifest, error) {
+	if chunkSize <= 0 || chunkSize > MaxChunkSize {
+		return Manifest{}, fmt.Errorf("invalid chunk size %d", chunkSize)
+	}
+	f, err := s.Open(cid)
+	if err != nil {
+		return Manifest{}, err
+	}
+	defer f.Close()
+
+	m := Manifest{CID: cid, ChunkSize: chunkSize, Chunks: []string{}}
+	whole := sha256.New()
+	buf := make([]byte, chunkSize)
+	for {
+		n, err := io.ReadFull(f, buf)
+		if n > 0 {
+			sum := sha256.Sum256(buf[:n])
+			m.Chunks = append(m.Chunks, hex.EncodeToString(sum[:]))
+			whole.Write(buf[:n])
+			m.Size += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return Manifest{}, fmt.Errorf("failed to read blob: %w", err)
+		}
+	}
+	if sumCID(whole) != cid {
+		return Manifest{}, fmt.Errorf("blob integrity check failed: %s", cid)
+	}
+	return m, nil
+}
+
+// ReadChunk reads chunk index of a stored blob split into chunks of
+// chunkSize bytes
+func (s *Store) ReadChunk(cid CID, chunkSize, index int) ([]byte, error) {
+	if chunkSize <= 0 || chunkSize > MaxChunkSize || index < 0 {
+		return nil, fmt.Errorf("invalid chunk %d of size %d", index, chunkSize)
+	}
+	f, err := s.Open(cid)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, chunkSize)
+	n, err := f.ReadAt(buf, int64(index)*int64(chunkSize))
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read blob: %w", err)
+	}
+	if n == 0 {
+		return nil, fmt.Errorf("chunk %d is past the end of blob %s", index, cid)
+	}
+	return buf[:n], nil
+}
+
+// Open opens a stored blob for reading. Unlike Get it does not verify the
+// blob's integrity, so parts of a large blob can be read without reading
+// all of it.
+func (s *Store) Open(cid CID) (*os.File, error) {
+	if len(cid) != 64 {
+		return nil, fmt.Errorf("invalid blob CID %q", cid)
+	}
+	if err := s.cached(cid); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(s.blobPath(cid))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("blob not found: %s", cid)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob: %w", err)
+	}
+	return f, nil
+}
+
+// Downloads: the chunks of a blob being received are kept in
+// blobs/partial/<cid>/ with its manifest, so an interrupted transfer
+// resumes with the chunks still missing.
+
+// StartDownload prepares to receive the blob m describes, keeping the
+// chunks already received for the same manifest
+func (s *Store) StartDownload(m Manifest) error {
+	if err := m.Validate(); err != nil {
+		return err
+	}
+	dir := s.partialDir(m.CID)
+	if prev, err := s.downloadManifest(m.CID); err == nil {
+		if prev.ChunkSize == m.ChunkSize && prev.Size == m.Size {
+			return nil
+		}
+		os.RemoveAll(dir) // Chunked differently, start over
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create download directory: %w", err)
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return writeAtomic(filepath.Join(dir, "manifest.json"), data)
+}
+
+// MissingChunks returns the chunks of a download not yet received.
+// Received chunks that fail verification are dropped and reported
+// missing.
+func (s *Store) MissingChunks(cid CID) ([]int, error) {
+	m, err := s.downloadManifest(cid)
+	if err != nil {
+		return nil, err
+	}
+	var missing []int
+	for i, want := range m.Chunks {
+		path := s.chunkPath(cid, i)
+		data, err := os.ReadFile(path)
+		if err == nil && len(data) == m.chunkLen(i) && hashHex(data) == want {
+			continue
+		}
+		os.Remove(path)
+		missing = append(missing, i)
+	}
+	return missing, nil
+}
+
+// PutChunk stores a received chunk of a download, after checking it
+// against the chunk's hash in the manifest
+func (s *Store) PutChunk(cid CID, index int, data []byte) error {
+	m, err := s.downloadManifest(cid)
+	if err != nil {
+		return err
+	}
+	if index < 0 || index >= len(m.Chunks) {
+		return fmt.Errorf("chunk %d out of range (%d chunks)", index, len(m.Chunks))
+	}
+	if len(data) != m.chunkLen(index) || hashHex(data) != m.Chunks[index] {
+		return fmt.Errorf("chunk %d of blob %s failed verification", index, cid)
+	}
+	return writeAtomic(s.chunkPath(cid, index), data)
+}
+
+// FinishDownload assembles the received chunks into the blob and stores
+// it once its hash matches the CID. The partial download is removed
+// either way unless chunks are missing.
+func (s *Store) FinishDownload(cid CID) error {
+	m, err := s.downloadManifest(cid)
+	if err != nil {
+		return err
+	}
+	if missing, err := s.MissingChunks(cid); err != nil {
+		return err
+	} else if len(missing) > 0 {
+		return fmt.Errorf("blob %s is missing %d of %d chunks", cid, len(missing), len(m.Chunks))
+	}
+	defer os.RemoveAll(s.partialDir(cid))
+
+	if err := s.ensureSubdir(cid); err != nil {
+		return err
+	}
+	path := s.blobPath(cid)
+	tmpPath := path + ".tmp"
+	out, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write blob: %w", err)
+	}
+	whole := sha256.New()
+	w := io.MultiWriter(out, whole)
+	for i := range m.Chunks {
+		data, err := os.ReadFile(s.chunkPath(cid, i))
+		if err == nil {
+			_, err = w.Write(data)
+		}
+		if err != nil {
+			out.Close()
+			os.Remove(tmpPath)
+			return fmt.Errorf("failed to assemble blob: %w", err)
+		}
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write blob: %w", err)
+	}
+
+	if actual := sumCID(whole); actual != cid {
+		os.Remove(tmpPath)
+		return fmt.Errorf("blob integrity check failed: expected %s, got %s", cid, actual)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to finalize blob: %w", err)
+	}
+	return s.stored(cid)
+}
+
+// errNoDownload is returned for blobs not being downloaded
+var errNoDownload = errors.New("no download in progress")
+
+func (s *Store) downloadManifest(cid CID) (Manifest, error) {
+	if len(cid) != 64 {
+		return Manifest{}, fmt.Errorf("invalid blob CID %q", cid)
+	}
+	data, err := os.ReadFile(filepath.Join(s.partialDir(cid), "manifest.json"))
+	if os.IsNotExist(err) {
+		return Manifest{}, fmt.Errorf("blob %s: %w", cid, errNoDownload)
+	}
+	if err != nil {
+		return Manifest{}, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return Manifest{}, fmt.Errorf("invalid download manifest: %w", err)
+	}
+	return m, m.Validate()
+}
+
+func (s *Store) partialDir(cid CID) string {
+	return filepath.Join(s.dir, "partial", string(cid))
+}
+
+func (s *Store) chunkPath(cid CID, index int) string {
+	return filepath.Join(s.partialDir(cid), strconv.Itoa(index))
+}
+
+func writeAtomic(path string, data []byte) error {
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(path), err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func sumCID(h hash.Hash) CID {
+	return CID(hex.EncodeToString(h.Sum(nil)))
+}
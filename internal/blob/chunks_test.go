@@ -0,0 +1,94 @@
+package blob
+
+import (
+	"bytes"
+	"os"
+	"slices"
+	"testing"
+)
+
+func TestChunkedDownload(t *testing.T) {
+	src, _ := NewStore(t.TempDir())
+	dst, _ := NewStore(t.TempDir())
+
+	data := bytes.Repeat([]byte("0123456789"), 105) // 1050 bytes
+	cid, err := src.PutWithSubdir(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := src.Manifest(cid, 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Size != 1050 || len(m.Chunks) != 5 {
+		t.Fatalf("manifest has %d bytes in %d chunks, want 1050 in 5", m.Size, len(m.Chunks))
+	}
+	if last, _ := src.ReadChunk(cid, 256, 4); len(last) != 26 {
+		t.Errorf("last chunk is %d bytes, want 26", len(last))
+	}
+
+	if err := dst.StartDownload(m); err != nil {
+		t.Fatal(err)
+	}
+	chunk := func(i int) []byte {
+		c, err := src.ReadChunk(cid, 256, i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	if err := dst.PutChunk(cid, 1, []byte("corrupt")); err == nil {
+		t.Error("expected a corrupt chunk to be rejected")
+	}
+	for _, i := range []int{0, 3} {
+		if err := dst.PutChunk(cid, i, chunk(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := dst.FinishDownload(cid); err == nil {
+		t.Error("expected an incomplete download to fail")
+	}
+
+	// An interrupted download resumes with the chunks it lacks, and
+	// chunks damaged on disk are fetched again
+	os.WriteFile(dst.chunkPath(cid, 3), []byte("damaged"), 0600)
+	dst.StartDownload(m)
+	missing, err := dst.MissingChunks(cid)
+	if err != nil || !slices.Equal(missing, []int{1, 2, 3, 4}) {
+		t.Fatalf("missing chunks = %v (%v), want [1 2 3 4]", missing, err)
+	}
+	for _, i := range missing {
+		if err := dst.PutChunk(cid, i, chunk(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := dst.FinishDownload(cid); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := dst.Get(cid); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("assembled blob differs: %v", err)
+	}
+	if _, err := os.Stat(dst.partialDir(cid)); !os.IsNotExist(err) {
+		t.Error("partial download was not removed")
+	}
+}
+
+func TestChunkedDownloadVerifiesCID(t *testing.T) {
+	dst, _ := NewStore(t.TempDir())
+
+	// Chunks that match a manifest lying about the CID
+	data := []byte("forged content")
+	m := Manifest{CID: computeCID([]byte("real content")), Size: int64(len(data)), ChunkSize: 64, Chunks: []string{hashHex(data)}}
+	if err := dst.StartDownload(m); err != nil {
+		t.Fatal(err)
+	}
+	if err := dst.PutChunk(m.CID, 0, data); err != nil {
+		t.Fatal(err)
+	}
+	if err := dst.FinishDownload(m.CID); err == nil {
+		t.Fatal("expected the assembled blob to fail verification")
+	}
+	if dst.Has(m.CID) {
+		t.Error("unverified blob was stored")
+	}
+}
@@ -0,0 +1,73 @@
+package blob
+
+import "github.com/amaydixit11/acorde/pkg/crypto"
+
+// FileContent is the content of a File entry: a reference to a blob, with
+// metadata detected when it was stored
+type FileContent struct {
+	Name      string `json:"name,omitempty"`
+	CID       CID    `json:"cid"`
+	Size      int    `json:"size"`
+	MIME      string `json:"mime,omitempty"`
+	Thumbnail CID    `json:"thumbnail,omitempty"` // Derived preview blob, for images
+
+	// Key seals the blob and thumbnail (see StoreSealedFile); nil for
+	// plaintext blobs. It is only as secret as the entry holding it, so
+	// encrypted vaults keep it under the vault key.
+	Key []byte `json:"key,omitempty"`
+
+	// Segment is the plaintext size of the segments sealed blobs are
+	// split into (see SealSegment); 0 for blobs sealed whole, as before
+	// segments
+	Segment int `json:"segment,omitempty"`
+}
+
+// StoreFile stores data with put, detecting its MIME type and, for images,
+// storing a thumbnail as a derived blob. Marshal the result as the content
+// of a File entry. A thumbnail that cannot be made is left out.
+func StoreFile(put func(data []byte) (CID, error), name string, data []byte) (FileContent, error) {
+	return storeFile(put, name, data, nil)
+}
+
+// StoreSealedFile is StoreFile for encrypted vaults: the blob and its
+// thumbnail are sealed with key (see NewKey) before they are stored, so
+// their CIDs are those of the ciphertext, and the key is recorded in the
+// FileContent for Open
+func StoreSealedFile(put func(data []byte) (CID, error), name string, data []byte, key crypto.Key) (FileContent, error) {
+	return storeFile(put, name, data, &key)
+}
+
+func storeFile(put func(data []byte) (CID, error), name string, data []byte, key *crypto.Key) (FileContent, error) {
+	if key != nil {
+		inner := put
+		put = func(data []byte) (CID, error) {
+			sealed, err := seal(*key, data)
+			if err != nil {
+				return "", err
+			}
+			return inner(sealed)
+		}
+	}
+
+	cid, err := put(data)
+	if err != nil {
+		return FileContent{}, err
+	}
+	fc := FileContent{
+		Name: name,
+		CID:  cid,
+		Size: len(data),
+		MIME: DetectMIME(name, data),
+	}
+	if key != nil {
+		fc.Key, fc.Segment = key[:], SealSegment
+	}
+	if CanThumbnail(fc.MIME) {
+		if thumb, err := Thumbnail(data); err == nil {
+			if fc.Thumbnail, err = put(thumb); err != nil {
+				return FileContent{}, err
+			}
+		}
+	}
+	return fc, nil
+}
@@ -0,0 +1,110 @@
+package blob
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	// Decoders for thumbnails
+	_ "image/gif"
+)
+
+// ThumbnailSize is the maximum width and height of thumbnails
+const ThumbnailSize = 256
+
+// DetectMIME returns the MIME type of content, sniffed from the data and
+// refined by the file name's extension when sniffing only finds generic
+// text or binary
+func DetectMIME(name string, data []byte) string {
+	sniffed := http.DetectContentType(data)
+	generic := sniffed == "application/octet-stream" || strings.HasPrefix(sniffed, "text/plain")
+	if generic && name != "" {
+		if byExt := mime.TypeByExtension(strings.ToLower(filepath.Ext(name))); byExt != "" {
+			return byExt
+		}
+	}
+	return sniffed
+}
+
+// CanThumbnail reports whether Thumbnail supports a MIME type
+func CanThumbnail(mimeType string) bool {
+	switch mimeType {
+	case "image/png", "image/jpeg", "image/gif":
+		return true
+	}
+	return false
+}
+
+// Thumbnail scales an image down to fit ThumbnailSize and encodes it as
+// PNG (for formats with transparency) or JPEG. Images already small
+// enough are re-encoded at their size.
+func Thumbnail(data []byte) ([]byte, error) {
+	src, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	thumb := scaleDown(src, ThumbnailSize)
+	var buf bytes.Buffer
+	if format == "jpeg" {
+		err = jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 80})
+	} else {
+		err = png.Encode(&buf, thumb)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// scaleDown shrinks src to fit a size×size box, averaging the source
+// pixels that fall into each destination pixel
+func scaleDown(src image.Image, size int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= size && h <= size {
+		return src
+	}
+	dw, dh := size, h*size/w
+	if h > w {
+		dw, dh = w*size/h, size
+	}
+	dw, dh = max(dw, 1), max(dh, 1)
+
+	// Work on RGBA so that pixel access is cheap
+	rgba := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(rgba, rgba.Bounds(), src, b.Min, draw.Src)
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*h/dh, max((y+1)*h/dh, y*h/dh+1)
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*w/dw, max((x+1)*w/dw, x*w/dw+1)
+			var r, g, bl, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				row := rgba.Pix[sy*rgba.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += uint32(p[0])
+					g += uint32(p[1])
+					bl += uint32(p[2])
+					a += uint32(p[3])
+					n++
+				}
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(bl / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
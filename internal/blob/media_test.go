@@ -0,0 +1,59 @@
+package blob
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func TestDetectMIME(t *testing.T) {
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 1, 1)))
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"photo.bin", buf.Bytes(), "image/png"}, // Sniffed beats the extension
+		{"style.css", []byte("body {}"), "text/css; charset=utf-8"},
+		{"data.json", []byte(`{"a": 1}`), "application/json"},
+		{"", []byte("plain"), "text/plain; charset=utf-8"},
+		{"", []byte{0, 1, 2, 3}, "application/octet-stream"},
+	}
+	for _, tt := range tests {
+		if got := DetectMIME(tt.name, tt.data); got != tt.want {
+			t.Errorf("DetectMIME(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 1000, 400))
+	for y := 0; y < 400; y++ {
+		for x := 0; x < 1000; x++ {
+			src.Set(x, y, color.RGBA{uint8(x), uint8(y), 0, 255})
+		}
+	}
+
+	var jpg bytes.Buffer
+	jpeg.Encode(&jpg, src, nil)
+	thumb, err := Thumbnail(jpg.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, format, err := image.Decode(bytes.NewReader(thumb))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "jpeg" || img.Bounds().Dx() != ThumbnailSize || img.Bounds().Dy() != ThumbnailSize*400/1000 {
+		t.Errorf("expected a %dx%d jpeg, got %s %v", ThumbnailSize, ThumbnailSize*400/1000, format, img.Bounds())
+	}
+
+	if _, err := Thumbnail([]byte("not an image")); err == nil {
+		t.Error("expected an error for non-image data")
+	}
+}
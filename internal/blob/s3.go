@@ -0,0 +1,294 @@
+package blob
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Config locates a bucket of an S3-compatible service (AWS S3, MinIO,
+// and others) holding a vault's blobs
+type S3Config struct {
+	Endpoint string `json:"endpoint"`         // e.g. https://s3.eu-west-1.amazonaws.com or http://localhost:9000
+	Region   string `json:"region,omitempty"` // Default us-east-1
+	Bucket   string `json:"bucket"`
+	Prefix   string `json:"prefix,omitempty"` // Key prefix, for sharing a bucket
+
+	// Credentials; $AWS_ACCESS_KEY_ID and $AWS_SECRET_ACCESS_KEY are used
+	// when left empty
+	AccessKey string `json:"access_key,omitempty"`
+	SecretKey string `json:"secret_key,omitempty"`
+}
+
+// Validate checks that the config names an endpoint and a bucket
+func (c S3Config) Validate() error {
+	if c.Bucket == "" {
+		return fmt.Errorf("s3 blob backend needs a bucket")
+	}
+	u, err := url.Parse(c.Endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid s3 endpoint %q (use http(s)://host[:port])", c.Endpoint)
+	}
+	return nil
+}
+
+// s3Backend stores blobs as objects <prefix><cid> of a bucket, addressed
+// path-style (endpoint/bucket/key) and signed with AWS Signature V4
+type s3Backend struct {
+	endpoint  *url.URL
+	region    string
+	bucket    string
+	prefix    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+}
+
+// NewS3Backend returns a Backend storing blobs in an S3 bucket
+func NewS3Backend(cfg S3Config) (Backend, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	endpoint, _ := url.Parse(strings.TrimRight(cfg.Endpoint, "/"))
+	b := &s3Backend{
+		endpoint:  endpoint,
+		region:    cfg.Region,
+		bucket:    cfg.Bucket,
+		prefix:    cfg.Prefix,
+		accessKey: cfg.AccessKey,
+		secretKey: cfg.SecretKey,
+		client:    &http.Client{Timeout: 10 * time.Minute}, // Large blobs
+	}
+	if b.region == "" {
+		b.region = "us-east-1"
+	}
+	if b.accessKey == "" && b.secretKey == "" {
+		b.accessKey, b.secretKey = os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+	if b.accessKey == "" || b.secretKey == "" {
+		return nil, fmt.Errorf("s3 blob backend needs credentials (access_key and secret_key, or $AWS_ACCESS_KEY_ID and $AWS_SECRET_ACCESS_KEY)")
+	}
+	return b, nil
+}
+
+func (b *s3Backend) Put(cid CID, r io.Reader, size int64) error {
+	// The CID is the SHA-256 of the content, as the signature needs
+	resp, err := b.do(http.MethodPut, b.key(cid), nil, io.NopCloser(r), size, string(cid))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (b *s3Backend) Get(cid CID) (io.ReadCloser, error) {
+	resp, err := b.do(http.MethodGet, b.key(cid), nil, nil, 0, emptyHash)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (b *s3Backend) Stat(cid CID) (int64, error) {
+	resp, err := b.do(http.MethodHead, b.key(cid), nil, nil, 0, emptyHash)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.ContentLength, nil
+}
+
+func (b *s3Backend) Delete(cid CID) error {
+	resp, err := b.do(http.MethodDelete, b.key(cid), nil, nil, 0, emptyHash)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (b *s3Backend) List() ([]Object, error) {
+	var objects []Object
+	query := url.Values{"list-type": {"2"}, "prefix": {b.prefix}}
+	for {
+		resp, err := b.do(http.MethodGet, "", query, nil, 0, emptyHash)
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Contents []struct {
+				Key  string
+				Size int64
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid s3 listing: %w", err)
+		}
+		for _, c := range page.Contents {
+			if cid := strings.TrimPrefix(c.Key, b.prefix); len(cid) == 64 {
+				objects = append(objects, Object{CID: CID(cid), Size: c.Size})
+			}
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return objects, nil
+		}
+		query.Set("continuation-token", page.NextContinuationToken)
+	}
+}
+
+// key returns the object key of a blob
+func (b *s3Backend) key(cid CID) string {
+	return b.prefix + string(cid)
+}
+
+// do sends a signed request for an object key of the bucket (or the
+// bucket itself) and checks its status. A missing object is ErrNotFound.
+func (b *s3Backend) do(method, key string, query url.Values, body io.ReadCloser, size int64, payloadHash string) (*http.Response, error) {
+	u := *b.endpoint
+	u.Path = b.endpoint.Path + "/" + b.bucket
+	if key != "" {
+		u.Path += "/" + key
+	}
+	u.RawQuery = query.Encode()
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	signV4(req, payloadHash, b.accessKey, b.secretKey, b.region, time.Now())
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("s3 %s failed: %w", method, err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		var s3err struct{ Code, Message string }
+		xml.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&s3err)
+		if s3err.Code != "" {
+			return nil, fmt.Errorf("s3 %s failed: %s: %s", method, s3err.Code, s3err.Message)
+		}
+		return nil, fmt.Errorf("s3 %s failed: %s", method, resp.Status)
+	}
+	return resp, nil
+}
+
+// emptyHash is the SHA-256 of an empty payload
+const emptyHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// signV4 signs a request for S3 with AWS Signature Version 4, covering
+// the host and every header already set
+func signV4(req *http.Request, payloadHash, accessKey, secretKey, region string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	day := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		escapePath(req.URL.EscapedPath()),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hashHex([]byte(canonicalRequest))
+	key := hmacSHA256([]byte("AWS4"+secretKey), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// escapePath escapes a URL path as SigV4 canonical requests need: every
+// byte but the unreserved characters and "/" percent-encoded
+func escapePath(path string) string {
+	unescaped, err := url.PathUnescape(path)
+	if err != nil {
+		unescaped = path
+	}
+	if unescaped == "" {
+		return "/"
+	}
+	return uriEncode(unescaped, false)
+}
+
+// canonicalQuery sorts and escapes query parameters for SigV4
+func canonicalQuery(query url.Values) string {
+	var pairs []string
+	for name, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, uriEncode(name, true)+"="+uriEncode(value, true))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode percent-encodes all but unreserved characters (and "/",
+// unless encodeSlash)
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,205 @@
+package blob
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/amaydixit11/acorde/pkg/crypto"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+// SealSegment is the plaintext size of the segments a blob is sealed in,
+// each on its own, so a sealed blob can be read from any offset without
+// opening it whole
+const SealSegment = 64 << 10
+
+// segmentOverhead is what sealing adds to each segment: nonce and tag
+const segmentOverhead = crypto.NonceSize + chacha20poly1305.Overhead
+
+// errTruncated reports a sealed blob cut short or padded
+var errTruncated = errors.New("sealed blob is truncated")
+
+// NewKey derives a fresh key for sealing one file's blobs from the vault's
+// master key, with HKDF over a random nonce. The nonce is independent of
+// the content, so equal files get different keys and ciphertexts: the
+// blob store does not deduplicate sealed files (content-derived keys
+// would reveal which files are equal).
+func NewKey(master crypto.Key) (crypto.Key, error) {
+	nonce := make([]byte, crypto.KeySize)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return crypto.Key{}, fmt.Errorf("failed to generate blob key nonce: %w", err)
+	}
+	h := hkdf.New(sha256.New, master[:], nonce, []byte("acorde-blob-key"))
+
+	var key crypto.Key
+	if _, err := io.ReadFull(h, key[:]); err != nil {
+		return crypto.Key{}, fmt.Errorf("failed to derive blob key: %w", err)
+	}
+	return key, nil
+}
+
+// segmentAAD binds a segment to its position, and marks the last one, so
+// segments cannot be reordered, dropped or the blob cut short
+func segmentAAD(index int64, last bool) []byte {
+	aad := binary.BigEndian.AppendUint64(nil, uint64(index))
+	if last {
+		return append(aad, 1)
+	}
+	return append(aad, 0)
+}
+
+// seal encrypts a blob with XChaCha20-Poly1305 under key, in segments of
+// SealSegment bytes
+func seal(key crypto.Key, data []byte) ([]byte, error) {
+	count := max((len(data)+SealSegment-1)/SealSegment, 1)
+	sealed := make([]byte, 0, len(data)+count*segmentOverhead)
+	for i := 0; i < count; i++ {
+		segment := data[i*SealSegment : min((i+1)*SealSegment, len(data))]
+		ciphertext, err := crypto.Encrypt(key, segment, segmentAAD(int64(i), i == count-1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to seal blob: %w", err)
+		}
+		sealed = append(sealed, ciphertext...)
+	}
+	return sealed, nil
+}
+
+// Sealed reports whether the file's blobs are sealed, so reading them
+// needs Open or NewReader
+func (fc FileContent) Sealed() bool {
+	return len(fc.Key) > 0
+}
+
+// key returns the key sealing the file's blobs
+func (fc FileContent) key() (crypto.Key, error) {
+	var key crypto.Key
+	if len(fc.Key) != crypto.KeySize {
+		return key, crypto.ErrInvalidKey
+	}
+	copy(key[:], fc.Key)
+	return key, nil
+}
+
+// Open returns the plaintext of one of the file's blobs (its content or
+// thumbnail), as read from the store. Blobs that are not sealed are
+// returned as they are.
+func (fc FileContent) Open(data []byte) ([]byte, error) {
+	if !fc.Sealed() {
+		return data, nil
+	}
+	r, err := fc.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+// NewReader returns a reader of the plaintext of one of the file's blobs,
+// read from r (see Store.Open). Sealed blobs are decrypted a segment at a
+// time as they are read, so seeking in them costs a segment; blobs sealed
+// whole, before segments, are opened whole. Blobs that are not sealed are
+// read as they are.
+func (fc FileContent) NewReader(r io.ReadSeeker) (io.ReadSeeker, error) {
+	if !fc.Sealed() {
+		return r, nil
+	}
+	key, err := fc.key()
+	if err != nil {
+		return nil, err
+	}
+	if fc.Segment == 0 {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		plain, err := crypto.Decrypt(key, data, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open blob %s: %w", fc.CID, err)
+		}
+		return bytes.NewReader(plain), nil
+	}
+
+	s := &segmentReader{r: r, key: key, segment: int64(fc.Segment), current: -1}
+	sealedSize, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	full := s.segment + segmentOverhead
+	s.count = (sealedSize + full - 1) / full
+	s.size = sealedSize - s.count*segmentOverhead
+	if s.count == 0 || s.size < (s.count-1)*s.segment {
+		return nil, fmt.Errorf("failed to open blob %s: %w", fc.CID, errTruncated)
+	}
+	// The last segment authenticates the size
+	if err := s.load(s.count - 1); err != nil {
+		return nil, fmt.Errorf("failed to open blob %s: %w", fc.CID, err)
+	}
+	return s, nil
+}
+
+// segmentReader reads the plaintext of a blob sealed in segments
+type segmentReader struct {
+	r       io.ReadSeeker
+	key     crypto.Key
+	segment int64 // Plaintext size of a segment
+	count   int64 // Segments
+	size    int64 // Plaintext size
+
+	pos     int64
+	current int64 // Segment in plain (-1 = none)
+	plain   []byte
+}
+
+// load decrypts segment i
+func (s *segmentReader) load(i int64) error {
+	full := s.segment + segmentOverhead
+	if _, err := s.r.Seek(i*full, io.SeekStart); err != nil {
+		return err
+	}
+	buf := make([]byte, full)
+	n, err := io.ReadFull(s.r, buf)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	plain, err := crypto.Decrypt(s.key, buf[:n], segmentAAD(i, i == s.count-1))
+	if err != nil {
+		return err
+	}
+	s.current, s.plain = i, plain
+	return nil
+}
+
+func (s *segmentReader) Read(p []byte) (int, error) {
+	if s.pos >= s.size {
+		return 0, io.EOF
+	}
+	i := s.pos / s.segment
+	if i != s.current {
+		if err := s.load(i); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, s.plain[s.pos-i*s.segment:])
+	s.pos += int64(n)
+	return n, nil
+}
+
+func (s *segmentReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += s.pos
+	case io.SeekEnd:
+		offset += s.size
+	}
+	if offset < 0 {
+		return 0, errors.New("seek before the start of the blob")
+	}
+	s.pos = offset
+	return offset, nil
+}
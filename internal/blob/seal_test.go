@@ -0,0 +1,112 @@
+package blob
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"io"
+	"testing"
+
+	"github.com/amaydixit11/acorde/pkg/crypto"
+)
+
+func TestStoreSealedFile(t *testing.T) {
+	var img bytes.Buffer
+	png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 400, 300)))
+	data := img.Bytes()
+
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	master, _ := crypto.GenerateKey()
+	key, err := NewKey(master)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fc, err := StoreSealedFile(store.PutWithSubdir, "photo.png", data, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fc.Sealed() || fc.MIME != "image/png" || fc.Size != len(data) || fc.Thumbnail == "" {
+		t.Fatalf("unexpected file content %+v", fc)
+	}
+
+	// Stored as ciphertext, under its CID
+	sealed, err := store.Get(fc.CID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(sealed, data) || fc.CID == computeCID(data) {
+		t.Error("expected the blob to be stored sealed")
+	}
+	if plain, err := fc.Open(sealed); err != nil || !bytes.Equal(plain, data) {
+		t.Errorf("Open = %d bytes, %v", len(plain), err)
+	}
+	thumb, _ := store.Get(fc.Thumbnail)
+	if _, format, err := image.DecodeConfig(bytes.NewReader(thumb)); err == nil {
+		t.Errorf("expected a sealed thumbnail, got a %s", format)
+	}
+	if plain, err := fc.Open(thumb); err != nil {
+		t.Errorf("failed to open the thumbnail: %v", err)
+	} else if _, _, err := image.DecodeConfig(bytes.NewReader(plain)); err != nil {
+		t.Errorf("opened thumbnail is no image: %v", err)
+	}
+
+	// Each file gets its own key
+	other, _ := NewKey(master)
+	if other == key {
+		t.Error("expected a fresh key per file")
+	}
+	fc.Key = other[:]
+	if _, err := fc.Open(sealed); err == nil {
+		t.Error("expected another file's key to fail")
+	}
+}
+
+func TestSealedReader(t *testing.T) {
+	data := make([]byte, 2*SealSegment+100)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	key, _ := crypto.GenerateKey()
+	sealed, err := seal(key, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fc := FileContent{CID: computeCID(sealed), Key: key[:], Segment: SealSegment}
+
+	r, err := fc.NewReader(bytes.NewReader(sealed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size, _ := r.Seek(0, io.SeekEnd); size != int64(len(data)) {
+		t.Errorf("expected size %d, got %d", len(data), size)
+	}
+	// A range across a segment boundary
+	start := int64(SealSegment - 10)
+	r.Seek(start, io.SeekStart)
+	part := make([]byte, 30)
+	if _, err := io.ReadFull(r, part); err != nil || !bytes.Equal(part, data[start:start+30]) {
+		t.Errorf("range read failed: %v", err)
+	}
+	if plain, err := fc.Open(sealed); err != nil || !bytes.Equal(plain, data) {
+		t.Errorf("Open = %d bytes, %v", len(plain), err)
+	}
+
+	// Dropping the last segment is noticed
+	if _, err := fc.NewReader(bytes.NewReader(sealed[:2*(SealSegment+segmentOverhead)])); err == nil {
+		t.Error("expected a truncated blob to fail")
+	}
+	empty, _ := seal(key, nil)
+	if plain, err := fc.Open(empty); err != nil || len(plain) != 0 {
+		t.Errorf("expected an empty file, got %d bytes (%v)", len(plain), err)
+	}
+
+	// Blobs sealed whole, before segments, still open
+	whole, _ := crypto.Encrypt(key, data, nil)
+	fc.Segment = 0
+	if plain, err := fc.Open(whole); err != nil || !bytes.Equal(plain, data) {
+		t.Errorf("Open of a blob sealed whole = %d bytes, %v", len(plain), err)
+	}
+}
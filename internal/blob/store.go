@@ -4,8 +4,10 @@ package blob
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 )
@@ -16,16 +18,38 @@ type CID string
 // Store provides content-addressed blob storage
 type Store struct {
 	dir string
+
+	remote     Backend // nil = blobs are kept in dir only
+	cacheBytes int64   // Size of dir kept as a cache of remote
 }
 
-// NewStore creates a new blob store at the given directory
+// NewStore creates a new blob store at the given directory, backed by
+// the backend its ConfigFile selects, if any
 func NewStore(dataDir string) (*Store, error) {
+	cfg, err := LoadConfig(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	remote, err := newBackend(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return NewStoreWithBackend(dataDir, remote, cfg.CacheBytes)
+}
+
+// NewStoreWithBackend creates a blob store keeping every blob in remote
+// and up to cacheBytes of recently used ones (0 = DefaultCacheBytes) at
+// the given directory. A nil remote stores blobs in the directory only.
+func NewStoreWithBackend(dataDir string, remote Backend, cacheBytes int64) (*Store, error) {
 	blobDir := filepath.Join(dataDir, "blobs")
 	if err := os.MkdirAll(blobDir, 0700); err != nil {
 		return nil, fmt.Errorf("failed to create blob directory: %w", err)
 	}
+	if cacheBytes <= 0 {
+		cacheBytes = DefaultCacheBytes
+	}
 
-	return &Store{dir: blobDir}, nil
+	return &Store{dir: blobDir, remote: remote, cacheBytes: cacheBytes}, nil
 }
 
 // Put stores a blob and returns its CID
@@ -49,7 +73,7 @@ func (s *Store) Put(data []byte) (CID, error) {
 		return "", fmt.Errorf("failed to finalize blob: %w", err)
 	}
 
-	return cid, nil
+	return cid, s.stored(cid)
 }
 
 // PutReader stores a blob from a reader
@@ -64,6 +88,9 @@ func (s *Store) PutReader(r io.Reader) (CID, error) {
 
 // Get retrieves a blob by CID
 func (s *Store) Get(cid CID) ([]byte, error) {
+	if err := s.cached(cid); err != nil {
+		return nil, err
+	}
 	path := s.blobPath(cid)
 	data, err := os.ReadFile(path)
 	if os.IsNotExist(err) {
@@ -85,7 +112,13 @@ func (s *Store) Get(cid CID) ([]byte, error) {
 // Has checks if a blob exists
 func (s *Store) Has(cid CID) bool {
 	path := s.blobPath(cid)
-	_, err := os.Stat(path)
+	if _, err := os.Stat(path); err == nil {
+		return true
+	}
+	if s.remote == nil {
+		return false
+	}
+	_, err := s.remote.Stat(cid)
 	return err == nil
 }
 
@@ -95,6 +128,11 @@ func (s *Store) Delete(cid CID) error {
 	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("failed to delete blob: %w", err)
 	}
+	if s.remote != nil {
+		if err := s.remote.Delete(cid); err != nil {
+			return fmt.Errorf("failed to delete blob: %w", err)
+		}
+	}
 	return nil
 }
 
@@ -102,6 +140,13 @@ func (s *Store) Delete(cid CID) error {
 func (s *Store) Size(cid CID) (int64, error) {
 	path := s.blobPath(cid)
 	info, err := os.Stat(path)
+	if os.IsNotExist(err) && s.remote != nil {
+		size, err := s.remote.Stat(cid)
+		if errors.Is(err, ErrNotFound) {
+			return 0, fmt.Errorf("blob not found: %s", cid)
+		}
+		return size, err
+	}
 	if os.IsNotExist(err) {
 		return 0, fmt.Errorf("blob not found: %s", cid)
 	}
@@ -113,6 +158,17 @@ func (s *Store) Size(cid CID) (int64, error) {
 
 // List returns all CIDs in the store
 func (s *Store) List() ([]CID, error) {
+	if s.remote != nil {
+		objects, err := s.remote.List()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list blobs: %w", err)
+		}
+		cids := make([]CID, len(objects))
+		for i, o := range objects {
+			cids[i] = o.CID
+		}
+		return cids, nil
+	}
 	entries, err := os.ReadDir(s.dir)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list blobs: %w", err)
@@ -127,6 +183,44 @@ func (s *Store) List() ([]CID, error) {
 	return cids, nil
 }
 
+// Usage returns the number of stored blobs and their total size, in
+// bytes. Partial downloads are not counted; with a backend, its blobs
+// are.
+func (s *Store) Usage() (count int, bytes int64, err error) {
+	if s.remote != nil {
+		objects, err := s.remote.List()
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to measure blobs: %w", err)
+		}
+		for _, o := range objects {
+			bytes += o.Size
+		}
+		return len(objects), bytes, nil
+	}
+	err = filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == "partial" {
+			return filepath.SkipDir
+		}
+		if d.IsDir() || len(d.Name()) != 64 {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		count++
+		bytes += info.Size()
+		return nil
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to measure blobs: %w", err)
+	}
+	return count, bytes, nil
+}
+
 // GarbageCollect removes unreferenced blobs
 // referencedCIDs should contain all CIDs that are still in use
 func (s *Store) GarbageCollect(referencedCIDs map[CID]bool) (int, error) {
@@ -190,5 +284,18 @@ func (s *Store) PutWithSubdir(data []byte) (CID, error) {
 		return "", fmt.Errorf("failed to finalize blob: %w", err)
 	}
 
-	return cid, nil
+	return cid, s.stored(cid)
+}
+
+// stored uploads a blob just written to disk to the backend, if any,
+// and makes room for it in the cache
+func (s *Store) stored(cid CID) error {
+	if s.remote == nil {
+		return nil
+	}
+	if err := s.upload(cid); err != nil {
+		return err
+	}
+	s.trimCache(cid)
+	return nil
 }
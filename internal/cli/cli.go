@@ -0,0 +1,463 @@
+// Package cli is a small command-line framework for the acorde binary:
+// nested commands on top of the standard flag package, global flags that
+// are accepted anywhere on the command line, generated help, and shell
+// completion.
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Command is a command or a group of subcommands
+type Command struct {
+	Name  string
+	Args  string // Positional argument synopsis for help, e.g. "<uuid>"
+	Short string // One-line description
+	Long  string // Optional detail and examples for help
+
+	// Flags registers the command's own flags
+	Flags func(fs *flag.FlagSet)
+
+	// ValidArgs are completion candidates for positional arguments
+	ValidArgs []string
+
+	// Run executes the command. Commands without Run only group
+	// subcommands.
+	Run func(c *Context) error
+
+	Commands []*Command
+	Hidden   bool // Left out of help and completion
+}
+
+// Context is passed to a running command
+type Context struct {
+	App     *App
+	Command *Command
+	Path    []string // Command names from the root, e.g. ["device", "revoke"]
+	Flags   *flag.FlagSet
+	Args    []string // Positional arguments
+}
+
+// NArg returns the number of positional arguments
+func (c *Context) NArg() int {
+	return len(c.Args)
+}
+
+// Arg returns the i'th positional argument, or "" if there is none
+func (c *Context) Arg(i int) string {
+	if i < 0 || i >= len(c.Args) {
+		return ""
+	}
+	return c.Args[i]
+}
+
+// String returns the value of a string flag
+func (c *Context) String(name string) string {
+	s, _ := c.get(name).(string)
+	return s
+}
+
+// Bool returns the value of a bool flag
+func (c *Context) Bool(name string) bool {
+	b, _ := c.get(name).(bool)
+	return b
+}
+
+// Int returns the value of an int flag
+func (c *Context) Int(name string) int {
+	i, _ := c.get(name).(int)
+	return i
+}
+
+// Uint64 returns the value of a uint64 flag
+func (c *Context) Uint64(name string) uint64 {
+	u, _ := c.get(name).(uint64)
+	return u
+}
+
+// Duration returns the value of a duration flag
+func (c *Context) Duration(name string) time.Duration {
+	d, _ := c.get(name).(time.Duration)
+	return d
+}
+
+// IsSet reports whether a flag was given on the command line, in the
+// environment or in the config file
+func (c *Context) IsSet(name string) bool {
+	set := false
+	c.Flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+func (c *Context) get(name string) interface{} {
+	f := c.Flags.Lookup(name)
+	if f == nil {
+		panic(fmt.Sprintf("cli: flag --%s is not defined for %q", name, c.commandLine()))
+	}
+	return f.Value.(flag.Getter).Get()
+}
+
+func (c *Context) commandLine() string {
+	return strings.Join(append([]string{c.App.Name}, c.Path...), " ")
+}
+
+// UsageError reports that a command was invoked incorrectly. The error is
+// printed with a pointer to the command's help.
+type UsageError struct {
+	msg string
+}
+
+func (e *UsageError) Error() string {
+	return e.msg
+}
+
+// Usagef returns a UsageError
+func Usagef(format string, args ...interface{}) error {
+	return &UsageError{msg: fmt.Sprintf(format, args...)}
+}
+
+// App is a command-line program
+type App struct {
+	Name  string
+	Short string
+	Long  string
+
+	// Flags registers global flags, accepted by every command
+	Flags func(fs *flag.FlagSet)
+
+	Commands []*Command
+
+	// ConfigFile returns the path of the config file the command line's
+	// flag defaults are read from (see Config), or "" for none
+	ConfigFile func(c *Context) (string, error)
+
+	// Env maps flag names to environment variables that set them when
+	// they are not given, overriding the config file
+	Env map[string]string
+
+	Stdout io.Writer // Defaults to os.Stdout
+	Stderr io.Writer // Defaults to os.Stderr
+}
+
+// Main runs the app with the process arguments and exits on failure
+func (a *App) Main() {
+	if err := a.Run(os.Args[1:]); err != nil {
+		var usage *UsageError
+		if errors.As(err, &usage) {
+			os.Exit(2)
+		}
+		os.Exit(1)
+	}
+}
+
+// Run parses args (without the program name), runs the selected command
+// and reports errors on Stderr. The error is returned for the exit code.
+func (a *App) Run(args []string) error {
+	root := a.root()
+	if len(args) > 0 && args[0] == completeCommand {
+		for _, candidate := range a.complete(root, args[1:]) {
+			fmt.Fprintln(a.stdout(), candidate)
+		}
+		return nil
+	}
+
+	cmd, path, rest := a.find(root, args)
+
+	fs := a.flagSet(cmd)
+	positional, err := parseInterspersed(fs, rest)
+	if errors.Is(err, flag.ErrHelp) {
+		a.printHelp(cmd, path)
+		return nil
+	}
+	if err != nil {
+		return a.fail(path, Usagef("%v", err))
+	}
+
+	if cmd.Run == nil {
+		if len(positional) > 0 {
+			return a.fail(path, Usagef("unknown command %q for %q", positional[0], a.commandLine(path)))
+		}
+		a.printHelp(cmd, path)
+		if cmd == root {
+			return Usagef("no command given")
+		}
+		return nil
+	}
+
+	ctx := &Context{App: a, Command: cmd, Path: path, Flags: fs, Args: positional}
+	if err := a.setDefaults(ctx); err != nil {
+		return a.fail(path, err)
+	}
+	if err := cmd.Run(ctx); err != nil {
+		return a.fail(path, err)
+	}
+	return nil
+}
+
+// fail prints a command's error
+func (a *App) fail(path []string, err error) error {
+	fmt.Fprintf(a.stderr(), "Error: %v\n", err)
+	var usage *UsageError
+	if errors.As(err, &usage) {
+		fmt.Fprintf(a.stderr(), "Run '%s' for usage.\n", a.commandLine(append([]string{"help"}, path...)))
+	}
+	return err
+}
+
+// root builds the root command, including the built-in commands
+func (a *App) root() *Command {
+	root := &Command{Name: a.Name, Short: a.Short, Long: a.Long}
+	root.Commands = append(root.Commands, a.Commands...)
+	root.Commands = append(root.Commands,
+		&Command{
+			Name:  "help",
+			Args:  "[command]...",
+			Short: "Show help for a command",
+			Run: func(c *Context) error {
+				cmd, path, rest := a.find(root, c.Args)
+				if len(rest) > 0 {
+					return Usagef("unknown command %q for %q", rest[0], a.commandLine(path))
+				}
+				a.printHelp(cmd, path)
+				return nil
+			},
+		},
+		&Command{
+			Name:      "completion",
+			Args:      "<bash|zsh|fish>",
+			Short:     "Print a shell completion script",
+			Long:      completionHelp(a.Name),
+			ValidArgs: []string{"bash", "zsh", "fish"},
+			Run: func(c *Context) error {
+				if c.NArg() != 1 {
+					return Usagef("expected one shell: bash, zsh or fish")
+				}
+				return a.writeCompletion(c.Arg(0))
+			},
+		},
+	)
+	return root
+}
+
+// find walks args down the command tree. It returns the deepest command
+// named, its path from the root, and args without the command names.
+// Flags may come before, between and after command names.
+func (a *App) find(root *Command, args []string) (*Command, []string, []string) {
+	cmd := root
+	var path, rest []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+		if isFlag(arg) {
+			rest = append(rest, arg)
+			if takesValue(a.flagSet(cmd), arg) && i+1 < len(args) {
+				i++
+				rest = append(rest, args[i])
+			}
+			continue
+		}
+		if sub := cmd.sub(arg); sub != nil {
+			cmd = sub
+			path = append(path, arg)
+			continue
+		}
+		// "acorde device help" is a request for the group's help
+		if arg == "help" && len(cmd.Commands) > 0 {
+			rest = append(rest, "-help")
+			continue
+		}
+		// First positional argument: the rest belongs to the command
+		rest = append(rest, args[i:]...)
+		break
+	}
+	return cmd, path, rest
+}
+
+// sub returns the subcommand called name, hidden or not
+func (cmd *Command) sub(name string) *Command {
+	for _, c := range cmd.Commands {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// flagSet returns a flag set holding cmd's flags and the global flags
+func (a *App) flagSet(cmd *Command) *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	if a.Flags != nil {
+		a.Flags(fs)
+	}
+	if cmd.Flags != nil {
+		cmd.Flags(fs)
+	}
+	return fs
+}
+
+// parseInterspersed parses flags anywhere in args, so that both
+// "get --raw <id>" and "get <id> --raw" work. A lone "-" (stdin) is
+// positional, and everything after "--" is.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var flags, positional []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			positional = append(positional, args[i+1:]...)
+			break
+		}
+		if !isFlag(arg) {
+			positional = append(positional, arg)
+			continue
+		}
+		flags = append(flags, arg)
+		if takesValue(fs, arg) && i+1 < len(args) {
+			i++
+			flags = append(flags, args[i])
+		}
+	}
+	if err := fs.Parse(flags); err != nil {
+		return nil, err
+	}
+	return positional, nil
+}
+
+func isFlag(arg string) bool {
+	return len(arg) > 1 && arg[0] == '-'
+}
+
+// takesValue reports whether arg is a flag whose value is the next
+// argument
+func takesValue(fs *flag.FlagSet, arg string) bool {
+	name := strings.TrimLeft(arg, "-")
+	if strings.Contains(name, "=") {
+		return false
+	}
+	f := fs.Lookup(name)
+	return f != nil && !isBoolFlag(f)
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// commandLine joins path to the program name
+func (a *App) commandLine(path []string) string {
+	return strings.Join(append([]string{a.Name}, path...), " ")
+}
+
+// printHelp writes help for cmd
+func (a *App) printHelp(cmd *Command, path []string) {
+	w := a.stdout()
+	if cmd.Short != "" {
+		fmt.Fprintf(w, "%s\n\n", cmd.Short)
+	}
+
+	fmt.Fprintln(w, "Usage:")
+	usage := a.commandLine(path)
+	switch {
+	case cmd.Run == nil:
+		usage += " <command>"
+	default:
+		usage += " [flags]"
+		if cmd.Args != "" {
+			usage += " " + cmd.Args
+		}
+	}
+	fmt.Fprintf(w, "  %s\n", usage)
+
+	if cmd.Long != "" {
+		fmt.Fprintf(w, "\n%s\n", strings.TrimRight(cmd.Long, "\n"))
+	}
+
+	var visible []*Command
+	for _, sub := range cmd.Commands {
+		if !sub.Hidden {
+			visible = append(visible, sub)
+		}
+	}
+	if len(visible) > 0 {
+		fmt.Fprintln(w, "\nCommands:")
+		width := 0
+		for _, sub := range visible {
+			width = max(width, len(sub.Name))
+		}
+		for _, sub := range visible {
+			fmt.Fprintf(w, "  %-*s  %s\n", width, sub.Name, sub.Short)
+		}
+	}
+
+	if cmd.Flags != nil {
+		fs := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+		cmd.Flags(fs)
+		fmt.Fprintln(w, "\nFlags:")
+		printFlags(w, fs)
+	}
+	if a.Flags != nil {
+		fs := flag.NewFlagSet(a.Name, flag.ContinueOnError)
+		a.Flags(fs)
+		fmt.Fprintln(w, "\nGlobal Flags:")
+		printFlags(w, fs)
+	}
+
+	if len(visible) > 0 {
+		fmt.Fprintf(w, "\nRun '%s' for more about a command.\n", a.commandLine(append([]string{"help"}, append(path, "<command>")...)))
+	}
+}
+
+// printFlags lists a flag set's flags, one per line
+func printFlags(w io.Writer, fs *flag.FlagSet) {
+	type line struct{ name, usage string }
+	var lines []line
+	width := 0
+	fs.VisitAll(func(f *flag.Flag) {
+		typeName, usage := flag.UnquoteUsage(f)
+		name := "--" + f.Name
+		if typeName != "" {
+			name += " " + typeName
+		}
+		if f.DefValue != "" && f.DefValue != "false" && f.DefValue != "0" && f.DefValue != "0s" {
+			if typeName == "string" {
+				usage += fmt.Sprintf(" (default %q)", f.DefValue)
+			} else {
+				usage += fmt.Sprintf(" (default %s)", f.DefValue)
+			}
+		}
+		width = max(width, len(name))
+		lines = append(lines, line{name, usage})
+	})
+	sort.Slice(lines, func(i, j int) bool { return lines[i].name < lines[j].name })
+	for _, l := range lines {
+		fmt.Fprintf(w, "  %-*s  %s\n", width, l.name, l.usage)
+	}
+}
+
+func (a *App) stdout() io.Writer {
+	if a.Stdout != nil {
+		return a.Stdout
+	}
+	return os.Stdout
+}
+
+func (a *App) stderr() io.Writer {
+	if a.Stderr != nil {
+		return a.Stderr
+	}
+	return os.Stderr
+}
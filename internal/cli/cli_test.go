@@ -0,0 +1,261 @@
+package cli
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testApp records the context of the command that ran
+func testApp(ran **Context) *App {
+	record := func(c *Context) error {
+		*ran = c
+		return nil
+	}
+	return &App{
+		Name: "acorde",
+		Flags: func(fs *flag.FlagSet) {
+			fs.String("data", "", "Data directory")
+			fs.Bool("json", false, "JSON output")
+		},
+		Commands: []*Command{
+			{
+				Name: "get",
+				Args: "<uuid>",
+				Flags: func(fs *flag.FlagSet) {
+					fs.Bool("raw", false, "Logical times")
+				},
+				Run: record,
+			},
+			{
+				Name: "device",
+				Commands: []*Command{
+					{Name: "list", Run: record},
+					{
+						Name: "revoke",
+						Flags: func(fs *flag.FlagSet) {
+							fs.Int("port", 0, "Port")
+						},
+						Run: record,
+					},
+				},
+			},
+		},
+		Stdout: &bytes.Buffer{},
+		Stderr: &bytes.Buffer{},
+	}
+}
+
+func TestRunParsesFlagsAnywhere(t *testing.T) {
+	var ran *Context
+	app := testApp(&ran)
+
+	for _, args := range [][]string{
+		{"--data", "/tmp/x", "get", "--raw", "abc"},
+		{"get", "abc", "--raw", "--data", "/tmp/x"},
+		{"get", "--data=/tmp/x", "abc", "-raw"},
+	} {
+		ran = nil
+		if err := app.Run(args); err != nil {
+			t.Fatalf("%v: %v", args, err)
+		}
+		if ran == nil || ran.Command.Name != "get" {
+			t.Fatalf("%v: get did not run", args)
+		}
+		if ran.String("data") != "/tmp/x" || !ran.Bool("raw") || ran.Bool("json") {
+			t.Errorf("%v: wrong flags: data=%q raw=%v json=%v", args, ran.String("data"), ran.Bool("raw"), ran.Bool("json"))
+		}
+		if !reflect.DeepEqual(ran.Args, []string{"abc"}) {
+			t.Errorf("%v: expected args [abc], got %v", args, ran.Args)
+		}
+	}
+}
+
+func TestRunNestedCommands(t *testing.T) {
+	var ran *Context
+	app := testApp(&ran)
+
+	if err := app.Run([]string{"device", "--json", "revoke", "--port", "4001", "peer", "-"}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ran.Path, []string{"device", "revoke"}) {
+		t.Errorf("expected path [device revoke], got %v", ran.Path)
+	}
+	if ran.Int("port") != 4001 || !ran.Bool("json") || !ran.IsSet("port") || ran.IsSet("data") {
+		t.Errorf("wrong flags for %v", ran.Path)
+	}
+	if !reflect.DeepEqual(ran.Args, []string{"peer", "-"}) {
+		t.Errorf("expected args [peer -], got %v", ran.Args)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	var ran *Context
+	app := testApp(&ran)
+
+	for _, args := range [][]string{
+		{"nope"},
+		{"device", "nope"},
+		{"get", "--unknown"},
+		{"device", "revoke", "--port", "x"},
+	} {
+		err := app.Run(args)
+		if _, ok := err.(*UsageError); !ok {
+			t.Errorf("%v: expected usage error, got %v", args, err)
+		}
+	}
+	if ran != nil {
+		t.Errorf("no command should have run, got %v", ran.Path)
+	}
+}
+
+func TestHelp(t *testing.T) {
+	var ran *Context
+	app := testApp(&ran)
+	out := app.Stdout.(*bytes.Buffer)
+
+	for _, args := range [][]string{
+		{"help", "device", "revoke"},
+		{"device", "revoke", "--help"},
+		{"device", "revoke", "-h"},
+	} {
+		out.Reset()
+		if err := app.Run(args); err != nil {
+			t.Fatalf("%v: %v", args, err)
+		}
+		help := out.String()
+		for _, want := range []string{"acorde device revoke [flags]", "--port int", "Global Flags:", "--data string"} {
+			if !strings.Contains(help, want) {
+				t.Errorf("%v: help is missing %q:\n%s", args, want, help)
+			}
+		}
+	}
+
+	out.Reset()
+	app.Run([]string{"device", "help"})
+	if help := out.String(); !strings.Contains(help, "Commands:") || !strings.Contains(help, "revoke") {
+		t.Errorf("group help should list subcommands:\n%s", help)
+	}
+}
+
+func TestComplete(t *testing.T) {
+	var ran *Context
+	app := testApp(&ran)
+	root := app.root()
+
+	tests := []struct {
+		words []string
+		want  []string
+	}{
+		{[]string{""}, []string{"get", "device", "help", "completion"}},
+		{[]string{"de"}, []string{"device"}},
+		{[]string{"device", ""}, []string{"list", "revoke"}},
+		{[]string{"--data", "/tmp/x", "device", "r"}, []string{"revoke"}},
+		{[]string{"device", "revoke", "--p"}, []string{"--port"}},
+		{[]string{"get", "--"}, []string{"--data", "--json", "--raw", "--help"}},
+		{[]string{"get", "--data", ""}, nil},
+		{[]string{"completion", "z"}, []string{"zsh"}},
+		{[]string{"nope", ""}, nil},
+	}
+	for _, tt := range tests {
+		if got := app.complete(root, tt.words); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("complete(%q) = %q, want %q", tt.words, got, tt.want)
+		}
+	}
+}
+
+func TestCompletionScripts(t *testing.T) {
+	var ran *Context
+	app := testApp(&ran)
+	out := app.Stdout.(*bytes.Buffer)
+
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		out.Reset()
+		if err := app.Run([]string{"completion", shell}); err != nil {
+			t.Fatalf("%s: %v", shell, err)
+		}
+		if script := out.String(); !strings.Contains(script, "acorde __complete") || strings.Contains(script, "{{") {
+			t.Errorf("%s: unexpected script:\n%s", shell, script)
+		}
+	}
+	if err := app.Run([]string{"completion", "tcsh"}); err == nil {
+		t.Error("expected an error for an unsupported shell")
+	}
+}
+
+func TestConfigDefaults(t *testing.T) {
+	var ran *Context
+	app := testApp(&ran)
+	path := filepath.Join(t.TempDir(), "config.json")
+	app.ConfigFile = func(*Context) (string, error) { return path, nil }
+	app.Env = map[string]string{"data": "ACORDE_TEST_DATA"}
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("missing config file should be empty: %v", err)
+	}
+	for key, value := range map[string]string{"data": "/from/config", "port": "1", "device.revoke.port": "4001", "json": "true"} {
+		typed, err := app.ConfigValue(key, value)
+		if err != nil {
+			t.Fatalf("%s: %v", key, err)
+		}
+		config.Set(key, typed)
+	}
+	if err := config.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := app.Run([]string{"device", "revoke", "--json=false", "peer"}); err != nil {
+		t.Fatal(err)
+	}
+	if ran.String("data") != "/from/config" || ran.Int("port") != 4001 || ran.Bool("json") {
+		t.Errorf("wrong flags: data=%q port=%d json=%v", ran.String("data"), ran.Int("port"), ran.Bool("json"))
+	}
+
+	// The environment overrides the config file, the command line both
+	t.Setenv("ACORDE_TEST_DATA", "/from/env")
+	app.Run([]string{"get", "abc"})
+	if ran.String("data") != "/from/env" || !ran.Bool("json") {
+		t.Errorf("expected data from the environment, got %q", ran.String("data"))
+	}
+	app.Run([]string{"get", "abc", "--data", "/from/flag"})
+	if ran.String("data") != "/from/flag" {
+		t.Errorf("expected data from the command line, got %q", ran.String("data"))
+	}
+
+	if !config.Unset("device.revoke.port") || config.Unset("device.revoke.port") {
+		t.Error("unset should report whether the key was set")
+	}
+	if got := config.Keys(); !reflect.DeepEqual(got, []string{"data", "json", "port"}) {
+		t.Errorf("empty sections should be removed, got keys %v", got)
+	}
+}
+
+func TestConfigValue(t *testing.T) {
+	var ran *Context
+	app := testApp(&ran)
+
+	if v, err := app.ConfigValue("device.revoke.port", "4001"); err != nil || v != 4001 {
+		t.Errorf("expected int 4001, got %v (%v)", v, err)
+	}
+	if v, err := app.ConfigValue("data", "/tmp/x"); err != nil || v != "/tmp/x" {
+		t.Errorf("expected string, got %v (%v)", v, err)
+	}
+	for _, key := range []string{"nope.port", "get.port", "bogus", "device.revoke.port"} {
+		if _, err := app.ConfigValue(key, "x"); err == nil {
+			t.Errorf("%s: expected an error", key)
+		}
+	}
+
+	// A broken value in the config file fails the command
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{"device": {"revoke": {"port": "x"}}}`), 0600)
+	app.ConfigFile = func(*Context) (string, error) { return path, nil }
+	if err := app.Run([]string{"device", "revoke"}); err == nil || !strings.Contains(err.Error(), path) {
+		t.Errorf("expected an error naming the config file, got %v", err)
+	}
+}
@@ -0,0 +1,141 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// completeCommand is the hidden command the completion scripts call with
+// the words typed so far. It prints one candidate per line. Its arguments
+// are not parsed as flags.
+const completeCommand = "__complete"
+
+// complete returns completion candidates for the last of words, which
+// may be empty. No candidates lets the shell fall back to file names.
+func (a *App) complete(root *Command, words []string) []string {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	typed, partial := words[:len(words)-1], words[len(words)-1]
+
+	cmd, _, rest := a.find(root, typed)
+	fs := a.flagSet(cmd)
+
+	// The value of a flag: nothing to suggest
+	if len(rest) > 0 {
+		if last := rest[len(rest)-1]; isFlag(last) && takesValue(fs, last) {
+			return nil
+		}
+	}
+
+	var candidates []string
+	switch {
+	case strings.HasPrefix(partial, "-"):
+		fs.VisitAll(func(f *flag.Flag) {
+			candidates = append(candidates, "--"+f.Name)
+		})
+		candidates = append(candidates, "--help")
+	case len(cmd.Commands) > 0 && !hasPositional(fs, rest):
+		for _, sub := range cmd.Commands {
+			if !sub.Hidden {
+				candidates = append(candidates, sub.Name)
+			}
+		}
+	default:
+		candidates = cmd.ValidArgs
+	}
+
+	var matches []string
+	for _, c := range candidates {
+		if strings.HasPrefix(c, partial) {
+			matches = append(matches, c)
+		}
+	}
+	return matches
+}
+
+// hasPositional reports whether args hold a positional argument
+func hasPositional(fs *flag.FlagSet, args []string) bool {
+	for i := 0; i < len(args); i++ {
+		if !isFlag(args[i]) {
+			return true
+		}
+		if takesValue(fs, args[i]) {
+			i++
+		}
+	}
+	return false
+}
+
+// writeCompletion prints the completion script for shell
+func (a *App) writeCompletion(shell string) error {
+	var script string
+	switch shell {
+	case "bash":
+		script = bashCompletion
+	case "zsh":
+		script = zshCompletion
+	case "fish":
+		script = fishCompletion
+	default:
+		return Usagef("unsupported shell %q (use bash, zsh or fish)", shell)
+	}
+	script = strings.NewReplacer("{{name}}", a.Name, "{{func}}", funcName(a.Name), "{{complete}}", completeCommand).Replace(script)
+	_, err := fmt.Fprint(a.stdout(), script)
+	return err
+}
+
+// funcName makes a program name usable in a shell function name
+func funcName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == '.' {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+func completionHelp(name string) string {
+	return fmt.Sprintf(`Load completions in the current shell:
+  bash:  source <(%[1]s completion bash)
+  zsh:   source <(%[1]s completion zsh)
+  fish:  %[1]s completion fish | source
+
+To load them for every session, add the line to ~/.bashrc or ~/.zshrc,
+or save the fish script as ~/.config/fish/completions/%[1]s.fish.`, name)
+}
+
+const bashCompletion = `# bash completion for {{name}}
+_{{func}}() {
+    local IFS=$'\n'
+    COMPREPLY=( $({{name}} {{complete}} "${COMP_WORDS[@]:1:$COMP_CWORD}" 2>/dev/null) )
+}
+complete -o default -F _{{func}} {{name}}
+`
+
+const zshCompletion = `#compdef {{name}}
+# zsh completion for {{name}}
+_{{func}}() {
+    local -a candidates
+    candidates=("${(@f)$({{name}} {{complete}} "${(@)words[2,$CURRENT]}" 2>/dev/null)}")
+    if [[ -n "${candidates[1]}" ]]; then
+        compadd -a candidates
+    else
+        _files
+    fi
+}
+if [[ "${funcstack[1]}" == "_{{func}}" ]]; then
+    _{{func}} "$@"
+else
+    compdef _{{func}} {{name}}
+fi
+`
+
+const fishCompletion = `# fish completion for {{name}}
+function __{{func}}_complete
+    set -l words (commandline -opc)[2..-1] (commandline -ct)
+    {{name}} {{complete}} $words 2>/dev/null
+end
+complete -c {{name}} -a '(__{{func}}_complete)'
+`
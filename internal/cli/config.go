@@ -0,0 +1,264 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Config is a JSON file of flag defaults. Top-level values apply to every
+// command with a flag of that name; objects are sections named after a
+// command, whose values take precedence for it and its subcommands:
+//
+//	{"data": "~/notes", "daemon": {"port": 4001, "dht": true}}
+//
+// Keys name settings with dots, e.g. "data" or "daemon.port".
+type Config struct {
+	Path   string
+	values map[string]interface{}
+}
+
+// LoadConfig reads the config file at path. A missing file is an empty
+// config.
+func LoadConfig(path string) (*Config, error) {
+	c := &Config{Path: path, values: map[string]interface{}{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&c.values); err != nil {
+		return nil, fmt.Errorf("config %s: %w", path, err)
+	}
+	if c.values == nil {
+		c.values = map[string]interface{}{}
+	}
+	return c, nil
+}
+
+// Lookup returns the value of a flag for the command at path, from the
+// most specific section that sets it
+func (c *Config) Lookup(path []string, name string) (string, bool) {
+	for i := len(path); i >= 0; i-- {
+		section := c.section(path[:i], false)
+		if v, ok := section[name]; ok {
+			if s, ok := scalar(v); ok {
+				return s, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Settings returns every value by key
+func (c *Config) Settings() map[string]string {
+	out := make(map[string]string)
+	var walk func(prefix string, m map[string]interface{})
+	walk = func(prefix string, m map[string]interface{}) {
+		for k, v := range m {
+			if sub, ok := v.(map[string]interface{}); ok {
+				walk(prefix+k+".", sub)
+			} else if s, ok := scalar(v); ok {
+				out[prefix+k] = s
+			}
+		}
+	}
+	walk("", c.values)
+	return out
+}
+
+// Keys returns the keys of every value, sorted
+func (c *Config) Keys() []string {
+	settings := c.Settings()
+	keys := make([]string, 0, len(settings))
+	for k := range settings {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Set sets the value of a key, creating its sections. value is a string,
+// bool or number (see App.ConfigValue).
+func (c *Config) Set(key string, value interface{}) {
+	path, name := splitKey(key)
+	c.section(path, true)[name] = value
+}
+
+// Unset removes a key, and the sections it leaves empty. It reports
+// whether the key was set.
+func (c *Config) Unset(key string) bool {
+	path, name := splitKey(key)
+	section := c.section(path, false)
+	if _, ok := section[name]; !ok {
+		return false
+	}
+	delete(section, name)
+	for i := len(path); i > 0 && len(c.section(path[:i], false)) == 0; i-- {
+		delete(c.section(path[:i-1], false), path[i-1])
+	}
+	return true
+}
+
+// Save writes the config file atomically, readable only by the user (it
+// may hold the API token)
+func (c *Config) Save() error {
+	data, err := json.MarshalIndent(c.values, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.Path), 0700); err != nil {
+		return err
+	}
+	tmp := c.Path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.Path)
+}
+
+// section returns the section at path, or nil if there is none and create
+// is false
+func (c *Config) section(path []string, create bool) map[string]interface{} {
+	m := c.values
+	for _, name := range path {
+		sub, ok := m[name].(map[string]interface{})
+		if !ok {
+			if !create {
+				return nil
+			}
+			sub = map[string]interface{}{}
+			m[name] = sub
+		}
+		m = sub
+	}
+	return m
+}
+
+// splitKey splits "daemon.port" into its section path and flag name
+func splitKey(key string) ([]string, string) {
+	parts := strings.Split(key, ".")
+	return parts[:len(parts)-1], parts[len(parts)-1]
+}
+
+func scalar(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case bool:
+		return strconv.FormatBool(v), true
+	case json.Number:
+		return v.String(), true
+	case int, int64, uint, uint64, float64:
+		return fmt.Sprint(v), true
+	}
+	return "", false
+}
+
+// setDefaults sets the flags not given on the command line from the
+// environment (App.Env), then from the config file (App.ConfigFile)
+func (a *App) setDefaults(c *Context) error {
+	var config *Config
+	if a.ConfigFile != nil {
+		path, err := a.ConfigFile(c)
+		if err != nil {
+			return err
+		}
+		if path != "" {
+			if config, err = LoadConfig(path); err != nil {
+				return err
+			}
+		}
+	}
+
+	given := make(map[string]bool)
+	c.Flags.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+	var errs []error
+	c.Flags.VisitAll(func(f *flag.Flag) {
+		if given[f.Name] {
+			return
+		}
+		var value, source string
+		if env := a.Env[f.Name]; env != "" && os.Getenv(env) != "" {
+			value, source = os.Getenv(env), "$"+env
+		} else if v, ok := config.lookup(c.Path, f.Name); ok {
+			value, source = v, config.Path
+		} else {
+			return
+		}
+		if err := c.Flags.Set(f.Name, value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: --%s: %v", source, f.Name, err))
+		}
+	})
+	return errors.Join(errs...)
+}
+
+// lookup is Lookup on a possibly nil config
+func (c *Config) lookup(path []string, name string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	return c.Lookup(path, name)
+}
+
+// ConfigValue checks a config file setting against the flags of the
+// commands it applies to, and returns the value typed like the flag, for
+// Config.Set
+func (a *App) ConfigValue(key, value string) (interface{}, error) {
+	path, name := splitKey(key)
+	root := a.root()
+	cmd, found, _ := a.find(root, path)
+	if len(found) != len(path) || name == "" {
+		return nil, fmt.Errorf("%s: no command %q", key, a.commandLine(path))
+	}
+
+	var typed interface{}
+	var err error
+	known := false
+	walkCommands(cmd, func(c *Command) {
+		fs := a.flagSet(c)
+		if known || fs.Lookup(name) == nil {
+			return
+		}
+		known = true
+		if err = fs.Set(name, value); err != nil {
+			return
+		}
+		switch v := fs.Lookup(name).Value.(flag.Getter).Get().(type) {
+		case bool, int, int64, uint, uint64, float64:
+			typed = v
+		default:
+			typed = value
+		}
+	})
+	if !known {
+		return nil, fmt.Errorf("%s: no flag --%s for %q", key, name, a.commandLine(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid value %q for --%s: %v", key, value, name, err)
+	}
+	return typed, nil
+}
+
+// walkCommands calls fn for cmd and each of its subcommands
+func walkCommands(cmd *Command, fn func(*Command)) {
+	fn(cmd)
+	for _, sub := range cmd.Commands {
+		walkCommands(sub, fn)
+	}
+}
@@ -2,13 +2,18 @@ package core
 
 import (
 	"sync"
+	"time"
 )
 
-// Clock implements a Lamport logical clock
+// Clock implements a Lamport logical clock, or a hybrid logical clock
+// (see NewHybridClock)
 // It provides monotonically increasing timestamps for causality tracking
 type Clock struct {
 	mu   sync.Mutex
 	time uint64
+
+	hybrid bool             // Ticks never fall behind the wall clock
+	wall   func() time.Time // Wall clock source (hybrid only)
 }
 
 // NewClock creates a new Lamport clock starting at 0
@@ -28,6 +33,7 @@ func (c *Clock) Tick() uint64 {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	c.time++
+	c.catchUp()
 	return c.time
 }
 
@@ -41,6 +47,19 @@ func (c *Clock) Update(remoteTime uint64) uint64 {
 		c.time = remoteTime
 	}
 	c.time++
+	c.catchUp()
+	return c.time
+}
+
+// Witness advances the clock to at least remoteTime without incrementing
+// Sets local time to max(local, remote)
+// Used when merging state, so that merge stays idempotent and commutative
+func (c *Clock) Witness(remoteTime uint64) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if remoteTime > c.time {
+		c.time = remoteTime
+	}
 	return c.time
 }
 
@@ -50,3 +69,15 @@ func (c *Clock) Now() uint64 {
 	defer c.mu.Unlock()
 	return c.time
 }
+
+// Hybrid reports whether this is a hybrid logical clock
+func (c *Clock) Hybrid() bool {
+	return c.hybrid
+}
+
+// Copy returns an independent clock of the same kind at the same time
+func (c *Clock) Copy() *Clock {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return &Clock{time: c.time, hybrid: c.hybrid, wall: c.wall}
+}
@@ -75,6 +75,19 @@ func TestUpdate(t *testing.T) {
 	}
 }
 
+func TestWitness(t *testing.T) {
+	c := NewClockWithTime(5)
+	if got := c.Witness(10); got != 10 {
+		t.Errorf("expected 10, got %d", got)
+	}
+	if got := c.Witness(10); got != 10 {
+		t.Errorf("expected witnessing the same time to keep 10, got %d", got)
+	}
+	if got := c.Witness(3); got != 10 {
+		t.Errorf("expected an older time to keep 10, got %d", got)
+	}
+}
+
 func TestClockConcurrency(t *testing.T) {
 	c := NewClock()
 	var wg sync.WaitGroup
@@ -1,6 +1,8 @@
 package core
 
 import (
+	"time"
+
 	"github.com/google/uuid"
 )
 
@@ -12,14 +14,35 @@ const (
 	Log   EntryType = "log"
 	File  EntryType = "file"
 	Event EntryType = "event"
+
+	// Config entries hold vault configuration, such as auto-tagging
+	// rules, that syncs like any other entry
+	Config EntryType = "config"
+
+	// Credential entries hold logins, validated against
+	// schema.CredentialSchema; their secrets are masked for display
+	Credential EntryType = "credential"
+
+	// Task, Contact and Bookmark entries are validated against the
+	// built-in schemas when the engine registers them
+	// (Config.BuiltinSchemas)
+	Task     EntryType = "task"
+	Contact  EntryType = "contact"
+	Bookmark EntryType = "bookmark"
 )
 
 // ValidEntryTypes contains all valid entry types for validation
 var ValidEntryTypes = map[EntryType]bool{
-	Note:  true,
-	Log:   true,
-	File:  true,
-	Event: true,
+	Note:   true,
+	Log:    true,
+	File:   true,
+	Event:  true,
+	Config: true,
+
+	Credential: true,
+	Task:       true,
+	Contact:    true,
+	Bookmark:   true,
 }
 
 // IsValid checks if the entry type is valid
@@ -34,9 +57,41 @@ type Entry struct {
 	Type      EntryType `json:"type"`
 	Content   []byte    `json:"content"` // Opaque to acorde
 	Tags      []string  `json:"tags"`
-	CreatedAt uint64    `json:"created_at"` // Logical time (Lamport)
-	UpdatedAt uint64    `json:"updated_at"` // Logical time (Lamport)
+	CreatedAt uint64    `json:"created_at"` // Logical time (Lamport or HLC)
+	UpdatedAt uint64    `json:"updated_at"` // Logical time (Lamport or HLC)
 	Deleted   bool      `json:"deleted"`    // Tombstone for CRDT
+
+	// Archived entries are hidden from default lists and search but kept
+	// and synced. ArchivedAt is the logical time of the last archive or
+	// unarchive: the flag is its own LWW register, independent of edits.
+	Archived   bool   `json:"archived,omitempty"`
+	ArchivedAt uint64 `json:"archived_at,omitempty"`
+
+	// Collection is the ID of the collection the entry is filed in
+	// (uuid.Nil = none). Like the archive flag it is its own LWW register,
+	// with CollectionAt the logical time of the last move.
+	Collection   uuid.UUID `json:"collection,omitzero"`
+	CollectionAt uint64    `json:"collection_at,omitempty"`
+
+	// Wall-clock times (Unix milliseconds) on the device that made the
+	// change. For display only: ordering always uses CreatedAt/UpdatedAt.
+	CreatedTime int64 `json:"created_time,omitempty"`
+	UpdatedTime int64 `json:"updated_time,omitempty"`
+
+	// SchemaVersion is the version of its type's schema the content was
+	// written against (0 = unknown: no versioned schema at the time). It
+	// changes with the content, and wins or loses with it in merges.
+	SchemaVersion int `json:"schema_version,omitempty"`
+
+	// Author is the peer ID of the device that made the last change to
+	// the content, tags or deletion ("" = unknown, e.g. written before
+	// authors were recorded). Merges check it against the entry's ACL.
+	Author string `json:"author,omitempty"`
+
+	// Namespace partitions a vault shared by several tenants ("" = the
+	// default namespace). It is set when the entry is created and never
+	// changes.
+	Namespace string `json:"namespace,omitempty"`
 }
 
 // NewEntry creates a new entry with the given parameters
@@ -46,15 +101,37 @@ func NewEntry(entryType EntryType, content []byte, tags []string, clockTime uint
 		tags = []string{}
 	}
 	
+	now := time.Now().UnixMilli()
 	return Entry{
-		ID:        uuid.New(),
-		Type:      entryType,
-		Content:   content,
-		Tags:      tags,
-		CreatedAt: clockTime,
-		UpdatedAt: clockTime,
-		Deleted:   false,
+		ID:          uuid.New(),
+		Type:        entryType,
+		Content:     content,
+		Tags:        tags,
+		CreatedAt:   clockTime,
+		UpdatedAt:   clockTime,
+		Deleted:     false,
+		CreatedTime: now,
+		UpdatedTime: now,
+	}
+}
+
+// Created returns when the entry was created, from its wall-clock time or
+// its HLC timestamp (zero if neither is known)
+func (e Entry) Created() time.Time {
+	return displayTime(e.CreatedTime, e.CreatedAt)
+}
+
+// Updated returns when the entry was last changed (see Created)
+func (e Entry) Updated() time.Time {
+	return displayTime(e.UpdatedTime, e.UpdatedAt)
+}
+
+// displayTime prefers a recorded wall time over one derived from ts
+func displayTime(wallMillis int64, ts uint64) time.Time {
+	if wallMillis != 0 {
+		return time.UnixMilli(wallMillis)
 	}
+	return WallTime(ts)
 }
 
 // Clone creates a deep copy of the entry
@@ -66,13 +143,23 @@ func (e Entry) Clone() Entry {
 	copy(tagsCopy, e.Tags)
 	
 	return Entry{
-		ID:        e.ID,
-		Type:      e.Type,
-		Content:   contentCopy,
-		Tags:      tagsCopy,
-		CreatedAt: e.CreatedAt,
-		UpdatedAt: e.UpdatedAt,
-		Deleted:   e.Deleted,
+		ID:          e.ID,
+		Type:        e.Type,
+		Content:     contentCopy,
+		Tags:        tagsCopy,
+		CreatedAt:   e.CreatedAt,
+		UpdatedAt:   e.UpdatedAt,
+		Deleted:     e.Deleted,
+		Archived:    e.Archived,
+		ArchivedAt:  e.ArchivedAt,
+		CreatedTime: e.CreatedTime,
+		UpdatedTime: e.UpdatedTime,
+
+		SchemaVersion: e.SchemaVersion,
+		Author:        e.Author,
+		Collection:    e.Collection,
+		CollectionAt:  e.CollectionAt,
+		Namespace:     e.Namespace,
 	}
 }
 
@@ -84,6 +171,17 @@ type ACL struct {
 	Writers   []string  `json:"writers,omitempty"`  // PeerIDs with write access
 	Public    bool      `json:"public"`              // Anyone can read
 	Timestamp uint64    `json:"timestamp"`          // Logical time for LWW resolution
+
+	// Per-entry sharing: content is encrypted with its own entry key,
+	// wrapped for each reader via X25519 with the owner's device key
+	OwnerKey  []byte            `json:"owner_key,omitempty"`  // Owner's X25519 device public key
+	SealedKey []byte            `json:"sealed_key,omitempty"` // Entry key sealed with the owner's vault key
+	Keys      map[string][]byte `json:"keys,omitempty"`       // PeerID → wrapped entry key
+}
+
+// IsShared reports whether the entry is encrypted with its own entry key
+func (a ACL) IsShared() bool {
+	return len(a.OwnerKey) > 0
 }
 
 // Clone creates a deep copy of the ACL
@@ -92,6 +190,13 @@ func (a ACL) Clone() ACL {
 	copy(readers, a.Readers)
 	writers := make([]string, len(a.Writers))
 	copy(writers, a.Writers)
+	var keys map[string][]byte
+	if a.Keys != nil {
+		keys = make(map[string][]byte, len(a.Keys))
+		for peerID, key := range a.Keys {
+			keys[peerID] = key
+		}
+	}
 
 	return ACL{
 		EntryID:   a.EntryID,
@@ -100,5 +205,26 @@ func (a ACL) Clone() ACL {
 		Writers:   writers,
 		Public:    a.Public,
 		Timestamp: a.Timestamp,
+		OwnerKey:  a.OwnerKey,
+		SealedKey: a.SealedKey,
+		Keys:      keys,
+	}
+}
+
+// Ack records that a peer has received an entry. Each peer acknowledges
+// only its own receipts, and only the newest version it has seen is kept.
+type Ack struct {
+	EntryID    uuid.UUID `json:"entry_id"`
+	Peer       string    `json:"peer"`        // PeerID of the receiving device
+	Version    uint64    `json:"version"`     // UpdatedAt of the received entry
+	Timestamp  uint64    `json:"timestamp"`   // Lamport time of the ack itself
+	ReceivedAt int64     `json:"received_at"` // Wall clock (Unix seconds)
+}
+
+// Supersedes reports whether a replaces b for the same entry and peer
+func (a Ack) Supersedes(b Ack) bool {
+	if a.Version != b.Version {
+		return a.Version > b.Version
 	}
+	return a.Timestamp > b.Timestamp
 }
@@ -15,6 +15,7 @@ func TestEntryTypeIsValid(t *testing.T) {
 		{Log, true},
 		{File, true},
 		{Event, true},
+		{Config, true},
 		{EntryType("invalid"), false},
 		{EntryType(""), false},
 	}
@@ -0,0 +1,76 @@
+package core
+
+import (
+	"fmt"
+	"time"
+)
+
+// A hybrid logical clock (HLC) timestamp packs wall time in milliseconds
+// into the high 48 bits and a logical counter into the low 16. Timestamps
+// stay plain uint64s ordered like Lamport times, so LWW comparisons are
+// unchanged, but they track real time across devices and can be shown to
+// humans. Lamport timestamps are far smaller than any HLC timestamp, so a
+// Lamport replica witnessing HLC times keeps causality.
+const hlcCounterBits = 16
+
+// hlcMinWall is the earliest wall time an HLC timestamp can carry
+// (2000-01-01). Smaller timestamps are Lamport times.
+var hlcMinWall = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// ClockKind selects the clock an engine stamps changes with
+type ClockKind string
+
+const (
+	ClockLamport ClockKind = "lamport" // Pure logical counter (default)
+	ClockHybrid  ClockKind = "hybrid"  // Wall time plus logical counter
+)
+
+// ParseClockKind validates a clock kind ("" means Lamport)
+func ParseClockKind(s string) (ClockKind, error) {
+	switch ClockKind(s) {
+	case "", ClockLamport:
+		return ClockLamport, nil
+	case ClockHybrid:
+		return ClockHybrid, nil
+	}
+	return "", fmt.Errorf("unknown clock %q (want %q or %q)", s, ClockLamport, ClockHybrid)
+}
+
+// NewClockOfKind creates a clock of the given kind with an initial time
+func NewClockOfKind(kind ClockKind, initialTime uint64) *Clock {
+	if kind == ClockHybrid {
+		return NewHybridClock(initialTime)
+	}
+	return NewClockWithTime(initialTime)
+}
+
+// NewHybridClock creates a hybrid logical clock with an initial time.
+// Every tick is at least the current wall time, and otherwise behaves
+// like a Lamport tick.
+func NewHybridClock(initialTime uint64) *Clock {
+	return &Clock{time: initialTime, hybrid: true, wall: time.Now}
+}
+
+// HLCTimestamp returns the first HLC timestamp at wall time t
+func HLCTimestamp(t time.Time) uint64 {
+	return uint64(t.UnixMilli()) << hlcCounterBits
+}
+
+// WallTime returns the wall time carried by an HLC timestamp, or the zero
+// time for a Lamport timestamp
+func WallTime(ts uint64) time.Time {
+	if ts < HLCTimestamp(hlcMinWall) {
+		return time.Time{}
+	}
+	return time.UnixMilli(int64(ts >> hlcCounterBits))
+}
+
+// catchUp moves a hybrid clock forward to the wall clock. Caller holds c.mu.
+func (c *Clock) catchUp() {
+	if !c.hybrid {
+		return
+	}
+	if now := HLCTimestamp(c.wall()); now > c.time {
+		c.time = now
+	}
+}
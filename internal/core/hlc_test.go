@@ -0,0 +1,77 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHybridClock(t *testing.T) {
+	wall := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	c := NewHybridClock(0)
+	c.wall = func() time.Time { return wall }
+
+	t1 := c.Tick()
+	if t1 != HLCTimestamp(wall) {
+		t.Fatalf("expected first tick at wall time, got %d", t1)
+	}
+
+	// Same millisecond: the counter advances
+	if t2 := c.Tick(); t2 != t1+1 {
+		t.Errorf("expected counter tick %d, got %d", t1+1, t2)
+	}
+
+	// Wall time moves on: the counter resets
+	wall = wall.Add(time.Second)
+	if t3 := c.Tick(); t3 != HLCTimestamp(wall) {
+		t.Errorf("expected tick at new wall time, got %d", t3)
+	}
+
+	// A remote clock ahead of ours is followed, not the lagging wall clock
+	ahead := HLCTimestamp(wall.Add(time.Minute)) + 5
+	if got := c.Update(ahead); got != ahead+1 {
+		t.Errorf("expected %d after update, got %d", ahead+1, got)
+	}
+	if got := c.Tick(); got != ahead+2 {
+		t.Errorf("expected %d, got %d", ahead+2, got)
+	}
+
+	if !c.Copy().Hybrid() {
+		t.Error("copy of a hybrid clock should be hybrid")
+	}
+}
+
+func TestHybridClockFromLamport(t *testing.T) {
+	// A vault switching from Lamport timestamps jumps to wall time
+	c := NewHybridClock(42)
+	if ts := c.Tick(); ts <= 42 || WallTime(ts).IsZero() {
+		t.Errorf("expected HLC timestamp after Lamport time 42, got %d", ts)
+	}
+
+	// A Lamport clock witnessing HLC times stays ahead of them
+	l := NewClock()
+	remote := HLCTimestamp(time.Now())
+	if got := l.Update(remote); got != remote+1 {
+		t.Errorf("expected %d, got %d", remote+1, got)
+	}
+}
+
+func TestWallTime(t *testing.T) {
+	wall := time.UnixMilli(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC).UnixMilli())
+	if got := WallTime(HLCTimestamp(wall) + 3); !got.Equal(wall) {
+		t.Errorf("expected %v, got %v", wall, got)
+	}
+	if got := WallTime(1000); !got.IsZero() {
+		t.Errorf("expected zero time for Lamport timestamp, got %v", got)
+	}
+}
+
+func TestParseClockKind(t *testing.T) {
+	for in, want := range map[string]ClockKind{"": ClockLamport, "lamport": ClockLamport, "hybrid": ClockHybrid} {
+		if got, err := ParseClockKind(in); err != nil || got != want {
+			t.Errorf("ParseClockKind(%q) = %q, %v", in, got, err)
+		}
+	}
+	if _, err := ParseClockKind("vector"); err == nil {
+		t.Error("expected error for unknown clock")
+	}
+}
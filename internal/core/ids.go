@@ -0,0 +1,86 @@
+package core
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// IDKind selects how an engine generates the IDs of new entries. Every
+// kind is a 128-bit value in UUID form, so vaults can mix them: existing
+// IDs never change.
+type IDKind string
+
+const (
+	IDRandom IDKind = "uuid4" // Random UUIDv4 (default)
+	IDTime   IDKind = "uuid7" // UUIDv7: millisecond time, then random bits
+	IDULID   IDKind = "ulid"  // ULID layout: millisecond time, then 80 random bits
+)
+
+// ParseIDKind validates an ID kind ("" means IDRandom)
+func ParseIDKind(s string) (IDKind, error) {
+	switch IDKind(s) {
+	case "", IDRandom:
+		return IDRandom, nil
+	case IDTime, IDULID:
+		return IDKind(s), nil
+	}
+	return "", fmt.Errorf("unknown ID kind %q (want %q, %q or %q)", s, IDRandom, IDTime, IDULID)
+}
+
+// NewIDGenerator returns a function generating IDs of the given kind.
+// Time-ordered IDs sort by creation time, also within a millisecond.
+func NewIDGenerator(kind IDKind) func() uuid.UUID {
+	switch kind {
+	case IDTime:
+		return func() uuid.UUID {
+			id, err := uuid.NewV7()
+			if err != nil {
+				return uuid.New()
+			}
+			return id
+		}
+	case IDULID:
+		return newULIDGenerator()
+	}
+	return uuid.New
+}
+
+// newULIDGenerator returns a monotonic ULID generator: an ID made in the
+// same millisecond as the last one is its random part plus one
+func newULIDGenerator() func() uuid.UUID {
+	var mu sync.Mutex
+	var last uuid.UUID
+	var lastMs uint64
+	return func() uuid.UUID {
+		mu.Lock()
+		defer mu.Unlock()
+
+		ms := uint64(time.Now().UnixMilli())
+		var id uuid.UUID
+		if ms <= lastMs {
+			// Same millisecond (or the wall clock went back): count up
+			id = last
+			for i := len(id) - 1; i >= 6; i-- {
+				id[i]++
+				if id[i] != 0 {
+					break
+				}
+			}
+		} else {
+			var stamp [8]byte
+			binary.BigEndian.PutUint64(stamp[:], ms)
+			copy(id[:6], stamp[2:])
+			if _, err := rand.Read(id[6:]); err != nil {
+				return uuid.New()
+			}
+			lastMs = ms
+		}
+		last = id
+		return id
+	}
+}
@@ -0,0 +1,27 @@
+package core
+
+import (
+	"testing"
+)
+
+func TestIDGenerators(t *testing.T) {
+	if _, err := ParseIDKind("snowflake"); err == nil {
+		t.Error("expected an unknown ID kind to fail")
+	}
+	if kind, _ := ParseIDKind(""); kind != IDRandom {
+		t.Errorf("expected the default to be %q, got %q", IDRandom, kind)
+	}
+
+	// Time-ordered IDs sort in creation order, also within a millisecond
+	for _, kind := range []IDKind{IDTime, IDULID} {
+		next := NewIDGenerator(kind)
+		prev := next()
+		for i := 0; i < 1000; i++ {
+			id := next()
+			if id.String() <= prev.String() {
+				t.Fatalf("%s: %s generated after %s", kind, id, prev)
+			}
+			prev = id
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package crdt
+
+import (
+	"github.com/amaydixit11/acorde/internal/core"
+	"github.com/google/uuid"
+)
+
+// Lazy loading: a replica with a Loader starts without entries and
+// hydrates them from durable storage as they are needed, one at a time
+// when an entry is read, changed or merged, and all at once the first
+// time the whole set is (listing, state for sync, cloning). ACLs and acks
+// are small and are still hydrated up front by the caller.
+
+// Loader reads entries from durable storage for a lazy replica. Entry
+// returns an entry (or its tombstone) by ID, false if storage has none;
+// All returns every entry, tombstones included. After an error from All
+// the replica stays lazy and tries again when next needed.
+type Loader struct {
+	Entry func(id uuid.UUID) (core.Entry, bool)
+	All   func() ([]core.Entry, error)
+}
+
+// SetLoader makes the replica lazy: entries it does not hold are loaded
+// with loader when first needed, instead of hydrated at startup
+func (r *Replica) SetLoader(loader Loader) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.loader = &loader
+}
+
+// Hydrated reports whether the replica holds every entry: it is not lazy,
+// or has loaded them all
+func (r *Replica) Hydrated() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.loader == nil
+}
+
+// Peek returns an entry (or its tombstone) with its tags like
+// GetEntryWithDeleted, reading entries a lazy replica has not loaded
+// from storage without loading them
+func (r *Replica) Peek(id uuid.UUID) (core.Entry, bool) {
+	r.mu.RLock()
+	if _, ok := r.entries.LookupWithDeleted(id); ok || r.loader == nil {
+		defer r.mu.RUnlock()
+		if !ok {
+			return core.Entry{}, false
+		}
+		return r.getEntryWithTags(id), true
+	}
+	loader := r.loader
+	r.mu.RUnlock()
+	return loader.Entry(id)
+}
+
+// load hydrates entries a lazy replica does not hold yet. Storage is
+// read without r.mu held; entries loaded or added meanwhile are kept.
+func (r *Replica) load(ids ...uuid.UUID) {
+	r.mu.RLock()
+	loader := r.loader
+	var missing []uuid.UUID
+	if loader != nil {
+		for _, id := range ids {
+			if _, ok := r.entries.LookupWithDeleted(id); !ok {
+				missing = append(missing, id)
+			}
+		}
+	}
+	r.mu.RUnlock()
+	if len(missing) == 0 {
+		return
+	}
+
+	var found []core.Entry
+	for _, id := range missing {
+		if entry, ok := loader.Entry(id); ok {
+			found = append(found, entry)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, entry := range found {
+		r.hydrateMissing(entry)
+	}
+}
+
+// loadAll hydrates every entry of a lazy replica, which stops being lazy
+func (r *Replica) loadAll() {
+	r.mu.RLock()
+	loader := r.loader
+	r.mu.RUnlock()
+	if loader == nil {
+		return
+	}
+
+	entries, err := loader.All()
+	if err != nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.loader == nil {
+		return // Another goroutine got there first
+	}
+	for _, entry := range entries {
+		r.hydrateMissing(entry)
+	}
+	r.loader = nil
+}
+
+// hydrateMissing hydrates an entry from storage unless the replica holds
+// it already (and so a version at least as new). r.mu must be held.
+func (r *Replica) hydrateMissing(entry core.Entry) {
+	if _, ok := r.entries.LookupWithDeleted(entry.ID); ok {
+		return
+	}
+	r.hydrate(entry)
+}
+
+// ids returns the IDs of the entries and tag sets the replica holds
+func (r *Replica) ids() []uuid.UUID {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	elements := r.entries.AllElements()
+	ids := make([]uuid.UUID, 0, len(elements)+len(r.tags))
+	for _, elem := range elements {
+		ids = append(ids, elem.Entry.ID)
+	}
+	for id := range r.tags {
+		ids = append(ids, id)
+	}
+	return ids
+}
@@ -7,6 +7,9 @@
 package crdt
 
 import (
+	"cmp"
+	"strings"
+
 	"github.com/amaydixit11/acorde/internal/core"
 	"github.com/google/uuid"
 )
@@ -47,18 +50,78 @@ func (s *LWWSet) Add(entry core.Entry) {
 			Deleted:   entry.Deleted,
 		}
 	}
+	s.mergeArchive(entry)
+	s.mergeCollection(entry)
+}
+
+// mergeArchive folds the archive register of entry into its element. The
+// register is independent of the element's timestamp: the later
+// ArchivedAt wins, archived on a tie.
+func (s *LWWSet) mergeArchive(entry core.Entry) {
+	elem, exists := s.elements[entry.ID]
+	if !exists {
+		return
+	}
+	if entry.ArchivedAt > elem.Entry.ArchivedAt ||
+		(entry.ArchivedAt == elem.Entry.ArchivedAt && entry.Archived && !elem.Entry.Archived) {
+		elem.Entry.Archived = entry.Archived
+		elem.Entry.ArchivedAt = entry.ArchivedAt
+		s.elements[entry.ID] = elem
+	}
+}
+
+// SetArchived sets the archive register of an element at the given
+// timestamp. Returns false if the element does not exist.
+func (s *LWWSet) SetArchived(id uuid.UUID, archived bool, timestamp uint64) bool {
+	if _, exists := s.elements[id]; !exists {
+		return false
+	}
+	s.mergeArchive(core.Entry{ID: id, Archived: archived, ArchivedAt: timestamp})
+	return true
+}
+
+// mergeCollection folds the collection register of entry into its
+// element: the later CollectionAt wins, the greater collection ID on a tie.
+func (s *LWWSet) mergeCollection(entry core.Entry) {
+	elem, exists := s.elements[entry.ID]
+	if !exists {
+		return
+	}
+	if entry.CollectionAt > elem.Entry.CollectionAt ||
+		(entry.CollectionAt == elem.Entry.CollectionAt && entry.Collection.String() > elem.Entry.Collection.String()) {
+		elem.Entry.Collection = entry.Collection
+		elem.Entry.CollectionAt = entry.CollectionAt
+		s.elements[entry.ID] = elem
+	}
+}
+
+// SetCollection sets the collection register of an element at the given
+// timestamp. Returns false if the element does not exist.
+func (s *LWWSet) SetCollection(id, collection uuid.UUID, timestamp uint64) bool {
+	if _, exists := s.elements[id]; !exists {
+		return false
+	}
+	s.mergeCollection(core.Entry{ID: id, Collection: collection, CollectionAt: timestamp})
+	return true
 }
 
 // Remove marks an entry as deleted (tombstone) with the given timestamp.
 // If the entry doesn't exist or has a higher timestamp, this is a no-op.
 func (s *LWWSet) Remove(id uuid.UUID, timestamp uint64) {
+	s.RemoveBy(id, timestamp, "", 0)
+}
+
+// RemoveBy is Remove recording the peer that deleted the entry as its
+// author ("" = keep the author of the element), and the wall-clock time
+// of the deletion as its UpdatedTime (0 = keep).
+func (s *LWWSet) RemoveBy(id uuid.UUID, timestamp uint64, author string, wallMillis int64) {
 	existing, exists := s.elements[id]
 
 	// Only mark deleted if timestamp is higher
 	if !exists {
 		// Create tombstone for unknown entry
 		s.elements[id] = LWWElement{
-			Entry:     core.Entry{ID: id, Deleted: true, UpdatedAt: timestamp},
+			Entry:     core.Entry{ID: id, Deleted: true, UpdatedAt: timestamp, UpdatedTime: wallMillis, Author: author},
 			Timestamp: timestamp,
 			Deleted:   true,
 		}
@@ -69,6 +132,12 @@ func (s *LWWSet) Remove(id uuid.UUID, timestamp uint64) {
 		(timestamp == existing.Timestamp && !existing.Deleted) {
 		existing.Entry.Deleted = true
 		existing.Entry.UpdatedAt = timestamp
+		if author != "" {
+			existing.Entry.Author = author
+		}
+		if wallMillis != 0 {
+			existing.Entry.UpdatedTime = wallMillis
+		}
 		existing.Timestamp = timestamp
 		existing.Deleted = true
 		s.elements[id] = existing
@@ -141,44 +210,33 @@ func (s *LWWSet) Merge(other *LWWSet) {
 				Deleted:   otherElem.Deleted,
 			}
 		} else if otherElem.Timestamp == existing.Timestamp {
-			// Tie-breaker: deleted wins, then higher ID wins
+			// Tie-breaker: deleted wins, then the greater entry
 			if otherElem.Deleted && !existing.Deleted {
 				s.elements[id] = LWWElement{
 					Entry:     otherElem.Entry.Clone(),
 					Timestamp: otherElem.Timestamp,
 					Deleted:   otherElem.Deleted,
 				}
-			} else if !otherElem.Deleted && !existing.Deleted {
-				// Both not deleted. Timestamps are equal. Entry ID is equal.
-				// We MUST have a deterministic tie-breaker based on CONTENT.
-				// If we don't, A keeps A, B keeps B -> Divergence.
-				
-				// Compare Content bytes
-				cmp := compareBytes(otherElem.Entry.Content, existing.Entry.Content)
-				if cmp > 0 {
-					// Other content "greater", so replace
-					s.elements[id] = LWWElement{
-						Entry:     otherElem.Entry.Clone(),
-						Timestamp: otherElem.Timestamp,
-						Deleted:   otherElem.Deleted,
-					}
-				} else if cmp == 0 {
-					// Content is same. Compare tags?
-					// Tags are handled by OR-Set, but Entry struct has them too.
-					// Let's assume Entry.Tags in LWW is secondary to OR-Set, but needed for equality.
-					// Compare tags as string.
-					tagCmp := compareTags(otherElem.Entry.Tags, existing.Entry.Tags)
-					if tagCmp > 0 {
-						s.elements[id] = LWWElement{
-							Entry:     otherElem.Entry.Clone(),
-							Timestamp: otherElem.Timestamp,
-							Deleted:   otherElem.Deleted,
-						}
-					}
+			} else if otherElem.Deleted == existing.Deleted &&
+				compareEntries(otherElem.Entry, existing.Entry) > 0 {
+				// Both live (or both tombstones) at the same timestamp:
+				// without a deterministic tie-breaker on what they hold, A
+				// keeps A, B keeps B and the replicas diverge
+				s.elements[id] = LWWElement{
+					Entry:     otherElem.Entry.Clone(),
+					Timestamp: otherElem.Timestamp,
+					Deleted:   otherElem.Deleted,
 				}
 			}
 		}
 		// If existing.Timestamp > otherElem.Timestamp, keep existing (no-op)
+
+		// The archive and collection registers merge separately from the
+		// winning element
+		s.mergeArchive(existing.Entry)
+		s.mergeArchive(otherElem.Entry)
+		s.mergeCollection(existing.Entry)
+		s.mergeCollection(otherElem.Entry)
 	}
 }
 
@@ -211,6 +269,28 @@ func (s *LWWSet) ActiveSize() int {
 	return count
 }
 
+// compareEntries orders two versions of an entry written at the same
+// logical time, so that every replica keeps the same one: by content,
+// then tags, author, and the remaining fields the element carries. The
+// archive and collection registers merge on their own.
+func compareEntries(a, b core.Entry) int {
+	if c := compareBytes(a.Content, b.Content); c != 0 {
+		return c
+	}
+	if c := compareTags(a.Tags, b.Tags); c != 0 {
+		return c
+	}
+	return cmp.Or(
+		strings.Compare(a.Author, b.Author),
+		cmp.Compare(a.UpdatedTime, b.UpdatedTime),
+		cmp.Compare(a.Type, b.Type),
+		cmp.Compare(a.CreatedAt, b.CreatedAt),
+		cmp.Compare(a.CreatedTime, b.CreatedTime),
+		cmp.Compare(a.SchemaVersion, b.SchemaVersion),
+		strings.Compare(a.Namespace, b.Namespace),
+	)
+}
+
 // compareBytes returns 1 if a > b, -1 if a < b, 0 if equal
 func compareBytes(a, b []byte) int {
 	if len(a) != len(b) {
@@ -145,6 +145,76 @@ func TestLWWSetMergeDeleteWins(t *testing.T) {
 	}
 }
 
+func TestLWWSetMergeTombstoneTie(t *testing.T) {
+	id := uuid.New()
+	a := NewLWWSet()
+	b := NewLWWSet()
+
+	// Both replicas delete the entry at the same time after different
+	// edits: the tombstones must still resolve to the same element
+	a.Add(core.Entry{ID: id, Content: []byte("edit on a"), UpdatedAt: 1})
+	b.Add(core.Entry{ID: id, Content: []byte("edit on b"), UpdatedAt: 1})
+	a.Remove(id, 2)
+	b.Remove(id, 2)
+
+	ab := a.Clone()
+	ab.Merge(b)
+	ba := b.Clone()
+	ba.Merge(a)
+
+	fromAB, _ := ab.LookupWithDeleted(id)
+	fromBA, _ := ba.LookupWithDeleted(id)
+	if string(fromAB.Content) != string(fromBA.Content) {
+		t.Errorf("tombstones diverged: %q vs %q", fromAB.Content, fromBA.Content)
+	}
+}
+
+func TestLWWSetMergeAuthorTie(t *testing.T) {
+	id := uuid.New()
+	a := NewLWWSet()
+	b := NewLWWSet()
+
+	// Two devices write the same content at the same time: the replicas
+	// must still agree on who wrote it
+	a.Add(core.Entry{ID: id, Content: []byte("same"), UpdatedAt: 1, Author: "peer-a"})
+	b.Add(core.Entry{ID: id, Content: []byte("same"), UpdatedAt: 1, Author: "peer-b"})
+
+	ab := a.Clone()
+	ab.Merge(b)
+	ba := b.Clone()
+	ba.Merge(a)
+
+	fromAB, _ := ab.Lookup(id)
+	fromBA, _ := ba.Lookup(id)
+	if fromAB.Author != fromBA.Author {
+		t.Errorf("authors diverged: %q vs %q", fromAB.Author, fromBA.Author)
+	}
+}
+
+func TestLWWSetMergeDeleteTimeTie(t *testing.T) {
+	id := uuid.New()
+	a := NewLWWSet()
+	b := NewLWWSet()
+
+	// The same deletion stamped with different wall-clock times, as by two
+	// devices: the tombstones must resolve to the same time
+	a.Add(core.Entry{ID: id, Content: []byte("x"), UpdatedAt: 1})
+	b.Add(core.Entry{ID: id, Content: []byte("x"), UpdatedAt: 1})
+	a.RemoveBy(id, 2, "peer", 1000)
+	b.RemoveBy(id, 2, "peer", 2000)
+
+	ab := a.Clone()
+	ab.Merge(b)
+	ba := b.Clone()
+	ba.Merge(a)
+
+	fromAB, _ := ab.LookupWithDeleted(id)
+	fromBA, _ := ba.LookupWithDeleted(id)
+	if fromAB.UpdatedTime != fromBA.UpdatedTime {
+		t.Errorf("deletion times diverged: %d vs %d", fromAB.UpdatedTime, fromBA.UpdatedTime)
+	}
+}
+
 func TestLWWSetMergeCommutative(t *testing.T) {
 	// A.Merge(B) should equal B.Merge(A)
 	a := NewLWWSet()
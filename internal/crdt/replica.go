@@ -1,17 +1,37 @@
 package crdt
 
 import (
+	"sync"
+	"time"
+
 	"github.com/amaydixit11/acorde/internal/core"
 	"github.com/google/uuid"
 )
 
 // Replica represents a acorde replica's CRDT state.
 // It contains the LWW-Set for entries and OR-Sets for tags (one per entry).
+//
+// A Replica is safe for concurrent use by multiple goroutines: each method
+// is atomic. A sequence of calls (e.g. GetEntry then UpdateEntry) is not;
+// callers that need one serialize it themselves. The LWWSet and ORSets a
+// Replica holds are not safe for concurrent use on their own and are only
+// reached through it.
 type Replica struct {
+	mu sync.RWMutex // Guards entries, tags, acls and acks
+
 	entries *LWWSet                // LWW-Set of all entries
 	tags    map[uuid.UUID]*ORSet   // Entry ID → OR-Set of tags
 	acls    map[uuid.UUID]core.ACL // Entry ID → LWW ACL (ACL contains its own Timestamp)
-	clock   *core.Clock            // Lamport clock for this replica
+	acks    map[ackKey]core.Ack    // (Entry ID, Peer) → newest delivery ack
+	clock   *core.Clock            // Lamport or hybrid logical clock for this replica
+	author  string                 // Peer ID recorded on local changes
+	loader  *Loader                // Loads entries on demand (nil = all hydrated)
+}
+
+// ackKey identifies one peer's ack of one entry
+type ackKey struct {
+	entryID uuid.UUID
+	peer    string
 }
 
 // NewReplica creates a new empty replica with the given clock.
@@ -20,13 +40,29 @@ func NewReplica(clock *core.Clock) *Replica {
 		entries: NewLWWSet(),
 		tags:    make(map[uuid.UUID]*ORSet),
 		acls:    make(map[uuid.UUID]core.ACL),
+		acks:    make(map[ackKey]core.Ack),
 		clock:   clock,
 	}
 }
 
+// SetAuthor sets the peer ID recorded as the Author of entries this
+// replica adds, updates or deletes from then on
+func (r *Replica) SetAuthor(peerID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.author = peerID
+}
+
 // HydrateEntry loads an existing entry from storage into the CRDT.
 // Used during startup to populate the replica from durable storage.
 func (r *Replica) HydrateEntry(entry core.Entry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hydrate(entry)
+}
+
+// hydrate is HydrateEntry with r.mu held
+func (r *Replica) hydrate(entry core.Entry) {
 	// Add entry to LWW-Set
 	r.entries.Add(entry)
 
@@ -48,16 +84,48 @@ func (r *Replica) AddEntry(entryType core.EntryType, content []byte, tags []stri
 
 // AddEntryWithID adds a new entry with a specific ID.
 func (r *Replica) AddEntryWithID(id uuid.UUID, entryType core.EntryType, content []byte, tags []string) core.Entry {
+	return r.AddEntryCreated(id, entryType, content, tags, 0)
+}
+
+// AddEntryCreated is AddEntryWithID for an entry first created elsewhere
+// (e.g. moved from another vault) at a wall-clock time in Unix
+// milliseconds (0 = now). Its logical times are new.
+func (r *Replica) AddEntryCreated(id uuid.UUID, entryType core.EntryType, content []byte, tags []string, created int64) core.Entry {
+	return r.AddEntryVersioned(id, entryType, content, tags, created, 0)
+}
+
+// AddEntryVersioned is AddEntryCreated for content written against
+// version schemaVersion of its type's schema.
+func (r *Replica) AddEntryVersioned(id uuid.UUID, entryType core.EntryType, content []byte, tags []string, created int64, schemaVersion int) core.Entry {
+	return r.AddEntryNamespaced(id, "", entryType, content, tags, created, schemaVersion)
+}
+
+// AddEntryNamespaced is AddEntryVersioned for an entry in a namespace
+// ("" = the default one)
+func (r *Replica) AddEntryNamespaced(id uuid.UUID, namespace string, entryType core.EntryType, content []byte, tags []string, created int64, schemaVersion int) core.Entry {
 	timestamp := r.clock.Tick()
+	now := time.Now().UnixMilli()
+	if created == 0 {
+		created = now
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
 
 	entry := core.Entry{
-		ID:        id,
-		Type:      entryType,
-		Content:   content,
-		Tags:      []string{}, // Tags managed separately via OR-Set
-		CreatedAt: timestamp,
-		UpdatedAt: timestamp,
-		Deleted:   false,
+		ID:          id,
+		Type:        entryType,
+		Content:     content,
+		Tags:        []string{}, // Tags managed separately via OR-Set
+		CreatedAt:   timestamp,
+		UpdatedAt:   timestamp,
+		Deleted:     false,
+		CreatedTime: created,
+		UpdatedTime: now,
+
+		SchemaVersion: schemaVersion,
+		Author:        r.author,
+		Namespace:     namespace,
 	}
 
 	r.entries.Add(entry)
@@ -74,8 +142,35 @@ func (r *Replica) AddEntryWithID(id uuid.UUID, entryType core.EntryType, content
 	return r.getEntryWithTags(entry.ID)
 }
 
-// UpdateEntry updates an existing entry's content and/or tags.
+// Witness advances the clock to at least t, so that later changes order
+// after it (e.g. after version history copied from another vault)
+func (r *Replica) Witness(t uint64) {
+	r.clock.Witness(t)
+}
+
+// UpdateEntry updates an existing entry's content and/or tags. The entry
+// keeps its schema version.
 func (r *Replica) UpdateEntry(id uuid.UUID, content *[]byte, updateTags *[]string) error {
+	return r.updateEntry(id, nil, content, updateTags, nil)
+}
+
+// UpdateEntryVersioned is UpdateEntry recording the version of its type's
+// schema the content was written against.
+func (r *Replica) UpdateEntryVersioned(id uuid.UUID, content *[]byte, updateTags *[]string, schemaVersion int) error {
+	return r.updateEntry(id, nil, content, updateTags, &schemaVersion)
+}
+
+// UpdateEntryRetyped is UpdateEntryVersioned that also changes the entry's
+// type, for content that becomes another kind of entry (a file).
+func (r *Replica) UpdateEntryRetyped(id uuid.UUID, entryType core.EntryType, content *[]byte, updateTags *[]string, schemaVersion int) error {
+	return r.updateEntry(id, &entryType, content, updateTags, &schemaVersion)
+}
+
+func (r *Replica) updateEntry(id uuid.UUID, entryType *core.EntryType, content *[]byte, updateTags *[]string, schemaVersion *int) error {
+	r.load(id)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	existing, exists := r.entries.LookupWithDeleted(id)
 	if !exists {
 		return &ErrEntryNotFound{ID: id}
@@ -87,10 +182,18 @@ func (r *Replica) UpdateEntry(id uuid.UUID, content *[]byte, updateTags *[]strin
 	timestamp := r.clock.Tick()
 
 	updated := existing.Clone()
+	if entryType != nil {
+		updated.Type = *entryType
+	}
 	if content != nil {
 		updated.Content = *content
 	}
+	if schemaVersion != nil {
+		updated.SchemaVersion = *schemaVersion
+	}
 	updated.UpdatedAt = timestamp
+	updated.UpdatedTime = time.Now().UnixMilli()
+	updated.Author = r.author
 
 	r.entries.Add(updated)
 
@@ -150,19 +253,65 @@ func (r *Replica) UpdateEntry(id uuid.UUID, content *[]byte, updateTags *[]strin
 
 // DeleteEntry marks an entry as deleted (tombstone).
 func (r *Replica) DeleteEntry(id uuid.UUID) error {
+	r.load(id)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	_, exists := r.entries.LookupWithDeleted(id)
 	if !exists {
 		return &ErrEntryNotFound{ID: id}
 	}
 
 	timestamp := r.clock.Tick()
-	r.entries.Remove(id, timestamp)
+	r.entries.RemoveBy(id, timestamp, r.author, time.Now().UnixMilli())
+
+	return nil
+}
+
+// SetArchived archives or unarchives an entry. Archiving does not change
+// the entry's content or UpdatedAt.
+func (r *Replica) SetArchived(id uuid.UUID, archived bool) error {
+	r.load(id)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, exists := r.entries.LookupWithDeleted(id)
+	if !exists {
+		return &ErrEntryNotFound{ID: id}
+	}
+	if existing.Deleted {
+		return &ErrEntryDeleted{ID: id}
+	}
+
+	r.entries.SetArchived(id, archived, r.clock.Tick())
+	return nil
+}
+
+// SetCollection files an entry in a collection (uuid.Nil = none). Moving
+// does not change the entry's content or UpdatedAt.
+func (r *Replica) SetCollection(id, collection uuid.UUID) error {
+	r.load(id)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, exists := r.entries.LookupWithDeleted(id)
+	if !exists {
+		return &ErrEntryNotFound{ID: id}
+	}
+	if existing.Deleted {
+		return &ErrEntryDeleted{ID: id}
+	}
 
+	r.entries.SetCollection(id, collection, r.clock.Tick())
 	return nil
 }
 
 // GetEntry retrieves an entry by ID with its current tags.
 func (r *Replica) GetEntry(id uuid.UUID) (core.Entry, error) {
+	r.load(id)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	_, exists := r.entries.Lookup(id)
 	if !exists {
 		// Check if it exists but is deleted
@@ -176,8 +325,24 @@ func (r *Replica) GetEntry(id uuid.UUID) (core.Entry, error) {
 	return r.getEntryWithTags(id), nil
 }
 
+// GetEntryWithDeleted retrieves an entry or its tombstone by ID.
+func (r *Replica) GetEntryWithDeleted(id uuid.UUID) (core.Entry, bool) {
+	r.load(id)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if _, exists := r.entries.LookupWithDeleted(id); !exists {
+		return core.Entry{}, false
+	}
+	return r.getEntryWithTags(id), true
+}
+
 // ListEntries returns all non-deleted entries with their tags.
 func (r *Replica) ListEntries() []core.Entry {
+	r.loadAll()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	elements := r.entries.Elements()
 	result := make([]core.Entry, len(elements))
 
@@ -188,36 +353,74 @@ func (r *Replica) ListEntries() []core.Entry {
 	return result
 }
 
+// ListAllEntries returns all entries, including tombstones, with their tags.
+func (r *Replica) ListAllEntries() []core.Entry {
+	r.loadAll()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	elements := r.entries.AllElements()
+	result := make([]core.Entry, len(elements))
+
+	for i, elem := range elements {
+		result[i] = r.getEntryWithTags(elem.Entry.ID)
+	}
+
+	return result
+}
+
 // SetACL updates the ACL for an entry using LWW rules.
 func (r *Replica) SetACL(acl core.ACL) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.setACL(acl)
+}
+
+// setACL is SetACL with r.mu held
+func (r *Replica) setACL(acl core.ACL) {
 	// Ensure ACL has a timestamp (if 0, use current clock)
 	if acl.Timestamp == 0 {
 		acl.Timestamp = r.clock.Tick()
 	} else {
 		r.clock.Update(acl.Timestamp)
 	}
+	r.mergeACL(acl)
+}
 
+// mergeACL keeps acl if it is newer than the ACL held for its entry
+func (r *Replica) mergeACL(acl core.ACL) {
 	existing, exists := r.acls[acl.EntryID]
-	if !exists || acl.Timestamp > existing.Timestamp {
+	if !exists || ACLWins(acl, existing) {
 		r.acls[acl.EntryID] = acl
-	} else if acl.Timestamp == existing.Timestamp {
-		// Tie-breaker: Lexicographical comparison of Owner string? 
-		// Or assume identical if timestamps match?
-		// For robustness, let's use Owner for determinism
-		if acl.Owner > existing.Owner {
-			r.acls[acl.EntryID] = acl
-		}
 	}
 }
 
+// ACLWins reports whether merging acl replaces existing, the ACL held for
+// the same entry
+func ACLWins(acl, existing core.ACL) bool {
+	if acl.Timestamp != existing.Timestamp {
+		return acl.Timestamp > existing.Timestamp
+	}
+	// Tie-breaker: Lexicographical comparison of Owner string? 
+	// Or assume identical if timestamps match?
+	// For robustness, let's use Owner for determinism
+	return acl.Owner > existing.Owner
+}
+
 // GetACL returns the ACL for an entry
 func (r *Replica) GetACL(entryID uuid.UUID) (core.ACL, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	acl, exists := r.acls[entryID]
 	return acl, exists
 }
 
 // ListACLs returns all known ACLs
 func (r *Replica) ListACLs() []core.ACL {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	result := make([]core.ACL, 0, len(r.acls))
 	for _, acl := range r.acls {
 		result = append(result, acl)
@@ -225,18 +428,91 @@ func (r *Replica) ListACLs() []core.ACL {
 	return result
 }
 
+// SetAck records a delivery ack, keeping the newest per entry and peer.
+// A zero Timestamp is assigned from the replica clock.
+func (r *Replica) SetAck(ack core.Ack) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.setAck(ack)
+}
+
+// setAck is SetAck with r.mu held
+func (r *Replica) setAck(ack core.Ack) {
+	if ack.Timestamp == 0 {
+		ack.Timestamp = r.clock.Tick()
+	} else {
+		r.clock.Update(ack.Timestamp)
+	}
+	r.mergeAck(ack)
+}
+
+// ListAcks returns the acks recorded for an entry
+func (r *Replica) ListAcks(entryID uuid.UUID) []core.Ack {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var result []core.Ack
+	for key, ack := range r.acks {
+		if key.entryID == entryID {
+			result = append(result, ack)
+		}
+	}
+	return result
+}
+
+// AllAcks returns every known ack
+func (r *Replica) AllAcks() []core.Ack {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.allAcks()
+}
+
+// allAcks is AllAcks with r.mu held
+func (r *Replica) allAcks() []core.Ack {
+	result := make([]core.Ack, 0, len(r.acks))
+	for _, ack := range r.acks {
+		result = append(result, ack)
+	}
+	return result
+}
+
+// mergeAck stores ack if it supersedes the one already known
+func (r *Replica) mergeAck(ack core.Ack) {
+	key := ackKey{entryID: ack.EntryID, peer: ack.Peer}
+	if existing, exists := r.acks[key]; !exists || ack.Supersedes(existing) {
+		r.acks[key] = ack
+	}
+}
+
 // Merge merges another replica's state into this one.
 // Both entries (LWW-Set) and tags (OR-Sets) are merged.
 //
 // Tag Update Semantics:
 // - Concurrent tag updates from different replicas will be merged
 // - Both sets of tags will be present after merge (OR-Set behavior)
+//
+// other is snapshotted before r is locked, so merging two replicas into
+// each other from different goroutines cannot deadlock.
 func (r *Replica) Merge(other *Replica) {
+	if other == r {
+		return
+	}
+	other = other.Clone()
+	r.load(other.ids()...)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	// Update clock FIRST (before merging state)
 	// This ensures causal consistency: any new operations after merge
-	// will have timestamps higher than all merged entries
-	otherMaxTime := other.MaxTimestamp()
-	r.clock.Update(otherMaxTime)
+	// will have timestamps higher than all merged entries (the next Tick
+	// increments past the witnessed time). Witness rather than Update keeps
+	// Merge idempotent and commutative.
+	otherMaxTime := other.maxTimestamp()
+	if otherClock := other.clock.Now(); otherClock > otherMaxTime {
+		otherMaxTime = otherClock
+	}
+	r.clock.Witness(otherMaxTime)
 
 	// Merge entries (LWW-Set)
 	r.entries.Merge(other.entries)
@@ -261,15 +537,34 @@ func (r *Replica) Merge(other *Replica) {
 			}
 		}
 	}
+
+	// Merge acks (newest version wins)
+	for _, ack := range other.acks {
+		r.mergeAck(ack)
+	}
 }
 
 // MaxTimestamp returns the highest timestamp in this replica.
 func (r *Replica) MaxTimestamp() uint64 {
+	r.loadAll()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.maxTimestamp()
+}
+
+// maxTimestamp is MaxTimestamp with r.mu held
+func (r *Replica) maxTimestamp() uint64 {
 	var max uint64 = 0
 	for _, elem := range r.entries.AllElements() {
 		if elem.Timestamp > max {
 			max = elem.Timestamp
 		}
+		if elem.Entry.ArchivedAt > max {
+			max = elem.Entry.ArchivedAt
+		}
+		if elem.Entry.CollectionAt > max {
+			max = elem.Entry.CollectionAt
+		}
 	}
 	// Also check ACL timestamps
 	for _, acl := range r.acls {
@@ -277,16 +572,32 @@ func (r *Replica) MaxTimestamp() uint64 {
 			max = acl.Timestamp
 		}
 	}
+	for _, ack := range r.acks {
+		if ack.Timestamp > max {
+			max = ack.Timestamp
+		}
+	}
 	return max
 }
 
+// ClockTime returns the replica's current clock time
+func (r *Replica) ClockTime() uint64 {
+	return r.clock.Now()
+}
+
 // Clone creates a deep copy of the replica.
 func (r *Replica) Clone() *Replica {
+	r.loadAll()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	clone := &Replica{
 		entries: r.entries.Clone(),
 		tags:    make(map[uuid.UUID]*ORSet),
 		acls:    make(map[uuid.UUID]core.ACL),
-		clock:   core.NewClockWithTime(r.clock.Now()),
+		acks:    make(map[ackKey]core.Ack, len(r.acks)),
+		clock:   r.clock.Copy(),
+		author:  r.author,
 	}
 
 	for id, tagSet := range r.tags {
@@ -295,22 +606,37 @@ func (r *Replica) Clone() *Replica {
 	for id, acl := range r.acls {
 		clone.acls[id] = acl.Clone()
 	}
+	for key, ack := range r.acks {
+		clone.acks[key] = ack
+	}
 
 	return clone
 }
 
 // State returns the current state for serialization/sync.
 func (r *Replica) State() ReplicaState {
+	r.loadAll()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	acls := make(map[uuid.UUID]core.ACL, len(r.acls))
+	for id, acl := range r.acls {
+		acls[id] = acl
+	}
 	return ReplicaState{
 		Entries:      r.entries.AllElements(),
 		Tags:         r.exportTags(),
-		ACLs:         r.acls,
+		ACLs:         acls,
+		Acks:         r.allAcks(),
 		ClockTime:    r.clock.Now(),
 	}
 }
 
 // LoadState loads state from a ReplicaState (for deserialization).
 func (r *Replica) LoadState(state ReplicaState) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	for _, elem := range state.Entries {
 		r.entries.Add(elem.Entry)
 		if elem.Deleted {
@@ -331,15 +657,31 @@ func (r *Replica) LoadState(state ReplicaState) {
 		r.tags[id] = tagSet
 	}
 
-	// Load ACLs
+	// Load ACLs and acks. Witness rather than tick for their timestamps,
+	// so loading a state leaves the clock where the state had it and
+	// replicas holding the same state hash the same.
 	for id, acl := range state.ACLs {
-		r.SetACL(acl)
+		if acl.Timestamp == 0 {
+			r.setACL(acl)
+		} else {
+			r.clock.Witness(acl.Timestamp)
+			r.mergeACL(acl)
+		}
 		// Ensure map key matches entryID just in case
 		if acl.EntryID != id {
 			// Try to correct or warn?
 			// Just trust the map iteration
 		}
 	}
+
+	for _, ack := range state.Acks {
+		if ack.Timestamp == 0 {
+			r.setAck(ack)
+		} else {
+			r.clock.Witness(ack.Timestamp)
+			r.mergeAck(ack)
+		}
+	}
 }
 
 // Helper methods
@@ -385,9 +727,74 @@ type ReplicaState struct {
 	Entries   []LWWElement              `json:"entries"`
 	Tags      map[uuid.UUID]TagSetState `json:"tags"`
 	ACLs      map[uuid.UUID]core.ACL    `json:"acls"`
+	Acks      []core.Ack                `json:"acks,omitempty"`
 	ClockTime uint64                    `json:"clock_time"`
 }
 
+// InNamespaces returns the part of a state in the given namespaces: their
+// entries, with the tags, ACLs and acks of those entries
+func (s ReplicaState) InNamespaces(namespaces []string) ReplicaState {
+	in := make(map[string]bool, len(namespaces))
+	for _, ns := range namespaces {
+		in[ns] = true
+	}
+
+	part := ReplicaState{
+		Tags:      make(map[uuid.UUID]TagSetState),
+		ACLs:      make(map[uuid.UUID]core.ACL),
+		ClockTime: s.ClockTime,
+	}
+	kept := make(map[uuid.UUID]bool)
+	for _, elem := range s.Entries {
+		if in[elem.Entry.Namespace] {
+			part.Entries = append(part.Entries, elem)
+			kept[elem.Entry.ID] = true
+		}
+	}
+	for id, tags := range s.Tags {
+		if kept[id] {
+			part.Tags[id] = tags
+		}
+	}
+	for id, acl := range s.ACLs {
+		if kept[id] {
+			part.ACLs[id] = acl
+		}
+	}
+	for _, ack := range s.Acks {
+		if kept[ack.EntryID] {
+			part.Acks = append(part.Acks, ack)
+		}
+	}
+	return part
+}
+
+// MergeStats describes the merge of a remote state into a replica
+type MergeStats struct {
+	Duration   time.Duration
+	Compared   int // Entries of the remote state compared with local ones
+	Changed    int // Entries the merge added or modified (tombstones included)
+	Tombstones int // Deleted entries in the remote state
+}
+
+// NewMergeStats returns the stats of merging state known before the merge
+// runs: Compared and Tombstones
+func NewMergeStats(state ReplicaState) MergeStats {
+	ids := make(map[uuid.UUID]struct{}, len(state.Entries)+len(state.Tags))
+	var stats MergeStats
+	for _, elem := range state.Entries {
+		ids[elem.Entry.ID] = struct{}{}
+		if elem.Entry.Deleted {
+			stats.Tombstones++
+		}
+	}
+	for id := range state.Tags {
+		ids[id] = struct{}{}
+	}
+	stats.Compared = len(ids)
+	return stats
+}
+
 // TagSetState represents the serializable state of an OR-Set.
 type TagSetState struct {
 	Adds    []TagToken `json:"adds"`
@@ -412,12 +819,21 @@ func (e *ErrEntryDeleted) Error() string {
 	return "entry is deleted: " + e.ID.String()
 }
 
-// EntriesSince returns entries updated after the given timestamp.
-// Used for delta sync.
+// EntriesSince returns entries updated, archived or unarchived after the
+// given timestamp. Used for delta sync.
 func (r *Replica) EntriesSince(since uint64) []LWWElement {
+	r.loadAll()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.entriesSince(since)
+}
+
+// entriesSince is EntriesSince with r.mu held
+func (r *Replica) entriesSince(since uint64) []LWWElement {
 	var result []LWWElement
 	for _, elem := range r.entries.AllElements() {
-		if elem.Timestamp > since {
+		if elem.Timestamp > since || elem.Entry.ArchivedAt > since ||
+			elem.Entry.CollectionAt > since {
 			result = append(result, elem)
 		}
 	}
@@ -426,7 +842,11 @@ func (r *Replica) EntriesSince(since uint64) []LWWElement {
 
 // DeltaState returns only changes since the given timestamp.
 func (r *Replica) DeltaState(since uint64) DeltaReplicaState {
-	entries := r.EntriesSince(since)
+	r.loadAll()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entries := r.entriesSince(since)
 	
 	// Collect tags for changed entries
 	tags := make(map[uuid.UUID]TagSetState)
@@ -443,6 +863,13 @@ func (r *Replica) DeltaState(since uint64) DeltaReplicaState {
 		}
 	}
 
+	var acks []core.Ack
+	for _, ack := range r.acks {
+		if ack.Timestamp > since {
+			acks = append(acks, ack)
+		}
+	}
+
 	for _, elem := range entries {
 		if tagSet, ok := r.tags[elem.Entry.ID]; ok {
 			tags[elem.Entry.ID] = TagSetState{
@@ -456,6 +883,7 @@ func (r *Replica) DeltaState(since uint64) DeltaReplicaState {
 		Entries:   entries,
 		Tags:      tags,
 		ACLs:      acls,
+		Acks:      acks,
 		ClockTime: r.clock.Now(),
 		Since:     since,
 	}
@@ -466,12 +894,25 @@ type DeltaReplicaState struct {
 	Entries   []LWWElement              `json:"entries"`
 	Tags      map[uuid.UUID]TagSetState `json:"tags"`
 	ACLs      map[uuid.UUID]core.ACL    `json:"acls"`
+	Acks      []core.Ack                `json:"acks,omitempty"`
 	ClockTime uint64                    `json:"clock_time"`
 	Since     uint64                    `json:"since"`
 }
 
 // ApplyDelta merges a delta state into this replica.
 func (r *Replica) ApplyDelta(delta DeltaReplicaState) {
+	ids := make([]uuid.UUID, 0, len(delta.Entries)+len(delta.Tags))
+	for _, elem := range delta.Entries {
+		ids = append(ids, elem.Entry.ID)
+	}
+	for id := range delta.Tags {
+		ids = append(ids, id)
+	}
+	r.load(ids...)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	// Apply entries
 	for _, elem := range delta.Entries {
 		r.entries.Add(elem.Entry)
@@ -490,7 +931,12 @@ func (r *Replica) ApplyDelta(delta DeltaReplicaState) {
 
 	// Apply ACLs
 	for _, acl := range delta.ACLs {
-		r.SetACL(acl)
+		r.setACL(acl)
+	}
+
+	// Apply acks
+	for _, ack := range delta.Acks {
+		r.setAck(ack)
 	}
 	
 	// Update clock
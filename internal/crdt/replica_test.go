@@ -2,6 +2,7 @@ package crdt
 
 import (
 	"sort"
+	"sync"
 	"testing"
 
 	"github.com/amaydixit11/acorde/internal/core"
@@ -181,6 +182,46 @@ func TestReplicaMergeDeleteVsUpdate(t *testing.T) {
 	}
 }
 
+func TestReplicaMergeArchive(t *testing.T) {
+	r1 := NewReplica(core.NewClockWithTime(0))
+	r2 := NewReplica(core.NewClockWithTime(0))
+
+	entry := r1.AddEntry(core.Note, []byte("original"), nil)
+	r2.Merge(r1)
+
+	// r1 archives while r2 makes a later edit: both changes survive
+	if err := r1.SetArchived(entry.ID, true); err != nil {
+		t.Fatalf("SetArchived failed: %v", err)
+	}
+	r2.clock = core.NewClockWithTime(100)
+	content := []byte("r2 update")
+	r2.UpdateEntry(entry.ID, &content, nil)
+
+	r1.Merge(r2)
+	r2.Merge(r1)
+
+	for i, r := range []*Replica{r1, r2} {
+		result, _ := r.GetEntry(entry.ID)
+		if string(result.Content) != "r2 update" || !result.Archived {
+			t.Errorf("replica %d: expected archived 'r2 update', got %q archived=%v", i+1, result.Content, result.Archived)
+		}
+	}
+
+	// A later unarchive wins over the archive, and is part of the delta
+	// even though the entry's UpdatedAt does not change
+	before, _ := r2.GetEntry(entry.ID)
+	if err := r2.SetArchived(entry.ID, false); err != nil {
+		t.Fatalf("SetArchived failed: %v", err)
+	}
+	if got := r2.EntriesSince(before.UpdatedAt); len(got) != 1 {
+		t.Errorf("expected the unarchive in the delta, got %d entries", len(got))
+	}
+	r1.Merge(r2)
+	if result, _ := r1.GetEntry(entry.ID); result.Archived {
+		t.Error("expected entry unarchived after merge")
+	}
+}
+
 func TestReplicaMergeTags(t *testing.T) {
 	r1 := NewReplica(core.NewClock())
 	r2 := NewReplica(core.NewClock())
@@ -271,6 +312,30 @@ func TestReplicaMergeIdempotent(t *testing.T) {
 	}
 }
 
+func TestReplicaMergeWitnessesClock(t *testing.T) {
+	a := NewReplica(core.NewClock())
+	b := NewReplica(core.NewClock())
+
+	entry := b.AddEntry(core.Note, []byte("remote"), nil)
+
+	// Merging takes the clock to the peer's time without moving past it,
+	// so merging the same state twice leaves the replica unchanged
+	a.Merge(b.Clone())
+	if got := a.State().ClockTime; got != b.State().ClockTime {
+		t.Errorf("expected clock %d after merge, got %d", b.State().ClockTime, got)
+	}
+	a.Merge(b.Clone())
+	if got := a.State().ClockTime; got != b.State().ClockTime {
+		t.Errorf("expected a repeated merge to leave the clock at %d, got %d", b.State().ClockTime, got)
+	}
+
+	// The next local change still orders after everything merged
+	local := a.AddEntry(core.Note, []byte("local"), nil)
+	if local.UpdatedAt <= entry.UpdatedAt {
+		t.Errorf("expected local timestamp after %d, got %d", entry.UpdatedAt, local.UpdatedAt)
+	}
+}
+
 func TestReplicaState(t *testing.T) {
 	r := NewReplica(core.NewClock())
 
@@ -285,3 +350,182 @@ func TestReplicaState(t *testing.T) {
 		t.Errorf("expected 1 tag set in state, got %d", len(state.Tags))
 	}
 }
+
+func TestReplicaLoadStateKeepsClock(t *testing.T) {
+	r := NewReplica(core.NewClock())
+	entry := r.AddEntry(core.Note, []byte("test"), nil)
+	r.SetACL(core.ACL{EntryID: entry.ID, Owner: "peer-a"})
+	r.SetAck(core.Ack{EntryID: entry.ID, Peer: "peer-b"})
+	state := r.State()
+
+	// Loading (and so merging) a state must not tick the clock, or
+	// replicas holding the same data would never hash the same
+	loaded := NewReplica(core.NewClockWithTime(state.ClockTime))
+	loaded.LoadState(state)
+	if got := loaded.ClockTime(); got != state.ClockTime {
+		t.Errorf("clock after LoadState = %d, want %d", got, state.ClockTime)
+	}
+	r.Merge(loaded)
+	if got := r.ClockTime(); got != state.ClockTime {
+		t.Errorf("clock after merge = %d, want %d", got, state.ClockTime)
+	}
+}
+
+func TestReplicaMergeAcks(t *testing.T) {
+	r1 := NewReplica(core.NewClock())
+	entry := r1.AddEntry(core.Note, []byte("test"), nil)
+
+	r2 := r1.Clone()
+	r2.SetAck(core.Ack{EntryID: entry.ID, Peer: "peer-b", Version: entry.UpdatedAt})
+	r2.SetAck(core.Ack{EntryID: entry.ID, Peer: "peer-b", Version: entry.UpdatedAt + 5})
+	r2.SetAck(core.Ack{EntryID: entry.ID, Peer: "peer-b", Version: entry.UpdatedAt}) // Older version is ignored
+
+	r1.Merge(r2)
+	acks := r1.ListAcks(entry.ID)
+	if len(acks) != 1 || acks[0].Version != entry.UpdatedAt+5 {
+		t.Fatalf("expected newest ack from peer-b, got %+v", acks)
+	}
+
+	// Acks travel in serialized state and deltas
+	r3 := NewReplica(core.NewClock())
+	r3.LoadState(r1.State())
+	if len(r3.ListAcks(entry.ID)) != 1 {
+		t.Error("acks missing from state")
+	}
+	delta := r1.DeltaState(acks[0].Timestamp - 1)
+	if len(delta.Acks) != 1 {
+		t.Errorf("expected ack in delta, got %d", len(delta.Acks))
+	}
+}
+
+// TestReplicaConcurrent exercises every kind of replica access at once;
+// run with -race
+func TestReplicaConcurrent(t *testing.T) {
+	r1 := NewReplica(core.NewClock())
+	r2 := NewReplica(core.NewClock())
+	seed := r1.AddEntry(core.Note, []byte("seed"), []string{"a"})
+	r2.Merge(r1)
+
+	const rounds = 200
+	var wg sync.WaitGroup
+	run := func(fn func(i int)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				fn(i)
+			}
+		}()
+	}
+
+	for _, r := range []*Replica{r1, r2} {
+		r := r
+		run(func(i int) {
+			e := r.AddEntry(core.Note, []byte("x"), []string{"b"})
+			r.UpdateEntry(e.ID, nil, &[]string{"c"})
+			if i%10 == 0 {
+				r.DeleteEntry(e.ID)
+			}
+		})
+		run(func(i int) {
+			tags := []string{"a", "d"}
+			r.UpdateEntry(seed.ID, nil, &tags)
+			r.SetArchived(seed.ID, i%2 == 0)
+			r.SetACL(core.ACL{EntryID: seed.ID, Owner: "owner"})
+			r.SetAck(core.Ack{EntryID: seed.ID, Peer: "peer", Version: uint64(i)})
+		})
+		run(func(int) {
+			r.ListEntries()
+			r.GetEntry(seed.ID)
+			r.ListACLs()
+			r.ListAcks(seed.ID)
+			r.MaxTimestamp()
+		})
+	}
+	run(func(int) { r1.Merge(r2) })
+	run(func(int) { r2.Merge(r1) })
+	run(func(int) { r2.ApplyDelta(r1.DeltaState(0)) })
+	run(func(int) { r1.LoadState(r2.State()) })
+	wg.Wait()
+
+	r1.Merge(r2)
+	r2.Merge(r1)
+	if len(r1.ListAllEntries()) != len(r2.ListAllEntries()) {
+		t.Errorf("replicas did not converge: %d vs %d entries", len(r1.ListAllEntries()), len(r2.ListAllEntries()))
+	}
+	if len(r1.ListAllEntries()) != 2*rounds+1 {
+		t.Errorf("expected %d entries, got %d", 2*rounds+1, len(r1.ListAllEntries()))
+	}
+}
+
+func TestLazyReplica(t *testing.T) {
+	// Storage holds three entries written by another replica
+	src := NewReplica(core.NewClock())
+	a := src.AddEntry(core.Note, []byte("a"), []string{"work"})
+	b := src.AddEntry(core.Note, []byte("b"), nil)
+	c := src.AddEntry(core.Note, []byte("c"), nil)
+	stored := map[uuid.UUID]core.Entry{}
+	for _, entry := range src.ListAllEntries() {
+		stored[entry.ID] = entry
+	}
+
+	var loads, loadAlls int
+	r := NewReplica(core.NewClockWithTime(src.ClockTime()))
+	r.SetLoader(Loader{
+		Entry: func(id uuid.UUID) (core.Entry, bool) {
+			loads++
+			entry, ok := stored[id]
+			return entry, ok
+		},
+		All: func() ([]core.Entry, error) {
+			loadAlls++
+			all := make([]core.Entry, 0, len(stored))
+			for _, entry := range stored {
+				all = append(all, entry)
+			}
+			return all, nil
+		},
+	})
+
+	got, err := r.GetEntry(a.ID)
+	if err != nil || string(got.Content) != "a" || len(got.Tags) != 1 {
+		t.Fatalf("GetEntry = %+v, %v", got, err)
+	}
+	r.GetEntry(a.ID)
+	if loads != 1 {
+		t.Errorf("entry loaded %d times, want once", loads)
+	}
+	if peeked, ok := r.Peek(b.ID); !ok || string(peeked.Content) != "b" {
+		t.Errorf("Peek = %+v, %v", peeked, ok)
+	}
+
+	// A merge loads the entries it touches before comparing them
+	remote := NewReplica(core.NewClockWithTime(src.ClockTime()))
+	remote.LoadState(src.State())
+	content := []byte("b, edited remotely")
+	remote.UpdateEntry(b.ID, &content, nil)
+	r.Merge(remote)
+	if got, _ := r.GetEntry(b.ID); string(got.Content) != string(content) {
+		t.Errorf("merged content = %q", got.Content)
+	}
+	if r.Hydrated() || loadAlls != 0 {
+		t.Error("lazy replica loaded everything before it was needed")
+	}
+
+	// Listing loads the rest, once
+	local := []byte("a, edited locally")
+	r.UpdateEntry(a.ID, &local, nil)
+	if n := len(r.ListEntries()); n != 3 {
+		t.Errorf("ListEntries returned %d entries, want 3", n)
+	}
+	r.ListEntries()
+	if loadAlls != 1 || !r.Hydrated() {
+		t.Errorf("loaded all %d times, hydrated %v", loadAlls, r.Hydrated())
+	}
+	if got, _ := r.GetEntry(a.ID); string(got.Content) != string(local) {
+		t.Errorf("hydration overwrote a local change: %q", got.Content)
+	}
+	if _, err := r.GetEntry(c.ID); err != nil {
+		t.Errorf("GetEntry(c) after hydration: %v", err)
+	}
+}
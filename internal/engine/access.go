@@ -0,0 +1,138 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/amaydixit11/acorde/internal/acl"
+	"github.com/amaydixit11/acorde/internal/core"
+	"github.com/amaydixit11/acorde/internal/crdt"
+	"github.com/amaydixit11/acorde/internal/quarantine"
+	"github.com/google/uuid"
+)
+
+// aclEnforced reports whether entry ACLs are checked. A vault runs in
+// single-user mode, where every entry is this device's to read and
+// write, until an entry is shared with a peer (here or by a peer whose
+// ACLs reached us through sync); Config.DisableACL keeps it there.
+func (e *engineImpl) aclEnforced() bool {
+	return !e.aclOff && e.acls.Shared()
+}
+
+// canRead reports whether this device may read an entry
+func (e *engineImpl) canRead(id uuid.UUID) bool {
+	if !e.aclEnforced() {
+		return true
+	}
+	allowed, _ := e.acls.CheckRead(id, e.localID)
+	return allowed
+}
+
+// canWrite reports whether this device may write an entry
+func (e *engineImpl) canWrite(id uuid.UUID) bool {
+	if !e.aclEnforced() {
+		return true
+	}
+	allowed, _ := e.acls.CheckWrite(id, e.localID)
+	return allowed
+}
+
+// quarantinedACL is the entry type recorded for quarantined ACL changes
+const quarantinedACL = "acl"
+
+// screenAuthors removes from remote state the entry versions that would
+// replace the local one but that from, the authenticated peer that sent
+// the state ("" if unknown), may not write under the local ACL of the
+// entry. The Author a version names is not trusted, as the sender sets
+// it; a peer relaying another's writes must be a writer itself. ACLs
+// arriving in the same state don't count, so a peer cannot grant itself
+// access. Changes to tags come with the version, so a removed version's
+// tags are dropped too. Nothing is removed in single-user mode. Removed
+// versions are returned for quarantine.
+func (e *engineImpl) screenAuthors(state crdt.ReplicaState, from string) (crdt.ReplicaState, []quarantine.Entry) {
+	if !e.aclEnforced() {
+		return state, nil
+	}
+	now := time.Now()
+
+	var rejected []quarantine.Entry
+	kept := state.Entries[:0:0]
+	for _, elem := range state.Entries {
+		id := elem.Entry.ID
+		current, exists := e.replica.GetEntryWithDeleted(id)
+		entryACL, hasACL := e.replica.GetACL(id)
+		if !exists || !hasACL || elem.Timestamp < current.UpdatedAt || sameVersion(elem, current) ||
+			(from != "" && acl.CanWrite(&entryACL, from, e.acls.Groups())) {
+			kept = append(kept, elem)
+			continue
+		}
+
+		reason := "sender unknown; the entry has an owner"
+		if from != "" {
+			reason = fmt.Sprintf("peer %s may not write the entry", from)
+		}
+		element, _ := json.Marshal(elem)
+		rejected = append(rejected, quarantine.Entry{
+			EntryID:       id,
+			EntryType:     string(current.Type),
+			Timestamp:     elem.Timestamp,
+			Reason:        reason,
+			QuarantinedAt: now.Unix(),
+			LastSeen:      now.Unix(),
+			Element:       element,
+		})
+		delete(state.Tags, id)
+	}
+	state.Entries = kept
+	return state, rejected
+}
+
+// screenACLs removes from remote state the ACL changes from (as for
+// screenAuthors) may not make: an ACL that would replace the local one
+// must come from the entry's owner. So a peer can neither take over an
+// entry nor share it with itself, even in single-user mode, where a
+// shared ACL would start enforcement. The first ACL of an entry is taken
+// from whichever peer sends it, as peers relay each other's. Nothing is
+// removed with ACLs disabled. Removed ACLs are returned for quarantine.
+func (e *engineImpl) screenACLs(state crdt.ReplicaState, from string) (crdt.ReplicaState, []quarantine.Entry) {
+	if e.aclOff || len(state.ACLs) == 0 {
+		return state, nil
+	}
+	now := time.Now()
+
+	var rejected []quarantine.Entry
+	kept := make(map[uuid.UUID]core.ACL, len(state.ACLs))
+	for id, remote := range state.ACLs {
+		local, exists := e.replica.GetACL(id)
+		if !exists || !crdt.ACLWins(remote, local) || (from != "" && from == local.Owner) {
+			kept[id] = remote
+			continue
+		}
+
+		reason := "sender unknown; ACL changes must come from the entry's owner"
+		if from != "" {
+			reason = fmt.Sprintf("peer %s does not own the entry", from)
+		}
+		element, _ := json.Marshal(remote)
+		rejected = append(rejected, quarantine.Entry{
+			EntryID:       id,
+			EntryType:     quarantinedACL,
+			Timestamp:     remote.Timestamp,
+			Reason:        reason,
+			QuarantinedAt: now.Unix(),
+			LastSeen:      now.Unix(),
+			Element:       element,
+		})
+	}
+	state.ACLs = kept
+	return state, rejected
+}
+
+// sameVersion reports whether a remote element is the version of the
+// entry already held
+func sameVersion(elem crdt.LWWElement, current core.Entry) bool {
+	return elem.Timestamp == current.UpdatedAt && elem.Deleted == current.Deleted &&
+		bytes.Equal(elem.Entry.Content, current.Content)
+}
@@ -0,0 +1,72 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/amaydixit11/acorde/internal/core"
+	"github.com/google/uuid"
+)
+
+// EntryAcks returns the acks for an entry, one per device that received
+// it through sync, sorted by peer ID. Acks are only recorded by devices
+// opened with Config.EnableAcks.
+func (e *engineImpl) EntryAcks(id uuid.UUID) ([]Ack, error) {
+	if !e.canRead(id) {
+		return nil, fmt.Errorf("permission denied")
+	}
+	if _, err := e.replica.GetEntry(id); err != nil {
+		return nil, convertCRDTError(err)
+	}
+
+	acks := e.replica.ListAcks(id)
+	sort.Slice(acks, func(i, j int) bool { return acks[i].Peer < acks[j].Peer })
+	return acks, nil
+}
+
+// ackChanges acknowledges every entry version a merge delivered. The acks
+// sync back to the author with the rest of the replica state.
+func (e *engineImpl) ackChanges(changes []mergeChange) {
+	if !e.ackSync {
+		return
+	}
+	now := time.Now().Unix()
+	for _, change := range changes {
+		e.replica.SetAck(core.Ack{
+			EntryID:    change.entry.ID,
+			Peer:       e.localID,
+			Version:    change.entry.UpdatedAt,
+			ReceivedAt: now,
+		})
+	}
+}
+
+// snapshotAcks records the acks known before a merge
+func (e *engineImpl) snapshotAcks() map[ackID]core.Ack {
+	acks := e.replica.AllAcks()
+	snap := make(map[ackID]core.Ack, len(acks))
+	for _, a := range acks {
+		snap[ackID{a.EntryID, a.Peer}] = a
+	}
+	return snap
+}
+
+// persistAcks stores acks that are new or changed since the snapshot
+func (e *engineImpl) persistAcks(before map[ackID]core.Ack) error {
+	for _, a := range e.replica.AllAcks() {
+		if prev, ok := before[ackID{a.EntryID, a.Peer}]; ok && prev == a {
+			continue
+		}
+		if err := e.acks.Put(a); err != nil {
+			return fmt.Errorf("failed to persist ack: %w", err)
+		}
+	}
+	return nil
+}
+
+// ackID identifies one peer's ack of one entry
+type ackID struct {
+	entryID uuid.UUID
+	peer    string
+}
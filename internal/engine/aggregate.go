@@ -0,0 +1,286 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/amaydixit11/acorde/internal/storage"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Bucket is the width of the time buckets Aggregate groups entries into
+type Bucket string
+
+const (
+	BucketHour  Bucket = "hour"
+	BucketDay   Bucket = "day"
+	BucketWeek  Bucket = "week" // Starting on Monday
+	BucketMonth Bucket = "month"
+)
+
+// AggregateFunc is what Aggregate computes per bucket
+type AggregateFunc string
+
+const (
+	AggCount AggregateFunc = "count"
+	AggSum   AggregateFunc = "sum"
+	AggAvg   AggregateFunc = "avg"
+	AggMin   AggregateFunc = "min"
+	AggMax   AggregateFunc = "max"
+)
+
+// Aggregation is a function and, except for AggCount, the numeric field
+// of JSON content it applies to (dots separate nested fields)
+type Aggregation struct {
+	Func  AggregateFunc
+	Field string
+}
+
+// AggregateFilter selects the entries Aggregate groups, by wall-clock
+// creation time. Entries without one are left out.
+type AggregateFilter struct {
+	Type  *EntryType
+	Tag   *string
+	Since time.Time // Created at or after (zero = unbounded)
+	Until time.Time // Created before (zero = unbounded)
+
+	// Location buckets start in (nil = time.Local)
+	Location *time.Location
+}
+
+// AggregateBucket is one time bucket of an aggregation. Count is the
+// number of entries aggregated; Value is the aggregate (the count for
+// AggCount, 0 for other functions over an empty bucket).
+type AggregateBucket struct {
+	Start time.Time `json:"start"`
+	Count int       `json:"count"`
+	Value float64   `json:"value"`
+}
+
+// aggregateSlot is the width of the groups storage aggregates. Every time
+// zone offset is a multiple of it, so slots never straddle buckets.
+const aggregateSlot = 15 * time.Minute
+
+var aggregateField = regexp.MustCompile(`^[A-Za-z0-9_-]+(\.[A-Za-z0-9_-]+)*$`)
+
+// Aggregate counts entries, or totals a numeric field of their JSON
+// content, per time bucket, from the first bucket with entries (or
+// Since) to the last (or Until), including empty buckets. Storage groups
+// entries by creation time, except for field aggregates in encrypted
+// vaults, which are computed on decrypted content.
+func (e *engineImpl) Aggregate(filter AggregateFilter, bucket Bucket, agg Aggregation) ([]AggregateBucket, error) {
+	ctx, span := e.startSpan("acorde.Aggregate",
+		attribute.String("acorde.bucket", string(bucket)),
+		attribute.String("acorde.aggregate", string(agg.Func)))
+	buckets, err := e.aggregate(ctx, filter, bucket, agg)
+	endSpan(span, err)
+	return buckets, err
+}
+
+func (e *engineImpl) aggregate(ctx context.Context, filter AggregateFilter, bucket Bucket, agg Aggregation) ([]AggregateBucket, error) {
+	switch bucket {
+	case BucketHour, BucketDay, BucketWeek, BucketMonth:
+	default:
+		return nil, fmt.Errorf("unknown bucket %q (use hour, day, week or month)", bucket)
+	}
+	switch agg.Func {
+	case "":
+		agg.Func = AggCount
+	case AggCount, AggSum, AggAvg, AggMin, AggMax:
+	default:
+		return nil, fmt.Errorf("unknown aggregate %q (use count, sum, avg, min or max)", agg.Func)
+	}
+	if agg.Func == AggCount {
+		agg.Field = ""
+	} else if !aggregateField.MatchString(agg.Field) {
+		return nil, fmt.Errorf("%s needs a field name, got %q", agg.Func, agg.Field)
+	}
+	if !filter.Since.IsZero() && !filter.Until.IsZero() && !filter.Since.Before(filter.Until) {
+		return nil, fmt.Errorf("since must be before until")
+	}
+	loc := filter.Location
+	if loc == nil {
+		loc = time.Local
+	}
+
+	query := storage.AggregateFilter{
+		Type: filter.Type,
+		Tag:  filter.Tag,
+		Slot: aggregateSlot.Milliseconds(),
+	}
+	if !filter.Since.IsZero() {
+		query.Since = filter.Since.UnixMilli()
+	}
+	if !filter.Until.IsZero() {
+		query.Until = filter.Until.UnixMilli()
+	}
+
+	var rows []storage.AggregateRow
+	var err error
+	if agg.Field != "" && e.encrypted() {
+		rows, err = e.aggregateDecrypted(ctx, query, agg.Field)
+	} else {
+		if agg.Field != "" {
+			query.Path = "$." + agg.Field
+		}
+		rows, err = e.storeFor(ctx).Aggregate(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return toBuckets(rows, filter, bucket, agg.Func, loc), nil
+}
+
+// aggregateDecrypted groups entries like storage does, reading the field
+// from decrypted content
+func (e *engineImpl) aggregateDecrypted(ctx context.Context, query storage.AggregateFilter, field string) ([]storage.AggregateRow, error) {
+	listed, err := e.listEntries(ctx, ListFilter{Type: query.Type, Tag: query.Tag, Archived: true})
+	if err != nil {
+		return nil, err
+	}
+	entries := listed.Entries
+	slots := make(map[int64]*storage.AggregateRow)
+	var order []int64
+	for _, entry := range entries {
+		if entry.CreatedTime.IsZero() {
+			continue
+		}
+		ms := entry.CreatedTime.UnixMilli()
+		if query.Since > 0 && ms < query.Since || query.Until > 0 && ms >= query.Until {
+			continue
+		}
+		v, ok := numericField(entry.Content, field)
+		if !ok {
+			continue
+		}
+		start := ms / query.Slot * query.Slot
+		row := slots[start]
+		if row == nil {
+			row = &storage.AggregateRow{Start: start, Min: v, Max: v}
+			slots[start] = row
+			order = append(order, start)
+		}
+		row.Count++
+		row.Sum += v
+		row.Min = min(row.Min, v)
+		row.Max = max(row.Max, v)
+	}
+
+	rows := make([]storage.AggregateRow, len(order))
+	for i, start := range order {
+		rows[i] = *slots[start]
+	}
+	return rows, nil
+}
+
+// numericField reads a number from JSON object content at a dotted path
+func numericField(content []byte, field string) (float64, bool) {
+	var value interface{}
+	if err := json.Unmarshal(content, &value); err != nil {
+		return 0, false
+	}
+	for _, name := range strings.Split(field, ".") {
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return 0, false
+		}
+		value = obj[name]
+	}
+	n, ok := value.(float64)
+	return n, ok
+}
+
+// toBuckets merges storage slots into buckets in loc, filling in empty
+// buckets
+func toBuckets(rows []storage.AggregateRow, filter AggregateFilter, bucket Bucket, fn AggregateFunc, loc *time.Location) []AggregateBucket {
+	type totals struct {
+		count         int
+		sum, min, max float64
+	}
+	merged := make(map[time.Time]*totals)
+	var first, last time.Time
+	for _, row := range rows {
+		start := bucketStart(time.UnixMilli(row.Start).In(loc), bucket)
+		t := merged[start]
+		if t == nil {
+			t = &totals{min: math.Inf(1), max: math.Inf(-1)}
+			merged[start] = t
+		}
+		t.count += row.Count
+		t.sum += row.Sum
+		t.min = min(t.min, row.Min)
+		t.max = max(t.max, row.Max)
+		if first.IsZero() || start.Before(first) {
+			first = start
+		}
+		if start.After(last) {
+			last = start
+		}
+	}
+
+	if !filter.Since.IsZero() {
+		first = bucketStart(filter.Since.In(loc), bucket)
+	}
+	if !filter.Until.IsZero() {
+		last = bucketStart(filter.Until.Add(-time.Millisecond).In(loc), bucket)
+	}
+	if first.IsZero() || last.Before(first) {
+		return []AggregateBucket{}
+	}
+
+	var result []AggregateBucket
+	for start := first; !start.After(last); start = nextBucket(start, bucket) {
+		b := AggregateBucket{Start: start}
+		if t := merged[start]; t != nil {
+			b.Count = t.count
+			switch fn {
+			case AggCount:
+				b.Value = float64(t.count)
+			case AggSum:
+				b.Value = t.sum
+			case AggAvg:
+				b.Value = t.sum / float64(t.count)
+			case AggMin:
+				b.Value = t.min
+			case AggMax:
+				b.Value = t.max
+			}
+		}
+		result = append(result, b)
+	}
+	return result
+}
+
+// bucketStart returns the start of the bucket holding t, in t's location
+func bucketStart(t time.Time, bucket Bucket) time.Time {
+	y, m, d := t.Date()
+	switch bucket {
+	case BucketHour:
+		return time.Date(y, m, d, t.Hour(), 0, 0, 0, t.Location())
+	case BucketWeek:
+		monday := d - (int(t.Weekday())+6)%7
+		return time.Date(y, m, monday, 0, 0, 0, 0, t.Location())
+	case BucketMonth:
+		return time.Date(y, m, 1, 0, 0, 0, 0, t.Location())
+	}
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// nextBucket returns the start of the bucket after the one starting at
+// start
+func nextBucket(start time.Time, bucket Bucket) time.Time {
+	switch bucket {
+	case BucketHour:
+		return bucketStart(start.Add(time.Hour), bucket)
+	case BucketWeek:
+		return start.AddDate(0, 0, 7)
+	case BucketMonth:
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
@@ -0,0 +1,70 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/amaydixit11/acorde/internal/hooks"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ArchiveEntry archives an entry: it is kept and synced, but left out of
+// ListEntries and Search unless they ask for archived entries, and out of
+// QuickOpen. Archiving an archived entry is a no-op.
+func (e *engineImpl) ArchiveEntry(id uuid.UUID) error {
+	ctx, span := e.startSpan("acorde.ArchiveEntry", attribute.String("acorde.entry_id", id.String()))
+	err := e.setArchived(ctx, id, true)
+	endSpan(span, err)
+	return err
+}
+
+// UnarchiveEntry restores an archived entry. Unarchiving an entry that is
+// not archived is a no-op.
+func (e *engineImpl) UnarchiveEntry(id uuid.UUID) error {
+	ctx, span := e.startSpan("acorde.UnarchiveEntry", attribute.String("acorde.entry_id", id.String()))
+	err := e.setArchived(ctx, id, false)
+	endSpan(span, err)
+	return err
+}
+
+// setArchived writes the entry's archive register. It is merged apart
+// from content, so archiving on one device and editing on another keep
+// both changes.
+func (e *engineImpl) setArchived(ctx context.Context, id uuid.UUID, archived bool) error {
+	if !e.canWrite(id) {
+		return fmt.Errorf("permission denied")
+	}
+
+	current, err := e.replica.GetEntry(id)
+	if err != nil {
+		return convertCRDTError(err)
+	}
+	if current.Archived == archived {
+		return nil
+	}
+
+	if err := e.replica.SetArchived(id, archived); err != nil {
+		return convertCRDTError(err)
+	}
+
+	coreEntry, _ := e.replica.GetEntry(id)
+	e.cache.invalidate(id)
+	if err := e.storeFor(ctx).Put(coreEntry); err != nil {
+		return fmt.Errorf("failed to store archived entry: %w", err)
+	}
+
+	eventType := EventUnarchived
+	if archived {
+		eventType = EventArchived
+	}
+	e.notify(ctx, Event{
+		Type:      eventType,
+		EntryID:   id,
+		EntryType: string(coreEntry.Type),
+		Timestamp: time.Now(),
+	}, hooks.NewArchiveEvent(id, string(coreEntry.Type), archived))
+
+	return nil
+}
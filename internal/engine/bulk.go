@@ -0,0 +1,269 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/amaydixit11/acorde/internal/hooks"
+	"github.com/amaydixit11/acorde/internal/version"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// notification is an event and its matching hook event
+type notification struct {
+	event Event
+	hook  hooks.HookEvent
+}
+
+// bulkState buffers the side effects of one bulk operation. It travels
+// in the context of the operation, so changes made by other callers
+// while it runs (API writes, sync merges) are not caught up in it.
+type bulkState struct {
+	mu       sync.Mutex
+	depth    int
+	order    []uuid.UUID                 // entry IDs in first-seen order
+	pending  map[uuid.UUID]*notification // coalesced per-entry notifications (nil = cancelled out)
+	global   map[EventType]notification  // entry-less notifications (e.g. synced)
+	versions []version.Version
+	reindex  map[uuid.UUID]struct{} // entries whose search documents are stale
+}
+
+// bulkKey is the context key of the bulkState of a bulk operation
+type bulkKey struct{}
+
+// bulkFrom returns the bulk operation ctx is part of (nil = none)
+func bulkFrom(ctx context.Context) *bulkState {
+	state, _ := ctx.Value(bulkKey{}).(*bulkState)
+	return state
+}
+
+// Batch makes the changes of a Bulk call. Only changes made through it
+// are part of the bulk operation; changes made through the engine while
+// it runs are delivered and saved as usual.
+type Batch interface {
+	AddEntry(input AddEntryInput) (Entry, error)
+	UpdateEntry(id uuid.UUID, input UpdateEntryInput) error
+	DeleteEntry(id uuid.UUID) error
+	ArchiveEntry(id uuid.UUID) error
+	UnarchiveEntry(id uuid.UUID) error
+	AppendLog(records []LogRecord) ([]uuid.UUID, error)
+}
+
+// Bulk runs fn in bulk mode. Changes made through the Batch passed to fn
+// have their events and hooks coalesced per entry (e.g. created+updated
+// becomes one created, created+deleted disappears), and their version
+// writes and search indexing buffered. Everything is flushed once fn
+// returns, even if it fails, since the entry changes themselves are
+// already persisted.
+func (e *engineImpl) Bulk(fn func(b Batch) error) error {
+	return e.inBulk(context.Background(), func(ctx context.Context) error {
+		return fn(batch{e: e, ctx: ctx})
+	})
+}
+
+// inBulk runs fn as a bulk operation, or as part of the one ctx is
+// already in. The outermost call flushes.
+func (e *engineImpl) inBulk(ctx context.Context, fn func(ctx context.Context) error) error {
+	state := bulkFrom(ctx)
+	if state == nil {
+		state = &bulkState{
+			pending: make(map[uuid.UUID]*notification),
+			global:  make(map[EventType]notification),
+			reindex: make(map[uuid.UUID]struct{}),
+		}
+		ctx = context.WithValue(ctx, bulkKey{}, state)
+	}
+	state.mu.Lock()
+	state.depth++
+	state.mu.Unlock()
+
+	fnErr := fn(ctx)
+
+	state.mu.Lock()
+	state.depth--
+	outermost := state.depth == 0
+	state.mu.Unlock()
+
+	if !outermost {
+		return fnErr
+	}
+
+	flushErr := e.flushBulk(state)
+	if fnErr != nil {
+		return fnErr
+	}
+	return flushErr
+}
+
+// batch is the Batch of a bulk operation: the engine's changes, made in
+// its context
+type batch struct {
+	e   *engineImpl
+	ctx context.Context
+}
+
+func (b batch) AddEntry(input AddEntryInput) (Entry, error) {
+	ctx, span := b.e.startSpanIn(b.ctx, "acorde.AddEntry", attribute.String("acorde.entry_type", string(input.Type)))
+	entry, err := b.e.addEntry(ctx, input)
+	if err == nil {
+		span.SetAttributes(attribute.String("acorde.entry_id", entry.ID.String()))
+	}
+	endSpan(span, err)
+	return entry, err
+}
+
+func (b batch) UpdateEntry(id uuid.UUID, input UpdateEntryInput) error {
+	ctx, span := b.e.startSpanIn(b.ctx, "acorde.UpdateEntry", attribute.String("acorde.entry_id", id.String()))
+	err := b.e.updateEntry(ctx, id, input)
+	endSpan(span, err)
+	return err
+}
+
+func (b batch) DeleteEntry(id uuid.UUID) error {
+	ctx, span := b.e.startSpanIn(b.ctx, "acorde.DeleteEntry", attribute.String("acorde.entry_id", id.String()))
+	err := b.e.deleteEntry(ctx, id)
+	endSpan(span, err)
+	return err
+}
+
+func (b batch) ArchiveEntry(id uuid.UUID) error {
+	ctx, span := b.e.startSpanIn(b.ctx, "acorde.ArchiveEntry", attribute.String("acorde.entry_id", id.String()))
+	err := b.e.setArchived(ctx, id, true)
+	endSpan(span, err)
+	return err
+}
+
+func (b batch) UnarchiveEntry(id uuid.UUID) error {
+	ctx, span := b.e.startSpanIn(b.ctx, "acorde.UnarchiveEntry", attribute.String("acorde.entry_id", id.String()))
+	err := b.e.setArchived(ctx, id, false)
+	endSpan(span, err)
+	return err
+}
+
+func (b batch) AppendLog(records []LogRecord) ([]uuid.UUID, error) {
+	ctx, span := b.e.startSpanIn(b.ctx, "acorde.AppendLog", attribute.Int("acorde.records", len(records)))
+	ids, err := b.e.appendLog(ctx, records)
+	endSpan(span, err)
+	return ids, err
+}
+
+// flushBulk writes buffered versions, updates the search index and
+// delivers coalesced notifications
+func (e *engineImpl) flushBulk(state *bulkState) error {
+	var err error
+	if verr := e.versions.SaveVersions(state.versions); verr != nil {
+		err = fmt.Errorf("failed to save versions: %w", verr)
+	}
+
+	ids := make([]uuid.UUID, 0, len(state.reindex))
+	for id := range state.reindex {
+		ids = append(ids, id)
+	}
+	if ierr := e.updateIndex(ids); ierr != nil && err == nil {
+		err = ierr
+	}
+
+	for _, id := range state.order {
+		if n := state.pending[id]; n != nil {
+			e.deliver(*n)
+		}
+	}
+	for _, n := range state.global {
+		e.deliver(n)
+	}
+
+	return err
+}
+
+// notify publishes an event and triggers the matching hook, or buffers
+// both if ctx is part of a bulk operation. Every entry notification also
+// means the entry's search document is stale (and, for config entries,
+// the loaded groups and collections).
+func (e *engineImpl) notify(ctx context.Context, event Event, hookEvent hooks.HookEvent) {
+	if event.EntryID != uuid.Nil {
+		e.reindex(ctx, event.EntryID)
+		e.groupsChanged(event.EntryType)
+		e.collectionsChanged(event.EntryType)
+	}
+
+	state := bulkFrom(ctx)
+	if state == nil {
+		e.deliver(notification{event: event, hook: hookEvent})
+		return
+	}
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	next := notification{event: event, hook: hookEvent}
+	if event.EntryID == uuid.Nil {
+		state.global[event.Type] = next
+		return
+	}
+
+	prev, seen := state.pending[event.EntryID]
+	if !seen {
+		state.order = append(state.order, event.EntryID)
+		state.pending[event.EntryID] = &next
+		return
+	}
+	state.pending[event.EntryID] = coalesce(prev, next)
+}
+
+// coalesce folds the next notification for an entry into the pending one.
+// A nil result means the two cancel out.
+func coalesce(prev *notification, next notification) *notification {
+	if prev == nil {
+		// Previously cancelled (created+deleted); anything new starts fresh
+		return &next
+	}
+	if prev.event.Type == EventCreated {
+		switch next.event.Type {
+		case EventDeleted:
+			return nil
+		case EventUpdated:
+			next.event.Type = EventCreated
+			next.hook.Type = hooks.EventCreate
+		case EventArchived, EventUnarchived:
+			return prev // Subscribers see the archive state on the created entry
+		}
+	}
+	return &next
+}
+
+func (e *engineImpl) deliver(n notification) {
+	e.events.Publish(n.event)
+	if n.hook.Type != "" {
+		e.hooks.TriggerAsync(n.hook)
+	}
+}
+
+// saveVersion records a version of an entry made on this device, or
+// buffers it if ctx is part of a bulk operation
+func (e *engineImpl) saveVersion(ctx context.Context, id uuid.UUID, content []byte, tags []string, timestamp uint64) error {
+	return e.recordVersion(ctx, version.Version{
+		EntryID:   id,
+		Content:   content,
+		Tags:      tags,
+		Timestamp: timestamp,
+		CreatedAt: time.Now(),
+		Author:    e.localID,
+	})
+}
+
+// recordVersion records a version, or buffers it if ctx is part of a
+// bulk operation
+func (e *engineImpl) recordVersion(ctx context.Context, v version.Version) error {
+	if state := bulkFrom(ctx); state != nil {
+		state.mu.Lock()
+		state.versions = append(state.versions, v)
+		state.mu.Unlock()
+		return nil
+	}
+	if err := e.versions.SaveVersions([]version.Version{v}); err != nil {
+		return fmt.Errorf("failed to save versions: %w", err)
+	}
+	return nil
+}
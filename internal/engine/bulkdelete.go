@@ -0,0 +1,109 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/amaydixit11/acorde/internal/hooks"
+	"github.com/amaydixit11/acorde/internal/storage"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// DeleteBatchSize is the most tombstones DeleteWhere and DeleteEntries
+// store in one transaction
+const DeleteBatchSize = 500
+
+// DeleteWhere deletes the live entries matching filter, ignoring its
+// Limit, Offset and Sort, and returns how many it deleted. A filter with
+// no conditions deletes every entry.
+func (e *engineImpl) DeleteWhere(filter ListFilter) (int, error) {
+	ctx, span := e.startSpan("acorde.DeleteWhere")
+	filter.Deleted = false
+	filter.Limit, filter.Offset, filter.Sort = 0, 0, ""
+	filter.WithoutContent = true
+
+	listed, err := e.listMeta(ctx, filter)
+	var n int
+	if err == nil {
+		ids := make([]uuid.UUID, len(listed.Entries))
+		for i, entry := range listed.Entries {
+			ids[i] = entry.ID
+		}
+		n, err = e.deleteEntries(ctx, ids)
+	}
+	span.SetAttributes(attribute.Int("acorde.deleted", n))
+	endSpan(span, err)
+	return n, err
+}
+
+// DeleteEntries deletes entries by ID and returns how many it deleted.
+// An unknown ID deletes nothing; entries already deleted, and repeated
+// IDs, are skipped.
+func (e *engineImpl) DeleteEntries(ids []uuid.UUID) (int, error) {
+	ctx, span := e.startSpan("acorde.DeleteEntries", attribute.Int("acorde.count", len(ids)))
+	live := make([]uuid.UUID, 0, len(ids))
+	seen := make(map[uuid.UUID]bool, len(ids))
+	var err error
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		entry, ok := e.replica.GetEntryWithDeleted(id)
+		if !ok {
+			err = storage.ErrNotFound{ID: id}
+			break
+		}
+		if !entry.Deleted {
+			live = append(live, id)
+		}
+	}
+	var n int
+	if err == nil {
+		n, err = e.deleteEntries(ctx, live)
+	}
+	endSpan(span, err)
+	return n, err
+}
+
+// deleteEntries tombstones entries in batches of DeleteBatchSize, each
+// stored in one transaction. Batches stored before an error stay
+// deleted; their count is returned with it.
+func (e *engineImpl) deleteEntries(ctx context.Context, ids []uuid.UUID) (int, error) {
+	deleted := 0
+	err := e.inBulk(ctx, func(ctx context.Context) error {
+		for len(ids) > 0 {
+			batch := ids
+			if len(batch) > DeleteBatchSize {
+				batch = batch[:DeleteBatchSize]
+			}
+			ids = ids[len(batch):]
+
+			ops := make([]storage.Operation, 0, len(batch))
+			for _, id := range batch {
+				if err := e.replica.DeleteEntry(id); err != nil {
+					return convertCRDTError(err)
+				}
+				e.cache.invalidate(id)
+				tombstone, _ := e.replica.GetEntryWithDeleted(id)
+				ops = append(ops, storage.Operation{Type: storage.OpPut, Entry: tombstone})
+			}
+			if err := e.storeFor(ctx).ApplyBatch(ops); err != nil {
+				return fmt.Errorf("failed to store tombstones: %w", err)
+			}
+
+			for _, id := range batch {
+				e.notify(ctx, Event{
+					Type:      EventDeleted,
+					EntryID:   id,
+					Timestamp: time.Now(),
+				}, hooks.NewDeleteEvent(id))
+			}
+			deleted += len(batch)
+		}
+		return nil
+	})
+	return deleted, err
+}
@@ -0,0 +1,126 @@
+package engine
+
+import (
+	"sync/atomic"
+
+	"github.com/google/uuid"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+// DefaultCacheSize is the number of decrypted entries cached when
+// Config.CacheSize is 0
+const DefaultCacheSize = 1024
+
+// CacheStats reports decrypted entry cache usage
+type CacheStats struct {
+	Hits     uint64 `json:"hits"`
+	Misses   uint64 `json:"misses"`
+	Size     int    `json:"size"`
+	Capacity int    `json:"capacity"`
+}
+
+// HitRate returns the fraction of lookups served from the cache
+func (s CacheStats) HitRate() float64 {
+	if total := s.Hits + s.Misses; total > 0 {
+		return float64(s.Hits) / float64(total)
+	}
+	return 0
+}
+
+// entryCache is a bounded LRU of decrypted entries. An entry is only
+// served while its UpdatedAt matches, so a stale version is never
+// returned even if an invalidation is missed.
+type entryCache struct {
+	lru      *lru.Cache // nil = disabled
+	capacity int
+	hits     atomic.Uint64
+	misses   atomic.Uint64
+}
+
+// newEntryCache creates a cache holding up to size entries (disabled if
+// size < 0, DefaultCacheSize if 0)
+func newEntryCache(size int) *entryCache {
+	if size == 0 {
+		size = DefaultCacheSize
+	}
+	c := &entryCache{}
+	if size > 0 {
+		c.lru, _ = lru.New(size)
+		c.capacity = size
+	}
+	return c
+}
+
+// get returns a copy of the cached entry if it is at version updatedAt
+func (c *entryCache) get(id uuid.UUID, updatedAt uint64) (Entry, bool) {
+	if c.lru == nil {
+		return Entry{}, false
+	}
+	if v, ok := c.lru.Get(id); ok {
+		if entry := v.(Entry); entry.UpdatedAt == updatedAt {
+			c.hits.Add(1)
+			return copyEntry(entry), true
+		}
+	}
+	c.misses.Add(1)
+	return Entry{}, false
+}
+
+// contains reports whether the entry is cached at version updatedAt,
+// without counting a hit or miss
+func (c *entryCache) contains(id uuid.UUID, updatedAt uint64) bool {
+	if c.lru == nil {
+		return false
+	}
+	v, ok := c.lru.Peek(id)
+	return ok && v.(Entry).UpdatedAt == updatedAt
+}
+
+// put caches a copy of a decrypted entry
+func (c *entryCache) put(entry Entry) {
+	if c.lru != nil {
+		c.lru.Add(entry.ID, copyEntry(entry))
+	}
+}
+
+// invalidate drops cached entries
+func (c *entryCache) invalidate(ids ...uuid.UUID) {
+	if c.lru == nil {
+		return
+	}
+	for _, id := range ids {
+		c.lru.Remove(id)
+	}
+}
+
+// purge drops every cached entry
+func (c *entryCache) purge() {
+	if c.lru != nil {
+		c.lru.Purge()
+	}
+}
+
+// stats returns hit/miss counters and occupancy
+func (c *entryCache) stats() CacheStats {
+	s := CacheStats{
+		Hits:     c.hits.Load(),
+		Misses:   c.misses.Load(),
+		Capacity: c.capacity,
+	}
+	if c.lru != nil {
+		s.Size = c.lru.Len()
+	}
+	return s
+}
+
+// copyEntry copies content and tags so callers cannot modify the cache
+func copyEntry(entry Entry) Entry {
+	entry.Content = append([]byte(nil), entry.Content...)
+	entry.Tags = append([]string{}, entry.Tags...)
+	return entry
+}
+
+// CacheStats returns decrypted entry cache statistics
+func (e *engineImpl) CacheStats() CacheStats {
+	return e.cache.stats()
+}
@@ -0,0 +1,419 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/amaydixit11/acorde/internal/core"
+	"github.com/amaydixit11/acorde/internal/hooks"
+	"github.com/amaydixit11/acorde/internal/storage"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// CollectionTag marks the config entries holding collections
+const CollectionTag = "collection"
+
+// collectionKind identifies collection content among config entries
+const collectionKind = "collection"
+
+// ErrCollectionNotFound is returned for a collection the vault does not
+// have
+var ErrCollectionNotFound = errors.New("collection not found")
+
+// ErrCollectionExists is returned for a name already taken in the parent
+// collection
+var ErrCollectionExists = errors.New("collection already exists")
+
+// ErrCollectionNotEmpty is returned by DeleteCollection for a collection
+// holding entries or other collections
+var ErrCollectionNotEmpty = errors.New("collection is not empty")
+
+// ErrCollectionCycle is returned by MoveCollection for a move into the
+// collection itself or one of its descendants
+var ErrCollectionCycle = errors.New("collection cannot be moved into itself")
+
+// Collection is a named folder entries are filed in. Collections form a
+// tree; they are stored as config entries, so they sync like any other
+// entry. An entry is in at most one collection, independent of its tags.
+type Collection struct {
+	ID     uuid.UUID `json:"id"`              // ID of the config entry holding the collection
+	Name   string    `json:"name"`            // Unique among its siblings
+	Parent uuid.UUID `json:"parent,omitzero"` // uuid.Nil = top level
+	Path   string    `json:"path"`            // "/" separated names from the top, e.g. "/work/projects"
+}
+
+// collectionContent is the content of a config entry holding a
+// collection
+type collectionContent struct {
+	Kind   string    `json:"kind"`
+	Name   string    `json:"name"`
+	Parent uuid.UUID `json:"parent,omitzero"`
+}
+
+// collectionTree is the vault's collections, loaded from their config
+// entries
+type collectionTree struct {
+	byID  map[uuid.UUID]Collection
+	order []uuid.UUID // Oldest first
+}
+
+// validateCollectionName checks that a collection name is usable as a
+// path element
+func validateCollectionName(name string) error {
+	if strings.TrimSpace(name) != name || name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+		return fmt.Errorf("invalid collection name %q: names must be non-empty, without '/' or surrounding spaces", name)
+	}
+	return nil
+}
+
+// CreateCollection creates a collection in parent (uuid.Nil = at the top)
+func (e *engineImpl) CreateCollection(name string, parent uuid.UUID) (Collection, error) {
+	if err := validateCollectionName(name); err != nil {
+		return Collection{}, err
+	}
+	tree, err := e.loadCollections()
+	if err != nil {
+		return Collection{}, err
+	}
+	if err := tree.checkPlace(uuid.Nil, name, parent); err != nil {
+		return Collection{}, err
+	}
+	content, err := json.Marshal(collectionContent{Kind: collectionKind, Name: name, Parent: parent})
+	if err != nil {
+		return Collection{}, err
+	}
+	entry, err := e.AddEntry(AddEntryInput{
+		Type:    core.Config,
+		Content: content,
+		Tags:    []string{CollectionTag},
+	})
+	if err != nil {
+		return Collection{}, err
+	}
+	return e.GetCollection(entry.ID)
+}
+
+// ListCollections returns the vault's collections ordered by path
+func (e *engineImpl) ListCollections() ([]Collection, error) {
+	tree, err := e.loadCollections()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]Collection, 0, len(tree.byID))
+	for _, id := range tree.order {
+		list = append(list, tree.byID[id])
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Path < list[j].Path })
+	return list, nil
+}
+
+// GetCollection returns a collection by ID
+func (e *engineImpl) GetCollection(id uuid.UUID) (Collection, error) {
+	tree, err := e.loadCollections()
+	if err != nil {
+		return Collection{}, err
+	}
+	collection, ok := tree.byID[id]
+	if !ok {
+		return Collection{}, fmt.Errorf("%w: %s", ErrCollectionNotFound, id)
+	}
+	return collection, nil
+}
+
+// ResolveCollection returns the collection at a path such as
+// "/work/projects". The path "/" is the top level, returned as a
+// collection with a nil ID. If devices concurrently created collections
+// of the same name and parent, the oldest is used.
+func (e *engineImpl) ResolveCollection(path string) (Collection, error) {
+	tree, err := e.loadCollections()
+	if err != nil {
+		return Collection{}, err
+	}
+	current := Collection{Path: "/"}
+	for _, name := range strings.Split(path, "/") {
+		if name == "" {
+			continue
+		}
+		child, ok := tree.child(current.ID, name)
+		if !ok {
+			return Collection{}, fmt.Errorf("%w: %s", ErrCollectionNotFound, path)
+		}
+		current = child
+	}
+	return current, nil
+}
+
+// RenameCollection renames a collection, and so changes the path of
+// everything below it
+func (e *engineImpl) RenameCollection(id uuid.UUID, name string) (Collection, error) {
+	if err := validateCollectionName(name); err != nil {
+		return Collection{}, err
+	}
+	return e.updateCollection(id, func(tree *collectionTree, c *Collection) error {
+		c.Name = name
+		return tree.checkPlace(id, name, c.Parent)
+	})
+}
+
+// MoveCollection moves a collection, with everything below it, into
+// parent (uuid.Nil = to the top)
+func (e *engineImpl) MoveCollection(id, parent uuid.UUID) (Collection, error) {
+	return e.updateCollection(id, func(tree *collectionTree, c *Collection) error {
+		if tree.within(parent, id) {
+			return ErrCollectionCycle
+		}
+		c.Parent = parent
+		return tree.checkPlace(id, c.Name, parent)
+	})
+}
+
+// updateCollection applies change to a collection and stores the result
+func (e *engineImpl) updateCollection(id uuid.UUID, change func(*collectionTree, *Collection) error) (Collection, error) {
+	tree, err := e.loadCollections()
+	if err != nil {
+		return Collection{}, err
+	}
+	collection, ok := tree.byID[id]
+	if !ok {
+		return Collection{}, fmt.Errorf("%w: %s", ErrCollectionNotFound, id)
+	}
+	if err := change(tree, &collection); err != nil {
+		return Collection{}, err
+	}
+	content, err := json.Marshal(collectionContent{Kind: collectionKind, Name: collection.Name, Parent: collection.Parent})
+	if err != nil {
+		return Collection{}, err
+	}
+	if err := e.UpdateEntry(id, UpdateEntryInput{Content: &content}); err != nil {
+		return Collection{}, err
+	}
+	return e.GetCollection(id)
+}
+
+// DeleteCollection deletes an empty collection
+func (e *engineImpl) DeleteCollection(id uuid.UUID) error {
+	tree, err := e.loadCollections()
+	if err != nil {
+		return err
+	}
+	if _, ok := tree.byID[id]; !ok {
+		return fmt.Errorf("%w: %s", ErrCollectionNotFound, id)
+	}
+	for _, c := range tree.byID {
+		if c.Parent == id {
+			return fmt.Errorf("%w: it holds %s", ErrCollectionNotEmpty, c.Path)
+		}
+	}
+	filed, err := e.store.List(storage.ListFilter{Collections: []uuid.UUID{id}, Archived: true, Limit: 1})
+	if err != nil {
+		return err
+	}
+	if len(filed) > 0 {
+		return fmt.Errorf("%w: it holds entries", ErrCollectionNotEmpty)
+	}
+	return e.DeleteEntry(id)
+}
+
+// MoveEntry files an entry in a collection (uuid.Nil = in none). The
+// collection is its own register, merged apart from content, so moving
+// on one device and editing on another keep both changes.
+func (e *engineImpl) MoveEntry(id, collection uuid.UUID) error {
+	ctx, span := e.startSpan("acorde.MoveEntry", attribute.String("acorde.entry_id", id.String()))
+	err := e.moveEntry(ctx, id, collection)
+	endSpan(span, err)
+	return err
+}
+
+func (e *engineImpl) moveEntry(ctx context.Context, id, collection uuid.UUID) error {
+	if !e.canWrite(id) {
+		return fmt.Errorf("permission denied")
+	}
+	if collection != uuid.Nil {
+		if _, err := e.GetCollection(collection); err != nil {
+			return err
+		}
+	}
+
+	current, err := e.replica.GetEntry(id)
+	if err != nil {
+		return convertCRDTError(err)
+	}
+	if current.Collection == collection {
+		return nil
+	}
+
+	if err := e.replica.SetCollection(id, collection); err != nil {
+		return convertCRDTError(err)
+	}
+
+	coreEntry, _ := e.replica.GetEntry(id)
+	e.cache.invalidate(id)
+	if err := e.storeFor(ctx).Put(coreEntry); err != nil {
+		return fmt.Errorf("failed to store moved entry: %w", err)
+	}
+
+	e.notify(ctx, Event{
+		Type:      EventUpdated,
+		EntryID:   id,
+		EntryType: string(coreEntry.Type),
+		Timestamp: time.Now(),
+	}, hooks.NewUpdateEvent(id, string(coreEntry.Type), e.plaintext(coreEntry), coreEntry.Tags))
+
+	return nil
+}
+
+// collectionScope returns the collections a ListFilter lists the entries
+// of (nil = any)
+func (e *engineImpl) collectionScope(filter ListFilter) ([]uuid.UUID, error) {
+	if filter.Collection == nil {
+		return nil, nil
+	}
+	root := *filter.Collection
+	if !filter.Subcollections {
+		return []uuid.UUID{root}, nil
+	}
+	if root == uuid.Nil {
+		return nil, nil // Everything is below the top level
+	}
+	tree, err := e.loadCollections()
+	if err != nil {
+		return nil, err
+	}
+	scope := []uuid.UUID{root}
+	for _, id := range tree.order {
+		if id != root && tree.within(id, root) {
+			scope = append(scope, id)
+		}
+	}
+	return scope, nil
+}
+
+// loadCollections returns the vault's collections, loading them from
+// their config entries when they changed since last loaded
+func (e *engineImpl) loadCollections() (*collectionTree, error) {
+	e.collectionsMu.Lock()
+	defer e.collectionsMu.Unlock()
+	if e.collections != nil {
+		return e.collections, nil
+	}
+
+	entryType, tag := core.Config, CollectionTag
+	entries, err := e.store.List(storage.ListFilter{
+		Type: &entryType, Tag: &tag, Archived: true,
+		Sort: storage.SortCreatedAt, Ascending: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list collections: %w", err)
+	}
+
+	tree := &collectionTree{byID: make(map[uuid.UUID]Collection)}
+	for _, entry := range entries {
+		content, err := e.decrypt(entry.ID, entry.Content)
+		if err != nil {
+			return nil, err // Locked: try again once unlocked
+		}
+		var cc collectionContent
+		if json.Unmarshal(content, &cc) != nil || cc.Kind != collectionKind ||
+			validateCollectionName(cc.Name) != nil {
+			continue // Not a collection this version can read
+		}
+		tree.byID[entry.ID] = Collection{ID: entry.ID, Name: cc.Name, Parent: cc.Parent}
+		tree.order = append(tree.order, entry.ID)
+	}
+	tree.resolve()
+	e.collections = tree
+	return tree, nil
+}
+
+// collectionsChanged drops the loaded collections after a change to a
+// config entry
+func (e *engineImpl) collectionsChanged(entryType string) {
+	if entryType != string(core.Config) && entryType != "" {
+		return
+	}
+	e.collectionsMu.Lock()
+	e.collections = nil
+	e.collectionsMu.Unlock()
+}
+
+// resolve settles the tree and sets paths. Concurrent moves on different
+// devices can leave a collection under a deleted parent or make a cycle;
+// such collections are placed at the top level.
+func (t *collectionTree) resolve() {
+	var top []uuid.UUID
+	for _, id := range t.order {
+		if _, ok := t.byID[t.byID[id].Parent]; !ok || t.inCycle(id) {
+			top = append(top, id)
+		}
+	}
+	for _, id := range top {
+		c := t.byID[id]
+		c.Parent = uuid.Nil
+		t.byID[id] = c
+	}
+	for _, id := range t.order {
+		var names []string
+		for at := id; at != uuid.Nil; at = t.byID[at].Parent {
+			names = append(names, t.byID[at].Name)
+		}
+		c := t.byID[id]
+		var path strings.Builder
+		for i := len(names) - 1; i >= 0; i-- {
+			path.WriteString("/" + names[i])
+		}
+		c.Path = path.String()
+		t.byID[id] = c
+	}
+}
+
+// inCycle reports whether following parents from id leads back to it
+func (t *collectionTree) inCycle(id uuid.UUID) bool {
+	seen := map[uuid.UUID]bool{}
+	for at := t.byID[id].Parent; at != uuid.Nil && !seen[at]; at = t.byID[at].Parent {
+		if at == id {
+			return true
+		}
+		seen[at] = true
+	}
+	return false
+}
+
+// within reports whether collection id is ancestor or below it
+func (t *collectionTree) within(id, ancestor uuid.UUID) bool {
+	for at := id; at != uuid.Nil; at = t.byID[at].Parent {
+		if at == ancestor {
+			return true
+		}
+	}
+	return false
+}
+
+// child returns the oldest collection of a name in parent
+func (t *collectionTree) child(parent uuid.UUID, name string) (Collection, bool) {
+	for _, id := range t.order {
+		if c := t.byID[id]; c.Parent == parent && c.Name == name {
+			return c, true
+		}
+	}
+	return Collection{}, false
+}
+
+// checkPlace checks that collection id (uuid.Nil = a new one) can be
+// named name in parent
+func (t *collectionTree) checkPlace(id uuid.UUID, name string, parent uuid.UUID) error {
+	if parent != uuid.Nil {
+		if _, ok := t.byID[parent]; !ok {
+			return fmt.Errorf("%w: %s", ErrCollectionNotFound, parent)
+		}
+	}
+	if c, ok := t.child(parent, name); ok && c.ID != id {
+		return fmt.Errorf("%w: %s", ErrCollectionExists, c.Path)
+	}
+	return nil
+}
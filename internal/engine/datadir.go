@@ -0,0 +1,16 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+)
+
+// DefaultDataDir returns the data directory used when Config.DataDir is
+// empty: ~/.acorde, or %APPDATA%\acorde on Windows
+func DefaultDataDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return defaultDataDir(home)
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+
+package engine
+
+import "path/filepath"
+
+func defaultDataDir(home string) (string, error) {
+	return filepath.Join(home, ".acorde"), nil
+}
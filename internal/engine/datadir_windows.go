@@ -0,0 +1,20 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// defaultDataDir keeps using ~/.acorde where an earlier version created it
+func defaultDataDir(home string) (string, error) {
+	legacy := filepath.Join(home, ".acorde")
+	if _, err := os.Stat(legacy); err == nil {
+		return legacy, nil
+	}
+	appData, err := os.UserConfigDir() // %APPDATA%
+	if err != nil {
+		return "", fmt.Errorf("failed to get application data directory: %w", err)
+	}
+	return filepath.Join(appData, "acorde"), nil
+}
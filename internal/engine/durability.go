@@ -0,0 +1,40 @@
+package engine
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/amaydixit11/acorde/internal/core"
+	"github.com/amaydixit11/acorde/internal/storage/sqlite"
+)
+
+// Durability is re-exported from sqlite for use by pkg/engine wrapper
+type Durability = sqlite.Durability
+
+// persist stores an entry together with its new version and, if acl is
+// not nil, its ACL, in a single transaction: a crash never leaves an
+// entry without its history or owner. In a bulk operation the version is
+// buffered instead and saved when the operation completes.
+func (e *engineImpl) persist(ctx context.Context, entry core.Entry, acl *core.ACL, tags []string, timestamp uint64) error {
+	buffered := bulkFrom(ctx) != nil
+
+	err := e.storeFor(ctx).PutWith(entry, func(tx *sql.Tx) error {
+		if acl != nil {
+			if err := e.acls.SetACLTx(tx, *acl); err != nil {
+				return fmt.Errorf("failed to set ACL: %w", err)
+			}
+		}
+		if buffered {
+			return nil
+		}
+		return e.versions.SaveVersionTx(tx, entry.ID, entry.Content, tags, timestamp, e.localID)
+	})
+	if err != nil {
+		return err
+	}
+	if buffered {
+		return e.saveVersion(ctx, entry.ID, entry.Content, tags, timestamp)
+	}
+	return nil
+}
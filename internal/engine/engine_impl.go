@@ -1,42 +1,144 @@
 package engine
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/amaydixit11/acorde/internal/ack"
 	"github.com/amaydixit11/acorde/internal/acl"
+	"github.com/amaydixit11/acorde/internal/blob"
 	"github.com/amaydixit11/acorde/internal/core"
 	"github.com/amaydixit11/acorde/internal/hooks"
 	"github.com/amaydixit11/acorde/internal/crdt"
+	"github.com/amaydixit11/acorde/internal/quarantine"
+	"github.com/amaydixit11/acorde/internal/rules"
+	"github.com/amaydixit11/acorde/internal/templates"
 	"github.com/amaydixit11/acorde/internal/schema"
+	"github.com/amaydixit11/acorde/internal/search"
+	"github.com/amaydixit11/acorde/internal/sharing"
 	"github.com/amaydixit11/acorde/internal/version"
 	"github.com/amaydixit11/acorde/pkg/crypto"
 	"github.com/amaydixit11/acorde/internal/storage"
 	"github.com/amaydixit11/acorde/internal/storage/sqlite"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 
 // Config contains configuration options for the engine
 type Config struct {
-	DataDir       string
-	InMemory      bool
-	EncryptionKey *crypto.Key // *crypto.Key or nil
-	MaxVersions   int         // 0 = unlimited
+	DataDir        string
+	InMemory       bool
+	EncryptionKey  *crypto.Key           // *crypto.Key or nil
+	KeyEpoch       uint32                // Epoch of EncryptionKey (see crypto.EpochKey)
+	Cipher         crypto.CipherProvider // nil = crypto.DefaultCipher
+	MaxVersions    int                   // 0 = unlimited
+	DisableSearch  bool                  // Don't maintain a full-text search index
+	SearchAnalyzer string                // Bleve content analyzer ("" = standard)
+	RetiredKeys    []crypto.EpochKey     // Keys replaced by rotation, oldest first
+	EnableAcks     bool                  // Ack entries received through sync
+	CacheSize      int                   // Decrypted entries cached (0 = DefaultCacheSize, <0 = off)
+	Clock          ClockKind             // Clock for new changes ("" = Lamport)
+	IDs            IDKind                // IDs of new entries ("" = random UUIDv4)
+
+	// GetEntry prefetches the entries an entry links to and from into the
+	// cache in the background (see Prefetch), unless DisablePrefetch
+	DisablePrefetch bool
+
+	// Merges quarantine entry versions whose timestamps are further ahead
+	// of local wall time (HLC) or the local clock (Lamport ticks).
+	// MaxClockSkew: 0 = DefaultMaxClockSkew, <0 = off. MaxLogicalSkew:
+	// 0 = off.
+	MaxClockSkew   time.Duration
+	MaxLogicalSkew uint64
+
+	// OnQuarantine is called for each entry version a merge quarantines
+	OnQuarantine func(QuarantinedEntry)
+
+	// Entry limits, checked on plaintext by AddEntry and UpdateEntry
+	// (0 = default, <0 = unlimited)
+	MaxContentSize  int // Bytes
+	MaxTagsPerEntry int
+	MaxTagLength    int // Characters
+
+	// StrictSchemas makes AddEntry, AppendLog and entries copied or moved
+	// into the vault fail with ErrNoSchema for entry types without a
+	// registered schema (config and file entries, whose content the
+	// engine defines, are exempt). Merges from peers are never refused.
+	StrictSchemas bool
+
+	// BuiltinSchemas registers the shipped schemas for the task, contact
+	// and bookmark entry types (credential's is always registered)
+	BuiltinSchemas bool
+
+	// DisableBlobRouting rejects content over MaxContentSize. Otherwise
+	// AddEntry stores it in the blob store (see StoreFile) and adds a File
+	// entry referencing it, on vaults on disk; UpdateEntry turns the entry
+	// into one.
+	DisableBlobRouting bool
+
+	// DisableACL turns entry ACLs off for good: entries get no ACL and
+	// reads and writes are never checked, even once entries are shared
+	// (ShareEntry fails with ErrACLDisabled). Otherwise checks start when
+	// an entry is first shared with a peer.
+	DisableACL bool
+
+	// PeerKeys resolves a peer ID to its X25519 device public key, for
+	// ShareEntry and to verify owners of entries shared with this device
+	PeerKeys func(peerID string) ([]byte, error)
+
+	// Extensions are called, in order, on engine lifecycle and changes
+	Extensions []Extension
+
+	// LazyLoad skips hydrating the replica at startup: entries are loaded
+	// from storage as they are read, changed or merged, and all of them
+	// the first time the whole replica is needed (sync payloads, key
+	// rotation). Lists, queries and indexing read storage.
+	LazyLoad bool
+
+	// Durability selects when committed writes reach the disk of vaults
+	// on disk ("" = DurabilitySync). Either way a crash never leaves an
+	// entry without its version or ACL, and Close flushes everything.
+	Durability Durability
+
+	// TracerProvider receives spans for engine operations, their storage
+	// queries and merges (nil = no tracing)
+	TracerProvider trace.TracerProvider
 }
 
 // EntryType is re-exported from core for use by pkg/engine wrapper
 type EntryType = core.EntryType
 
+// Ack is re-exported from core for use by pkg/engine wrapper
+type Ack = core.Ack
+
+// ClockKind is re-exported from core for use by pkg/engine wrapper
+type ClockKind = core.ClockKind
+
+// MergeStats is re-exported from crdt for use by pkg/engine wrapper
+type MergeStats = crdt.MergeStats
+
+// IDKind is re-exported from core for use by pkg/engine wrapper
+type IDKind = core.IDKind
+
 // AddEntryInput contains parameters for adding a new entry
 type AddEntryInput struct {
-	Type    EntryType
-	Content []byte
-	Tags    []string
-	Public  bool
+	Type      EntryType
+	Content   []byte
+	Tags      []string
+	Public    bool
+	Namespace string // "" = the default namespace (see ValidateNamespace)
 }
 
 // UpdateEntryInput contains parameters for updating an entry
@@ -54,8 +156,40 @@ type ListFilter struct {
 	Deleted bool
 	Limit   int
 	Offset  int
+
+	Archived     bool // Include archived entries
+	OnlyArchived bool // Only archived entries
+
+	// Collection lists only the entries filed in a collection (uuid.Nil =
+	// entries in none); with Subcollections, also those filed below it
+	Collection     *uuid.UUID
+	Subcollections bool
+
+	Namespace *string // Only entries in this namespace (nil = any)
+
+	Sort      SortField // "" = SortUpdatedAt
+	Ascending bool
+
+	// WithoutContent lists metadata only: content is neither read nor
+	// decrypted, and Entry.Content is nil
+	WithoutContent bool
 }
 
+// SortField is a field ListEntries orders entries by
+type SortField = storage.SortField
+
+const (
+	SortUpdatedAt = storage.SortUpdatedAt
+	SortCreatedAt = storage.SortCreatedAt
+
+	// SortTitle orders by Entry.Title, case-insensitively, untitled
+	// entries last. Plaintext vaults store titles as entries are indexed
+	// and sort in the database; titles of encrypted vaults are kept out of
+	// it, so those sort by the in-memory title index and decrypt only the
+	// page listed.
+	SortTitle = storage.SortTitle
+)
+
 // Entry is the internal entry type
 type Entry struct {
 	ID        uuid.UUID
@@ -65,29 +199,187 @@ type Entry struct {
 	CreatedAt uint64
 	UpdatedAt uint64
 	Deleted   bool
+	Archived  bool      // Hidden from default lists and search
 	Owner     string    // PeerID of creator/owner
+
+	Collection uuid.UUID // Collection the entry is filed in (uuid.Nil = none)
+	Namespace  string    // Namespace the entry was created in ("" = default)
+
+	CreatedTime time.Time // Wall-clock creation time (zero if unknown)
+	UpdatedTime time.Time // Wall-clock time of the last change (zero if unknown)
+
+	SchemaVersion int    // Schema version of the content (0 = unknown)
+	Author        string // PeerID of the last change ("" = unknown)
+
+	Title string // Display title extracted from the content ("" = none)
 }
 
-// Engine is the main interface for acorde
+// Engine is the main interface for acorde. It is safe for concurrent use
+// by multiple goroutines.
 type Engine interface {
 	// Entry lifecycle
 	AddEntry(input AddEntryInput) (Entry, error)
 	GetEntry(id uuid.UUID) (Entry, error)
 	UpdateEntry(id uuid.UUID, input UpdateEntryInput) error
+	ResolveID(prefix string) (uuid.UUID, error)
+	Resolve(ref string) (uuid.UUID, error)
 	DeleteEntry(id uuid.UUID) error
+	DeleteEntries(ids []uuid.UUID) (int, error)
+	DeleteWhere(filter ListFilter) (int, error)
 
 	// Querying
 	ListEntries(filter ListFilter) ([]Entry, error)
+	ListEntriesChecked(filter ListFilter) (ListResult, error)
+	Count(filter ListFilter) (int, error)
+	Exists(id uuid.UUID) (bool, error)
+
+	// Namespaces counts live entries by namespace ("" = the default one)
+	Namespaces() (map[string]int, error)
+
+	// VerifyIntegrity reports entries and versions that do not decrypt
+	VerifyIntegrity() (IntegrityReport, error)
 
 	// Sync hooks (called by transport layer)
 	GetSyncPayload() ([]byte, error)
+	GetSyncDelta(since uint64) ([]byte, error)
+	ChangesSince(since uint64) (Changes, error)
 	ApplyRemotePayload(payload []byte) error
+	MergeRemotePayload(payload []byte) (MergeStats, error)
+	MergeRemotePayloadFrom(from string, payload []byte) (MergeStats, error)
 
 	// Events
 	Subscribe() Subscription
+	SubscribeWithOptions(opts SubscriptionOptions) (Subscription, error)
+	Watch(id uuid.UUID) Subscription
+	WatchQuery(filter ListFilter) Subscription
+
+	// Events subscriptions did not deliver because their buffer was full
+	DroppedEvents() uint64
+
+	// PublishSyncEvent publishes a sync lifecycle event (peer connected,
+	// sync started, ...) reported by the sync service running alongside
+	PublishSyncEvent(event Event) error
+
+	// Bulk runs fn with the events/hooks of the changes it makes through
+	// its Batch coalesced and their version writes batched
+	Bulk(fn func(b Batch) error) error
+
+	// Archive hides an entry from default lists and search; unarchive restores it
+	ArchiveEntry(id uuid.UUID) error
+	UnarchiveEntry(id uuid.UUID) error
+
+	// PatchEntry applies a JSON Patch or merge patch and tag changes
+	PatchEntry(id uuid.UUID, patch EntryPatch) (Entry, error)
+
+	// StoreFile stores a file's content as blobs, sealed on encrypted vaults
+	StoreFile(name string, data []byte) (blob.FileContent, error)
+
+	// Copy or move an entry, with its history, ACL and blobs, to another vault
+	CopyEntryTo(id uuid.UUID, dst Engine) (Entry, error)
+	MoveEntryTo(id uuid.UUID, dst Engine) (Entry, error)
+
+	// AppendLog adds log entries on a batched write path
+	AppendLog(records []LogRecord) ([]uuid.UUID, error)
+
+	// Aggregate groups entries into time buckets by creation time
+	Aggregate(filter AggregateFilter, bucket Bucket, agg Aggregation) ([]AggregateBucket, error)
+
+	// Search runs a full-text query (ErrSearchDisabled if no index)
+	Search(query string, opts search.SearchOptions) (*search.Results, error)
+
+	// QuickOpen fuzzy-matches entry titles and metadata
+	QuickOpen(query string, limit int) []search.TitleMatch
+
+	// Key rotation (ErrNotEncrypted on unencrypted vaults)
+	RotateKey(newKey crypto.Key) error
+	AdoptKey(newKey crypto.EpochKey) error
+
+	// Lock drops the vault key from memory; Unlock restores it
+	Lock() error
+	Unlock(key crypto.Key) error
+
+	// EncryptionStatus reports whether the vault is encrypted and locked
+	EncryptionStatus() EncryptionStatus
+
+	// ShareEntry encrypts an entry with its own key, wrapped for each peer
+	ShareEntry(id uuid.UUID, peerIDs []string) error
+
+	// EntryAcks lists the devices that acknowledged receiving an entry
+	EntryAcks(id uuid.UUID) ([]Ack, error)
+
+	// Version history, decrypted, and restoring a version
+	History(id uuid.UUID, limit, offset int) ([]Version, int, error)
+	GetVersion(id uuid.UUID, versionID int64) (Version, error)
+	DiffVersions(id uuid.UUID, from, to int64) (VersionDiff, error)
+	RestoreVersion(id uuid.UUID, versionID int64) (Entry, error)
+
+	// Other devices that changed an entry within a window of now
+	RecentEditors(id uuid.UUID, window time.Duration) ([]Editor, error)
+
+	// Creates, updates and deletions across the vault, most recent first
+	Timeline(filter TimelineFilter, limit int) ([]TimelineEvent, error)
+
+	// Entry versions merges rejected for implausible timestamps
+	Quarantined() ([]QuarantinedEntry, error)
+	ClearQuarantine() error
+
+	// Prefetch loads entries into the decrypted entry cache
+	Prefetch(ids []uuid.UUID) int
+
+	// CacheStats reports decrypted entry cache hits and misses
+	CacheStats() CacheStats
+
+	// Stats summarizes entries, creation activity, storage use and
+	// version history
+	Stats() (VaultStats, error)
+
+	// Ping checks that storage is reachable
+	Ping() error
+
+	// Auto-tagging rules, stored as config entries
+	AddRule(rule rules.Rule) (rules.Rule, error)
+	ListRules() ([]rules.Rule, error)
+	RemoveRule(id uuid.UUID) error
+
+	// ACL groups: named sets of peers, stored as config entries, that
+	// entry ACLs grant access to as a whole
+	CreateGroup(name string, members []string) (acl.Group, error)
+	ListGroups() ([]acl.Group, error)
+	GetGroup(name string) (acl.Group, error)
+	UpdateGroup(name string, add, remove []string) (acl.Group, error)
+	DeleteGroup(name string) error
+	GrantGroup(id uuid.UUID, name string, write bool) error
+	RevokeGroup(id uuid.UUID, name string) error
+
+	// Collections: a tree of named folders, stored as config entries,
+	// that entries are filed in apart from their tags
+	CreateCollection(name string, parent uuid.UUID) (Collection, error)
+	ListCollections() ([]Collection, error)
+	GetCollection(id uuid.UUID) (Collection, error)
+	ResolveCollection(path string) (Collection, error)
+	RenameCollection(id uuid.UUID, name string) (Collection, error)
+	MoveCollection(id, parent uuid.UUID) (Collection, error)
+	DeleteCollection(id uuid.UUID) error
+	MoveEntry(id, collection uuid.UUID) error
+
+	// Templates: named skeletons for new entries, stored as config entries
+	SaveTemplate(tmpl templates.Template) (templates.Template, error)
+	ListTemplates() ([]templates.Template, error)
+	GetTemplate(name string) (templates.Template, error)
+	DeleteTemplate(name string) error
+	AddFromTemplate(name string, vars map[string]string, tags []string) (Entry, error)
+
+	// Schemas saved in the vault as config entries, and validation
+	SaveSchema(entryType string, definition []byte) (StoredSchema, error)
+	ListSchemas() ([]StoredSchema, error)
+	GetSchema(entryType string) (StoredSchema, error)
+	DeleteSchema(entryType string) error
+	ValidateContent(entryType string, content []byte) (ValidationResult, error)
 
 	// Features
 	RegisterSchema(entryType string, schemaJSON []byte) error
+	RegisterSchemaVersion(entryType string, version int, schemaJSON []byte, migrator SchemaMigrator) error
+	MigrateType(entryType string) (int, error)
 	
 	// Accessors for new features
 	Versions() *version.Store
@@ -102,31 +394,74 @@ type Engine interface {
 // Replica is the source of truth, Storage is a materialized view
 
 type engineImpl struct {
-	replica  *crdt.Replica    // CRDT state (source of truth)
-	store    storage.Store    // Persistent storage (materialized view)
-	key      *crypto.Key      // Encryption key (nil = disabled)
-	events   *EventBus        // Event subscriptions
-	schemas  *schema.Registry // Schema validation
-	versions *version.Store   // Version history
-	acls     *acl.Store       // Access control
-	hooks    *hooks.Manager   // Webhooks
-	localID  string           // Local Peer ID
+	replica  *crdt.Replica         // CRDT state (source of truth)
+	store    storage.Store         // Persistent storage (materialized view)
+	key      *crypto.Key           // Encryption key (nil = disabled)
+	cipher   crypto.CipherProvider // Content cipher
+	events   *EventBus             // Event subscriptions
+	schemas  *schema.Registry      // Schema validation
+	strict   bool                  // Refuse new entries of types without a schema
+	newID    func() uuid.UUID      // Generates IDs of new entries
+	versions *version.Store        // Version history
+	acls     *acl.Store            // Access control
+	aclOff   bool                  // Config.DisableACL (see aclEnforced)
+	acks     *ack.Store            // Delivery acks
+	ackSync  bool                  // Record acks for merged entries
+	skew     skewLimits            // Timestamp sanity limits for merges
+	limits   entryLimits           // Content and tag limits for changes
+	blobs    *blob.Store           // Oversized content (nil = rejected)
+	hooks    *hooks.Manager        // Webhooks
+	index    *search.Index         // Full-text search (nil = disabled)
+	titles   *search.TitleIndex    // Quick-open title/metadata index
+	cache    *entryCache           // Decrypted entries
+	prefetch *prefetcher           // Prefetches linked entries (nil = off)
+	localID  string                // Local Peer ID
+
+	keyMu   sync.RWMutex
+	epoch   uint32            // Epoch of key, named by what it seals
+	retired []crypto.EpochKey // Keys replaced by rotation, oldest first
+	locked  *lockState        // Set while Lock has the key out of memory
+
+	device    *sharing.KeyPair             // X25519 key for per-entry sharing
+	peerKeys  func(string) ([]byte, error) // Peer ID → device public key
+	shareMu   sync.Mutex
+	entryKeys map[uuid.UUID]crypto.Key // Recovered keys of shared entries
+
+	patchMu sync.Mutex // Serializes PatchEntry read-modify-writes
+
+	groupsMu sync.Mutex
+	groups   map[string]acl.Group // ACL groups by name (nil = reload, see loadGroups)
+
+	collectionsMu sync.Mutex
+	collections   *collectionTree // nil = reload, see loadCollections
+
+	storedMu      sync.Mutex
+	storedSchemas map[string]bool // Entry types whose schema was loaded from the vault
+	builtins      bool            // Config.BuiltinSchemas
+
+	quarantine   *quarantine.Store // Entry versions merges rejected
+	onQuarantine func(QuarantinedEntry)
+
+	extensions []Extension
+
+	tracer trace.Tracer
+
+	dataDir string // "" for in-memory vaults
 }
 
 // New creates a new engine instance
 func New(cfg Config) (Engine, error) {
-	var dbPath string
+	var dbPath, dataDir string
 
 	if cfg.InMemory {
 		dbPath = ":memory:"
 	} else {
-		dataDir := cfg.DataDir
+		dataDir = cfg.DataDir
 		if dataDir == "" {
-			home, err := os.UserHomeDir()
-			if err != nil {
-				return nil, fmt.Errorf("failed to get home directory: %w", err)
+			var err error
+			if dataDir, err = DefaultDataDir(); err != nil {
+				return nil, err
 			}
-			dataDir = filepath.Join(home, ".acorde")
 		}
 
 		// Create data directory if it doesn't exist
@@ -137,7 +472,12 @@ func New(cfg Config) (Engine, error) {
 		dbPath = filepath.Join(dataDir, "acorde.db")
 	}
 
-	store, err := sqlite.New(dbPath)
+	durability, err := sqlite.ParseDurability(string(cfg.Durability))
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := sqlite.Open(dbPath, durability)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create storage: %w", err)
 	}
@@ -150,30 +490,48 @@ func New(cfg Config) (Engine, error) {
 	}
 
 	// Create CRDT Replica with recovered clock
-	clock := core.NewClockWithTime(maxTime)
-	replica := crdt.NewReplica(clock)
-
-	// Hydrate replica from storage (load existing entries into CRDT)
-	entries, err := store.List(storage.ListFilter{Deleted: true})
+	clockKind, err := core.ParseClockKind(string(cfg.Clock))
 	if err != nil {
 		store.Close()
-		return nil, fmt.Errorf("failed to load entries: %w", err)
+		return nil, err
 	}
-	for _, entry := range entries {
-		replica.HydrateEntry(entry)
+	clock := core.NewClockOfKind(clockKind, maxTime)
+	replica := crdt.NewReplica(clock)
+	idKind, err := core.ParseIDKind(string(cfg.IDs))
+	if err != nil {
+		store.Close()
+		return nil, err
 	}
 
-	// Initialize ACL Store
-	var localPeerID string
-	nodeIDPath := filepath.Join(filepath.Dir(dbPath), "node_id")
-	
-	if idBytes, err := os.ReadFile(nodeIDPath); err == nil {
-		localPeerID = string(idBytes)
+	// Hydrate replica from storage (load existing entries into CRDT), or
+	// have it load them as they are needed
+	if cfg.LazyLoad {
+		replica.SetLoader(storageLoader(store))
 	} else {
-		localPeerID = uuid.New().String()
-		os.WriteFile(nodeIDPath, []byte(localPeerID), 0644)
+		entries, err := store.List(storage.ListFilter{Deleted: true, Archived: true})
+		if err != nil {
+			store.Close()
+			return nil, fmt.Errorf("failed to load entries: %w", err)
+		}
+		for _, entry := range entries {
+			replica.HydrateEntry(entry)
+		}
 	}
 
+	// Initialize ACL Store. In-memory engines get a fresh node ID: there
+	// is no data directory to keep it in.
+	localPeerID := uuid.New().String()
+	if dataDir != "" {
+		nodeIDPath := filepath.Join(dataDir, "node_id")
+		if idBytes, err := os.ReadFile(nodeIDPath); err == nil {
+			localPeerID = string(idBytes)
+		} else {
+			os.WriteFile(nodeIDPath, []byte(localPeerID), 0644)
+		}
+	}
+
+	replica.SetAuthor(localPeerID) // Merges check authors against ACLs
+
 	aclStore, err := acl.NewStore(store.GetDB(), localPeerID)
 	if err != nil {
 		store.Close()
@@ -189,9 +547,59 @@ func New(cfg Config) (Engine, error) {
 	for _, a := range acls {
 		replica.SetACL(a)
 	}
+
+	// Initialize Ack Store and hydrate acks
+	ackStore, err := ack.NewStore(store.GetDB())
+	if err != nil {
+		store.Close()
+		return nil, fmt.Errorf("failed to create ack store: %w", err)
+	}
+	acks, err := ackStore.List()
+	if err != nil {
+		store.Close()
+		return nil, fmt.Errorf("failed to load acks: %w", err)
+	}
+	for _, a := range acks {
+		replica.SetAck(a)
+	}
+
 	var key *crypto.Key
 	if cfg.EncryptionKey != nil {
-		key = cfg.EncryptionKey
+		k := *cfg.EncryptionKey // Our own copy, for Lock to wipe
+		key = &k
+	}
+	cipher := cfg.Cipher
+	if cipher == nil {
+		cipher = crypto.DefaultCipher
+	}
+
+	// SQLite's own full-text index only holds plaintext content, and
+	// is dropped once a vault is encrypted (without FTS5 it stays off)
+	if err := store.SetFullTextIndex(key == nil && !cfg.DisableSearch); err != nil && !errors.Is(err, sqlite.ErrFullTextUnavailable) {
+		store.Close()
+		return nil, fmt.Errorf("failed to set up full-text index: %w", err)
+	}
+	// ...and so are titles stored for sorting
+	if key != nil {
+		if err := store.ClearTitles(); err != nil {
+			store.Close()
+			return nil, err
+		}
+	}
+
+	// Blob store for oversized content
+	var blobs *blob.Store
+	if !cfg.InMemory && !cfg.DisableBlobRouting {
+		if blobs, err = blob.NewStore(dataDir); err != nil {
+			store.Close()
+			return nil, err
+		}
+	}
+
+	quarantineStore, err := quarantine.NewStore(store.GetDB())
+	if err != nil {
+		store.Close()
+		return nil, fmt.Errorf("failed to create quarantine store: %w", err)
 	}
 
 	// Initialize Version Store
@@ -201,88 +609,226 @@ func New(cfg Config) (Engine, error) {
 		return nil, fmt.Errorf("failed to create version store: %w", err)
 	}
 
-	return &engineImpl{
+	// Device key for per-entry sharing (shared with the sync layer's key
+	// grants)
+	var device *sharing.KeyPair
+	if cfg.InMemory {
+		device, err = sharing.GenerateKeyPair()
+	} else {
+		device, err = sharing.LoadOrCreateKeyPair(filepath.Join(dataDir, "device.key"))
+	}
+	if err != nil {
+		store.Close()
+		return nil, fmt.Errorf("failed to load device key: %w", err)
+	}
+
+	// Initialize Search Index
+	index, err := openSearchIndex(cfg, dataDir)
+	if err != nil {
+		store.Close()
+		return nil, fmt.Errorf("failed to open search index: %w", err)
+	}
+
+	e := &engineImpl{
 		replica:  replica,
 		store:    store,
 		key:      key,
+		cipher:   cipher,
 		events:   NewEventBus(),
 		schemas:  schema.NewRegistry(),
+		strict:   cfg.StrictSchemas,
+		newID:    core.NewIDGenerator(idKind),
 		versions: versionStore,
 		acls:     aclStore,
+		aclOff:   cfg.DisableACL,
+		acks:     ackStore,
+		ackSync:  cfg.EnableAcks,
+		skew:     newSkewLimits(cfg),
+		limits:   newEntryLimits(cfg),
+		blobs:    blobs,
 		hooks:    hooks.NewManager(),
+		index:    index,
+		titles:   search.NewTitleIndex(),
+		cache:    newEntryCache(cfg.CacheSize),
 		localID:  localPeerID,
-	}, nil
+		epoch:    cfg.KeyEpoch,
+		retired:  append([]crypto.EpochKey(nil), cfg.RetiredKeys...),
+
+		device:    device,
+		peerKeys:  cfg.PeerKeys,
+		entryKeys: make(map[uuid.UUID]crypto.Key),
+
+		extensions: append([]Extension(nil), cfg.Extensions...),
+
+		quarantine:   quarantineStore,
+		onQuarantine: cfg.OnQuarantine,
+
+		tracer: newTracer(cfg.TracerProvider),
+
+		dataDir: dataDir,
+	}
+
+	// Built-in types with a fixed shape (RegisterSchema can replace them)
+	if err := e.schemas.RegisterFromJSON(string(core.Credential), "credential-schema", schema.CredentialSchema); err != nil {
+		e.Close()
+		return nil, fmt.Errorf("failed to register credential schema: %w", err)
+	}
+	if cfg.BuiltinSchemas {
+		for _, entryType := range []core.EntryType{core.Task, core.Contact, core.Bookmark} {
+			name := string(entryType) + "-schema"
+			if err := e.schemas.RegisterFromJSON(string(entryType), name, schema.Builtin[string(entryType)]); err != nil {
+				e.Close()
+				return nil, fmt.Errorf("failed to register %s schema: %w", entryType, err)
+			}
+		}
+	}
+	e.builtins = cfg.BuiltinSchemas
+	e.acls.SetGroupResolver(e.groupMembers)
+	e.hooks.SetSensitive(e.schemas.Sensitive)
+	e.hooks.SetBackfillSource(e.backfillEntries)
+
+	if err := e.loadSchemas(); err != nil {
+		e.Close()
+		return nil, fmt.Errorf("failed to load schemas: %w", err)
+	}
+
+	if err := e.syncIndex(cfg, dataDir); err != nil {
+		e.Close()
+		return nil, fmt.Errorf("failed to build search index: %w", err)
+	}
+
+	// Finish a rotation received while offline
+	if key != nil && len(e.retired) > 0 {
+		if err := e.reencrypt(false); err != nil {
+			e.Close()
+			return nil, fmt.Errorf("failed to re-encrypt with rotated key: %w", err)
+		}
+	}
+
+	if err := e.startExtensions(); err != nil {
+		e.extensions = nil // Already stopped
+		e.Close()
+		return nil, err
+	}
+
+	if !cfg.DisablePrefetch && cfg.CacheSize >= 0 {
+		e.prefetch = newPrefetcher(e.prefetchLinked)
+	}
+
+	return e, nil
 }
 
 // AddEntry creates a new entry
 func (e *engineImpl) AddEntry(input AddEntryInput) (Entry, error) {
+	ctx, span := e.startSpan("acorde.AddEntry", attribute.String("acorde.entry_type", string(input.Type)))
+	entry, err := e.addEntry(ctx, input)
+	if err == nil {
+		span.SetAttributes(attribute.String("acorde.entry_id", entry.ID.String()))
+	}
+	endSpan(span, err)
+	return entry, err
+}
+
+func (e *engineImpl) addEntry(ctx context.Context, input AddEntryInput) (Entry, error) {
+	if err := e.beforeAdd(&input); err != nil {
+		return Entry{}, err
+	}
 	if !input.Type.IsValid() {
 		return Entry{}, fmt.Errorf("invalid entry type: %s", input.Type)
 	}
-
-	// Validate against schema if registered
-	result := e.schemas.Validate(string(input.Type), input.Content)
-	if !result.Valid {
-		return Entry{}, fmt.Errorf("schema validation failed: %v", result.Errors)
+	if err := ValidateNamespace(input.Namespace); err != nil {
+		return Entry{}, err
+	}
+	if err := e.requireSchema(input.Type); err != nil {
+		return Entry{}, err // Before oversized content is stored as a file
 	}
 
-	// Generate ID for AAD binding
-	id := uuid.New()
+	// Auto-tagging rules
+	input.Content, input.Tags, _ = e.applyRules(input.Type, input.Content, input.Tags)
 
-	// Encrypt content if key is present
-	content := input.Content
-	if e.key != nil {
-		aad := []byte(id.String()) // Bind ID to content
-		encrypted, err := crypto.Encrypt(*e.key, content, aad)
+	if err := e.limits.checkContent(input.Content); err != nil {
+		if e.blobs == nil || input.Type == core.File || input.Type == core.Config {
+			return Entry{}, err
+		}
+		// Too large for an entry: store it as a file
+		fc, err := e.StoreFile("", input.Content)
 		if err != nil {
-			return Entry{}, fmt.Errorf("encryption failed: %w", err)
+			return Entry{}, fmt.Errorf("failed to store oversized content: %w", err)
+		}
+		if input.Content, err = json.Marshal(fc); err != nil {
+			return Entry{}, err
 		}
-		content = encrypted
+		input.Type = core.File
+	}
+	if err := e.limits.checkTags(input.Tags); err != nil {
+		return Entry{}, err
+	}
+
+	if err := e.validateNew(input.Type, input.Content); err != nil {
+		return Entry{}, err
+	}
+
+	// Generate ID for AAD binding
+	id := e.newID()
+
+	// Encrypt content if key is present (ID bound as AAD)
+	content, err := e.encrypt(id, input.Content)
+	if err != nil {
+		return Entry{}, fmt.Errorf("encryption failed: %w", err)
 	}
 
 	// Add to CRDT Replica (source of truth)
-	coreEntry := e.replica.AddEntryWithID(id, input.Type, content, input.Tags)
+	coreEntry := e.replica.AddEntryNamespaced(id, input.Namespace, input.Type, content, input.Tags, 0, e.schemas.Version(string(input.Type)))
+
+	// Default ACL (Private, Owned by creator)
+	var defaultACL *core.ACL
+	if !e.aclOff {
+		defaultACL = &core.ACL{
+			EntryID:   coreEntry.ID,
+			Owner:     e.localID,
+			Public:    input.Public,
+			Timestamp: coreEntry.CreatedAt,
+		}
+	}
 
-	// Persist to storage (materialized view)
-	if err := e.store.Put(coreEntry); err != nil {
+	// Persist to storage (materialized view) with the ACL and initial version
+	if err := e.persist(ctx, coreEntry, defaultACL, input.Tags, coreEntry.CreatedAt); err != nil {
 		return Entry{}, fmt.Errorf("failed to store entry: %w", err)
 	}
+	if defaultACL != nil {
+		e.replica.SetACL(*defaultACL) // Update Sync Replica
+	}
 
 	result2 := toInternalEntry(coreEntry)
 	result2.Content = input.Content // Return plaintext to caller
+	result2.Title = search.EntryTitle(input.Content)
 	result2.Owner = e.localID       // Set owner
 
-	// Set default ACL (Private, Owned by creator)
-	defaultACL := core.ACL{
-		EntryID:   result2.ID,
-		Owner:     e.localID,
-		Public:    input.Public,
-		Timestamp: result2.CreatedAt,
-	}
-	e.acls.SetACL(defaultACL)
-	e.replica.SetACL(defaultACL) // Update Sync Replica
-
-	// Save initial version
-	e.versions.SaveVersion(result2.ID, content, input.Tags, result2.CreatedAt, e.localID)
-
-	// Emit event
-	e.events.Publish(Event{
+	// Emit event and trigger webhooks
+	e.notify(ctx, Event{
 		Type:      EventCreated,
 		EntryID:   result2.ID,
 		EntryType: string(result2.Type),
 		Timestamp: time.Now(),
-	})
-
-	// Trigger Webhooks
-	e.hooks.TriggerAsync(hooks.NewCreateEvent(result2.ID, string(result2.Type), input.Content, input.Tags))
+	}, hooks.NewCreateEvent(result2.ID, string(result2.Type), input.Content, input.Tags))
 
 	return result2, nil
 }
 
 // GetEntry retrieves an entry by ID
 func (e *engineImpl) GetEntry(id uuid.UUID) (Entry, error) {
+	_, span := e.startSpan("acorde.GetEntry", attribute.String("acorde.entry_id", id.String()))
+	entry, err := e.getEntry(id)
+	endSpan(span, err)
+	if err == nil {
+		e.prefetch.queue(id)
+	}
+	return entry, err
+}
+
+func (e *engineImpl) getEntry(id uuid.UUID) (Entry, error) {
 	// Check read permission
-	if allowed, _ := e.acls.CheckRead(id, e.localID); !allowed {
+	if !e.canRead(id) {
 		return Entry{}, fmt.Errorf("permission denied")
 	}
 
@@ -290,29 +836,50 @@ func (e *engineImpl) GetEntry(id uuid.UUID) (Entry, error) {
 	if err != nil {
 		return Entry{}, convertCRDTError(err)
 	}
-	
+	if cached, ok := e.cache.get(id, coreEntry.UpdatedAt); ok {
+		cached.Archived = coreEntry.Archived // Archiving doesn't change UpdatedAt
+		cached.Collection = coreEntry.Collection // Nor does moving
+		return cached, nil
+	}
+	return e.loadEntry(coreEntry)
+}
+
+// loadEntry decrypts an entry read from the replica and caches it
+func (e *engineImpl) loadEntry(coreEntry core.Entry) (Entry, error) {
+	id := coreEntry.ID
 	entry := toInternalEntry(coreEntry)
-	if e.key != nil && len(entry.Content) > 0 {
-		aad := []byte(id.String())
-		plaintext, err := crypto.Decrypt(*e.key, entry.Content, aad)
-		if err != nil {
-			return Entry{}, fmt.Errorf("decryption failed: %w", err)
-		}
-		entry.Content = plaintext
+	plaintext, err := e.decrypt(id, entry.Content)
+	if err != nil {
+		return Entry{}, fmt.Errorf("decryption failed: %w", err)
 	}
+	entry.Content = plaintext
+	e.upgradeRead(&entry)
+	entry.Title = search.EntryTitle(entry.Content)
 
 	// Populate Owner
 	if acl, err := e.acls.GetACL(id); err == nil {
 		entry.Owner = acl.Owner
 	}
 
+	one := []Entry{entry}
+	e.fillSavedTimes(one)
+	entry = one[0]
+
+	e.cache.put(entry)
 	return entry, nil
 }
 
 // UpdateEntry updates an existing entry
 func (e *engineImpl) UpdateEntry(id uuid.UUID, input UpdateEntryInput) error {
+	ctx, span := e.startSpan("acorde.UpdateEntry", attribute.String("acorde.entry_id", id.String()))
+	err := e.updateEntry(ctx, id, input)
+	endSpan(span, err)
+	return err
+}
+
+func (e *engineImpl) updateEntry(ctx context.Context, id uuid.UUID, input UpdateEntryInput) error {
 	// Check write permission
-	if allowed, _ := e.acls.CheckWrite(id, e.localID); !allowed {
+	if !e.canWrite(id) {
 		return fmt.Errorf("permission denied")
 	}
 
@@ -325,22 +892,72 @@ func (e *engineImpl) UpdateEntry(id uuid.UUID, input UpdateEntryInput) error {
 		return convertCRDTError(err)
 	}
 
+	// Entries written against an older schema are upgraded when touched
+	if input.Content == nil {
+		if input.Content, err = e.migrateStored(current); err != nil {
+			return err
+		}
+	}
+
+	if err := e.beforeUpdate(current, &input); err != nil {
+		return err
+	}
+
+	// Auto-tagging rules, on the entry as it will be after the update
+	if current.Type != core.Config {
+		newContent, newTags := input.Content, input.Tags
+		if newContent == nil {
+			plaintext := e.plaintext(current)
+			newContent = &plaintext
+		}
+		if newTags == nil {
+			newTags = &current.Tags
+		}
+		if content, tags, changed := e.applyRules(current.Type, *newContent, *newTags); changed {
+			if !bytes.Equal(content, *newContent) {
+				input.Content = &content
+			}
+			if !slices.Equal(tags, *newTags) {
+				input.Tags = &tags
+			}
+		}
+	}
+
+	entryType := current.Type
+	if input.Content != nil {
+		if err := e.limits.checkContent(*input.Content); err != nil {
+			if e.blobs == nil || entryType == core.File || entryType == core.Config {
+				return err
+			}
+			// Grown too large for an entry: it becomes a file, as in AddEntry
+			fc, err := e.StoreFile("", *input.Content)
+			if err != nil {
+				return fmt.Errorf("failed to store oversized content: %w", err)
+			}
+			fileContent, err := json.Marshal(fc)
+			if err != nil {
+				return err
+			}
+			input.Content, entryType = &fileContent, core.File
+		}
+	}
+	if input.Tags != nil {
+		if err := e.limits.checkTags(*input.Tags); err != nil {
+			return err
+		}
+	}
+
 	if input.Content != nil {
 		// Validate against schema if registered
-		typeStr := string(toInternalEntry(current).Type)
+		typeStr := string(entryType)
 		result := e.schemas.Validate(typeStr, *input.Content)
 		if !result.Valid {
-			return fmt.Errorf("schema validation failed: %v", result.Errors)
+			return fmt.Errorf("%w: %v", ErrSchemaValidation, result.Errors)
 		}
 
-		content = *input.Content
-		if e.key != nil {
-			aad := []byte(id.String())
-			encrypted, err := crypto.Encrypt(*e.key, content, aad)
-			if err != nil {
-				return fmt.Errorf("encryption failed: %w", err)
-			}
-			content = encrypted
+		content, err = e.encrypt(id, *input.Content)
+		if err != nil {
+			return fmt.Errorf("encryption failed: %w", err)
 		}
 	} else {
 		content = current.Content
@@ -352,62 +969,259 @@ func (e *engineImpl) UpdateEntry(id uuid.UUID, input UpdateEntryInput) error {
 		tags = current.Tags
 	}
 
-	// Update in CRDT Replica
-	if err := e.replica.UpdateEntry(id, &content, &tags); err != nil {
+	// Update in CRDT Replica (new content is of the current schema version)
+	switch {
+	case entryType != current.Type:
+		err = e.replica.UpdateEntryRetyped(id, entryType, &content, &tags, e.schemas.Version(string(entryType)))
+	case input.Content != nil:
+		err = e.replica.UpdateEntryVersioned(id, &content, &tags, e.schemas.Version(string(current.Type)))
+	default:
+		err = e.replica.UpdateEntry(id, &content, &tags)
+	}
+	if err != nil {
 		return convertCRDTError(err)
 	}
 
 	// Get updated entry and persist
 	coreEntry, _ := e.replica.GetEntry(id)
-	if err := e.store.Put(coreEntry); err != nil {
+	e.cache.invalidate(id)
+	if err := e.persist(ctx, coreEntry, nil, tags, coreEntry.UpdatedAt); err != nil {
 		return fmt.Errorf("failed to store updated entry: %w", err)
 	}
 
-	// Save new version
-	e.versions.SaveVersion(id, content, tags, coreEntry.UpdatedAt, e.localID)
-
-	// Emit event
-	e.events.Publish(Event{
+	// Emit event and trigger webhooks
+	e.notify(ctx, Event{
 		Type:      EventUpdated,
 		EntryID:   id,
-		EntryType: string(toInternalEntry(coreEntry).Type),
+		EntryType: string(coreEntry.Type),
 		Timestamp: time.Now(),
-	})
-
-	// Trigger Webhooks
-	e.hooks.TriggerAsync(hooks.NewUpdateEvent(id, string(toInternalEntry(coreEntry).Type), content, tags))
+	}, hooks.NewUpdateEvent(id, string(coreEntry.Type), e.plaintext(coreEntry), tags))
 
 	return nil
 }
 
 // DeleteEntry marks an entry as deleted
 func (e *engineImpl) DeleteEntry(id uuid.UUID) error {
+	ctx, span := e.startSpan("acorde.DeleteEntry", attribute.String("acorde.entry_id", id.String()))
+	err := e.deleteEntry(ctx, id)
+	endSpan(span, err)
+	return err
+}
+
+func (e *engineImpl) deleteEntry(ctx context.Context, id uuid.UUID) error {
+	// Check write permission: peers would quarantine the tombstone
+	if !e.canWrite(id) {
+		return fmt.Errorf("permission denied")
+	}
+
 	// Delete in CRDT Replica (creates tombstone)
 	if err := e.replica.DeleteEntry(id); err != nil {
 		return convertCRDTError(err)
 	}
+	e.cache.invalidate(id)
 
-	// Persist tombstone
-	if err := e.store.Delete(id); err != nil {
-		return err
+	// Persist tombstone (with its deletion timestamp, so it still wins
+	// over older updates after a restart)
+	tombstone, _ := e.replica.GetEntryWithDeleted(id)
+	if err := e.storeFor(ctx).Put(tombstone); err != nil {
+		return fmt.Errorf("failed to store tombstone: %w", err)
 	}
 
-	// Emit event
-	e.events.Publish(Event{
+	// Emit event and trigger webhooks
+	e.notify(ctx, Event{
 		Type:      EventDeleted,
 		EntryID:   id,
 		Timestamp: time.Now(),
-	})
-
-	// Trigger Webhooks
-	e.hooks.TriggerAsync(hooks.NewDeleteEvent(id))
+	}, hooks.NewDeleteEvent(id))
 
 	return nil
 }
 
-// ListEntries returns entries matching the filter
+// ListEntries returns entries matching the filter. Entries whose content
+// does not decrypt are skipped (see ListEntriesChecked).
 func (e *engineImpl) ListEntries(filter ListFilter) ([]Entry, error) {
+	result, err := e.ListEntriesChecked(filter)
+	return result.Entries, err
+}
+
+func (e *engineImpl) listEntries(ctx context.Context, filter ListFilter) (ListResult, error) {
+	if filter.WithoutContent {
+		return e.listMeta(ctx, filter)
+	}
+
+	// Locked, every entry would look corrupt
+	if e.isLocked() {
+		return ListResult{}, ErrLocked
+	}
+
 	// List from storage (it's the indexed/filtered view)
+	var entries []core.Entry
+	var err error
+	if e.sortsByTitleIndex(filter) {
+		entries, err = e.pageByTitle(ctx, filter)
+	} else {
+		var storeFilter storage.ListFilter
+		if storeFilter, err = e.storeFilter(filter); err == nil {
+			entries, err = e.storeFor(ctx).List(storeFilter)
+		}
+	}
+	if err != nil {
+		return ListResult{}, err
+	}
+
+	result := make([]Entry, 0, len(entries))
+	var corrupt []CorruptEntry
+	var fetched []int // Indexes in result of entries not served from cache
+	for _, entry := range entries {
+		if cached, ok := e.cache.get(entry.ID, entry.UpdatedAt); ok {
+			cached.Archived = entry.Archived // Archiving doesn't change UpdatedAt
+			cached.Collection = entry.Collection // Nor does moving
+			result = append(result, cached)
+			continue
+		}
+		internal := toInternalEntry(entry)
+
+		// Populate Owner
+		if acl, err := e.acls.GetACL(internal.ID); err == nil {
+			internal.Owner = acl.Owner
+		}
+
+		plaintext, err := e.decrypt(internal.ID, internal.Content)
+		if err != nil {
+			// Skip other peers' entries this device has no key for
+			if internal.Owner != "" && internal.Owner != e.localID {
+				continue
+			}
+			// One corrupt entry must not hide the rest: skip and report it
+			corrupt = append(corrupt, CorruptEntry{ID: internal.ID, Type: string(internal.Type), Error: err.Error()})
+			continue
+		}
+		internal.Content = plaintext
+		e.upgradeRead(&internal)
+		internal.Title = search.EntryTitle(internal.Content)
+
+		fetched = append(fetched, len(result))
+		result = append(result, internal)
+	}
+
+	e.fillSavedTimes(result)
+	for _, idx := range fetched {
+		e.cache.put(result[idx])
+	}
+	return ListResult{Entries: result, Corrupt: corrupt}, nil
+}
+
+// listMeta lists entries without their content. Nothing is decrypted, so
+// it works while the vault is locked, no entry is reported corrupt and
+// the entry cache is bypassed.
+func (e *engineImpl) listMeta(ctx context.Context, filter ListFilter) (ListResult, error) {
+	storeFilter, err := e.storeFilter(filter)
+	if err != nil {
+		return ListResult{}, err
+	}
+	entries, err := e.storeFor(ctx).List(storeFilter)
+	if err != nil {
+		return ListResult{}, err
+	}
+
+	result := make([]Entry, 0, len(entries))
+	for _, entry := range entries {
+		internal := toInternalEntry(entry)
+		if acl, err := e.acls.GetACL(entry.ID); err == nil {
+			internal.Owner = acl.Owner
+		}
+		// Skip other peers' entries this device has no key for, as
+		// listEntries does
+		if internal.Owner != "" && internal.Owner != e.localID && !e.readable(ctx, entry) {
+			continue
+		}
+		if doc, ok := e.titles.Get(entry.ID); ok {
+			internal.Title = doc.Title
+		}
+		result = append(result, internal)
+	}
+	e.fillSavedTimes(result)
+	if e.sortsByTitleIndex(filter) {
+		result = sortByTitle(result, filter)
+	}
+	return ListResult{Entries: result}, nil
+}
+
+// sortsByTitleIndex reports whether a listing sorts by the in-memory
+// title index rather than in storage: titles of encrypted vaults are not
+// stored (see indexEntries)
+func (e *engineImpl) sortsByTitleIndex(filter ListFilter) bool {
+	return filter.Sort == SortTitle && e.encrypted()
+}
+
+// pageByTitle returns the stored entries of a page sorted by the title
+// index. Only the page is read with content, so only it is decrypted.
+func (e *engineImpl) pageByTitle(ctx context.Context, filter ListFilter) ([]core.Entry, error) {
+	meta := filter
+	meta.WithoutContent = true
+	page, err := e.listMeta(ctx, meta)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]core.Entry, 0, len(page.Entries))
+	for _, listed := range page.Entries {
+		entry, err := e.storeFor(ctx).Get(listed.ID)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// readable reports whether the content of an entry listed without it
+// decrypts. Locked, only a shared entry's key can be checked: others are
+// reported readable, as full listings fail then anyway.
+func (e *engineImpl) readable(ctx context.Context, entry core.Entry) bool {
+	if _, ok := e.cache.get(entry.ID, entry.UpdatedAt); ok {
+		return true
+	}
+	if e.isLocked() {
+		_, _, err := e.sharedEntryKey(entry.ID)
+		return err == nil
+	}
+	stored, err := e.storeFor(ctx).Get(entry.ID)
+	if err != nil {
+		return false
+	}
+	_, err = e.decrypt(entry.ID, stored.Content)
+	return err == nil
+}
+
+// sortByTitle orders listed entries by title, then pages them: storage
+// listed them all (see storeFilter). It orders as storage does for
+// plaintext vaults.
+func sortByTitle(entries []Entry, filter ListFilter) []Entry {
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := strings.ToLower(entries[i].Title), strings.ToLower(entries[j].Title)
+		if (a == "") != (b == "") {
+			return b == "" // Untitled last either way
+		}
+		if filter.Ascending {
+			return a < b
+		}
+		return a > b
+	})
+	if filter.Offset > 0 {
+		entries = entries[min(filter.Offset, len(entries)):]
+	}
+	if filter.Limit > 0 && filter.Limit < len(entries) {
+		entries = entries[:filter.Limit]
+	}
+	return entries
+}
+
+// storeFilter translates a ListFilter for storage
+func (e *engineImpl) storeFilter(filter ListFilter) (storage.ListFilter, error) {
+	collections, err := e.collectionScope(filter)
+	if err != nil {
+		return storage.ListFilter{}, err
+	}
 	storeFilter := storage.ListFilter{
 		Type:    filter.Type,
 		Tag:     filter.Tag,
@@ -416,33 +1230,47 @@ func (e *engineImpl) ListEntries(filter ListFilter) ([]Entry, error) {
 		Deleted: filter.Deleted,
 		Limit:   filter.Limit,
 		Offset:  filter.Offset,
-	}
 
-	entries, err := e.store.List(storeFilter)
-	if err != nil {
-		return nil, err
+		Archived:     filter.Archived,
+		OnlyArchived: filter.OnlyArchived,
+		Collections:  collections,
+		Namespace:    filter.Namespace,
+
+		Sort:      filter.Sort,
+		Ascending: filter.Ascending,
+
+		WithoutContent: filter.WithoutContent,
+	}
+	if e.sortsByTitleIndex(filter) {
+		// Titles are not stored: list everything, sort and page after
+		storeFilter.Sort, storeFilter.Limit, storeFilter.Offset = "", 0, 0
 	}
+	return storeFilter, nil
+}
 
-	result := make([]Entry, len(entries))
-	for i, entry := range entries {
-		internal := toInternalEntry(entry)
-		if e.key != nil && len(internal.Content) > 0 {
-			aad := []byte(internal.ID.String())
-			plaintext, err := crypto.Decrypt(*e.key, internal.Content, aad)
-			if err != nil {
-				return nil, fmt.Errorf("decryption failed for entry %s: %w", internal.ID, err)
-			}
-			internal.Content = plaintext
-		}
-		
-		// Populate Owner
-		if acl, err := e.acls.GetACL(internal.ID); err == nil {
-			internal.Owner = acl.Owner
-		}
-		
-		result[i] = internal
+// Count returns the number of entries ListEntries would return for the
+// filter without its Limit and Offset, counted in storage: nothing is
+// decrypted, so entries that do not decrypt are included. It works while
+// the vault is locked.
+func (e *engineImpl) Count(filter ListFilter) (int, error) {
+	ctx, span := e.startSpan("acorde.Count")
+	storeFilter, err := e.storeFilter(filter)
+	n := 0
+	if err == nil {
+		n, err = e.storeFor(ctx).Count(storeFilter)
 	}
-	return result, nil
+	span.SetAttributes(attribute.Int("acorde.entries", n))
+	endSpan(span, err)
+	return n, err
+}
+
+// Exists reports whether a live entry (archived or not) has the ID,
+// without reading or decrypting it
+func (e *engineImpl) Exists(id uuid.UUID) (bool, error) {
+	ctx, span := e.startSpan("acorde.Exists", attribute.String("acorde.entry_id", id.String()))
+	found, err := e.storeFor(ctx).Exists(id)
+	endSpan(span, err)
+	return found, err
 }
 
 // GetSyncPayload returns the current CRDT state for synchronization
@@ -451,37 +1279,42 @@ func (e *engineImpl) GetSyncPayload() ([]byte, error) {
 	return json.Marshal(state)
 }
 
+// GetSyncDelta returns the CRDT changes after since (a replica clock
+// time), in the same form as GetSyncPayload
+func (e *engineImpl) GetSyncDelta(since uint64) ([]byte, error) {
+	delta := e.replica.DeltaState(since)
+	return json.Marshal(crdt.ReplicaState{
+		Entries:   delta.Entries,
+		Tags:      delta.Tags,
+		ACLs:      delta.ACLs,
+		Acks:      delta.Acks,
+		ClockTime: delta.ClockTime,
+	})
+}
+
 // ApplyRemotePayload applies remote CRDT state and merges
 func (e *engineImpl) ApplyRemotePayload(payload []byte) error {
 	var state crdt.ReplicaState
 	if err := json.Unmarshal(payload, &state); err != nil {
 		return fmt.Errorf("failed to unmarshal payload: %w", err)
 	}
+	_, err := e.applyState(state, "")
+	return err
+}
 
-	// Create temporary replica with received state
-	tempClock := core.NewClockWithTime(state.ClockTime)
-	tempReplica := crdt.NewReplica(tempClock)
-	tempReplica.LoadState(state)
-
-	// Merge into our replica
-	e.replica.Merge(tempReplica)
-
-	// Persist merged state to storage
-	for _, entry := range e.replica.ListEntries() {
-		// fmt.Printf("DEBUG: Persisting entry %s\n", entry.ID)
-		if err := e.store.Put(entry); err != nil {
-			return fmt.Errorf("failed to persist merged entry: %w", err)
-		}
-	}
+// MergeRemotePayload is ApplyRemotePayload returning what the merge did
+func (e *engineImpl) MergeRemotePayload(payload []byte) (MergeStats, error) {
+	return e.MergeRemotePayloadFrom("", payload)
+}
 
-	// Persist merged ACLs
-	for _, acl := range e.replica.ListACLs() {
-		if err := e.acls.SetACL(acl); err != nil {
-			return fmt.Errorf("failed to persist merged ACL: %w", err)
-		}
+// MergeRemotePayloadFrom is MergeRemotePayload for a payload sent by the
+// authenticated peer from, whose changes are checked against the ACLs
+func (e *engineImpl) MergeRemotePayloadFrom(from string, payload []byte) (MergeStats, error) {
+	var state crdt.ReplicaState
+	if err := json.Unmarshal(payload, &state); err != nil {
+		return MergeStats{}, fmt.Errorf("failed to unmarshal payload: %w", err)
 	}
-
-	return nil
+	return e.applyState(state, from)
 }
 
 // GetSyncState returns the current CRDT state (implements sync.Syncable)
@@ -491,34 +1324,38 @@ func (e *engineImpl) GetSyncState() crdt.ReplicaState {
 
 // ApplySyncState applies remote CRDT state and merges (implements sync.Syncable)
 func (e *engineImpl) ApplySyncState(state crdt.ReplicaState) error {
-	// Create temporary replica with received state
-	tempClock := core.NewClockWithTime(state.ClockTime)
-	tempReplica := crdt.NewReplica(tempClock)
-	tempReplica.LoadState(state)
-
-	// Merge into our replica
-	e.replica.Merge(tempReplica)
+	_, err := e.applyState(state, "")
+	return err
+}
 
-	// Persist merged state to storage
-	for _, entry := range e.replica.ListEntries() {
-		if err := e.store.Put(entry); err != nil {
-			return fmt.Errorf("failed to persist merged entry: %w", err)
-		}
-	}
+// MergeSyncState is ApplySyncState returning what the merge did
+// (implements sync.MergeReporter)
+func (e *engineImpl) MergeSyncState(state crdt.ReplicaState) (MergeStats, error) {
+	return e.applyState(state, "")
+}
 
-	// Persist merged ACLs
-	for _, acl := range e.replica.ListACLs() {
-		if err := e.acls.SetACL(acl); err != nil {
-			return fmt.Errorf("failed to persist merged ACL: %w", err)
-		}
-	}
+// MergeSyncStateFrom is MergeSyncState for state sent by the
+// authenticated peer from (implements sync.PeerMergeReporter)
+func (e *engineImpl) MergeSyncStateFrom(from string, state crdt.ReplicaState) (MergeStats, error) {
+	return e.applyState(state, from)
+}
 
-	return nil
+// Ping checks that storage is reachable
+func (e *engineImpl) Ping() error {
+	return e.store.Ping()
 }
 
-// Close releases all resources
+// Close releases all resources. Storage is flushed last, so the
+// database file alone holds every committed write.
 func (e *engineImpl) Close() error {
-	return e.store.Close()
+	e.prefetch.stop()
+	extErr := e.stopExtensions(e.extensions)
+	e.extensions = nil
+	if e.index != nil {
+		e.index.Close()
+		e.index = nil // Bleve panics on double close
+	}
+	return errors.Join(extErr, e.store.Close())
 }
 
 // toInternalEntry converts a core.Entry to internal Entry
@@ -535,6 +1372,48 @@ func toInternalEntry(e core.Entry) Entry {
 		CreatedAt: e.CreatedAt,
 		UpdatedAt: e.UpdatedAt,
 		Deleted:   e.Deleted,
+		Archived:  e.Archived,
+
+		Collection: e.Collection,
+		Namespace:  e.Namespace,
+
+		CreatedTime: e.Created(),
+		UpdatedTime: e.Updated(),
+
+		SchemaVersion: e.SchemaVersion,
+		Author:        e.Author,
+	}
+}
+
+// fillSavedTimes gives entries that carry no wall-clock times (written
+// before they were recorded, with a Lamport clock) the times their oldest
+// and newest stored versions were saved on this device
+func (e *engineImpl) fillSavedTimes(entries []Entry) {
+	var ids []uuid.UUID
+	for _, entry := range entries {
+		if entry.CreatedTime.IsZero() || entry.UpdatedTime.IsZero() {
+			ids = append(ids, entry.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	spans, err := e.versions.SavedSpans(ids)
+	if err != nil {
+		return // Display only: leave the times unknown
+	}
+	for i := range entries {
+		span, ok := spans[entries[i].ID]
+		if !ok {
+			continue
+		}
+		if entries[i].CreatedTime.IsZero() {
+			entries[i].CreatedTime = span.First
+		}
+		if entries[i].UpdatedTime.IsZero() {
+			entries[i].UpdatedTime = span.Last
+		}
 	}
 }
 
@@ -554,6 +1433,50 @@ func (e *engineImpl) Subscribe() Subscription {
 	return e.events.Subscribe()
 }
 
+// SubscribeWithOptions returns a subscription to the change events opts
+// selects, with its buffer size and overflow policy
+func (e *engineImpl) SubscribeWithOptions(opts SubscriptionOptions) (Subscription, error) {
+	if !opts.Overflow.valid() {
+		return nil, fmt.Errorf("unknown overflow policy %q", opts.Overflow)
+	}
+	return e.events.SubscribeWithOptions(opts), nil
+}
+
+// DroppedEvents returns how many events subscriptions did not deliver
+// because their buffer was full, since the engine was opened
+func (e *engineImpl) DroppedEvents() uint64 {
+	return e.events.Dropped()
+}
+
+// ErrSchemaValidation is returned by AddEntry and UpdateEntry when content
+// does not match the schema registered for its entry type
+var ErrSchemaValidation = errors.New("schema validation failed")
+
+// ErrNoSchema is returned by AddEntry, with Config.StrictSchemas, for an
+// entry type that has no registered schema
+var ErrNoSchema = errors.New("no schema registered for entry type")
+
+// requireSchema returns ErrNoSchema in strict mode if entryType has no
+// schema. Config and file entries hold content the engine defines.
+func (e *engineImpl) requireSchema(entryType EntryType) error {
+	if !e.strict || entryType == core.Config || entryType == core.File || e.schemas.HasSchema(string(entryType)) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrNoSchema, entryType)
+}
+
+// validateNew checks the content of a new entry against the schema for
+// its type, which strict mode requires to exist
+func (e *engineImpl) validateNew(entryType EntryType, content []byte) error {
+	if err := e.requireSchema(entryType); err != nil {
+		return err
+	}
+	if result := e.schemas.Validate(string(entryType), content); !result.Valid {
+		return fmt.Errorf("%w: %v", ErrSchemaValidation, result.Errors)
+	}
+	return nil
+}
+
 // RegisterSchema registers a JSON schema for an entry type
 func (e *engineImpl) RegisterSchema(entryType string, schemaJSON []byte) error {
 	return e.schemas.RegisterFromJSON(entryType, entryType+"-schema", schemaJSON)
@@ -573,3 +1496,23 @@ func (e *engineImpl) ACL() *acl.Store {
 func (e *engineImpl) Hooks() *hooks.Manager {
 	return e.hooks
 }
+
+// backfillEntries replays live entries, oldest first, as create events for
+// webhooks registered with Backfill. It stops if the vault is locked.
+func (e *engineImpl) backfillEntries(yield func(hooks.HookEvent) bool) {
+	entries, err := e.liveEntries()
+	if err != nil {
+		return
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].CreatedAt < entries[j].CreatedAt })
+	for _, entry := range entries {
+		if e.isLocked() {
+			return
+		}
+		event := hooks.NewCreateEvent(entry.ID, string(entry.Type), e.plaintext(entry), entry.Tags)
+		event.Backfill = true
+		if !yield(event) {
+			return
+		}
+	}
+}
@@ -1,7 +1,14 @@
 package engine
 
 import (
+	"math"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/amaydixit11/acorde/internal/core"
+	"github.com/amaydixit11/acorde/internal/storage"
+	"github.com/google/uuid"
 )
 
 // TestEngineSyncPayload tests that sync payload can be generated and applied
@@ -92,3 +99,475 @@ func TestEngineSyncMergeConflict(t *testing.T) {
 		t.Errorf("expected e2's update to win, got: %s", string(result.Content))
 	}
 }
+
+// TestEngineSyncPublishesRemoteEvents tests that merged changes reach subscribers
+func TestEngineSyncPublishesRemoteEvents(t *testing.T) {
+	e1 := newTestEngine(t).(*engineImpl)
+	e2 := newTestEngine(t).(*engineImpl)
+	defer e1.Close()
+	defer e2.Close()
+
+	created, _ := e1.AddEntry(AddEntryInput{Type: "note", Content: []byte("created")})
+	updated, _ := e1.AddEntry(AddEntryInput{Type: "note", Content: []byte("v1")})
+	deleted, _ := e1.AddEntry(AddEntryInput{Type: "note", Content: []byte("doomed")})
+
+	payload, _ := e1.GetSyncPayload()
+	e2.ApplyRemotePayload(payload)
+
+	content := []byte("v2")
+	e1.UpdateEntry(updated.ID, UpdateEntryInput{Content: &content})
+	e1.DeleteEntry(deleted.ID)
+
+	sub := e2.Subscribe()
+	defer sub.Close()
+
+	payload, _ = e1.GetSyncPayload()
+	if err := e2.ApplyRemotePayload(payload); err != nil {
+		t.Fatalf("failed to apply payload: %v", err)
+	}
+
+	got := make(map[EventType][]Event)
+	for {
+		event := <-sub.Events()
+		if event.Origin != OriginRemote {
+			t.Errorf("expected origin %q, got %q", OriginRemote, event.Origin)
+		}
+		got[event.Type] = append(got[event.Type], event)
+		if event.Type == EventSynced {
+			break
+		}
+	}
+
+	if len(got[EventCreated]) != 0 {
+		t.Errorf("expected no created events, got %d", len(got[EventCreated]))
+	}
+	if len(got[EventUpdated]) != 1 || got[EventUpdated][0].EntryID != updated.ID {
+		t.Errorf("expected one updated event for %s, got %v", updated.ID, got[EventUpdated])
+	}
+	if len(got[EventDeleted]) != 1 || got[EventDeleted][0].EntryID != deleted.ID {
+		t.Errorf("expected one deleted event for %s, got %v", deleted.ID, got[EventDeleted])
+	}
+	if _, err := e2.GetEntry(created.ID); err != nil {
+		t.Errorf("created entry should still exist: %v", err)
+	}
+}
+
+// countingStore records entry writes made through a storage.Store
+type countingStore struct {
+	storage.Store
+	puts    int
+	batches int
+}
+
+func (s *countingStore) Put(entry core.Entry) error {
+	s.puts++
+	return s.Store.Put(entry)
+}
+
+func (s *countingStore) ApplyBatch(ops []storage.Operation) error {
+	s.batches++
+	s.puts += len(ops)
+	return s.Store.ApplyBatch(ops)
+}
+
+// TestEngineSyncPersistsOnlyChanges tests that a merge writes only the
+// entries it changed, in one batch
+func TestEngineSyncPersistsOnlyChanges(t *testing.T) {
+	e1 := newTestEngine(t).(*engineImpl)
+	e2 := newTestEngine(t).(*engineImpl)
+	defer e1.Close()
+	defer e2.Close()
+
+	var doomed Entry
+	for i := 0; i < 20; i++ {
+		doomed, _ = e1.AddEntry(AddEntryInput{Type: "note", Content: []byte("entry")})
+	}
+	payload, _ := e1.GetSyncPayload()
+	e2.ApplyRemotePayload(payload)
+
+	store := &countingStore{Store: e2.store}
+	e2.store = store
+
+	// Re-applying the same state writes nothing
+	e2.ApplyRemotePayload(payload)
+	if store.puts != 0 {
+		t.Errorf("expected no writes for an unchanged merge, got %d", store.puts)
+	}
+
+	content := []byte("changed")
+	e1.UpdateEntry(doomed.ID, UpdateEntryInput{Content: &content})
+	e1.DeleteEntry(doomed.ID)
+	payload, _ = e1.GetSyncPayload()
+	e2.ApplyRemotePayload(payload)
+	if store.puts != 1 || store.batches != 1 {
+		t.Errorf("expected 1 write in 1 batch, got %d in %d", store.puts, store.batches)
+	}
+
+	// The tombstone reached storage
+	stored, err := store.Get(doomed.ID)
+	if err != nil || !stored.Deleted {
+		t.Errorf("expected deleted entry in storage, got %+v (%v)", stored, err)
+	}
+}
+
+func TestEngineSyncMergeStats(t *testing.T) {
+	e1 := newTestEngine(t).(*engineImpl)
+	e2 := newTestEngine(t).(*engineImpl)
+	defer e1.Close()
+	defer e2.Close()
+
+	var doomed Entry
+	for i := 0; i < 3; i++ {
+		doomed, _ = e1.AddEntry(AddEntryInput{Type: "note", Content: []byte("entry")})
+	}
+	e1.DeleteEntry(doomed.ID)
+	payload, _ := e1.GetSyncPayload()
+
+	stats, err := e2.MergeRemotePayload(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Compared != 3 || stats.Changed != 3 || stats.Tombstones != 1 || stats.Duration <= 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	// Merging the same state again changes nothing
+	if stats, _ = e2.MergeRemotePayload(payload); stats.Compared != 3 || stats.Changed != 0 {
+		t.Errorf("unexpected stats for an unchanged merge %+v", stats)
+	}
+}
+
+// TestEngineSyncQuarantinesClockSkew tests that versions timestamped far
+// ahead of the local clock are quarantined rather than merged
+func TestEngineSyncQuarantinesClockSkew(t *testing.T) {
+	e1 := newTestEngine(t).(*engineImpl)
+	e2 := newTestEngine(t).(*engineImpl)
+	defer e1.Close()
+	defer e2.Close()
+
+	var reported []QuarantinedEntry
+	e2.onQuarantine = func(q QuarantinedEntry) { reported = append(reported, q) }
+
+	shared, _ := e1.AddEntry(AddEntryInput{Type: "note", Content: []byte("v1")})
+	good, _ := e1.AddEntry(AddEntryInput{Type: "note", Content: []byte("fine")})
+	if err := e2.ApplySyncState(e1.GetSyncState()); err != nil {
+		t.Fatal(err)
+	}
+
+	// e1's clock jumps a year ahead; its update would win every conflict
+	future := core.HLCTimestamp(time.Now().AddDate(1, 0, 0))
+	content := []byte("from the future")
+	if err := e1.UpdateEntry(shared.ID, UpdateEntryInput{Content: &content}); err != nil {
+		t.Fatal(err)
+	}
+	state := e1.GetSyncState()
+	for i, elem := range state.Entries {
+		if elem.Entry.ID == shared.ID {
+			state.Entries[i].Timestamp, state.Entries[i].Entry.UpdatedAt = future, future
+		}
+	}
+	state.ClockTime = future
+
+	for range 2 {
+		if err := e2.ApplySyncState(state); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got, _ := e2.GetEntry(shared.ID); string(got.Content) != "v1" {
+		t.Errorf("expected the local version to be kept, got %q", got.Content)
+	}
+	if _, err := e2.GetEntry(good.ID); err != nil {
+		t.Errorf("sane entries should still merge: %v", err)
+	}
+	if now := e2.replica.ClockTime(); now >= future {
+		t.Errorf("local clock dragged ahead to %d", now)
+	}
+
+	list, err := e2.Quarantined()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].EntryID != shared.ID || list[0].Timestamp != future || list[0].Rejections != 2 {
+		t.Errorf("unexpected quarantine %+v", list)
+	}
+	if len(reported) != 2 || reported[0].Reason == "" {
+		t.Errorf("expected each rejection to be reported, got %+v", reported)
+	}
+
+	if err := e2.ClearQuarantine(); err != nil {
+		t.Fatal(err)
+	}
+	if list, _ := e2.Quarantined(); len(list) != 0 {
+		t.Errorf("expected an empty quarantine, got %+v", list)
+	}
+}
+
+// TestEngineSyncRejectsUnauthorizedWrites tests that once ACLs are
+// enforced, updates from peers that may not write an entry are kept out
+// of the merge and quarantined, whatever author they name, and that ACL
+// changes are only taken from the entry's owner
+func TestEngineSyncRejectsUnauthorizedWrites(t *testing.T) {
+	owner := newTestEngine(t).(*engineImpl)
+	defer owner.Close()
+	// A peer that doesn't check ACLs itself
+	p, err := New(Config{InMemory: true, DisableACL: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer := p.(*engineImpl)
+	defer peer.Close()
+	peer.localID = "peer"
+	peer.replica.SetAuthor("peer")
+
+	entry, _ := owner.AddEntry(AddEntryInput{Type: "note", Content: []byte("v1"), Tags: []string{"a"}})
+	readOnly := core.ACL{EntryID: entry.ID, Owner: owner.localID, Readers: []string{"peer"}}
+	owner.replica.SetACL(readOnly)
+	readOnly, _ = owner.replica.GetACL(entry.ID)
+	owner.acls.SetACL(readOnly)
+	if err := peer.ApplySyncState(owner.GetSyncState()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The reader's update, claiming to be by the owner
+	peer.replica.SetAuthor(owner.localID)
+	content := []byte("by a reader")
+	if err := peer.UpdateEntry(entry.ID, UpdateEntryInput{Content: &content, Tags: &[]string{"b"}}); err != nil {
+		t.Fatal(err)
+	}
+	peer.replica.SetAuthor("peer")
+	if _, err := owner.MergeSyncStateFrom("peer", peer.GetSyncState()); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := owner.GetEntry(entry.ID)
+	if string(got.Content) != "v1" || len(got.Tags) != 1 || got.Tags[0] != "a" {
+		t.Errorf("expected the local version to be kept, got %q %v", got.Content, got.Tags)
+	}
+	list, _ := owner.Quarantined()
+	if len(list) != 1 || list[0].EntryID != entry.ID || !strings.Contains(list[0].Reason, "peer") {
+		t.Errorf("unexpected quarantine %+v", list)
+	}
+
+	// Without a known sender, no update of an owned entry merges
+	if err := owner.ApplySyncState(peer.GetSyncState()); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := owner.GetEntry(entry.ID); string(got.Content) != "v1" {
+		t.Errorf("expected the local version to be kept, got %q", got.Content)
+	}
+	owner.ClearQuarantine()
+
+	// Writers' updates merge
+	writable := readOnly.Clone()
+	writable.Writers = []string{"peer"}
+	writable.Timestamp = 0
+	owner.replica.SetACL(writable)
+	writable, _ = owner.replica.GetACL(entry.ID)
+	owner.acls.SetACL(writable)
+
+	content = []byte("by a writer")
+	if err := peer.UpdateEntry(entry.ID, UpdateEntryInput{Content: &content}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := owner.MergeSyncStateFrom("peer", peer.GetSyncState()); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := owner.GetEntry(entry.ID); string(got.Content) != "by a writer" || got.Author != "peer" {
+		t.Errorf("expected the writer's update, got %q by %q", got.Content, got.Author)
+	}
+
+	// A writer cannot take the entry over
+	takeover := writable.Clone()
+	takeover.Owner = "peer"
+	takeover.Timestamp = 0
+	peer.replica.SetACL(takeover)
+	if _, err := owner.MergeSyncStateFrom("peer", peer.GetSyncState()); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := owner.replica.GetACL(entry.ID); got.Owner != owner.localID {
+		t.Errorf("expected the owner to keep the entry, got owner %q", got.Owner)
+	}
+	if stored, _ := owner.acls.GetACL(entry.ID); stored == nil || stored.Owner != owner.localID {
+		t.Errorf("expected the stored ACL to keep its owner, got %+v", stored)
+	}
+	list, _ = owner.Quarantined()
+	if len(list) != 1 || list[0].EntryType != quarantinedACL || !strings.Contains(list[0].Reason, "peer") {
+		t.Errorf("expected the ACL change quarantined, got %+v", list)
+	}
+}
+
+func TestSkewLimits(t *testing.T) {
+	now := time.Now()
+	limits := skewLimits{wall: time.Hour, logical: 1000}
+
+	for _, tt := range []struct {
+		ts, local uint64
+		ok        bool
+	}{
+		{core.HLCTimestamp(now.Add(30 * time.Minute)), 0, true},
+		{core.HLCTimestamp(now.Add(2 * time.Hour)), 0, false},
+		{math.MaxUint64, 0, false}, // Corrupt Lamport time lands in the HLC range
+		// Relative to a clock already ahead
+		{core.HLCTimestamp(now.Add(2 * time.Hour)), core.HLCTimestamp(now.Add(90 * time.Minute)), true},
+		{500, 0, true},
+		{5000, 0, false},
+		{5000, 4500, true},
+		{10, 5000, true}, // Behind is always fine
+	} {
+		if got := limits.check(tt.ts, tt.local, now) == ""; got != tt.ok {
+			t.Errorf("check(%d, %d) ok = %v, want %v", tt.ts, tt.local, got, tt.ok)
+		}
+	}
+
+	if (skewLimits{}).check(math.MaxUint64, 0, now) != "" {
+		t.Error("zero limits should accept anything")
+	}
+}
+
+// nextEvent returns the next event of sub, failing after a second
+func nextEvent(t *testing.T, sub Subscription) Event {
+	t.Helper()
+	select {
+	case event := <-sub.Events():
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for event")
+		return Event{}
+	}
+}
+
+// TestEngineWatch tests that Watch and WatchQuery see only their entries,
+// including ones merged from a peer
+func TestEngineWatch(t *testing.T) {
+	e1 := newTestEngine(t).(*engineImpl)
+	e2 := newTestEngine(t).(*engineImpl)
+	defer e1.Close()
+	defer e2.Close()
+
+	e1.AddEntry(AddEntryInput{Type: "note", Content: []byte("other")})
+	watched, _ := e1.AddEntry(AddEntryInput{Type: "note", Content: []byte("watched")})
+
+	// Watching an entry e2 has not received yet
+	entrySub := e2.Watch(watched.ID)
+	defer entrySub.Close()
+	tag := "work"
+	querySub := e2.WatchQuery(ListFilter{Tag: &tag})
+	defer querySub.Close()
+
+	payload, _ := e1.GetSyncPayload()
+	if err := e2.ApplyRemotePayload(payload); err != nil {
+		t.Fatalf("failed to apply payload: %v", err)
+	}
+	if event := nextEvent(t, entrySub); event.EntryID != watched.ID || event.Origin != OriginRemote {
+		t.Errorf("expected remote event for %s, got %+v", watched.ID, event)
+	}
+
+	// Entries join and leave the query
+	e2.AddEntry(AddEntryInput{Type: "note", Content: []byte("personal")})
+	work, _ := e2.AddEntry(AddEntryInput{Type: "note", Content: []byte("work"), Tags: []string{"work"}})
+	if event := nextEvent(t, querySub); event.EntryID != work.ID || event.Type != EventCreated {
+		t.Errorf("expected created event for %s, got %+v", work.ID, event)
+	}
+	none := []string{}
+	e2.UpdateEntry(work.ID, UpdateEntryInput{Tags: &none})
+	if event := nextEvent(t, querySub); event.EntryID != work.ID || event.Type != EventUpdated {
+		t.Errorf("expected a last event for %s, got %+v", work.ID, event)
+	}
+	content := []byte("no longer work")
+	e2.UpdateEntry(work.ID, UpdateEntryInput{Content: &content})
+
+	// A match arriving through sync
+	remote, _ := e1.AddEntry(AddEntryInput{Type: "note", Content: []byte("remote"), Tags: []string{"work"}})
+	payload, _ = e1.GetSyncPayload()
+	e2.ApplyRemotePayload(payload)
+	if event := nextEvent(t, querySub); event.EntryID != remote.ID || event.Origin != OriginRemote {
+		t.Errorf("expected remote event for %s, got %+v", remote.ID, event)
+	}
+
+	select {
+	case event := <-entrySub.Events():
+		t.Errorf("unexpected event for the watched entry: %+v", event)
+	case event := <-querySub.Events():
+		t.Errorf("unexpected query event: %+v", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// TestEngineSyncMergesMoves tests that a move on one device and an edit
+// on another both survive a merge
+func TestEngineSyncMergesMoves(t *testing.T) {
+	e1 := newTestEngine(t).(*engineImpl)
+	e2 := newTestEngine(t).(*engineImpl)
+	defer e1.Close()
+	defer e2.Close()
+
+	entry, _ := e1.AddEntry(AddEntryInput{Type: "note", Content: []byte("draft")})
+	payload, _ := e1.GetSyncPayload()
+	e2.ApplyRemotePayload(payload)
+
+	collection, err := e1.CreateCollection("drafts", uuid.Nil)
+	if err != nil {
+		t.Fatalf("CreateCollection failed: %v", err)
+	}
+	if err := e1.MoveEntry(entry.ID, collection.ID); err != nil {
+		t.Fatalf("MoveEntry failed: %v", err)
+	}
+	content := []byte("edited")
+	if err := e2.replica.UpdateEntry(entry.ID, &content, nil); err != nil {
+		t.Fatalf("UpdateEntry failed: %v", err)
+	}
+
+	payload1, _ := e1.GetSyncPayload()
+	payload2, _ := e2.GetSyncPayload()
+	e2.ApplyRemotePayload(payload1)
+	e1.ApplyRemotePayload(payload2)
+
+	for _, e := range []*engineImpl{e1, e2} {
+		got, err := e.replica.GetEntry(entry.ID)
+		if err != nil {
+			t.Fatalf("GetEntry failed: %v", err)
+		}
+		if got.Collection != collection.ID || string(got.Content) != "edited" {
+			t.Errorf("expected the move and the edit, got collection %s, content %q", got.Collection, got.Content)
+		}
+	}
+}
+
+func TestEngineSyncRecentEditors(t *testing.T) {
+	desktop := newTestEngine(t).(*engineImpl)
+	defer desktop.Close()
+	laptop := newTestEngine(t).(*engineImpl)
+	defer laptop.Close()
+	laptop.localID = "laptop"
+	laptop.replica.SetAuthor("laptop")
+
+	entry, _ := desktop.AddEntry(AddEntryInput{Type: "note", Content: []byte("v1")})
+	laptop.ApplySyncState(desktop.GetSyncState())
+	v2 := []byte("v2")
+	laptop.UpdateEntry(entry.ID, UpdateEntryInput{Content: &v2})
+	laptop.ArchiveEntry(entry.ID)
+	if err := desktop.ApplySyncState(laptop.GetSyncState()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The merged edit is in the history, by its author; the archive is not
+	versions, total, _ := desktop.History(entry.ID, 0, 0)
+	if total != 2 || versions[0].Author != "laptop" || string(versions[0].Content) != "v2" {
+		t.Fatalf("expected the laptop's edit in the history, got %d versions: %+v", total, versions)
+	}
+
+	editors, err := desktop.RecentEditors(entry.ID, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(editors) != 1 || editors[0].PeerID != "laptop" || editors[0].Edits != 1 {
+		t.Errorf("expected the laptop as the only other editor, got %+v", editors)
+	}
+	if editors, _ := laptop.RecentEditors(entry.ID, time.Minute); len(editors) != 1 || editors[0].PeerID != desktop.localID {
+		t.Errorf("expected the desktop as the laptop's other editor, got %+v", editors)
+	}
+
+	if _, err := desktop.RecentEditors(uuid.New(), time.Minute); err == nil {
+		t.Error("expected an error for an unknown entry")
+	}
+}
@@ -1,10 +1,36 @@
 package engine
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/amaydixit11/acorde/internal/blob"
+	"github.com/amaydixit11/acorde/internal/acl"
 	"github.com/amaydixit11/acorde/internal/core"
+	"github.com/amaydixit11/acorde/internal/hooks"
+	"github.com/amaydixit11/acorde/internal/schema"
+	"github.com/amaydixit11/acorde/internal/search"
+	"github.com/amaydixit11/acorde/internal/storage/sqlite"
+	"github.com/amaydixit11/acorde/internal/templates"
+	"github.com/amaydixit11/acorde/internal/storage"
+	"github.com/amaydixit11/acorde/pkg/crypto"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/embedded"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
 func newTestEngine(t *testing.T) Engine {
@@ -144,6 +170,138 @@ func TestUpdateEntryPartial(t *testing.T) {
 	}
 }
 
+func TestUpdateEntrySchemaValidation(t *testing.T) {
+	e := newTestEngine(t)
+	defer e.Close()
+
+	schema := []byte(`{"type": "object", "required": ["title"]}`)
+	if err := e.RegisterSchema(string(core.Note), schema); err != nil {
+		t.Fatalf("failed to register schema: %v", err)
+	}
+
+	entry, err := e.AddEntry(AddEntryInput{Type: core.Note, Content: []byte(`{"title": "a"}`)})
+	if err != nil {
+		t.Fatalf("failed to add entry: %v", err)
+	}
+
+	invalid := []byte(`{"body": "no title"}`)
+	err = e.UpdateEntry(entry.ID, UpdateEntryInput{Content: &invalid})
+	if !errors.Is(err, ErrSchemaValidation) {
+		t.Fatalf("expected ErrSchemaValidation, got %v", err)
+	}
+
+	got, _ := e.GetEntry(entry.ID)
+	if string(got.Content) != `{"title": "a"}` {
+		t.Errorf("rejected update was written: %s", got.Content)
+	}
+}
+
+func TestStrictSchemas(t *testing.T) {
+	e, err := New(Config{InMemory: true, StrictSchemas: true, BuiltinSchemas: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	if _, err := e.AddEntry(AddEntryInput{Type: core.Note, Content: []byte("free text")}); !errors.Is(err, ErrNoSchema) {
+		t.Errorf("expected ErrNoSchema for a note, got %v", err)
+	}
+	if _, err := e.AppendLog([]LogRecord{{Content: []byte(`{}`)}}); !errors.Is(err, ErrNoSchema) {
+		t.Errorf("expected ErrNoSchema for a log, got %v", err)
+	}
+	if _, err := e.AddEntry(AddEntryInput{Type: core.Task, Content: []byte(`{"title":"Ship it"}`)}); err != nil {
+		t.Errorf("task with the built-in schema failed: %v", err)
+	}
+	if _, err := e.AddEntry(AddEntryInput{Type: core.Bookmark, Content: []byte(`{"title":"no url"}`)}); !errors.Is(err, ErrSchemaValidation) {
+		t.Errorf("expected ErrSchemaValidation for a bookmark without url, got %v", err)
+	}
+
+	// Registering a schema opens the type up
+	if err := e.RegisterSchema(string(core.Note), []byte(`{"type":"object"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.AddEntry(AddEntryInput{Type: core.Note, Content: []byte(`{"body":"hi"}`)}); err != nil {
+		t.Errorf("note with a schema failed: %v", err)
+	}
+
+	// Without BuiltinSchemas the new types have no schema
+	loose := newTestEngine(t)
+	defer loose.Close()
+	if _, err := loose.AddEntry(AddEntryInput{Type: core.Bookmark, Content: []byte("anything")}); err != nil {
+		t.Errorf("bookmark without strict mode failed: %v", err)
+	}
+}
+
+func TestSchemaMigration(t *testing.T) {
+	e := newTestEngine(t).(*engineImpl)
+	defer e.Close()
+
+	if err := e.RegisterSchema("task", []byte(`{"type":"object","required":["title"]}`)); err != nil {
+		t.Fatal(err)
+	}
+	touched, _ := e.AddEntry(AddEntryInput{Type: core.Task, Content: []byte(`{"title":"a"}`)})
+	left, _ := e.AddEntry(AddEntryInput{Type: core.Task, Content: []byte(`{"title":"b"}`)})
+	if touched.SchemaVersion != 1 {
+		t.Errorf("expected schema version 1, got %d", touched.SchemaVersion)
+	}
+
+	// v2 renames title to name
+	v2 := []byte(`{"type":"object","required":["name"],"properties":{"title":false}}`)
+	rename := schema.MigratorFunc(func(from, to int, content []byte) ([]byte, error) {
+		var v map[string]any
+		if err := json.Unmarshal(content, &v); err != nil {
+			return nil, err
+		}
+		v["name"] = v["title"]
+		delete(v, "title")
+		return json.Marshal(v)
+	})
+	if err := e.RegisterSchemaVersion("task", 2, v2, rename); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.RegisterSchemaVersion("task", 1, v2, nil); err == nil {
+		t.Error("expected an error registering an older version")
+	}
+
+	// Reads see migrated content without writing it
+	got, _ := e.GetEntry(left.ID)
+	if string(got.Content) != `{"name":"b"}` || got.SchemaVersion != 2 {
+		t.Errorf("expected migrated content, got %s (version %d)", got.Content, got.SchemaVersion)
+	}
+	if stored, _ := e.replica.GetEntry(left.ID); stored.SchemaVersion != 1 {
+		t.Errorf("read should not write the migration, stored version %d", stored.SchemaVersion)
+	}
+
+	// A tag-only update writes it
+	tags := []string{"done"}
+	if err := e.UpdateEntry(touched.ID, UpdateEntryInput{Tags: &tags}); err != nil {
+		t.Fatalf("update of a v1 entry failed: %v", err)
+	}
+	if stored, _ := e.store.Get(touched.ID); stored.SchemaVersion != 2 {
+		t.Errorf("expected the update to store version 2, got %d", stored.SchemaVersion)
+	}
+
+	n, err := e.MigrateType("task")
+	if err != nil || n != 1 {
+		t.Fatalf("expected 1 entry migrated, got %d (%v)", n, err)
+	}
+	if stored, _ := e.replica.GetEntry(left.ID); stored.SchemaVersion != 2 || string(e.plaintext(stored)) != `{"name":"b"}` {
+		t.Errorf("expected version 2 stored, got %s (version %d)", e.plaintext(stored), stored.SchemaVersion)
+	}
+	if n, _ := e.MigrateType("task"); n != 0 {
+		t.Errorf("expected nothing left to migrate, got %d", n)
+	}
+
+	// The version syncs with the content
+	peer := newTestEngine(t).(*engineImpl)
+	defer peer.Close()
+	payload, _ := e.GetSyncPayload()
+	peer.ApplyRemotePayload(payload)
+	if synced, _ := peer.GetEntry(left.ID); synced.SchemaVersion != 2 || string(synced.Content) != `{"name":"b"}` {
+		t.Errorf("expected version 2 content on the peer, got %s (version %d)", synced.Content, synced.SchemaVersion)
+	}
+}
+
 func TestDeleteEntry(t *testing.T) {
 	e := newTestEngine(t)
 	defer e.Close()
@@ -171,6 +329,55 @@ func TestDeleteEntry(t *testing.T) {
 	}
 }
 
+func TestDeleteWhere(t *testing.T) {
+	e := newTestEngine(t)
+	defer e.Close()
+
+	// More logs than fit in one batch
+	records := make([]LogRecord, DeleteBatchSize+20)
+	for i := range records {
+		records[i] = LogRecord{Content: []byte(fmt.Sprintf("line %d", i))}
+	}
+	if _, err := e.AppendLog(records); err != nil {
+		t.Fatalf("AppendLog failed: %v", err)
+	}
+	note, _ := e.AddEntry(AddEntryInput{Type: core.Note, Content: []byte("keep")})
+
+	logType := core.Log
+	n, err := e.DeleteWhere(ListFilter{Type: &logType, Limit: 1})
+	if err != nil {
+		t.Fatalf("DeleteWhere failed: %v", err)
+	}
+	if n != len(records) {
+		t.Errorf("expected %d deleted, got %d", len(records), n)
+	}
+	if count, _ := e.Count(ListFilter{Type: &logType}); count != 0 {
+		t.Errorf("expected no logs left, got %d", count)
+	}
+	if count, _ := e.Count(ListFilter{Type: &logType, Deleted: true}); count != len(records) {
+		t.Errorf("expected %d tombstones, got %d", len(records), count)
+	}
+	if _, err := e.GetEntry(note.ID); err != nil {
+		t.Errorf("expected the note to be kept: %v", err)
+	}
+
+	// Nothing left to match
+	if n, _ := e.DeleteWhere(ListFilter{Type: &logType}); n != 0 {
+		t.Errorf("expected nothing deleted again, got %d", n)
+	}
+
+	// An unknown ID deletes nothing
+	if _, err := e.DeleteEntries([]uuid.UUID{note.ID, uuid.New()}); err == nil {
+		t.Error("expected error for an unknown ID")
+	}
+	if _, err := e.GetEntry(note.ID); err != nil {
+		t.Errorf("expected the note to survive a failed DeleteEntries: %v", err)
+	}
+	if n, err := e.DeleteEntries([]uuid.UUID{note.ID, note.ID}); err != nil || n != 1 {
+		t.Errorf("expected the note deleted once, got %d (%v)", n, err)
+	}
+}
+
 func TestUpdateDeletedEntry(t *testing.T) {
 	e := newTestEngine(t)
 	defer e.Close()
@@ -236,3 +443,2143 @@ func TestClockIncrementsMonotonically(t *testing.T) {
 		lastTime = entry.CreatedAt
 	}
 }
+
+func TestBulkCoalescesEvents(t *testing.T) {
+	e := newTestEngine(t).(*engineImpl)
+	defer e.Close()
+
+	sub := e.Subscribe()
+	defer sub.Close()
+
+	var kept, dropped Entry
+	err := e.Bulk(func(b Batch) error {
+		kept, _ = b.AddEntry(AddEntryInput{Type: "note", Content: []byte("v1")})
+		content := []byte("v2")
+		b.UpdateEntry(kept.ID, UpdateEntryInput{Content: &content})
+
+		dropped, _ = b.AddEntry(AddEntryInput{Type: "note", Content: []byte("temp")})
+		b.DeleteEntry(dropped.ID)
+
+		select {
+		case event := <-sub.Events():
+			t.Errorf("event delivered during bulk mode: %+v", event)
+		default:
+		}
+
+		// A change made elsewhere meanwhile is not part of the bulk
+		// operation
+		other, _ := e.AddEntry(AddEntryInput{Type: "note", Content: []byte("unrelated")})
+		select {
+		case event := <-sub.Events():
+			if event.Type != EventCreated || event.EntryID != other.ID {
+				t.Errorf("expected created event for %s, got %+v", other.ID, event)
+			}
+		default:
+			t.Error("expected a change outside the batch to be delivered at once")
+		}
+		if history, _ := e.Versions().GetHistory(other.ID); len(history) != 1 {
+			t.Errorf("expected the version of a change outside the batch to be saved at once, got %d", len(history))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Bulk failed: %v", err)
+	}
+
+	select {
+	case event := <-sub.Events():
+		if event.Type != EventCreated || event.EntryID != kept.ID {
+			t.Errorf("expected created event for %s, got %+v", kept.ID, event)
+		}
+	default:
+		t.Fatal("expected an event after bulk mode ended")
+	}
+	select {
+	case event := <-sub.Events():
+		t.Errorf("expected a single coalesced event, got extra %+v", event)
+	default:
+	}
+
+	history, err := e.Versions().GetHistory(kept.ID)
+	if err != nil {
+		t.Fatalf("GetHistory failed: %v", err)
+	}
+	if len(history) != 2 {
+		t.Errorf("expected 2 versions written on flush, got %d", len(history))
+	}
+}
+
+func TestEntryCache(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	e, err := New(Config{InMemory: true, EncryptionKey: &key, CacheSize: 2})
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+	defer e.Close()
+
+	entry, _ := e.AddEntry(AddEntryInput{Type: "note", Content: []byte("v1")})
+	e.GetEntry(entry.ID)
+	got, _ := e.GetEntry(entry.ID)
+	if stats := e.CacheStats(); stats.Hits != 1 || stats.Misses != 1 {
+		t.Errorf("expected 1 hit and 1 miss, got %+v", stats)
+	}
+
+	// Callers cannot modify cached content
+	got.Content[0] = 'X'
+	if got, _ := e.GetEntry(entry.ID); string(got.Content) != "v1" {
+		t.Errorf("cache was modified through a returned entry: %q", got.Content)
+	}
+
+	content := []byte("v2")
+	e.UpdateEntry(entry.ID, UpdateEntryInput{Content: &content})
+	if got, _ := e.GetEntry(entry.ID); string(got.Content) != "v2" {
+		t.Errorf("expected updated content, got %q", got.Content)
+	}
+	if list, _ := e.ListEntries(ListFilter{}); len(list) != 1 || string(list[0].Content) != "v2" {
+		t.Errorf("expected updated content in list, got %+v", list)
+	}
+
+	// The cache is bounded
+	for i := 0; i < 5; i++ {
+		e.AddEntry(AddEntryInput{Type: "note", Content: []byte("more")})
+	}
+	e.ListEntries(ListFilter{})
+	if stats := e.CacheStats(); stats.Size != 2 {
+		t.Errorf("expected cache size 2, got %d", stats.Size)
+	}
+
+	// A negative size disables the cache
+	off, _ := New(Config{InMemory: true, CacheSize: -1})
+	defer off.Close()
+	other, _ := off.AddEntry(AddEntryInput{Type: "note", Content: []byte("x")})
+	off.GetEntry(other.ID)
+	if stats := off.CacheStats(); stats.Hits != 0 || stats.Size != 0 {
+		t.Errorf("disabled cache should not be used, got %+v", stats)
+	}
+}
+
+func TestPrefetch(t *testing.T) {
+	e := newTestEngine(t).(*engineImpl)
+	defer e.Close()
+
+	beta, _ := e.AddEntry(AddEntryInput{Type: "note", Content: []byte("# Beta")})
+	alpha, _ := e.AddEntry(AddEntryInput{Type: "note", Content: []byte("# Alpha\nsee [[beta]] and [[Missing]]")})
+	gamma, _ := e.AddEntry(AddEntryInput{Type: "note", Content: []byte("back to [[" + alpha.ID.String() + "]]")})
+	other, _ := e.AddEntry(AddEntryInput{Type: "note", Content: []byte("unrelated")})
+
+	linked := e.linkedEntries(alpha.ID)
+	if len(linked) != 2 || linked[0] != beta.ID || linked[1] != gamma.ID {
+		t.Errorf("expected Beta then the entry linking back, got %v", linked)
+	}
+
+	e.cache.purge()
+	if n := e.Prefetch([]uuid.UUID{other.ID, uuid.New()}); n != 1 {
+		t.Errorf("expected 1 entry loaded, got %d", n)
+	}
+	if n := e.Prefetch([]uuid.UUID{other.ID}); n != 0 {
+		t.Errorf("expected a cached entry to be skipped, got %d", n)
+	}
+
+	// Reading an entry prefetches its neighbours in the background
+	e.GetEntry(alpha.ID)
+	deadline := time.Now().Add(5 * time.Second)
+	for !e.cache.contains(beta.ID, beta.UpdatedAt) || !e.cache.contains(gamma.ID, gamma.UpdatedAt) {
+		if time.Now().After(deadline) {
+			t.Fatal("expected linked entries to be prefetched")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	before := e.CacheStats()
+	if got, _ := e.GetEntry(beta.ID); string(got.Content) != "# Beta" {
+		t.Errorf("expected Beta, got %q", got.Content)
+	}
+	if stats := e.CacheStats(); stats.Hits != before.Hits+1 {
+		t.Errorf("expected a prefetched entry to be a cache hit, got %+v", stats)
+	}
+}
+
+func TestLegacyEntryTimesFromVersions(t *testing.T) {
+	e := newTestEngine(t)
+	defer e.Close()
+	impl := e.(*engineImpl)
+
+	// An entry from before wall times were recorded
+	legacy := core.Entry{ID: uuid.New(), Type: core.Note, Content: []byte("old"), Tags: []string{}, CreatedAt: 1, UpdatedAt: 1}
+	impl.replica.HydrateEntry(legacy)
+	if err := impl.store.Put(legacy); err != nil {
+		t.Fatalf("failed to store entry: %v", err)
+	}
+	impl.versions.SaveVersion(legacy.ID, legacy.Content, legacy.Tags, legacy.UpdatedAt, "")
+
+	got, err := e.GetEntry(legacy.ID)
+	if err != nil {
+		t.Fatalf("failed to get entry: %v", err)
+	}
+	if got.CreatedTime.IsZero() || got.UpdatedTime.IsZero() {
+		t.Errorf("expected times from version history, got %v / %v", got.CreatedTime, got.UpdatedTime)
+	}
+
+	list, _ := e.ListEntries(ListFilter{})
+	if len(list) != 1 || list[0].UpdatedTime.IsZero() {
+		t.Errorf("expected listed entry to carry a time, got %+v", list)
+	}
+}
+
+func TestEntryLimits(t *testing.T) {
+	e, err := New(Config{InMemory: true, MaxContentSize: 10, MaxTagsPerEntry: 2, MaxTagLength: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	var limitErr *LimitError
+	for _, tt := range []struct {
+		input AddEntryInput
+		limit string
+	}{
+		{AddEntryInput{Type: core.Note, Content: []byte("way too long")}, "content size"},
+		{AddEntryInput{Type: core.Note, Tags: []string{"a", "b", "c"}}, "tag count"},
+		{AddEntryInput{Type: core.Note, Tags: []string{"ok", "toolong"}}, "tag length"},
+	} {
+		_, err := e.AddEntry(tt.input)
+		if !errors.Is(err, ErrLimitExceeded) || !errors.As(err, &limitErr) || limitErr.Limit != tt.limit {
+			t.Errorf("expected a %s error, got %v", tt.limit, err)
+		}
+	}
+
+	// Multi-byte tags are measured in characters
+	entry, err := e.AddEntry(AddEntryInput{Type: core.Note, Content: []byte("fits"), Tags: []string{"héllo"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := []byte("now too long")
+	if err := e.UpdateEntry(entry.ID, UpdateEntryInput{Content: &content}); !errors.As(err, &limitErr) {
+		t.Errorf("expected updates to be limited, got %v", err)
+	}
+}
+
+func TestCountAndExists(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	e, err := New(Config{InMemory: true, EncryptionKey: &key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	var ids []uuid.UUID
+	for i := 0; i < 3; i++ {
+		entry, err := e.AddEntry(AddEntryInput{Type: core.Note, Content: []byte(fmt.Sprintf("note %d", i)), Tags: []string{"t"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, entry.ID)
+	}
+	if err := e.ArchiveEntry(ids[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.DeleteEntry(ids[2]); err != nil {
+		t.Fatal(err)
+	}
+
+	tag := "t"
+	if n, err := e.Count(ListFilter{Tag: &tag, Limit: 1}); err != nil || n != 1 {
+		t.Errorf("Count = %d, %v; want 1", n, err)
+	}
+	if n, _ := e.Count(ListFilter{Archived: true}); n != 2 {
+		t.Errorf("expected 2 entries counting archived ones, got %d", n)
+	}
+	for i, want := range []bool{true, true, false} {
+		if found, err := e.Exists(ids[i]); err != nil || found != want {
+			t.Errorf("Exists(entry %d) = %v, %v; want %v", i, found, err, want)
+		}
+	}
+
+	// Counting decrypts nothing, so it works locked
+	if err := e.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := e.Count(ListFilter{}); err != nil || n != 1 {
+		t.Errorf("Count while locked = %d, %v; want 1", n, err)
+	}
+}
+
+
+func TestEntryWritesAreAtomic(t *testing.T) {
+	e, err := New(Config{InMemory: true, DisableSearch: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	entry, err := e.AddEntry(AddEntryInput{Type: core.Note, Content: []byte("before")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every version write fails from now on
+	db := e.(*engineImpl).store.(*sqlite.SQLiteStore).GetDB()
+	if _, err := db.Exec(`CREATE TRIGGER fail_versions BEFORE INSERT ON entry_versions
+		BEGIN SELECT RAISE(ABORT, 'disk full'); END`); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e.AddEntry(AddEntryInput{Type: core.Note, Content: []byte("lost")}); err == nil {
+		t.Fatal("expected AddEntry to fail")
+	}
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM entries").Scan(&n); err != nil || n != 1 {
+		t.Errorf("entries stored = %d, %v; want 1", n, err)
+	}
+	if err := db.QueryRow("SELECT COUNT(*) FROM entry_acl").Scan(&n); err != nil || n != 1 {
+		t.Errorf("ACLs stored = %d, %v; want 1", n, err)
+	}
+
+	after := []byte("after")
+	if err := e.UpdateEntry(entry.ID, UpdateEntryInput{Content: &after}); err == nil {
+		t.Fatal("expected UpdateEntry to fail")
+	}
+	var content []byte
+	if err := db.QueryRow("SELECT content FROM entries WHERE id = ?", entry.ID.String()).Scan(&content); err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "before" {
+		t.Errorf("stored content = %q, want the update rolled back", content)
+	}
+}
+
+func TestDurability(t *testing.T) {
+	if _, err := New(Config{InMemory: true, Durability: "sometimes"}); err == nil {
+		t.Error("expected an unknown durability to fail")
+	}
+
+	for _, durability := range []Durability{sqlite.DurabilitySync, sqlite.DurabilityRelaxed} {
+		dir := t.TempDir()
+		e, err := New(Config{DataDir: dir, DisableSearch: true, Durability: durability})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 10; i++ {
+			if _, err := e.AddEntry(AddEntryInput{Type: core.Note, Content: []byte(fmt.Sprintf("note %d", i))}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := e.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		// Close checkpoints the write-ahead log into the database file
+		if info, err := os.Stat(filepath.Join(dir, "acorde.db-wal")); err == nil && info.Size() > 0 {
+			t.Errorf("%s: write-ahead log holds %d bytes after Close", durability, info.Size())
+		}
+
+		e, err = New(Config{DataDir: dir, DisableSearch: true, Durability: durability})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n, err := e.Count(ListFilter{}); err != nil || n != 10 {
+			t.Errorf("%s: Count after reopening = %d, %v; want 10", durability, n, err)
+		}
+		e.Close()
+	}
+}
+func TestListWithoutContent(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	e, err := New(Config{InMemory: true, EncryptionKey: &key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	added, err := e.AddEntry(AddEntryInput{Type: core.Note, Content: []byte("secret"), Tags: []string{"a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.GetEntry(added.ID) // Cached with content
+
+	// Another peer's entry this device has no key for: skipped as in full
+	// listings
+	impl := e.(*engineImpl)
+	other, _ := e.AddEntry(AddEntryInput{Type: core.Note, Content: []byte("theirs")})
+	impl.acls.SetACL(core.ACL{EntryID: other.ID, Owner: "peer"})
+	sealed, _ := impl.store.Get(other.ID)
+	sealed.Content = []byte("sealed with a key this device lacks")
+	impl.store.Put(sealed)
+	impl.cache.invalidate(other.ID)
+	if full, _ := e.ListEntries(ListFilter{}); len(full) != 1 {
+		t.Fatalf("expected 1 readable entry, got %d", len(full))
+	}
+
+	check := func(when string, want int) {
+		t.Helper()
+		entries, err := e.ListEntries(ListFilter{WithoutContent: true})
+		if err != nil {
+			t.Fatalf("%s: %v", when, err)
+		}
+		if len(entries) != want {
+			t.Fatalf("%s: expected %d entries, got %d", when, want, len(entries))
+		}
+		got := entries[len(entries)-1] // Oldest last
+		if got.ID != added.ID || got.Type != core.Note || !slices.Equal(got.Tags, []string{"a"}) || got.UpdatedAt != added.UpdatedAt {
+			t.Errorf("%s: unexpected metadata %+v", when, got)
+		}
+		if got.Content != nil {
+			t.Errorf("%s: expected no content, got %q", when, got.Content)
+		}
+	}
+	check("unlocked", 1)
+
+	// Nothing is decrypted, so it works locked
+	if err := e.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	check("locked", 2) // Without the vault key, readability is unknown
+}
+
+func TestKeyEpochs(t *testing.T) {
+	retired, _ := crypto.GenerateKey()
+	key, _ := crypto.GenerateKey()
+	e, err := New(Config{InMemory: true, EncryptionKey: &key, KeyEpoch: 3, RetiredKeys: []crypto.EpochKey{{Epoch: 1, Key: retired}}})
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+	defer e.Close()
+	impl := e.(*engineImpl)
+
+	entry, err := e.AddEntry(AddEntryInput{Type: core.Note, Content: []byte("sealed at 3")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, _ := impl.store.Get(entry.ID)
+	if !bytes.HasPrefix(stored.Content, []byte{0xac, 0xe0, 0, 0, 0, 3}) {
+		t.Errorf("expected content to name epoch 3, got % x", stored.Content[:epochHeaderSize])
+	}
+
+	// Content from before epochs were recorded is still tried key by key
+	aad := []byte(entry.ID.String())
+	legacy, _ := crypto.Encrypt(retired, []byte("legacy"), aad)
+	if plain, current, err := impl.openWithVaultKeys(legacy, aad); err != nil || string(plain) != "legacy" || current {
+		t.Errorf("legacy content: got %q, current %v (%v)", plain, current, err)
+	}
+
+	// Epochs without a key fail rather than being tried with every key
+	unknown := slices.Clone(stored.Content)
+	unknown[epochHeaderSize-1] = 9
+	if _, _, err := impl.openWithVaultKeys(unknown, aad); err == nil {
+		t.Error("expected content naming an unknown epoch to fail")
+	}
+
+	// Rotating retires the key at its epoch, so the old content is opened
+	// by it; rotating back restores the key's own epoch
+	newKey, _ := crypto.GenerateKey()
+	if err := impl.setKey(crypto.EpochKey{Key: newKey}); err != nil {
+		t.Fatal(err)
+	}
+	if impl.epoch != 4 {
+		t.Errorf("expected epoch 4 after rotating, got %d", impl.epoch)
+	}
+	if plain, current, err := impl.openWithVaultKeys(stored.Content, aad); err != nil || string(plain) != "sealed at 3" || current {
+		t.Errorf("content at retired epoch 3: got %q, current %v (%v)", plain, current, err)
+	}
+	if err := impl.setKey(crypto.EpochKey{Key: key}); err != nil {
+		t.Fatal(err)
+	}
+	if impl.epoch != 3 {
+		t.Errorf("expected epoch 3 rotating back, got %d", impl.epoch)
+	}
+	if _, current, err := impl.openWithVaultKeys(stored.Content, aad); err != nil || !current {
+		t.Errorf("expected content at epoch 3 to be current again (%v)", err)
+	}
+}
+
+func TestEntryTitles(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	for _, tt := range []struct {
+		name string
+		key  *crypto.Key
+	}{{"plaintext", nil}, {"encrypted", &key}} {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := New(Config{InMemory: true, EncryptionKey: tt.key})
+			if err != nil {
+				t.Fatalf("failed to create engine: %v", err)
+			}
+			defer e.Close()
+			testEntryTitles(t, e)
+
+			// Titles are stored to sort by only where content is plaintext
+			var stored int
+			db := e.(*engineImpl).store.(*sqlite.SQLiteStore).GetDB()
+			if err := db.QueryRow(`SELECT COUNT(*) FROM entries WHERE sort_title != ''`).Scan(&stored); err != nil {
+				t.Fatal(err)
+			}
+			want := 3 // The titled entries
+			if tt.key != nil {
+				want = 0
+			}
+			if stored != want {
+				t.Errorf("expected %d stored titles, got %d", want, stored)
+			}
+		})
+	}
+}
+
+func testEntryTitles(t *testing.T, e Engine) {
+	inputs := []struct {
+		entryType EntryType
+		content   string
+		title     string
+	}{
+		{core.Note, "\n## Meeting notes\nbody", "Meeting notes"},
+		{core.Task, `{"title": "buy  milk", "completed": false}`, "buy milk"},
+		{core.Credential, `{"service": "Bank", "username": "me"}`, "Bank"},
+		{core.Config, `{"theme": "dark"}`, ""},
+	}
+	ids := make(map[string]uuid.UUID)
+	for _, in := range inputs {
+		entry, err := e.AddEntry(AddEntryInput{Type: in.entryType, Content: []byte(in.content)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry.Title != in.title {
+			t.Errorf("AddEntry title = %q, want %q", entry.Title, in.title)
+		}
+		if got, _ := e.GetEntry(entry.ID); got.Title != in.title {
+			t.Errorf("GetEntry title = %q, want %q", got.Title, in.title)
+		}
+		ids[in.title] = entry.ID
+	}
+	if err := e.ArchiveEntry(ids["Bank"]); err != nil {
+		t.Fatal(err)
+	}
+
+	// By title A to Z, untitled last, with or without content, paged
+	for _, withoutContent := range []bool{false, true} {
+		entries, err := e.ListEntries(ListFilter{Sort: SortTitle, Ascending: true, Archived: true, WithoutContent: withoutContent})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var titles []string
+		for _, entry := range entries {
+			titles = append(titles, entry.Title)
+		}
+		if want := []string{"Bank", "buy milk", "Meeting notes", ""}; !slices.Equal(titles, want) {
+			t.Errorf("WithoutContent %v: titles %q, want %q", withoutContent, titles, want)
+		}
+	}
+	page, _ := e.ListEntries(ListFilter{Sort: SortTitle, Limit: 1, Offset: 1})
+	if len(page) != 1 || page[0].Title != "buy milk" {
+		t.Errorf("expected the second title Z to A, got %+v", page)
+	}
+
+	// Archived entries keep their title but stay out of quick-open
+	if matches := e.QuickOpen("bank", 0); len(matches) != 0 {
+		t.Errorf("expected no archived matches, got %+v", matches)
+	}
+}
+
+func TestOversizedContentGoesToBlobs(t *testing.T) {
+	dir := t.TempDir()
+	e, err := New(Config{DataDir: dir, MaxContentSize: 10, DisableSearch: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	data := []byte("much larger than ten bytes")
+	entry, err := e.AddEntry(AddEntryInput{Type: core.Note, Content: data, Tags: []string{"big"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Type != core.File {
+		t.Fatalf("expected a file entry, got %s", entry.Type)
+	}
+	var fc blob.FileContent
+	if err := json.Unmarshal(entry.Content, &fc); err != nil || fc.Size != len(data) || fc.MIME == "" {
+		t.Fatalf("unexpected file content %s (%v)", entry.Content, err)
+	}
+	blobs, _ := blob.NewStore(dir)
+	if stored, err := blobs.Get(fc.CID); err != nil || !bytes.Equal(stored, data) {
+		t.Errorf("blob not stored: %v", err)
+	}
+
+	// An update crossing the limit turns the entry into a file
+	small, err := e.AddEntry(AddEntryInput{Type: core.Note, Content: []byte("small")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	grown := []byte("grown beyond ten bytes")
+	if err := e.UpdateEntry(small.ID, UpdateEntryInput{Content: &grown}); err != nil {
+		t.Fatal(err)
+	}
+	updated, _ := e.GetEntry(small.ID)
+	if updated.Type != core.File {
+		t.Fatalf("expected the updated entry to be a file, got %s", updated.Type)
+	}
+	if err := json.Unmarshal(updated.Content, &fc); err != nil || fc.Size != len(grown) {
+		t.Fatalf("unexpected file content %s (%v)", updated.Content, err)
+	}
+	if stored, err := blobs.Get(fc.CID); err != nil || !bytes.Equal(stored, grown) {
+		t.Errorf("updated blob not stored: %v", err)
+	}
+
+	// Unless disabled
+	e2, err := New(Config{DataDir: t.TempDir(), MaxContentSize: 10, DisableSearch: true, DisableBlobRouting: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e2.Close()
+	if _, err := e2.AddEntry(AddEntryInput{Type: core.Note, Content: data}); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("expected a limit error, got %v", err)
+	}
+	small, _ = e2.AddEntry(AddEntryInput{Type: core.Note, Content: []byte("small")})
+	if err := e2.UpdateEntry(small.ID, UpdateEntryInput{Content: &grown}); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("expected a limit error on update, got %v", err)
+	}
+}
+
+func TestOversizedContentIsSealedInEncryptedVaults(t *testing.T) {
+	dir := t.TempDir()
+	key, _ := crypto.GenerateKey()
+	e, err := New(Config{DataDir: dir, EncryptionKey: &key, MaxContentSize: 10, DisableSearch: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	data := []byte("much larger than ten bytes")
+	entry, err := e.AddEntry(AddEntryInput{Type: core.Note, Content: data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Type != core.File {
+		t.Fatalf("expected a file entry, got %s", entry.Type)
+	}
+	var fc blob.FileContent
+	if err := json.Unmarshal(entry.Content, &fc); err != nil || !fc.Sealed() {
+		t.Fatalf("expected a sealed file, got %s (%v)", entry.Content, err)
+	}
+	blobs, _ := blob.NewStore(dir)
+	stored, err := blobs.Get(fc.CID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(stored, data) {
+		t.Error("expected the blob to be stored encrypted")
+	}
+	if plain, err := fc.Open(stored); err != nil || !bytes.Equal(plain, data) {
+		t.Errorf("Open = %q, %v", plain, err)
+	}
+
+	// The per-file key needs the vault key
+	if err := e.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.StoreFile("", data); !errors.Is(err, ErrLocked) {
+		t.Errorf("expected ErrLocked, got %v", err)
+	}
+}
+
+func TestWebhookRedaction(t *testing.T) {
+	e := newTestEngine(t)
+	defer e.Close()
+
+	type delivery struct {
+		path  string // Which webhook
+		event hooks.HookEvent
+	}
+	received := make(chan delivery, 3)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event hooks.HookEvent
+		json.NewDecoder(r.Body).Decode(&event)
+		received <- delivery{r.URL.Path, event}
+	}))
+	defer server.Close()
+
+	for _, mode := range []hooks.Redaction{"", hooks.RedactStrip, hooks.RedactNone} {
+		err := e.Hooks().RegisterWebhook(hooks.WebhookConfig{
+			URL:    server.URL + "/" + string(mode),
+			Events: []hooks.EventType{hooks.EventCreate},
+			Redact: mode,
+		})
+		if err != nil {
+			t.Fatalf("failed to register webhook: %v", err)
+		}
+	}
+	if err := e.Hooks().RegisterWebhook(hooks.WebhookConfig{URL: server.URL, Redact: "hide"}); err == nil {
+		t.Error("expected an error for an unknown redaction")
+	}
+
+	content := `{"service":"GitHub","username":"alice","password":"hunter2"}`
+	if _, err := e.AddEntry(AddEntryInput{Type: core.Credential, Content: []byte(content)}); err != nil {
+		t.Fatalf("failed to add credential: %v", err)
+	}
+
+	want := map[string]string{
+		"/":      `{"service":"GitHub","username":"alice","password":"********"}`,
+		"/strip": "",
+		"/none":  content,
+	}
+	for range want {
+		select {
+		case d := <-received:
+			if string(d.event.Content) != want[d.path] {
+				t.Errorf("webhook %s got content %q, want %q", d.path, d.event.Content, want[d.path])
+			}
+			if d.event.Redacted != (d.path != "/none") {
+				t.Errorf("webhook %s got redacted=%v", d.path, d.event.Redacted)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for webhooks")
+		}
+	}
+}
+
+func TestWebhookBackfill(t *testing.T) {
+	e := newTestEngine(t)
+	defer e.Close()
+
+	var added []uuid.UUID
+	for _, content := range []string{"first", "second", "third"} {
+		entry, _ := e.AddEntry(AddEntryInput{Type: core.Note, Content: []byte(content)})
+		added = append(added, entry.ID)
+	}
+
+	received := make(chan hooks.HookEvent, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event hooks.HookEvent
+		json.NewDecoder(r.Body).Decode(&event)
+		received <- event
+	}))
+	defer server.Close()
+
+	err := e.Hooks().RegisterWebhook(hooks.WebhookConfig{
+		URL:          server.URL,
+		Events:       []hooks.EventType{hooks.EventCreate},
+		Backfill:     true,
+		BackfillRate: 100,
+	})
+	if err != nil {
+		t.Fatalf("failed to register webhook: %v", err)
+	}
+
+	// Hooks fire asynchronously, so the webhook may also get live events
+	// for the entries just added
+	next := func(backfill bool) hooks.HookEvent {
+		t.Helper()
+		for {
+			select {
+			case event := <-received:
+				if event.Backfill == backfill {
+					return event
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("timed out waiting for webhook")
+			}
+		}
+	}
+	for i, id := range added {
+		if event := next(true); event.EntryID != id || event.Type != hooks.EventCreate {
+			t.Errorf("backfill event %d: got %+v, want a create event for %s", i, event, id)
+		}
+	}
+
+	// New entries are delivered as usual
+	entry, _ := e.AddEntry(AddEntryInput{Type: core.Note, Content: []byte("fourth")})
+	for next(false).EntryID != entry.ID {
+	}
+}
+
+func TestWebhookStats(t *testing.T) {
+	e := newTestEngine(t)
+	defer e.Close()
+
+	var failing atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	disabled := make(chan hooks.HookEvent, 1)
+	e.Hooks().On(hooks.EventWebhookDisabled, func(event hooks.HookEvent) {
+		disabled <- event
+	})
+	err := e.Hooks().RegisterWebhook(hooks.WebhookConfig{
+		ID:           "wh",
+		URL:          server.URL,
+		Events:       []hooks.EventType{hooks.EventCreate},
+		MaxRetries:   1,
+		DisableAfter: 2,
+	})
+	if err != nil {
+		t.Fatalf("failed to register webhook: %v", err)
+	}
+
+	waitStats := func(done func(hooks.WebhookStats) bool) hooks.WebhookStats {
+		t.Helper()
+		deadline := time.Now().Add(10 * time.Second)
+		for {
+			stats, ok := e.Hooks().WebhookStats("wh")
+			if !ok {
+				t.Fatal("webhook stats not found")
+			}
+			if done(stats) {
+				return stats
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for webhook stats, got %+v", stats)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	e.AddEntry(AddEntryInput{Type: core.Note, Content: []byte("delivered")})
+	stats := waitStats(func(s hooks.WebhookStats) bool { return s.Deliveries == 1 })
+	if stats.Attempts != 1 || stats.Failures != 0 || stats.Disabled {
+		t.Errorf("after a delivery got %+v", stats)
+	}
+
+	// Two failed events in a row disable the webhook
+	failing.Store(true)
+	e.AddEntry(AddEntryInput{Type: core.Note, Content: []byte("lost")})
+	e.AddEntry(AddEntryInput{Type: core.Note, Content: []byte("lost too")})
+	select {
+	case event := <-disabled:
+		if event.WebhookID != "wh" || event.Error == "" {
+			t.Errorf("disabled event = %+v", event)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("webhook was not disabled")
+	}
+	stats = waitStats(func(s hooks.WebhookStats) bool { return s.Failures == 2 })
+	if !stats.Disabled || stats.ConsecutiveFailures != 2 || stats.Attempts != 5 || stats.LastError == "" {
+		t.Errorf("after failures got %+v", stats)
+	}
+
+	// Disabled webhooks get no events until re-enabled
+	failing.Store(false)
+	e.AddEntry(AddEntryInput{Type: core.Note, Content: []byte("skipped")})
+	time.Sleep(50 * time.Millisecond)
+	if stats, _ := e.Hooks().WebhookStats("wh"); stats.Attempts != 5 {
+		t.Errorf("disabled webhook got %d attempts, want 5", stats.Attempts)
+	}
+	if err := e.Hooks().EnableWebhook("wh"); err != nil {
+		t.Fatal(err)
+	}
+	e.AddEntry(AddEntryInput{Type: core.Note, Content: []byte("delivered again")})
+	stats = waitStats(func(s hooks.WebhookStats) bool { return s.Deliveries == 2 })
+	if stats.Disabled || stats.ConsecutiveFailures != 0 {
+		t.Errorf("after re-enabling got %+v", stats)
+	}
+}
+
+func TestSearchEnabledOnExistingVault(t *testing.T) {
+	dir := t.TempDir()
+	e, err := New(Config{DataDir: dir, DisableSearch: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < indexBatchSize+10; i++ {
+		e.AddEntry(AddEntryInput{Type: core.Note, Content: []byte(fmt.Sprintf("meeting %d", i))})
+	}
+	e.Close()
+
+	e, err = New(Config{DataDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	results, err := e.Search("meeting", search.SearchOptions{Limit: 1})
+	if err != nil {
+		t.Fatalf("search failed: %v", err)
+	}
+	if results.Total != indexBatchSize+10 {
+		t.Errorf("expected the whole vault indexed, got %d hits", results.Total)
+	}
+}
+
+func TestAppendLog(t *testing.T) {
+	e := newTestEngine(t).(*engineImpl)
+	defer e.Close()
+
+	sub := e.Subscribe()
+	defer sub.Close()
+
+	records := make([]LogRecord, 500)
+	for i := range records {
+		records[i] = LogRecord{Content: []byte(fmt.Sprintf(`{"cpu":%d}`, i)), Tags: []string{"metrics"}}
+	}
+	var ids []uuid.UUID
+	err := e.Bulk(func(b Batch) error {
+		var err error
+		if ids, err = b.AppendLog(records[:200]); err != nil {
+			return err
+		}
+		more, err := b.AppendLog(records[200:])
+		ids = append(ids, more...)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("AppendLog failed: %v", err)
+	}
+	if len(ids) != len(records) {
+		t.Fatalf("expected %d IDs, got %d", len(records), len(ids))
+	}
+
+	select {
+	case event := <-sub.Events():
+		if event.Type != EventAppended || event.Count != len(records) || event.EntryType != "log" {
+			t.Errorf("expected one appended event for %d logs, got %+v", len(records), event)
+		}
+	default:
+		t.Fatal("expected an appended event")
+	}
+	select {
+	case event := <-sub.Events():
+		t.Errorf("expected a single event, got extra %+v", event)
+	default:
+	}
+
+	entry, err := e.GetEntry(ids[42])
+	if err != nil {
+		t.Fatalf("GetEntry failed: %v", err)
+	}
+	if entry.Type != core.Log || string(entry.Content) != `{"cpu":42}` || len(entry.Tags) != 1 {
+		t.Errorf("unexpected entry %+v", entry)
+	}
+	if history, _ := e.Versions().GetHistory(ids[42]); len(history) != 0 {
+		t.Errorf("expected no version history, got %d versions", len(history))
+	}
+	stored, _ := e.store.List(storage.ListFilter{})
+	if len(stored) != len(records) {
+		t.Errorf("expected %d stored entries, got %d", len(records), len(stored))
+	}
+
+	// A bad record rejects the whole batch
+	e.RegisterSchema("log", []byte(`{"type": "object", "required": ["cpu"]}`))
+	_, err = e.AppendLog([]LogRecord{{Content: []byte(`{"cpu":1}`)}, {Content: []byte(`{}`)}})
+	if !errors.Is(err, ErrSchemaValidation) {
+		t.Errorf("expected a schema error, got %v", err)
+	}
+	if all, _ := e.ListEntries(ListFilter{}); len(all) != len(records) {
+		t.Errorf("expected a rejected batch to add nothing, got %d entries", len(all))
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	encrypted, err := New(Config{InMemory: true, EncryptionKey: &key})
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+	engines := map[string]Engine{"plain": newTestEngine(t), "encrypted": encrypted}
+
+	for name, e := range engines {
+		t.Run(name, func(t *testing.T) {
+			defer e.Close()
+			for _, ms := range []int{10, 30, 50} {
+				e.AddEntry(AddEntryInput{Type: core.Log, Content: []byte(fmt.Sprintf(`{"req":{"ms":%d}}`, ms))})
+			}
+			e.AddEntry(AddEntryInput{Type: core.Log, Content: []byte(`{"req":{"ms":"slow"}}`)})
+			e.AddEntry(AddEntryInput{Type: core.Note, Content: []byte(`{"req":{"ms":1000}}`)})
+
+			logs := core.Log
+			today := time.Now().UTC().Truncate(24 * time.Hour)
+			filter := AggregateFilter{Type: &logs, Since: today.AddDate(0, 0, -2), Location: time.UTC}
+
+			buckets, err := e.Aggregate(filter, BucketDay, Aggregation{})
+			if err != nil {
+				t.Fatalf("Aggregate failed: %v", err)
+			}
+			if len(buckets) != 3 || !buckets[0].Start.Equal(filter.Since) || buckets[0].Count != 0 {
+				t.Fatalf("expected 3 days starting with an empty one, got %+v", buckets)
+			}
+			if last := buckets[2]; !last.Start.Equal(today) || last.Count != 4 || last.Value != 4 {
+				t.Errorf("expected 4 logs today, got %+v", last)
+			}
+
+			want := map[AggregateFunc]float64{AggSum: 90, AggAvg: 30, AggMin: 10, AggMax: 50}
+			for fn, value := range want {
+				buckets, err := e.Aggregate(filter, BucketDay, Aggregation{Func: fn, Field: "req.ms"})
+				if err != nil {
+					t.Fatalf("Aggregate %s failed: %v", fn, err)
+				}
+				if last := buckets[len(buckets)-1]; last.Count != 3 || last.Value != value {
+					t.Errorf("%s: expected %v over 3 logs, got %+v", fn, value, last)
+				}
+			}
+
+			if _, err := e.Aggregate(filter, "year", Aggregation{}); err == nil {
+				t.Error("expected an error for an unknown bucket")
+			}
+			if _, err := e.Aggregate(filter, BucketDay, Aggregation{Func: AggSum, Field: "$.x') --"}); err == nil {
+				t.Error("expected an error for an invalid field")
+			}
+		})
+	}
+}
+
+func TestAggregateBuckets(t *testing.T) {
+	// 2026-03-01 is a Sunday; Kolkata is UTC+5:30
+	loc := time.FixedZone("IST", 5*3600+1800)
+	rows := []storage.AggregateRow{
+		{Start: time.Date(2026, 2, 28, 18, 15, 0, 0, time.UTC).UnixMilli(), Count: 1, Sum: 2, Min: 2, Max: 2},
+		{Start: time.Date(2026, 2, 28, 18, 30, 0, 0, time.UTC).UnixMilli(), Count: 2, Sum: 10, Min: 3, Max: 7},
+		{Start: time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC).UnixMilli(), Count: 1, Sum: 1, Min: 1, Max: 1},
+	}
+
+	days := toBuckets(rows, AggregateFilter{}, BucketDay, AggMax, loc)
+	if len(days) != 3 {
+		t.Fatalf("expected Feb 28 to Mar 2 in IST, got %+v", days)
+	}
+	if d := days[0]; !d.Start.Equal(time.Date(2026, 2, 28, 0, 0, 0, 0, loc)) || d.Count != 1 {
+		t.Errorf("expected 23:45 IST on Feb 28 in its own day, got %+v", d)
+	}
+	if d := days[1]; d.Count != 2 || d.Value != 7 {
+		t.Errorf("expected max 7 on Mar 1, got %+v", d)
+	}
+
+	weeks := toBuckets(rows, AggregateFilter{}, BucketWeek, AggSum, loc)
+	if len(weeks) != 2 || weeks[0].Start.Weekday() != time.Monday || weeks[0].Value != 12 || weeks[1].Value != 1 {
+		t.Errorf("expected Monday weeks summing 12 and 1, got %+v", weeks)
+	}
+
+	months := toBuckets(rows, AggregateFilter{}, BucketMonth, AggCount, time.UTC)
+	if len(months) != 2 || months[0].Value != 3 || months[1].Value != 1 {
+		t.Errorf("expected 3 in February and 1 in March UTC, got %+v", months)
+	}
+
+	if empty := toBuckets(nil, AggregateFilter{}, BucketDay, AggCount, loc); len(empty) != 0 {
+		t.Errorf("expected no buckets without entries or bounds, got %+v", empty)
+	}
+}
+
+func TestPatchEntry(t *testing.T) {
+	e := newTestEngine(t)
+	defer e.Close()
+
+	err := e.RegisterSchema("note", []byte(`{"type":"object","required":["title"],"properties":{"title":{"type":"string"},"done":{"type":"boolean"}}}`))
+	if err != nil {
+		t.Fatalf("failed to register schema: %v", err)
+	}
+	entry, err := e.AddEntry(AddEntryInput{Type: core.Note, Content: []byte(`{"title":"Write docs","done":false}`), Tags: []string{"inbox"}})
+	if err != nil {
+		t.Fatalf("AddEntry failed: %v", err)
+	}
+
+	patched, err := e.PatchEntry(entry.ID, EntryPatch{
+		JSONPatch:  []PatchOperation{{Op: "test", Path: "/done", Value: []byte(`false`)}, {Op: "replace", Path: "/done", Value: []byte(`true`)}},
+		AddTags:    []string{"done", "inbox"},
+		RemoveTags: []string{"inbox"},
+	})
+	if err != nil {
+		t.Fatalf("PatchEntry failed: %v", err)
+	}
+	if string(patched.Content) != `{"done":true,"title":"Write docs"}` || !slices.Equal(patched.Tags, []string{"done"}) {
+		t.Errorf("unexpected patched entry: %s %v", patched.Content, patched.Tags)
+	}
+
+	patched, err = e.PatchEntry(entry.ID, EntryPatch{MergePatch: []byte(`{"title":"Write more docs","done":null}`)})
+	if err != nil {
+		t.Fatalf("merge patch failed: %v", err)
+	}
+	if string(patched.Content) != `{"title":"Write more docs"}` {
+		t.Errorf("unexpected merged content: %s", patched.Content)
+	}
+
+	failures := []struct {
+		patch EntryPatch
+		want  error
+	}{
+		{EntryPatch{JSONPatch: []PatchOperation{{Op: "test", Path: "/title", Value: []byte(`"Write docs"`)}}}, ErrPatchTestFailed},
+		{EntryPatch{JSONPatch: []PatchOperation{{Op: "remove", Path: "/missing"}}}, ErrInvalidPatch},
+		{EntryPatch{MergePatch: []byte(`{"title":null}`)}, ErrSchemaValidation},
+		{EntryPatch{}, ErrInvalidPatch},
+	}
+	for _, f := range failures {
+		if _, err := e.PatchEntry(entry.ID, f.patch); !errors.Is(err, f.want) {
+			t.Errorf("patch %+v: expected %v, got %v", f.patch, f.want, err)
+		}
+	}
+	if got, _ := e.GetEntry(entry.ID); string(got.Content) != `{"title":"Write more docs"}` {
+		t.Errorf("failed patches changed the entry: %s", got.Content)
+	}
+
+	// Concurrent patches each see the previous one's result
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			e.PatchEntry(entry.ID, EntryPatch{AddTags: []string{fmt.Sprintf("t%d", i)}})
+		}(i)
+	}
+	wg.Wait()
+	if got, _ := e.GetEntry(entry.ID); len(got.Tags) != 11 {
+		t.Errorf("expected every concurrent tag patch to stick, got %v", got.Tags)
+	}
+}
+
+// recordingProvider hands out a tracer that records the spans it starts
+type recordingProvider struct {
+	embedded.TracerProvider
+	tracer *recordingTracer
+}
+
+type recordingTracer struct {
+	embedded.Tracer
+
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+type recordedSpan struct {
+	noop.Span
+	name   string
+	sc     trace.SpanContext
+	parent trace.SpanID
+	err    error
+	ended  bool
+}
+
+func (p recordingProvider) Tracer(string, ...trace.TracerOption) trace.Tracer { return p.tracer }
+
+func (t *recordingTracer) Start(ctx context.Context, name string, _ ...trace.SpanStartOption) (context.Context, trace.Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	span := &recordedSpan{name: name, parent: trace.SpanContextFromContext(ctx).SpanID()}
+	span.sc = trace.NewSpanContext(trace.SpanContextConfig{TraceID: trace.TraceID{1}, SpanID: trace.SpanID{byte(len(t.spans) + 1)}})
+	t.spans = append(t.spans, span)
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+func (s *recordedSpan) SpanContext() trace.SpanContext { return s.sc }
+func (s *recordedSpan) IsRecording() bool              { return !s.ended }
+func (s *recordedSpan) RecordError(err error, _ ...trace.EventOption) {
+	s.err = err
+}
+func (s *recordedSpan) End(...trace.SpanEndOption) { s.ended = true }
+
+func TestArchiveEntry(t *testing.T) {
+	e := newTestEngine(t).(*engineImpl)
+	defer e.Close()
+
+	kept, _ := e.AddEntry(AddEntryInput{Type: core.Note, Content: []byte("kept meeting notes")})
+	old, _ := e.AddEntry(AddEntryInput{Type: core.Note, Content: []byte("old meeting notes")})
+
+	sub := e.Subscribe()
+	defer sub.Close()
+	if err := e.ArchiveEntry(old.ID); err != nil {
+		t.Fatalf("ArchiveEntry failed: %v", err)
+	}
+	if event := <-sub.Events(); event.Type != EventArchived || event.EntryID != old.ID {
+		t.Errorf("expected archived event for %s, got %+v", old.ID, event)
+	}
+	if err := e.ArchiveEntry(old.ID); err != nil {
+		t.Fatalf("archiving an archived entry failed: %v", err)
+	}
+	select {
+	case event := <-sub.Events():
+		t.Errorf("expected no event archiving twice, got %+v", event)
+	default:
+	}
+
+	ids := func(filter ListFilter) []uuid.UUID {
+		entries, err := e.ListEntries(filter)
+		if err != nil {
+			t.Fatalf("ListEntries failed: %v", err)
+		}
+		var ids []uuid.UUID
+		for _, entry := range entries {
+			ids = append(ids, entry.ID)
+		}
+		return ids
+	}
+	if got := ids(ListFilter{}); !slices.Equal(got, []uuid.UUID{kept.ID}) {
+		t.Errorf("default list: expected only %s, got %v", kept.ID, got)
+	}
+	if got := ids(ListFilter{OnlyArchived: true}); !slices.Equal(got, []uuid.UUID{old.ID}) {
+		t.Errorf("archived list: expected only %s, got %v", old.ID, got)
+	}
+	if got := ids(ListFilter{Archived: true}); len(got) != 2 {
+		t.Errorf("expected both entries with Archived, got %v", got)
+	}
+
+	results, err := e.Search("meeting", search.SearchOptions{})
+	if err != nil || len(results.Hits) != 1 || results.Hits[0].ID != kept.ID {
+		t.Errorf("expected search to skip the archived entry, got %+v (%v)", results, err)
+	}
+	if results, _ := e.Search("meeting", search.SearchOptions{Archived: true}); len(results.Hits) != 2 {
+		t.Errorf("expected search with Archived to find both entries, got %+v", results)
+	}
+	if matches := e.QuickOpen("old", 0); len(matches) != 0 {
+		t.Errorf("expected quick open to skip the archived entry, got %+v", matches)
+	}
+
+	// Editing an archived entry keeps it archived
+	content := []byte("old meeting notes, edited")
+	if err := e.UpdateEntry(old.ID, UpdateEntryInput{Content: &content}); err != nil {
+		t.Fatalf("UpdateEntry failed: %v", err)
+	}
+	if got, _ := e.GetEntry(old.ID); !got.Archived {
+		t.Error("expected entry to stay archived after an edit")
+	}
+
+	// The archive state syncs, and so does unarchiving
+	peer := newTestEngine(t)
+	defer peer.Close()
+	payload, _ := e.GetSyncPayload()
+	if err := peer.ApplyRemotePayload(payload); err != nil {
+		t.Fatalf("ApplyRemotePayload failed: %v", err)
+	}
+	if got, _ := peer.GetEntry(old.ID); !got.Archived {
+		t.Error("expected archive state to sync")
+	}
+
+	if err := e.UnarchiveEntry(old.ID); err != nil {
+		t.Fatalf("UnarchiveEntry failed: %v", err)
+	}
+	if got := ids(ListFilter{}); len(got) != 2 {
+		t.Errorf("expected unarchived entry back in the default list, got %v", got)
+	}
+	peerSub := peer.Subscribe()
+	defer peerSub.Close()
+	payload, _ = e.GetSyncPayload()
+	if err := peer.ApplyRemotePayload(payload); err != nil {
+		t.Fatalf("ApplyRemotePayload failed: %v", err)
+	}
+	if event := <-peerSub.Events(); event.Type != EventUnarchived || event.Origin != OriginRemote {
+		t.Errorf("expected remote unarchived event, got %+v", event)
+	}
+	if got, _ := peer.GetEntry(old.ID); got.Archived {
+		t.Error("expected unarchive to sync")
+	}
+}
+
+func TestCorruptEntries(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	e, err := New(Config{InMemory: true, EncryptionKey: &key})
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+	defer e.Close()
+	impl := e.(*engineImpl)
+
+	good, _ := e.AddEntry(AddEntryInput{Type: core.Note, Content: []byte("fine")})
+	bad, _ := e.AddEntry(AddEntryInput{Type: core.Note, Content: []byte("damaged")})
+
+	// Damage the stored ciphertext of one entry
+	stored, _ := impl.store.Get(bad.ID)
+	stored.Content = append(stored.Content[:len(stored.Content)-1], stored.Content[len(stored.Content)-1]^0xff)
+	if err := impl.store.Put(stored); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	impl.cache.invalidate(bad.ID)
+
+	entries, err := e.ListEntries(ListFilter{})
+	if err != nil {
+		t.Fatalf("expected ListEntries to skip the corrupt entry, got %v", err)
+	}
+	if len(entries) != 1 || entries[0].ID != good.ID {
+		t.Errorf("expected only %s, got %+v", good.ID, entries)
+	}
+
+	result, err := e.ListEntriesChecked(ListFilter{})
+	if err != nil || len(result.Entries) != 1 || len(result.Corrupt) != 1 || result.Corrupt[0].ID != bad.ID {
+		t.Errorf("expected %s reported as corrupt, got %+v (%v)", bad.ID, result, err)
+	}
+
+	report, err := e.VerifyIntegrity()
+	if err != nil {
+		t.Fatalf("VerifyIntegrity failed: %v", err)
+	}
+	if report.Entries != 2 || report.Versions != 2 {
+		t.Errorf("expected 2 entries and 2 versions checked, got %+v", report)
+	}
+	if len(report.Corrupt) != 1 || report.Corrupt[0].ID != bad.ID || report.Corrupt[0].Version != 0 {
+		t.Errorf("expected the current content of %s reported, got %+v", bad.ID, report.Corrupt)
+	}
+}
+
+func TestTransferEntry(t *testing.T) {
+	srcKey, _ := crypto.GenerateKey()
+	dstKey, _ := crypto.GenerateKey()
+	srcDir, dstDir := t.TempDir(), t.TempDir()
+	src, err := New(Config{DataDir: srcDir, EncryptionKey: &srcKey, DisableSearch: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	dst, err := New(Config{DataDir: dstDir, EncryptionKey: &dstKey, DisableSearch: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+
+	entry, _ := src.AddEntry(AddEntryInput{Type: core.Note, Content: []byte("v1"), Tags: []string{"a"}})
+	v2 := []byte("v2")
+	src.UpdateEntry(entry.ID, UpdateEntryInput{Content: &v2})
+
+	copied, err := src.CopyEntryTo(entry.ID, dst)
+	if err != nil {
+		t.Fatalf("CopyEntryTo failed: %v", err)
+	}
+	if copied.ID != entry.ID || string(copied.Content) != "v2" {
+		t.Errorf("unexpected copy %+v", copied)
+	}
+	got, err := dst.GetEntry(entry.ID)
+	if err != nil || string(got.Content) != "v2" || !slices.Equal(got.Tags, []string{"a"}) {
+		t.Fatalf("copy not readable in destination: %+v (%v)", got, err)
+	}
+	if got.CreatedTime.UnixMilli() != entry.CreatedTime.UnixMilli() {
+		t.Errorf("expected creation time %v, got %v", entry.CreatedTime, got.CreatedTime)
+	}
+	history, _ := dst.Versions().GetHistory(entry.ID)
+	if len(history) != 2 {
+		t.Fatalf("expected 2 versions, got %d", len(history))
+	}
+	stored, _ := dst.(*engineImpl).store.Get(entry.ID)
+	if bytes.Contains(stored.Content, []byte("v2")) {
+		t.Error("copy stored in the clear")
+	}
+	if plaintext, err := dst.(*engineImpl).decrypt(entry.ID, history[1].Content); err != nil || string(plaintext) != "v1" {
+		t.Errorf("history not re-encrypted: %q (%v)", plaintext, err)
+	}
+	if _, err := src.GetEntry(entry.ID); err != nil {
+		t.Errorf("copy removed the source entry: %v", err)
+	}
+	if _, err := src.CopyEntryTo(entry.ID, dst); !errors.Is(err, ErrEntryExists) {
+		t.Errorf("expected ErrEntryExists, got %v", err)
+	}
+
+	// Edits after the copy order after its history
+	v3 := []byte("v3")
+	if err := dst.UpdateEntry(entry.ID, UpdateEntryInput{Content: &v3}); err != nil {
+		t.Fatalf("copy not writable: %v", err)
+	}
+	if history, _ := dst.Versions().GetHistory(entry.ID); len(history) != 3 || history[0].Timestamp <= history[1].Timestamp {
+		t.Errorf("unexpected history order %+v", history)
+	}
+
+	// Moving takes the blobs of file entries along
+	blobs, _ := blob.NewStore(srcDir)
+	fc, _ := blob.StoreFile(blobs.PutWithSubdir, "a.txt", []byte("attachment"))
+	content, _ := json.Marshal(fc)
+	file, _ := src.AddEntry(AddEntryInput{Type: core.File, Content: content})
+	if _, err := src.MoveEntryTo(file.ID, dst); err != nil {
+		t.Fatalf("MoveEntryTo failed: %v", err)
+	}
+	if _, err := src.GetEntry(file.ID); err == nil {
+		t.Error("moved entry still in source")
+	}
+	if history, _ := src.Versions().GetHistory(file.ID); len(history) != 0 {
+		t.Errorf("moved entry left %d versions in source", len(history))
+	}
+	dstBlobs, _ := blob.NewStore(dstDir)
+	if data, err := dstBlobs.Get(fc.CID); err != nil || string(data) != "attachment" {
+		t.Errorf("blob not copied: %v", err)
+	}
+
+	if _, err := src.CopyEntryTo(entry.ID, src); err == nil {
+		t.Error("expected an error copying to the same vault")
+	}
+}
+
+func TestInMemoryNodeID(t *testing.T) {
+	t.Chdir(t.TempDir())
+	e, err := New(Config{InMemory: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	if e.(*engineImpl).localID == "" {
+		t.Error("expected a node ID")
+	}
+	if _, err := os.Stat("node_id"); !os.IsNotExist(err) {
+		t.Errorf("in-memory engine wrote node_id to the working directory: %v", err)
+	}
+}
+
+func TestSingleUserACL(t *testing.T) {
+	e := newTestEngine(t)
+	defer e.Close()
+	impl := e.(*engineImpl)
+
+	// An entry owned by another node ID, e.g. one this device had before
+	// its node_id file was lost
+	entry, _ := e.AddEntry(AddEntryInput{Type: core.Note, Content: []byte("mine")})
+	impl.acls.SetACL(core.ACL{EntryID: entry.ID, Owner: "old-node-id"})
+
+	if _, err := e.GetEntry(entry.ID); err != nil {
+		t.Errorf("single-user vault should not check ACLs: %v", err)
+	}
+	if err := e.UpdateEntry(entry.ID, UpdateEntryInput{Tags: &[]string{"x"}}); err != nil {
+		t.Errorf("single-user vault should not check ACLs: %v", err)
+	}
+
+	// Sharing any entry turns enforcement on
+	other, _ := e.AddEntry(AddEntryInput{Type: core.Note, Content: []byte("shared")})
+	impl.acls.SetACL(core.ACL{EntryID: other.ID, Owner: impl.localID, Readers: []string{"peer"}})
+	if _, err := e.GetEntry(entry.ID); err == nil {
+		t.Error("ACLs should be checked once an entry is shared")
+	}
+	if _, err := e.GetEntry(other.ID); err != nil {
+		t.Errorf("owner should read its shared entry: %v", err)
+	}
+	if err := e.DeleteEntry(entry.ID); err == nil {
+		t.Error("deleting an entry this device may not write should fail")
+	}
+	if _, err := impl.replica.GetEntry(entry.ID); err != nil {
+		t.Errorf("refused delete left a tombstone: %v", err)
+	}
+
+	// DisableACL: no ACLs stored, no checks, no sharing
+	d, err := New(Config{InMemory: true, DisableACL: true})
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+	defer d.Close()
+	dimpl := d.(*engineImpl)
+
+	entry, _ = d.AddEntry(AddEntryInput{Type: core.Note, Content: []byte("mine")})
+	if _, ok := dimpl.replica.GetACL(entry.ID); ok {
+		t.Error("DisableACL should not store an ACL for new entries")
+	}
+	dimpl.acls.SetACL(core.ACL{EntryID: entry.ID, Owner: "peer", Readers: []string{"other"}})
+	if _, err := d.GetEntry(entry.ID); err != nil {
+		t.Errorf("DisableACL should never check ACLs: %v", err)
+	}
+	if err := d.ShareEntry(entry.ID, []string{"peer"}); !errors.Is(err, ErrACLDisabled) {
+		t.Errorf("expected ErrACLDisabled, got %v", err)
+	}
+}
+
+func TestACLGroups(t *testing.T) {
+	e := newTestEngine(t)
+	defer e.Close()
+	impl := e.(*engineImpl)
+
+	if _, err := e.CreateGroup("family", []string{"alice", "bob", "alice"}); err != nil {
+		t.Fatalf("CreateGroup failed: %v", err)
+	}
+	if _, err := e.CreateGroup("family", nil); !errors.Is(err, ErrGroupExists) {
+		t.Errorf("expected ErrGroupExists, got %v", err)
+	}
+	if _, err := e.CreateGroup("not a name", nil); err == nil {
+		t.Error("expected an invalid group name to fail")
+	}
+	group, err := e.GetGroup("family")
+	if err != nil || len(group.Members) != 2 {
+		t.Fatalf("expected 2 deduplicated members, got %+v, %v", group, err)
+	}
+
+	// A group grant lets its members write, as membership is now
+	entry, _ := e.AddEntry(AddEntryInput{Type: core.Note, Content: []byte("groceries")})
+	if err := e.GrantGroup(entry.ID, "family", true); err != nil {
+		t.Fatalf("GrantGroup failed: %v", err)
+	}
+	canWrite := func(peer string) bool {
+		allowed, _ := impl.acls.CheckWrite(entry.ID, peer)
+		return allowed
+	}
+	if !canWrite("alice") || canWrite("carol") {
+		t.Error("expected alice, not carol, to write through the group")
+	}
+	if _, err := e.UpdateGroup("family", []string{"carol"}, []string{"alice"}); err != nil {
+		t.Fatalf("UpdateGroup failed: %v", err)
+	}
+	if canWrite("alice") || !canWrite("carol") {
+		t.Error("expected the grant to follow the group's new members")
+	}
+	if err := e.RevokeGroup(entry.ID, "family"); err != nil {
+		t.Fatalf("RevokeGroup failed: %v", err)
+	}
+	if canWrite("carol") {
+		t.Error("expected no access after revoking the group")
+	}
+
+	// Groups resolve for this device's own access too
+	other, _ := e.AddEntry(AddEntryInput{Type: core.Note, Content: []byte("theirs")})
+	impl.acls.SetACL(core.ACL{EntryID: other.ID, Owner: "old-node-id", Readers: []string{acl.GroupRef("readers")}})
+	if _, err := e.GetEntry(other.ID); err == nil {
+		t.Error("expected no access before joining the group")
+	}
+	if _, err := e.CreateGroup("readers", []string{impl.localID}); err != nil {
+		t.Fatalf("CreateGroup failed: %v", err)
+	}
+	if _, err := e.GetEntry(other.ID); err != nil {
+		t.Errorf("expected access through the group: %v", err)
+	}
+	if err := e.DeleteGroup("readers"); err != nil {
+		t.Fatalf("DeleteGroup failed: %v", err)
+	}
+	if _, err := e.GetEntry(other.ID); err == nil {
+		t.Error("expected no access once the group is deleted")
+	}
+
+	groups, err := e.ListGroups()
+	if err != nil || len(groups) != 1 || groups[0].Name != "family" {
+		t.Errorf("expected only family to remain, got %+v, %v", groups, err)
+	}
+}
+
+func TestTracing(t *testing.T) {
+	tracer := &recordingTracer{}
+	e, err := New(Config{InMemory: true, TracerProvider: recordingProvider{tracer: tracer}})
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+	defer e.Close()
+
+	entry, _ := e.AddEntry(AddEntryInput{Type: core.Note, Content: []byte("traced")})
+	e.ListEntries(ListFilter{})
+	e.UpdateEntry(uuid.New(), UpdateEntryInput{})
+
+	tracer.mu.Lock()
+	defer tracer.mu.Unlock()
+	byName := make(map[string]*recordedSpan)
+	for _, span := range tracer.spans {
+		if !span.ended {
+			t.Errorf("span %s was not ended", span.name)
+		}
+		byName[span.name] = span
+	}
+	for _, pair := range [][2]string{{"sqlite.PutWith", "acorde.AddEntry"}, {"sqlite.List", "acorde.ListEntries"}} {
+		child, parent := byName[pair[0]], byName[pair[1]]
+		if child == nil || parent == nil {
+			t.Fatalf("expected %s and %s spans, got %v", pair[0], pair[1], tracer.spans)
+		}
+		if child.parent != parent.sc.SpanID() {
+			t.Errorf("expected %s to be a child of %s", pair[0], pair[1])
+		}
+	}
+	if span := byName["acorde.UpdateEntry"]; span == nil || span.err == nil {
+		t.Errorf("expected the failed update's span to record its error")
+	}
+	if entry.ID == uuid.Nil {
+		t.Error("expected the traced AddEntry to succeed")
+	}
+}
+
+func TestStats(t *testing.T) {
+	dir := t.TempDir()
+	e, err := New(Config{DataDir: dir, MaxContentSize: 10, DisableSearch: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	a, _ := e.AddEntry(AddEntryInput{Type: core.Note, Content: []byte("one"), Tags: []string{"work"}})
+	b, _ := e.AddEntry(AddEntryInput{Type: core.Note, Content: []byte("two"), Tags: []string{"work", "home"}})
+	c, _ := e.AddEntry(AddEntryInput{Type: core.Task, Content: []byte("{}")})
+	e.AddEntry(AddEntryInput{Type: core.Note, Content: []byte("much larger than ten bytes")}) // Moved to a blob
+	content := []byte("uno")
+	if err := e.UpdateEntry(a.ID, UpdateEntryInput{Content: &content}); err != nil {
+		t.Fatal(err)
+	}
+	e.ArchiveEntry(b.ID)
+	e.DeleteEntry(c.ID)
+
+	stats, err := e.Stats()
+	if err != nil {
+		t.Fatalf("Stats failed: %v", err)
+	}
+	want := EntryStats{
+		Total: 3, Archived: 1, Deleted: 1,
+		ByType: map[string]int{"note": 2, "file": 1},
+		ByTag:  map[string]int{"work": 2, "home": 1},
+	}
+	if got := stats.Entries; got.Total != want.Total || got.Archived != want.Archived || got.Deleted != want.Deleted ||
+		fmt.Sprint(got.ByType) != fmt.Sprint(want.ByType) || fmt.Sprint(got.ByTag) != fmt.Sprint(want.ByTag) {
+		t.Errorf("Entries = %+v, want %+v", got, want)
+	}
+	if stats.Storage.ContentBytes["note"] != 6 {
+		t.Errorf("note content = %d bytes, want 6", stats.Storage.ContentBytes["note"])
+	}
+	if stats.Storage.Blobs != 1 || stats.Storage.BlobBytes != 26 || stats.Storage.DatabaseBytes == 0 {
+		t.Errorf("Storage = %+v", stats.Storage)
+	}
+	if len(stats.Activity) != StatsActivityDays || stats.Activity[StatsActivityDays-1].Count != 3 { // Live entries
+		t.Errorf("Activity has %d days, today %+v", len(stats.Activity), stats.Activity[len(stats.Activity)-1])
+	}
+	if stats.Versions.Total < 5 || stats.Versions.Entries != 4 {
+		t.Errorf("Versions = %+v", stats.Versions)
+	}
+}
+
+func TestLazyLoad(t *testing.T) {
+	dir := t.TempDir()
+	e, err := New(Config{DataDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, _ := e.AddEntry(AddEntryInput{Type: core.Note, Content: []byte("# Groceries\nmilk"), Tags: []string{"home"}})
+	second, _ := e.AddEntry(AddEntryInput{Type: core.Note, Content: []byte("# Recipes")})
+	e.Close()
+
+	e, err = New(Config{DataDir: dir, LazyLoad: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	replica := e.(*engineImpl).replica
+
+	if entries, err := e.ListEntries(ListFilter{}); err != nil || len(entries) != 2 {
+		t.Fatalf("ListEntries = %d entries, %v", len(entries), err)
+	}
+	if results := e.QuickOpen("groc", 10); len(results) != 1 || results[0].ID != first.ID {
+		t.Errorf("QuickOpen = %+v", results)
+	}
+	entry, err := e.GetEntry(first.ID)
+	if err != nil || string(entry.Content) != "# Groceries\nmilk" || len(entry.Tags) != 1 {
+		t.Fatalf("GetEntry = %+v, %v", entry, err)
+	}
+	content := []byte("# Groceries\neggs")
+	if err := e.UpdateEntry(first.ID, UpdateEntryInput{Content: &content}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Merging a peer's changes loads only the entries they touch
+	peer, err := New(Config{InMemory: true, DisableSearch: true, DisableACL: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+	third, _ := peer.AddEntry(AddEntryInput{Type: core.Note, Content: []byte("# From a peer")})
+	delta, _ := peer.GetSyncDelta(0)
+	if err := e.ApplyRemotePayload(delta); err != nil {
+		t.Fatal(err)
+	}
+	if replica.Hydrated() {
+		t.Fatal("reads, writes and merges hydrated the whole replica")
+	}
+	if got, err := e.GetEntry(third.ID); err != nil || string(got.Content) != "# From a peer" {
+		t.Errorf("merged entry = %+v, %v", got, err)
+	}
+	if _, err := e.GetEntry(second.ID); err != nil {
+		t.Error(err)
+	}
+
+	// A sync payload needs every entry
+	if _, err := e.GetSyncPayload(); err != nil {
+		t.Fatal(err)
+	}
+	if !replica.Hydrated() {
+		t.Error("GetSyncPayload did not hydrate the replica")
+	}
+	if got, _ := e.GetEntry(first.ID); string(got.Content) != string(content) {
+		t.Errorf("hydration lost a local change: %q", got.Content)
+	}
+}
+
+func TestCollections(t *testing.T) {
+	e := newTestEngine(t)
+	defer e.Close()
+
+	work, err := e.CreateCollection("work", uuid.Nil)
+	if err != nil {
+		t.Fatalf("CreateCollection failed: %v", err)
+	}
+	projects, err := e.CreateCollection("projects", work.ID)
+	if err != nil {
+		t.Fatalf("CreateCollection failed: %v", err)
+	}
+	if projects.Path != "/work/projects" || projects.Parent != work.ID {
+		t.Errorf("unexpected collection %+v", projects)
+	}
+	if _, err := e.CreateCollection("projects", work.ID); !errors.Is(err, ErrCollectionExists) {
+		t.Errorf("expected ErrCollectionExists, got %v", err)
+	}
+	if _, err := e.CreateCollection("a/b", uuid.Nil); err == nil {
+		t.Error("expected a name with '/' to fail")
+	}
+	if got, err := e.ResolveCollection("work/projects/"); err != nil || got.ID != projects.ID {
+		t.Errorf("ResolveCollection = %+v, %v", got, err)
+	}
+
+	// Moving files an entry without touching its content or tags
+	entry, _ := e.AddEntry(AddEntryInput{Type: core.Note, Content: []byte("plan"), Tags: []string{"todo"}})
+	loose, _ := e.AddEntry(AddEntryInput{Type: core.Note, Content: []byte("loose")})
+	if err := e.MoveEntry(entry.ID, projects.ID); err != nil {
+		t.Fatalf("MoveEntry failed: %v", err)
+	}
+	got, _ := e.GetEntry(entry.ID)
+	if got.Collection != projects.ID || got.UpdatedAt != entry.UpdatedAt || len(got.Tags) != 1 {
+		t.Errorf("unexpected moved entry %+v", got)
+	}
+	if err := e.MoveEntry(entry.ID, uuid.New()); !errors.Is(err, ErrCollectionNotFound) {
+		t.Errorf("expected ErrCollectionNotFound, got %v", err)
+	}
+
+	count := func(filter ListFilter) int {
+		entries, err := e.ListEntries(filter)
+		if err != nil {
+			t.Fatalf("ListEntries failed: %v", err)
+		}
+		return len(entries)
+	}
+	noteType := core.Note
+	if n := count(ListFilter{Type: &noteType, Collection: &work.ID}); n != 0 {
+		t.Errorf("expected no entries directly in /work, got %d", n)
+	}
+	if n := count(ListFilter{Type: &noteType, Collection: &work.ID, Subcollections: true}); n != 1 {
+		t.Errorf("expected 1 entry below /work, got %d", n)
+	}
+	top := uuid.Nil
+	if n := count(ListFilter{Type: &noteType, Collection: &top}); n != 1 || loose.ID == uuid.Nil {
+		t.Errorf("expected 1 unfiled note, got %d", n)
+	}
+
+	// The tree stays a tree, and only empty collections are deleted
+	if _, err := e.MoveCollection(work.ID, projects.ID); !errors.Is(err, ErrCollectionCycle) {
+		t.Errorf("expected ErrCollectionCycle, got %v", err)
+	}
+	if err := e.DeleteCollection(projects.ID); !errors.Is(err, ErrCollectionNotEmpty) {
+		t.Errorf("expected ErrCollectionNotEmpty, got %v", err)
+	}
+	moved, err := e.MoveCollection(projects.ID, uuid.Nil)
+	if err != nil || moved.Path != "/projects" {
+		t.Errorf("MoveCollection = %+v, %v", moved, err)
+	}
+	renamed, err := e.RenameCollection(work.ID, "office")
+	if err != nil || renamed.Path != "/office" {
+		t.Errorf("RenameCollection = %+v, %v", renamed, err)
+	}
+	if err := e.DeleteCollection(work.ID); err != nil {
+		t.Errorf("DeleteCollection failed: %v", err)
+	}
+	if list, _ := e.ListCollections(); len(list) != 1 || list[0].ID != projects.ID {
+		t.Errorf("expected only /projects left, got %+v", list)
+	}
+}
+
+func TestCollectionCycles(t *testing.T) {
+	a, b := uuid.New(), uuid.New()
+	tree := &collectionTree{
+		byID: map[uuid.UUID]Collection{
+			a: {ID: a, Name: "a", Parent: b},
+			b: {ID: b, Name: "b", Parent: a},
+		},
+		order: []uuid.UUID{a, b},
+	}
+	// Concurrent moves of a into b and b into a: both end up at the top
+	tree.resolve()
+	if tree.byID[a].Path != "/a" || tree.byID[b].Path != "/b" {
+		t.Errorf("unexpected paths %q and %q", tree.byID[a].Path, tree.byID[b].Path)
+	}
+}
+
+func TestResolveID(t *testing.T) {
+	e, err := New(Config{InMemory: true, IDs: core.IDTime})
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+	defer e.Close()
+
+	first, _ := e.AddEntry(AddEntryInput{Type: core.Note, Content: []byte("one")})
+	second, _ := e.AddEntry(AddEntryInput{Type: core.Note, Content: []byte("two")})
+	if first.ID.Version() != 7 || first.ID.String() >= second.ID.String() {
+		t.Errorf("expected ordered UUIDv7s, got %s then %s", first.ID, second.ID)
+	}
+
+	full := second.ID.String()
+	if id, err := e.ResolveID(strings.ToUpper(full[:24])); err != nil || id != second.ID {
+		t.Errorf("ResolveID = %s, %v", id, err)
+	}
+	if id, err := e.ResolveID(full); err != nil || id != second.ID {
+		t.Errorf("expected a full ID to resolve to itself, got %s, %v", id, err)
+	}
+	// Created in the same second: their leading digits are shared
+	if _, err := e.ResolveID(full[:6]); !errors.Is(err, ErrAmbiguousID) {
+		t.Errorf("expected ErrAmbiguousID, got %v", err)
+	}
+	if _, err := e.ResolveID("ffffffff"); !errors.Is(err, ErrUnknownID) {
+		t.Errorf("expected ErrUnknownID, got %v", err)
+	}
+	if _, err := e.ResolveID("8f3"); err == nil {
+		t.Error("expected a prefix shorter than MinIDPrefix to fail")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	e := newTestEngine(t)
+
+	groceries, _ := e.AddEntry(AddEntryInput{Type: core.Note, Content: []byte("# Groceries\nmilk"), Tags: []string{"inbox"}})
+	e.AddEntry(AddEntryInput{Type: core.Note, Content: []byte("# Groceries for the party\nchips")})
+	e.AddEntry(AddEntryInput{Type: core.Note, Content: []byte("# Party plan")})
+
+	for _, ref := range []string{`title:"groceries"`, "title:GROCERIES", "Groceries", "tag:inbox", groceries.ID.String()[:8]} {
+		if id, err := e.Resolve(ref); err != nil || id != groceries.ID {
+			t.Errorf("Resolve(%s) = %s, %v", ref, id, err)
+		}
+	}
+
+	// Two titles contain "party" and neither is exactly it
+	_, err := e.Resolve("title:party")
+	if !errors.Is(err, ErrAmbiguousID) {
+		t.Fatalf("expected ErrAmbiguousID, got %v", err)
+	}
+	if !strings.Contains(err.Error(), `"Party plan"`) || !strings.Contains(err.Error(), `"Groceries for the party"`) {
+		t.Errorf("expected the candidates to be listed, got %v", err)
+	}
+
+	if _, err := e.Resolve("title:nothing"); !errors.Is(err, ErrUnknownID) {
+		t.Errorf("expected ErrUnknownID, got %v", err)
+	}
+	if _, err := e.Resolve("tag:missing"); !errors.Is(err, ErrUnknownID) {
+		t.Errorf("expected ErrUnknownID, got %v", err)
+	}
+}
+
+func TestTemplates(t *testing.T) {
+	e := newTestEngine(t)
+
+	tmpl, err := e.SaveTemplate(templates.Template{
+		Name:    "meeting",
+		Content: "# {{title}}\n{{date}}",
+		Tags:    []string{"meeting"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.SaveTemplate(templates.Template{Name: "bad", Type: "config"}); err == nil {
+		t.Error("expected a config template to be rejected")
+	}
+
+	entry, err := e.AddFromTemplate("meeting", map[string]string{"title": "Standup"}, []string{"team", "meeting"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# Standup\n" + time.Now().Format("2006-01-02")
+	if entry.Type != core.Note || string(entry.Content) != want || !slices.Equal(slices.Sorted(slices.Values(entry.Tags)), []string{"meeting", "team"}) {
+		t.Errorf("unexpected entry %s %q %q", entry.Type, entry.Content, entry.Tags)
+	}
+	if _, err := e.AddFromTemplate("meeting", nil, nil); !errors.Is(err, templates.ErrMissingVariable) {
+		t.Errorf("expected ErrMissingVariable, got %v", err)
+	}
+
+	// Saving again under the name replaces the template in place
+	saved, err := e.SaveTemplate(templates.Template{Name: "meeting", Type: "log", Content: "{{time}}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := e.ListTemplates()
+	if err != nil || len(list) != 1 || list[0].ID != tmpl.ID || saved.ID != tmpl.ID || list[0].Type != "log" {
+		t.Fatalf("expected the template to be replaced, got %+v, %v", list, err)
+	}
+
+	if err := e.DeleteTemplate("meeting"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.AddFromTemplate("meeting", nil, nil); !errors.Is(err, ErrTemplateNotFound) {
+		t.Errorf("expected ErrTemplateNotFound, got %v", err)
+	}
+}
+
+func TestStoredSchemas(t *testing.T) {
+	dir := t.TempDir()
+	e, err := New(Config{DataDir: dir, DisableSearch: true, BuiltinSchemas: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event := []byte(`{"type": "object", "required": ["title"], "properties": {"title": {"type": "string"}}}`)
+	if _, err := e.SaveSchema("event", []byte(`{"type": 3}`)); err == nil {
+		t.Error("expected an invalid schema to be rejected")
+	}
+	if _, err := e.SaveSchema("config", event); err == nil {
+		t.Error("expected a config schema to be rejected")
+	}
+	stored, err := e.SaveSchema("event", event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.AddEntry(AddEntryInput{Type: core.Event, Content: []byte(`{}`)}); !errors.Is(err, ErrSchemaValidation) {
+		t.Errorf("expected ErrSchemaValidation, got %v", err)
+	}
+	result, err := e.ValidateContent("event", []byte(`{"title": 1}`))
+	if err != nil || result.Valid || len(result.Errors) != 1 || result.Errors[0].Field != "title" {
+		t.Errorf("expected an error about the title field, got %+v, %v", result, err)
+	}
+	if _, err := e.ValidateContent("note", []byte(`{}`)); !errors.Is(err, ErrNoSchema) {
+		t.Errorf("expected ErrNoSchema, got %v", err)
+	}
+
+	// Saved schemas replace built-in ones, and are loaded when the vault
+	// is opened again
+	if _, err := e.SaveSchema("task", []byte(`{"type": "object", "required": ["done"]}`)); err != nil {
+		t.Fatal(err)
+	}
+	e.Close()
+	e, err = New(Config{DataDir: dir, DisableSearch: true, BuiltinSchemas: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	list, err := e.ListSchemas()
+	if err != nil || len(list) != 2 || list[0].Type != "event" || list[0].ID != stored.ID || list[1].Type != "task" {
+		t.Fatalf("expected the event and task schemas, got %+v, %v", list, err)
+	}
+	if result, _ := e.ValidateContent("task", []byte(`{"title": "x"}`)); result.Valid {
+		t.Error("expected the saved task schema")
+	}
+
+	if err := e.DeleteSchema("event"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.GetSchema("event"); !errors.Is(err, ErrSchemaNotFound) {
+		t.Errorf("expected ErrSchemaNotFound, got %v", err)
+	}
+	if _, err := e.AddEntry(AddEntryInput{Type: core.Event, Content: []byte(`{}`)}); err != nil {
+		t.Errorf("expected the event schema to be gone, got %v", err)
+	}
+	if err := e.DeleteSchema("task"); err != nil {
+		t.Fatal(err)
+	}
+	if result, _ := e.ValidateContent("task", []byte(`{"title": "x"}`)); !result.Valid {
+		t.Errorf("expected the built-in task schema to be restored, got %+v", result)
+	}
+}
+
+func TestTimeline(t *testing.T) {
+	e := newTestEngine(t)
+
+	start := time.Now().Add(-time.Second)
+	kept, _ := e.AddEntry(AddEntryInput{Type: core.Note, Content: []byte("# Kept")})
+	content := []byte("# Kept, edited")
+	if err := e.UpdateEntry(kept.ID, UpdateEntryInput{Content: &content}); err != nil {
+		t.Fatal(err)
+	}
+	gone, _ := e.AddEntry(AddEntryInput{Type: core.Task, Content: []byte(`{"title": "Gone"}`)})
+	if err := e.DeleteEntry(gone.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := e.Timeline(TimelineFilter{Since: start}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		action TimelineAction
+		id     uuid.UUID
+		title  string
+	}{
+		{TimelineDelete, gone.ID, "Gone"},
+		{TimelineCreate, gone.ID, "Gone"},
+		{TimelineUpdate, kept.ID, "Kept, edited"},
+		{TimelineCreate, kept.ID, "Kept"},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("expected %d events, got %+v", len(want), events)
+	}
+	for i, w := range want {
+		ev := events[i]
+		if ev.Action != w.action || ev.EntryID != w.id || ev.Title != w.title || ev.Author != e.(*engineImpl).localID {
+			t.Errorf("event %d: expected %s of %s %q, got %+v", i, w.action, w.id, w.title, ev)
+		}
+	}
+	if events[3].Version == 0 || events[0].Version != 0 {
+		t.Errorf("expected versions for the create only, got %d and %d", events[3].Version, events[0].Version)
+	}
+
+	note := core.Note
+	if events, _ := e.Timeline(TimelineFilter{Type: &note}, 1); len(events) != 1 || events[0].Action != TimelineUpdate {
+		t.Errorf("expected the latest note change, got %+v", events)
+	}
+	if events, _ := e.Timeline(TimelineFilter{Author: "other-device"}, 0); len(events) != 0 {
+		t.Errorf("expected no changes by another device, got %+v", events)
+	}
+	if events, _ := e.Timeline(TimelineFilter{Until: start}, 0); len(events) != 0 {
+		t.Errorf("expected no changes before the start, got %+v", events)
+	}
+}
+
+func TestChangesSince(t *testing.T) {
+	e := newTestEngine(t)
+
+	kept, _ := e.AddEntry(AddEntryInput{Type: core.Note, Content: []byte("kept"), Tags: []string{"a"}})
+	gone, _ := e.AddEntry(AddEntryInput{Type: core.Note, Content: []byte("gone")})
+
+	all, err := e.ChangesSince(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all.Entries) != 2 || all.Entries[0].ID != kept.ID || len(all.Deleted) != 0 {
+		t.Fatalf("expected both entries, oldest first, got %+v", all)
+	}
+	if all.Entries[0].Tags[0] != "a" || string(all.Entries[0].Content) != "kept" {
+		t.Errorf("expected tags and content, got %+v", all.Entries[0])
+	}
+
+	if changes, err := e.ChangesSince(all.Cursor); err != nil || len(changes.Entries)+len(changes.Deleted) != 0 || changes.Cursor != all.Cursor {
+		t.Fatalf("expected no changes after the cursor, got %+v, %v", changes, err)
+	}
+
+	if err := e.DeleteEntry(gone.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.ArchiveEntry(kept.ID); err != nil {
+		t.Fatal(err)
+	}
+	changes, err := e.ChangesSince(all.Cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes.Deleted) != 1 || changes.Deleted[0].ID != gone.ID || changes.Deleted[0].DeletedAt <= all.Cursor {
+		t.Errorf("expected the deletion, got %+v", changes.Deleted)
+	}
+	if len(changes.Entries) != 1 || !changes.Entries[0].Archived {
+		t.Errorf("expected the archived entry, got %+v", changes.Entries)
+	}
+	if changes.Cursor <= all.Cursor {
+		t.Errorf("expected the cursor to advance past %d, got %d", all.Cursor, changes.Cursor)
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	e := newTestEngine(t)
+
+	team, err := e.AddEntry(AddEntryInput{Type: core.Note, Content: []byte("team"), Namespace: "team-a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.AddEntry(AddEntryInput{Type: core.Note, Content: []byte("mine")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.AddEntry(AddEntryInput{Type: core.Note, Content: []byte("bad"), Namespace: "Team A"}); !errors.Is(err, ErrInvalidNamespace) {
+		t.Errorf("expected ErrInvalidNamespace, got %v", err)
+	}
+
+	got, err := e.GetEntry(team.ID)
+	if err != nil || got.Namespace != "team-a" {
+		t.Fatalf("expected the entry in team-a, got %+v, %v", got, err)
+	}
+	namespace := "team-a"
+	entries, err := e.ListEntries(ListFilter{Namespace: &namespace})
+	if err != nil || len(entries) != 1 || entries[0].ID != team.ID {
+		t.Errorf("expected only the team-a entry, got %+v, %v", entries, err)
+	}
+	namespace = ""
+	if n, err := e.Count(ListFilter{Namespace: &namespace}); err != nil || n != 1 {
+		t.Errorf("expected one entry in the default namespace, got %d, %v", n, err)
+	}
+
+	// Updates keep the namespace
+	content := []byte("team, edited")
+	if err := e.UpdateEntry(team.ID, UpdateEntryInput{Content: &content}); err != nil {
+		t.Fatal(err)
+	}
+	counts, err := e.Namespaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(counts) != 2 || counts["team-a"] != 1 || counts[""] != 1 {
+		t.Errorf("expected one entry per namespace, got %v", counts)
+	}
+}
+
+func TestPublishSyncEvent(t *testing.T) {
+	e := newTestEngine(t)
+
+	sub := e.Subscribe()
+	defer sub.Close()
+	finished := make(chan hooks.HookEvent, 1)
+	e.Hooks().On(hooks.EventSyncFinish, func(event hooks.HookEvent) {
+		finished <- event
+	})
+
+	// Bulk mode doesn't hold sync events back
+	err := e.Bulk(func(Batch) error {
+		return e.PublishSyncEvent(Event{Type: EventSyncFinished, PeerID: "peer1", Count: 3})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case event := <-sub.Events():
+		if event.Type != EventSyncFinished || event.PeerID != "peer1" || event.Count != 3 || event.Timestamp.IsZero() {
+			t.Errorf("unexpected event %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the sync event")
+	}
+	select {
+	case event := <-finished:
+		if event.PeerID != "peer1" || event.Changed != 3 {
+			t.Errorf("unexpected hook event %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the sync_finish hook")
+	}
+
+	if err := e.PublishSyncEvent(Event{Type: EventCreated}); !errors.Is(err, ErrNotSyncEvent) {
+		t.Errorf("expected ErrNotSyncEvent, got %v", err)
+	}
+}
+
+func TestSubscriptionOverflow(t *testing.T) {
+	publish := func(bus *EventBus, counts ...int) {
+		for _, n := range counts {
+			bus.Publish(Event{Type: EventCreated, Count: n})
+		}
+	}
+	received := func(sub Subscription) []int {
+		var counts []int
+		for {
+			select {
+			case event, ok := <-sub.Events():
+				if !ok {
+					return counts
+				}
+				counts = append(counts, event.Count)
+			default:
+				return counts
+			}
+		}
+	}
+
+	bus := NewEventBus()
+	newest := bus.SubscribeWithOptions(SubscriptionOptions{BufferSize: 2})
+	oldest := bus.SubscribeWithOptions(SubscriptionOptions{BufferSize: 2, Overflow: OverflowDropOldest})
+	closing := bus.SubscribeWithOptions(SubscriptionOptions{BufferSize: 2, Overflow: OverflowClose})
+	publish(bus, 1, 2, 3)
+
+	if got := received(newest); !slices.Equal(got, []int{1, 2}) || newest.Dropped() != 1 {
+		t.Errorf("drop-newest: expected 1 and 2 with 1 dropped, got %v with %d", got, newest.Dropped())
+	}
+	if got := received(oldest); !slices.Equal(got, []int{2, 3}) || oldest.Dropped() != 1 {
+		t.Errorf("drop-oldest: expected 2 and 3 with 1 dropped, got %v with %d", got, oldest.Dropped())
+	}
+	if got := received(closing); !slices.Equal(got, []int{1, 2}) || !errors.Is(closing.Err(), ErrSubscriptionOverflow) {
+		t.Errorf("close: expected 1 and 2 then ErrSubscriptionOverflow, got %v, %v", got, closing.Err())
+	}
+	publish(bus, 4) // Nothing more for the closed subscription
+	if bus.Dropped() != 3 || closing.Dropped() != 1 {
+		t.Errorf("expected 3 events dropped in all, got %d (%d closing)", bus.Dropped(), closing.Dropped())
+	}
+
+	// Blocking waits for the subscriber, then gives up
+	bus = NewEventBus()
+	blocking := bus.SubscribeWithOptions(SubscriptionOptions{BufferSize: 1, Overflow: OverflowBlock, BlockTimeout: 200 * time.Millisecond})
+	publish(bus, 1)
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		<-blocking.Events()
+	}()
+	publish(bus, 2)
+	if blocking.Dropped() != 0 {
+		t.Errorf("expected the publisher to wait for room, got %d dropped", blocking.Dropped())
+	}
+	start := time.Now()
+	publish(bus, 3)
+	if blocking.Dropped() != 1 || time.Since(start) < 200*time.Millisecond {
+		t.Errorf("expected the event dropped after the timeout, got %d dropped after %v", blocking.Dropped(), time.Since(start))
+	}
+	blocking.Close()
+
+	e := newTestEngine(t)
+	if _, err := e.SubscribeWithOptions(SubscriptionOptions{Overflow: "spill"}); err == nil {
+		t.Error("expected an unknown overflow policy to be rejected")
+	}
+}
@@ -1,12 +1,59 @@
 package engine
 
 import (
+	"errors"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// DefaultSubscriptionBuffer is the number of events a subscription
+// buffers without SubscriptionOptions.BufferSize
+const DefaultSubscriptionBuffer = 100
+
+// DefaultBlockTimeout is how long OverflowBlock waits for room without
+// SubscriptionOptions.BlockTimeout
+const DefaultBlockTimeout = time.Second
+
+// ErrSubscriptionOverflow is the Err of a subscription closed by
+// OverflowClose because its buffer was full
+var ErrSubscriptionOverflow = errors.New("subscription buffer overflowed")
+
+// OverflowPolicy is what a subscription does with an event when its buffer
+// is full, because the subscriber reads more slowly than changes happen.
+// Every event it does not deliver counts in Dropped.
+type OverflowPolicy string
+
+const (
+	// OverflowDropNewest drops the event (the default)
+	OverflowDropNewest OverflowPolicy = "drop-newest"
+
+	// OverflowDropOldest drops the oldest buffered event to make room, so
+	// the subscriber sees the latest changes
+	OverflowDropOldest OverflowPolicy = "drop-oldest"
+
+	// OverflowBlock makes the change that published the event wait up to
+	// BlockTimeout for room, then drops the event. Every subscriber and
+	// the writer wait meanwhile: use it for subscribers that keep up.
+	OverflowBlock OverflowPolicy = "block"
+
+	// OverflowClose closes the subscription, with Err returning
+	// ErrSubscriptionOverflow, so the subscriber knows to resynchronize
+	// (e.g. with ChangesSince) rather than miss changes unawares
+	OverflowClose OverflowPolicy = "close"
+)
+
+// valid reports whether p is a known policy ("" = OverflowDropNewest)
+func (p OverflowPolicy) valid() bool {
+	switch p {
+	case "", OverflowDropNewest, OverflowDropOldest, OverflowBlock, OverflowClose:
+		return true
+	}
+	return false
+}
+
 // EventType represents the type of change event
 type EventType string
 
@@ -15,14 +62,45 @@ const (
 	EventUpdated EventType = "updated"
 	EventDeleted EventType = "deleted"
 	EventSynced  EventType = "synced"
+
+	// EventArchived and EventUnarchived report changes to an entry's
+	// archive state, which leave its content and UpdatedAt alone
+	EventArchived   EventType = "archived"
+	EventUnarchived EventType = "unarchived"
+
+	// EventAppended reports a batch of log entries added by AppendLog,
+	// with their count, instead of an event per entry
+	EventAppended EventType = "appended"
+
+	// EventLocked and EventUnlocked report Lock and Unlock of the vault key
+	// (EntryID is nil)
+	EventLocked   EventType = "locked"
+	EventUnlocked EventType = "unlocked"
+
+	// Sync lifecycle events, published by the sync service through
+	// PublishSyncEvent (EntryID is nil, PeerID names the peer)
+	EventPeerConnected    EventType = "peer_connected"
+	EventPeerDisconnected EventType = "peer_disconnected"
+	EventSyncStarted      EventType = "sync_started"
+	EventSyncFinished     EventType = "sync_finished"
+	EventSyncFailed       EventType = "sync_failed"
 )
 
+// OriginRemote marks events for changes that arrived through sync
+const OriginRemote = "remote"
+
 // Event represents a change notification
 type Event struct {
 	Type      EventType `json:"type"`
 	EntryID   uuid.UUID `json:"entry_id"`
 	EntryType string    `json:"entry_type,omitempty"`
 	Timestamp time.Time `json:"timestamp"`
+	Origin    string    `json:"origin,omitempty"` // "remote" for merged changes, empty for local
+
+	Count int `json:"count,omitempty"` // Entries appended (EventAppended) or changed by a sync session (EventSyncFinished)
+
+	PeerID string `json:"peer_id,omitempty"` // For sync lifecycle events
+	Error  string `json:"error,omitempty"`   // For EventSyncFailed
 }
 
 // SubscriptionOptions configures a subscription
@@ -31,6 +109,18 @@ type SubscriptionOptions struct {
 	Events []EventType
 	// EntryType filters by entry type (empty = all types)
 	EntryType string
+	// EntryID filters by entry (uuid.Nil = all entries)
+	EntryID uuid.UUID
+
+	// BufferSize is the number of events buffered for the subscriber
+	// (0 = DefaultSubscriptionBuffer)
+	BufferSize int
+	// Overflow is what happens to events when the buffer is full
+	// ("" = OverflowDropNewest)
+	Overflow OverflowPolicy
+	// BlockTimeout bounds the wait of OverflowBlock (0 =
+	// DefaultBlockTimeout)
+	BlockTimeout time.Duration
 }
 
 // Subscription represents an active event subscription
@@ -39,6 +129,12 @@ type Subscription interface {
 	Events() <-chan Event
 	// Close stops the subscription and closes the channel
 	Close()
+	// Dropped returns how many matching events were not delivered because
+	// the buffer was full
+	Dropped() uint64
+	// Err returns ErrSubscriptionOverflow once OverflowClose closed the
+	// subscription, and nil otherwise
+	Err() error
 }
 
 // subscriptionImpl is the concrete implementation
@@ -47,12 +143,25 @@ type subscriptionImpl struct {
 	closed  bool
 	mu      sync.Mutex
 	filter  SubscriptionOptions
+	done    chan struct{} // Closed by Close, to end a blocked send
+	once    sync.Once
+	dropped atomic.Uint64
+	err     error
+	total   *atomic.Uint64 // The bus's count of dropped events
 }
 
-func newSubscription(bufferSize int, opts SubscriptionOptions) *subscriptionImpl {
+func newSubscription(opts SubscriptionOptions, total *atomic.Uint64) *subscriptionImpl {
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = DefaultSubscriptionBuffer
+	}
+	if opts.BlockTimeout <= 0 {
+		opts.BlockTimeout = DefaultBlockTimeout
+	}
 	return &subscriptionImpl{
-		ch:     make(chan Event, bufferSize),
+		ch:     make(chan Event, opts.BufferSize),
 		filter: opts,
+		done:   make(chan struct{}),
+		total:  total,
 	}
 }
 
@@ -61,6 +170,8 @@ func (s *subscriptionImpl) Events() <-chan Event {
 }
 
 func (s *subscriptionImpl) Close() {
+	// A send blocked with s.mu held gives up once done is closed
+	s.once.Do(func() { close(s.done) })
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if !s.closed {
@@ -69,6 +180,16 @@ func (s *subscriptionImpl) Close() {
 	}
 }
 
+func (s *subscriptionImpl) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+func (s *subscriptionImpl) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
 func (s *subscriptionImpl) matches(event Event) bool {
 	// Check event type filter
 	if len(s.filter.Events) > 0 {
@@ -88,6 +209,11 @@ func (s *subscriptionImpl) matches(event Event) bool {
 	if s.filter.EntryType != "" && event.EntryType != s.filter.EntryType {
 		return false
 	}
+
+	// Check entry filter
+	if s.filter.EntryID != uuid.Nil && event.EntryID != s.filter.EntryID {
+		return false
+	}
 	
 	return true
 }
@@ -95,19 +221,58 @@ func (s *subscriptionImpl) matches(event Event) bool {
 func (s *subscriptionImpl) send(event Event) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if !s.closed && s.matches(event) {
+	if s.closed || !s.matches(event) {
+		return
+	}
+	select {
+	case s.ch <- event:
+		return
+	default:
+	}
+
+	// Buffer full
+	switch s.filter.Overflow {
+	case OverflowDropOldest:
+		for {
+			select {
+			case s.ch <- event:
+				return
+			default:
+			}
+			select {
+			case <-s.ch:
+				s.drop()
+			default: // The subscriber made room meanwhile
+			}
+		}
+	case OverflowBlock:
+		timer := time.NewTimer(s.filter.BlockTimeout)
+		defer timer.Stop()
 		select {
 		case s.ch <- event:
-		default:
-			// Buffer full, drop event (non-blocking)
+			return
+		case <-timer.C:
+		case <-s.done:
 		}
+	case OverflowClose:
+		s.err = ErrSubscriptionOverflow
+		s.closed = true
+		close(s.ch)
 	}
+	s.drop()
+}
+
+// drop counts an event not delivered
+func (s *subscriptionImpl) drop() {
+	s.dropped.Add(1)
+	s.total.Add(1)
 }
 
 // EventBus manages subscriptions and broadcasts events
 type EventBus struct {
-	subs []*subscriptionImpl
-	mu   sync.RWMutex
+	subs    []*subscriptionImpl
+	mu      sync.RWMutex
+	dropped atomic.Uint64 // Events not delivered to any subscription
 }
 
 // NewEventBus creates a new event bus
@@ -120,15 +285,25 @@ func (b *EventBus) Subscribe() Subscription {
 	return b.SubscribeWithOptions(SubscriptionOptions{})
 }
 
-// SubscribeWithOptions creates a new subscription with filtering
+// SubscribeWithOptions creates a new subscription with filtering and an
+// overflow policy. Unknown policies are OverflowDropNewest.
 func (b *EventBus) SubscribeWithOptions(opts SubscriptionOptions) Subscription {
-	sub := newSubscription(100, opts) // Buffer 100 events
+	if !opts.Overflow.valid() {
+		opts.Overflow = OverflowDropNewest
+	}
+	sub := newSubscription(opts, &b.dropped)
 	b.mu.Lock()
 	b.subs = append(b.subs, sub)
 	b.mu.Unlock()
 	return sub
 }
 
+// Dropped returns how many events subscriptions have not delivered
+// because their buffer was full, since the bus was created
+func (b *EventBus) Dropped() uint64 {
+	return b.dropped.Load()
+}
+
 // Publish sends an event to all subscribers
 func (b *EventBus) Publish(event Event) {
 	b.mu.RLock()
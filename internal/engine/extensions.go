@@ -0,0 +1,137 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/amaydixit11/acorde/internal/core"
+)
+
+// Extension adds behavior to the engine: auto-tagging, content
+// transforms, external indexers. Extensions are registered with
+// Config.Extensions and called in that order, synchronously, on the
+// goroutine making the change. Embed BaseExtension to implement only the
+// hooks you need.
+type Extension interface {
+	// Name identifies the extension in errors
+	Name() string
+
+	// OnStart is called once the engine is open, before New returns.
+	// An error fails New.
+	OnStart(e Engine) error
+
+	// OnStop is called by Close, in reverse registration order, while
+	// the engine is still usable
+	OnStop() error
+
+	// BeforeAdd and BeforeUpdate may modify the input, which later
+	// extensions see modified. They run before schema validation and
+	// encryption, so content is plaintext. An error rejects the change.
+	BeforeAdd(input *AddEntryInput) error
+	BeforeUpdate(current Entry, input *UpdateEntryInput) error
+
+	// AfterMerge is called after changes received through sync have been
+	// persisted and published. Before hooks do not run for them: they were
+	// accepted on the device that made them. The engine may be used
+	// from AfterMerge.
+	AfterMerge(changes []MergeChange)
+}
+
+// BaseExtension implements every hook of Extension but Name as a no-op
+type BaseExtension struct{}
+
+func (BaseExtension) OnStart(Engine) error                        { return nil }
+func (BaseExtension) OnStop() error                               { return nil }
+func (BaseExtension) BeforeAdd(*AddEntryInput) error              { return nil }
+func (BaseExtension) BeforeUpdate(Entry, *UpdateEntryInput) error { return nil }
+func (BaseExtension) AfterMerge([]MergeChange)                    {}
+
+// MergeChange is an entry a merge created, updated or deleted. Content
+// is plaintext, or nil if this device cannot decrypt it.
+type MergeChange struct {
+	Type  EventType
+	Entry Entry
+}
+
+// ExtensionError is returned when an extension hook fails. Err is the
+// extension's error, which errors.Is and errors.As see through.
+type ExtensionError struct {
+	Extension string
+	Hook      string
+	Err       error
+}
+
+func (e *ExtensionError) Error() string {
+	return fmt.Sprintf("extension %s: %s: %v", e.Extension, e.Hook, e.Err)
+}
+
+func (e *ExtensionError) Unwrap() error {
+	return e.Err
+}
+
+// startExtensions calls OnStart in order. If one fails, those already
+// started are stopped.
+func (e *engineImpl) startExtensions() error {
+	for i, ext := range e.extensions {
+		if err := ext.OnStart(e); err != nil {
+			e.stopExtensions(e.extensions[:i])
+			return &ExtensionError{Extension: ext.Name(), Hook: "OnStart", Err: err}
+		}
+	}
+	return nil
+}
+
+// stopExtensions calls OnStop in reverse order and returns all failures
+func (e *engineImpl) stopExtensions(exts []Extension) error {
+	var errs []error
+	for i := len(exts) - 1; i >= 0; i-- {
+		if err := exts[i].OnStop(); err != nil {
+			errs = append(errs, &ExtensionError{Extension: exts[i].Name(), Hook: "OnStop", Err: err})
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// beforeAdd runs BeforeAdd hooks, stopping at the first error
+func (e *engineImpl) beforeAdd(input *AddEntryInput) error {
+	for _, ext := range e.extensions {
+		if err := ext.BeforeAdd(input); err != nil {
+			return &ExtensionError{Extension: ext.Name(), Hook: "BeforeAdd", Err: err}
+		}
+	}
+	return nil
+}
+
+// beforeUpdate runs BeforeUpdate hooks, stopping at the first error
+func (e *engineImpl) beforeUpdate(current core.Entry, input *UpdateEntryInput) error {
+	if len(e.extensions) == 0 {
+		return nil
+	}
+	entry := toInternalEntry(current)
+	entry.Content = e.plaintext(current)
+	for _, ext := range e.extensions {
+		if err := ext.BeforeUpdate(entry, input); err != nil {
+			return &ExtensionError{Extension: ext.Name(), Hook: "BeforeUpdate", Err: err}
+		}
+	}
+	return nil
+}
+
+// afterMerge runs AfterMerge hooks
+func (e *engineImpl) afterMerge(changes []mergeChange) {
+	if len(e.extensions) == 0 || len(changes) == 0 {
+		return
+	}
+	merged := make([]MergeChange, len(changes))
+	for i, change := range changes {
+		entry := toInternalEntry(change.entry)
+		entry.Content = nil
+		if !change.entry.Deleted {
+			entry.Content = e.plaintext(change.entry)
+		}
+		merged[i] = MergeChange{Type: change.eventType, Entry: entry}
+	}
+	for _, ext := range e.extensions {
+		ext.AfterMerge(merged)
+	}
+}
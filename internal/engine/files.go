@@ -0,0 +1,44 @@
+package engine
+
+import (
+	"errors"
+
+	"github.com/amaydixit11/acorde/internal/blob"
+)
+
+// ErrNoBlobStore is returned by StoreFile on in-memory vaults
+var ErrNoBlobStore = errors.New("vault has no blob store")
+
+// StoreFile stores data in the vault's blob store, with its MIME type and,
+// for images, a thumbnail (see blob.StoreFile). On encrypted vaults the
+// blobs are sealed with a key derived from the vault key for this file,
+// which the returned FileContent holds: add it as the content of a File
+// entry so the key is encrypted with the entry.
+func (e *engineImpl) StoreFile(name string, data []byte) (blob.FileContent, error) {
+	store := e.blobs
+	if store == nil {
+		if e.dataDir == "" {
+			return blob.FileContent{}, ErrNoBlobStore
+		}
+		var err error
+		if store, err = blob.NewStore(e.dataDir); err != nil { // Routing disabled
+			return blob.FileContent{}, err
+		}
+	}
+
+	e.keyMu.RLock()
+	key, locked := e.key, e.locked != nil
+	e.keyMu.RUnlock()
+
+	if locked {
+		return blob.FileContent{}, ErrLocked
+	}
+	if key == nil {
+		return blob.StoreFile(store.PutWithSubdir, name, data)
+	}
+	fileKey, err := blob.NewKey(*key)
+	if err != nil {
+		return blob.FileContent{}, err
+	}
+	return blob.StoreSealedFile(store.PutWithSubdir, name, data, fileKey)
+}
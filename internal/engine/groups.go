@@ -0,0 +1,229 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/amaydixit11/acorde/internal/acl"
+	"github.com/amaydixit11/acorde/internal/core"
+	"github.com/amaydixit11/acorde/internal/storage"
+	"github.com/google/uuid"
+)
+
+// ErrGroupNotFound is returned for a group the vault does not have
+var ErrGroupNotFound = errors.New("group not found")
+
+// ErrGroupExists is returned by CreateGroup for a name already taken
+var ErrGroupExists = errors.New("group already exists")
+
+// CreateGroup validates a group and stores it as a config entry, so that
+// it syncs to the vault's other devices
+func (e *engineImpl) CreateGroup(name string, members []string) (acl.Group, error) {
+	group := acl.Group{Name: name, Members: members}
+	if err := group.Validate(); err != nil {
+		return acl.Group{}, err
+	}
+	if _, err := e.GetGroup(name); err == nil {
+		return acl.Group{}, fmt.Errorf("%w: %s", ErrGroupExists, name)
+	}
+	content, err := acl.EncodeGroup(group)
+	if err != nil {
+		return acl.Group{}, err
+	}
+	entry, err := e.AddEntry(AddEntryInput{
+		Type:    core.Config,
+		Content: content,
+		Tags:    []string{acl.GroupTag},
+	})
+	if err != nil {
+		return acl.Group{}, err
+	}
+	group.ID = entry.ID
+	return group, nil
+}
+
+// ListGroups returns the vault's groups by name
+func (e *engineImpl) ListGroups() ([]acl.Group, error) {
+	groups, err := e.loadGroups()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]acl.Group, 0, len(groups))
+	for _, group := range groups {
+		list = append(list, cloneGroup(group))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// GetGroup returns a group by name
+func (e *engineImpl) GetGroup(name string) (acl.Group, error) {
+	groups, err := e.loadGroups()
+	if err != nil {
+		return acl.Group{}, err
+	}
+	group, ok := groups[name]
+	if !ok {
+		return acl.Group{}, fmt.Errorf("%w: %s", ErrGroupNotFound, name)
+	}
+	return cloneGroup(group), nil
+}
+
+// UpdateGroup adds and removes members of a group
+func (e *engineImpl) UpdateGroup(name string, add, remove []string) (acl.Group, error) {
+	group, err := e.GetGroup(name)
+	if err != nil {
+		return acl.Group{}, err
+	}
+	group.Members = slices.DeleteFunc(append(group.Members, add...), func(m string) bool {
+		return slices.Contains(remove, m)
+	})
+	if err := group.Validate(); err != nil {
+		return acl.Group{}, err
+	}
+	content, err := acl.EncodeGroup(group)
+	if err != nil {
+		return acl.Group{}, err
+	}
+	if err := e.UpdateEntry(group.ID, UpdateEntryInput{Content: &content}); err != nil {
+		return acl.Group{}, err
+	}
+	return group, nil
+}
+
+// DeleteGroup deletes a group's config entry. ACLs that refer to it grant
+// nobody access through it any more.
+func (e *engineImpl) DeleteGroup(name string) error {
+	group, err := e.GetGroup(name)
+	if err != nil {
+		return err
+	}
+	return e.DeleteEntry(group.ID)
+}
+
+// GrantGroup lets the members of a group read an entry, or read and
+// write it. Members are resolved when access is checked, so the grant
+// follows later changes to the group.
+func (e *engineImpl) GrantGroup(id uuid.UUID, name string, write bool) error {
+	if e.aclOff {
+		return ErrACLDisabled
+	}
+	if err := acl.ValidateGroupName(name); err != nil {
+		return err
+	}
+	return e.changeACL(id, func(entryACL *core.ACL) {
+		ref := acl.GroupRef(name)
+		list := &entryACL.Readers
+		if write {
+			list = &entryACL.Writers
+		}
+		if !slices.Contains(*list, ref) {
+			*list = append(*list, ref)
+		}
+	})
+}
+
+// RevokeGroup removes a group's access to an entry
+func (e *engineImpl) RevokeGroup(id uuid.UUID, name string) error {
+	if e.aclOff {
+		return ErrACLDisabled
+	}
+	ref := acl.GroupRef(name)
+	return e.changeACL(id, func(entryACL *core.ACL) {
+		isRef := func(s string) bool { return s == ref }
+		entryACL.Readers = slices.DeleteFunc(entryACL.Readers, isRef)
+		entryACL.Writers = slices.DeleteFunc(entryACL.Writers, isRef)
+	})
+}
+
+// changeACL applies change to an entry's ACL, which this device must
+// administer, and stores it in the replica (to sync) and the ACL store
+func (e *engineImpl) changeACL(id uuid.UUID, change func(*core.ACL)) error {
+	if allowed, _ := e.acls.CheckAdmin(id, e.localID); !allowed {
+		return fmt.Errorf("permission denied")
+	}
+	if _, err := e.replica.GetEntry(id); err != nil {
+		return convertCRDTError(err)
+	}
+
+	entryACL, ok := e.replica.GetACL(id)
+	if !ok {
+		entryACL = core.ACL{EntryID: id, Owner: e.localID}
+	}
+	entryACL = entryACL.Clone()
+	change(&entryACL)
+
+	entryACL.Timestamp = 0 // Assigned by the replica clock
+	e.replica.SetACL(entryACL)
+	entryACL, _ = e.replica.GetACL(id)
+	if err := e.acls.SetACL(entryACL); err != nil {
+		return fmt.Errorf("failed to store ACL: %w", err)
+	}
+	e.cache.invalidate(id)
+	return nil
+}
+
+// groupMembers resolves a group for ACL checks (see acl.GroupResolver)
+func (e *engineImpl) groupMembers(name string) []string {
+	groups, err := e.loadGroups()
+	if err != nil {
+		return nil
+	}
+	return groups[name].Members
+}
+
+// loadGroups returns the vault's groups by name, loading them from their
+// config entries when they changed since last loaded. Groups are read
+// from storage without ACL checks, which themselves resolve groups. If
+// devices created a group of the same name concurrently, the one created
+// first is used.
+func (e *engineImpl) loadGroups() (map[string]acl.Group, error) {
+	e.groupsMu.Lock()
+	defer e.groupsMu.Unlock()
+	if e.groups != nil {
+		return e.groups, nil
+	}
+
+	entryType, tag := core.Config, acl.GroupTag
+	entries, err := e.store.List(storage.ListFilter{
+		Type: &entryType, Tag: &tag, Archived: true,
+		Sort: storage.SortCreatedAt, Ascending: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list groups: %w", err)
+	}
+
+	groups := make(map[string]acl.Group)
+	for _, entry := range entries {
+		content, err := e.decrypt(entry.ID, entry.Content)
+		if err != nil {
+			return nil, err // Locked: try again once unlocked
+		}
+		group, err := acl.DecodeGroup(entry.ID, content)
+		if err != nil {
+			continue // Not a group this version can read
+		}
+		if _, taken := groups[group.Name]; !taken {
+			groups[group.Name] = group
+		}
+	}
+	e.groups = groups
+	return groups, nil
+}
+
+// groupsChanged drops the loaded groups after a change to a config entry
+func (e *engineImpl) groupsChanged(entryType string) {
+	if entryType != string(core.Config) && entryType != "" {
+		return
+	}
+	e.groupsMu.Lock()
+	e.groups = nil
+	e.groupsMu.Unlock()
+}
+
+func cloneGroup(group acl.Group) acl.Group {
+	group.Members = append([]string(nil), group.Members...)
+	return group
+}
@@ -0,0 +1,141 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/amaydixit11/acorde/internal/crdt"
+	"github.com/amaydixit11/acorde/internal/version"
+	"github.com/google/uuid"
+)
+
+// ErrVersionNotFound is returned for a version ID an entry doesn't have
+var ErrVersionNotFound = version.ErrNotFound
+
+// Version is a stored version of an entry
+type Version = version.Version
+
+// VersionDiff is the difference between two versions of an entry
+type VersionDiff = version.Diff
+
+// History returns up to limit versions of an entry (0 = all), newest
+// first, skipping the newest offset, with their content decrypted, and
+// how many versions are stored. Deleted entries keep their history.
+func (e *engineImpl) History(id uuid.UUID, limit, offset int) ([]Version, int, error) {
+	if err := e.checkHistory(id); err != nil {
+		return nil, 0, err
+	}
+	total, err := e.versions.GetVersionCount(id)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count versions: %w", err)
+	}
+	versions, err := e.versions.GetHistoryPage(id, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range versions {
+		if versions[i].Content, err = e.decrypt(id, versions[i].Content); err != nil {
+			return nil, 0, fmt.Errorf("decryption failed: %w", err)
+		}
+	}
+	return versions, total, nil
+}
+
+// GetVersion returns one version of an entry, its content decrypted
+func (e *engineImpl) GetVersion(id uuid.UUID, versionID int64) (Version, error) {
+	if err := e.checkHistory(id); err != nil {
+		return Version{}, err
+	}
+	return e.getVersion(id, versionID)
+}
+
+// DiffVersions compares two versions of an entry
+func (e *engineImpl) DiffVersions(id uuid.UUID, from, to int64) (VersionDiff, error) {
+	if err := e.checkHistory(id); err != nil {
+		return VersionDiff{}, err
+	}
+	old, err := e.getVersion(id, from)
+	if err != nil {
+		return VersionDiff{}, err
+	}
+	new, err := e.getVersion(id, to)
+	if err != nil {
+		return VersionDiff{}, err
+	}
+	return *version.ComputeDiff(&old, &new), nil
+}
+
+// RestoreVersion updates an entry to the content and tags of one of its
+// versions, saving a new version; history is kept.
+func (e *engineImpl) RestoreVersion(id uuid.UUID, versionID int64) (Entry, error) {
+	if err := e.checkHistory(id); err != nil {
+		return Entry{}, err
+	}
+	v, err := e.getVersion(id, versionID)
+	if err != nil {
+		return Entry{}, err
+	}
+	tags := v.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	if err := e.UpdateEntry(id, UpdateEntryInput{Content: &v.Content, Tags: &tags}); err != nil {
+		return Entry{}, err
+	}
+	return e.GetEntry(id)
+}
+
+// Editor is another device that changed an entry recently
+type Editor struct {
+	PeerID   string    `json:"peer_id"`
+	LastEdit time.Time `json:"last_edit"` // When it last changed the entry
+	Edits    int       `json:"edits"`     // Changes within the window
+}
+
+// RecentEditors returns the other devices whose changes to an entry were
+// made within window of now, most recent first, for UIs to warn of
+// concurrent edits. Times are those of the device that made the change,
+// to the second.
+func (e *engineImpl) RecentEditors(id uuid.UUID, window time.Duration) ([]Editor, error) {
+	if err := e.checkHistory(id); err != nil {
+		return nil, err
+	}
+	authors, err := e.versions.RecentAuthors(id, time.Now().Add(-window))
+	if err != nil {
+		return nil, err
+	}
+	editors := []Editor{}
+	for _, a := range authors {
+		if a.Author != e.localID {
+			editors = append(editors, Editor{PeerID: a.Author, LastEdit: a.LastEdit, Edits: a.Edits})
+		}
+	}
+	return editors, nil
+}
+
+// checkHistory checks that an entry exists, deleted or not, and that
+// this device may read it
+func (e *engineImpl) checkHistory(id uuid.UUID) error {
+	if !e.canRead(id) {
+		return fmt.Errorf("permission denied")
+	}
+	if _, ok := e.replica.GetEntryWithDeleted(id); !ok {
+		return convertCRDTError(&crdt.ErrEntryNotFound{ID: id})
+	}
+	return nil
+}
+
+func (e *engineImpl) getVersion(id uuid.UUID, versionID int64) (Version, error) {
+	v, err := e.versions.GetVersion(id, versionID)
+	if errors.Is(err, version.ErrNotFound) {
+		return Version{}, fmt.Errorf("%w: %d", ErrVersionNotFound, versionID)
+	}
+	if err != nil {
+		return Version{}, err
+	}
+	if v.Content, err = e.decrypt(id, v.Content); err != nil {
+		return Version{}, fmt.Errorf("decryption failed: %w", err)
+	}
+	return *v, nil
+}
@@ -0,0 +1,178 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/amaydixit11/acorde/internal/core"
+	"github.com/amaydixit11/acorde/internal/storage"
+	"github.com/google/uuid"
+)
+
+// MinIDPrefix is the shortest ID prefix ResolveID accepts
+const MinIDPrefix = 4
+
+// ErrAmbiguousID is returned by ResolveID and Resolve for a reference
+// matching several entries
+var ErrAmbiguousID = errors.New("ambiguous entry reference")
+
+// ErrUnknownID is returned by ResolveID and Resolve for a reference
+// matching no entry
+var ErrUnknownID = errors.New("no entry matches")
+
+// maxCandidates is how many matches an ambiguous reference's error lists
+const maxCandidates = 5
+
+// ResolveID returns the ID of the live entry whose ID starts with prefix,
+// such as "8f3a" (case-insensitive). A full ID is returned as is, whether
+// or not the vault has it.
+func (e *engineImpl) ResolveID(prefix string) (uuid.UUID, error) {
+	if id, err := uuid.Parse(prefix); err == nil {
+		return id, nil
+	}
+	prefix = strings.ToLower(prefix)
+	if len(prefix) < MinIDPrefix || strings.Trim(prefix, "0123456789abcdef-") != "" {
+		return uuid.Nil, fmt.Errorf("invalid ID %q: give a UUID or at least %d of its leading hex digits", prefix, MinIDPrefix)
+	}
+
+	ids, err := e.store.IDsWithPrefix(prefix, maxCandidates+1)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return e.pick(prefix, ids)
+}
+
+// Resolve returns the ID of the entry a reference names:
+//   - a full ID, returned as is
+//   - title:<text>, the live unarchived entry titled text, or else the one
+//     whose title contains it (case insensitive, quotes optional)
+//   - tag:<tag>, the one live entry tagged tag
+//   - an ID prefix as taken by ResolveID
+//   - any other text, which is not hex, as title:<text>
+//
+// A reference matching several entries fails with ErrAmbiguousID, listing
+// the candidates with their short IDs and titles.
+func (e *engineImpl) Resolve(ref string) (uuid.UUID, error) {
+	ref = strings.TrimSpace(ref)
+	if id, err := uuid.Parse(ref); err == nil {
+		return id, nil
+	}
+
+	kind, value, ok := strings.Cut(ref, ":")
+	switch {
+	case ok && kind == "title":
+		return e.resolveTitle(ref, unquote(value))
+	case ok && kind == "tag":
+		return e.resolveTag(ref, unquote(value))
+	case strings.Trim(strings.ToLower(ref), "0123456789abcdef-") == "":
+		return e.ResolveID(ref)
+	}
+	return e.resolveTitle(ref, unquote(ref))
+}
+
+// resolveTitle resolves a title reference, preferring exact titles to
+// titles containing text
+func (e *engineImpl) resolveTitle(ref, text string) (uuid.UUID, error) {
+	if text == "" {
+		return uuid.Nil, fmt.Errorf("invalid reference %q: empty title", ref)
+	}
+	exact, containing := e.titles.FindTitle(text)
+	docs := exact
+	if len(docs) == 0 {
+		docs = containing
+	}
+	ids := make([]uuid.UUID, len(docs))
+	for i, doc := range docs {
+		ids[i] = doc.ID
+	}
+	return e.pick(ref, ids)
+}
+
+// resolveTag resolves a tag reference
+func (e *engineImpl) resolveTag(ref, tag string) (uuid.UUID, error) {
+	if tag == "" {
+		return uuid.Nil, fmt.Errorf("invalid reference %q: empty tag", ref)
+	}
+	entries, err := e.store.List(storage.ListFilter{
+		Tag:      &tag,
+		Archived: true,
+		Limit:    maxCandidates + 1,
+	})
+	if err != nil {
+		return uuid.Nil, err
+	}
+	ids := make([]uuid.UUID, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Type != core.Config {
+			ids = append(ids, entry.ID)
+		}
+	}
+	return e.pick(ref, ids)
+}
+
+// pick returns the one ID a reference matched, or an error listing up to
+// maxCandidates of them
+func (e *engineImpl) pick(ref string, ids []uuid.UUID) (uuid.UUID, error) {
+	switch len(ids) {
+	case 0:
+		return uuid.Nil, fmt.Errorf("%w %q", ErrUnknownID, ref)
+	case 1:
+		return ids[0], nil
+	}
+
+	more := len(ids) > maxCandidates
+	if more {
+		ids = ids[:maxCandidates]
+	}
+	width := shortWidth(ids)
+	lines := make([]string, 0, len(ids)+1)
+	for _, id := range ids {
+		lines = append(lines, "  "+e.describe(id, width))
+	}
+	if more {
+		lines = append(lines, "  ...")
+	}
+	return uuid.Nil, fmt.Errorf("%w %q; it matches:\n%s", ErrAmbiguousID, ref, strings.Join(lines, "\n"))
+}
+
+// shortWidth returns how many leading characters, at least 8, tell the
+// given IDs apart
+func shortWidth(ids []uuid.UUID) int {
+	width := 8
+	for i := range ids {
+		a := ids[i].String()
+		for _, id := range ids[i+1:] {
+			b := id.String()
+			n := 0
+			for n < len(a) && a[n] == b[n] {
+				n++
+			}
+			width = max(width, min(n+1, len(a)))
+		}
+	}
+	return width
+}
+
+// describe summarizes an entry for a disambiguation list: its first width
+// ID characters, type and title
+func (e *engineImpl) describe(id uuid.UUID, width int) string {
+	short := id.String()[:width]
+	doc, ok := e.titles.Get(id)
+	if !ok {
+		return short
+	}
+	if doc.Title == "" {
+		return fmt.Sprintf("%s  %s", short, doc.Type)
+	}
+	return fmt.Sprintf("%s  %s  %q", short, doc.Type, doc.Title)
+}
+
+// unquote strips one pair of matching quotes around s
+func unquote(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		s = s[1 : len(s)-1]
+	}
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,255 @@
+package engine
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/amaydixit11/acorde/pkg/crypto"
+	"github.com/google/uuid"
+)
+
+// ErrNotEncrypted is returned by key rotation on vaults without a key
+var ErrNotEncrypted = errors.New("vault is not encrypted")
+
+// encrypt seals content for an entry (AAD = entry ID) with its entry key
+// if the entry is shared, else with the current vault key. Content is
+// returned unchanged when encryption is disabled.
+func (e *engineImpl) encrypt(id uuid.UUID, content []byte) ([]byte, error) {
+	aad := []byte(id.String())
+	if entryKey, shared, err := e.sharedEntryKey(id); shared {
+		if err != nil {
+			return nil, err
+		}
+		return e.cipher.Encrypt(entryKey, content, aad)
+	}
+	return e.encryptWithVaultKey(id, content)
+}
+
+// encryptWithVaultKey seals content with the current vault key, whether
+// or not the entry is shared
+func (e *engineImpl) encryptWithVaultKey(id uuid.UUID, content []byte) ([]byte, error) {
+	return e.sealWithVaultKey(content, []byte(id.String()))
+}
+
+// epochMagic starts data sealed with a vault key: it is followed by the
+// key's epoch (big-endian uint32), then the ciphertext. Data sealed
+// before epochs were recorded starts with its nonce instead.
+var epochMagic = []byte{0xac, 0xe0}
+
+// epochHeaderSize is the size of epochMagic and the epoch
+const epochHeaderSize = 6
+
+// sealWithVaultKey encrypts data with the current vault key, naming its
+// epoch, which aad then covers too. Data is returned unchanged when
+// encryption is disabled.
+func (e *engineImpl) sealWithVaultKey(data, aad []byte) ([]byte, error) {
+	e.keyMu.RLock()
+	key, epoch, locked := e.key, e.epoch, e.locked != nil
+	e.keyMu.RUnlock()
+
+	if locked {
+		return nil, ErrLocked
+	}
+	if key == nil {
+		return data, nil
+	}
+	header := binary.BigEndian.AppendUint32(slices.Clone(epochMagic), epoch)
+	sealed, err := e.cipher.Encrypt(*key, data, slices.Concat(aad, header))
+	if err != nil {
+		return nil, err
+	}
+	return append(header, sealed...), nil
+}
+
+// decrypt opens entry content with the entry key of a shared entry or the
+// current vault key, falling back to keys retired by rotation for content
+// written before a peer received the new key
+func (e *engineImpl) decrypt(id uuid.UUID, content []byte) ([]byte, error) {
+	plaintext, _, err := e.decryptWithKeyring(id, content)
+	return plaintext, err
+}
+
+// decryptWithKeyring is decrypt that also reports whether the content is
+// sealed with the current key
+func (e *engineImpl) decryptWithKeyring(id uuid.UUID, content []byte) ([]byte, bool, error) {
+	if len(content) == 0 {
+		return content, true, nil
+	}
+
+	aad := []byte(id.String())
+	var shareErr error
+	if entryKey, shared, err := e.sharedEntryKey(id); shared {
+		if err == nil {
+			if plaintext, derr := e.cipher.Decrypt(entryKey, content, aad); derr == nil {
+				return plaintext, true, nil
+			}
+		} else if !e.encrypted() {
+			return nil, false, err
+		}
+		shareErr = err
+	}
+
+	// Versions from before an entry was shared use the vault key
+	plaintext, current, err := e.openWithVaultKeys(content, aad)
+	if err != nil && shareErr != nil {
+		return nil, false, shareErr
+	}
+	return plaintext, current, err
+}
+
+// openWithVaultKeys decrypts data sealed by sealWithVaultKey with the
+// vault key of the epoch it names, and reports whether that is the
+// current key. Data from before epochs were recorded is tried with the
+// current key, then retired keys newest first; so is data that only looks
+// like it names one (a nonce starts with epochMagic once in 65536). Data
+// is returned unchanged when encryption is disabled.
+func (e *engineImpl) openWithVaultKeys(data, aad []byte) ([]byte, bool, error) {
+	e.keyMu.RLock()
+	key, epoch, locked := e.key, e.epoch, e.locked != nil
+	retired := e.retired
+	e.keyMu.RUnlock()
+
+	if locked {
+		return nil, false, ErrLocked
+	}
+	if key == nil {
+		return data, true, nil
+	}
+
+	var epochErr error
+	if len(data) > epochHeaderSize && bytes.HasPrefix(data, epochMagic) {
+		header := data[:epochHeaderSize]
+		sealedWith := binary.BigEndian.Uint32(header[len(epochMagic):])
+		k := *key
+		if sealedWith != epoch {
+			k, epochErr = crypto.KeyForEpoch(retired, sealedWith)
+		}
+		if epochErr == nil {
+			plaintext, err := e.cipher.Decrypt(k, data[epochHeaderSize:], slices.Concat(aad, header))
+			if err == nil {
+				return plaintext, sealedWith == epoch, nil
+			}
+			epochErr = err
+		}
+	}
+
+	plaintext, err := e.cipher.Decrypt(*key, data, aad)
+	if err == nil {
+		return plaintext, true, nil
+	}
+	for i := len(retired) - 1; i >= 0; i-- {
+		if plaintext, rerr := e.cipher.Decrypt(retired[i].Key, data, aad); rerr == nil {
+			return plaintext, false, nil
+		}
+	}
+	return nil, false, cmp.Or(epochErr, err)
+}
+
+// encrypted reports whether the vault has a key, locked or not
+func (e *engineImpl) encrypted() bool {
+	e.keyMu.RLock()
+	defer e.keyMu.RUnlock()
+	return e.key != nil || e.locked != nil
+}
+
+// RotateKey replaces the vault key and re-encrypts every entry and all
+// version history with it. The new key starts the next epoch, or, rotating
+// back to a retired key, its own. The re-encrypted entries sync as
+// updates, so peers need the new key (see AdoptKey) to read them. The old
+// key is kept in memory to read content peers wrote before they received
+// the new key.
+func (e *engineImpl) RotateKey(newKey crypto.Key) error {
+	if err := e.setKey(crypto.EpochKey{Key: newKey}); err != nil {
+		return err
+	}
+	return e.reencrypt(true)
+}
+
+// AdoptKey switches to a key rotated on another device, at the epoch it
+// has there (0, from devices that do not send epochs, means the next
+// one). Entries are re-encrypted only where they are still readable solely
+// with a retired key (e.g. local edits made before the rotation arrived).
+func (e *engineImpl) AdoptKey(newKey crypto.EpochKey) error {
+	if err := e.setKey(newKey); err != nil {
+		return err
+	}
+	return e.reencrypt(false)
+}
+
+// setKey makes newKey current and retires the previous key
+func (e *engineImpl) setKey(newKey crypto.EpochKey) error {
+	e.keyMu.Lock()
+	defer e.keyMu.Unlock()
+
+	if e.locked != nil {
+		return ErrLocked
+	}
+	if e.key == nil {
+		return ErrNotEncrypted
+	}
+	if *e.key == newKey.Key {
+		return nil
+	}
+
+	epoch := cmp.Or(newKey.Epoch, e.epoch+1)
+	retired := make([]crypto.EpochKey, 0, len(e.retired)+1)
+	for _, k := range e.retired {
+		if k.Key == newKey.Key {
+			if newKey.Epoch == 0 {
+				epoch = k.Epoch // Rotated back
+			}
+			continue
+		}
+		retired = append(retired, k)
+	}
+	e.retired = append(retired, crypto.EpochKey{Epoch: e.epoch, Key: *e.key})
+	e.key, e.epoch = &newKey.Key, epoch
+	e.cache.purge()
+	return nil
+}
+
+// reencrypt re-encrypts live entries, version history and sealed entry
+// keys with the current key. With all=false only content that needs a
+// retired key is rewritten. Entries no known key can open are left
+// untouched.
+func (e *engineImpl) reencrypt(all bool) error {
+	for _, entry := range e.replica.ListEntries() {
+		plaintext, current, err := e.decryptWithKeyring(entry.ID, entry.Content)
+		if err != nil || (current && !all) || len(entry.Content) == 0 {
+			continue
+		}
+
+		content, err := e.encrypt(entry.ID, plaintext)
+		if err != nil {
+			return fmt.Errorf("failed to re-encrypt entry %s: %w", entry.ID, err)
+		}
+		tags := entry.Tags
+		if err := e.replica.UpdateEntry(entry.ID, &content, &tags); err != nil {
+			return convertCRDTError(err)
+		}
+		updated, _ := e.replica.GetEntry(entry.ID)
+		if err := e.store.Put(updated); err != nil {
+			return fmt.Errorf("failed to store re-encrypted entry: %w", err)
+		}
+	}
+
+	if err := e.resealEntryKeys(); err != nil {
+		return err
+	}
+
+	_, err := e.versions.RewriteContent(func(id uuid.UUID, content []byte) ([]byte, error) {
+		plaintext, current, err := e.decryptWithKeyring(id, content)
+		if err != nil {
+			return nil, err
+		}
+		if current && !all {
+			return content, nil
+		}
+		return e.encrypt(id, plaintext)
+	})
+	return err
+}
@@ -0,0 +1,31 @@
+package engine
+
+import (
+	"github.com/amaydixit11/acorde/internal/core"
+	"github.com/amaydixit11/acorde/internal/crdt"
+	"github.com/amaydixit11/acorde/internal/storage"
+	"github.com/google/uuid"
+)
+
+// storageLoader loads entries into a lazy replica from storage
+func storageLoader(store storage.Store) crdt.Loader {
+	return crdt.Loader{
+		Entry: func(id uuid.UUID) (core.Entry, bool) {
+			entry, err := store.Get(id)
+			return entry, err == nil
+		},
+		All: func() ([]core.Entry, error) {
+			return store.List(storage.ListFilter{Deleted: true, Archived: true})
+		},
+	}
+}
+
+// liveEntries lists live entries, archived ones included. Until a lazy
+// replica is hydrated they are read from storage, so indexing and
+// backfills do not load the whole vault into memory.
+func (e *engineImpl) liveEntries() ([]core.Entry, error) {
+	if e.replica.Hydrated() {
+		return e.replica.ListEntries(), nil
+	}
+	return e.store.List(storage.ListFilter{Archived: true})
+}
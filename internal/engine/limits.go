@@ -0,0 +1,84 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// Default entry limits (see Config)
+const (
+	DefaultMaxContentSize  = 16 << 20 // 16 MiB
+	DefaultMaxTagsPerEntry = 256
+	DefaultMaxTagLength    = 256 // Characters
+)
+
+// ErrLimitExceeded is returned, wrapped in a *LimitError, when an entry
+// exceeds a size limit
+var ErrLimitExceeded = errors.New("entry limit exceeded")
+
+// LimitError reports which limit an entry exceeded
+type LimitError struct {
+	Limit string // "content size", "tag count" or "tag length"
+	Max   int
+	Got   int
+	Tag   string // The offending tag, for tag length
+}
+
+func (e *LimitError) Error() string {
+	if e.Tag != "" {
+		return fmt.Sprintf("%v: %s %d exceeds %d (tag %.32q)", ErrLimitExceeded, e.Limit, e.Got, e.Max, e.Tag)
+	}
+	return fmt.Sprintf("%v: %s %d exceeds %d", ErrLimitExceeded, e.Limit, e.Got, e.Max)
+}
+
+func (e *LimitError) Unwrap() error {
+	return ErrLimitExceeded
+}
+
+// entryLimits bounds entry content and tags (0 = unlimited)
+type entryLimits struct {
+	contentSize int
+	tags        int
+	tagLength   int
+}
+
+func newEntryLimits(cfg Config) entryLimits {
+	limit := func(n, def int) int {
+		switch {
+		case n == 0:
+			return def
+		case n < 0:
+			return 0
+		}
+		return n
+	}
+	return entryLimits{
+		contentSize: limit(cfg.MaxContentSize, DefaultMaxContentSize),
+		tags:        limit(cfg.MaxTagsPerEntry, DefaultMaxTagsPerEntry),
+		tagLength:   limit(cfg.MaxTagLength, DefaultMaxTagLength),
+	}
+}
+
+// checkContent checks plaintext content against the size limit
+func (l entryLimits) checkContent(content []byte) error {
+	if l.contentSize > 0 && len(content) > l.contentSize {
+		return &LimitError{Limit: "content size", Max: l.contentSize, Got: len(content)}
+	}
+	return nil
+}
+
+// checkTags checks tags against the count and length limits
+func (l entryLimits) checkTags(tags []string) error {
+	if l.tags > 0 && len(tags) > l.tags {
+		return &LimitError{Limit: "tag count", Max: l.tags, Got: len(tags)}
+	}
+	if l.tagLength > 0 {
+		for _, tag := range tags {
+			if n := utf8.RuneCountInString(tag); n > l.tagLength {
+				return &LimitError{Limit: "tag length", Max: l.tagLength, Got: n, Tag: tag}
+			}
+		}
+	}
+	return nil
+}
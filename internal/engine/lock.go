@@ -0,0 +1,214 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/amaydixit11/acorde/internal/hooks"
+	"github.com/amaydixit11/acorde/pkg/crypto"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrLocked is returned by reads and writes of encrypted content while
+	// the vault is locked
+	ErrLocked = errors.New("vault is locked")
+
+	// ErrWrongKey is returned by Unlock for a key that is not the vault's
+	ErrWrongKey = errors.New("key does not match the vault")
+)
+
+// EncryptionStatus describes the encryption of a vault
+type EncryptionStatus struct {
+	Enabled     bool   `json:"enabled"`
+	Locked      bool   `json:"locked"`
+	Cipher      string `json:"cipher,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"`  // crypto.Key.Fingerprint of the vault key
+	Epoch       uint32 `json:"epoch,omitempty"`        // Epoch of the vault key
+	RetiredKeys int    `json:"retired_keys,omitempty"` // Keys kept from rotations, while unlocked
+}
+
+// lockState is what a locked engine keeps of its keys: enough to check
+// the key given to Unlock and to restore the retired keys
+type lockState struct {
+	fingerprint string
+	epochs      []uint32 // Of the retired keys
+	sealed      []byte   // Retired keys, encrypted with the vault key
+}
+
+// retiredAAD binds sealed retired keys to their purpose
+var retiredAAD = []byte("acorde retired keys")
+
+// Lock wipes the vault key, the keys retired by rotation and decrypted
+// content (the entry cache, shared entry keys and the search indexes) from
+// memory. Until Unlock, reading or writing encrypted content and Search
+// fail with ErrLocked, QuickOpen finds nothing, and sync keeps merging
+// ciphertext. Locking a locked vault is a no-op.
+func (e *engineImpl) Lock() error {
+	e.keyMu.Lock()
+	if e.locked != nil {
+		e.keyMu.Unlock()
+		return nil
+	}
+	if e.key == nil {
+		e.keyMu.Unlock()
+		return ErrNotEncrypted
+	}
+
+	retired := make([]byte, 0, len(e.retired)*crypto.KeySize)
+	epochs := make([]uint32, len(e.retired))
+	for i, k := range e.retired {
+		retired = append(retired, k.Key[:]...)
+		epochs[i] = k.Epoch
+	}
+	sealed, err := e.cipher.Encrypt(*e.key, retired, retiredAAD)
+	clear(retired)
+	if err != nil {
+		e.keyMu.Unlock()
+		return err
+	}
+
+	e.locked = &lockState{
+		fingerprint: e.key.Fingerprint(),
+		epochs:      epochs,
+		sealed:      sealed,
+	}
+	e.key.Wipe()
+	e.key = nil
+	for i := range e.retired {
+		e.retired[i].Key.Wipe()
+	}
+	e.retired = nil
+	e.keyMu.Unlock()
+
+	e.cache.purge()
+	e.shareMu.Lock()
+	clear(e.entryKeys)
+	e.shareMu.Unlock()
+	if err := e.dropIndexes(); err != nil {
+		return err
+	}
+
+	e.notify(context.Background(), Event{Type: EventLocked, Timestamp: time.Now()}, hooks.NewLockEvent(true))
+	return nil
+}
+
+// Unlock restores the vault key after Lock and rebuilds the search
+// indexes. It fails with ErrWrongKey for any other key. Unlocking an
+// unlocked vault with its key is a no-op.
+func (e *engineImpl) Unlock(key crypto.Key) error {
+	e.keyMu.Lock()
+	if e.locked == nil {
+		defer e.keyMu.Unlock()
+		if e.key == nil {
+			return ErrNotEncrypted
+		}
+		if *e.key != key {
+			return ErrWrongKey
+		}
+		return nil
+	}
+	if key.Fingerprint() != e.locked.fingerprint {
+		e.keyMu.Unlock()
+		return ErrWrongKey
+	}
+	opened, err := e.cipher.Decrypt(key, e.locked.sealed, retiredAAD)
+	if err != nil || len(opened) != len(e.locked.epochs)*crypto.KeySize {
+		e.keyMu.Unlock()
+		return ErrWrongKey
+	}
+
+	e.retired = make([]crypto.EpochKey, len(e.locked.epochs))
+	for i, epoch := range e.locked.epochs {
+		e.retired[i].Epoch = epoch
+		copy(e.retired[i].Key[:], opened[i*crypto.KeySize:])
+	}
+	clear(opened)
+	e.key = &key
+	e.locked = nil
+	e.keyMu.Unlock()
+
+	if err := e.rebuildIndexes(); err != nil {
+		return err
+	}
+
+	e.notify(context.Background(), Event{Type: EventUnlocked, Timestamp: time.Now()}, hooks.NewLockEvent(false))
+	return nil
+}
+
+// EncryptionStatus reports whether the vault is encrypted and locked, and
+// which key it uses
+func (e *engineImpl) EncryptionStatus() EncryptionStatus {
+	e.keyMu.RLock()
+	defer e.keyMu.RUnlock()
+
+	switch {
+	case e.locked != nil:
+		return EncryptionStatus{
+			Enabled:     true,
+			Locked:      true,
+			Cipher:      e.cipher.Name(),
+			Fingerprint: e.locked.fingerprint,
+			Epoch:       e.epoch,
+		}
+	case e.key != nil:
+		return EncryptionStatus{
+			Enabled:     true,
+			Cipher:      e.cipher.Name(),
+			Fingerprint: e.key.Fingerprint(),
+			Epoch:       e.epoch,
+			RetiredKeys: len(e.retired),
+		}
+	}
+	return EncryptionStatus{}
+}
+
+// isLocked reports whether Lock has the key out of memory
+func (e *engineImpl) isLocked() bool {
+	e.keyMu.RLock()
+	defer e.keyMu.RUnlock()
+	return e.locked != nil
+}
+
+// dropIndexes removes every entry from the search and title indexes,
+// which hold plaintext
+func (e *engineImpl) dropIndexes() error {
+	ids, err := e.liveIDs()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		e.titles.Remove(id)
+	}
+	if e.index == nil {
+		return nil
+	}
+	if err := e.index.IndexBatch(nil, ids); err != nil {
+		return fmt.Errorf("failed to clear search index: %w", err)
+	}
+	return nil
+}
+
+// rebuildIndexes indexes every entry again after Unlock
+func (e *engineImpl) rebuildIndexes() error {
+	ids, err := e.liveIDs()
+	if err != nil {
+		return err
+	}
+	return e.updateIndex(ids)
+}
+
+// liveIDs lists the IDs of the live entries
+func (e *engineImpl) liveIDs() ([]uuid.UUID, error) {
+	entries, err := e.liveEntries()
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uuid.UUID, len(entries))
+	for i, entry := range entries {
+		ids[i] = entry.ID
+	}
+	return ids, nil
+}
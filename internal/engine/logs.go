@@ -0,0 +1,113 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/amaydixit11/acorde/internal/core"
+	"github.com/amaydixit11/acorde/internal/rules"
+	"github.com/amaydixit11/acorde/internal/storage"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// LogRecord is a log entry to append with AppendLog
+type LogRecord struct {
+	Content []byte
+	Tags    []string
+}
+
+// AppendLog adds a batch of log entries on a write path for high-volume
+// streams such as metrics and telemetry. Extensions, rules, limits and
+// schemas apply as for AddEntry, and every record is checked before any
+// is written, so a batch is added whole or not at all. Unlike AddEntry,
+// appended entries get no version history and no ACL row (entries without
+// one are readable by every device of the vault), storage writes are one
+// transaction, and the batch produces a single EventAppended event with
+// its count instead of an event and a webhook per entry. Oversized
+// content is rejected rather than moved to the blob store.
+func (e *engineImpl) AppendLog(records []LogRecord) ([]uuid.UUID, error) {
+	ctx, span := e.startSpan("acorde.AppendLog", attribute.Int("acorde.records", len(records)))
+	ids, err := e.appendLog(ctx, records)
+	endSpan(span, err)
+	return ids, err
+}
+
+func (e *engineImpl) appendLog(ctx context.Context, records []LogRecord) ([]uuid.UUID, error) {
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	ruleList, _ := e.ListRules() // Rules that cannot be loaded are skipped
+	inputs := make([]AddEntryInput, len(records))
+	for i, record := range records {
+		input := AddEntryInput{Type: core.Log, Content: record.Content, Tags: record.Tags}
+		if err := e.beforeAdd(&input); err != nil {
+			return nil, fmt.Errorf("log record %d: %w", i, err)
+		}
+		if input.Type != core.Log {
+			return nil, fmt.Errorf("log record %d: extension changed its type to %s", i, input.Type)
+		}
+		if len(ruleList) > 0 {
+			input.Content, input.Tags, _ = rules.Apply(ruleList, string(core.Log), input.Content, input.Tags)
+		}
+		if err := e.limits.checkContent(input.Content); err != nil {
+			return nil, fmt.Errorf("log record %d: %w", i, err)
+		}
+		if err := e.limits.checkTags(input.Tags); err != nil {
+			return nil, fmt.Errorf("log record %d: %w", i, err)
+		}
+		if err := e.validateNew(core.Log, input.Content); err != nil {
+			return nil, fmt.Errorf("log record %d: %w", i, err)
+		}
+		inputs[i] = input
+	}
+
+	ids := make([]uuid.UUID, len(inputs))
+	contents := make([][]byte, len(inputs))
+	for i, input := range inputs {
+		ids[i] = e.newID()
+		content, err := e.encrypt(ids[i], input.Content)
+		if err != nil {
+			return nil, fmt.Errorf("encryption failed: %w", err)
+		}
+		contents[i] = content
+	}
+
+	ops := make([]storage.Operation, len(inputs))
+	for i, input := range inputs {
+		entry := e.replica.AddEntryVersioned(ids[i], core.Log, contents[i], input.Tags, 0, e.schemas.Version(string(core.Log)))
+		ops[i] = storage.Operation{Type: storage.OpPut, Entry: entry}
+	}
+	if err := e.storeFor(ctx).ApplyBatch(ops); err != nil {
+		return nil, fmt.Errorf("failed to store log entries: %w", err)
+	}
+
+	e.reindex(ctx, ids...)
+	e.notifyAppended(ctx, len(ids))
+	return ids, nil
+}
+
+// notifyAppended publishes one EventAppended for a batch of log entries.
+// In a bulk operation, batches add up to a single event.
+func (e *engineImpl) notifyAppended(ctx context.Context, count int) {
+	event := Event{
+		Type:      EventAppended,
+		EntryType: string(core.Log),
+		Count:     count,
+		Timestamp: time.Now(),
+	}
+
+	state := bulkFrom(ctx)
+	if state == nil {
+		e.events.Publish(event)
+		return
+	}
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	if prev, ok := state.global[EventAppended]; ok {
+		event.Count += prev.event.Count
+	}
+	state.global[EventAppended] = notification{event: event}
+}
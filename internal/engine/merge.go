@@ -0,0 +1,351 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/amaydixit11/acorde/internal/core"
+	"github.com/amaydixit11/acorde/internal/crdt"
+	"github.com/amaydixit11/acorde/internal/hooks"
+	"github.com/amaydixit11/acorde/internal/storage"
+	"github.com/amaydixit11/acorde/internal/version"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// entrySnapshot captures the parts of an entry that a merge can change
+type entrySnapshot struct {
+	updatedAt  uint64
+	deleted    bool
+	content    string
+	tags       string
+	archived   bool
+	archivedAt uint64
+
+	collection   uuid.UUID
+	collectionAt uint64
+
+	// A concurrent version of equal timestamp and content can win the
+	// tie-break: stored, but no change to report
+	author      string
+	updatedTime int64
+}
+
+// mergeChange is a single entry changed by a merge
+type mergeChange struct {
+	eventType EventType
+	entry     core.Entry
+}
+
+// stateIDs returns the IDs of the entries and tag sets in remote state,
+// the only entries merging it can change
+func stateIDs(state crdt.ReplicaState) []uuid.UUID {
+	ids := make([]uuid.UUID, 0, len(state.Entries)+len(state.Tags))
+	for _, elem := range state.Entries {
+		ids = append(ids, elem.Entry.ID)
+	}
+	for id := range state.Tags {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// snapshotEntries records the current state of the given entries
+// (including tombstones). Lazy replicas load them, and only them.
+func (e *engineImpl) snapshotEntries(ids []uuid.UUID) map[uuid.UUID]entrySnapshot {
+	snap := make(map[uuid.UUID]entrySnapshot, len(ids))
+	for _, id := range ids {
+		if entry, ok := e.replica.GetEntryWithDeleted(id); ok {
+			snap[id] = newEntrySnapshot(entry)
+		}
+	}
+	return snap
+}
+
+func newEntrySnapshot(entry core.Entry) entrySnapshot {
+	tags := append([]string(nil), entry.Tags...)
+	sort.Strings(tags)
+	return entrySnapshot{
+		updatedAt:  entry.UpdatedAt,
+		deleted:    entry.Deleted,
+		content:    string(entry.Content),
+		tags:       strings.Join(tags, "\x00"),
+		archived:   entry.Archived,
+		archivedAt: entry.ArchivedAt,
+
+		collection:   entry.Collection,
+		collectionAt: entry.CollectionAt,
+
+		author:      entry.Author,
+		updatedTime: entry.UpdatedTime,
+	}
+}
+
+// changedEntries compares the given entries against a pre-merge snapshot
+// and returns every one (including tombstones) the merge added or
+// modified
+func (e *engineImpl) changedEntries(before map[uuid.UUID]entrySnapshot, ids []uuid.UUID) []core.Entry {
+	var changed []core.Entry
+	seen := make(map[uuid.UUID]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			continue // In both the entries and the tags of the state
+		}
+		seen[id] = true
+		entry, ok := e.replica.GetEntryWithDeleted(id)
+		if !ok {
+			continue
+		}
+		if prev, existed := before[id]; !existed || prev != newEntrySnapshot(entry) {
+			changed = append(changed, entry)
+		}
+	}
+	return changed
+}
+
+// diffEntries classifies changed entries as created, updated, deleted,
+// archived or unarchived relative to a pre-merge snapshot. A move to
+// another collection is an update. Changes to tombstones that stay
+// deleted, and to the archive and collection registers that leave the
+// entry where it was, produce no event.
+func diffEntries(before map[uuid.UUID]entrySnapshot, changed []core.Entry) []mergeChange {
+	var changes []mergeChange
+	for _, entry := range changed {
+		prev, existed := before[entry.ID]
+
+		switch {
+		case !existed || prev.deleted:
+			if !entry.Deleted {
+				changes = append(changes, mergeChange{eventType: EventCreated, entry: entry})
+			}
+		case entry.Deleted:
+			changes = append(changes, mergeChange{eventType: EventDeleted, entry: entry})
+		case registersOnly(prev, newEntrySnapshot(entry)):
+			if prev.archived != entry.Archived {
+				eventType := EventUnarchived
+				if entry.Archived {
+					eventType = EventArchived
+				}
+				changes = append(changes, mergeChange{eventType: eventType, entry: entry})
+			}
+			if prev.collection != entry.Collection {
+				changes = append(changes, mergeChange{eventType: EventUpdated, entry: entry})
+			}
+		default:
+			changes = append(changes, mergeChange{eventType: EventUpdated, entry: entry})
+		}
+	}
+	return changes
+}
+
+// registersOnly reports whether two snapshots differ at most in the
+// archive and collection registers (and the author of a tied version)
+func registersOnly(prev, next entrySnapshot) bool {
+	next.archived, next.archivedAt = prev.archived, prev.archivedAt
+	next.collection, next.collectionAt = prev.collection, prev.collectionAt
+	next.author, next.updatedTime = prev.author, prev.updatedTime
+	return prev == next
+}
+
+// aclVersion identifies which write of an ACL the replica holds
+type aclVersion struct {
+	timestamp uint64
+	owner     string
+}
+
+// snapshotACLs records the version of every ACL before a merge
+func (e *engineImpl) snapshotACLs() map[uuid.UUID]aclVersion {
+	acls := e.replica.ListACLs()
+	snap := make(map[uuid.UUID]aclVersion, len(acls))
+	for _, acl := range acls {
+		snap[acl.EntryID] = aclVersion{acl.Timestamp, acl.Owner}
+	}
+	return snap
+}
+
+// persistChanges writes the entries and ACLs a merge changed. Entries are
+// written in a single transaction, so a sync costs O(changes) writes
+// rather than one per entry in the vault.
+func (e *engineImpl) persistChanges(ctx context.Context, changed []core.Entry, aclsBefore map[uuid.UUID]aclVersion) error {
+	if len(changed) > 0 {
+		ops := make([]storage.Operation, len(changed))
+		for i, entry := range changed {
+			ops[i] = storage.Operation{Type: storage.OpPut, Entry: entry}
+			e.cache.invalidate(entry.ID)
+		}
+		if err := e.storeFor(ctx).ApplyBatch(ops); err != nil {
+			return fmt.Errorf("failed to persist merged entries: %w", err)
+		}
+	}
+
+	for _, acl := range e.replica.ListACLs() {
+		if prev, ok := aclsBefore[acl.EntryID]; ok && prev == (aclVersion{acl.Timestamp, acl.Owner}) {
+			continue
+		}
+		e.cache.invalidate(acl.EntryID) // Owner may have changed
+		if err := e.acls.SetACL(acl); err != nil {
+			return fmt.Errorf("failed to persist merged ACL: %w", err)
+		}
+	}
+	return nil
+}
+
+// applyState merges remote CRDT state, sent by the authenticated peer from
+// ("" if unknown), into the local replica, persists the result and
+// notifies subscribers and hooks of every entry the merge changed.
+// Quarantined entries are not counted in the stats.
+func (e *engineImpl) applyState(state crdt.ReplicaState, from string) (stats crdt.MergeStats, err error) {
+	started := time.Now()
+	ctx, span := e.startSpan("acorde.Merge", attribute.Int("acorde.remote_entries", len(state.Entries)))
+	defer func() { endSpan(span, err) }()
+
+	// Keep timestamps from a peer with a broken clock out of LWW
+	state, rejected := e.screenState(state)
+	if err := e.quarantineEntries(rejected); err != nil {
+		return stats, err
+	}
+
+	// ...and changes from peers the entry's ACL doesn't let write it
+	state, rejected = e.screenAuthors(state, from)
+	if err := e.quarantineEntries(rejected); err != nil {
+		return stats, err
+	}
+	state, rejected = e.screenACLs(state, from)
+	if err := e.quarantineEntries(rejected); err != nil {
+		return stats, err
+	}
+	stats = crdt.NewMergeStats(state)
+
+	// Create temporary replica with received state
+	tempClock := core.NewClockWithTime(state.ClockTime)
+	tempReplica := crdt.NewReplica(tempClock)
+	tempReplica.LoadState(state)
+
+	// Run as a bulk operation so the merge's events coalesce and its
+	// versions are saved in one batch
+	var changes []mergeChange
+	err = e.inBulk(ctx, func(ctx context.Context) error {
+		ids := stateIDs(state)
+		before := e.snapshotEntries(ids)
+		aclsBefore := e.snapshotACLs()
+		acksBefore := e.snapshotAcks()
+
+		// Merge into our replica
+		e.replica.Merge(tempReplica)
+
+		// Persist only what the merge changed
+		changed := e.changedEntries(before, ids)
+		stats.Changed = len(changed)
+		if err := e.persistChanges(ctx, changed, aclsBefore); err != nil {
+			return err
+		}
+
+		// Acknowledge delivered changes and persist acks
+		changes = diffEntries(before, changed)
+		span.SetAttributes(attribute.Int("acorde.changed_entries", len(changes)))
+		e.ackChanges(changes)
+		if err := e.saveMergeVersions(ctx, before, changes); err != nil {
+			return err
+		}
+		if err := e.persistAcks(acksBefore); err != nil {
+			return err
+		}
+
+		e.publishMergeChanges(ctx, changes)
+
+		return nil
+	})
+	if err != nil {
+		return stats, err
+	}
+
+	// After the bulk flush, once events and hooks have been delivered
+	e.reloadSchemas(changes)
+	e.afterMerge(changes)
+	stats.Duration = time.Since(started)
+	return stats, nil
+}
+
+// saveMergeVersions records a version of each entry a merge created or
+// whose content or tags it changed, by the device that made the change
+// and at the time it did (now if unknown)
+func (e *engineImpl) saveMergeVersions(ctx context.Context, before map[uuid.UUID]entrySnapshot, changes []mergeChange) error {
+	for _, change := range changes {
+		entry := change.entry
+		switch change.eventType {
+		case EventCreated:
+		case EventUpdated:
+			if prev, ok := before[entry.ID]; ok && registersOnly(prev, newEntrySnapshot(entry)) {
+				continue
+			}
+		default:
+			continue
+		}
+		createdAt := time.Now()
+		if entry.UpdatedTime > 0 {
+			createdAt = time.UnixMilli(entry.UpdatedTime)
+		}
+		if err := e.recordVersion(ctx, version.Version{
+			EntryID:   entry.ID,
+			Content:   entry.Content,
+			Tags:      entry.Tags,
+			Timestamp: entry.UpdatedAt,
+			CreatedAt: createdAt,
+			Author:    entry.Author,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// publishMergeChanges emits per-entry events (origin=remote) followed by a
+// single synced event
+func (e *engineImpl) publishMergeChanges(ctx context.Context, changes []mergeChange) {
+	now := time.Now()
+	for _, change := range changes {
+		entry := change.entry
+		var hookEvent hooks.HookEvent
+		switch change.eventType {
+		case EventCreated:
+			hookEvent = hooks.NewCreateEvent(entry.ID, string(entry.Type), e.plaintext(entry), entry.Tags)
+		case EventUpdated:
+			hookEvent = hooks.NewUpdateEvent(entry.ID, string(entry.Type), e.plaintext(entry), entry.Tags)
+		case EventDeleted:
+			hookEvent = hooks.NewDeleteEvent(entry.ID)
+			hookEvent.EntryType = string(entry.Type)
+		case EventArchived, EventUnarchived:
+			hookEvent = hooks.NewArchiveEvent(entry.ID, string(entry.Type), entry.Archived)
+		}
+		hookEvent.Origin = hooks.OriginRemote
+
+		e.notify(ctx, Event{
+			Type:      change.eventType,
+			EntryID:   entry.ID,
+			EntryType: string(entry.Type),
+			Timestamp: now,
+			Origin:    OriginRemote,
+		}, hookEvent)
+	}
+
+	syncEvent := hooks.NewSyncEvent("")
+	syncEvent.Origin = hooks.OriginRemote
+	e.notify(ctx, Event{
+		Type:      EventSynced,
+		Timestamp: now,
+		Origin:    OriginRemote,
+	}, syncEvent)
+}
+
+// plaintext returns the decrypted content of an entry, or nil if it
+// cannot be decrypted with the local key
+func (e *engineImpl) plaintext(entry core.Entry) []byte {
+	plaintext, err := e.decrypt(entry.ID, entry.Content)
+	if err != nil {
+		return nil
+	}
+	return plaintext
+}
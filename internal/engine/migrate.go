@@ -0,0 +1,88 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/amaydixit11/acorde/internal/core"
+	"github.com/amaydixit11/acorde/internal/schema"
+	"github.com/google/uuid"
+)
+
+// SchemaMigrator upgrades content written against an older version of an
+// entry type's schema
+type SchemaMigrator = schema.Migrator
+
+// RegisterSchemaVersion registers version (1 or more) of an entry type's
+// schema, replacing an older one. New and updated entries record the
+// version; entries written against an older one are upgraded by migrator
+// (nil = left as they are): as they are read, without writing them back,
+// when they are next updated, or all at once by MigrateType.
+func (e *engineImpl) RegisterSchemaVersion(entryType string, version int, schemaJSON []byte, migrator SchemaMigrator) error {
+	if err := e.schemas.RegisterVersion(entryType, version, schemaJSON, migrator); err != nil {
+		return err
+	}
+	e.cache.purge() // Cached entries hold content of the older version
+	return nil
+}
+
+// MigrateType upgrades every entry of entryType written against an older
+// schema version, as UpdateEntry does, in one bulk operation. Entries
+// this device may not write are skipped. It returns how many entries
+// were migrated, stopping at the first that fails.
+func (e *engineImpl) MigrateType(entryType string) (int, error) {
+	if e.isLocked() {
+		return 0, ErrLocked
+	}
+
+	var ids []uuid.UUID
+	for _, entry := range e.replica.ListEntries() {
+		if string(entry.Type) != entryType || !e.schemas.NeedsMigration(entryType, entry.SchemaVersion) {
+			continue
+		}
+		if e.canWrite(entry.ID) {
+			ids = append(ids, entry.ID)
+		}
+	}
+
+	migrated := 0
+	err := e.Bulk(func(b Batch) error {
+		for _, id := range ids {
+			if err := b.UpdateEntry(id, UpdateEntryInput{}); err != nil {
+				return fmt.Errorf("entry %s: %w", id, err)
+			}
+			migrated++
+		}
+		return nil
+	})
+	return migrated, err
+}
+
+// upgradeRead migrates the plaintext content of an entry being read to
+// its type's schema version. Content that fails to migrate is returned
+// as stored, with its version.
+func (e *engineImpl) upgradeRead(entry *Entry) {
+	if !e.schemas.NeedsMigration(string(entry.Type), entry.SchemaVersion) {
+		return
+	}
+	if content, version, err := e.schemas.Migrate(string(entry.Type), entry.SchemaVersion, entry.Content); err == nil {
+		entry.Content, entry.SchemaVersion = content, version
+	}
+}
+
+// migrateStored returns the stored content of an entry upgraded to its
+// type's schema version, for an update that leaves content alone. It
+// returns nil if no migration is needed.
+func (e *engineImpl) migrateStored(entry core.Entry) (*[]byte, error) {
+	if !e.schemas.NeedsMigration(string(entry.Type), entry.SchemaVersion) {
+		return nil, nil
+	}
+	plaintext, err := e.decrypt(entry.ID, entry.Content)
+	if err != nil {
+		return nil, fmt.Errorf("decryption failed: %w", err)
+	}
+	content, _, err := e.schemas.Migrate(string(entry.Type), entry.SchemaVersion, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	return &content, nil
+}
@@ -0,0 +1,43 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+)
+
+// MaxNamespaceLength is the longest namespace name
+const MaxNamespaceLength = 64
+
+// ErrInvalidNamespace is returned for namespace names ValidateNamespace
+// refuses
+var ErrInvalidNamespace = errors.New("invalid namespace")
+
+// ValidateNamespace checks a namespace name: "" (the default namespace),
+// or up to MaxNamespaceLength lowercase letters, digits, '-', '_' and
+// '.', starting with a letter or digit
+func ValidateNamespace(namespace string) error {
+	if namespace == "" {
+		return nil
+	}
+	if len(namespace) > MaxNamespaceLength {
+		return fmt.Errorf("%w: %q is longer than %d characters", ErrInvalidNamespace, namespace, MaxNamespaceLength)
+	}
+	for i, c := range namespace {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+		case i > 0 && (c == '-' || c == '_' || c == '.'):
+		default:
+			return fmt.Errorf("%w: %q (use lowercase letters, digits, '-', '_' and '.')", ErrInvalidNamespace, namespace)
+		}
+	}
+	return nil
+}
+
+// Namespaces counts live entries by namespace, in storage. Entries of a
+// vault that never used namespaces are all in "".
+func (e *engineImpl) Namespaces() (map[string]int, error) {
+	ctx, span := e.startSpan("acorde.Namespaces")
+	counts, err := e.storeFor(ctx).Namespaces()
+	endSpan(span, err)
+	return counts, err
+}
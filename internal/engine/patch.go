@@ -0,0 +1,98 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/amaydixit11/acorde/internal/jsonpatch"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ErrInvalidPatch is returned by PatchEntry when a patch cannot be
+// applied to an entry's content
+var ErrInvalidPatch = errors.New("invalid patch")
+
+// ErrPatchTestFailed is returned by PatchEntry when a JSON Patch "test"
+// operation does not match
+var ErrPatchTestFailed = jsonpatch.ErrTestFailed
+
+// PatchOperation is a JSON Patch (RFC 6902) operation
+type PatchOperation = jsonpatch.Operation
+
+// EntryPatch is a partial update of an entry: a JSON Patch or a JSON
+// Merge Patch (RFC 7396) of its JSON content, and tags to add and remove
+type EntryPatch struct {
+	JSONPatch  []PatchOperation
+	MergePatch []byte
+	AddTags    []string
+	RemoveTags []string // Applied after AddTags
+}
+
+// PatchEntry reads an entry, applies a patch to it, and updates it as
+// UpdateEntry does (extensions, rules, limits and schema validation
+// included), returning the updated entry. Patches are applied one at a
+// time, so concurrent patches of the same entry do not lose each other's
+// changes.
+func (e *engineImpl) PatchEntry(id uuid.UUID, patch EntryPatch) (Entry, error) {
+	ctx, span := e.startSpan("acorde.PatchEntry", attribute.String("acorde.entry_id", id.String()))
+	entry, err := e.patchEntry(ctx, id, patch)
+	endSpan(span, err)
+	return entry, err
+}
+
+func (e *engineImpl) patchEntry(ctx context.Context, id uuid.UUID, patch EntryPatch) (Entry, error) {
+	if patch.JSONPatch != nil && patch.MergePatch != nil {
+		return Entry{}, fmt.Errorf("%w: use a JSON Patch or a merge patch, not both", ErrInvalidPatch)
+	}
+	if patch.JSONPatch == nil && patch.MergePatch == nil && len(patch.AddTags) == 0 && len(patch.RemoveTags) == 0 {
+		return Entry{}, fmt.Errorf("%w: empty patch", ErrInvalidPatch)
+	}
+
+	e.patchMu.Lock()
+	defer e.patchMu.Unlock()
+
+	current, err := e.getEntry(id)
+	if err != nil {
+		return Entry{}, err
+	}
+	if current.Deleted {
+		return Entry{}, fmt.Errorf("cannot patch deleted entry %s", id)
+	}
+
+	var input UpdateEntryInput
+	if patch.JSONPatch != nil || patch.MergePatch != nil {
+		var content []byte
+		if patch.JSONPatch != nil {
+			content, err = jsonpatch.Apply(current.Content, patch.JSONPatch)
+		} else {
+			content, err = jsonpatch.Merge(current.Content, patch.MergePatch)
+		}
+		if errors.Is(err, jsonpatch.ErrTestFailed) {
+			return Entry{}, err
+		}
+		if err != nil {
+			return Entry{}, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+		}
+		input.Content = &content
+	}
+	if len(patch.AddTags) > 0 || len(patch.RemoveTags) > 0 {
+		tags := slices.Clone(current.Tags)
+		for _, tag := range patch.AddTags {
+			if !slices.Contains(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+		tags = slices.DeleteFunc(tags, func(tag string) bool {
+			return slices.Contains(patch.RemoveTags, tag)
+		})
+		input.Tags = &tags
+	}
+
+	if err := e.updateEntry(ctx, id, input); err != nil {
+		return Entry{}, err
+	}
+	return e.getEntry(id)
+}
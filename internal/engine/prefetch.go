@@ -0,0 +1,135 @@
+package engine
+
+import (
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// prefetchQueueSize bounds the entries read waiting for their linked
+// entries to be prefetched; reads beyond it are not prefetched for
+const prefetchQueueSize = 64
+
+// maxPrefetchLinks bounds the linked entries prefetched per entry read
+const maxPrefetchLinks = 32
+
+// Prefetch loads entries into the decrypted entry cache, so that reading
+// them next is served from memory. Entries already cached, unknown,
+// unreadable or failing to decrypt are skipped. It returns the number of
+// entries loaded.
+func (e *engineImpl) Prefetch(ids []uuid.UUID) int {
+	loaded := 0
+	for _, id := range ids {
+		if e.prefetchEntry(id) {
+			loaded++
+		}
+	}
+	return loaded
+}
+
+// prefetchEntry loads an entry into the cache unless it is already there
+func (e *engineImpl) prefetchEntry(id uuid.UUID) bool {
+	if e.isLocked() || !e.canRead(id) {
+		return false
+	}
+	coreEntry, err := e.replica.GetEntry(id)
+	if err != nil || e.cache.contains(id, coreEntry.UpdatedAt) {
+		return false
+	}
+	_, err = e.loadEntry(coreEntry)
+	return err == nil
+}
+
+// prefetchLinked prefetches the entries an entry links to and from
+func (e *engineImpl) prefetchLinked(id uuid.UUID) {
+	e.Prefetch(e.linkedEntries(id))
+}
+
+// linkedEntries returns up to maxPrefetchLinks entries an entry links to
+// with [[wiki links]], by ID or title, then entries linking to it
+func (e *engineImpl) linkedEntries(id uuid.UUID) []uuid.UUID {
+	seen := map[uuid.UUID]bool{id: true}
+	var ids []uuid.UUID
+	add := func(linked uuid.UUID) {
+		if !seen[linked] && len(ids) < maxPrefetchLinks {
+			seen[linked] = true
+			ids = append(ids, linked)
+		}
+	}
+
+	doc, _ := e.titles.Get(id)
+	for _, target := range doc.Links {
+		if linked, err := uuid.Parse(target); err == nil {
+			add(linked)
+			continue
+		}
+		exact, _ := e.titles.FindTitle(target)
+		for _, linked := range exact {
+			add(linked.ID)
+		}
+	}
+	for _, linked := range e.titles.LinkedFrom(id) {
+		add(linked)
+	}
+	return ids
+}
+
+// prefetcher runs a function for entries read, one at a time, in the
+// background
+type prefetcher struct {
+	mu      sync.Mutex
+	pending chan uuid.UUID // nil once stopped
+	done    chan struct{}
+}
+
+// newPrefetcher starts a prefetcher running fn
+func newPrefetcher(fn func(uuid.UUID)) *prefetcher {
+	pending := make(chan uuid.UUID, prefetchQueueSize)
+	p := &prefetcher{pending: pending, done: make(chan struct{})}
+	go func() {
+		defer close(p.done)
+		for id := range pending {
+			fn(id)
+		}
+	}()
+	return p
+}
+
+// queue queues an entry read, dropping it if the queue is full
+func (p *prefetcher) queue(id uuid.UUID) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pending == nil {
+		return
+	}
+	select {
+	case p.pending <- id:
+	default:
+	}
+}
+
+// stop waits for the entry being prefetched for, dropping those queued
+func (p *prefetcher) stop() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	pending := p.pending
+	p.pending = nil
+	p.mu.Unlock()
+	if pending == nil {
+		return
+	}
+	for drained := false; !drained; {
+		select {
+		case <-pending:
+		default:
+			drained = true
+		}
+	}
+	close(pending)
+	<-p.done
+}
@@ -0,0 +1,77 @@
+package engine
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/amaydixit11/acorde/internal/core"
+	"github.com/amaydixit11/acorde/internal/rules"
+	"github.com/google/uuid"
+)
+
+// AddRule validates a rule and stores it as a config entry, so that it
+// syncs to the vault's other devices
+func (e *engineImpl) AddRule(rule rules.Rule) (rules.Rule, error) {
+	if err := rule.Validate(); err != nil {
+		return rules.Rule{}, err
+	}
+	content, err := rules.Encode(rule)
+	if err != nil {
+		return rules.Rule{}, err
+	}
+	entry, err := e.AddEntry(AddEntryInput{
+		Type:    core.Config,
+		Content: content,
+		Tags:    []string{rules.Tag},
+	})
+	if err != nil {
+		return rules.Rule{}, err
+	}
+	rule.ID = entry.ID
+	return rule, nil
+}
+
+// ListRules returns the vault's rules in the order they apply. Config
+// entries that do not hold a valid rule (e.g. written by a newer version)
+// are skipped.
+func (e *engineImpl) ListRules() ([]rules.Rule, error) {
+	entryType, tag := core.Config, rules.Tag
+	entries, err := e.ListEntries(ListFilter{Type: &entryType, Tag: &tag})
+	if err != nil {
+		return nil, err
+	}
+	var list []rules.Rule
+	for _, entry := range entries {
+		if rule, err := rules.Decode(entry.ID, entry.Content); err == nil {
+			list = append(list, rule)
+		}
+	}
+	rules.Sort(list)
+	return list, nil
+}
+
+// RemoveRule deletes a rule's config entry
+func (e *engineImpl) RemoveRule(id uuid.UUID) error {
+	entry, err := e.replica.GetEntry(id)
+	if err != nil {
+		return convertCRDTError(err)
+	}
+	if entry.Type != core.Config || !slices.Contains(entry.Tags, rules.Tag) {
+		return fmt.Errorf("entry %s is not a rule", id)
+	}
+	return e.DeleteEntry(id)
+}
+
+// applyRules runs the vault's rules on an entry being added or updated.
+// Config entries are left alone. Rules that cannot be loaded are skipped
+// rather than failing the change.
+func (e *engineImpl) applyRules(entryType EntryType, content []byte, tags []string) ([]byte, []string, bool) {
+	if entryType == core.Config {
+		return content, tags, false
+	}
+	list, err := e.ListRules()
+	if err != nil || len(list) == 0 {
+		return content, tags, false
+	}
+	return rules.Apply(list, string(entryType), content, tags)
+}
@@ -0,0 +1,182 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/amaydixit11/acorde/internal/core"
+	"github.com/amaydixit11/acorde/internal/schema"
+)
+
+// ErrSchemaNotFound is returned for an entry type without a schema saved
+// in the vault
+var ErrSchemaNotFound = errors.New("schema not found")
+
+// StoredSchema is an entry type's schema saved in the vault
+type StoredSchema = schema.Stored
+
+// ValidationResult is the outcome of checking content against a schema:
+// each error names the field (a dotted path, "(root)" for the content
+// itself) and what is wrong with it
+type ValidationResult = schema.ValidationResult
+
+// SaveSchema checks a JSON schema and stores it as a config entry for an
+// entry type, so that it persists and syncs to the vault's other devices.
+// It is registered at once, replacing the schema registered for the
+// type; a schema already saved for the type is replaced.
+func (e *engineImpl) SaveSchema(entryType string, definition []byte) (StoredSchema, error) {
+	if err := checkSchemaType(entryType); err != nil {
+		return StoredSchema{}, err
+	}
+	if err := schema.Check(definition); err != nil {
+		return StoredSchema{}, err
+	}
+	stored := StoredSchema{Type: entryType, Definition: definition}
+	content, err := schema.EncodeStored(stored)
+	if err != nil {
+		return StoredSchema{}, err
+	}
+
+	existing, err := e.GetSchema(entryType)
+	switch {
+	case err == nil:
+		if err := e.UpdateEntry(existing.ID, UpdateEntryInput{Content: &content}); err != nil {
+			return StoredSchema{}, err
+		}
+		stored.ID = existing.ID
+	case errors.Is(err, ErrSchemaNotFound):
+		entry, err := e.AddEntry(AddEntryInput{
+			Type:    core.Config,
+			Content: content,
+			Tags:    []string{schema.Tag},
+		})
+		if err != nil {
+			return StoredSchema{}, err
+		}
+		stored.ID = entry.ID
+	default:
+		return StoredSchema{}, err
+	}
+	return stored, e.loadSchemas()
+}
+
+// ListSchemas returns the schemas saved in the vault by entry type. If
+// devices saved a schema for the same type concurrently, the one created
+// first is used. Config entries that do not hold a valid schema are
+// skipped.
+func (e *engineImpl) ListSchemas() ([]StoredSchema, error) {
+	entryType, tag := core.Config, schema.Tag
+	entries, err := e.ListEntries(ListFilter{
+		Type: &entryType, Tag: &tag,
+		Sort: SortCreatedAt, Ascending: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var list []StoredSchema
+	taken := make(map[string]bool)
+	for _, entry := range entries {
+		stored, err := schema.DecodeStored(entry.ID, entry.Content)
+		if err != nil || taken[stored.Type] {
+			continue
+		}
+		taken[stored.Type] = true
+		list = append(list, stored)
+	}
+	schema.SortStored(list)
+	return list, nil
+}
+
+// GetSchema returns the schema saved in the vault for an entry type
+func (e *engineImpl) GetSchema(entryType string) (StoredSchema, error) {
+	list, err := e.ListSchemas()
+	if err != nil {
+		return StoredSchema{}, err
+	}
+	for _, stored := range list {
+		if stored.Type == entryType {
+			return stored, nil
+		}
+	}
+	return StoredSchema{}, fmt.Errorf("%w: %s", ErrSchemaNotFound, entryType)
+}
+
+// DeleteSchema deletes the schema saved for an entry type; entries of the
+// type are no longer validated, unless it has a built-in schema
+func (e *engineImpl) DeleteSchema(entryType string) error {
+	stored, err := e.GetSchema(entryType)
+	if err != nil {
+		return err
+	}
+	if err := e.DeleteEntry(stored.ID); err != nil {
+		return err
+	}
+	return e.loadSchemas()
+}
+
+// ValidateContent checks content against the schema registered for an
+// entry type, without writing anything (ErrNoSchema if it has none)
+func (e *engineImpl) ValidateContent(entryType string, content []byte) (ValidationResult, error) {
+	if !e.schemas.HasSchema(entryType) {
+		return ValidationResult{}, fmt.Errorf("%w: %s", ErrNoSchema, entryType)
+	}
+	return e.schemas.Validate(entryType, content), nil
+}
+
+// checkSchemaType checks that schemas can be saved for an entry type:
+// not for config, file and credential entries, whose content the engine
+// defines
+func checkSchemaType(entryType string) error {
+	switch t := core.EntryType(entryType); {
+	case !t.IsValid():
+		return fmt.Errorf("invalid entry type %q", entryType)
+	case t == core.Config || t == core.File || t == core.Credential:
+		return fmt.Errorf("the %s entry type has a fixed schema", entryType)
+	}
+	return nil
+}
+
+// loadSchemas registers the schemas saved in the vault, replacing those
+// registered for their types, and unregisters those deleted since the
+// last load (restoring built-in schemas)
+func (e *engineImpl) loadSchemas() error {
+	list, err := e.ListSchemas()
+	if err != nil {
+		return err
+	}
+
+	e.storedMu.Lock()
+	defer e.storedMu.Unlock()
+	loaded := make(map[string]bool, len(list))
+	for _, stored := range list {
+		if checkSchemaType(stored.Type) != nil {
+			continue
+		}
+		if err := e.schemas.RegisterFromJSON(stored.Type, stored.Type+"-schema", stored.Definition); err == nil {
+			loaded[stored.Type] = true
+		}
+	}
+	for entryType := range e.storedSchemas {
+		if loaded[entryType] {
+			continue
+		}
+		e.schemas.Unregister(entryType)
+		if builtin, ok := schema.Builtin[entryType]; ok && e.builtins {
+			e.schemas.RegisterFromJSON(entryType, entryType+"-schema", builtin)
+		}
+	}
+	e.storedSchemas = loaded
+	return nil
+}
+
+// reloadSchemas reloads the schemas saved in the vault if a merge changed
+// config entries, which hold them. Schemas that cannot be loaded keep the
+// ones registered before.
+func (e *engineImpl) reloadSchemas(changes []mergeChange) {
+	for _, change := range changes {
+		if change.entry.Type == core.Config {
+			e.loadSchemas()
+			return
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/amaydixit11/acorde/internal/core"
+	"github.com/amaydixit11/acorde/internal/markdown"
+	"github.com/amaydixit11/acorde/internal/search"
+	"github.com/amaydixit11/acorde/internal/storage"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ErrSearchDisabled is returned by Search when the engine has no search index
+var ErrSearchDisabled = errors.New("search index is disabled")
+
+// openSearchIndex creates the engine's search index. Encrypted and in-memory
+// vaults get an in-memory index so plaintext is never written to disk.
+func openSearchIndex(cfg Config, dataDir string) (*search.Index, error) {
+	if cfg.DisableSearch {
+		return nil, nil
+	}
+	indexCfg := search.IndexConfig{Analyzer: cfg.SearchAnalyzer}
+	if cfg.InMemory || cfg.EncryptionKey != nil {
+		return search.NewMemoryIndexWithConfig(indexCfg)
+	}
+	index, err := search.NewIndexWithConfig(dataDir, indexCfg)
+	if errors.Is(err, search.ErrIndexLocked) {
+		// Another process (usually the daemon) owns the on-disk index; use a
+		// private in-memory one rather than blocking
+		return search.NewMemoryIndexWithConfig(indexCfg)
+	}
+	return index, err
+}
+
+// Search runs a full-text query against the engine's index
+func (e *engineImpl) Search(query string, opts search.SearchOptions) (*search.Results, error) {
+	if e.index == nil {
+		return nil, ErrSearchDisabled
+	}
+	if e.isLocked() {
+		return nil, ErrLocked
+	}
+	_, span := e.startSpan("acorde.Search")
+	results, err := e.index.SearchFaceted(query, opts)
+	if err == nil {
+		span.SetAttributes(attribute.Int("acorde.hits", int(results.Total)))
+	}
+	endSpan(span, err)
+	return results, err
+}
+
+// QuickOpen fuzzy-matches entry titles and metadata, best matches first
+func (e *engineImpl) QuickOpen(query string, limit int) []search.TitleMatch {
+	return e.titles.Match(query, limit)
+}
+
+// reindex marks entries as changed in the search indexes. If ctx is part
+// of a bulk operation the work is deferred until the operation completes.
+func (e *engineImpl) reindex(ctx context.Context, ids ...uuid.UUID) {
+	if state := bulkFrom(ctx); state != nil {
+		state.mu.Lock()
+		for _, id := range ids {
+			state.reindex[id] = struct{}{}
+		}
+		state.mu.Unlock()
+		return
+	}
+	e.updateIndex(ids)
+}
+
+// indexBatchSize is the most entries indexed in one batch, which bounds
+// the plaintext held in memory while (re)building the index of a vault
+const indexBatchSize = 500
+
+// updateIndex (re)indexes live entries and removes deleted ones. While
+// the vault is locked it does nothing; Unlock reindexes everything.
+func (e *engineImpl) updateIndex(ids []uuid.UUID) error {
+	if e.isLocked() {
+		return nil
+	}
+	for len(ids) > indexBatchSize {
+		if err := e.indexEntries(ids[:indexBatchSize], e.index); err != nil {
+			return err
+		}
+		ids = ids[indexBatchSize:]
+	}
+	return e.indexEntries(ids, e.index)
+}
+
+// indexEntries updates the title index, the titles stored for sorting
+// and, if index is non-nil, the full-text index for the given entries
+func (e *engineImpl) indexEntries(ids []uuid.UUID, index *search.Index) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var docs []search.Document
+	var deletes []uuid.UUID
+	titles := make(map[uuid.UUID]string, len(ids))
+	for _, id := range ids {
+		entry, ok := e.replica.Peek(id) // Indexing does not load lazy entries
+		if !ok || entry.Deleted {
+			e.titles.Remove(id)
+			deletes = append(deletes, id)
+			continue
+		}
+
+		content := e.plaintext(entry)
+		titles[id] = search.EntryTitle(content)
+		e.titles.Put(search.TitleDoc{
+			ID:       id,
+			Title:    titles[id],
+			Type:     string(entry.Type),
+			Tags:     entry.Tags,
+			Archived: entry.Archived, // Quick-open never offers archived entries
+			Links:    markdown.WikiLinks(content),
+		})
+		if index == nil {
+			continue
+		}
+
+		month := time.Now()
+		if first, ok := e.versions.FirstSavedAt(id); ok {
+			month = first
+		}
+
+		docs = append(docs, search.Document{
+			ID:      id.String(),
+			Type:    string(entry.Type),
+			Content: string(content),
+			Tags:    entry.Tags,
+			Month:   month.Format("2006-01"),
+
+			Archived: entry.Archived,
+		})
+	}
+
+	// Plaintext vaults sort by title in storage; titles of encrypted ones
+	// must not reach the disk
+	if !e.encrypted() {
+		if err := e.store.SetTitles(titles); err != nil {
+			return err
+		}
+	}
+
+	if index == nil {
+		return nil
+	}
+	if err := index.IndexBatch(docs, deletes); err != nil {
+		return fmt.Errorf("failed to update search index: %w", err)
+	}
+	return nil
+}
+
+// syncIndex builds the in-memory title index and brings the search index
+// up to date with the replica: only entries changed since the watermark
+// saved when it was last opened, or every entry if it has none or entries
+// before it changed (new index, e.g. search enabled on an existing vault,
+// encrypted vault, changed analyzer, or changes made by another process
+// while this one held the index)
+func (e *engineImpl) syncIndex(cfg Config, dataDir string) error {
+	ids, err := e.liveIDs()
+	if err != nil {
+		return err
+	}
+
+	if e.index == nil {
+		return e.updateIndex(ids)
+	}
+
+	if changed, ok := e.changedSinceWatermark(); ok {
+		// Full-text index is current up to its watermark
+		if err := e.indexEntries(ids, nil); err != nil {
+			return err
+		}
+		if err := e.updateIndex(changed); err != nil {
+			return err
+		}
+		return e.saveIndexWatermark()
+	}
+
+	// Start from an empty index so stale documents don't survive
+	count, err := e.index.DocCount()
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		if err := e.index.Delete(); err != nil {
+			return err
+		}
+		if e.index, err = openSearchIndex(cfg, dataDir); err != nil {
+			return err
+		}
+	}
+
+	if err := e.updateIndex(ids); err != nil {
+		return err
+	}
+	return e.saveIndexWatermark()
+}
+
+// indexWatermark is the state of the vault an on-disk search index was
+// brought up to date with when it was opened: the latest entry timestamp,
+// and a digest of the live entries at or before it. Entries written later
+// by this process are indexed as they change; those written by others
+// either come after it or change the digest.
+type indexWatermark struct {
+	Clock  uint64 `json:"clock"`
+	Digest []byte `json:"digest"`
+}
+
+// saveIndexWatermark records the state the on-disk search index was just
+// brought up to date with
+func (e *engineImpl) saveIndexWatermark() error {
+	if e.index == nil || !e.index.OnDisk() {
+		return nil
+	}
+	entries, err := e.indexedEntries()
+	if err != nil {
+		return err
+	}
+	var clock uint64
+	for _, entry := range entries {
+		clock = max(clock, entry.UpdatedAt)
+	}
+	data, err := json.Marshal(indexWatermark{Clock: clock, Digest: entriesDigest(entries, clock)})
+	if err != nil {
+		return err
+	}
+	return e.index.SetWatermark(data)
+}
+
+// changedSinceWatermark returns the entries (live or deleted) written
+// after the search index's watermark. ok is false if the index has no
+// watermark or entries at or before it changed since, e.g. written by
+// another process or merged with older timestamps: then only a rebuild
+// brings it up to date.
+func (e *engineImpl) changedSinceWatermark() (changed []uuid.UUID, ok bool) {
+	data, err := e.index.Watermark()
+	if err != nil || data == nil {
+		return nil, false
+	}
+	var mark indexWatermark
+	if json.Unmarshal(data, &mark) != nil {
+		return nil, false
+	}
+	entries, err := e.indexedEntries()
+	if err != nil || !bytes.Equal(entriesDigest(entries, mark.Clock), mark.Digest) {
+		return nil, false
+	}
+	for _, entry := range entries {
+		if entry.UpdatedAt > mark.Clock {
+			changed = append(changed, entry.ID)
+		}
+	}
+	return changed, true
+}
+
+// indexedEntries lists every entry, tombstones included, without content:
+// what the watermark describes. They are read from storage, so a lazy
+// replica is not loaded.
+func (e *engineImpl) indexedEntries() ([]core.Entry, error) {
+	return e.store.List(storage.ListFilter{Deleted: true, Archived: true, WithoutContent: true})
+}
+
+// entriesDigest hashes what the search index holds of the live entries
+// updated at or before clock
+func entriesDigest(entries []core.Entry, clock uint64) []byte {
+	entries = slices.Clone(entries)
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].ID[:], entries[j].ID[:]) < 0
+	})
+	h := sha256.New()
+	for _, entry := range entries {
+		if entry.Deleted || entry.UpdatedAt > clock {
+			continue
+		}
+		tags := slices.Sorted(slices.Values(entry.Tags))
+		fmt.Fprintf(h, "%s %d %t %q\n", entry.ID, entry.UpdatedAt, entry.Archived, tags)
+	}
+	return h.Sum(nil)
+}
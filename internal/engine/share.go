@@ -0,0 +1,230 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/amaydixit11/acorde/internal/core"
+	"github.com/amaydixit11/acorde/internal/sharing"
+	"github.com/amaydixit11/acorde/pkg/crypto"
+	"github.com/google/uuid"
+)
+
+// ErrNotShared is returned when reading a shared entry this device holds
+// no entry key for
+var ErrNotShared = errors.New("entry is not shared with this device")
+
+// ErrACLDisabled is returned by ShareEntry when Config.DisableACL is set
+var ErrACLDisabled = errors.New("entry ACLs are disabled")
+
+// ShareEntry gives peers read access to a single entry. The entry is
+// re-encrypted with its own random entry key, which is wrapped for each
+// peer (X25519 between this device's key and theirs, see sharing.ShareKeyWith)
+// and stored in the entry's ACL, so the wrapped keys reach peers through
+// normal sync. Sharing again with more peers reuses the entry key.
+func (e *engineImpl) ShareEntry(id uuid.UUID, peerIDs []string) error {
+	if e.aclOff {
+		return ErrACLDisabled
+	}
+	if allowed, _ := e.acls.CheckAdmin(id, e.localID); !allowed {
+		return fmt.Errorf("permission denied")
+	}
+	current, err := e.replica.GetEntry(id)
+	if err != nil {
+		return convertCRDTError(err)
+	}
+	if e.peerKeys == nil {
+		return errors.New("sharing requires a device key resolver (Config.PeerKeys)")
+	}
+
+	// Resolve every recipient before changing anything
+	recipients := make(map[string][]byte, len(peerIDs))
+	for _, peerID := range peerIDs {
+		if peerID == e.localID {
+			continue
+		}
+		key, err := e.peerKeys(peerID)
+		if err != nil {
+			return fmt.Errorf("no device key for peer %s: %w", peerID, err)
+		}
+		if len(key) != 32 {
+			return fmt.Errorf("invalid device key for peer %s", peerID)
+		}
+		recipients[peerID] = key
+	}
+
+	acl, ok := e.replica.GetACL(id)
+	if !ok {
+		acl = core.ACL{EntryID: id, Owner: e.localID}
+	}
+	acl = acl.Clone()
+
+	var entryKey crypto.Key
+	first := !acl.IsShared()
+	if first {
+		if entryKey, err = crypto.GenerateKey(); err != nil {
+			return err
+		}
+		acl.OwnerKey = e.device.Public[:]
+		acl.Keys = make(map[string][]byte)
+		recipients[e.localID] = e.device.Public[:] // So this device can read it without the vault key
+		if acl.SealedKey, err = e.sealEntryKey(id, entryKey); err != nil {
+			return err
+		}
+	} else if entryKey, err = e.entryKey(id); err != nil {
+		return err
+	}
+
+	for peerID, deviceKey := range recipients {
+		shared, err := sharing.ShareKeyWith(&sharing.EntryKey{Key: entryKey, EntryID: id}, e.device.Private, sharing.PeerID(deviceKey))
+		if err != nil {
+			return err
+		}
+		acl.Keys[peerID] = shared.EncryptedKey
+		if peerID != e.localID && !containsString(acl.Readers, peerID) {
+			acl.Readers = append(acl.Readers, peerID)
+		}
+	}
+
+	// Decrypt with the vault key before the ACL switches the entry over
+	var content []byte
+	if first {
+		plaintext, err := e.decrypt(id, current.Content)
+		if err != nil {
+			return fmt.Errorf("decryption failed: %w", err)
+		}
+		if content, err = e.cipher.Encrypt(entryKey, plaintext, []byte(id.String())); err != nil {
+			return fmt.Errorf("encryption failed: %w", err)
+		}
+	}
+
+	acl.Timestamp = 0 // Assigned by the replica clock
+	e.replica.SetACL(acl)
+	acl, _ = e.replica.GetACL(id)
+	if err := e.acls.SetACL(acl); err != nil {
+		return fmt.Errorf("failed to store ACL: %w", err)
+	}
+	e.shareMu.Lock()
+	e.entryKeys[id] = entryKey
+	e.shareMu.Unlock()
+
+	if first {
+		if err := e.replica.UpdateEntry(id, &content, nil); err != nil {
+			return convertCRDTError(err)
+		}
+		updated, _ := e.replica.GetEntry(id)
+		e.cache.invalidate(id)
+		if err := e.store.Put(updated); err != nil {
+			return fmt.Errorf("failed to store entry: %w", err)
+		}
+	}
+	return nil
+}
+
+// sharedEntryKey returns the entry key of a shared entry. ok is false for
+// entries encrypted with the vault key.
+func (e *engineImpl) sharedEntryKey(id uuid.UUID) (key crypto.Key, ok bool, err error) {
+	acl, exists := e.replica.GetACL(id)
+	if !exists || !acl.IsShared() {
+		return crypto.Key{}, false, nil
+	}
+	key, err = e.entryKey(id)
+	return key, true, err
+}
+
+// entryKey recovers a shared entry's key: from the copy wrapped for this
+// device, or else from the copy sealed with the vault key (other devices
+// of the owner)
+func (e *engineImpl) entryKey(id uuid.UUID) (crypto.Key, error) {
+	e.shareMu.Lock()
+	key, cached := e.entryKeys[id]
+	e.shareMu.Unlock()
+	if cached {
+		return key, nil
+	}
+
+	acl, _ := e.replica.GetACL(id)
+	if wrapped, ok := acl.Keys[e.localID]; ok {
+		// Trust the owner's device key only as far as our own records go
+		if acl.Owner != e.localID && e.peerKeys != nil {
+			if known, err := e.peerKeys(acl.Owner); err != nil || string(known) != string(acl.OwnerKey) {
+				return crypto.Key{}, fmt.Errorf("unverified device key for owner %s", acl.Owner)
+			}
+		}
+		recovered, err := sharing.RecoverSharedKey(&sharing.ShareableKey{EncryptedKey: wrapped}, id, e.device.Private, sharing.PeerID(acl.OwnerKey))
+		if err != nil {
+			return crypto.Key{}, err
+		}
+		key = *recovered
+	} else if len(acl.SealedKey) > 0 {
+		opened, _, err := e.openWithVaultKeys(acl.SealedKey, sealAAD(id))
+		if err != nil || len(opened) != crypto.KeySize {
+			return crypto.Key{}, ErrNotShared
+		}
+		copy(key[:], opened)
+	} else {
+		return crypto.Key{}, ErrNotShared
+	}
+
+	e.shareMu.Lock()
+	e.entryKeys[id] = key
+	e.shareMu.Unlock()
+	return key, nil
+}
+
+// sealEntryKey encrypts an entry key with the vault key (nil if the vault
+// is not encrypted)
+func (e *engineImpl) sealEntryKey(id uuid.UUID, entryKey crypto.Key) ([]byte, error) {
+	e.keyMu.RLock()
+	key, locked := e.key, e.locked != nil
+	e.keyMu.RUnlock()
+
+	if locked {
+		return nil, ErrLocked
+	}
+	if key == nil {
+		return nil, nil
+	}
+	return e.sealWithVaultKey(entryKey[:], sealAAD(id))
+}
+
+// resealEntryKeys re-seals entry keys still sealed with a retired vault key
+func (e *engineImpl) resealEntryKeys() error {
+	for _, acl := range e.replica.ListACLs() {
+		if len(acl.SealedKey) == 0 {
+			continue
+		}
+		opened, current, err := e.openWithVaultKeys(acl.SealedKey, sealAAD(acl.EntryID))
+		if err != nil || current {
+			continue
+		}
+		var entryKey crypto.Key
+		copy(entryKey[:], opened)
+
+		updated := acl.Clone()
+		if updated.SealedKey, err = e.sealEntryKey(acl.EntryID, entryKey); err != nil {
+			return err
+		}
+		updated.Timestamp = 0
+		e.replica.SetACL(updated)
+		updated, _ = e.replica.GetACL(acl.EntryID)
+		if err := e.acls.SetACL(updated); err != nil {
+			return fmt.Errorf("failed to store ACL: %w", err)
+		}
+	}
+	return nil
+}
+
+// sealAAD binds a sealed entry key to its entry
+func sealAAD(id uuid.UUID) []byte {
+	return []byte("acorde-entry-key|" + id.String())
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
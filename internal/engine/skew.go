@@ -0,0 +1,164 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/amaydixit11/acorde/internal/core"
+	"github.com/amaydixit11/acorde/internal/crdt"
+	"github.com/amaydixit11/acorde/internal/quarantine"
+	"github.com/google/uuid"
+)
+
+// DefaultMaxClockSkew is how far ahead of local wall time a merged
+// timestamp may be (see Config.MaxClockSkew)
+const DefaultMaxClockSkew = 24 * time.Hour
+
+// QuarantinedEntry is a version of an entry a merge rejected because its
+// timestamp was implausibly far ahead of the local clock (left in, it
+// would win every last-writer-wins conflict until clocks caught up), or
+// because the peer that sent it is not allowed to write the entry. ACL
+// changes from a peer that doesn't own the entry are quarantined too,
+// with EntryType "acl".
+type QuarantinedEntry struct {
+	EntryID       uuid.UUID `json:"entry_id"`
+	EntryType     string    `json:"entry_type"`
+	Timestamp     uint64    `json:"timestamp"` // The rejected timestamp
+	Reason        string    `json:"reason"`
+	Rejections    int64     `json:"rejections"` // Times received (peers resend it every sync)
+	QuarantinedAt time.Time `json:"quarantined_at"`
+	LastSeen      time.Time `json:"last_seen"`
+}
+
+// skewLimits bounds how far ahead of the local clock merged timestamps
+// may be
+type skewLimits struct {
+	wall    time.Duration // For HLC timestamps, against wall time (0 = off)
+	logical uint64        // For Lamport timestamps, in ticks (0 = off)
+}
+
+func newSkewLimits(cfg Config) skewLimits {
+	l := skewLimits{wall: cfg.MaxClockSkew, logical: cfg.MaxLogicalSkew}
+	if l.wall == 0 {
+		l.wall = DefaultMaxClockSkew
+	} else if l.wall < 0 {
+		l.wall = 0
+	}
+	return l
+}
+
+// check returns why a timestamp is implausible, or "". Timestamps past
+// the Lamport range carry wall time (see core.WallTime), which catches
+// absurdly high values whichever clock the vault uses. They are compared
+// with the local clock's wall time when that is ahead of now.
+func (l skewLimits) check(ts, local uint64, now time.Time) string {
+	if wall := core.WallTime(ts); !wall.IsZero() {
+		if localWall := core.WallTime(local); localWall.After(now) {
+			now = localWall
+		}
+		if ahead := wall.Sub(now); l.wall > 0 && ahead > l.wall {
+			return fmt.Sprintf("timestamp is %s ahead of the local clock (max %s)", ahead.Round(time.Second), l.wall)
+		}
+		return ""
+	}
+	if l.logical > 0 && ts > local && ts-local > l.logical {
+		return fmt.Sprintf("timestamp is %d ticks ahead of the local clock (max %d)", ts-local, l.logical)
+	}
+	return ""
+}
+
+// screenState removes entry versions with implausible timestamps from
+// remote state before it is merged, and caps its clock time so that it
+// cannot drag the local clock ahead either. Removed versions are returned
+// for quarantine; the entries keep their local versions.
+func (e *engineImpl) screenState(state crdt.ReplicaState) (crdt.ReplicaState, []quarantine.Entry) {
+	if e.skew == (skewLimits{}) {
+		return state, nil
+	}
+	local, now := e.replica.ClockTime(), time.Now()
+
+	var rejected []quarantine.Entry
+	var highest uint64 // Of the timestamps kept
+	kept := state.Entries[:0:0]
+	for _, elem := range state.Entries {
+		ts := max(elem.Timestamp, elem.Entry.UpdatedAt, elem.Entry.CreatedAt)
+		reason := e.skew.check(ts, local, now)
+		if reason == "" {
+			kept = append(kept, elem)
+			highest = max(highest, ts)
+			continue
+		}
+		element, _ := json.Marshal(elem)
+		rejected = append(rejected, quarantine.Entry{
+			EntryID:   elem.Entry.ID,
+			EntryType: string(elem.Entry.Type),
+			Timestamp: ts,
+			Reason:    reason,
+			// Put keeps the first rejection time of a known version
+			QuarantinedAt: now.Unix(),
+			LastSeen:      now.Unix(),
+			Element:       element,
+		})
+	}
+	state.Entries = kept
+
+	// ACLs and acks are merged as they are; they move the clock anyway
+	for _, acl := range state.ACLs {
+		highest = max(highest, acl.Timestamp)
+	}
+	for _, a := range state.Acks {
+		highest = max(highest, a.Timestamp)
+	}
+	if e.skew.check(state.ClockTime, local, now) != "" {
+		state.ClockTime = highest
+	}
+	return state, rejected
+}
+
+// quarantineEntries stores rejected versions and reports them to
+// Config.OnQuarantine
+func (e *engineImpl) quarantineEntries(rejected []quarantine.Entry) error {
+	for _, q := range rejected {
+		if err := e.quarantine.Put(q); err != nil {
+			return fmt.Errorf("failed to quarantine entry: %w", err)
+		}
+		if e.onQuarantine != nil {
+			e.onQuarantine(toQuarantinedEntry(q))
+		}
+	}
+	return nil
+}
+
+// Quarantined lists the entry versions and ACL changes merges rejected,
+// for implausible timestamps or unauthorized senders, most recently seen
+// first
+func (e *engineImpl) Quarantined() ([]QuarantinedEntry, error) {
+	list, err := e.quarantine.List()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]QuarantinedEntry, len(list))
+	for i, q := range list {
+		result[i] = toQuarantinedEntry(q)
+	}
+	return result, nil
+}
+
+// ClearQuarantine forgets quarantined versions. Peers that still hold
+// them will have them quarantined again on their next sync.
+func (e *engineImpl) ClearQuarantine() error {
+	return e.quarantine.Clear()
+}
+
+func toQuarantinedEntry(q quarantine.Entry) QuarantinedEntry {
+	return QuarantinedEntry{
+		EntryID:       q.EntryID,
+		EntryType:     q.EntryType,
+		Timestamp:     q.Timestamp,
+		Reason:        q.Reason,
+		Rejections:    max(q.Rejections, 1),
+		QuarantinedAt: time.Unix(q.QuarantinedAt, 0),
+		LastSeen:      time.Unix(q.LastSeen, 0),
+	}
+}
@@ -0,0 +1,130 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/amaydixit11/acorde/internal/storage"
+)
+
+// StatsActivityDays is how many days of creation activity Stats reports
+const StatsActivityDays = 30
+
+// VaultStats summarizes a vault: what it holds, how it grew, and what it
+// takes on disk
+type VaultStats struct {
+	Entries  EntryStats        `json:"entries"`
+	Activity []AggregateBucket `json:"activity"` // Entries created per day, the last StatsActivityDays days
+	Storage  StorageStats      `json:"storage"`
+	Versions VersionStats      `json:"versions"`
+}
+
+// EntryStats counts entries. Total, ByType and ByTag count live entries,
+// archived ones included; deleted entries are only counted in Deleted.
+type EntryStats struct {
+	Total    int            `json:"total"`
+	Archived int            `json:"archived"`
+	Deleted  int            `json:"deleted"` // Tombstones kept for sync
+	ByType   map[string]int `json:"by_type"`
+	ByTag    map[string]int `json:"by_tag"`
+}
+
+// StorageStats is the disk space a vault takes, in bytes. In-memory
+// vaults only report ContentBytes.
+type StorageStats struct {
+	DatabaseBytes int64            `json:"database_bytes"` // acorde.db with its journal
+	IndexBytes    int64            `json:"index_bytes"`    // On-disk search index
+	BlobBytes     int64            `json:"blob_bytes"`
+	Blobs         int              `json:"blobs"`
+	ContentBytes  map[string]int64 `json:"content_bytes"` // Stored content of live entries, per type
+}
+
+// VersionStats counts stored version history
+type VersionStats struct {
+	Total   int `json:"total"`
+	Entries int `json:"entries"` // Entries with any history
+}
+
+// Stats gathers entry counts, creation activity, storage use and version
+// counts in one pass
+func (e *engineImpl) Stats() (VaultStats, error) {
+	ctx, span := e.startSpan("acorde.Stats")
+	stats, err := e.stats(ctx)
+	endSpan(span, err)
+	return stats, err
+}
+
+func (e *engineImpl) stats(ctx context.Context) (VaultStats, error) {
+	stats := VaultStats{
+		Entries: EntryStats{ByType: make(map[string]int), ByTag: make(map[string]int)},
+		Storage: StorageStats{ContentBytes: make(map[string]int64)},
+	}
+
+	// Content stays sealed: only types, tags and sizes are needed
+	entries, err := e.store.List(storage.ListFilter{Deleted: true, Archived: true})
+	if err != nil {
+		return VaultStats{}, fmt.Errorf("failed to list entries: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.Deleted {
+			stats.Entries.Deleted++
+			continue
+		}
+		stats.Entries.Total++
+		if entry.Archived {
+			stats.Entries.Archived++
+		}
+		stats.Entries.ByType[string(entry.Type)]++
+		for _, tag := range entry.Tags {
+			stats.Entries.ByTag[tag]++
+		}
+		stats.Storage.ContentBytes[string(entry.Type)] += int64(len(entry.Content))
+	}
+
+	today := time.Now()
+	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.Local)
+	stats.Activity, err = e.aggregate(ctx, AggregateFilter{
+		Since: today.AddDate(0, 0, 1-StatsActivityDays),
+		Until: today.AddDate(0, 0, 1),
+	}, BucketDay, Aggregation{Func: AggCount})
+	if err != nil {
+		return VaultStats{}, err
+	}
+
+	if stats.Versions.Total, stats.Versions.Entries, err = e.versions.Totals(); err != nil {
+		return VaultStats{}, fmt.Errorf("failed to count versions: %w", err)
+	}
+
+	if e.dataDir != "" {
+		for _, suffix := range []string{"", "-wal", "-shm", "-journal"} {
+			if info, err := os.Stat(filepath.Join(e.dataDir, "acorde.db"+suffix)); err == nil {
+				stats.Storage.DatabaseBytes += info.Size()
+			}
+		}
+		stats.Storage.IndexBytes = dirSize(filepath.Join(e.dataDir, "search.bleve"))
+	}
+	if e.blobs != nil {
+		if stats.Storage.Blobs, stats.Storage.BlobBytes, err = e.blobs.Usage(); err != nil {
+			return VaultStats{}, err
+		}
+	}
+	return stats, nil
+}
+
+// dirSize returns the size of the files under dir (0 if it is missing)
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
@@ -0,0 +1,43 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/amaydixit11/acorde/internal/hooks"
+)
+
+// ErrNotSyncEvent is returned by PublishSyncEvent for events that are
+// not sync lifecycle events
+var ErrNotSyncEvent = errors.New("not a sync lifecycle event")
+
+// syncHookTypes maps the sync lifecycle events to their hook events
+var syncHookTypes = map[EventType]hooks.EventType{
+	EventPeerConnected:    hooks.EventPeerConnect,
+	EventPeerDisconnected: hooks.EventPeerDisconnect,
+	EventSyncStarted:      hooks.EventSyncStart,
+	EventSyncFinished:     hooks.EventSyncFinish,
+	EventSyncFailed:       hooks.EventSyncFail,
+}
+
+// PublishSyncEvent publishes a sync lifecycle event to subscribers and
+// hooks. Bulk mode doesn't hold them back.
+func (e *engineImpl) PublishSyncEvent(event Event) error {
+	hookType, ok := syncHookTypes[event.Type]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrNotSyncEvent, event.Type)
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	e.deliver(notification{event: event, hook: hooks.HookEvent{
+		Type:      hookType,
+		PeerID:    event.PeerID,
+		Changed:   event.Count,
+		Error:     event.Error,
+		Timestamp: event.Timestamp,
+	}})
+	return nil
+}
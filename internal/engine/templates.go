@@ -0,0 +1,129 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/amaydixit11/acorde/internal/core"
+	"github.com/amaydixit11/acorde/internal/templates"
+)
+
+// ErrTemplateNotFound is returned for a template the vault does not have
+var ErrTemplateNotFound = errors.New("template not found")
+
+// SaveTemplate validates a template and stores it as a config entry, so
+// that it syncs to the vault's other devices. A template of the same name
+// is replaced.
+func (e *engineImpl) SaveTemplate(tmpl templates.Template) (templates.Template, error) {
+	if err := tmpl.Validate(); err != nil {
+		return templates.Template{}, err
+	}
+	if entryType := core.EntryType(tmpl.Type); !entryType.IsValid() || entryType == core.Config {
+		return templates.Template{}, fmt.Errorf("invalid template type %q", tmpl.Type)
+	}
+	content, err := templates.Encode(tmpl)
+	if err != nil {
+		return templates.Template{}, err
+	}
+
+	existing, err := e.GetTemplate(tmpl.Name)
+	switch {
+	case err == nil:
+		if err := e.UpdateEntry(existing.ID, UpdateEntryInput{Content: &content}); err != nil {
+			return templates.Template{}, err
+		}
+		tmpl.ID = existing.ID
+		return tmpl, nil
+	case !errors.Is(err, ErrTemplateNotFound):
+		return templates.Template{}, err
+	}
+
+	entry, err := e.AddEntry(AddEntryInput{
+		Type:    core.Config,
+		Content: content,
+		Tags:    []string{templates.Tag},
+	})
+	if err != nil {
+		return templates.Template{}, err
+	}
+	tmpl.ID = entry.ID
+	return tmpl, nil
+}
+
+// ListTemplates returns the vault's templates by name. If devices saved
+// a template of the same name concurrently, the one created first is
+// used. Config entries that do not hold a valid template are skipped.
+func (e *engineImpl) ListTemplates() ([]templates.Template, error) {
+	entryType, tag := core.Config, templates.Tag
+	entries, err := e.ListEntries(ListFilter{
+		Type: &entryType, Tag: &tag,
+		Sort: SortCreatedAt, Ascending: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var list []templates.Template
+	for _, entry := range entries {
+		tmpl, err := templates.Decode(entry.ID, entry.Content)
+		if err != nil {
+			continue
+		}
+		taken := slices.ContainsFunc(list, func(t templates.Template) bool { return t.Name == tmpl.Name })
+		if !taken {
+			list = append(list, tmpl)
+		}
+	}
+	templates.Sort(list)
+	return list, nil
+}
+
+// GetTemplate returns a template by name
+func (e *engineImpl) GetTemplate(name string) (templates.Template, error) {
+	if err := templates.ValidateName(name); err != nil {
+		return templates.Template{}, err
+	}
+	list, err := e.ListTemplates()
+	if err != nil {
+		return templates.Template{}, err
+	}
+	for _, tmpl := range list {
+		if tmpl.Name == name {
+			return tmpl, nil
+		}
+	}
+	return templates.Template{}, fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+}
+
+// DeleteTemplate deletes a template's config entry
+func (e *engineImpl) DeleteTemplate(name string) error {
+	tmpl, err := e.GetTemplate(name)
+	if err != nil {
+		return err
+	}
+	return e.DeleteEntry(tmpl.ID)
+}
+
+// AddFromTemplate adds an entry rendered from a template with the given
+// variables, and the template's tags followed by tags
+func (e *engineImpl) AddFromTemplate(name string, vars map[string]string, tags []string) (Entry, error) {
+	tmpl, err := e.GetTemplate(name)
+	if err != nil {
+		return Entry{}, err
+	}
+	content, tmplTags, err := tmpl.Render(vars, time.Now())
+	if err != nil {
+		return Entry{}, err
+	}
+	for _, tag := range tags {
+		if !slices.Contains(tmplTags, tag) {
+			tmplTags = append(tmplTags, tag)
+		}
+	}
+	return e.AddEntry(AddEntryInput{
+		Type:    core.EntryType(tmpl.Type),
+		Content: []byte(content),
+		Tags:    tmplTags,
+	})
+}
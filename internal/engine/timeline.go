@@ -0,0 +1,161 @@
+package engine
+
+import (
+	"sort"
+	"time"
+
+	"github.com/amaydixit11/acorde/internal/search"
+	"github.com/amaydixit11/acorde/internal/version"
+	"github.com/google/uuid"
+)
+
+// timelinePage is how many versions Timeline reads from the version
+// store at a time
+const timelinePage = 256
+
+// TimelineAction is what a TimelineEvent did to its entry
+type TimelineAction string
+
+const (
+	TimelineCreate TimelineAction = "create"
+	TimelineUpdate TimelineAction = "update"
+	TimelineDelete TimelineAction = "delete"
+)
+
+// TimelineEvent is one change to an entry of the vault, made on this
+// device or merged from another
+type TimelineEvent struct {
+	Action    TimelineAction `json:"action"`
+	EntryID   uuid.UUID      `json:"entry_id"`
+	Type      EntryType      `json:"type"`
+	Title     string         `json:"title,omitempty"`   // Of the entry as the change left it (the last known, for deletions)
+	Author    string         `json:"author,omitempty"`  // Peer ID of the device that made the change ("" = unknown)
+	Time      time.Time      `json:"time"`              // Wall-clock time, to the second for creates and updates
+	Timestamp uint64         `json:"timestamp"`         // Logical time of the change
+	Version   int64          `json:"version,omitempty"` // Version the create or update saved (see GetVersion)
+}
+
+// TimelineFilter selects the events Timeline returns
+type TimelineFilter struct {
+	Since  time.Time  // At or after (zero = unbounded)
+	Until  time.Time  // Before (zero = unbounded)
+	Type   *EntryType // Only changes to entries of this type
+	Author string     // Only changes made by this peer ID
+}
+
+// Timeline returns up to limit changes (0 = all) to the entries of the
+// vault, most recent first: creates and updates from version history,
+// deletions from tombstones. Changes merged from other devices count at
+// the time they were made on their device. Versions pruned by
+// Config.MaxVersions are no longer listed; deletions recorded before
+// tombstones kept their time have none, and are listed last.
+func (e *engineImpl) Timeline(filter TimelineFilter, limit int) ([]TimelineEvent, error) {
+	if e.isLocked() {
+		return nil, ErrLocked
+	}
+
+	events := e.timelineDeletions(filter)
+
+	// Versions come most recent first, so the first limit that match are
+	// the most recent ones
+	matched := 0
+	for offset := 0; limit <= 0 || matched < limit; offset += timelinePage {
+		versions, err := e.versions.Between(filter.Since, filter.Until, timelinePage, offset)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range versions {
+			if event, ok := e.versionEvent(v, filter); ok {
+				events = append(events, event)
+				matched++
+			}
+		}
+		if len(versions) < timelinePage {
+			break
+		}
+	}
+
+	// Version times are to the second: order within one by logical time
+	sort.SliceStable(events, func(i, j int) bool {
+		ti, tj := events[i].Time.Truncate(time.Second), events[j].Time.Truncate(time.Second)
+		if !ti.Equal(tj) {
+			return ti.After(tj)
+		}
+		return events[i].Timestamp > events[j].Timestamp
+	})
+	if limit > 0 && len(events) > limit {
+		events = events[:limit]
+	}
+	return events, nil
+}
+
+// versionEvent is the create or update that saved v, if filter selects it
+func (e *engineImpl) versionEvent(v version.Version, filter TimelineFilter) (TimelineEvent, bool) {
+	entry, ok := e.replica.GetEntryWithDeleted(v.EntryID)
+	if !ok || !timelineMatch(entry.Type, v.Author, filter) || !e.canRead(v.EntryID) {
+		return TimelineEvent{}, false
+	}
+	action := TimelineUpdate
+	if v.Timestamp == entry.CreatedAt {
+		action = TimelineCreate
+	}
+	return TimelineEvent{
+		Action:    action,
+		EntryID:   v.EntryID,
+		Type:      entry.Type,
+		Title:     e.versionTitle(v),
+		Author:    v.Author,
+		Time:      v.CreatedAt,
+		Timestamp: v.Timestamp,
+		Version:   v.ID,
+	}, true
+}
+
+// timelineDeletions returns the deletions filter selects, titled after
+// the last stored version of their entry
+func (e *engineImpl) timelineDeletions(filter TimelineFilter) []TimelineEvent {
+	var events []TimelineEvent
+	for _, entry := range e.replica.ListAllEntries() {
+		if !entry.Deleted || !timelineMatch(entry.Type, entry.Author, filter) {
+			continue
+		}
+		at := entry.Updated()
+		if (!filter.Since.IsZero() && at.Before(filter.Since)) ||
+			(!filter.Until.IsZero() && !at.Before(filter.Until)) {
+			continue
+		}
+		if !e.canRead(entry.ID) {
+			continue
+		}
+		event := TimelineEvent{
+			Action:    TimelineDelete,
+			EntryID:   entry.ID,
+			Type:      entry.Type,
+			Author:    entry.Author,
+			Time:      at,
+			Timestamp: entry.UpdatedAt,
+		}
+		if last, err := e.versions.GetHistoryPage(entry.ID, 1, 0); err == nil && len(last) == 1 {
+			event.Title = e.versionTitle(last[0])
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// versionTitle returns the title of a version's content ("" if it does
+// not decrypt)
+func (e *engineImpl) versionTitle(v version.Version) string {
+	content, err := e.decrypt(v.EntryID, v.Content)
+	if err != nil {
+		return ""
+	}
+	return search.EntryTitle(content)
+}
+
+// timelineMatch reports whether filter selects changes by author to an
+// entry of entryType
+func timelineMatch(entryType EntryType, author string, filter TimelineFilter) bool {
+	return (filter.Type == nil || *filter.Type == entryType) &&
+		(filter.Author == "" || filter.Author == author)
+}
@@ -0,0 +1,133 @@
+package engine
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/amaydixit11/acorde/internal/core"
+	"github.com/amaydixit11/acorde/internal/storage"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// tracerName is the instrumentation name of engine spans
+const tracerName = "github.com/amaydixit11/acorde"
+
+func newTracer(provider trace.TracerProvider) trace.Tracer {
+	if provider == nil {
+		provider = noop.NewTracerProvider()
+	}
+	return provider.Tracer(tracerName)
+}
+
+// startSpan starts a span for an engine operation. Engine methods take no
+// context, so operations are root spans; storage and merge spans are
+// their children.
+func (e *engineImpl) startSpan(name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return e.startSpanIn(context.Background(), name, attrs...)
+}
+
+// startSpanIn starts a span for an engine operation made as part of the
+// one in ctx (a Bulk call)
+func (e *engineImpl) startSpanIn(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return e.tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan ends a span, recording err
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// storeFor returns the store, with its calls traced as children of the
+// span in ctx when tracing is on
+func (e *engineImpl) storeFor(ctx context.Context) storage.Store {
+	if !trace.SpanFromContext(ctx).IsRecording() {
+		return e.store
+	}
+	return tracedStore{Store: e.store, tracer: e.tracer, ctx: ctx}
+}
+
+// tracedStore traces the calls of a storage.Store as SQLite query spans
+type tracedStore struct {
+	storage.Store
+	tracer trace.Tracer
+	ctx    context.Context
+}
+
+func (s tracedStore) start(op string, attrs ...attribute.KeyValue) trace.Span {
+	attrs = append(attrs, attribute.String("db.system", "sqlite"), attribute.String("db.operation", op))
+	_, span := s.tracer.Start(s.ctx, "sqlite."+op, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	return span
+}
+
+func (s tracedStore) Put(entry core.Entry) error {
+	span := s.start("Put", attribute.String("acorde.entry_id", entry.ID.String()))
+	err := s.Store.Put(entry)
+	endSpan(span, err)
+	return err
+}
+
+func (s tracedStore) PutWith(entry core.Entry, fn func(tx *sql.Tx) error) error {
+	span := s.start("PutWith", attribute.String("acorde.entry_id", entry.ID.String()))
+	err := s.Store.PutWith(entry, fn)
+	endSpan(span, err)
+	return err
+}
+
+func (s tracedStore) Get(id uuid.UUID) (core.Entry, error) {
+	span := s.start("Get", attribute.String("acorde.entry_id", id.String()))
+	entry, err := s.Store.Get(id)
+	endSpan(span, err)
+	return entry, err
+}
+
+func (s tracedStore) List(filter storage.ListFilter) ([]core.Entry, error) {
+	span := s.start("List")
+	entries, err := s.Store.List(filter)
+	span.SetAttributes(attribute.Int("acorde.entries", len(entries)))
+	endSpan(span, err)
+	return entries, err
+}
+
+func (s tracedStore) Count(filter storage.ListFilter) (int, error) {
+	span := s.start("Count")
+	n, err := s.Store.Count(filter)
+	span.SetAttributes(attribute.Int("acorde.entries", n))
+	endSpan(span, err)
+	return n, err
+}
+
+func (s tracedStore) Exists(id uuid.UUID) (bool, error) {
+	span := s.start("Exists", attribute.String("acorde.entry_id", id.String()))
+	found, err := s.Store.Exists(id)
+	endSpan(span, err)
+	return found, err
+}
+
+func (s tracedStore) Delete(id uuid.UUID) error {
+	span := s.start("Delete", attribute.String("acorde.entry_id", id.String()))
+	err := s.Store.Delete(id)
+	endSpan(span, err)
+	return err
+}
+
+func (s tracedStore) ApplyBatch(ops []storage.Operation) error {
+	span := s.start("ApplyBatch", attribute.Int("acorde.operations", len(ops)))
+	err := s.Store.ApplyBatch(ops)
+	endSpan(span, err)
+	return err
+}
+
+func (s tracedStore) Aggregate(filter storage.AggregateFilter) ([]storage.AggregateRow, error) {
+	span := s.start("Aggregate")
+	rows, err := s.Store.Aggregate(filter)
+	endSpan(span, err)
+	return rows, err
+}
@@ -0,0 +1,273 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/amaydixit11/acorde/internal/blob"
+	"github.com/amaydixit11/acorde/internal/core"
+	"github.com/amaydixit11/acorde/internal/hooks"
+	"github.com/amaydixit11/acorde/internal/search"
+	"github.com/amaydixit11/acorde/internal/version"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ErrEntryExists is returned by CopyEntryTo and MoveEntryTo when the
+// destination vault already has the entry (a deleted one is replaced)
+var ErrEntryExists = errors.New("entry already exists in the destination vault")
+
+// CopyEntryTo copies an entry to another vault under the same ID, with its
+// version history, ACL and, for File entries, blobs. Content and history
+// are re-encrypted with dst's vault key. The ACL keeps its readers,
+// writers and public flag, with this device replaced by dst's; per-entry
+// sharing does not carry over (share the copy again). The copy must pass
+// dst's schemas and limits; rules are not applied.
+func (e *engineImpl) CopyEntryTo(id uuid.UUID, dst Engine) (Entry, error) {
+	ctx, span := e.startSpan("acorde.CopyEntry", attribute.String("acorde.entry_id", id.String()))
+	entry, err := e.transferEntry(ctx, id, dst, false)
+	endSpan(span, err)
+	return entry, err
+}
+
+// MoveEntryTo is CopyEntryTo that then deletes the entry and its version
+// history from this vault. If the delete fails, the copy is removed from
+// dst again, so the entry ends up in exactly one vault. Blobs stay in
+// this vault's blob store (other entries may reference them).
+func (e *engineImpl) MoveEntryTo(id uuid.UUID, dst Engine) (Entry, error) {
+	ctx, span := e.startSpan("acorde.MoveEntry", attribute.String("acorde.entry_id", id.String()))
+	entry, err := e.transferEntry(ctx, id, dst, true)
+	endSpan(span, err)
+	return entry, err
+}
+
+// entryTransfer is an entry read for copying to another vault, in
+// plaintext
+type entryTransfer struct {
+	entry   Entry
+	history []version.Version // Oldest first
+	acl     core.ACL
+	from    string // Source device's peer ID
+}
+
+func (e *engineImpl) transferEntry(ctx context.Context, id uuid.UUID, dst Engine, move bool) (Entry, error) {
+	to, ok := dst.(*engineImpl)
+	if !ok {
+		return Entry{}, fmt.Errorf("unsupported destination engine %T", dst)
+	}
+	if to == e || (e.dataDir != "" && sameDir(e.dataDir, to.dataDir)) {
+		return Entry{}, errors.New("source and destination are the same vault")
+	}
+	if move {
+		if !e.canWrite(id) {
+			return Entry{}, fmt.Errorf("permission denied")
+		}
+	}
+
+	t, err := e.readTransfer(id)
+	if err != nil {
+		return Entry{}, err
+	}
+	if err := to.checkTransfer(t); err != nil {
+		return Entry{}, err
+	}
+	if err := e.copyBlobs(to, t.entry); err != nil {
+		return Entry{}, err
+	}
+	entry, err := to.writeTransfer(ctx, t)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	if move {
+		if err := e.deleteEntry(ctx, id); err != nil {
+			to.discardTransfer(ctx, id)
+			return Entry{}, fmt.Errorf("failed to remove entry from source vault: %w", err)
+		}
+		if err := e.versions.DeleteVersions(id); err != nil {
+			return entry, fmt.Errorf("entry moved, but failed to delete its history: %w", err)
+		}
+	}
+	return entry, nil
+}
+
+// readTransfer reads an entry, its decrypted history and its ACL.
+// Versions that no longer decrypt are left out.
+func (e *engineImpl) readTransfer(id uuid.UUID) (entryTransfer, error) {
+	entry, err := e.getEntry(id)
+	if err != nil {
+		return entryTransfer{}, err
+	}
+
+	stored, err := e.versions.GetHistory(id)
+	if err != nil {
+		return entryTransfer{}, fmt.Errorf("failed to read history: %w", err)
+	}
+	history := make([]version.Version, 0, len(stored))
+	for _, v := range slices.Backward(stored) {
+		if v.Content, err = e.decrypt(id, v.Content); err == nil {
+			history = append(history, v)
+		}
+	}
+
+	acl, ok := e.replica.GetACL(id)
+	if !ok {
+		acl = core.ACL{EntryID: id, Owner: e.localID}
+	}
+	return entryTransfer{entry: entry, history: history, acl: acl.Clone(), from: e.localID}, nil
+}
+
+// checkTransfer checks that an entry can be written to this vault
+func (e *engineImpl) checkTransfer(t entryTransfer) error {
+	if current, ok := e.replica.GetEntryWithDeleted(t.entry.ID); ok && !current.Deleted {
+		return ErrEntryExists
+	}
+	if err := e.limits.checkContent(t.entry.Content); err != nil {
+		return err
+	}
+	if err := e.limits.checkTags(t.entry.Tags); err != nil {
+		return err
+	}
+	return e.validateNew(t.entry.Type, t.entry.Content)
+}
+
+// copyBlobs copies the blob and thumbnail of a File entry to the blob
+// store of dst. Blobs missing here are skipped.
+func (e *engineImpl) copyBlobs(dst *engineImpl, entry Entry) error {
+	if entry.Type != core.File || e.dataDir == "" || dst.dataDir == "" {
+		return nil
+	}
+	var fc blob.FileContent
+	if err := json.Unmarshal(entry.Content, &fc); err != nil {
+		return nil // Not a blob reference
+	}
+
+	from, err := blob.NewStore(e.dataDir)
+	if err != nil {
+		return err
+	}
+	to, err := blob.NewStore(dst.dataDir)
+	if err != nil {
+		return err
+	}
+	for _, cid := range []blob.CID{fc.CID, fc.Thumbnail} {
+		if cid == "" || to.Has(cid) || !from.Has(cid) {
+			continue
+		}
+		data, err := from.Get(cid)
+		if err != nil {
+			return fmt.Errorf("failed to read blob %s: %w", cid, err)
+		}
+		if _, err := to.PutWithSubdir(data); err != nil {
+			return fmt.Errorf("failed to copy blob %s: %w", cid, err)
+		}
+	}
+	return nil
+}
+
+// writeTransfer adds an entry read from another vault, encrypting it with
+// this vault's key. Its history keeps its logical times, with the clock
+// advanced past them so later edits order after it.
+func (e *engineImpl) writeTransfer(ctx context.Context, t entryTransfer) (Entry, error) {
+	id := t.entry.ID
+	content, err := e.encryptWithVaultKey(id, t.entry.Content)
+	if err != nil {
+		return Entry{}, fmt.Errorf("encryption failed: %w", err)
+	}
+	history := make([]version.Version, len(t.history))
+	for i, v := range t.history {
+		if v.Content, err = e.encryptWithVaultKey(id, v.Content); err != nil {
+			return Entry{}, fmt.Errorf("encryption failed: %w", err)
+		}
+		history[i] = v
+		e.replica.Witness(v.Timestamp)
+	}
+
+	// Replace what is left of a deleted entry with the ID
+	e.versions.DeleteVersions(id)
+	var created int64
+	if !t.entry.CreatedTime.IsZero() {
+		created = t.entry.CreatedTime.UnixMilli()
+	}
+	coreEntry := e.replica.AddEntryNamespaced(id, t.entry.Namespace, t.entry.Type, content, t.entry.Tags, created, e.schemas.Version(string(t.entry.Type)))
+	e.cache.invalidate(id)
+	if err := e.storeFor(ctx).Put(coreEntry); err != nil {
+		e.discardTransfer(ctx, id)
+		return Entry{}, fmt.Errorf("failed to store entry: %w", err)
+	}
+
+	owner := e.localID
+	if !e.aclOff {
+		acl := t.acl
+		acl.Owner = e.deviceFor(acl.Owner, t.from)
+		acl.Readers = e.devicesFor(acl.Readers, t.from)
+		acl.Writers = e.devicesFor(acl.Writers, t.from)
+		acl.OwnerKey, acl.SealedKey, acl.Keys = nil, nil, nil
+		acl.Timestamp = 0 // Assigned by the replica clock
+		e.replica.SetACL(acl)
+		acl, _ = e.replica.GetACL(id)
+		if err := e.acls.SetACL(acl); err != nil {
+			e.discardTransfer(ctx, id)
+			return Entry{}, fmt.Errorf("failed to store ACL: %w", err)
+		}
+		owner = acl.Owner
+	}
+
+	// The newest version is the entry as copied
+	if n := len(t.history); n == 0 || !bytes.Equal(t.history[n-1].Content, t.entry.Content) || !slices.Equal(t.history[n-1].Tags, t.entry.Tags) {
+		history = append(history, version.Version{EntryID: id, Content: content, Tags: t.entry.Tags, Author: e.localID})
+	}
+	history[len(history)-1].Timestamp = coreEntry.UpdatedAt
+	if err := e.versions.SaveVersions(history); err != nil {
+		e.discardTransfer(ctx, id)
+		return Entry{}, fmt.Errorf("failed to save versions: %w", err)
+	}
+
+	result := toInternalEntry(coreEntry)
+	result.Content = t.entry.Content
+	result.Title = search.EntryTitle(t.entry.Content)
+	result.Owner = owner
+	e.notify(ctx, Event{
+		Type:      EventCreated,
+		EntryID:   id,
+		EntryType: string(result.Type),
+		Timestamp: time.Now(),
+	}, hooks.NewCreateEvent(id, string(result.Type), t.entry.Content, t.entry.Tags))
+	return result, nil
+}
+
+// discardTransfer removes an entry written by writeTransfer that cannot
+// be kept
+func (e *engineImpl) discardTransfer(ctx context.Context, id uuid.UUID) {
+	e.deleteEntry(ctx, id)
+	e.versions.DeleteVersions(id)
+}
+
+// deviceFor returns this device's peer ID in place of from
+func (e *engineImpl) deviceFor(peerID, from string) string {
+	if peerID == from {
+		return e.localID
+	}
+	return peerID
+}
+
+func (e *engineImpl) devicesFor(peerIDs []string, from string) []string {
+	mapped := make([]string, len(peerIDs))
+	for i, peerID := range peerIDs {
+		mapped[i] = e.deviceFor(peerID, from)
+	}
+	return mapped
+}
+
+// sameDir reports whether two paths name the same directory
+func sameDir(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
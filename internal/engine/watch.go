@@ -0,0 +1,158 @@
+package engine
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/amaydixit11/acorde/internal/core"
+	"github.com/amaydixit11/acorde/internal/crdt"
+	"github.com/google/uuid"
+)
+
+// Watch returns a subscription to the changes of one entry, local or
+// merged from a peer
+func (e *engineImpl) Watch(id uuid.UUID) Subscription {
+	return e.events.SubscribeWithOptions(SubscriptionOptions{EntryID: id})
+}
+
+// WatchQuery returns a subscription to the changes of entries matching
+// filter (Limit, Offset and sort order are ignored). An entry that stops
+// matching, e.g. loses the tag or is deleted, gets one last event. The
+// collections below a watched collection are those it had when the watch
+// started.
+func (e *engineImpl) WatchQuery(filter ListFilter) Subscription {
+	q := &querySubscription{
+		sub:     e.events.Subscribe(),
+		ch:      make(chan Event, 100),
+		done:    make(chan struct{}),
+		filter:  filter,
+		replica: e.replica,
+		members: make(map[uuid.UUID]bool),
+		total:   &e.events.dropped,
+	}
+	if scope, err := e.collectionScope(filter); err == nil && scope != nil {
+		q.scope = make(map[uuid.UUID]bool, len(scope))
+		for _, id := range scope {
+			q.scope[id] = true
+		}
+	} else if filter.Collection != nil && *filter.Collection != uuid.Nil {
+		q.scope = map[uuid.UUID]bool{*filter.Collection: true} // Locked: no subcollections
+	}
+	for _, entry := range e.replica.ListAllEntries() {
+		if q.matches(entry) {
+			q.members[entry.ID] = true
+		}
+	}
+	go q.run()
+	return q
+}
+
+// querySubscription filters events by the current state of their entry.
+// Matching reads the replica, so it runs on its own goroutine rather than
+// while the event bus is publishing.
+type querySubscription struct {
+	sub     Subscription
+	ch      chan Event
+	done    chan struct{}
+	once    sync.Once
+	filter  ListFilter
+	replica *crdt.Replica
+	members map[uuid.UUID]bool // Entries matching after the last event
+	scope   map[uuid.UUID]bool // Collections matching entries are in (nil = any)
+	dropped atomic.Uint64      // Events dropped from ch
+	total   *atomic.Uint64     // The event bus's count of dropped events
+}
+
+func (q *querySubscription) Events() <-chan Event {
+	return q.ch
+}
+
+// Dropped counts the events dropped by the event bus and from q's own
+// buffer
+func (q *querySubscription) Dropped() uint64 {
+	return q.sub.Dropped() + q.dropped.Load()
+}
+
+func (q *querySubscription) Err() error {
+	return q.sub.Err()
+}
+
+func (q *querySubscription) Close() {
+	q.once.Do(func() {
+		close(q.done)
+		q.sub.Close()
+	})
+}
+
+func (q *querySubscription) run() {
+	defer close(q.ch)
+	for event := range q.sub.Events() {
+		if event.EntryID == uuid.Nil {
+			continue
+		}
+		entry, ok := q.replica.GetEntryWithDeleted(event.EntryID)
+		matched := ok && q.matches(entry)
+		was := q.members[event.EntryID]
+		if matched {
+			q.members[event.EntryID] = true
+		} else {
+			delete(q.members, event.EntryID)
+		}
+		if !matched && !was {
+			continue
+		}
+
+		select {
+		case q.ch <- event:
+		case <-q.done:
+			return
+		default:
+			// Buffer full, drop event (as the event bus does by default)
+			q.dropped.Add(1)
+			q.total.Add(1)
+		}
+	}
+}
+
+// matches reports whether an entry matches the subscription's filter
+func (q *querySubscription) matches(entry core.Entry) bool {
+	if q.scope != nil && !q.scope[entry.Collection] {
+		return false
+	}
+	return matchesFilter(entry, q.filter)
+}
+
+// matchesFilter reports whether ListEntries with filter would include
+// entry, ignoring Limit, Offset and collections
+func matchesFilter(entry core.Entry, filter ListFilter) bool {
+	if filter.Type != nil && entry.Type != *filter.Type {
+		return false
+	}
+	if filter.Namespace != nil && entry.Namespace != *filter.Namespace {
+		return false
+	}
+	if entry.Deleted && !filter.Deleted {
+		return false
+	}
+	if filter.OnlyArchived && !entry.Archived {
+		return false
+	}
+	if entry.Archived && !filter.Archived && !filter.OnlyArchived {
+		return false
+	}
+	if filter.Since != nil && entry.UpdatedAt < *filter.Since {
+		return false
+	}
+	if filter.Until != nil && entry.UpdatedAt > *filter.Until {
+		return false
+	}
+	if filter.Tag != nil {
+		for _, tag := range entry.Tags {
+			if tag == *filter.Tag {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
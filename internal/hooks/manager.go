@@ -10,6 +10,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/amaydixit11/acorde/internal/schema"
 	"github.com/google/uuid"
 )
 
@@ -21,8 +22,25 @@ const (
 	EventUpdate EventType = "update"
 	EventDelete EventType = "delete"
 	EventSync   EventType = "sync"
+
+	EventArchive   EventType = "archive"
+	EventUnarchive EventType = "unarchive"
+
+	EventLock   EventType = "lock"
+	EventUnlock EventType = "unlock"
+
+	// Sync lifecycle events: a peer connecting or disconnecting, a sync
+	// session with it starting, finishing or failing
+	EventPeerConnect    EventType = "peer_connect"
+	EventPeerDisconnect EventType = "peer_disconnect"
+	EventSyncStart      EventType = "sync_start"
+	EventSyncFinish     EventType = "sync_finish"
+	EventSyncFail       EventType = "sync_fail"
 )
 
+// OriginRemote marks hook events for changes that arrived through sync
+const OriginRemote = "remote"
+
 // HookEvent contains event data passed to callbacks
 type HookEvent struct {
 	Type      EventType `json:"type"`
@@ -32,8 +50,36 @@ type HookEvent struct {
 	Tags      []string  `json:"tags,omitempty"`
 	Timestamp time.Time `json:"timestamp"`
 	PeerID    string    `json:"peer_id,omitempty"` // For sync events
+	Origin    string    `json:"origin,omitempty"`  // "remote" for merged changes
+
+	// Entries changed by the session of an EventSyncFinish event
+	Changed int `json:"changed,omitempty"`
+
+	// Content was masked or stripped (see Redaction)
+	Redacted bool `json:"redacted,omitempty"`
+
+	// A create event replaying an existing entry (see WebhookConfig.Backfill)
+	Backfill bool `json:"backfill,omitempty"`
+
+	// The webhook and last failure of an EventWebhookDisabled event, or
+	// the failure of an EventSyncFail event
+	WebhookID string `json:"webhook_id,omitempty"`
+	Error     string `json:"error,omitempty"`
 }
 
+// Redaction is how much entry content a webhook receives
+type Redaction string
+
+const (
+	// RedactMask masks the sensitive fields of entry types whose schema
+	// marks some (the default)
+	RedactMask Redaction = "mask"
+	// RedactStrip sends no content at all
+	RedactStrip Redaction = "strip"
+	// RedactNone sends content as it is, secrets included
+	RedactNone Redaction = "none"
+)
+
 // Callback is a function called when an event occurs
 type Callback func(event HookEvent)
 
@@ -47,14 +93,42 @@ type WebhookConfig struct {
 	MaxRetries int               `json:"max_retries"` // Retry count (default 3)
 	Timeout    time.Duration     `json:"timeout"`     // Request timeout
 	Async      bool              `json:"async"`       // Non-blocking
+
+	Redact Redaction `json:"redact,omitempty"` // Content redaction (default mask)
+
+	// Backfill replays the existing entries to a webhook listening for
+	// create events, as create events with Backfill set, when it is
+	// registered. BackfillRate limits the replay (events per second,
+	// default 10); unregistering the webhook stops it.
+	Backfill     bool `json:"backfill,omitempty"`
+	BackfillRate int  `json:"backfill_rate,omitempty"`
+
+	// DisableAfter disables the webhook after that many consecutive
+	// events failed to be delivered, retries included (0 = never),
+	// triggering EventWebhookDisabled. Disabled webhooks are sent
+	// nothing until EnableWebhook.
+	DisableAfter int  `json:"disable_after,omitempty"`
+	Disabled     bool `json:"disabled,omitempty"`
 }
 
+// DefaultBackfillRate is the default WebhookConfig.BackfillRate
+const DefaultBackfillRate = 10
+
+// BackfillSource calls yield with a create event for each existing entry
+// until it returns false
+type BackfillSource func(yield func(HookEvent) bool)
+
 // Manager manages hooks and webhooks
 type Manager struct {
 	callbacks map[EventType][]Callback
 	webhooks  map[string]*WebhookConfig
 	client    *http.Client
+	sensitive func(entryType string) []string
+	backfill  BackfillSource
 	mu        sync.RWMutex
+
+	stats   map[*WebhookConfig]*WebhookStats // By registration
+	statsMu sync.Mutex                       // Guards stats; taken after mu
 }
 
 // NewManager creates a new hook manager
@@ -62,6 +136,7 @@ func NewManager() *Manager {
 	return &Manager{
 		callbacks: make(map[EventType][]Callback),
 		webhooks:  make(map[string]*WebhookConfig),
+		stats:     make(map[*WebhookConfig]*WebhookStats),
 		client: &http.Client{
 			Timeout: 10 * time.Second,
 		},
@@ -113,20 +188,126 @@ func (m *Manager) RegisterWebhook(config WebhookConfig) error {
 	if config.Timeout == 0 {
 		config.Timeout = 10 * time.Second
 	}
+	switch config.Redact {
+	case "":
+		config.Redact = RedactMask
+	case RedactMask, RedactStrip, RedactNone:
+	default:
+		return fmt.Errorf("unknown webhook redaction %q (use mask, strip or none)", config.Redact)
+	}
+	if config.BackfillRate < 0 {
+		return fmt.Errorf("webhook backfill rate must not be negative")
+	}
+	if config.BackfillRate == 0 {
+		config.BackfillRate = DefaultBackfillRate
+	}
+	if config.DisableAfter < 0 {
+		return fmt.Errorf("webhook disable_after must not be negative")
+	}
 
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	m.forgetStats(m.webhooks[config.ID])
 	m.webhooks[config.ID] = &config
+	if config.Backfill && m.backfill != nil && config.listens(EventCreate) {
+		go m.runBackfill(&config, m.backfill)
+	}
 	return nil
 }
 
+// SetBackfillSource sets where webhooks registered with Backfill get the
+// existing entries from, normally the engine. Without it nothing is replayed.
+func (m *Manager) SetBackfillSource(source BackfillSource) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.backfill = source
+}
+
+// runBackfill replays existing entries to wh at its backfill rate, until
+// they run out or wh is unregistered or replaced
+func (m *Manager) runBackfill(wh *WebhookConfig, source BackfillSource) {
+	tick := time.NewTicker(time.Second / time.Duration(wh.BackfillRate))
+	defer tick.Stop()
+
+	source(func(event HookEvent) bool {
+		<-tick.C
+		m.mu.RLock()
+		current := m.webhooks[wh.ID] == wh && !wh.Disabled
+		m.mu.RUnlock()
+		if !current {
+			return false
+		}
+		m.executeWebhook(wh, event)
+		return true
+	})
+}
+
+// listens reports whether the webhook is sent events of type t
+func (c *WebhookConfig) listens(t EventType) bool {
+	for _, et := range c.Events {
+		if et == t {
+			return true
+		}
+	}
+	return false
+}
+
+// SetSensitive sets how the sensitive fields of an entry type are found
+// for RedactMask, normally from its schema. Without it nothing is masked.
+func (m *Manager) SetSensitive(sensitive func(entryType string) []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sensitive = sensitive
+}
+
+// Redact returns an event with its content redacted. Callbacks receive
+// events as they are; those that log or forward content can use this.
+func (m *Manager) Redact(event HookEvent, mode Redaction) HookEvent {
+	if len(event.Content) == 0 || mode == RedactNone {
+		return event
+	}
+	if mode == RedactStrip {
+		event.Content = nil
+		event.Redacted = true
+		return event
+	}
+
+	m.mu.RLock()
+	sensitive := m.sensitive
+	m.mu.RUnlock()
+	if sensitive == nil {
+		return event
+	}
+	if fields := sensitive(event.EntryType); len(fields) > 0 {
+		if content := bytes.TrimSpace(event.Content); len(content) > 0 && content[0] == '{' && json.Valid(content) {
+			event.Content = schema.MaskFields(content, fields)
+		} else {
+			event.Content = nil // Not an object, so it cannot be masked
+		}
+		event.Redacted = true
+	}
+	return event
+}
+
 // UnregisterWebhook removes a webhook
 func (m *Manager) UnregisterWebhook(id string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	m.forgetStats(m.webhooks[id])
 	delete(m.webhooks, id)
 }
 
+// forgetStats drops the stats of a webhook being replaced or removed,
+// with m.mu held
+func (m *Manager) forgetStats(wh *WebhookConfig) {
+	if wh == nil {
+		return
+	}
+	m.statsMu.Lock()
+	delete(m.stats, wh)
+	m.statsMu.Unlock()
+}
+
 // ListWebhooks returns all registered webhooks
 func (m *Manager) ListWebhooks() []WebhookConfig {
 	m.mu.RLock()
@@ -145,11 +326,8 @@ func (m *Manager) Trigger(event HookEvent) {
 	callbacks := m.callbacks[event.Type]
 	webhooks := make([]*WebhookConfig, 0)
 	for _, wh := range m.webhooks {
-		for _, et := range wh.Events {
-			if et == event.Type {
-				webhooks = append(webhooks, wh)
-				break
-			}
+		if wh.listens(event.Type) && !wh.Disabled {
+			webhooks = append(webhooks, wh)
 		}
 	}
 	m.mu.RUnlock()
@@ -174,8 +352,16 @@ func (m *Manager) TriggerAsync(event HookEvent) {
 	go m.Trigger(event)
 }
 
+// executeWebhook delivers an event to a webhook, retrying failures, and
+// records the outcome in its stats
 func (m *Manager) executeWebhook(config *WebhookConfig, event HookEvent) error {
-	payload, _ := json.Marshal(event)
+	err := m.deliverWebhook(config, event)
+	m.recordDelivery(config, err)
+	return err
+}
+
+func (m *Manager) deliverWebhook(config *WebhookConfig, event HookEvent) error {
+	payload, _ := json.Marshal(m.Redact(event, config.Redact))
 
 	var lastErr error
 	for attempt := 0; attempt <= config.MaxRetries; attempt++ {
@@ -199,8 +385,10 @@ func (m *Manager) executeWebhook(config *WebhookConfig, event HookEvent) error {
 			req.Header.Set(k, v)
 		}
 
+		started := time.Now()
 		resp, err := m.client.Do(req)
 		cancel()
+		m.recordAttempt(config, time.Since(started))
 
 		if err != nil {
 			lastErr = err
@@ -253,6 +441,32 @@ func NewDeleteEvent(entryID uuid.UUID) HookEvent {
 	}
 }
 
+// NewArchiveEvent creates an archive or unarchive event
+func NewArchiveEvent(entryID uuid.UUID, entryType string, archived bool) HookEvent {
+	eventType := EventUnarchive
+	if archived {
+		eventType = EventArchive
+	}
+	return HookEvent{
+		Type:      eventType,
+		EntryID:   entryID,
+		EntryType: entryType,
+		Timestamp: time.Now(),
+	}
+}
+
+// NewLockEvent creates a vault lock or unlock event
+func NewLockEvent(locked bool) HookEvent {
+	eventType := EventUnlock
+	if locked {
+		eventType = EventLock
+	}
+	return HookEvent{
+		Type:      eventType,
+		Timestamp: time.Now(),
+	}
+}
+
 // NewSyncEvent creates a sync event
 func NewSyncEvent(peerID string) HookEvent {
 	return HookEvent{
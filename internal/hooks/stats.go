@@ -0,0 +1,146 @@
+package hooks
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// EventWebhookDisabled is triggered when a webhook is disabled after
+// WebhookConfig.DisableAfter consecutive failed deliveries. WebhookID
+// names it and Error has the last failure.
+const EventWebhookDisabled EventType = "webhook_disabled"
+
+// WebhookStats describes the deliveries to a webhook since it was
+// registered
+type WebhookStats struct {
+	ID                  string        `json:"id"`
+	Deliveries          int64         `json:"deliveries"`           // Events delivered
+	Failures            int64         `json:"failures"`             // Events not delivered after every retry
+	Attempts            int64         `json:"attempts"`             // Requests sent, retries included
+	ConsecutiveFailures int           `json:"consecutive_failures"` // Failed events since the last delivery
+	LastLatency         time.Duration `json:"last_latency_ns"`      // Of the last request
+	AvgLatency          time.Duration `json:"avg_latency_ns"`       // Of every request
+	LastDelivery        time.Time     `json:"last_delivery,omitzero"`
+	LastError           string        `json:"last_error,omitempty"`
+	LastErrorAt         time.Time     `json:"last_error_at,omitzero"`
+	Disabled            bool          `json:"disabled"`
+
+	totalLatency time.Duration
+}
+
+// Stats returns the delivery stats of every registered webhook, by ID
+func (m *Manager) Stats() []WebhookStats {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stats := make([]WebhookStats, 0, len(m.webhooks))
+	for id, wh := range m.webhooks {
+		stats = append(stats, m.statsOf(id, wh))
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].ID < stats[j].ID })
+	return stats
+}
+
+// WebhookStats returns the delivery stats of one webhook
+func (m *Manager) WebhookStats(id string) (WebhookStats, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	wh, ok := m.webhooks[id]
+	if !ok {
+		return WebhookStats{}, false
+	}
+	return m.statsOf(id, wh), true
+}
+
+// statsOf copies a webhook's stats, with m.mu held
+func (m *Manager) statsOf(id string, wh *WebhookConfig) WebhookStats {
+	m.statsMu.Lock()
+	defer m.statsMu.Unlock()
+
+	var s WebhookStats
+	if tracked := m.stats[wh]; tracked != nil {
+		s = *tracked
+	}
+	s.ID, s.Disabled = id, wh.Disabled
+	return s
+}
+
+// EnableWebhook re-enables a webhook disabled after failed deliveries
+func (m *Manager) EnableWebhook(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	wh, ok := m.webhooks[id]
+	if !ok {
+		return fmt.Errorf("webhook %s not found", id)
+	}
+	wh.Disabled = false
+	m.statsMu.Lock()
+	if s := m.stats[wh]; s != nil {
+		s.ConsecutiveFailures = 0
+	}
+	m.statsMu.Unlock()
+	return nil
+}
+
+// recordAttempt counts a request sent to a webhook
+func (m *Manager) recordAttempt(wh *WebhookConfig, latency time.Duration) {
+	m.statsMu.Lock()
+	defer m.statsMu.Unlock()
+
+	s := m.trackedStats(wh)
+	s.Attempts++
+	s.LastLatency = latency
+	s.totalLatency += latency
+	s.AvgLatency = s.totalLatency / time.Duration(s.Attempts)
+}
+
+// recordDelivery records the outcome of delivering an event to a
+// webhook, disabling it after DisableAfter consecutive failures
+func (m *Manager) recordDelivery(wh *WebhookConfig, err error) {
+	now := time.Now()
+	m.statsMu.Lock()
+	s := m.trackedStats(wh)
+	if err == nil {
+		s.Deliveries++
+		s.ConsecutiveFailures = 0
+		s.LastDelivery = now
+		m.statsMu.Unlock()
+		return
+	}
+	s.Failures++
+	s.ConsecutiveFailures++
+	s.LastError, s.LastErrorAt = err.Error(), now
+	disable := wh.DisableAfter > 0 && s.ConsecutiveFailures >= wh.DisableAfter
+	m.statsMu.Unlock()
+	if !disable {
+		return
+	}
+
+	m.mu.Lock()
+	disabled := !wh.Disabled && m.webhooks[wh.ID] == wh
+	if disabled {
+		wh.Disabled = true
+	}
+	m.mu.Unlock()
+	if disabled {
+		m.Trigger(HookEvent{
+			Type:      EventWebhookDisabled,
+			WebhookID: wh.ID,
+			Error:     err.Error(),
+			Timestamp: now,
+		})
+	}
+}
+
+// trackedStats returns the stats of a webhook, with m.statsMu held
+func (m *Manager) trackedStats(wh *WebhookConfig) *WebhookStats {
+	s := m.stats[wh]
+	if s == nil {
+		s = &WebhookStats{}
+		m.stats[wh] = s
+	}
+	return s
+}
@@ -0,0 +1,59 @@
+package importer
+
+import (
+	"slices"
+	"time"
+)
+
+// Filter selects entries to export or import. Zero fields match
+// everything.
+type Filter struct {
+	Types []string  // Entry types
+	Tags  []string  // Entries with any of these tags
+	Since time.Time // Created at or after
+	Until time.Time // Created before
+}
+
+// IsZero reports whether the filter matches every entry
+func (f Filter) IsZero() bool {
+	return len(f.Types) == 0 && len(f.Tags) == 0 && f.Since.IsZero() && f.Until.IsZero()
+}
+
+// Match reports whether an entry passes the filter. With a date range,
+// entries without a creation time do not.
+func (f Filter) Match(entry ExportEntry) bool {
+	if len(f.Types) > 0 && !slices.Contains(f.Types, entry.Type) {
+		return false
+	}
+	if len(f.Tags) > 0 && !slices.ContainsFunc(entry.Tags, func(tag string) bool {
+		return slices.Contains(f.Tags, tag)
+	}) {
+		return false
+	}
+	if !f.Since.IsZero() || !f.Until.IsZero() {
+		if entry.Created.IsZero() {
+			return false
+		}
+		if !f.Since.IsZero() && entry.Created.Before(f.Since) {
+			return false
+		}
+		if !f.Until.IsZero() && !entry.Created.Before(f.Until) {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply returns the entries that pass the filter
+func (f Filter) Apply(entries []ExportEntry) []ExportEntry {
+	if f.IsZero() {
+		return entries
+	}
+	var matched []ExportEntry
+	for _, entry := range entries {
+		if f.Match(entry) {
+			matched = append(matched, entry)
+		}
+	}
+	return matched
+}
@@ -0,0 +1,57 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFilter(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2026, 1, d, 12, 0, 0, 0, time.UTC) }
+	entries := []ExportEntry{
+		{ID: "a", Type: "note", Tags: []string{"work"}, Created: day(1)},
+		{ID: "b", Type: "log", Tags: []string{"home"}, Created: day(5)},
+		{ID: "c", Type: "note", Created: day(10)},
+		{ID: "d", Type: "note", Tags: []string{"work"}}, // No creation time
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   string
+	}{
+		{"zero", Filter{}, "abcd"},
+		{"type", Filter{Types: []string{"note"}}, "acd"},
+		{"tags", Filter{Tags: []string{"home", "work"}}, "abd"},
+		{"since", Filter{Since: day(5)}, "bc"},
+		{"until exclusive", Filter{Until: day(5)}, "a"},
+		{"combined", Filter{Types: []string{"note"}, Tags: []string{"work"}, Until: day(10)}, "a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got strings.Builder
+			for _, entry := range tt.filter.Apply(entries) {
+				got.WriteString(entry.ID)
+			}
+			if got.String() != tt.want {
+				t.Errorf("got %q, want %q", got.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestImportFromJSONFormats(t *testing.T) {
+	i := &Importer{Filter: Filter{Types: []string{"note"}}}
+	for _, input := range []string{
+		`{"version":"1.0","entries":[{"id":"a","type":"note"},{"id":"b","type":"log"}]}`,
+		`[{"id":"a","type":"note"},{"id":"b","type":"log"}]`,
+	} {
+		entries, err := i.ImportFromJSON(strings.NewReader(input))
+		if err != nil {
+			t.Fatalf("failed to import %s: %v", input, err)
+		}
+		if len(entries) != 1 || entries[0].ID != "a" {
+			t.Errorf("expected only entry a from %s, got %+v", input, entries)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -22,6 +23,10 @@ type ExportEntry struct {
 	CreatedAt uint64    `json:"created_at"`
 	UpdatedAt uint64    `json:"updated_at"`
 	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+
+	// Wall-clock times, when known; date filters use Created
+	Created time.Time `json:"created,omitzero"`
+	Updated time.Time `json:"updated,omitzero"`
 }
 
 // ExportData represents a full vault export
@@ -42,7 +47,9 @@ const (
 )
 
 // Exporter handles exporting entries
-type Exporter struct{}
+type Exporter struct {
+	Filter Filter // Entries to export (zero = all)
+}
 
 // NewExporter creates a new exporter
 func NewExporter() *Exporter {
@@ -51,6 +58,7 @@ func NewExporter() *Exporter {
 
 // ExportToJSON exports entries to JSON format
 func (e *Exporter) ExportToJSON(entries []ExportEntry, w io.Writer) error {
+	entries = e.Filter.Apply(entries)
 	export := ExportData{
 		Version:    "1.0",
 		ExportedAt: time.Now(),
@@ -69,13 +77,13 @@ func (e *Exporter) ExportToMarkdown(entries []ExportEntry, dir string) error {
 		return fmt.Errorf("failed to create directory: %w", err)
 	}
 
-	for _, entry := range entries {
+	for _, entry := range e.Filter.Apply(entries) {
 		if entry.Type != "note" {
 			continue
 		}
 
 		filename := sanitizeFilename(entry.ID) + ".md"
-		path := dir + "/" + filename
+		path := filepath.Join(dir, filename)
 
 		var content strings.Builder
 		
@@ -114,7 +122,7 @@ func (e *Exporter) ExportToCSV(entries []ExportEntry, w io.Writer) error {
 	}
 
 	// Rows
-	for _, entry := range entries {
+	for _, entry := range e.Filter.Apply(entries) {
 		row := []string{
 			entry.ID,
 			entry.Type,
@@ -132,7 +140,9 @@ func (e *Exporter) ExportToCSV(entries []ExportEntry, w io.Writer) error {
 }
 
 // Importer handles importing entries
-type Importer struct{}
+type Importer struct {
+	Filter Filter // Entries to keep from the input (zero = all)
+}
 
 // NewImporter creates a new importer
 func NewImporter() *Importer {
@@ -146,23 +156,30 @@ type ImportResult struct {
 	Skipped      int      `json:"skipped"`
 	Failed       int      `json:"failed"`
 	Errors       []string `json:"errors,omitempty"`
+
+	// Entries already in the vault, and how many of them had tags merged
+	MatchedByID      int `json:"matched_by_id"`
+	MatchedByContent int `json:"matched_by_content"`
+	Merged           int `json:"merged"`
 }
 
-// ImportFromJSON imports entries from JSON
+// ImportFromJSON imports entries from JSON: an export document, or an
+// array of entries
 func (i *Importer) ImportFromJSON(r io.Reader) ([]ExportEntry, error) {
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
 	var data ExportData
-	decoder := json.NewDecoder(r)
-	if err := decoder.Decode(&data); err != nil {
+	if err := json.Unmarshal(raw, &data); err != nil {
 		// Try parsing as array directly
 		var entries []ExportEntry
-		r2 := io.MultiReader(r)
-		decoder2 := json.NewDecoder(r2)
-		if err2 := decoder2.Decode(&entries); err2 != nil {
+		if err2 := json.Unmarshal(raw, &entries); err2 != nil {
 			return nil, fmt.Errorf("invalid JSON format: %w", err)
 		}
-		return entries, nil
+		return i.Filter.Apply(entries), nil
 	}
-	return data.Entries, nil
+	return i.Filter.Apply(data.Entries), nil
 }
 
 // ImportFromCSV imports entries from CSV
@@ -218,7 +235,7 @@ func (i *Importer) ImportFromCSV(r io.Reader) ([]ExportEntry, error) {
 		entries = append(entries, entry)
 	}
 
-	return entries, nil
+	return i.Filter.Apply(entries), nil
 }
 
 // ImportFromMarkdown imports entries from a Markdown file
@@ -0,0 +1,284 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// PasswordFormat is a password manager export format
+type PasswordFormat string
+
+const (
+	PasswordBitwarden PasswordFormat = "bitwarden" // CSV or unencrypted JSON
+	Password1Password PasswordFormat = "1password" // CSV
+	PasswordKeePass   PasswordFormat = "keepass"   // KeePass 2 or KeePassXC CSV
+)
+
+// PasswordFormats lists the supported password manager formats
+var PasswordFormats = []PasswordFormat{PasswordBitwarden, Password1Password, PasswordKeePass}
+
+// Credential is the content of a credential entry (see
+// schema.CredentialSchema)
+type Credential struct {
+	Service    string `json:"service"`
+	Username   string `json:"username"`
+	Password   string `json:"password,omitempty"`
+	URL        string `json:"url,omitempty"`
+	Notes      string `json:"notes,omitempty"`
+	TOTPSecret string `json:"totp_secret,omitempty"`
+}
+
+// passwordColumns maps credential fields to the CSV headers the formats
+// use for them, lowercased
+var passwordColumns = map[string][]string{
+	"service":  {"name", "title", "account"},
+	"username": {"login_username", "username", "login name"},
+	"password": {"login_password", "password"},
+	"url":      {"login_uri", "url", "web site", "website"},
+	"notes":    {"notes", "comments"},
+	"totp":     {"login_totp", "totp", "otpauth"},
+	"folder":   {"folder", "group"},
+	"tags":     {"tags"},
+	"favorite": {"favorite"},
+	"type":     {"type"},
+}
+
+// ImportPasswords reads a password manager export into credential
+// entries, tagged with the format, the item's folder or group, its own
+// tags and "favorite". Only logins are imported: Bitwarden cards, notes
+// and identities are left out. An empty format is detected from the CSV
+// header or JSON shape.
+func (i *Importer) ImportPasswords(r io.Reader, format PasswordFormat) ([]ExportEntry, error) {
+	if format != "" && !slices.Contains(PasswordFormats, format) {
+		return nil, fmt.Errorf("unknown password format %q (use one of %v)", format, PasswordFormats)
+	}
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	raw = bytes.TrimPrefix(raw, []byte("\xef\xbb\xbf")) // UTF-8 BOM
+
+	var entries []ExportEntry
+	if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && trimmed[0] == '{' {
+		if format != "" && format != PasswordBitwarden {
+			return nil, fmt.Errorf("JSON is only supported for %s exports", PasswordBitwarden)
+		}
+		entries, err = importBitwardenJSON(trimmed)
+	} else {
+		entries, err = importPasswordCSV(raw, format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return i.Filter.Apply(entries), nil
+}
+
+func importPasswordCSV(raw []byte, format PasswordFormat) ([]ExportEntry, error) {
+	reader := csv.NewReader(bytes.NewReader(raw))
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	indices := make(map[string]int)
+	for i, col := range header {
+		indices[strings.ToLower(strings.TrimSpace(col))] = i
+	}
+	if format == "" {
+		if format = detectPasswordFormat(indices); format == "" {
+			return nil, fmt.Errorf("unrecognized password export (specify one of %v)", PasswordFormats)
+		}
+	}
+
+	columns := make(map[string]int)
+	for field, names := range passwordColumns {
+		for _, name := range names {
+			if idx, ok := indices[name]; ok {
+				columns[field] = idx
+				break
+			}
+		}
+	}
+	if _, ok := columns["password"]; !ok {
+		return nil, fmt.Errorf("no password column in %s export", format)
+	}
+
+	var entries []ExportEntry
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		get := func(field string) string {
+			if idx, ok := columns[field]; ok && idx < len(record) {
+				return strings.TrimSpace(record[idx])
+			}
+			return ""
+		}
+		if t := get("type"); t != "" && t != "login" {
+			continue
+		}
+
+		line, _ := reader.FieldPos(0)
+		cred := Credential{
+			Service:    get("service"),
+			Username:   get("username"),
+			Password:   get("password"),
+			URL:        get("url"),
+			Notes:      get("notes"),
+			TOTPSecret: get("totp"),
+		}
+		tags := []string{string(format)}
+		if folder := folderTag(get("folder")); folder != "" {
+			tags = append(tags, folder)
+		}
+		for _, tag := range strings.FieldsFunc(get("tags"), func(r rune) bool { return r == ',' || r == ';' }) {
+			tags = append(tags, normalizeTag(tag))
+		}
+		if favorite, _ := strconv.ParseBool(get("favorite")); favorite {
+			tags = append(tags, "favorite")
+		}
+		entries = append(entries, credentialEntry(fmt.Sprintf("line %d", line), cred, tags))
+	}
+	return entries, nil
+}
+
+// detectPasswordFormat guesses a CSV export's format from its header
+func detectPasswordFormat(indices map[string]int) PasswordFormat {
+	has := func(col string) bool {
+		_, ok := indices[col]
+		return ok
+	}
+	switch {
+	case has("login_username"):
+		return PasswordBitwarden
+	case has("otpauth"), has("archived"):
+		return Password1Password
+	case has("group"), has("login name"):
+		return PasswordKeePass
+	}
+	return ""
+}
+
+// bitwardenExport is the unencrypted Bitwarden JSON export
+type bitwardenExport struct {
+	Encrypted bool `json:"encrypted"`
+	Folders   []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"folders"`
+	Items []struct {
+		ID       string `json:"id"`
+		FolderID string `json:"folderId"`
+		Type     int    `json:"type"` // 1 = login
+		Name     string `json:"name"`
+		Notes    string `json:"notes"`
+		Favorite bool   `json:"favorite"`
+		Login    *struct {
+			URIs []struct {
+				URI string `json:"uri"`
+			} `json:"uris"`
+			Username string `json:"username"`
+			Password string `json:"password"`
+			TOTP     string `json:"totp"`
+		} `json:"login"`
+	} `json:"items"`
+}
+
+func importBitwardenJSON(raw []byte) ([]ExportEntry, error) {
+	var export bitwardenExport
+	if err := json.Unmarshal(raw, &export); err != nil {
+		return nil, fmt.Errorf("invalid Bitwarden export: %w", err)
+	}
+	if export.Encrypted {
+		return nil, fmt.Errorf("encrypted Bitwarden exports are not supported; export unencrypted JSON or CSV")
+	}
+	folders := make(map[string]string, len(export.Folders))
+	for _, f := range export.Folders {
+		folders[f.ID] = f.Name
+	}
+
+	var entries []ExportEntry
+	for _, item := range export.Items {
+		if item.Type != 1 || item.Login == nil {
+			continue
+		}
+		cred := Credential{
+			Service:    strings.TrimSpace(item.Name),
+			Username:   strings.TrimSpace(item.Login.Username),
+			Password:   item.Login.Password,
+			Notes:      item.Notes,
+			TOTPSecret: item.Login.TOTP,
+		}
+		if len(item.Login.URIs) > 0 {
+			cred.URL = strings.TrimSpace(item.Login.URIs[0].URI)
+		}
+		tags := []string{string(PasswordBitwarden)}
+		if folder := folderTag(folders[item.FolderID]); folder != "" {
+			tags = append(tags, folder)
+		}
+		if item.Favorite {
+			tags = append(tags, "favorite")
+		}
+		entries = append(entries, credentialEntry(item.ID, cred, tags))
+	}
+	return entries, nil
+}
+
+// credentialEntry builds a credential entry. A URL without a scheme gets
+// https; one that still does not parse moves to the notes. Without a
+// name, the service is the URL's host.
+func credentialEntry(id string, cred Credential, tags []string) ExportEntry {
+	if cred.URL != "" {
+		u, err := url.Parse(cred.URL)
+		if err == nil && u.Scheme == "" {
+			u, err = url.Parse("https://" + cred.URL)
+		}
+		if err != nil || u.Host == "" && u.Opaque == "" {
+			cred.Notes = strings.TrimSpace(cred.Notes + "\nURL: " + cred.URL)
+			cred.URL = ""
+		} else {
+			cred.URL = u.String()
+			if cred.Service == "" {
+				cred.Service = strings.TrimPrefix(u.Hostname(), "www.")
+			}
+		}
+	}
+	content, _ := json.Marshal(cred)
+
+	var unique []string
+	for _, tag := range tags {
+		if tag != "" && !slices.Contains(unique, tag) {
+			unique = append(unique, tag)
+		}
+	}
+	return ExportEntry{ID: id, Type: "credential", Content: string(content), Tags: unique}
+}
+
+// folderTag turns a folder or group path into a tag: its last component,
+// except KeePass's "Root" group
+func folderTag(folder string) string {
+	folder = strings.Trim(folder, "/\\ ")
+	if i := strings.LastIndexAny(folder, "/\\"); i >= 0 {
+		folder = folder[i+1:]
+	}
+	if strings.EqualFold(folder, "root") {
+		return ""
+	}
+	return normalizeTag(folder)
+}
+
+// normalizeTag lowercases a tag and joins its words with dashes
+func normalizeTag(tag string) string {
+	return strings.Join(strings.Fields(strings.ToLower(tag)), "-")
+}
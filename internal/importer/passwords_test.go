@@ -0,0 +1,81 @@
+package importer
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestImportPasswords(t *testing.T) {
+	tests := []struct {
+		name   string
+		format PasswordFormat
+		input  string
+		want   Credential
+		tags   []string
+	}{
+		{
+			name: "bitwarden csv",
+			input: "folder,favorite,type,name,notes,fields,reprompt,login_uri,login_username,login_password,login_totp\n" +
+				"Work,1,login,GitHub,,,0,https://github.com,alice,hunter2,JBSWY3DP\n" +
+				"Work,,note,Secret note,text,,0,,,,\n",
+			want: Credential{Service: "GitHub", Username: "alice", Password: "hunter2", URL: "https://github.com", TOTPSecret: "JBSWY3DP"},
+			tags: []string{"bitwarden", "work", "favorite"},
+		},
+		{
+			name: "bitwarden json",
+			input: `{"encrypted":false,"folders":[{"id":"f1","name":"Social Media"}],"items":[
+				{"id":"i1","folderId":"f1","type":1,"name":"Mastodon","login":{"uris":[{"uri":"mastodon.social"}],"username":"bob","password":"pw"}},
+				{"id":"i2","type":3,"name":"Visa"}]}`,
+			want: Credential{Service: "Mastodon", Username: "bob", Password: "pw", URL: "https://mastodon.social"},
+			tags: []string{"bitwarden", "social-media"},
+		},
+		{
+			name:   "1password csv",
+			format: Password1Password,
+			input: "Title,Url,Username,Password,OTPAuth,Favorite,Archived,Tags,Notes\n" +
+				"Bank,https://bank.example,carol,s3cret,,false,false,\"Finance, Home\",PIN in safe\n",
+			want: Credential{Service: "Bank", Username: "carol", Password: "s3cret", URL: "https://bank.example", Notes: "PIN in safe"},
+			tags: []string{"1password", "finance", "home"},
+		},
+		{
+			name: "keepassxc csv",
+			input: "\"Group\",\"Title\",\"Username\",\"Password\",\"URL\",\"Notes\",\"TOTP\"\n" +
+				"\"Root/Internet\",\"\",\"dave\",\"pw\",\"https://www.example.com/login\",\"\",\"\"\n",
+			want: Credential{Service: "example.com", Username: "dave", Password: "pw", URL: "https://www.example.com/login"},
+			tags: []string{"keepass", "internet"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := NewImporter().ImportPasswords(strings.NewReader(tt.input), tt.format)
+			if err != nil {
+				t.Fatalf("failed to import: %v", err)
+			}
+			if len(entries) != 1 {
+				t.Fatalf("expected only the login, got %+v", entries)
+			}
+			if entries[0].Type != "credential" {
+				t.Errorf("expected type credential, got %s", entries[0].Type)
+			}
+			var got Credential
+			if err := json.Unmarshal([]byte(entries[0].Content), &got); err != nil {
+				t.Fatalf("invalid content %s: %v", entries[0].Content, err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+			if !slices.Equal(entries[0].Tags, tt.tags) {
+				t.Errorf("got tags %v, want %v", entries[0].Tags, tt.tags)
+			}
+		})
+	}
+
+	if _, err := NewImporter().ImportPasswords(strings.NewReader("id,content\n1,x\n"), ""); err == nil {
+		t.Error("expected an error for an unrecognized export")
+	}
+	if _, err := NewImporter().ImportPasswords(strings.NewReader(`{"encrypted":true}`), ""); err == nil {
+		t.Error("expected an error for an encrypted Bitwarden export")
+	}
+}
@@ -0,0 +1,352 @@
+// Package jsonpatch applies JSON Patch (RFC 6902) and JSON Merge Patch
+// (RFC 7396) documents to JSON content.
+package jsonpatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrTestFailed is returned when a "test" operation does not match
+var ErrTestFailed = errors.New("patch test failed")
+
+// Operation is a JSON Patch operation: add, remove, replace, move, copy
+// or test
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`  // For move and copy
+	Value json.RawMessage `json:"value,omitempty"` // For add, replace and test
+}
+
+// Apply applies a JSON Patch to a JSON document. Operations apply in
+// order, and any failure fails the whole patch.
+func Apply(doc []byte, ops []Operation) ([]byte, error) {
+	root, err := decode(doc)
+	if err != nil {
+		return nil, fmt.Errorf("document is not JSON: %w", err)
+	}
+	for i, op := range ops {
+		if root, err = applyOp(root, op); err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %w", i, op.Op, op.Path, err)
+		}
+	}
+	return json.Marshal(root)
+}
+
+// Merge applies a JSON Merge Patch to a JSON document: object members of
+// the patch are merged recursively, null members are removed, and any
+// other patch replaces the document.
+func Merge(doc, patch []byte) ([]byte, error) {
+	p, err := decode(patch)
+	if err != nil {
+		return nil, fmt.Errorf("merge patch is not JSON: %w", err)
+	}
+	var target interface{}
+	if _, isObject := p.(map[string]interface{}); isObject {
+		if target, err = decode(doc); err != nil {
+			return nil, fmt.Errorf("document is not JSON: %w", err)
+		}
+	}
+	return json.Marshal(merge(target, p))
+}
+
+func merge(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{})
+	}
+	for key, value := range p {
+		if value == nil {
+			delete(t, key)
+		} else {
+			t[key] = merge(t[key], value)
+		}
+	}
+	return t
+}
+
+// decode parses JSON, keeping numbers as written
+func decode(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("trailing data after JSON value")
+	}
+	return v, nil
+}
+
+func applyOp(root interface{}, op Operation) (interface{}, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, errors.New("missing value")
+		}
+		value, err := decode(op.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value: %w", err)
+		}
+		switch op.Op {
+		case "add":
+			return add(root, path, value)
+		case "replace":
+			return replace(root, path, value)
+		}
+		current, err := get(root, path)
+		if err != nil {
+			return nil, err
+		}
+		if !equal(current, value) {
+			return nil, ErrTestFailed
+		}
+		return root, nil
+	case "remove":
+		root, _, err := remove(root, path)
+		return root, err
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, fmt.Errorf("from: %w", err)
+		}
+		var value interface{}
+		if op.Op == "move" {
+			if len(from) < len(path) && isPrefix(from, path) {
+				return nil, errors.New("cannot move a value into itself")
+			}
+			if root, value, err = remove(root, from); err != nil {
+				return nil, fmt.Errorf("from: %w", err)
+			}
+		} else {
+			if value, err = get(root, from); err != nil {
+				return nil, fmt.Errorf("from: %w", err)
+			}
+			if value, err = clone(value); err != nil {
+				return nil, err
+			}
+		}
+		return add(root, path, value)
+	}
+	return nil, fmt.Errorf("unknown op %q", op.Op)
+}
+
+// parsePointer splits a JSON Pointer (RFC 6901) into unescaped tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid path %q: must start with /", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func isPrefix(prefix, path []string) bool {
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func get(node interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			value, ok := n[token]
+			if !ok {
+				return nil, fmt.Errorf("no member %q", token)
+			}
+			node = value
+		case []interface{}:
+			i, err := index(token, len(n)-1)
+			if err != nil {
+				return nil, err
+			}
+			node = n[i]
+		default:
+			return nil, fmt.Errorf("cannot index %T with %q", node, token)
+		}
+	}
+	return node, nil
+}
+
+// index parses an array index token, between 0 and max
+func index(token string, max int) (int, error) {
+	if token == "" || len(token) > 1 && token[0] == '0' {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	if i > max {
+		return 0, fmt.Errorf("array index %d out of range", i)
+	}
+	return i, nil
+}
+
+// update replaces the value at the parent of path with what fn returns
+// for it and the last token, rebuilding the containers above it
+func update(node interface{}, path []string, fn func(parent interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return fn(node, path[0])
+	}
+	child, err := get(node, path[:1])
+	if err != nil {
+		return nil, err
+	}
+	child, err = update(child, path[1:], fn)
+	if err != nil {
+		return nil, err
+	}
+	switch n := node.(type) {
+	case map[string]interface{}:
+		n[path[0]] = child
+	case []interface{}:
+		i, _ := strconv.Atoi(path[0]) // Checked by get
+		n[i] = child
+	}
+	return node, nil
+}
+
+func add(root interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return update(root, path, func(parent interface{}, token string) (interface{}, error) {
+		switch p := parent.(type) {
+		case map[string]interface{}:
+			p[token] = value
+			return p, nil
+		case []interface{}:
+			if token == "-" {
+				return append(p, value), nil
+			}
+			i, err := index(token, len(p))
+			if err != nil {
+				return nil, err
+			}
+			p = append(p, nil)
+			copy(p[i+1:], p[i:])
+			p[i] = value
+			return p, nil
+		}
+		return nil, fmt.Errorf("cannot add %q to %T", token, parent)
+	})
+}
+
+func replace(root interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	if _, err := get(root, path); err != nil {
+		return nil, err
+	}
+	return update(root, path, func(parent interface{}, token string) (interface{}, error) {
+		switch p := parent.(type) {
+		case map[string]interface{}:
+			p[token] = value
+		case []interface{}:
+			i, _ := strconv.Atoi(token) // Checked by get
+			p[i] = value
+		}
+		return parent, nil
+	})
+}
+
+// remove removes the value at path, returning the new root and the value
+func remove(root interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil, errors.New("cannot remove the whole document")
+	}
+	var removed interface{}
+	root, err := update(root, path, func(parent interface{}, token string) (interface{}, error) {
+		switch p := parent.(type) {
+		case map[string]interface{}:
+			value, ok := p[token]
+			if !ok {
+				return nil, fmt.Errorf("no member %q", token)
+			}
+			removed = value
+			delete(p, token)
+			return p, nil
+		case []interface{}:
+			i, err := index(token, len(p)-1)
+			if err != nil {
+				return nil, err
+			}
+			removed = p[i]
+			return append(p[:i], p[i+1:]...), nil
+		}
+		return nil, fmt.Errorf("cannot remove %q from %T", token, parent)
+	})
+	return root, removed, err
+}
+
+func clone(value interface{}) (interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return decode(data)
+}
+
+// equal compares decoded JSON values, numbers by value
+func equal(a, b interface{}) bool {
+	switch a := a.(type) {
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for key, value := range a {
+			other, ok := b[key]
+			if !ok || !equal(value, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		x, errA := a.Float64()
+		y, errB := b.Float64()
+		return errA == nil && errB == nil && x == y || a == b
+	}
+	return a == b
+}
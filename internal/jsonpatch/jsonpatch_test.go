@@ -0,0 +1,102 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string // "" = error
+	}{
+		{"add member", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`},
+		{"add array element", `{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`},
+		{"append", `{"foo":[1]}`, `[{"op":"add","path":"/foo/-","value":2}]`, `{"foo":[1,2]}`},
+		{"remove", `{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`},
+		{"remove array element", `{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`},
+		{"replace", `{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`},
+		{"replace root", `{"a":1}`, `[{"op":"replace","path":"","value":[1]}]`, `[1]`},
+		{"move", `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`, `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`},
+		{"copy", `{"a":{"b":[1]}}`, `[{"op":"copy","from":"/a","path":"/c"},{"op":"add","path":"/c/b/-","value":2}]`, `{"a":{"b":[1]},"c":{"b":[1,2]}}`},
+		{"escaped path", `{"a/b":{"m~n":1}}`, `[{"op":"replace","path":"/a~1b/m~0n","value":2}]`, `{"a/b":{"m~n":2}}`},
+		{"test passes", `{"n":1.0,"s":"x"}`, `[{"op":"test","path":"/n","value":1},{"op":"test","path":"/s","value":"x"}]`, `{"n":1.0,"s":"x"}`},
+		{"large number kept", `{"id":12345678901234567890}`, `[{"op":"add","path":"/x","value":true}]`, `{"id":12345678901234567890,"x":true}`},
+		{"missing member", `{"a":1}`, `[{"op":"replace","path":"/b","value":2}]`, ""},
+		{"remove missing", `{"a":1}`, `[{"op":"remove","path":"/b"}]`, ""},
+		{"index out of range", `{"a":[1]}`, `[{"op":"add","path":"/a/2","value":2}]`, ""},
+		{"leading zero", `{"a":[1,2]}`, `[{"op":"remove","path":"/a/01"}]`, ""},
+		{"move into itself", `{"a":{"b":1}}`, `[{"op":"move","from":"/a","path":"/a/c"}]`, ""},
+		{"unknown op", `{}`, `[{"op":"frob","path":"/a"}]`, ""},
+		{"missing value", `{}`, `[{"op":"add","path":"/a"}]`, ""},
+		{"relative path", `{}`, `[{"op":"add","path":"a","value":1}]`, ""},
+		{"not json", `plain text`, `[{"op":"add","path":"/a","value":1}]`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ops []Operation
+			if err := json.Unmarshal([]byte(tt.patch), &ops); err != nil {
+				t.Fatalf("invalid test patch: %v", err)
+			}
+			got, err := Apply([]byte(tt.doc), ops)
+			if tt.want == "" {
+				if err == nil {
+					t.Errorf("expected an error, got %s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to apply: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyTestFailure(t *testing.T) {
+	doc := []byte(`{"a":1}`)
+	_, err := Apply(doc, []Operation{
+		{Op: "replace", Path: "/a", Value: json.RawMessage(`2`)},
+		{Op: "test", Path: "/a", Value: json.RawMessage(`1`)},
+	})
+	if !errors.Is(err, ErrTestFailed) {
+		t.Errorf("expected ErrTestFailed, got %v", err)
+	}
+	if string(doc) != `{"a":1}` {
+		t.Errorf("expected the document untouched, got %s", doc)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		doc, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":{"b":"c","d":1}}`, `{"a":{"b":null,"e":[1]}}`, `{"a":{"d":1,"e":[1]}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a"]`, `{"a":"b"}`, `{"a":"b"}`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`not json`, `["replaced"]`, `["replaced"]`},
+	}
+	for _, tt := range tests {
+		got, err := Merge([]byte(tt.doc), []byte(tt.patch))
+		if err != nil {
+			t.Errorf("Merge(%s, %s) failed: %v", tt.doc, tt.patch, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("Merge(%s, %s) = %s, want %s", tt.doc, tt.patch, got, tt.want)
+		}
+	}
+
+	if _, err := Merge([]byte(`not json`), []byte(`{"a":1}`)); err == nil {
+		t.Error("expected an error merging an object into non-JSON content")
+	}
+}
@@ -0,0 +1,195 @@
+package markdown
+
+import (
+	"html"
+	"strings"
+)
+
+// language describes the syntax highlighted in a fenced code block
+type language struct {
+	keywords      map[string]bool
+	lineComments  []string
+	blockComment  [2]string // Opening and closing delimiters, if any
+	quotes        string    // Characters that delimit strings
+	caseFold      bool      // Keywords match in any case
+	multilineStrs string    // Quotes whose strings may span lines
+}
+
+func words(s string) map[string]bool {
+	m := make(map[string]bool)
+	for _, w := range strings.Fields(s) {
+		m[w] = true
+	}
+	return m
+}
+
+var (
+	cLike = language{
+		lineComments: []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       `"'`,
+	}
+
+	languages = map[string]language{
+		"go":         withKeywords(cLike, "break case chan const continue default defer else fallthrough for func go goto if import interface map package range return select struct switch type var nil true false iota", "`"),
+		"javascript": withKeywords(cLike, "async await break case catch class const continue debugger default delete do else export extends finally for function if import in instanceof let new of return super switch this throw try typeof var void while with yield null undefined true false", "`"),
+		"typescript": withKeywords(cLike, "abstract async await break case catch class const continue declare default delete do else enum export extends finally for function if implements import in instanceof interface let namespace new of private protected public readonly return super switch this throw try type typeof var void while yield null undefined true false", "`"),
+		// Not ' in Rust, which also marks lifetimes
+		"rust": func() language {
+			l := withKeywords(cLike, "as async await break const continue crate dyn else enum extern false fn for if impl in let loop match mod move mut pub ref return self Self static struct super trait true type unsafe use where while", "")
+			l.quotes = `"`
+			return l
+		}(),
+		"java": withKeywords(cLike, "abstract boolean break byte case catch char class continue default do double else enum extends final finally float for if implements import instanceof int interface long new null package private protected public return short static super switch this throw throws true false try void while", ""),
+		"c":    withKeywords(cLike, "auto break case char const continue default do double else enum extern float for goto if int long register return short signed sizeof static struct switch typedef union unsigned void volatile while NULL", ""),
+		"python": {
+			keywords:     words("and as assert async await break class continue def del elif else except False finally for from global if import in is lambda None nonlocal not or pass raise return True try while with yield self"),
+			lineComments: []string{"#"},
+			quotes:       `"'`,
+		},
+		"sh": {
+			keywords:     words("if then else elif fi for while until do done case esac function in return local export echo exit"),
+			lineComments: []string{"#"},
+			quotes:       `"'`,
+		},
+		"sql": {
+			keywords:     words("select from where and or not insert into values update set delete create table index drop alter join left right inner outer on group by order having limit offset as null is in like distinct union primary key"),
+			lineComments: []string{"--"},
+			blockComment: [2]string{"/*", "*/"},
+			quotes:       `'"`,
+			caseFold:     true,
+		},
+		"json": {
+			keywords: words("true false null"),
+			quotes:   `"`,
+		},
+	}
+
+	languageAliases = map[string]string{
+		"golang": "go", "js": "javascript", "jsx": "javascript", "ts": "typescript", "tsx": "typescript",
+		"rs": "rust", "cpp": "c", "c++": "c", "h": "c", "py": "python", "bash": "sh", "shell": "sh",
+		"zsh": "sh", "console": "sh",
+	}
+)
+
+func withKeywords(base language, keywords, extraQuotes string) language {
+	base.keywords = words(keywords)
+	base.quotes += extraQuotes
+	base.multilineStrs = extraQuotes
+	return base
+}
+
+// lookupLanguage returns the syntax of a fenced code block's language
+func lookupLanguage(name string) (language, bool) {
+	name = strings.ToLower(name)
+	if alias, ok := languageAliases[name]; ok {
+		name = alias
+	}
+	lang, ok := languages[name]
+	return lang, ok
+}
+
+// highlight escapes code, wrapping keywords, strings, comments and
+// numbers in <span class="hl-kw|hl-str|hl-com|hl-num">
+func highlight(code string, lang language) string {
+	var b strings.Builder
+	span := func(class, text string) {
+		b.WriteString(`<span class="hl-` + class + `">` + html.EscapeString(text) + "</span>")
+	}
+
+	for i := 0; i < len(code); {
+		rest := code[i:]
+		if n := lang.commentLen(rest); n > 0 {
+			span("com", rest[:n])
+			i += n
+			continue
+		}
+
+		c := code[i]
+		switch {
+		case strings.IndexByte(lang.quotes, c) >= 0:
+			n := stringLen(rest, strings.IndexByte(lang.multilineStrs, c) >= 0)
+			span("str", rest[:n])
+			i += n
+
+		case isDigit(c) && (i == 0 || !isIdent(code[i-1])):
+			n := 1
+			for n < len(rest) && (isIdent(rest[n]) || rest[n] == '.') {
+				n++
+			}
+			span("num", rest[:n])
+			i += n
+
+		case isIdent(c):
+			n := 1
+			for n < len(rest) && isIdent(rest[n]) {
+				n++
+			}
+			word := rest[:n]
+			key := word
+			if lang.caseFold {
+				key = strings.ToLower(word)
+			}
+			if lang.keywords[key] && (i == 0 || !isIdent(code[i-1])) {
+				span("kw", word)
+			} else {
+				b.WriteString(html.EscapeString(word))
+			}
+			i += n
+
+		default:
+			b.WriteString(html.EscapeString(rest[:1]))
+			i++
+		}
+	}
+	return b.String()
+}
+
+// commentLen returns the length of the comment at the start of s, or 0
+func (l language) commentLen(s string) int {
+	for _, prefix := range l.lineComments {
+		if strings.HasPrefix(s, prefix) {
+			if end := strings.IndexByte(s, '\n'); end >= 0 {
+				return end
+			}
+			return len(s)
+		}
+	}
+	if open, shut := l.blockComment[0], l.blockComment[1]; open != "" && strings.HasPrefix(s, open) {
+		if end := strings.Index(s[len(open):], shut); end >= 0 {
+			return len(open) + end + len(shut)
+		}
+		return len(s)
+	}
+	return 0
+}
+
+// stringLen returns the length of the string literal at the start of s,
+// which ends at the closing quote, or the end of the line unless it may
+// span lines
+func stringLen(s string, multiline bool) int {
+	quote := s[0]
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if quote != '`' {
+				i++
+			}
+		case quote:
+			return i + 1
+		case '\n':
+			if !multiline {
+				return i
+			}
+		}
+	}
+	return len(s)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdent(c byte) bool {
+	return c == '_' || isDigit(c) || (c|0x20 >= 'a' && c|0x20 <= 'z')
+}
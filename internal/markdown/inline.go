@@ -0,0 +1,321 @@
+package markdown
+
+import (
+	"html"
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// inline renders the inline content of a block
+func (r *renderer) inline(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && isPunct(s[i+1]):
+			b.WriteString(html.EscapeString(s[i+1 : i+2]))
+			i += 2
+			continue
+
+		case c == '\\' && i+1 < len(s) && s[i+1] == '\n':
+			b.WriteString("<br>\n")
+			i += 2
+			continue
+
+		case c == '`':
+			if n, ok := r.codeSpan(&b, s[i:]); ok {
+				i += n
+				continue
+			}
+			run := len(s[i:]) - len(strings.TrimLeft(s[i:], "`"))
+			b.WriteString(s[i : i+run])
+			i += run
+			continue
+
+		case c == '[' && strings.HasPrefix(s[i:], "[["):
+			if n, ok := r.wikiLink(&b, s[i:]); ok {
+				i += n
+				continue
+			}
+
+		case c == '[' || (c == '!' && strings.HasPrefix(s[i:], "![")):
+			if n, ok := r.link(&b, s[i:]); ok {
+				i += n
+				continue
+			}
+
+		case c == '<':
+			if n, ok := autolink(&b, s[i:]); ok {
+				i += n
+				continue
+			}
+
+		case c == '*' || c == '_' || c == '~':
+			if n, ok := r.emphasis(&b, s, i); ok {
+				i += n
+				continue
+			}
+			run := len(s[i:]) - len(strings.TrimLeft(s[i:], string(c)))
+			b.WriteString(s[i : i+run])
+			i += run
+			continue
+
+		case c == '\n':
+			// Two trailing spaces make a hard line break
+			text := b.String()
+			if strings.HasSuffix(text, "  ") {
+				trimmed := strings.TrimRight(text, " ")
+				b.Reset()
+				b.WriteString(trimmed + "<br>")
+			}
+			b.WriteByte('\n')
+			i++
+			continue
+		}
+
+		_, size := utf8.DecodeRuneInString(s[i:])
+		b.WriteString(html.EscapeString(s[i : i+size]))
+		i += size
+	}
+	return b.String()
+}
+
+// codeSpan renders a code span at the start of s, returning its length
+func (r *renderer) codeSpan(b *strings.Builder, s string) (int, bool) {
+	ticks := len(s) - len(strings.TrimLeft(s, "`"))
+	rest := s[ticks:]
+	for off := 0; off < len(rest); {
+		j := strings.Index(rest[off:], s[:ticks])
+		if j < 0 {
+			return 0, false
+		}
+		j += off
+		end := j + ticks
+		if end < len(rest) && rest[end] == '`' {
+			// A longer run of backticks does not close the span
+			off = end + len(rest[end:]) - len(strings.TrimLeft(rest[end:], "`"))
+			continue
+		}
+		code := strings.ReplaceAll(rest[:j], "\n", " ")
+		if len(code) > 2 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.Trim(code, " ") != "" {
+			code = code[1 : len(code)-1]
+		}
+		b.WriteString("<code>" + html.EscapeString(code) + "</code>")
+		return ticks + end, true
+	}
+	return 0, false
+}
+
+// wikiLink renders a [[target]] or [[target|label]] link at the start of
+// s, returning its length
+func (r *renderer) wikiLink(b *strings.Builder, s string) (int, bool) {
+	target, label, n, ok := parseWikiLink(s)
+	if !ok {
+		return 0, false
+	}
+
+	if r.opts.WikiLink != nil {
+		if href, ok := r.opts.WikiLink(target); ok {
+			b.WriteString(`<a class="wikilink" href="` + html.EscapeString(href) + `">` + html.EscapeString(label) + "</a>")
+			return n, true
+		}
+	}
+	b.WriteString(`<span class="wikilink missing">` + html.EscapeString(label) + "</span>")
+	return n, true
+}
+
+// link renders a [text](url "title") link or ![alt](src "title") image
+// at the start of s, returning its length
+func (r *renderer) link(b *strings.Builder, s string) (int, bool) {
+	image := s[0] == '!'
+	start := 1
+	if image {
+		start = 2
+	}
+
+	// Find the closing bracket, allowing nested brackets
+	depth, closing := 1, -1
+	for i := start; i < len(s) && closing < 0; i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '[':
+			depth++
+		case ']':
+			if depth--; depth == 0 {
+				closing = i
+			}
+		}
+	}
+	if closing < 0 || closing+1 >= len(s) || s[closing+1] != '(' {
+		return 0, false
+	}
+	// Find the closing parenthesis, allowing balanced ones in the URL
+	depth, end := 0, -1
+	for i := closing + 1; i < len(s) && end < 0; i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				end = i
+			}
+		case '\n':
+			return 0, false
+		}
+	}
+	if end < 0 {
+		return 0, false
+	}
+
+	dest, title := parseDestination(s[closing+2 : end])
+	text := s[start:closing]
+	href := html.EscapeString(safeURL(dest))
+	titleAttr := ""
+	if title != "" {
+		titleAttr = ` title="` + html.EscapeString(title) + `"`
+	}
+
+	if image {
+		b.WriteString(`<img src="` + href + `" alt="` + html.EscapeString(plainText(text)) + `"` + titleAttr + ">")
+	} else {
+		b.WriteString(`<a href="` + href + `"` + titleAttr + ">" + r.inline(text) + "</a>")
+	}
+	return end + 1, true
+}
+
+// parseDestination splits the inside of a link's parentheses into its
+// destination and optional quoted title
+func parseDestination(s string) (dest, title string) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "<") {
+		if end := strings.IndexByte(s, '>'); end > 0 {
+			dest, s = s[1:end], strings.TrimSpace(s[end+1:])
+		}
+	} else {
+		dest, s, _ = strings.Cut(s, " ")
+		s = strings.TrimSpace(s)
+	}
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		title = s[1 : len(s)-1]
+	}
+	return dest, title
+}
+
+// autolink renders a <https://...> or <user@example.com> link at the
+// start of s, returning its length
+func autolink(b *strings.Builder, s string) (int, bool) {
+	end := strings.IndexByte(s, '>')
+	if end < 0 {
+		return 0, false
+	}
+	target := s[1:end]
+	if target == "" || strings.ContainsAny(target, " <\n") {
+		return 0, false
+	}
+	href := target
+	switch {
+	case strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://"):
+	case strings.Contains(target, "@") && !strings.Contains(target, ":"):
+		href = "mailto:" + target
+	default:
+		return 0, false
+	}
+	b.WriteString(`<a href="` + html.EscapeString(safeURL(href)) + `">` + html.EscapeString(target) + "</a>")
+	return end + 1, true
+}
+
+// emphasis renders *em*, **strong**, ***both*** or ~~strikethrough~~
+// opening at s[i], returning its length
+func (r *renderer) emphasis(b *strings.Builder, s string, i int) (int, bool) {
+	c := s[i]
+	run := len(s[i:]) - len(strings.TrimLeft(s[i:], string(c)))
+	if run > 3 || (c == '~' && run != 2) {
+		return 0, false
+	}
+	delim := s[i : i+run]
+
+	// The opening run must be followed by non-space text, and _ does not
+	// open inside words
+	if i+run >= len(s) || isSpace(s[i+run]) {
+		return 0, false
+	}
+	if c == '_' && i > 0 && isAlnum(s[i-1]) {
+		return 0, false
+	}
+
+	for off := i + run; off < len(s); {
+		j := strings.Index(s[off:], delim)
+		if j < 0 {
+			return 0, false
+		}
+		j += off
+		after := j + run
+		if isSpace(s[j-1]) || (after < len(s) && s[after] == c) ||
+			(c == '_' && after < len(s) && isAlnum(s[after])) || j == i+run {
+			off = j + 1
+			continue
+		}
+		if strings.Count(s[i+run:j], "`")%2 != 0 {
+			// The closing run is inside a code span
+			off = j + 1
+			continue
+		}
+
+		inner := r.inline(s[i+run : j])
+		switch {
+		case c == '~':
+			b.WriteString("<del>" + inner + "</del>")
+		case run == 1:
+			b.WriteString("<em>" + inner + "</em>")
+		case run == 2:
+			b.WriteString("<strong>" + inner + "</strong>")
+		default:
+			b.WriteString("<em><strong>" + inner + "</strong></em>")
+		}
+		return after - i, true
+	}
+	return 0, false
+}
+
+// safeSchemes are the URL schemes links may use
+var safeSchemes = map[string]bool{"http": true, "https": true, "mailto": true}
+
+// safeURL returns u, or "#" if it has a scheme links may not use (such
+// as javascript:)
+func safeURL(u string) string {
+	parsed, err := url.Parse(strings.TrimSpace(u))
+	if err != nil {
+		return "#"
+	}
+	if parsed.Scheme != "" && !safeSchemes[strings.ToLower(parsed.Scheme)] {
+		return "#"
+	}
+	return u
+}
+
+// plainText strips Markdown punctuation from image alt text
+func plainText(s string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune("*_`[]~", r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+func isPunct(c byte) bool {
+	return c < utf8.RuneSelf && unicode.IsPunct(rune(c)) || strings.IndexByte("$+<=>^`|~", c) >= 0
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\n'
+}
+
+func isAlnum(c byte) bool {
+	return c < utf8.RuneSelf && (unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c)))
+}
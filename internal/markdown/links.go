@@ -0,0 +1,63 @@
+package markdown
+
+import "strings"
+
+// WikiLinks returns the targets of the [[target]] and [[target|label]]
+// links in src, outside fenced code blocks, in order and without
+// duplicates
+func WikiLinks(src []byte) []string {
+	text := string(src)
+	if !strings.Contains(text, "[[") {
+		return nil
+	}
+
+	var targets []string
+	seen := make(map[string]bool)
+	fence := ""
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+				fence = ""
+			}
+			continue
+		}
+		if m := fenceRe.FindStringSubmatch(line); m != nil {
+			fence = m[2]
+			continue
+		}
+
+		for i := strings.Index(line, "[["); i >= 0; i = strings.Index(line, "[[") {
+			target, _, n, ok := parseWikiLink(line[i:])
+			if !ok {
+				line = line[i+2:]
+				continue
+			}
+			if !seen[target] {
+				seen[target] = true
+				targets = append(targets, target)
+			}
+			line = line[i+n:]
+		}
+	}
+	return targets
+}
+
+// parseWikiLink parses a [[target]] or [[target|label]] link at the
+// start of s, returning its target, its label (the target if none) and
+// its length
+func parseWikiLink(s string) (target, label string, n int, ok bool) {
+	end := strings.Index(s, "]]")
+	if end < 0 || strings.ContainsAny(s[2:end], "[]\n") {
+		return "", "", 0, false
+	}
+	target, label, _ = strings.Cut(s[2:end], "|")
+	target = strings.TrimSpace(target)
+	if label = strings.TrimSpace(label); label == "" {
+		label = target
+	}
+	if target == "" {
+		return "", "", 0, false
+	}
+	return target, label, end + 2, true
+}
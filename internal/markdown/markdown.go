@@ -0,0 +1,277 @@
+// Package markdown renders the Markdown of note entries to HTML.
+//
+// It covers the common subset of CommonMark (headings, paragraphs,
+// emphasis, code, lists and task lists, blockquotes, links, images and
+// rules) plus strikethrough, [[wiki links]] and syntax highlighting. Raw HTML is escaped and
+// links with unsafe schemes are dropped, so the output is safe to embed
+// in a page without further sanitizing.
+package markdown
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// Options configures Render
+type Options struct {
+	// WikiLink resolves the target of a [[target]] or [[target|label]]
+	// link to an href. Unresolved links are rendered as
+	// <span class="wikilink missing">.
+	// Optional (every wiki link is unresolved)
+	WikiLink func(target string) (href string, ok bool)
+
+	// Highlight marks up the syntax of fenced code blocks in known
+	// languages with <span class="hl-kw|hl-str|hl-com|hl-num">
+	Highlight bool
+}
+
+// Render converts Markdown to HTML
+func Render(src []byte, opts Options) string {
+	text := strings.ReplaceAll(string(src), "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\t", "    ")
+	r := renderer{opts: opts}
+	var b strings.Builder
+	r.blocks(&b, strings.Split(text, "\n"), false)
+	return b.String()
+}
+
+type renderer struct {
+	opts Options
+}
+
+var (
+	headingRe = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	fenceRe   = regexp.MustCompile("^( {0,3})(`{3,}|~{3,})[ \t]*([^`\\s]*)")
+	ruleRe    = regexp.MustCompile(`^ {0,3}(?:(?:-[ \t]*){3,}|(?:\*[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	quoteRe   = regexp.MustCompile(`^ {0,3}> ?`)
+	itemRe    = regexp.MustCompile(`^( {0,3})([-*+]|\d{1,9}[.)])( +|$)`)
+	taskRe    = regexp.MustCompile(`^\[([ xX])\](?: |$)`)
+)
+
+// blocks renders lines as block elements. In tight lists, paragraphs
+// are not wrapped in <p>.
+func (r *renderer) blocks(b *strings.Builder, lines []string, tight bool) {
+	var para []string
+	flush := func() {
+		if len(para) == 0 {
+			return
+		}
+		text := r.inline(strings.TrimSpace(strings.Join(para, "\n")))
+		if tight {
+			b.WriteString(text + "\n")
+		} else {
+			b.WriteString("<p>" + text + "</p>\n")
+		}
+		para = nil
+	}
+
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		switch {
+		case strings.TrimSpace(line) == "":
+			flush()
+			i++
+
+		case fenceRe.MatchString(line):
+			flush()
+			i = r.fence(b, lines, i)
+
+		case headingRe.MatchString(line):
+			flush()
+			m := headingRe.FindStringSubmatch(line)
+			level := string('0' + byte(len(m[1])))
+			b.WriteString("<h" + level + ">" + r.inline(m[2]) + "</h" + level + ">\n")
+			i++
+
+		case ruleRe.MatchString(line):
+			flush()
+			b.WriteString("<hr>\n")
+			i++
+
+		case quoteRe.MatchString(line):
+			flush()
+			var quoted []string
+			for ; i < len(lines) && quoteRe.MatchString(lines[i]); i++ {
+				quoted = append(quoted, quoteRe.ReplaceAllString(lines[i], ""))
+			}
+			b.WriteString("<blockquote>\n")
+			r.blocks(b, quoted, false)
+			b.WriteString("</blockquote>\n")
+
+		case itemRe.MatchString(line):
+			flush()
+			i = r.list(b, lines, i)
+
+		default:
+			para = append(para, line)
+			i++
+		}
+	}
+	flush()
+}
+
+// fence renders the fenced code block starting at lines[start] and
+// returns the index of the line after it
+func (r *renderer) fence(b *strings.Builder, lines []string, start int) int {
+	m := fenceRe.FindStringSubmatch(lines[start])
+	indent, marker, lang := len(m[1]), m[2], m[3]
+
+	var code []string
+	i := start + 1
+	for ; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(trimmed, marker) && strings.Trim(trimmed, marker[:1]) == "" {
+			i++
+			break
+		}
+		line := lines[i]
+		for n := 0; n < indent && strings.HasPrefix(line, " "); n++ {
+			line = line[1:]
+		}
+		code = append(code, line)
+	}
+
+	b.WriteString("<pre><code")
+	if lang != "" {
+		b.WriteString(` class="language-` + html.EscapeString(lang) + `"`)
+	}
+	b.WriteString(">")
+	var text string
+	if len(code) > 0 {
+		text = strings.Join(code, "\n") + "\n"
+	}
+	if syntax, ok := lookupLanguage(lang); ok && r.opts.Highlight {
+		b.WriteString(highlight(text, syntax))
+	} else {
+		b.WriteString(html.EscapeString(text))
+	}
+	b.WriteString("</code></pre>\n")
+	return i
+}
+
+// list renders the list starting at lines[start] and returns the index
+// of the line after it
+func (r *renderer) list(b *strings.Builder, lines []string, start int) int {
+	first := itemRe.FindStringSubmatch(lines[start])
+	ordered := !strings.ContainsAny(first[2][:1], "-*+")
+	kind := first[2][len(first[2])-1:] // Bullet or delimiter of ordered lists
+
+	var items [][]string // Content lines of each item
+	loose := false
+	i := start
+	for i < len(lines) {
+		m := itemRe.FindStringSubmatch(lines[i])
+		if m == nil || m[2][len(m[2])-1:] != kind {
+			break
+		}
+		indent := len(m[1]) + len(m[2]) + len(m[3])
+		if len(m[3]) > 4 {
+			indent = len(m[1]) + len(m[2]) + 1 // Indented code is not supported
+		}
+		item := []string{lines[i][indent:]}
+		i++
+
+		// Continuation lines are indented past the marker, or continue a
+		// paragraph lazily
+		for i < len(lines) {
+			line := lines[i]
+			if strings.TrimSpace(line) == "" {
+				next := i + 1
+				for next < len(lines) && strings.TrimSpace(lines[next]) == "" {
+					next++
+				}
+				if next == len(lines) || leadingSpaces(lines[next]) < indent {
+					break
+				}
+				item = append(item, "")
+				i++
+				continue
+			}
+			if leadingSpaces(line) >= indent {
+				item = append(item, line[indent:])
+				i++
+				continue
+			}
+			prev := item[len(item)-1]
+			if strings.TrimSpace(prev) != "" && !startsBlock(line) {
+				item = append(item, line)
+				i++
+				continue
+			}
+			break
+		}
+		if hasInnerBlank(item) {
+			loose = true
+		}
+		items = append(items, item)
+
+		// A blank line between items makes the list loose
+		if i < len(lines) && strings.TrimSpace(lines[i]) == "" {
+			next := i + 1
+			for next < len(lines) && strings.TrimSpace(lines[next]) == "" {
+				next++
+			}
+			if next < len(lines) {
+				if m := itemRe.FindStringSubmatch(lines[next]); m != nil && m[2][len(m[2])-1:] == kind {
+					loose = true
+					i = next
+				}
+			}
+		}
+	}
+
+	tag := "ul"
+	if ordered {
+		tag = "ol"
+		if n := strings.TrimLeft(first[2][:len(first[2])-1], "0"); n != "1" {
+			if n == "" {
+				n = "0"
+			}
+			b.WriteString(`<ol start="` + n + `">` + "\n")
+		} else {
+			b.WriteString("<ol>\n")
+		}
+	} else {
+		b.WriteString("<ul>\n")
+	}
+	for _, item := range items {
+		b.WriteString("<li>")
+		if m := taskRe.FindStringSubmatch(item[0]); m != nil && !ordered {
+			checked := ""
+			if m[1] != " " {
+				checked = " checked"
+			}
+			b.WriteString(`<input type="checkbox" disabled` + checked + `> `)
+			item[0] = item[0][len(m[0]):]
+		}
+		var inner strings.Builder
+		r.blocks(&inner, item, !loose)
+		b.WriteString(strings.TrimSuffix(inner.String(), "\n"))
+		b.WriteString("</li>\n")
+	}
+	b.WriteString("</" + tag + ">\n")
+	return i
+}
+
+// startsBlock reports whether a line starts a block other than a
+// paragraph, ending lazy continuation
+func startsBlock(line string) bool {
+	return fenceRe.MatchString(line) || headingRe.MatchString(line) ||
+		ruleRe.MatchString(line) || quoteRe.MatchString(line) || itemRe.MatchString(line)
+}
+
+func leadingSpaces(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// hasInnerBlank reports whether an item's content has blank lines
+// between its blocks, making the list loose
+func hasInnerBlank(lines []string) bool {
+	for _, line := range lines[:len(lines)-1] {
+		if strings.TrimSpace(line) == "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"heading", "# Title #\n## Sub", "<h1>Title</h1>\n<h2>Sub</h2>\n"},
+		{"paragraphs", "one\ntwo\n\nthree", "<p>one\ntwo</p>\n<p>three</p>\n"},
+		{"emphasis", "*a* **b** ***c*** _d_ ~~e~~ snake_case_name",
+			"<p><em>a</em> <strong>b</strong> <em><strong>c</strong></em> <em>d</em> <del>e</del> snake_case_name</p>\n"},
+		{"unclosed emphasis", "2 * 3 and **open", "<p>2 * 3 and **open</p>\n"},
+		{"code span", "use `a <b>` and ``x ` y``", "<p>use <code>a &lt;b&gt;</code> and <code>x ` y</code></p>\n"},
+		{"escapes", `\*not em\* <script>alert(1)</script>`,
+			"<p>*not em* &lt;script&gt;alert(1)&lt;/script&gt;</p>\n"},
+		{"hard break", "a  \nb\\\nc", "<p>a<br>\nb<br>\nc</p>\n"},
+		{"fenced code", "```go\nfunc <T>()\n```\nafter",
+			"<pre><code class=\"language-go\">func &lt;T&gt;()\n</code></pre>\n<p>after</p>\n"},
+		{"unclosed fence", "~~~\ncode", "<pre><code>code\n</code></pre>\n"},
+		{"rule", "a\n\n---\n\n* * *", "<p>a</p>\n<hr>\n<hr>\n"},
+		{"blockquote", "> quoted\n> **text**", "<blockquote>\n<p>quoted\n<strong>text</strong></p>\n</blockquote>\n"},
+		{"tight list", "- one\n- two\n  more\n- three", "<ul>\n<li>one</li>\n<li>two\nmore</li>\n<li>three</li>\n</ul>\n"},
+		{"loose list", "1. one\n\n2. two", "<ol>\n<li><p>one</p></li>\n<li><p>two</p></li>\n</ol>\n"},
+		{"ordered start", "3) c\n4) d", "<ol start=\"3\">\n<li>c</li>\n<li>d</li>\n</ol>\n"},
+		{"nested list", "- a\n  - b\n- c", "<ul>\n<li>a\n<ul>\n<li>b</li>\n</ul></li>\n<li>c</li>\n</ul>\n"},
+		{"task list", "- [ ] todo\n- [x] done",
+			"<ul>\n<li><input type=\"checkbox\" disabled> todo</li>\n<li><input type=\"checkbox\" disabled checked> done</li>\n</ul>\n"},
+		{"list ends", "- a\n\npara", "<ul>\n<li>a</li>\n</ul>\n<p>para</p>\n"},
+		{"link", `[the *site*](https://example.com "Example")`,
+			"<p><a href=\"https://example.com\" title=\"Example\">the <em>site</em></a></p>\n"},
+		{"image", "![a *cat*](cat.png)", "<p><img src=\"cat.png\" alt=\"a cat\"></p>\n"},
+		{"unsafe link", "[x](javascript:alert(1)) [y](JaVaScRiPt:alert(1))",
+			"<p><a href=\"#\">x</a> <a href=\"#\">y</a></p>\n"},
+		{"not a link", "[x] and [y]", "<p>[x] and [y]</p>\n"},
+		{"autolink", "<https://a.example/?q=1&r=2> <me@example.com>",
+			"<p><a href=\"https://a.example/?q=1&amp;r=2\">https://a.example/?q=1&amp;r=2</a> <a href=\"mailto:me@example.com\">me@example.com</a></p>\n"},
+		{"raw html", "<img src=x onerror=alert(1)>", "<p>&lt;img src=x onerror=alert(1)&gt;</p>\n"},
+		{"unresolved wiki link", "see [[Other Note|other]]", "<p>see <span class=\"wikilink missing\">other</span></p>\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Render([]byte(tt.src), Options{}); got != tt.want {
+				t.Errorf("Render(%q)\n got %q\nwant %q", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderWikiLinks(t *testing.T) {
+	opts := Options{WikiLink: func(target string) (string, bool) {
+		if strings.EqualFold(target, "shopping") {
+			return "shopping.html?a=1&b=2", true
+		}
+		return "", false
+	}}
+	got := Render([]byte("[[Shopping]], [[shopping|the list]] and [[Missing]]"), opts)
+	want := "<p><a class=\"wikilink\" href=\"shopping.html?a=1&amp;b=2\">Shopping</a>, " +
+		"<a class=\"wikilink\" href=\"shopping.html?a=1&amp;b=2\">the list</a> and " +
+		"<span class=\"wikilink missing\">Missing</span></p>\n"
+	if got != want {
+		t.Errorf("got %q\nwant %q", got, want)
+	}
+}
+
+func TestWikiLinks(t *testing.T) {
+	src := "See [[Shopping]] and [[ Trip | the trip ]], [[shopping]] again, [[]] [[a\n\n```\n[[In Code]]\n```\n[[Shopping]] [[Last]]"
+	got := WikiLinks([]byte(src))
+	want := []string{"Shopping", "Trip", "shopping", "Last"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRenderHighlight(t *testing.T) {
+	src := "```go\n// Add <ints>\nfunc add(a int) int { return a + 1 } // \"done\"\nvar s = `x\ny`\n```\n```text\nfunc\n```"
+	got := Render([]byte(src), Options{Highlight: true})
+	want := "<pre><code class=\"language-go\"><span class=\"hl-com\">// Add &lt;ints&gt;</span>\n" +
+		"<span class=\"hl-kw\">func</span> add(a int) int { <span class=\"hl-kw\">return</span> a + <span class=\"hl-num\">1</span> } " +
+		"<span class=\"hl-com\">// &#34;done&#34;</span>\n" +
+		"<span class=\"hl-kw\">var</span> s = <span class=\"hl-str\">`x\ny`</span>\n</code></pre>\n" +
+		"<pre><code class=\"language-text\">func\n</code></pre>\n"
+	if got != want {
+		t.Errorf("got %q\nwant %q", got, want)
+	}
+
+	sql := Render([]byte("```SQL\nSELECT 'it''s' -- note\n```"), Options{Highlight: true})
+	if want := "<span class=\"hl-kw\">SELECT</span> <span class=\"hl-str\">&#39;it&#39;</span><span class=\"hl-str\">&#39;s&#39;</span> <span class=\"hl-com\">-- note</span>"; !strings.Contains(sql, want) {
+		t.Errorf("got %q, want it to contain %q", sql, want)
+	}
+}
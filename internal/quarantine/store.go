@@ -0,0 +1,103 @@
+// Package quarantine persists entries a merge rejected, e.g. for
+// timestamps far ahead of the local clock.
+package quarantine
+
+import (
+	"database/sql"
+
+	"github.com/google/uuid"
+)
+
+// Entry is a rejected version of an entry
+type Entry struct {
+	EntryID       uuid.UUID
+	EntryType     string
+	Timestamp     uint64 // The rejected timestamp
+	Reason        string
+	Rejections    int64  // Times this version was received and rejected
+	QuarantinedAt int64  // Unix seconds, first rejection
+	LastSeen      int64  // Unix seconds, last rejection
+	Element       []byte // The rejected CRDT element, JSON
+}
+
+// Store manages quarantined entries in SQLite
+type Store struct {
+	db *sql.DB
+}
+
+// NewStore creates a new quarantine store
+func NewStore(db *sql.DB) (*Store, error) {
+	store := &Store{db: db}
+
+	if err := store.initSchema(); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+func (s *Store) initSchema() error {
+	schema := `
+		CREATE TABLE IF NOT EXISTS quarantine (
+			entry_id TEXT NOT NULL,
+			timestamp INTEGER NOT NULL,
+			entry_type TEXT NOT NULL,
+			reason TEXT NOT NULL,
+			rejections INTEGER NOT NULL,
+			quarantined_at INTEGER NOT NULL,
+			last_seen INTEGER NOT NULL,
+			element BLOB,
+			PRIMARY KEY (entry_id, timestamp)
+		);
+	`
+	_, err := s.db.Exec(schema)
+	return err
+}
+
+// Put records a rejection. Receiving the same version again (peers resend
+// their whole state) only counts it.
+func (s *Store) Put(e Entry) error {
+	_, err := s.db.Exec(`
+		INSERT INTO quarantine (entry_id, timestamp, entry_type, reason, rejections, quarantined_at, last_seen, element)
+		VALUES (?, ?, ?, ?, 1, ?, ?, ?)
+		ON CONFLICT (entry_id, timestamp) DO UPDATE SET
+			rejections = rejections + 1,
+			reason = excluded.reason,
+			last_seen = excluded.last_seen
+	`, e.EntryID.String(), e.Timestamp, e.EntryType, e.Reason, e.QuarantinedAt, e.LastSeen, e.Element)
+
+	return err
+}
+
+// List returns all quarantined entries, most recently rejected first
+func (s *Store) List() ([]Entry, error) {
+	rows, err := s.db.Query(`
+		SELECT entry_id, timestamp, entry_type, reason, rejections, quarantined_at, last_seen, element
+		FROM quarantine
+		ORDER BY last_seen DESC, entry_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []Entry
+	for rows.Next() {
+		var e Entry
+		var entryIDStr string
+
+		if err := rows.Scan(&entryIDStr, &e.Timestamp, &e.EntryType, &e.Reason, &e.Rejections, &e.QuarantinedAt, &e.LastSeen, &e.Element); err != nil {
+			return nil, err
+		}
+
+		e.EntryID, _ = uuid.Parse(entryIDStr)
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// Clear forgets every quarantined entry
+func (s *Store) Clear() error {
+	_, err := s.db.Exec(`DELETE FROM quarantine`)
+	return err
+}
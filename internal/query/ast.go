@@ -0,0 +1,307 @@
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Field names understood by the query language
+const (
+	FieldID        = "id"
+	FieldType      = "type"
+	FieldTag       = "tag" // "tags" is accepted as an alias
+	FieldContent   = "content"
+	FieldCreatedAt = "created_at"
+	FieldUpdatedAt = "updated_at"
+	FieldDeleted   = "deleted"
+)
+
+// Comparison operators
+const (
+	OpEq       = "="
+	OpNe       = "!="
+	OpLt       = "<"
+	OpLe       = "<="
+	OpGt       = ">"
+	OpGe       = ">="
+	OpLike     = "LIKE"
+	OpContains = "CONTAINS"
+)
+
+// Record is the view of an entry that expressions are evaluated against
+type Record struct {
+	ID        string
+	Type      string
+	Tags      []string
+	Content   []byte
+	CreatedAt uint64
+	UpdatedAt uint64
+	Deleted   bool
+}
+
+// Expr is a node in a WHERE clause expression tree
+type Expr interface {
+	// Eval reports whether the record matches the expression
+	Eval(r Record) bool
+	// String returns the expression in query syntax
+	String() string
+
+	toSQL(args *[]interface{}) string
+}
+
+// AndExpr matches when both sides match
+type AndExpr struct {
+	Left, Right Expr
+}
+
+// OrExpr matches when either side matches
+type OrExpr struct {
+	Left, Right Expr
+}
+
+// NotExpr matches when the inner expression does not
+type NotExpr struct {
+	Expr Expr
+}
+
+// Comparison compares a field against a single value
+type Comparison struct {
+	Field string
+	Op    string
+	Value string
+
+	num  uint64         // Parsed value for created_at/updated_at
+	flag bool           // Parsed value for deleted
+	like *regexp.Regexp // Compiled pattern for LIKE
+}
+
+// InExpr matches when a field equals any of the values.
+// For tags, it matches when the entry has any of the tags.
+type InExpr struct {
+	Field  string
+	Values []string
+	Negate bool // NOT IN
+}
+
+func (e *AndExpr) Eval(r Record) bool { return e.Left.Eval(r) && e.Right.Eval(r) }
+func (e *OrExpr) Eval(r Record) bool  { return e.Left.Eval(r) || e.Right.Eval(r) }
+func (e *NotExpr) Eval(r Record) bool { return !e.Expr.Eval(r) }
+
+func (e *AndExpr) String() string { return "(" + e.Left.String() + " AND " + e.Right.String() + ")" }
+func (e *OrExpr) String() string  { return "(" + e.Left.String() + " OR " + e.Right.String() + ")" }
+func (e *NotExpr) String() string { return "NOT " + e.Expr.String() }
+
+func (e *AndExpr) toSQL(args *[]interface{}) string {
+	return "(" + e.Left.toSQL(args) + " AND " + e.Right.toSQL(args) + ")"
+}
+
+func (e *OrExpr) toSQL(args *[]interface{}) string {
+	return "(" + e.Left.toSQL(args) + " OR " + e.Right.toSQL(args) + ")"
+}
+
+func (e *NotExpr) toSQL(args *[]interface{}) string {
+	return "NOT (" + e.Expr.toSQL(args) + ")"
+}
+
+// Eval evaluates the comparison against a record
+func (c *Comparison) Eval(r Record) bool {
+	switch c.Field {
+	case FieldTag:
+		switch c.Op {
+		case OpNe:
+			return !hasTag(r.Tags, c.Value)
+		case OpLike:
+			for _, t := range r.Tags {
+				if c.like.MatchString(t) {
+					return true
+				}
+			}
+			return false
+		default: // = and CONTAINS
+			return hasTag(r.Tags, c.Value)
+		}
+	case FieldCreatedAt:
+		return compareUint(r.CreatedAt, c.Op, c.num)
+	case FieldUpdatedAt:
+		return compareUint(r.UpdatedAt, c.Op, c.num)
+	case FieldDeleted:
+		if c.Op == OpNe {
+			return r.Deleted != c.flag
+		}
+		return r.Deleted == c.flag
+	case FieldContent:
+		return compareString(string(r.Content), c)
+	case FieldType:
+		return compareString(r.Type, c)
+	case FieldID:
+		return compareString(r.ID, c)
+	}
+	return false
+}
+
+func (c *Comparison) String() string {
+	return fmt.Sprintf("%s %s %q", c.Field, c.Op, c.Value)
+}
+
+func (c *Comparison) toSQL(args *[]interface{}) string {
+	switch c.Field {
+	case FieldTag:
+		switch c.Op {
+		case OpNe:
+			*args = append(*args, c.Value)
+			return "id NOT IN (SELECT entry_id FROM tags WHERE tag = ?)"
+		case OpLike:
+			*args = append(*args, c.Value)
+			return "id IN (SELECT entry_id FROM tags WHERE tag LIKE ?)"
+		default:
+			*args = append(*args, c.Value)
+			return "id IN (SELECT entry_id FROM tags WHERE tag = ?)"
+		}
+	case FieldCreatedAt, FieldUpdatedAt:
+		*args = append(*args, c.num)
+		return c.Field + " " + c.Op + " ?"
+	case FieldDeleted:
+		if c.flag {
+			*args = append(*args, 1)
+		} else {
+			*args = append(*args, 0)
+		}
+		return "deleted " + c.Op + " ?"
+	default:
+		*args = append(*args, c.Value)
+		if c.Op == OpContains {
+			return "instr(" + c.Field + ", ?) > 0"
+		}
+		return c.Field + " " + c.Op + " ?"
+	}
+}
+
+// Eval evaluates the IN expression against a record
+func (e *InExpr) Eval(r Record) bool {
+	match := false
+	for _, v := range e.Values {
+		switch e.Field {
+		case FieldTag:
+			match = hasTag(r.Tags, v)
+		case FieldType:
+			match = r.Type == v
+		case FieldID:
+			match = r.ID == v
+		case FieldContent:
+			match = string(r.Content) == v
+		}
+		if match {
+			break
+		}
+	}
+	return match != e.Negate
+}
+
+func (e *InExpr) String() string {
+	quoted := make([]string, len(e.Values))
+	for i, v := range e.Values {
+		quoted[i] = fmt.Sprintf("%q", v)
+	}
+	op := "IN"
+	if e.Negate {
+		op = "NOT IN"
+	}
+	return fmt.Sprintf("%s %s (%s)", e.Field, op, strings.Join(quoted, ", "))
+}
+
+func (e *InExpr) toSQL(args *[]interface{}) string {
+	placeholders := make([]string, len(e.Values))
+	for i, v := range e.Values {
+		placeholders[i] = "?"
+		*args = append(*args, v)
+	}
+	list := "(" + strings.Join(placeholders, ", ") + ")"
+
+	op := "IN"
+	if e.Negate {
+		op = "NOT IN"
+	}
+	if e.Field == FieldTag {
+		return "id " + op + " (SELECT entry_id FROM tags WHERE tag IN " + list + ")"
+	}
+	return e.Field + " " + op + " " + list
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func compareUint(a uint64, op string, b uint64) bool {
+	switch op {
+	case OpEq:
+		return a == b
+	case OpNe:
+		return a != b
+	case OpLt:
+		return a < b
+	case OpLe:
+		return a <= b
+	case OpGt:
+		return a > b
+	case OpGe:
+		return a >= b
+	}
+	return false
+}
+
+func compareString(s string, c *Comparison) bool {
+	switch c.Op {
+	case OpEq:
+		return s == c.Value
+	case OpNe:
+		return s != c.Value
+	case OpLike:
+		return c.like.MatchString(s)
+	case OpContains:
+		return strings.Contains(s, c.Value)
+	}
+	return false
+}
+
+// likeToRegexp converts a SQL LIKE pattern (% and _ wildcards) into an
+// anchored, case-insensitive regular expression, matching SQLite's LIKE
+func likeToRegexp(pattern string) *regexp.Regexp {
+	var sb strings.Builder
+	sb.WriteString("(?is)^")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			sb.WriteString(".*")
+		case '_':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.MustCompile(sb.String())
+}
+
+// walk calls fn for every node in the expression tree
+func walk(e Expr, fn func(Expr)) {
+	if e == nil {
+		return
+	}
+	fn(e)
+	switch n := e.(type) {
+	case *AndExpr:
+		walk(n.Left, fn)
+		walk(n.Right, fn)
+	case *OrExpr:
+		walk(n.Left, fn)
+		walk(n.Right, fn)
+	case *NotExpr:
+		walk(n.Expr, fn)
+	}
+}
@@ -0,0 +1,149 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// tokenKind identifies the kind of a lexical token
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokOp     // = != <> < <= > >=
+	tokLParen // (
+	tokRParen // )
+	tokComma  // ,
+	tokStar   // *
+)
+
+// token is a single lexical token
+type token struct {
+	kind tokenKind
+	text string // Raw text (unquoted for strings)
+	pos  int    // Byte offset in the input
+}
+
+// keyword reports whether the token is the given keyword (case insensitive)
+func (t token) keyword(kw string) bool {
+	return t.kind == tokIdent && strings.EqualFold(t.text, kw)
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of query"
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// lex splits a query string into tokens
+func lex(input string) ([]token, error) {
+	var tokens []token
+	i := 0
+
+	for i < len(input) {
+		c, size := utf8.DecodeRuneInString(input[i:])
+
+		switch {
+		case unicode.IsSpace(c):
+			i += size
+
+		case c == '(':
+			tokens = append(tokens, token{kind: tokLParen, text: "(", pos: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokRParen, text: ")", pos: i})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{kind: tokComma, text: ",", pos: i})
+			i++
+		case c == '*':
+			tokens = append(tokens, token{kind: tokStar, text: "*", pos: i})
+			i++
+
+		case c == '=' || c == '<' || c == '>' || c == '!':
+			start := i
+			i++
+			if i < len(input) && (input[i] == '=' || (c == '<' && input[i] == '>')) {
+				i++
+			}
+			op := input[start:i]
+			if op == "!" {
+				return nil, fmt.Errorf("query: unexpected '!' at position %d", start)
+			}
+			if op == "<>" {
+				op = "!="
+			}
+			tokens = append(tokens, token{kind: tokOp, text: op, pos: start})
+
+		case c == '"' || c == '\'':
+			start := i
+			i++
+			var sb strings.Builder
+			closed := false
+			for i < len(input) {
+				r, n := utf8.DecodeRuneInString(input[i:])
+				if r == '\\' && i+n < len(input) {
+					escaped, m := utf8.DecodeRuneInString(input[i+n:])
+					sb.WriteRune(escaped)
+					i += n + m
+					continue
+				}
+				if r == c {
+					// SQL-style doubled quote escapes the quote character
+					if i+n < len(input) && rune(input[i+n]) == c {
+						sb.WriteRune(c)
+						i += 2 * n
+						continue
+					}
+					closed = true
+					i += n
+					break
+				}
+				sb.WriteString(input[i : i+n])
+				i += n
+			}
+			if !closed {
+				return nil, fmt.Errorf("query: unterminated string starting at position %d", start)
+			}
+			tokens = append(tokens, token{kind: tokString, text: sb.String(), pos: start})
+
+		case c == '-' || unicode.IsDigit(c):
+			start := i
+			i += size
+			for i < len(input) {
+				r, n := utf8.DecodeRuneInString(input[i:])
+				if !unicode.IsDigit(r) && r != '.' {
+					break
+				}
+				i += n
+			}
+			if input[start:i] == "-" {
+				return nil, fmt.Errorf("query: unexpected '-' at position %d", start)
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: input[start:i], pos: start})
+
+		case unicode.IsLetter(c) || c == '_':
+			start := i
+			for i < len(input) {
+				r, n := utf8.DecodeRuneInString(input[i:])
+				if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '.' {
+					break
+				}
+				i += n
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: input[start:i], pos: start})
+
+		default:
+			return nil, fmt.Errorf("query: unexpected character %q at position %d", c, i)
+		}
+	}
+
+	tokens = append(tokens, token{kind: tokEOF, pos: len(input)})
+	return tokens, nil
+}
@@ -1,9 +1,22 @@
 // Package query provides SQL-like query parsing and execution.
+//
+// Grammar:
+//
+//	query      = [ "SELECT" "*" "FROM" "entries" ] [ "WHERE" ] [ expr ]
+//	             [ "ORDER" "BY" order { "," order } ] [ "LIMIT" n ] [ "OFFSET" n ]
+//	expr       = and { "OR" and }
+//	and        = unary { "AND" unary }
+//	unary      = "NOT" unary | "(" expr ")" | predicate
+//	predicate  = field op value
+//	           | field [ "NOT" ] "IN" "(" value { "," value } ")"
+//	           | field [ "NOT" ] "LIKE" value
+//	           | field "CONTAINS" value
+//
+// Fields: id, type, tag (or tags), content, created_at, updated_at, deleted.
 package query
 
 import (
 	"fmt"
-	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -11,18 +24,10 @@ import (
 
 // Query represents a parsed query
 type Query struct {
-	Type        *string           // Entry type filter
-	Tags        []string          // Tags to include (AND)
-	TagsAny     []string          // Tags to include (OR)
-	ContentLike *string           // Content LIKE pattern
-	CreatedAfter  *time.Time
-	CreatedBefore *time.Time
-	UpdatedAfter  *time.Time
-	UpdatedBefore *time.Time
-	Deleted     *bool
-	OrderBy     []OrderClause
-	Limit       int
-	Offset      int
+	Where   Expr // nil matches every entry
+	OrderBy []OrderClause
+	Limit   int
+	Offset  int
 }
 
 // OrderClause specifies ordering
@@ -31,6 +36,84 @@ type OrderClause struct {
 	Desc  bool
 }
 
+// Match reports whether a record satisfies the WHERE clause
+func (q *Query) Match(r Record) bool {
+	return q.Where == nil || q.Where.Eval(r)
+}
+
+// ReferencesField reports whether the WHERE clause mentions a field.
+// Callers use it to decide e.g. whether deleted entries must be considered.
+func (q *Query) ReferencesField(field string) bool {
+	found := false
+	walk(q.Where, func(e Expr) {
+		switch n := e.(type) {
+		case *Comparison:
+			found = found || n.Field == field
+		case *InExpr:
+			found = found || n.Field == field
+		}
+	})
+	return found
+}
+
+// Pushdown is the part of a WHERE clause a store can filter on before
+// entries are loaded: a type and a tag that every match must have.
+type Pushdown struct {
+	Type *string // Only entries of this type (nil = any)
+	Tag  *string // Only entries with this tag (nil = any)
+
+	// Exact is set when Type and Tag are the whole WHERE clause, so the
+	// store's matches are the query's and LIMIT and OFFSET can be
+	// applied there too
+	Exact bool
+}
+
+// Pushdown returns the type and tag predicates ANDed at the top level of
+// the WHERE clause
+func (q *Query) Pushdown() Pushdown {
+	var p Pushdown
+	p.Exact = true
+	for _, e := range conjuncts(q.Where) {
+		field, value, ok := equality(e)
+		switch {
+		case ok && field == FieldType && p.Type == nil:
+			p.Type = &value
+		case ok && field == FieldTag && p.Tag == nil:
+			p.Tag = &value
+		default:
+			p.Exact = false
+		}
+	}
+	return p
+}
+
+// conjuncts returns the expressions ANDed at the top of e
+func conjuncts(e Expr) []Expr {
+	switch n := e.(type) {
+	case nil:
+		return nil
+	case *AndExpr:
+		return append(conjuncts(n.Left), conjuncts(n.Right)...)
+	}
+	return []Expr{e}
+}
+
+// equality reports whether e requires field to equal (for tags, contain)
+// a single value
+func equality(e Expr) (field, value string, ok bool) {
+	switch n := e.(type) {
+	case *Comparison:
+		if n.Op == OpEq || (n.Field == FieldTag && n.Op == OpContains) {
+			return n.Field, n.Value, true
+		}
+	case *InExpr:
+		if !n.Negate && len(n.Values) == 1 {
+			return n.Field, n.Values[0], true
+		}
+	}
+	return "", "", false
+}
+
 // Parser parses SQL-like query strings
 type Parser struct{}
 
@@ -39,244 +122,412 @@ func NewParser() *Parser {
 	return &Parser{}
 }
 
-// Parse parses a query string into a Query struct
+// Parse parses a query string into a Query struct.
+// Invalid syntax, unknown fields and unsupported operators are reported as errors.
 func (p *Parser) Parse(queryStr string) (*Query, error) {
-	q := &Query{}
-	queryStr = strings.TrimSpace(queryStr)
-
-	// Handle SELECT prefix (optional)
-	if strings.HasPrefix(strings.ToUpper(queryStr), "SELECT") {
-		re := regexp.MustCompile(`(?i)^SELECT\s+\*\s+FROM\s+entries\s*`)
-		queryStr = re.ReplaceAllString(queryStr, "")
+	tokens, err := lex(queryStr)
+	if err != nil {
+		return nil, err
 	}
 
-	// Parse WHERE clause
-	whereMatch := regexp.MustCompile(`(?i)^WHERE\s+(.+?)(?:\s+ORDER\s+BY|\s+LIMIT|\s+OFFSET|$)`).FindStringSubmatch(queryStr)
-	if whereMatch != nil {
-		if err := p.parseWhere(whereMatch[1], q); err != nil {
-			return nil, err
-		}
-	} else {
-		// Try without WHERE keyword
-		if err := p.parseWhere(queryStr, q); err != nil {
-			// Not an error, might just be ORDER BY or LIMIT
-		}
-	}
+	ps := &parseState{tokens: tokens}
+	return ps.parseQuery()
+}
+
+// parseState is a recursive-descent parser over a token stream
+type parseState struct {
+	tokens []token
+	pos    int
+}
+
+func (ps *parseState) peek() token {
+	return ps.tokens[ps.pos]
+}
 
-	// Parse ORDER BY
-	orderMatch := regexp.MustCompile(`(?i)ORDER\s+BY\s+(.+?)(?:\s+LIMIT|\s+OFFSET|$)`).FindStringSubmatch(queryStr)
-	if orderMatch != nil {
-		q.OrderBy = p.parseOrderBy(orderMatch[1])
+func (ps *parseState) next() token {
+	t := ps.tokens[ps.pos]
+	if t.kind != tokEOF {
+		ps.pos++
 	}
+	return t
+}
 
-	// Parse LIMIT
-	limitMatch := regexp.MustCompile(`(?i)LIMIT\s+(\d+)`).FindStringSubmatch(queryStr)
-	if limitMatch != nil {
-		q.Limit, _ = strconv.Atoi(limitMatch[1])
+// accept consumes the next token if it is the given keyword
+func (ps *parseState) accept(kw string) bool {
+	if ps.peek().keyword(kw) {
+		ps.pos++
+		return true
 	}
+	return false
+}
 
-	// Parse OFFSET
-	offsetMatch := regexp.MustCompile(`(?i)OFFSET\s+(\d+)`).FindStringSubmatch(queryStr)
-	if offsetMatch != nil {
-		q.Offset, _ = strconv.Atoi(offsetMatch[1])
+func (ps *parseState) expect(kw string) error {
+	if !ps.accept(kw) {
+		return ps.errorf("expected %s", kw)
 	}
+	return nil
+}
 
-	return q, nil
+func (ps *parseState) errorf(format string, args ...interface{}) error {
+	t := ps.peek()
+	return fmt.Errorf("query: %s at position %d, got %s", fmt.Sprintf(format, args...), t.pos, t)
 }
 
-func (p *Parser) parseWhere(whereClause string, q *Query) error {
-	// Split by AND (case insensitive)
-	conditions := regexp.MustCompile(`(?i)\s+AND\s+`).Split(whereClause, -1)
+// atClauseEnd reports whether the WHERE expression is over
+func (ps *parseState) atClauseEnd() bool {
+	t := ps.peek()
+	return t.kind == tokEOF || t.keyword("ORDER") || t.keyword("LIMIT") || t.keyword("OFFSET")
+}
 
-	for _, cond := range conditions {
-		cond = strings.TrimSpace(cond)
-		if cond == "" {
-			continue
+func (ps *parseState) parseQuery() (*Query, error) {
+	q := &Query{}
+
+	if ps.accept("SELECT") {
+		if ps.peek().kind != tokStar {
+			return nil, ps.errorf("expected *")
 		}
+		ps.next()
+		if err := ps.expect("FROM"); err != nil {
+			return nil, err
+		}
+		if err := ps.expect("entries"); err != nil {
+			return nil, err
+		}
+	}
 
-		// Handle OR within parentheses
-		if strings.Contains(strings.ToUpper(cond), " OR ") {
-			orParts := regexp.MustCompile(`(?i)\s+OR\s+`).Split(cond, -1)
-			for _, orPart := range orParts {
-				if err := p.parseCondition(strings.TrimSpace(orPart), q, true); err != nil {
-					return err
-				}
+	explicitWhere := ps.accept("WHERE")
+	if !ps.atClauseEnd() {
+		where, err := ps.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		q.Where = where
+	} else if explicitWhere {
+		return nil, ps.errorf("expected condition after WHERE")
+	}
+
+	if ps.accept("ORDER") {
+		if err := ps.expect("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			clause, err := ps.parseOrder()
+			if err != nil {
+				return nil, err
 			}
-		} else {
-			if err := p.parseCondition(cond, q, false); err != nil {
-				return err
+			q.OrderBy = append(q.OrderBy, clause)
+			if ps.peek().kind != tokComma {
+				break
 			}
+			ps.next()
 		}
 	}
 
-	return nil
-}
+	if ps.accept("LIMIT") {
+		n, err := ps.parseCount()
+		if err != nil {
+			return nil, err
+		}
+		q.Limit = n
+	}
 
-func (p *Parser) parseCondition(cond string, q *Query, isOr bool) error {
-	cond = strings.TrimSpace(cond)
-	cond = strings.Trim(cond, "()")
+	if ps.accept("OFFSET") {
+		n, err := ps.parseCount()
+		if err != nil {
+			return nil, err
+		}
+		q.Offset = n
+	}
 
-	// type = "note"
-	if match := regexp.MustCompile(`(?i)^type\s*=\s*['""]?(\w+)['""]?$`).FindStringSubmatch(cond); match != nil {
-		t := match[1]
-		q.Type = &t
-		return nil
+	if ps.peek().kind != tokEOF {
+		return nil, ps.errorf("unexpected token")
 	}
 
-	// tag = "work" or tags CONTAINS "work"
-	if match := regexp.MustCompile(`(?i)^tags?\s*(?:=|CONTAINS)\s*['""]?(\w+)['""]?$`).FindStringSubmatch(cond); match != nil {
-		tag := match[1]
-		if isOr {
-			q.TagsAny = append(q.TagsAny, tag)
-		} else {
-			q.Tags = append(q.Tags, tag)
+	return q, nil
+}
+
+func (ps *parseState) parseOr() (Expr, error) {
+	left, err := ps.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for ps.accept("OR") {
+		right, err := ps.parseAnd()
+		if err != nil {
+			return nil, err
 		}
-		return nil
+		left = &OrExpr{Left: left, Right: right}
 	}
+	return left, nil
+}
 
-	// content LIKE "%pattern%"
-	if match := regexp.MustCompile(`(?i)^content\s+LIKE\s+['""](.+)['""]$`).FindStringSubmatch(cond); match != nil {
-		pattern := match[1]
-		q.ContentLike = &pattern
-		return nil
+func (ps *parseState) parseAnd() (Expr, error) {
+	left, err := ps.parseUnary()
+	if err != nil {
+		return nil, err
 	}
-
-	// created_at > "2024-01-01" or created_at > 1700000000
-	if match := regexp.MustCompile(`(?i)^created_at\s*([<>=!]+)\s*['""]?(.+?)['""]?$`).FindStringSubmatch(cond); match != nil {
-		op := match[1]
-		value := match[2]
-		t, err := p.parseTime(value)
+	for ps.accept("AND") {
+		right, err := ps.parseUnary()
 		if err != nil {
-			return err
+			return nil, err
 		}
-		switch op {
-		case ">", ">=":
-			q.CreatedAfter = &t
-		case "<", "<=":
-			q.CreatedBefore = &t
+		left = &AndExpr{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (ps *parseState) parseUnary() (Expr, error) {
+	if ps.accept("NOT") {
+		inner, err := ps.parseUnary()
+		if err != nil {
+			return nil, err
 		}
-		return nil
+		return &NotExpr{Expr: inner}, nil
 	}
 
-	// updated_at > "2024-01-01"
-	if match := regexp.MustCompile(`(?i)^updated_at\s*([<>=!]+)\s*['""]?(.+?)['""]?$`).FindStringSubmatch(cond); match != nil {
-		op := match[1]
-		value := match[2]
-		t, err := p.parseTime(value)
+	if ps.peek().kind == tokLParen {
+		ps.next()
+		inner, err := ps.parseOr()
 		if err != nil {
-			return err
+			return nil, err
 		}
-		switch op {
-		case ">", ">=":
-			q.UpdatedAfter = &t
-		case "<", "<=":
-			q.UpdatedBefore = &t
+		if ps.peek().kind != tokRParen {
+			return nil, ps.errorf("expected )")
 		}
-		return nil
+		ps.next()
+		return inner, nil
 	}
 
-	// deleted = true/false
-	if match := regexp.MustCompile(`(?i)^deleted\s*=\s*(true|false|1|0)$`).FindStringSubmatch(cond); match != nil {
-		deleted := match[1] == "true" || match[1] == "1"
-		q.Deleted = &deleted
-		return nil
+	return ps.parsePredicate()
+}
+
+func (ps *parseState) parsePredicate() (Expr, error) {
+	fieldTok := ps.peek()
+	if fieldTok.kind != tokIdent {
+		return nil, ps.errorf("expected field name")
 	}
+	field, ok := normalizeField(fieldTok.text)
+	if !ok {
+		return nil, fmt.Errorf("query: unknown field %q at position %d", fieldTok.text, fieldTok.pos)
+	}
+	ps.next()
 
-	// Unknown condition - ignore for flexibility
-	return nil
-}
+	negate := ps.accept("NOT")
+
+	switch {
+	case ps.accept("IN"):
+		return ps.parseIn(field, fieldTok, negate)
+
+	case ps.accept("LIKE"):
+		expr, err := ps.parseComparison(field, fieldTok, OpLike)
+		if err != nil || !negate {
+			return expr, err
+		}
+		return &NotExpr{Expr: expr}, nil
 
-func (p *Parser) parseTime(value string) (time.Time, error) {
-	// Try unix timestamp
-	if ts, err := strconv.ParseInt(value, 10, 64); err == nil {
-		return time.Unix(ts, 0), nil
+	case negate:
+		return nil, ps.errorf("expected IN or LIKE after NOT")
+
+	case ps.accept("CONTAINS"):
+		return ps.parseComparison(field, fieldTok, OpContains)
+
+	case ps.peek().kind == tokOp:
+		return ps.parseComparison(field, fieldTok, ps.next().text)
 	}
 
-	// Try ISO date
-	formats := []string{
-		"2006-01-02",
-		"2006-01-02T15:04:05",
-		"2006-01-02T15:04:05Z",
-		time.RFC3339,
+	return nil, ps.errorf("expected operator after %s", field)
+}
+
+func (ps *parseState) parseComparison(field string, fieldTok token, op string) (Expr, error) {
+	if !operatorAllowed(field, op) {
+		return nil, fmt.Errorf("query: operator %s not supported for field %s at position %d", op, field, fieldTok.pos)
 	}
 
-	for _, format := range formats {
-		if t, err := time.Parse(format, value); err == nil {
-			return t, nil
-		}
+	valueTok := ps.peek()
+	value, err := ps.parseValue()
+	if err != nil {
+		return nil, err
 	}
 
-	return time.Time{}, fmt.Errorf("invalid time format: %s", value)
+	c := &Comparison{Field: field, Op: op, Value: value}
+	switch field {
+	case FieldCreatedAt, FieldUpdatedAt:
+		c.num, err = parseTimestamp(value)
+	case FieldDeleted:
+		c.flag, err = parseBool(value)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query: %v at position %d", err, valueTok.pos)
+	}
+	if op == OpLike {
+		c.like = likeToRegexp(value)
+	}
+	return c, nil
 }
 
-func (p *Parser) parseOrderBy(orderClause string) []OrderClause {
-	var clauses []OrderClause
+func (ps *parseState) parseIn(field string, fieldTok token, negate bool) (Expr, error) {
+	switch field {
+	case FieldType, FieldTag, FieldID, FieldContent:
+	default:
+		return nil, fmt.Errorf("query: operator IN not supported for field %s at position %d", field, fieldTok.pos)
+	}
+
+	if ps.peek().kind != tokLParen {
+		return nil, ps.errorf("expected ( after IN")
+	}
+	ps.next()
+
+	expr := &InExpr{Field: field, Negate: negate}
+	for {
+		value, err := ps.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		expr.Values = append(expr.Values, value)
 
-	parts := strings.Split(orderClause, ",")
-	for _, part := range parts {
-		part = strings.TrimSpace(part)
-		fields := strings.Fields(part)
-		if len(fields) == 0 {
+		if ps.peek().kind == tokComma {
+			ps.next()
 			continue
 		}
+		if ps.peek().kind == tokRParen {
+			ps.next()
+			return expr, nil
+		}
+		return nil, ps.errorf("expected , or )")
+	}
+}
 
-		clause := OrderClause{Field: fields[0]}
-		if len(fields) > 1 && strings.ToUpper(fields[1]) == "DESC" {
-			clause.Desc = true
+// parseValue accepts a quoted string, a number or a bare word
+func (ps *parseState) parseValue() (string, error) {
+	t := ps.peek()
+	switch t.kind {
+	case tokString, tokNumber:
+		ps.next()
+		return t.text, nil
+	case tokIdent:
+		if isKeyword(t.text) {
+			return "", ps.errorf("expected value")
 		}
-		clauses = append(clauses, clause)
+		ps.next()
+		return t.text, nil
 	}
+	return "", ps.errorf("expected value")
+}
 
-	return clauses
+func (ps *parseState) parseOrder() (OrderClause, error) {
+	t := ps.peek()
+	if t.kind != tokIdent {
+		return OrderClause{}, ps.errorf("expected field name")
+	}
+	field, ok := normalizeField(t.text)
+	if !ok || field == FieldTag || field == FieldContent {
+		return OrderClause{}, fmt.Errorf("query: cannot order by %q at position %d", t.text, t.pos)
+	}
+	ps.next()
+
+	clause := OrderClause{Field: field}
+	if ps.accept("DESC") {
+		clause.Desc = true
+	} else {
+		ps.accept("ASC")
+	}
+	return clause, nil
 }
 
-// ToSQL generates a SQL WHERE clause (for SQLite)
-func (q *Query) ToSQL() (string, []interface{}) {
-	var conditions []string
-	var args []interface{}
+func (ps *parseState) parseCount() (int, error) {
+	t := ps.peek()
+	if t.kind != tokNumber {
+		return 0, ps.errorf("expected number")
+	}
+	n, err := strconv.Atoi(t.text)
+	if err != nil || n < 0 {
+		return 0, ps.errorf("expected non-negative integer")
+	}
+	ps.next()
+	return n, nil
+}
 
-	if q.Type != nil {
-		conditions = append(conditions, "type = ?")
-		args = append(args, *q.Type)
+// normalizeField maps a field name (case insensitive, with aliases) to its canonical form
+func normalizeField(name string) (string, bool) {
+	switch strings.ToLower(name) {
+	case FieldID:
+		return FieldID, true
+	case FieldType:
+		return FieldType, true
+	case FieldTag, "tags":
+		return FieldTag, true
+	case FieldContent:
+		return FieldContent, true
+	case FieldCreatedAt:
+		return FieldCreatedAt, true
+	case FieldUpdatedAt:
+		return FieldUpdatedAt, true
+	case FieldDeleted:
+		return FieldDeleted, true
 	}
+	return "", false
+}
 
-	if q.ContentLike != nil {
-		conditions = append(conditions, "content LIKE ?")
-		args = append(args, *q.ContentLike)
+func operatorAllowed(field, op string) bool {
+	switch field {
+	case FieldCreatedAt, FieldUpdatedAt:
+		return op != OpLike && op != OpContains
+	case FieldDeleted:
+		return op == OpEq || op == OpNe
+	case FieldTag:
+		return op == OpEq || op == OpNe || op == OpLike || op == OpContains
+	default: // id, type, content
+		return op == OpEq || op == OpNe || op == OpLike || op == OpContains
 	}
+}
 
-	if q.CreatedAfter != nil {
-		conditions = append(conditions, "created_at > ?")
-		args = append(args, q.CreatedAfter.Unix())
+func isKeyword(word string) bool {
+	switch strings.ToUpper(word) {
+	case "AND", "OR", "NOT", "IN", "LIKE", "CONTAINS", "ORDER", "BY", "LIMIT", "OFFSET", "WHERE", "SELECT", "FROM", "ASC", "DESC":
+		return true
 	}
+	return false
+}
 
-	if q.CreatedBefore != nil {
-		conditions = append(conditions, "created_at < ?")
-		args = append(args, q.CreatedBefore.Unix())
+func parseBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "true", "1":
+		return true, nil
+	case "false", "0":
+		return false, nil
 	}
+	return false, fmt.Errorf("invalid boolean: %s", value)
+}
 
-	if q.UpdatedAfter != nil {
-		conditions = append(conditions, "updated_at > ?")
-		args = append(args, q.UpdatedAfter.Unix())
+// parseTimestamp accepts a raw number or a date (converted to unix seconds)
+func parseTimestamp(value string) (uint64, error) {
+	if ts, err := strconv.ParseUint(value, 10, 64); err == nil {
+		return ts, nil
 	}
 
-	if q.UpdatedBefore != nil {
-		conditions = append(conditions, "updated_at < ?")
-		args = append(args, q.UpdatedBefore.Unix())
+	formats := []string{
+		"2006-01-02",
+		"2006-01-02T15:04:05",
+		"2006-01-02T15:04:05Z",
+		time.RFC3339,
 	}
 
-	if q.Deleted != nil {
-		conditions = append(conditions, "deleted = ?")
-		if *q.Deleted {
-			args = append(args, 1)
-		} else {
-			args = append(args, 0)
+	for _, format := range formats {
+		if t, err := time.Parse(format, value); err == nil {
+			return uint64(t.Unix()), nil
 		}
 	}
 
+	return 0, fmt.Errorf("invalid time format: %s", value)
+}
+
+// ToSQL generates a SQL WHERE clause (for SQLite)
+func (q *Query) ToSQL() (string, []interface{}) {
+	var args []interface{}
+
 	sql := ""
-	if len(conditions) > 0 {
-		sql = "WHERE " + strings.Join(conditions, " AND ")
+	if q.Where != nil {
+		sql = "WHERE " + q.Where.toSQL(&args)
 	}
 
 	// ORDER BY
@@ -289,7 +540,10 @@ func (q *Query) ToSQL() (string, []interface{}) {
 				orderParts = append(orderParts, o.Field+" ASC")
 			}
 		}
-		sql += " ORDER BY " + strings.Join(orderParts, ", ")
+		if sql != "" {
+			sql += " "
+		}
+		sql += "ORDER BY " + strings.Join(orderParts, ", ")
 	}
 
 	// LIMIT
@@ -302,5 +556,5 @@ func (q *Query) ToSQL() (string, []interface{}) {
 		sql += fmt.Sprintf(" OFFSET %d", q.Offset)
 	}
 
-	return sql, args
+	return strings.TrimSpace(sql), args
 }
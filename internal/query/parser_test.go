@@ -0,0 +1,180 @@
+package query
+
+import (
+	"strings"
+	"testing"
+)
+
+func mustParse(t *testing.T, q string) *Query {
+	t.Helper()
+	parsed, err := NewParser().Parse(q)
+	if err != nil {
+		t.Fatalf("Parse(%q) failed: %v", q, err)
+	}
+	return parsed
+}
+
+func TestParseAndEval(t *testing.T) {
+	note := Record{ID: "a", Type: "note", Tags: []string{"work", "urgent"}, Content: []byte("Team meeting notes"), CreatedAt: 10, UpdatedAt: 20}
+	log := Record{ID: "b", Type: "log", Tags: []string{"personal"}, Content: []byte("ran 5k"), CreatedAt: 30, UpdatedAt: 30}
+	event := Record{ID: "c", Type: "event", Tags: []string{"work"}, CreatedAt: 40, UpdatedAt: 50, Deleted: true}
+
+	tests := []struct {
+		query string
+		want  []Record
+	}{
+		{``, []Record{note, log, event}},
+		{`type = "note"`, []Record{note}},
+		{`type = note`, []Record{note}},
+		{`type != "note"`, []Record{log, event}},
+		{`NOT tag = "work"`, []Record{log}},
+		{`tags CONTAINS "work" AND NOT tags CONTAINS "urgent"`, []Record{event}},
+		{`(type = "note" OR type = "log") AND tag = "work"`, []Record{note}},
+		{`type = "note" OR type = "log" AND tag = "work"`, []Record{note}},
+		{`type IN ("note", "log")`, []Record{note, log}},
+		{`type NOT IN ("note", "log")`, []Record{event}},
+		{`tag IN ("personal", "urgent")`, []Record{note, log}},
+		{`content LIKE "%MEETING%"`, []Record{note}},
+		{`content NOT LIKE "%meeting%"`, []Record{log, event}},
+		{`content CONTAINS "5k"`, []Record{log}},
+		{`created_at > 10 AND updated_at <= 30`, []Record{log}},
+		{`deleted = true`, []Record{event}},
+		{`SELECT * FROM entries WHERE NOT (deleted = true OR type = "log")`, []Record{note}},
+	}
+
+	for _, tt := range tests {
+		q := mustParse(t, tt.query)
+		var got []string
+		for _, r := range []Record{note, log, event} {
+			if q.Match(r) {
+				got = append(got, r.ID)
+			}
+		}
+		var want []string
+		for _, r := range tt.want {
+			want = append(want, r.ID)
+		}
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("%s: got %v, want %v", tt.query, got, want)
+		}
+	}
+}
+
+func TestParseClauses(t *testing.T) {
+	q := mustParse(t, `WHERE type = "note" ORDER BY updated_at DESC, created_at LIMIT 20 OFFSET 5`)
+	if q.Limit != 20 || q.Offset != 5 {
+		t.Errorf("expected LIMIT 20 OFFSET 5, got %d/%d", q.Limit, q.Offset)
+	}
+	if len(q.OrderBy) != 2 || q.OrderBy[0] != (OrderClause{Field: FieldUpdatedAt, Desc: true}) || q.OrderBy[1] != (OrderClause{Field: FieldCreatedAt}) {
+		t.Errorf("unexpected ORDER BY: %+v", q.OrderBy)
+	}
+
+	q = mustParse(t, `LIMIT 3`)
+	if q.Where != nil || q.Limit != 3 {
+		t.Errorf("expected no WHERE and LIMIT 3, got %v/%d", q.Where, q.Limit)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	invalid := []string{
+		`type = `,
+		`colour = "red"`,
+		`type = "note" AND`,
+		`(type = "note"`,
+		`type = "note")`,
+		`type IN "note"`,
+		`type IN ("note",)`,
+		`tag > "work"`,
+		`created_at LIKE "1%"`,
+		`created_at > "yesterday"`,
+		`deleted = maybe`,
+		`type = "note`,
+		`type ~ "note"`,
+		`NOT`,
+		`type NOT = "note"`,
+		`WHERE`,
+		`ORDER BY content`,
+		`LIMIT many`,
+		`type = "note" garbage`,
+	}
+
+	for _, q := range invalid {
+		if _, err := NewParser().Parse(q); err == nil {
+			t.Errorf("expected error for %q", q)
+		}
+	}
+}
+
+func TestToSQL(t *testing.T) {
+	q := mustParse(t, `(type = "note" OR type = "log") AND NOT tag IN ("a", "b") ORDER BY created_at LIMIT 5`)
+	sql, args := q.ToSQL()
+
+	want := `WHERE ((type = ? OR type = ?) AND NOT (id IN (SELECT entry_id FROM tags WHERE tag IN (?, ?)))) ORDER BY created_at ASC LIMIT 5`
+	if sql != want {
+		t.Errorf("unexpected SQL:\n got: %s\nwant: %s", sql, want)
+	}
+	if len(args) != 4 || args[0] != "note" || args[3] != "b" {
+		t.Errorf("unexpected args: %v", args)
+	}
+}
+
+func TestReferencesField(t *testing.T) {
+	q := mustParse(t, `type = "note" AND NOT (deleted = true)`)
+	if !q.ReferencesField(FieldDeleted) {
+		t.Error("expected query to reference deleted")
+	}
+	if q.ReferencesField(FieldTag) {
+		t.Error("did not expect query to reference tag")
+	}
+}
+
+func TestLexUnicode(t *testing.T) {
+	cafe := Record{ID: "a", Type: "note", Tags: []string{"café"}, Content: []byte("naïve «quotes»")}
+	other := Record{ID: "b", Type: "note", Tags: []string{"caf"}, Content: []byte("plain")}
+
+	for _, query := range []string{
+		`tag = café`,
+		`tag = "café"`,
+		`tags CONTAINS 'caf\é'`,
+		`content LIKE "%ïve «%"`,
+	} {
+		q := mustParse(t, query)
+		if !q.Match(cafe) || q.Match(other) {
+			t.Errorf("%s: expected only the café entry to match", query)
+		}
+	}
+
+	if _, err := NewParser().Parse(`type = "note" … `); err == nil || !strings.Contains(err.Error(), `'…'`) {
+		t.Errorf("expected the whole character in the error, got %v", err)
+	}
+}
+
+func TestPushdown(t *testing.T) {
+	tests := []struct {
+		query    string
+		typ, tag string
+		exact    bool
+	}{
+		{``, "", "", true},
+		{`type = "note"`, "note", "", true},
+		{`tag CONTAINS "work" AND type IN ("log")`, "log", "work", true},
+		{`type = "note" AND content LIKE "%x%"`, "note", "", false},
+		{`type = "note" OR tag = "work"`, "", "", false},
+		{`NOT type = "note"`, "", "", false},
+		{`tag = "a" AND tag = "b"`, "", "a", false},
+	}
+
+	for _, tt := range tests {
+		p := mustParse(t, tt.query).Pushdown()
+		typ, tag := "", ""
+		if p.Type != nil {
+			typ = *p.Type
+		}
+		if p.Tag != nil {
+			tag = *p.Tag
+		}
+		if typ != tt.typ || tag != tt.tag || p.Exact != tt.exact {
+			t.Errorf("%s: got type %q tag %q exact %v", tt.query, typ, tag, p.Exact)
+		}
+	}
+}
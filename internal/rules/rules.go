@@ -0,0 +1,189 @@
+// Package rules implements auto-tagging rules: conditions on an entry's
+// type, tags and content that add tags and fill in content fields when
+// the entry is added or updated.
+package rules
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+
+	"github.com/google/uuid"
+)
+
+// Tag marks the config entries holding rules
+const Tag = "rule"
+
+// kind identifies rule content among config entries
+const kind = "rule"
+
+// Rule adds tags to, and fills in fields of, entries that match all of
+// its conditions. Conditions see the entry as given: tags added by one
+// rule do not trigger another.
+type Rule struct {
+	ID   uuid.UUID `json:"-"` // ID of the config entry holding the rule
+	Name string    `json:"name,omitempty"`
+
+	// Conditions; at least one is required
+	Type    string `json:"type,omitempty"`    // Entry type
+	Tag     string `json:"tag,omitempty"`     // Entry has this tag
+	Pattern string `json:"pattern,omitempty"` // Regexp matched against the content, or Field
+	Field   string `json:"field,omitempty"`   // Top-level field of JSON content to match Pattern against
+
+	// Actions; at least one is required
+	AddTags []string               `json:"add_tags,omitempty"`
+	Set     map[string]interface{} `json:"set,omitempty"` // Fields filled into JSON object content when missing
+
+	pattern *regexp.Regexp
+}
+
+// ruleContent is the content of a config entry holding a rule
+type ruleContent struct {
+	Kind string `json:"kind"`
+	Rule
+}
+
+// Validate checks the rule and compiles its pattern
+func (r *Rule) Validate() error {
+	if r.Type == "" && r.Tag == "" && r.Pattern == "" {
+		return errors.New("rule needs a condition: type, tag or pattern")
+	}
+	if len(r.AddTags) == 0 && len(r.Set) == 0 {
+		return errors.New("rule needs an action: tags to add or fields to set")
+	}
+	if r.Field != "" && r.Pattern == "" {
+		return errors.New("rule field needs a pattern")
+	}
+	if r.Pattern != "" {
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid rule pattern: %w", err)
+		}
+		r.pattern = re
+	}
+	return nil
+}
+
+// Encode returns the content of a config entry holding the rule
+func Encode(r Rule) ([]byte, error) {
+	return json.Marshal(ruleContent{Kind: kind, Rule: r})
+}
+
+// Decode parses and validates the content of a config entry holding a
+// rule
+func Decode(id uuid.UUID, content []byte) (Rule, error) {
+	var rc ruleContent
+	if err := json.Unmarshal(content, &rc); err != nil {
+		return Rule{}, fmt.Errorf("invalid rule: %w", err)
+	}
+	if rc.Kind != kind {
+		return Rule{}, fmt.Errorf("not a rule: kind %q", rc.Kind)
+	}
+	rule := rc.Rule
+	rule.ID = id
+	if err := rule.Validate(); err != nil {
+		return Rule{}, err
+	}
+	return rule, nil
+}
+
+// Sort orders rules by name, then ID, which is the order they apply in
+func Sort(rules []Rule) {
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].Name != rules[j].Name {
+			return rules[i].Name < rules[j].Name
+		}
+		return rules[i].ID.String() < rules[j].ID.String()
+	})
+}
+
+// Matches reports whether an entry meets all of the rule's conditions
+func (r *Rule) Matches(entryType string, content []byte, tags []string) bool {
+	if r.Type != "" && r.Type != entryType {
+		return false
+	}
+	if r.Tag != "" && !slices.Contains(tags, r.Tag) {
+		return false
+	}
+	if r.pattern == nil {
+		return true
+	}
+	if r.Field == "" {
+		return r.pattern.Match(content)
+	}
+	var fields map[string]interface{}
+	if json.Unmarshal(content, &fields) != nil {
+		return false
+	}
+	value, ok := fields[r.Field].(string)
+	return ok && r.pattern.MatchString(value)
+}
+
+// Apply runs rules, in order, on an entry. It returns the new content and
+// tags, and whether either changed. Set only touches JSON object content,
+// and only fields it does not have yet, so hand edits are kept.
+func Apply(rules []Rule, entryType string, content []byte, tags []string) ([]byte, []string, bool) {
+	newTags := slices.Clone(tags)
+	var set map[string]interface{}
+	for i := range rules {
+		r := &rules[i]
+		if !r.Matches(entryType, content, tags) {
+			continue
+		}
+		for _, tag := range r.AddTags {
+			if !slices.Contains(newTags, tag) {
+				newTags = append(newTags, tag)
+			}
+		}
+		for field, value := range r.Set {
+			if set == nil {
+				set = make(map[string]interface{})
+			}
+			if _, ok := set[field]; !ok {
+				set[field] = value
+			}
+		}
+	}
+
+	newContent := content
+	if len(set) > 0 {
+		newContent = fillFields(content, set)
+	}
+	changed := len(newTags) != len(tags) || len(newContent) != len(content) || string(newContent) != string(content)
+	if !changed {
+		return content, tags, false
+	}
+	return newContent, newTags, true
+}
+
+// fillFields adds missing fields to JSON object content. Other content is
+// returned unchanged.
+func fillFields(content []byte, set map[string]interface{}) []byte {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(content, &fields) != nil || fields == nil {
+		return content
+	}
+	added := false
+	for field, value := range set {
+		if _, ok := fields[field]; ok {
+			continue
+		}
+		raw, err := json.Marshal(value)
+		if err != nil {
+			continue
+		}
+		fields[field] = raw
+		added = true
+	}
+	if !added {
+		return content
+	}
+	out, err := json.Marshal(fields)
+	if err != nil {
+		return content
+	}
+	return out
+}
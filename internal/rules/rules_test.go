@@ -0,0 +1,82 @@
+package rules
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func mustRule(t *testing.T, r Rule) Rule {
+	t.Helper()
+	if err := r.Validate(); err != nil {
+		t.Fatalf("invalid rule %+v: %v", r, err)
+	}
+	return r
+}
+
+func TestValidate(t *testing.T) {
+	invalid := []Rule{
+		{AddTags: []string{"x"}},               // No condition
+		{Type: "log"},                          // No action
+		{Field: "url", AddTags: []string{"x"}}, // Field without pattern
+		{Pattern: "(", AddTags: []string{"x"}}, // Bad regexp
+	}
+	for _, r := range invalid {
+		if err := r.Validate(); err == nil {
+			t.Errorf("expected %+v to be invalid", r)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	list := []Rule{
+		mustRule(t, Rule{Type: "log", Pattern: `(?i)error`, AddTags: []string{"errors"}}),
+		mustRule(t, Rule{Field: "url", Pattern: `github\.com`, AddTags: []string{"code"}, Set: map[string]interface{}{"source": "github"}}),
+		mustRule(t, Rule{Tag: "errors", AddTags: []string{"never"}}), // Sees tags as given
+	}
+
+	tests := []struct {
+		name      string
+		entryType string
+		content   string
+		tags      []string
+		wantBody  string
+		wantTags  []string
+		changed   bool
+	}{
+		{"log match", "log", "ERROR: disk full", []string{"ops"}, "ERROR: disk full", []string{"ops", "errors"}, true},
+		{"type mismatch", "note", "error", nil, "error", nil, false},
+		{"field match", "note", `{"url":"https://github.com/x"}`, nil, `{"source":"github","url":"https://github.com/x"}`, []string{"code"}, true},
+		{"field kept", "note", `{"url":"https://github.com/x","source":"me"}`, []string{"code"}, `{"url":"https://github.com/x","source":"me"}`, []string{"code"}, false},
+		{"not json", "note", "github.com", nil, "github.com", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, tags, changed := Apply(list, tt.entryType, []byte(tt.content), tt.tags)
+			if string(content) != tt.wantBody || !reflect.DeepEqual(tags, tt.wantTags) || changed != tt.changed {
+				t.Errorf("got %q %v %v, want %q %v %v", content, tags, changed, tt.wantBody, tt.wantTags, tt.changed)
+			}
+		})
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	rule := Rule{Name: "bookmarks", Type: "note", Field: "url", Pattern: "^https", AddTags: []string{"web"}}
+	content, err := Encode(rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := uuid.New()
+	got, err := Decode(id, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != id || got.Name != rule.Name || got.Pattern != rule.Pattern || !got.Matches("note", []byte(`{"url":"https://a"}`), nil) {
+		t.Errorf("round trip lost data: %+v", got)
+	}
+
+	if _, err := Decode(id, []byte(`{"kind":"theme"}`)); err == nil {
+		t.Error("expected other config kinds to be rejected")
+	}
+}
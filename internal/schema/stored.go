@@ -0,0 +1,74 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// Tag marks the config entries holding schemas saved in a vault
+const Tag = "schema"
+
+// kind identifies schema content among config entries
+const kind = "schema"
+
+// Stored is an entry type's schema saved in a vault, so that it persists
+// and syncs to the vault's other devices
+type Stored struct {
+	ID         uuid.UUID       `json:"-"` // ID of the config entry holding the schema
+	Type       string          `json:"type"`
+	Definition json.RawMessage `json:"definition"`
+}
+
+// storedContent is the content of a config entry holding a schema
+type storedContent struct {
+	Kind string `json:"kind"`
+	Stored
+}
+
+// Check compiles a schema definition, returning why it is invalid
+func Check(definition []byte) error {
+	if _, err := gojsonschema.NewSchema(gojsonschema.NewBytesLoader(definition)); err != nil {
+		return fmt.Errorf("invalid schema: %w", err)
+	}
+	return nil
+}
+
+// EncodeStored serializes a schema as config entry content
+func EncodeStored(s Stored) ([]byte, error) {
+	return json.Marshal(storedContent{Kind: kind, Stored: s})
+}
+
+// DecodeStored parses and checks the content of a config entry holding a
+// schema
+func DecodeStored(id uuid.UUID, content []byte) (Stored, error) {
+	var sc storedContent
+	if err := json.Unmarshal(content, &sc); err != nil {
+		return Stored{}, fmt.Errorf("invalid stored schema: %w", err)
+	}
+	if sc.Kind != kind {
+		return Stored{}, fmt.Errorf("not a schema: kind %q", sc.Kind)
+	}
+	if sc.Type == "" {
+		return Stored{}, fmt.Errorf("stored schema has no entry type")
+	}
+	if err := Check(sc.Definition); err != nil {
+		return Stored{}, err
+	}
+	s := sc.Stored
+	s.ID = id
+	return s, nil
+}
+
+// SortStored orders schemas by entry type, then ID
+func SortStored(list []Stored) {
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Type != list[j].Type {
+			return list[i].Type < list[j].Type
+		}
+		return list[i].ID.String() < list[j].ID.String()
+	})
+}
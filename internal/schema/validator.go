@@ -2,8 +2,10 @@
 package schema
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"slices"
 	"sync"
 
 	"github.com/xeipuuv/gojsonschema"
@@ -16,6 +18,8 @@ type Schema struct {
 	Version     int             `json:"version"`
 	Definition  json.RawMessage `json:"definition"`
 	compiled    *gojsonschema.Schema
+	sensitive   []string // Properties marked "sensitive": true
+	migrator    Migrator // Upgrades content of older versions (nil = none)
 }
 
 // ValidationError represents a schema validation error
@@ -59,6 +63,7 @@ func (r *Registry) Register(entryType string, schema *Schema) error {
 		return fmt.Errorf("invalid schema: %w", err)
 	}
 	schema.compiled = compiled
+	schema.sensitive = SensitiveFields(schema.Definition)
 
 	r.schemas[entryType] = schema
 	return nil
@@ -140,6 +145,39 @@ func (s *Schema) Validate(content []byte) ValidationResult {
 	}
 }
 
+// Sensitive returns the sensitive properties of an entry type's schema:
+// the top-level properties marked "sensitive": true, whose values are
+// masked outside the vault (see MaskFields)
+func (r *Registry) Sensitive(entryType string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if schema, ok := r.schemas[entryType]; ok {
+		return schema.sensitive
+	}
+	return nil
+}
+
+// SensitiveFields lists the top-level properties a schema definition
+// marks "sensitive": true, a keyword validation ignores
+func SensitiveFields(definition []byte) []string {
+	var def struct {
+		Properties map[string]struct {
+			Sensitive bool `json:"sensitive"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal(definition, &def); err != nil {
+		return nil
+	}
+	var fields []string
+	for name, prop := range def.Properties {
+		if prop.Sensitive {
+			fields = append(fields, name)
+		}
+	}
+	slices.Sort(fields)
+	return fields
+}
+
 // HasSchema checks if a schema is registered for an entry type
 func (r *Registry) HasSchema(entryType string) bool {
 	r.mu.RLock()
@@ -211,9 +249,67 @@ var CredentialSchema = []byte(`{
 	"properties": {
 		"service": {"type": "string", "minLength": 1},
 		"username": {"type": "string", "minLength": 1},
-		"password": {"type": "string"},
+		"password": {"type": "string", "sensitive": true},
 		"url": {"type": "string", "format": "uri"},
 		"notes": {"type": "string"},
-		"totp_secret": {"type": "string"}
+		"totp_secret": {"type": "string", "sensitive": true}
 	}
 }`)
+
+// Builtin maps entry types to the schemas shipped for them
+var Builtin = map[string][]byte{
+	"task":       TaskSchema,
+	"contact":    ContactSchema,
+	"bookmark":   BookmarkSchema,
+	"credential": CredentialSchema,
+}
+
+// CredentialSecrets are the credential fields MaskCredential hides
+var CredentialSecrets = SensitiveFields(CredentialSchema)
+
+// SecretMask replaces secret values in masked output
+const SecretMask = "********"
+
+// MaskCredential returns credential content with its non-empty secret
+// fields replaced by SecretMask, for display
+func MaskCredential(content []byte) []byte {
+	return MaskFields(content, CredentialSecrets)
+}
+
+// MaskFields returns JSON object content with the non-empty values of
+// fields replaced by SecretMask, keeping the field order. Content that
+// is not a JSON object is returned as it is.
+func MaskFields(content []byte, fields []string) []byte {
+	if len(fields) == 0 {
+		return content
+	}
+	dec := json.NewDecoder(bytes.NewReader(content))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return content
+	}
+	var out bytes.Buffer
+	out.WriteByte('{')
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return content
+		}
+		key, _ := tok.(string)
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return content
+		}
+		if slices.Contains(fields, key) && string(value) != `""` && string(value) != "null" {
+			value = json.RawMessage(`"` + SecretMask + `"`)
+		}
+		if out.Len() > 1 {
+			out.WriteByte(',')
+		}
+		name, _ := json.Marshal(key)
+		out.Write(name)
+		out.WriteByte(':')
+		out.Write(value)
+	}
+	out.WriteByte('}')
+	return out.Bytes()
+}
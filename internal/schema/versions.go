@@ -0,0 +1,76 @@
+package schema
+
+import "fmt"
+
+// Migrator upgrades entry content written against an older version of a
+// schema. MigrateContent is called with the version the content was
+// written against (0 if unknown) and the registered version; it must
+// return content valid against the registered version.
+type Migrator interface {
+	MigrateContent(from, to int, content []byte) ([]byte, error)
+}
+
+// MigratorFunc adapts a function to Migrator
+type MigratorFunc func(from, to int, content []byte) ([]byte, error)
+
+// MigrateContent calls f(from, to, content)
+func (f MigratorFunc) MigrateContent(from, to int, content []byte) ([]byte, error) {
+	return f(from, to, content)
+}
+
+// RegisterVersion registers version (1 or more) of an entry type's
+// schema, replacing the registered one, which must not be newer. migrator
+// upgrades content written against older versions (nil = none).
+func (r *Registry) RegisterVersion(entryType string, version int, definition []byte, migrator Migrator) error {
+	if version < 1 {
+		return fmt.Errorf("invalid schema version %d", version)
+	}
+	if current := r.Version(entryType); version < current {
+		return fmt.Errorf("schema version %d is older than registered version %d", version, current)
+	}
+	return r.Register(entryType, &Schema{
+		ID:         entryType + "-schema",
+		Name:       fmt.Sprintf("%s-schema-v%d", entryType, version),
+		Version:    version,
+		Definition: definition,
+		migrator:   migrator,
+	})
+}
+
+// Version returns the registered schema version of an entry type (0 if
+// it has no schema)
+func (r *Registry) Version(entryType string) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if schema, ok := r.schemas[entryType]; ok {
+		return schema.Version
+	}
+	return 0
+}
+
+// NeedsMigration reports whether content written against version from
+// of entryType's schema can be upgraded to the registered version
+func (r *Registry) NeedsMigration(entryType string, from int) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	schema, ok := r.schemas[entryType]
+	return ok && schema.migrator != nil && from < schema.Version
+}
+
+// Migrate upgrades content written against version from of entryType's
+// schema, returning it with the version it now matches. Content is
+// returned as it is when no migration is needed.
+func (r *Registry) Migrate(entryType string, from int, content []byte) ([]byte, int, error) {
+	r.mu.RLock()
+	schema, ok := r.schemas[entryType]
+	r.mu.RUnlock()
+	if !ok || schema.migrator == nil || from >= schema.Version {
+		return content, from, nil
+	}
+
+	migrated, err := schema.migrator.MigrateContent(from, schema.Version, content)
+	if err != nil {
+		return nil, from, fmt.Errorf("failed to migrate %s content from version %d to %d: %w", entryType, from, schema.Version, err)
+	}
+	return migrated, schema.Version, nil
+}
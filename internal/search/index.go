@@ -2,14 +2,28 @@
 package search
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
 
 	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/search/query"
 	"github.com/google/uuid"
+	bolt "go.etcd.io/bbolt"
 )
 
+// ErrIndexLocked is returned when another process has the index open
+var ErrIndexLocked = errors.New("search index is in use by another process")
+
+// lockTimeout bounds how long opening waits for another process's lock
+const lockTimeout = "1s"
+
 // Index wraps Bleve for full-text search
 type Index struct {
 	index bleve.Index
@@ -22,42 +36,71 @@ type Document struct {
 	Type    string   `json:"type"`
 	Content string   `json:"content"`
 	Tags    []string `json:"tags"`
+	Month   string   `json:"month,omitempty"` // YYYY-MM the entry was first saved, for faceting
+
+	Archived bool `json:"archived,omitempty"` // Left out of searches unless SearchOptions.Archived
+}
+
+// Facet names returned in Results.Facets
+const (
+	FacetType  = "type"
+	FacetTag   = "tag"
+	FacetMonth = "month"
+)
+
+// facetFields maps facet names to indexed fields
+var facetFields = map[string]string{
+	FacetType:  "type",
+	FacetTag:   "tags",
+	FacetMonth: "month",
+}
+
+// DefaultAnalyzer is the content analyzer used when none is configured
+const DefaultAnalyzer = "standard"
+
+// IndexConfig configures how documents are analyzed
+type IndexConfig struct {
+	// Analyzer is the Bleve analyzer for content, e.g. "standard",
+	// "simple", "web" or a language analyzer such as "en" (stemming).
+	// Empty means DefaultAnalyzer.
+	Analyzer string
+}
+
+func (c IndexConfig) analyzer() string {
+	if c.Analyzer == "" {
+		return DefaultAnalyzer
+	}
+	return c.Analyzer
 }
 
 // NewIndex creates or opens a Bleve index at the given path
 func NewIndex(dataDir string) (*Index, error) {
+	return NewIndexWithConfig(dataDir, IndexConfig{})
+}
+
+// NewIndexWithConfig creates or opens a Bleve index at the given path.
+// An existing index built with a different analyzer is recreated empty,
+// so callers should re-index when DocCount reports 0.
+func NewIndexWithConfig(dataDir string, cfg IndexConfig) (*Index, error) {
 	indexPath := filepath.Join(dataDir, "search.bleve")
 
 	var idx bleve.Index
 	var err error
 
 	// Try to open existing index
-	idx, err = bleve.Open(indexPath)
+	idx, err = bleve.OpenUsing(indexPath, map[string]interface{}{"bolt_timeout": lockTimeout})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return nil, ErrIndexLocked
+	}
+	if err == nil && contentAnalyzer(idx) != cfg.analyzer() {
+		idx.Close()
+		if err := os.RemoveAll(indexPath); err != nil {
+			return nil, fmt.Errorf("failed to reset index: %w", err)
+		}
+		err = bleve.ErrorIndexPathDoesNotExist
+	}
 	if err == bleve.ErrorIndexPathDoesNotExist {
-		// Create new index
-		mapping := bleve.NewIndexMapping()
-		
-		// Custom document mapping for better search
-		docMapping := bleve.NewDocumentMapping()
-		
-		// Content field - full text searchable
-		contentField := bleve.NewTextFieldMapping()
-		contentField.Analyzer = "standard"
-		docMapping.AddFieldMappingsAt("content", contentField)
-		
-		// Tags field - keyword searchable
-		tagsField := bleve.NewTextFieldMapping()
-		tagsField.Analyzer = "keyword"
-		docMapping.AddFieldMappingsAt("tags", tagsField)
-		
-		// Type field - keyword
-		typeField := bleve.NewTextFieldMapping()
-		typeField.Analyzer = "keyword"
-		docMapping.AddFieldMappingsAt("type", typeField)
-		
-		mapping.AddDocumentMapping("entry", docMapping)
-		
-		idx, err = bleve.New(indexPath, mapping)
+		idx, err = bleve.New(indexPath, newMapping(cfg))
 		if err != nil {
 			return nil, fmt.Errorf("failed to create index: %w", err)
 		}
@@ -71,25 +114,106 @@ func NewIndex(dataDir string) (*Index, error) {
 	}, nil
 }
 
-// NewMemoryIndex creates an in-memory index for testing
+// NewMemoryIndex creates an in-memory index (for tests and encrypted vaults,
+// where plaintext must not be written to disk)
 func NewMemoryIndex() (*Index, error) {
-	mapping := bleve.NewIndexMapping()
-	idx, err := bleve.NewMemOnly(mapping)
+	return NewMemoryIndexWithConfig(IndexConfig{})
+}
+
+// NewMemoryIndexWithConfig creates an in-memory index with the given config
+func NewMemoryIndexWithConfig(cfg IndexConfig) (*Index, error) {
+	idx, err := bleve.NewMemOnly(newMapping(cfg))
 	if err != nil {
 		return nil, err
 	}
 	return &Index{index: idx}, nil
 }
 
+// contentAnalyzer returns the analyzer an existing index uses for content
+func contentAnalyzer(idx bleve.Index) string {
+	impl, ok := idx.Mapping().(*mapping.IndexMappingImpl)
+	if !ok || impl.DefaultMapping == nil {
+		return ""
+	}
+	content, ok := impl.DefaultMapping.Properties["content"]
+	if !ok || len(content.Fields) == 0 {
+		return ""
+	}
+	return content.Fields[0].Analyzer
+}
+
+// newMapping builds the index mapping used for entry documents
+func newMapping(cfg IndexConfig) mapping.IndexMapping {
+	indexMapping := bleve.NewIndexMapping()
+
+	// Custom document mapping for better search
+	docMapping := bleve.NewDocumentMapping()
+
+	// Content field - full text searchable
+	contentField := bleve.NewTextFieldMapping()
+	contentField.Analyzer = cfg.analyzer()
+	docMapping.AddFieldMappingsAt("content", contentField)
+
+	// Tags field - keyword searchable
+	tagsField := bleve.NewTextFieldMapping()
+	tagsField.Analyzer = "keyword"
+	docMapping.AddFieldMappingsAt("tags", tagsField)
+
+	// Type field - keyword
+	typeField := bleve.NewTextFieldMapping()
+	typeField.Analyzer = "keyword"
+	typeField.IncludeInAll = false
+	docMapping.AddFieldMappingsAt("type", typeField)
+
+	// Month field - keyword, only used for filtering and facets
+	monthField := bleve.NewTextFieldMapping()
+	monthField.Analyzer = "keyword"
+	monthField.IncludeInAll = false
+	docMapping.AddFieldMappingsAt("month", monthField)
+
+	// Archived flag, only used for filtering
+	archivedField := bleve.NewBooleanFieldMapping()
+	archivedField.IncludeInAll = false
+	docMapping.AddFieldMappingsAt("archived", archivedField)
+
+	// ID is the document key, no need to index it
+	idField := bleve.NewTextFieldMapping()
+	idField.Index = false
+	idField.IncludeInAll = false
+	docMapping.AddFieldMappingsAt("id", idField)
+
+	// Documents don't carry a type name, so this must be the default mapping
+	indexMapping.DefaultMapping = docMapping
+	return indexMapping
+}
+
 // IndexDocument adds or updates a document in the index
 func (i *Index) IndexDocument(id uuid.UUID, entryType string, content []byte, tags []string) error {
-	doc := Document{
+	return i.Index(Document{
 		ID:      id.String(),
 		Type:    entryType,
 		Content: string(content),
 		Tags:    tags,
+	})
+}
+
+// Index adds or updates a document in the index
+func (i *Index) Index(doc Document) error {
+	return i.index.Index(doc.ID, doc)
+}
+
+// IndexBatch indexes and deletes documents in a single batch
+func (i *Index) IndexBatch(docs []Document, deletes []uuid.UUID) error {
+	batch := i.index.NewBatch()
+	for _, doc := range docs {
+		if err := batch.Index(doc.ID, doc); err != nil {
+			return err
+		}
 	}
-	return i.index.Index(id.String(), doc)
+	for _, id := range deletes {
+		batch.Delete(id.String())
+	}
+	return i.index.Batch(batch)
 }
 
 // DeleteDocument removes a document from the index
@@ -97,11 +221,53 @@ func (i *Index) DeleteDocument(id uuid.UUID) error {
 	return i.index.Delete(id.String())
 }
 
+// watermarkKey is the internal key the watermark is kept under
+var watermarkKey = []byte("acorde.watermark")
+
+// Watermark returns what SetWatermark last saved with the index (nil if
+// nothing)
+func (i *Index) Watermark() ([]byte, error) {
+	return i.index.GetInternal(watermarkKey)
+}
+
+// SetWatermark saves an opaque description of the state the index is
+// current with, for whoever opens it next
+func (i *Index) SetWatermark(watermark []byte) error {
+	return i.index.SetInternal(watermarkKey, watermark)
+}
+
+// OnDisk reports whether the index outlives the process (see NewIndex)
+func (i *Index) OnDisk() bool {
+	return i.path != ""
+}
+
+// DocCount returns the number of indexed documents
+func (i *Index) DocCount() (uint64, error) {
+	return i.index.DocCount()
+}
+
+// Mode selects how query terms are matched
+type Mode string
+
+const (
+	ModeExact  Mode = ""       // Terms match analyzed tokens exactly
+	ModePrefix Mode = "prefix" // Terms match tokens starting with them ("meet" -> "meeting")
+	ModeFuzzy  Mode = "fuzzy"  // Terms match tokens within a small edit distance ("meetng" -> "meeting")
+)
+
+// fuzziness is the edit distance used in ModeFuzzy
+const fuzziness = 2
+
 // SearchOptions configures a search query
 type SearchOptions struct {
-	Type  string   // Filter by entry type
-	Tags  []string // Filter by tags
-	Limit int      // Max results (default 50)
+	Type   string   // Filter by entry type
+	Tags   []string // Filter by tags
+	Limit  int      // Max results (default 50)
+	Offset int      // Skip first N hits
+	Facets bool     // Compute facet counts by type, tag and month
+	Mode   Mode     // Term matching mode (default exact)
+
+	Archived bool // Include archived documents
 }
 
 // SearchResult represents a search hit
@@ -110,17 +276,154 @@ type SearchResult struct {
 	Score float64
 }
 
+// FacetCount is the number of matching documents for one facet term
+type FacetCount struct {
+	Term  string `json:"term"`
+	Count int    `json:"count"`
+}
+
+// Results contains the hits of a search and, if requested, facet counts
+type Results struct {
+	Hits   []SearchResult
+	Total  uint64                  // Total matches (ignoring Limit/Offset)
+	Facets map[string][]FacetCount // Keyed by FacetType, FacetTag, FacetMonth
+}
+
+// maxFacetTerms caps the number of terms returned per facet
+const maxFacetTerms = 50
+
+// tagFieldRe matches "tag:" at the start of a query clause, so users can
+// write tag:work as well as tags:work
+var tagFieldRe = regexp.MustCompile(`^([+\-]?)tag:`)
+
+// normalizeQuery rewrites a user query into Bleve query string syntax.
+// Clauses are required by default (tag:work content:"meeting notes" means
+// both must match); clauses prefixed with - are excluded. In prefix and
+// fuzzy modes, plain (unquoted) terms become wildcard or fuzzy terms.
+func normalizeQuery(q string, mode Mode) string {
+	clauses := splitClauses(q)
+	for i, clause := range clauses {
+		clause = tagFieldRe.ReplaceAllString(clause, "${1}tags:")
+		if clause[0] != '+' && clause[0] != '-' {
+			clause = "+" + clause
+		}
+		clauses[i] = applyMode(clause, mode)
+	}
+	return strings.Join(clauses, " ")
+}
+
+// applyMode decorates the term of a single clause for prefix/fuzzy matching.
+// Quoted phrases and terms that already use query operators are left alone.
+func applyMode(clause string, mode Mode) string {
+	if mode == ModeExact || strings.ContainsAny(clause, "\"*?~^/<>=") {
+		return clause
+	}
+
+	// Split "+field:term" into prefix and term
+	split := 1
+	if idx := strings.IndexByte(clause, ':'); idx >= 0 {
+		split = idx + 1
+	}
+	head, term := clause[:split], clause[split:]
+	if term == "" {
+		return clause
+	}
+
+	// Wildcard and fuzzy terms are not analyzed, so match the
+	// lowercased tokens the analyzers produce
+	term = strings.ToLower(term)
+	switch mode {
+	case ModePrefix:
+		return head + term + "*"
+	case ModeFuzzy:
+		return head + term + "~" + strconv.Itoa(fuzziness)
+	}
+	return clause
+}
+
+// splitClauses splits a query on whitespace outside of double quotes
+func splitClauses(q string) []string {
+	var clauses []string
+	var current strings.Builder
+	inQuotes := false
+	for _, r := range q {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+			current.WriteRune(r)
+		case unicode.IsSpace(r) && !inQuotes:
+			if current.Len() > 0 {
+				clauses = append(clauses, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		clauses = append(clauses, current.String())
+	}
+	return clauses
+}
+
 // Search performs a full-text search
-func (i *Index) Search(query string, opts SearchOptions) ([]SearchResult, error) {
+func (i *Index) Search(queryStr string, opts SearchOptions) ([]SearchResult, error) {
+	results, err := i.SearchFaceted(queryStr, opts)
+	if err != nil {
+		return nil, err
+	}
+	return results.Hits, nil
+}
+
+// SearchFaceted performs a full-text search and optionally computes facets.
+// The query uses Bleve query string syntax: bare terms match any text field,
+// and terms can be scoped to a field, e.g. tag:work content:"meeting notes".
+// All clauses must match unless prefixed with -.
+func (i *Index) SearchFaceted(queryStr string, opts SearchOptions) (*Results, error) {
 	// Build query
-	q := bleve.NewMatchQuery(query)
-	q.SetField("content")
+	var q query.Query
+	if strings.TrimSpace(queryStr) == "" {
+		q = bleve.NewMatchAllQuery()
+	} else {
+		q = bleve.NewQueryStringQuery(normalizeQuery(queryStr, opts.Mode))
+	}
+
+	// Apply filters
+	var filters []query.Query
+	if opts.Type != "" {
+		tq := bleve.NewTermQuery(opts.Type)
+		tq.SetField("type")
+		filters = append(filters, tq)
+	}
+	for _, tag := range opts.Tags {
+		tq := bleve.NewTermQuery(tag)
+		tq.SetField("tags")
+		filters = append(filters, tq)
+	}
+	if len(filters) > 0 {
+		q = bleve.NewConjunctionQuery(append([]query.Query{q}, filters...)...)
+	}
+	if !opts.Archived {
+		aq := bleve.NewBoolFieldQuery(true)
+		aq.SetField("archived")
+		bq := bleve.NewBooleanQuery()
+		bq.AddMust(q)
+		bq.AddMustNot(aq)
+		q = bq
+	}
 
 	searchReq := bleve.NewSearchRequest(q)
 	searchReq.Size = opts.Limit
 	if searchReq.Size <= 0 {
 		searchReq.Size = 50
 	}
+	searchReq.From = opts.Offset
+
+	if opts.Facets {
+		for name, field := range facetFields {
+			searchReq.AddFacet(name, bleve.NewFacetRequest(field, maxFacetTerms))
+		}
+	}
 
 	// Execute search
 	searchRes, err := i.index.Search(searchReq)
@@ -129,18 +432,34 @@ func (i *Index) Search(query string, opts SearchOptions) ([]SearchResult, error)
 	}
 
 	// Convert results
-	results := make([]SearchResult, 0, len(searchRes.Hits))
+	results := &Results{
+		Hits:  make([]SearchResult, 0, len(searchRes.Hits)),
+		Total: searchRes.Total,
+	}
 	for _, hit := range searchRes.Hits {
 		id, err := uuid.Parse(hit.ID)
 		if err != nil {
 			continue
 		}
-		results = append(results, SearchResult{
+		results.Hits = append(results.Hits, SearchResult{
 			ID:    id,
 			Score: hit.Score,
 		})
 	}
 
+	if opts.Facets {
+		results.Facets = make(map[string][]FacetCount, len(facetFields))
+		for name := range facetFields {
+			counts := []FacetCount{}
+			if facet, ok := searchRes.Facets[name]; ok {
+				for _, term := range facet.Terms.Terms() {
+					counts = append(counts, FacetCount{Term: term.Term, Count: term.Count})
+				}
+			}
+			results.Facets[name] = counts
+		}
+	}
+
 	return results, nil
 }
 
@@ -0,0 +1,279 @@
+package search
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// maxTitleLength caps the length of extracted titles
+const maxTitleLength = 120
+
+// TitleDoc is the lightweight metadata kept per entry for quick-open
+type TitleDoc struct {
+	ID    uuid.UUID `json:"id"`
+	Title string    `json:"title"`
+	Type  string    `json:"type"`
+	Tags  []string  `json:"tags"`
+
+	// Archived entries keep their title for Get but are never matched
+	Archived bool `json:"-"`
+
+	// Links are the targets of the entry's [[wiki links]]: IDs or titles
+	Links []string `json:"-"`
+}
+
+// TitleMatch is a quick-open result
+type TitleMatch struct {
+	TitleDoc
+	Score int `json:"score"`
+}
+
+// TitleIndex is an in-memory index of entry titles and metadata for
+// quick-open style fuzzy matching ("mtg nts" matches "meeting notes").
+// It is kept separate from the full-text index so it stays small and fast.
+type TitleIndex struct {
+	docs map[uuid.UUID]TitleDoc
+	mu   sync.RWMutex
+}
+
+// NewTitleIndex creates an empty title index
+func NewTitleIndex() *TitleIndex {
+	return &TitleIndex{docs: make(map[uuid.UUID]TitleDoc)}
+}
+
+// Put adds or replaces a document
+func (t *TitleIndex) Put(doc TitleDoc) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.docs[doc.ID] = doc
+}
+
+// Remove deletes a document
+func (t *TitleIndex) Remove(id uuid.UUID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.docs, id)
+}
+
+// Len returns the number of documents
+func (t *TitleIndex) Len() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return len(t.docs)
+}
+
+// Get returns the document of an entry
+func (t *TitleIndex) Get(id uuid.UUID) (TitleDoc, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	doc, ok := t.docs[id]
+	return doc, ok
+}
+
+// LinkedFrom returns the IDs of the documents that link to a document,
+// by its ID or its title (case insensitive), ordered by ID
+func (t *TitleIndex) LinkedFrom(id uuid.UUID) []uuid.UUID {
+	t.mu.RLock()
+	target := t.docs[id]
+	var ids []uuid.UUID
+	for _, doc := range t.docs {
+		if doc.ID == id {
+			continue
+		}
+		for _, link := range doc.Links {
+			if link == id.String() || (target.Title != "" && strings.EqualFold(link, target.Title)) {
+				ids = append(ids, doc.ID)
+				break
+			}
+		}
+	}
+	t.mu.RUnlock()
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i].String() < ids[j].String() })
+	return ids
+}
+
+// FindTitle returns the documents titled text and those whose title
+// contains it (case insensitive), each ordered by title and ID
+func (t *TitleIndex) FindTitle(text string) (exact, containing []TitleDoc) {
+	text = strings.ToLower(strings.TrimSpace(text))
+	t.mu.RLock()
+	for _, doc := range t.docs {
+		if doc.Archived {
+			continue
+		}
+		title := strings.ToLower(doc.Title)
+		switch {
+		case title == text:
+			exact = append(exact, doc)
+		case strings.Contains(title, text):
+			containing = append(containing, doc)
+		}
+	}
+	t.mu.RUnlock()
+
+	for _, docs := range [][]TitleDoc{exact, containing} {
+		sort.Slice(docs, func(i, j int) bool {
+			if docs[i].Title != docs[j].Title {
+				return docs[i].Title < docs[j].Title
+			}
+			return docs[i].ID.String() < docs[j].ID.String()
+		})
+	}
+	return exact, containing
+}
+
+// Match returns documents whose title, type or tags fuzzy-match the query,
+// best matches first. limit <= 0 means no limit.
+func (t *TitleIndex) Match(query string, limit int) []TitleMatch {
+	query = strings.ToLower(strings.Join(strings.Fields(query), ""))
+
+	t.mu.RLock()
+	var matches []TitleMatch
+	for _, doc := range t.docs {
+		if doc.Archived {
+			continue
+		}
+		score, ok := bestScore(query, doc)
+		if ok {
+			matches = append(matches, TitleMatch{TitleDoc: doc, Score: score})
+		}
+	}
+	t.mu.RUnlock()
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		if len(matches[i].Title) != len(matches[j].Title) {
+			return len(matches[i].Title) < len(matches[j].Title)
+		}
+		return matches[i].ID.String() < matches[j].ID.String()
+	})
+
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches
+}
+
+// bestScore scores the query against the title, and against tags and type
+// at a discount so title matches rank first
+func bestScore(query string, doc TitleDoc) (int, bool) {
+	if query == "" {
+		return 0, true
+	}
+
+	best, found := FuzzyScore(query, doc.Title)
+	candidates := append([]string{doc.Type}, doc.Tags...)
+	for _, c := range candidates {
+		if score, ok := FuzzyScore(query, c); ok {
+			score /= 2
+			if !found || score > best {
+				best, found = score, true
+			}
+		}
+	}
+	return best, found
+}
+
+// FuzzyScore reports whether the characters of pattern appear in order in
+// text (case insensitive, whitespace in pattern ignored) and scores the
+// match. Matches at word starts and consecutive runs score higher, so
+// "mtg nts" scores well against "Meeting notes".
+func FuzzyScore(pattern, text string) (int, bool) {
+	pattern = strings.ToLower(strings.Join(strings.Fields(pattern), ""))
+	if pattern == "" {
+		return 0, true
+	}
+	lower := strings.ToLower(text)
+
+	score := 0
+	pi := 0
+	prevMatched := false
+	prev := ' '
+	for i, r := range lower {
+		if pi >= len(pattern) {
+			break
+		}
+		pr, size := utf8.DecodeRuneInString(pattern[pi:])
+		if r == pr {
+			score += 1
+			if isWordStart(prev, i) {
+				score += 8
+			}
+			if prevMatched {
+				score += 4
+			}
+			pi += size
+			prevMatched = true
+		} else {
+			prevMatched = false
+		}
+		prev = r
+	}
+
+	if pi < len(pattern) {
+		return 0, false
+	}
+
+	// Prefer shorter texts for the same match
+	score -= len(lower) / 16
+	return score, true
+}
+
+func isWordStart(prev rune, i int) bool {
+	return i == 0 || !(unicode.IsLetter(prev) || unicode.IsDigit(prev))
+}
+
+// TitleFields are the properties of JSON content taken as its title, in
+// order: those of the builtin schemas (task and bookmark title, contact
+// name, credential service)
+var TitleFields = []string{"title", "name", "service"}
+
+// EntryTitle returns the display title of entry content: the first
+// non-empty TitleFields property of a JSON object, or else the first line
+// of text (see ExtractTitle). JSON objects without one have no title.
+func EntryTitle(content []byte) string {
+	trimmed := bytes.TrimSpace(content)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		var fields map[string]any
+		if json.Unmarshal(trimmed, &fields) == nil {
+			for _, key := range TitleFields {
+				if title, ok := fields[key].(string); ok && strings.TrimSpace(title) != "" {
+					return capTitle(strings.Join(strings.Fields(title), " "))
+				}
+			}
+			return ""
+		}
+	}
+	return ExtractTitle(content)
+}
+
+// ExtractTitle returns the first non-empty line of content, trimmed of
+// markdown heading markers and capped in length
+func ExtractTitle(content []byte) string {
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(line), "#"))
+		if line == "" {
+			continue
+		}
+		return capTitle(line)
+	}
+	return ""
+}
+
+// capTitle cuts a title to maxTitleLength runes
+func capTitle(title string) string {
+	if utf8.RuneCountInString(title) > maxTitleLength {
+		title = string([]rune(title)[:maxTitleLength])
+	}
+	return title
+}
@@ -5,6 +5,8 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"fmt"
+	"os"
+	"path/filepath"
 
 	"github.com/amaydixit11/acorde/pkg/crypto"
 	"github.com/google/uuid"
@@ -39,6 +41,36 @@ func GenerateKeyPair() (*KeyPair, error) {
 	return &KeyPair{Private: private, Public: public}, nil
 }
 
+// LoadOrCreateKeyPair loads a device key pair from path (the raw private
+// key), generating and saving one if it does not exist
+func LoadOrCreateKeyPair(path string) (*KeyPair, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		if len(data) != 32 {
+			return nil, fmt.Errorf("invalid device key file %s", path)
+		}
+		kp := &KeyPair{}
+		copy(kp.Private[:], data)
+		curve25519.ScalarBaseMult(&kp.Public, &kp.Private)
+		return kp, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read device key: %w", err)
+	}
+
+	kp, err := GenerateKeyPair()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := os.WriteFile(path, kp.Private[:], 0600); err != nil {
+		return nil, fmt.Errorf("failed to save device key: %w", err)
+	}
+	return kp, nil
+}
+
 // EntryKey represents a per-entry encryption key
 type EntryKey struct {
 	Key       crypto.Key
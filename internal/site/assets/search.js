@@ -0,0 +1,61 @@
+// Client-side search over the index in search-index.js: query terms
+// match indexed terms by prefix, scored by term weight and rarity.
+(function () {
+  var input = document.getElementById("search");
+  var results = document.getElementById("results");
+  var data = window.ACORDE_INDEX;
+  if (!input || !results || !data) return;
+
+  var terms = Object.keys(data.index);
+
+  function tokenize(text) {
+    return text.toLowerCase().split(/[^\p{L}\p{N}]+/u).filter(function (t) {
+      return t.length > 1;
+    });
+  }
+
+  function search(query) {
+    var scores = {};
+    var tokens = tokenize(query);
+    tokens.forEach(function (token, i) {
+      var matched = {};
+      terms.forEach(function (term) {
+        if (term.indexOf(token) !== 0) return;
+        var postings = data.index[term];
+        var idf = Math.log(1 + data.docs.length / postings.length);
+        var exact = term === token ? 1 : 0.5;
+        postings.forEach(function (p) {
+          matched[p[0]] = (matched[p[0]] || 0) + p[1] * idf * exact;
+        });
+      });
+      // Every query term must match
+      Object.keys(matched).forEach(function (doc) {
+        if (i === 0) scores[doc] = matched[doc];
+        else if (doc in scores) scores[doc] += matched[doc];
+      });
+      Object.keys(scores).forEach(function (doc) {
+        if (!(doc in matched)) delete scores[doc];
+      });
+    });
+    return Object.keys(scores).sort(function (a, b) {
+      return scores[b] - scores[a];
+    }).slice(0, 50);
+  }
+
+  input.addEventListener("input", function () {
+    results.innerHTML = "";
+    search(input.value).forEach(function (i) {
+      var doc = data.docs[i];
+      var li = document.createElement("li");
+      var a = document.createElement("a");
+      a.href = doc.u;
+      a.textContent = doc.t;
+      var p = document.createElement("div");
+      p.className = "meta";
+      p.textContent = doc.s;
+      li.appendChild(a);
+      li.appendChild(p);
+      results.appendChild(li);
+    });
+  });
+})();
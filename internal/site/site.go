@@ -0,0 +1,327 @@
+// Package site builds a static HTML site from vault entries, for
+// publishing or archiving a read-only copy of a vault.
+//
+// The site has an index page with client-side search, a tag index and
+// a page per entry. Notes are rendered from Markdown, with [[wiki links]]
+// resolved to other pages by ID or title; other entries are shown as
+// preformatted text. It needs no server: open index.html in a browser.
+package site
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/amaydixit11/acorde/internal/markdown"
+	"github.com/amaydixit11/acorde/internal/search"
+)
+
+//go:embed assets
+var assets embed.FS
+
+// Entry is an entry to publish
+type Entry struct {
+	ID      string
+	Type    string
+	Content string
+	Tags    []string
+	Created time.Time
+	Updated time.Time
+}
+
+// Options configures Build
+type Options struct {
+	// Title of the site
+	// Default: "acorde"
+	Title string
+}
+
+// skipTypes are never published: credentials are secret and files are
+// binary
+var skipTypes = map[string]bool{"credential": true, "file": true}
+
+// page is an entry as rendered
+type page struct {
+	Entry
+	Title   string
+	URL     string // Relative to the site root
+	Summary string
+	HTML    template.HTML
+}
+
+// Build writes the site for entries to dir, creating it if needed, and
+// returns the number of entry pages written. Credential and file entries
+// are skipped.
+func Build(dir string, entries []Entry, opts Options) (int, error) {
+	if opts.Title == "" {
+		opts.Title = "acorde"
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "entries"), 0755); err != nil {
+		return 0, fmt.Errorf("failed to create site directory: %w", err)
+	}
+
+	var pages []*page
+	for _, e := range entries {
+		if skipTypes[e.Type] {
+			continue
+		}
+		title := titleOf(e)
+		pages = append(pages, &page{
+			Entry:   e,
+			Title:   title,
+			URL:     "entries/" + e.ID + ".html",
+			Summary: summary(e.Content, title),
+		})
+	}
+	sort.SliceStable(pages, func(i, j int) bool { return pages[i].Updated.After(pages[j].Updated) })
+
+	// Resolve wiki links by ID or title, case-insensitively; the newest
+	// page wins when titles repeat
+	targets := make(map[string]*page, 2*len(pages))
+	for i := len(pages) - 1; i >= 0; i-- {
+		targets[strings.ToLower(pages[i].ID)] = pages[i]
+		targets[strings.ToLower(pages[i].Title)] = pages[i]
+	}
+	render := markdown.Options{Highlight: true, WikiLink: func(target string) (string, bool) {
+		if p, ok := targets[strings.ToLower(target)]; ok {
+			return p.ID + ".html", true
+		}
+		return "", false
+	}}
+	for _, p := range pages {
+		if p.Type == "note" {
+			p.HTML = template.HTML(markdown.Render([]byte(p.Content), render))
+		} else {
+			p.HTML = template.HTML("<pre>" + template.HTMLEscapeString(p.Content) + "</pre>")
+		}
+	}
+
+	w := writer{dir: dir, title: opts.Title}
+	w.render("index.html", indexTemplate, map[string]any{"Pages": pages})
+	w.render("tags.html", tagsTemplate, map[string]any{"Tags": tagIndex(pages)})
+	for _, p := range pages {
+		w.render(p.URL, pageTemplate, map[string]any{"Page": p})
+	}
+	w.searchIndex(pages)
+	for _, name := range []string{"style.css", "search.js"} {
+		data, _ := assets.ReadFile("assets/" + name)
+		w.write(name, data)
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+	return len(pages), nil
+}
+
+// writer writes site files, keeping the first error
+type writer struct {
+	dir   string
+	title string
+	err   error
+}
+
+func (w *writer) write(name string, data []byte) {
+	if w.err != nil {
+		return
+	}
+	if err := os.WriteFile(filepath.Join(w.dir, filepath.FromSlash(name)), data, 0644); err != nil {
+		w.err = fmt.Errorf("failed to write %s: %w", name, err)
+	}
+}
+
+func (w *writer) render(name string, tmpl *template.Template, data map[string]any) {
+	// Pages link to the site root relative to their own directory
+	data["Root"] = strings.Repeat("../", strings.Count(name, "/"))
+	data["SiteTitle"] = w.title
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil && w.err == nil {
+		w.err = fmt.Errorf("failed to render %s: %w", name, err)
+	}
+	w.write(name, []byte(b.String()))
+}
+
+// tag is a tag and the pages that have it
+type tag struct {
+	Name  string
+	Pages []*page
+}
+
+// tagIndex groups pages by tag, sorted by tag name
+func tagIndex(pages []*page) []tag {
+	byTag := make(map[string][]*page)
+	for _, p := range pages {
+		for _, t := range p.Tags {
+			byTag[t] = append(byTag[t], p)
+		}
+	}
+	tags := make([]tag, 0, len(byTag))
+	for name, tagged := range byTag {
+		tags = append(tags, tag{Name: name, Pages: tagged})
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+	return tags
+}
+
+// titleOf returns the title of an entry (see search.EntryTitle)
+func titleOf(e Entry) string {
+	if title := search.EntryTitle([]byte(e.Content)); title != "" {
+		return title
+	}
+	return "Untitled " + shortID(e.ID)
+}
+
+// summary returns the start of content after its title line
+func summary(content, title string) string {
+	text := strings.Join(strings.Fields(content), " ")
+	text = strings.TrimSpace(strings.TrimPrefix(strings.TrimLeft(text, "# "), title))
+	if runes := []rune(text); len(runes) > 160 {
+		text = string(runes[:160]) + "…"
+	}
+	return text
+}
+
+func shortID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
+
+var funcs = template.FuncMap{
+	"date": func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.UTC().Format("2006-01-02")
+	},
+	"anchor": anchor,
+	"dict": func(root string, tags []string) map[string]any {
+		return map[string]any{"Root": root, "Tags": tags}
+	},
+}
+
+// anchor returns the fragment ID of a tag on the tag index
+func anchor(tag string) string {
+	return "tag-" + strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' {
+			return unicode.ToLower(r)
+		}
+		return '-'
+	}, tag)
+}
+
+const layout = `{{define "head"}}<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.}}</title>
+{{end}}{{define "nav"}}<link rel="stylesheet" href="{{.Root}}style.css">
+</head>
+<body>
+<header><nav><a href="{{.Root}}index.html">{{.SiteTitle}}</a><a href="{{.Root}}tags.html">Tags</a></nav></header>
+{{end}}{{define "taglinks"}}{{$root := .Root}}{{range .Tags}}<a class="tag" href="{{$root}}tags.html#{{anchor .}}">{{.}}</a>{{end}}{{end}}`
+
+var (
+	indexTemplate = template.Must(template.Must(template.New("index").Funcs(funcs).Parse(layout)).Parse(
+		`{{template "head" .SiteTitle}}{{template "nav" .}}<main>
+<h1>{{.SiteTitle}}</h1>
+<input id="search" type="search" placeholder="Search {{len .Pages}} entries" autocomplete="off">
+<ul id="results" class="pages"></ul>
+<ul class="pages">
+{{$root := .Root}}{{range .Pages}}<li><a href="{{.URL}}">{{.Title}}</a>
+<div class="meta">{{date .Updated}} {{template "taglinks" (dict $root .Tags)}}</div></li>
+{{end}}</ul>
+</main>
+<script src="search-index.js"></script>
+<script src="search.js"></script>
+</body>
+</html>
+`))
+
+	tagsTemplate = template.Must(template.Must(template.New("tags").Funcs(funcs).Parse(layout)).Parse(
+		`{{template "head" (print "Tags - " .SiteTitle)}}{{template "nav" .}}<main>
+<h1>Tags</h1>
+<p>{{range .Tags}}<a class="tag" href="#{{anchor .Name}}">{{.Name}} ({{len .Pages}})</a>{{end}}</p>
+{{range .Tags}}<h2 id="{{anchor .Name}}">{{.Name}}</h2>
+<ul class="pages">
+{{range .Pages}}<li><a href="{{.URL}}">{{.Title}}</a> <span class="meta">{{date .Updated}}</span></li>
+{{end}}</ul>
+{{end}}</main>
+</body>
+</html>
+`))
+
+	pageTemplate = template.Must(template.Must(template.New("page").Funcs(funcs).Parse(layout)).Parse(
+		`{{template "head" (print .Page.Title " - " .SiteTitle)}}{{template "nav" .}}<main>
+<article>
+<div class="meta">{{.Page.Type}} · created {{date .Page.Created}}{{if ne (date .Page.Created) (date .Page.Updated)}} · updated {{date .Page.Updated}}{{end}}</div>
+<div class="meta">{{template "taglinks" (dict .Root .Page.Tags)}}</div>
+{{.Page.HTML}}
+</article>
+</main>
+</body>
+</html>
+`))
+)
+
+// searchIndex writes search-index.js: the pages and an inverted index of
+// their terms, weighted by where they appear. It is a script rather than
+// JSON so the site works when opened from the file system.
+func (w *writer) searchIndex(pages []*page) {
+	type doc struct {
+		Title   string `json:"t"`
+		URL     string `json:"u"`
+		Summary string `json:"s"`
+	}
+	docs := make([]doc, len(pages))
+	index := make(map[string][][2]int) // Term to (doc, weight) pairs
+	for i, p := range pages {
+		docs[i] = doc{Title: p.Title, URL: p.URL, Summary: p.Summary}
+
+		weights := make(map[string]int)
+		for _, term := range tokenize(p.Content) {
+			weights[term]++
+		}
+		for _, term := range tokenize(p.Title) {
+			weights[term] += 10
+		}
+		for _, t := range p.Tags {
+			for _, term := range tokenize(t) {
+				weights[term] += 5
+			}
+		}
+		for term, weight := range weights {
+			index[term] = append(index[term], [2]int{i, weight})
+		}
+	}
+
+	data, err := json.Marshal(map[string]any{"docs": docs, "index": index})
+	if err != nil {
+		w.err = err
+		return
+	}
+	w.write("search-index.js", []byte("window.ACORDE_INDEX = "+string(data)+";\n"))
+}
+
+// tokenize splits text into lowercase search terms, as search.js does
+func tokenize(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	terms := fields[:0]
+	for _, f := range fields {
+		if utf8.RuneCountInString(f) > 1 {
+			terms = append(terms, f)
+		}
+	}
+	return terms
+}
@@ -0,0 +1,100 @@
+package site
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuild(t *testing.T) {
+	dir := t.TempDir()
+	day := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	entries := []Entry{
+		{ID: "aaaa-1", Type: "note", Content: "# Groceries\n\nBuy **milk**, see [[Recipes]] and [[Nowhere]].",
+			Tags: []string{"home", "to do"}, Created: day, Updated: day.Add(48 * time.Hour)},
+		{ID: "bbbb-2", Type: "note", Content: "# Recipes\n\n<script>alert(1)</script> pancakes",
+			Tags: []string{"home"}, Created: day, Updated: day},
+		{ID: "cccc-3", Type: "credential", Content: `{"password":"hunter2"}`, Created: day, Updated: day},
+		{ID: "dddd-4", Type: "bookmark", Content: `{"url":"https://example.com","title":"Example"}`, Created: day, Updated: day.Add(time.Hour)},
+	}
+
+	n, err := Build(dir, entries, Options{Title: "My Notes"})
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	if n != 3 {
+		t.Errorf("Build wrote %d pages, want 3 (credentials skipped)", n)
+	}
+
+	read := func(name string) string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	index := read("index.html")
+	if !strings.Contains(index, "<title>My Notes</title>") || !strings.Contains(index, `<script src="search.js">`) {
+		t.Errorf("index.html is missing its title or search script:\n%s", index)
+	}
+	// Newest first
+	if g, r := strings.Index(index, "Groceries"), strings.Index(index, "Recipes"); g < 0 || r < 0 || g > r {
+		t.Errorf("index.html does not list Groceries before Recipes:\n%s", index)
+	}
+
+	groceries := read("entries/aaaa-1.html")
+	for _, want := range []string{
+		"<strong>milk</strong>",
+		`<a class="wikilink" href="bbbb-2.html">Recipes</a>`,
+		`<span class="wikilink missing">Nowhere</span>`,
+		`href="../tags.html#tag-to-do"`,
+		`href="../style.css"`,
+	} {
+		if !strings.Contains(groceries, want) {
+			t.Errorf("groceries page is missing %s:\n%s", want, groceries)
+		}
+	}
+	if recipes := read("entries/bbbb-2.html"); strings.Contains(recipes, "<script>") {
+		t.Errorf("recipes page has unescaped HTML:\n%s", recipes)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "entries", "cccc-3.html")); !os.IsNotExist(err) {
+		t.Error("credential entry was published")
+	}
+	if bookmark := read("entries/dddd-4.html"); !strings.Contains(bookmark, "<title>Example - My Notes</title>") ||
+		!strings.Contains(bookmark, "<pre>{&#34;url&#34;") {
+		t.Errorf("bookmark is not shown as text:\n%s", bookmark)
+	}
+
+	tags := read("tags.html")
+	if !strings.Contains(tags, `<h2 id="tag-home">home</h2>`) || !strings.Contains(tags, "home (2)") {
+		t.Errorf("tags.html is missing the home tag:\n%s", tags)
+	}
+
+	var data struct {
+		Docs []struct {
+			Title string `json:"t"`
+			URL   string `json:"u"`
+		} `json:"docs"`
+		Index map[string][][2]int `json:"index"`
+	}
+	script := read("search-index.js")
+	js := strings.TrimSuffix(strings.TrimPrefix(script, "window.ACORDE_INDEX = "), ";\n")
+	if err := json.Unmarshal([]byte(js), &data); err != nil {
+		t.Fatalf("search index is not JSON: %v\n%s", err, script)
+	}
+	if len(data.Docs) != 3 || data.Docs[0].URL != "entries/aaaa-1.html" {
+		t.Errorf("search index docs = %+v", data.Docs)
+	}
+	postings := data.Index["pancakes"]
+	if len(postings) != 1 || data.Docs[postings[0][0]].Title != "Recipes" {
+		t.Errorf("postings for pancakes = %v", postings)
+	}
+	if _, ok := data.Index["hunter2"]; ok {
+		t.Error("credential content was indexed")
+	}
+}
@@ -0,0 +1,81 @@
+package sqlite
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrFullTextUnavailable is returned by Search while the full-text index
+// is off, and by SetFullTextIndex when SQLite was built without FTS5
+// (build with -tags sqlite_fts5)
+var ErrFullTextUnavailable = errors.New("full-text index unavailable")
+
+// ftsSchema is the FTS5 index of entry content: an external content
+// table reading entries, kept up to date by triggers on every write
+const ftsSchema = `
+	CREATE VIRTUAL TABLE IF NOT EXISTS entries_fts USING fts5(
+		content, content='entries', content_rowid='rowid'
+	);
+
+	CREATE TRIGGER IF NOT EXISTS entries_fts_insert AFTER INSERT ON entries BEGIN
+		INSERT INTO entries_fts(rowid, content) VALUES (new.rowid, new.content);
+	END;
+	CREATE TRIGGER IF NOT EXISTS entries_fts_delete AFTER DELETE ON entries BEGIN
+		INSERT INTO entries_fts(entries_fts, rowid, content) VALUES ('delete', old.rowid, old.content);
+	END;
+	CREATE TRIGGER IF NOT EXISTS entries_fts_update AFTER UPDATE OF content ON entries BEGIN
+		INSERT INTO entries_fts(entries_fts, rowid, content) VALUES ('delete', old.rowid, old.content);
+		INSERT INTO entries_fts(rowid, content) VALUES (new.rowid, new.content);
+	END;
+`
+
+// dropFTSSchema removes the index and its triggers
+const dropFTSSchema = `
+	DROP TRIGGER IF EXISTS entries_fts_insert;
+	DROP TRIGGER IF EXISTS entries_fts_delete;
+	DROP TRIGGER IF EXISTS entries_fts_update;
+	DROP TABLE IF EXISTS entries_fts;
+`
+
+// SetFullTextIndex turns the FTS5 index of entry content used by Search
+// on or off. Only turn it on when content is stored as plaintext: the
+// index holds the words of every entry, and is useless on ciphertext.
+// Turning it on indexes existing entries; turning it off drops the index,
+// so no plaintext is left behind once a vault is encrypted.
+func (s *SQLiteStore) SetFullTextIndex(enabled bool) error {
+	if !enabled {
+		s.fts = false
+		if _, err := s.db.Exec(dropFTSSchema); err != nil {
+			return fmt.Errorf("failed to drop full-text index: %w", err)
+		}
+		return nil
+	}
+
+	var exists int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name = 'entries_fts'`).Scan(&exists); err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(ftsSchema); err != nil {
+		if strings.Contains(err.Error(), "no such module: fts5") {
+			return ErrFullTextUnavailable
+		}
+		return fmt.Errorf("failed to create full-text index: %w", err)
+	}
+	if exists == 0 {
+		if _, err := tx.Exec(`INSERT INTO entries_fts(entries_fts) VALUES ('rebuild')`); err != nil {
+			return fmt.Errorf("failed to build full-text index: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.fts = true
+	return nil
+}
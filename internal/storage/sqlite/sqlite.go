@@ -13,23 +13,75 @@ import (
 
 // SQLiteStore implements the Store interface using SQLite
 type SQLiteStore struct {
-	db *sql.DB
+	db    *sql.DB
+	stmts *stmtCache // Prepared statements
+	wal   bool       // Journal is a write-ahead log (see Flush)
+	fts   bool       // Full-text index is on (see SetFullTextIndex)
 }
 
-// New creates a new SQLite store at the given path
+// Durability selects when committed writes reach the disk
+type Durability string
+
+const (
+	// DurabilitySync syncs the write-ahead log on every commit: a
+	// committed write survives a crash or power loss (default)
+	DurabilitySync Durability = "sync"
+	// DurabilityRelaxed syncs only when the log is checkpointed. The
+	// database stays consistent, but a power loss can undo the last
+	// commits. Writes are faster.
+	DurabilityRelaxed Durability = "relaxed"
+)
+
+// ParseDurability validates a durability mode ("" means DurabilitySync)
+func ParseDurability(s string) (Durability, error) {
+	switch Durability(s) {
+	case "", DurabilitySync:
+		return DurabilitySync, nil
+	case DurabilityRelaxed:
+		return DurabilityRelaxed, nil
+	}
+	return "", fmt.Errorf("unknown durability %q (want %q or %q)", s, DurabilitySync, DurabilityRelaxed)
+}
+
+// New creates a new SQLite store at the given path with DurabilitySync
 // If path is ":memory:", creates an in-memory database
 func New(path string) (*SQLiteStore, error) {
-	db, err := sql.Open("sqlite3", path+"?_foreign_keys=on")
+	return Open(path, DurabilitySync)
+}
+
+// Open creates a new SQLite store at the given path. Databases on disk
+// use a write-ahead log, synced as durability says.
+func Open(path string, durability Durability) (*SQLiteStore, error) {
+	dsn := path + "?_foreign_keys=on"
+	if path != ":memory:" {
+		synchronous := "FULL"
+		if durability == DurabilityRelaxed {
+			synchronous = "NORMAL"
+		}
+		// Set on every connection of the pool
+		dsn += "&_journal_mode=WAL&_synchronous=" + synchronous
+	}
+	db, err := sql.Open("sqlite3", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
+	if path == ":memory:" {
+		// Every connection to ":memory:" is a separate, empty database:
+		// concurrent callers must share the one that has the schema
+		db.SetMaxOpenConns(1)
+	}
 
-	store := &SQLiteStore{db: db}
+	store := &SQLiteStore{db: db, stmts: newStmtCache(db)}
 	if err := store.initSchema(); err != nil {
 		db.Close()
 		return nil, fmt.Errorf("failed to initialize schema: %w", err)
 	}
+	if err := store.stmts.prepare(txStatements()...); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to prepare statements: %w", err)
+	}
 
+	store.wal = path != ":memory:"
 	return store, nil
 }
 
@@ -47,7 +99,17 @@ func (s *SQLiteStore) initSchema() error {
 			content BLOB NOT NULL,
 			created_at INTEGER NOT NULL,
 			updated_at INTEGER NOT NULL,
-			deleted INTEGER NOT NULL DEFAULT 0
+			deleted INTEGER NOT NULL DEFAULT 0,
+			created_time INTEGER NOT NULL DEFAULT 0,
+			updated_time INTEGER NOT NULL DEFAULT 0,
+			archived INTEGER NOT NULL DEFAULT 0,
+			archived_at INTEGER NOT NULL DEFAULT 0,
+			schema_version INTEGER NOT NULL DEFAULT 0,
+			author TEXT NOT NULL DEFAULT '',
+			collection TEXT NOT NULL DEFAULT '',
+			collection_at INTEGER NOT NULL DEFAULT 0,
+			namespace TEXT NOT NULL DEFAULT '',
+			sort_title TEXT NOT NULL DEFAULT ''
 		);
 
 		CREATE TABLE IF NOT EXISTS tags (
@@ -62,7 +124,78 @@ func (s *SQLiteStore) initSchema() error {
 		CREATE INDEX IF NOT EXISTS idx_entries_deleted ON entries(deleted);
 		CREATE INDEX IF NOT EXISTS idx_tags_tag ON tags(tag);
 	`
-	_, err := s.db.Exec(schema)
+	if _, err := s.db.Exec(schema); err != nil {
+		return err
+	}
+
+	// Databases created before wall-clock times lack their columns
+	if err := s.addColumns("created_time", `
+		ALTER TABLE entries ADD COLUMN created_time INTEGER NOT NULL DEFAULT 0;
+		ALTER TABLE entries ADD COLUMN updated_time INTEGER NOT NULL DEFAULT 0;
+	`); err != nil {
+		return err
+	}
+
+	// ...databases created before archiving lack its columns
+	if err := s.addColumns("archived", `
+		ALTER TABLE entries ADD COLUMN archived INTEGER NOT NULL DEFAULT 0;
+		ALTER TABLE entries ADD COLUMN archived_at INTEGER NOT NULL DEFAULT 0;
+	`); err != nil {
+		return err
+	}
+
+	// ...those created before schema versions lack theirs
+	if err := s.addColumns("schema_version", `
+		ALTER TABLE entries ADD COLUMN schema_version INTEGER NOT NULL DEFAULT 0;
+	`); err != nil {
+		return err
+	}
+
+	// ...those created before authors were recorded lack that
+	if err := s.addColumns("author", `
+		ALTER TABLE entries ADD COLUMN author TEXT NOT NULL DEFAULT '';
+	`); err != nil {
+		return err
+	}
+
+	// ...those created before collections lack their columns
+	if err := s.addColumns("collection", `
+		ALTER TABLE entries ADD COLUMN collection TEXT NOT NULL DEFAULT '';
+		ALTER TABLE entries ADD COLUMN collection_at INTEGER NOT NULL DEFAULT 0;
+	`); err != nil {
+		return err
+	}
+
+	// ...those created before namespaces lack that
+	if err := s.addColumns("namespace", `
+		ALTER TABLE entries ADD COLUMN namespace TEXT NOT NULL DEFAULT '';
+	`); err != nil {
+		return err
+	}
+
+	// ...and those created before stored titles lack theirs (the engine
+	// fills it in when it builds its title index)
+	if err := s.addColumns("sort_title", `
+		ALTER TABLE entries ADD COLUMN sort_title TEXT NOT NULL DEFAULT '';
+	`); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(`
+		CREATE INDEX IF NOT EXISTS idx_entries_collection ON entries(collection);
+		CREATE INDEX IF NOT EXISTS idx_entries_namespace ON entries(namespace);
+		CREATE INDEX IF NOT EXISTS idx_entries_sort_title ON entries(sort_title);
+	`)
+	return err
+}
+
+// addColumns runs alter unless the entries table already has column
+func (s *SQLiteStore) addColumns(column, alter string) error {
+	var n int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('entries') WHERE name = ?`, column).Scan(&n)
+	if err != nil || n > 0 {
+		return err
+	}
+	_, err = s.db.Exec(alter)
 	return err
 }
 
@@ -74,33 +207,27 @@ func (s *SQLiteStore) Put(entry core.Entry) error {
 	}
 	defer tx.Rollback()
 
-	// Upsert entry
-	_, err = tx.Exec(`
-		INSERT INTO entries (id, type, content, created_at, updated_at, deleted)
-		VALUES (?, ?, ?, ?, ?, ?)
-		ON CONFLICT(id) DO UPDATE SET
-			type = excluded.type,
-			content = excluded.content,
-			updated_at = excluded.updated_at,
-			deleted = excluded.deleted
-	`, entry.ID.String(), string(entry.Type), entry.Content,
-		entry.CreatedAt, entry.UpdatedAt, boolToInt(entry.Deleted))
-	if err != nil {
-		return fmt.Errorf("failed to upsert entry: %w", err)
+	if err := s.putEntry(tx, entry); err != nil {
+		return err
 	}
 
-	// Delete existing tags and insert new ones
-	_, err = tx.Exec("DELETE FROM tags WHERE entry_id = ?", entry.ID.String())
+	return tx.Commit()
+}
+
+// PutWith stores an entry and runs fn in the same transaction: rows fn
+// writes (versions, ACLs) are committed with the entry or not at all
+func (s *SQLiteStore) PutWith(entry core.Entry, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
 	if err != nil {
-		return fmt.Errorf("failed to delete existing tags: %w", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback()
 
-	for _, tag := range entry.Tags {
-		_, err = tx.Exec("INSERT INTO tags (entry_id, tag) VALUES (?, ?)",
-			entry.ID.String(), tag)
-		if err != nil {
-			return fmt.Errorf("failed to insert tag: %w", err)
-		}
+	if err := s.putEntry(tx, entry); err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		return err
 	}
 
 	return tx.Commit()
@@ -110,14 +237,17 @@ func (s *SQLiteStore) Put(entry core.Entry) error {
 func (s *SQLiteStore) Get(id uuid.UUID) (core.Entry, error) {
 	var entry core.Entry
 	var idStr, typeStr string
-	var deleted int
+	var deleted, archived int
+	var collection string
 
-	err := s.db.QueryRow(`
-		SELECT id, type, content, created_at, updated_at, deleted
-		FROM entries
-		WHERE id = ?
-	`, id.String()).Scan(&idStr, &typeStr, &entry.Content,
-		&entry.CreatedAt, &entry.UpdatedAt, &deleted)
+	getEntry, err := s.stmts.get(getEntrySQL)
+	if err != nil {
+		return core.Entry{}, fmt.Errorf("failed to get entry: %w", err)
+	}
+	err = getEntry.QueryRow(id.String()).Scan(&idStr, &typeStr, &entry.Content,
+		&entry.CreatedAt, &entry.UpdatedAt, &deleted, &entry.CreatedTime, &entry.UpdatedTime,
+		&archived, &entry.ArchivedAt, &entry.SchemaVersion, &entry.Author,
+		&collection, &entry.CollectionAt, &entry.Namespace)
 
 	if err == sql.ErrNoRows {
 		return core.Entry{}, storage.ErrNotFound{ID: id}
@@ -129,9 +259,15 @@ func (s *SQLiteStore) Get(id uuid.UUID) (core.Entry, error) {
 	entry.ID = id
 	entry.Type = core.EntryType(typeStr)
 	entry.Deleted = deleted != 0
+	entry.Archived = archived != 0
+	entry.Collection = parseCollection(collection)
 
 	// Get tags
-	rows, err := s.db.Query("SELECT tag FROM tags WHERE entry_id = ?", id.String())
+	getTags, err := s.stmts.get(getTagsSQL)
+	if err != nil {
+		return core.Entry{}, fmt.Errorf("failed to get tags: %w", err)
+	}
+	rows, err := getTags.Query(id.String())
 	if err != nil {
 		return core.Entry{}, fmt.Errorf("failed to get tags: %w", err)
 	}
@@ -151,31 +287,29 @@ func (s *SQLiteStore) Get(id uuid.UUID) (core.Entry, error) {
 
 // List returns entries matching the filter
 func (s *SQLiteStore) List(filter storage.ListFilter) ([]core.Entry, error) {
-	query := "SELECT id, type, content, created_at, updated_at, deleted FROM entries WHERE 1=1"
-	args := []interface{}{}
-
-	if filter.Type != nil {
-		query += " AND type = ?"
-		args = append(args, string(*filter.Type))
-	}
-	if !filter.Deleted {
-		query += " AND deleted = 0"
+	where, args := listWhere(filter)
+	content := "content"
+	if filter.WithoutContent {
+		content = "NULL" // Scans as nil
 	}
-	if filter.Since != nil {
-		query += " AND updated_at >= ?"
-		args = append(args, *filter.Since)
-	}
-	if filter.Until != nil {
-		query += " AND updated_at <= ?"
-		args = append(args, *filter.Until)
+	query := "SELECT id, type, " + content + ", created_at, updated_at, deleted, created_time, updated_time, archived, archived_at, schema_version, author, collection, collection_at, namespace FROM entries WHERE 1=1" + where
+
+	order := " DESC"
+	if filter.Ascending {
+		order = ""
 	}
-	if filter.Tag != nil {
-		query += " AND id IN (SELECT entry_id FROM tags WHERE tag = ?)"
-		args = append(args, *filter.Tag)
+	switch filter.Sort {
+	case "", storage.SortUpdatedAt:
+		query += " ORDER BY updated_at" + order
+	case storage.SortCreatedAt:
+		query += " ORDER BY created_at" + order
+	case storage.SortTitle:
+		// Untitled last either way, ties most recently updated first
+		query += " ORDER BY sort_title = '', sort_title" + order + ", updated_at" + order
+	default:
+		return nil, fmt.Errorf("unknown sort field %q", filter.Sort)
 	}
 
-	query += " ORDER BY updated_at DESC"
-
 	if filter.Limit > 0 {
 		query += " LIMIT ?"
 		args = append(args, filter.Limit)
@@ -188,7 +322,7 @@ func (s *SQLiteStore) List(filter storage.ListFilter) ([]core.Entry, error) {
 		args = append(args, filter.Offset)
 	}
 
-	rows, err := s.db.Query(query, args...)
+	rows, err := s.filterQuery(filter, query, args)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list entries: %w", err)
 	}
@@ -198,16 +332,21 @@ func (s *SQLiteStore) List(filter storage.ListFilter) ([]core.Entry, error) {
 	for rows.Next() {
 		var entry core.Entry
 		var idStr, typeStr string
-		var deleted int
+		var deleted, archived int
+		var collection string
 
 		if err := rows.Scan(&idStr, &typeStr, &entry.Content,
-			&entry.CreatedAt, &entry.UpdatedAt, &deleted); err != nil {
+			&entry.CreatedAt, &entry.UpdatedAt, &deleted, &entry.CreatedTime, &entry.UpdatedTime,
+			&archived, &entry.ArchivedAt, &entry.SchemaVersion, &entry.Author,
+			&collection, &entry.CollectionAt, &entry.Namespace); err != nil {
 			return nil, fmt.Errorf("failed to scan entry: %w", err)
 		}
 
 		entry.ID, _ = uuid.Parse(idStr)
 		entry.Type = core.EntryType(typeStr)
 		entry.Deleted = deleted != 0
+		entry.Archived = archived != 0
+		entry.Collection = parseCollection(collection)
 		entries = append(entries, entry)
 	}
 
@@ -255,10 +394,11 @@ func (s *SQLiteStore) List(filter storage.ListFilter) ([]core.Entry, error) {
 
 // Delete marks an entry as deleted (tombstone)
 func (s *SQLiteStore) Delete(id uuid.UUID) error {
-	result, err := s.db.Exec(
-		"UPDATE entries SET deleted = 1 WHERE id = ?",
-		id.String(),
-	)
+	deleteEntry, err := s.stmts.get(deleteEntrySQL)
+	if err != nil {
+		return fmt.Errorf("failed to delete entry: %w", err)
+	}
+	result, err := deleteEntry.Exec(id.String())
 	if err != nil {
 		return fmt.Errorf("failed to delete entry: %w", err)
 	}
@@ -285,38 +425,16 @@ func (s *SQLiteStore) ApplyBatch(ops []storage.Operation) error {
 	for _, op := range ops {
 		switch op.Type {
 		case storage.OpPut:
-			// Upsert entry
-			_, err = tx.Exec(`
-				INSERT INTO entries (id, type, content, created_at, updated_at, deleted)
-				VALUES (?, ?, ?, ?, ?, ?)
-				ON CONFLICT(id) DO UPDATE SET
-					type = excluded.type,
-					content = excluded.content,
-					updated_at = excluded.updated_at,
-					deleted = excluded.deleted
-			`, op.Entry.ID.String(), string(op.Entry.Type), op.Entry.Content,
-				op.Entry.CreatedAt, op.Entry.UpdatedAt, boolToInt(op.Entry.Deleted))
-			if err != nil {
-				return fmt.Errorf("failed to put entry in batch: %w", err)
-			}
-
-			// Update tags
-			_, err = tx.Exec("DELETE FROM tags WHERE entry_id = ?", op.Entry.ID.String())
-			if err != nil {
-				return fmt.Errorf("failed to delete tags in batch: %w", err)
-			}
-			for _, tag := range op.Entry.Tags {
-				_, err = tx.Exec("INSERT INTO tags (entry_id, tag) VALUES (?, ?)",
-					op.Entry.ID.String(), tag)
-				if err != nil {
-					return fmt.Errorf("failed to insert tag in batch: %w", err)
-				}
+			if err := s.putEntry(tx, op.Entry); err != nil {
+				return fmt.Errorf("batch: %w", err)
 			}
 
 		case storage.OpDelete:
-			_, err = tx.Exec("UPDATE entries SET deleted = 1 WHERE id = ?",
-				op.Entry.ID.String())
+			deleteEntry, err := s.txStmt(tx, deleteEntrySQL)
 			if err != nil {
+				return err
+			}
+			if _, err := deleteEntry.Exec(op.Entry.ID.String()); err != nil {
 				return fmt.Errorf("failed to delete entry in batch: %w", err)
 			}
 		}
@@ -325,10 +443,198 @@ func (s *SQLiteStore) ApplyBatch(ops []storage.Operation) error {
 	return tx.Commit()
 }
 
-// GetMaxTimestamp returns the highest UpdatedAt timestamp in storage
+// listWhere returns the conditions of a List filter, to append to a
+// query on entries ending in a WHERE clause, and their arguments
+func listWhere(filter storage.ListFilter) (string, []interface{}) {
+	query := ""
+	args := []interface{}{}
+
+	if filter.Type != nil {
+		query += " AND type = ?"
+		args = append(args, string(*filter.Type))
+	}
+	if !filter.Deleted {
+		query += " AND deleted = 0"
+	}
+	if filter.OnlyArchived {
+		query += " AND archived = 1"
+	} else if !filter.Archived {
+		query += " AND archived = 0"
+	}
+	if filter.Since != nil {
+		query += " AND updated_at >= ?"
+		args = append(args, *filter.Since)
+	}
+	if filter.Until != nil {
+		query += " AND updated_at <= ?"
+		args = append(args, *filter.Until)
+	}
+	if filter.Tag != nil {
+		query += " AND id IN (SELECT entry_id FROM tags WHERE tag = ?)"
+		args = append(args, *filter.Tag)
+	}
+	if filter.Namespace != nil {
+		query += " AND namespace = ?"
+		args = append(args, *filter.Namespace)
+	}
+	if filter.Collections != nil {
+		query += " AND collection IN (" + strings.TrimSuffix(strings.Repeat("?,", len(filter.Collections)), ",") + ")"
+		for _, collection := range filter.Collections {
+			args = append(args, collectionColumn(collection))
+		}
+	}
+	return query, args
+}
+
+// filterQuery runs a query built from a List filter. The query text
+// depends only on which filters are set, and for several collections on
+// how many: those are not prepared.
+func (s *SQLiteStore) filterQuery(filter storage.ListFilter, query string, args []interface{}) (*sql.Rows, error) {
+	if len(filter.Collections) > 1 {
+		return s.db.Query(query, args...)
+	}
+	stmt, err := s.stmts.get(query)
+	if err != nil {
+		return nil, err
+	}
+	return stmt.Query(args...)
+}
+
+// Count returns the number of entries matching the filter, ignoring its
+// Limit, Offset and Sort
+func (s *SQLiteStore) Count(filter storage.ListFilter) (int, error) {
+	where, args := listWhere(filter)
+	rows, err := s.filterQuery(filter, "SELECT COUNT(*) FROM entries WHERE 1=1"+where, args)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count entries: %w", err)
+	}
+	defer rows.Close()
+
+	var n int
+	if rows.Next() {
+		if err := rows.Scan(&n); err != nil {
+			return 0, fmt.Errorf("failed to count entries: %w", err)
+		}
+	}
+	return n, rows.Err()
+}
+
+// Exists reports whether a live (not deleted) entry is stored under id
+func (s *SQLiteStore) Exists(id uuid.UUID) (bool, error) {
+	exists, err := s.stmts.get(existsSQL)
+	if err != nil {
+		return false, fmt.Errorf("failed to check entry: %w", err)
+	}
+	var found bool
+	if err := exists.QueryRow(id.String()).Scan(&found); err != nil {
+		return false, fmt.Errorf("failed to check entry: %w", err)
+	}
+	return found, nil
+}
+
+// SetTitles stores the titles entries sort by with SortTitle, lowercased
+// so they order case-insensitively. Titles that did not change are not
+// rewritten.
+func (s *SQLiteStore) SetTitles(titles map[uuid.UUID]string) error {
+	if len(titles) == 0 {
+		return nil
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := s.txStmt(tx, setTitleSQL)
+	if err != nil {
+		return err
+	}
+	for id, title := range titles {
+		key := strings.ToLower(title)
+		if _, err := stmt.Exec(key, id.String(), key); err != nil {
+			return fmt.Errorf("failed to store title: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// ClearTitles removes every stored title, so none is left behind in
+// plaintext once a vault is encrypted
+func (s *SQLiteStore) ClearTitles() error {
+	if _, err := s.db.Exec(`UPDATE entries SET sort_title = '' WHERE sort_title != ''`); err != nil {
+		return fmt.Errorf("failed to clear titles: %w", err)
+	}
+	return nil
+}
+
+// IDsWithPrefix returns up to limit IDs of live entries starting with
+// prefix. IDs are stored in lowercase string form, so the match is a
+// range of the primary key: from prefix to prefix followed by '~', which
+// sorts after every hex digit and '-'.
+func (s *SQLiteStore) IDsWithPrefix(prefix string, limit int) ([]uuid.UUID, error) {
+	idPrefix, err := s.stmts.get(idPrefixSQL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to match ID prefix: %w", err)
+	}
+	rows, err := idPrefix.Query(prefix, prefix, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to match ID prefix: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var idStr string
+		if err := rows.Scan(&idStr); err != nil {
+			return nil, fmt.Errorf("failed to scan ID: %w", err)
+		}
+		if id, err := uuid.Parse(idStr); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids, rows.Err()
+}
+
+// Namespaces counts live entries by namespace
+func (s *SQLiteStore) Namespaces() (map[string]int, error) {
+	stmt, err := s.stmts.get(namespacesSQL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count namespaces: %w", err)
+	}
+	rows, err := stmt.Query()
+	if err != nil {
+		return nil, fmt.Errorf("failed to count namespaces: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var namespace string
+		var n int
+		if err := rows.Scan(&namespace, &n); err != nil {
+			return nil, fmt.Errorf("failed to scan namespace: %w", err)
+		}
+		counts[namespace] = n
+	}
+	return counts, rows.Err()
+}
+
+// GetMaxTimestamp returns the highest UpdatedAt, ArchivedAt or CollectionAt timestamp in storage
+// Ping checks that the database answers a query on the entries table
+func (s *SQLiteStore) Ping() error {
+	var n int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM (SELECT 1 FROM entries LIMIT 1)").Scan(&n); err != nil {
+		return fmt.Errorf("database unreachable: %w", err)
+	}
+	return nil
+}
+
 func (s *SQLiteStore) GetMaxTimestamp() (uint64, error) {
 	var maxTime sql.NullInt64
-	err := s.db.QueryRow("SELECT MAX(updated_at) FROM entries").Scan(&maxTime)
+	maxTimestamp, err := s.stmts.get(maxTimestampSQL)
+	if err == nil {
+		err = maxTimestamp.QueryRow().Scan(&maxTime)
+	}
 	if err != nil {
 		return 0, fmt.Errorf("failed to get max timestamp: %w", err)
 	}
@@ -338,9 +644,26 @@ func (s *SQLiteStore) GetMaxTimestamp() (uint64, error) {
 	return uint64(maxTime.Int64), nil
 }
 
-// Close closes the database connection
+// Flush checkpoints the write-ahead log into the database file and
+// truncates it, so the file alone holds every committed write
+func (s *SQLiteStore) Flush() error {
+	if !s.wal {
+		return nil
+	}
+	if _, err := s.db.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		return fmt.Errorf("failed to checkpoint: %w", err)
+	}
+	return nil
+}
+
+// Close flushes the write-ahead log and releases the database
 func (s *SQLiteStore) Close() error {
-	return s.db.Close()
+	flushErr := s.Flush()
+	s.stmts.close()
+	if err := s.db.Close(); err != nil {
+		return err
+	}
+	return flushErr
 }
 
 func boolToInt(b bool) int {
@@ -350,17 +673,34 @@ func boolToInt(b bool) int {
 	return 0
 }
 
+// collectionColumn returns how a collection ID is stored ("" = none)
+func collectionColumn(id uuid.UUID) string {
+	if id == uuid.Nil {
+		return ""
+	}
+	return id.String()
+}
+
+// parseCollection is the inverse of collectionColumn
+func parseCollection(column string) uuid.UUID {
+	id, _ := uuid.Parse(column)
+	return id
+}
+
 // SearchOptions for full-text search
 type SearchOptions struct {
 	Type  *core.EntryType
 	Limit int
 }
 
-// Search performs full-text search on entry content
+// Search performs full-text search on entry content, with an FTS5 query.
+// It fails with ErrFullTextUnavailable unless SetFullTextIndex is on.
 func (s *SQLiteStore) Search(query string, opts SearchOptions) ([]core.Entry, error) {
-	// Use FTS5 MATCH query
+	if !s.fts {
+		return nil, ErrFullTextUnavailable
+	}
 	sqlQuery := `
-		SELECT e.id, e.type, e.content, e.created_at, e.updated_at, e.deleted
+		SELECT e.id, e.type, e.content, e.created_at, e.updated_at, e.deleted, e.created_time, e.updated_time
 		FROM entries e
 		JOIN entries_fts fts ON e.rowid = fts.rowid
 		WHERE entries_fts MATCH ? AND e.deleted = 0
@@ -372,7 +712,7 @@ func (s *SQLiteStore) Search(query string, opts SearchOptions) ([]core.Entry, er
 		args = append(args, string(*opts.Type))
 	}
 
-	sqlQuery += " ORDER BY rank LIMIT ?"
+	sqlQuery += " ORDER BY fts.rank LIMIT ?"
 	limit := opts.Limit
 	if limit <= 0 {
 		limit = 50
@@ -392,7 +732,7 @@ func (s *SQLiteStore) Search(query string, opts SearchOptions) ([]core.Entry, er
 		var deleted int
 
 		if err := rows.Scan(&idStr, &typeStr, &entry.Content,
-			&entry.CreatedAt, &entry.UpdatedAt, &deleted); err != nil {
+			&entry.CreatedAt, &entry.UpdatedAt, &deleted, &entry.CreatedTime, &entry.UpdatedTime); err != nil {
 			return nil, fmt.Errorf("failed to scan entry: %w", err)
 		}
 
@@ -406,3 +746,61 @@ func (s *SQLiteStore) Search(query string, opts SearchOptions) ([]core.Entry, er
 	return entries, nil
 }
 
+// Aggregate groups live entries by wall-clock creation time
+func (s *SQLiteStore) Aggregate(filter storage.AggregateFilter) ([]storage.AggregateRow, error) {
+	if filter.Slot <= 0 {
+		return nil, fmt.Errorf("invalid aggregate slot %d", filter.Slot)
+	}
+	value := "NULL"
+	args := []interface{}{}
+	if filter.Path != "" {
+		// Content that is not JSON has no fields rather than failing
+		value = "CASE WHEN json_valid(CAST(content AS TEXT)) THEN json_extract(CAST(content AS TEXT), ?) END"
+		args = append(args, filter.Path)
+	}
+	inner := "SELECT created_time, " + value + " AS v FROM entries WHERE deleted = 0 AND created_time > 0"
+	if filter.Type != nil {
+		inner += " AND type = ?"
+		args = append(args, string(*filter.Type))
+	}
+	if filter.Tag != nil {
+		inner += " AND id IN (SELECT entry_id FROM tags WHERE tag = ?)"
+		args = append(args, *filter.Tag)
+	}
+	if filter.Since > 0 {
+		inner += " AND created_time >= ?"
+		args = append(args, filter.Since)
+	}
+	if filter.Until > 0 {
+		inner += " AND created_time < ?"
+		args = append(args, filter.Until)
+	}
+
+	query := "SELECT (created_time / ?) * ? AS slot, COUNT(*), COALESCE(SUM(v), 0), COALESCE(MIN(v), 0), COALESCE(MAX(v), 0) FROM (" + inner + ")"
+	if filter.Path != "" {
+		query += " WHERE typeof(v) IN ('integer', 'real')"
+	}
+	query += " GROUP BY slot ORDER BY slot"
+	args = append([]interface{}{filter.Slot, filter.Slot}, args...)
+
+	// The query text depends only on which filters are set
+	aggregate, err := s.stmts.get(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate entries: %w", err)
+	}
+	rows, err := aggregate.Query(args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate entries: %w", err)
+	}
+	defer rows.Close()
+
+	var result []storage.AggregateRow
+	for rows.Next() {
+		var row storage.AggregateRow
+		if err := rows.Scan(&row.Start, &row.Count, &row.Sum, &row.Min, &row.Max); err != nil {
+			return nil, fmt.Errorf("failed to scan aggregate: %w", err)
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
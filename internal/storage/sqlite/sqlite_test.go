@@ -1,7 +1,12 @@
 package sqlite
 
 import (
+	"database/sql"
+	"errors"
+	"fmt"
 	"os"
+	"slices"
+	"sort"
 	"testing"
 
 	"github.com/amaydixit11/acorde/internal/core"
@@ -17,6 +22,20 @@ func TestNew(t *testing.T) {
 	defer store.Close()
 }
 
+func TestPing(t *testing.T) {
+	store, err := New(":memory:")
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	if err := store.Ping(); err != nil {
+		t.Fatalf("Ping failed: %v", err)
+	}
+	store.Close()
+	if err := store.Ping(); err == nil {
+		t.Error("Ping should fail after Close")
+	}
+}
+
 func TestNewWithFile(t *testing.T) {
 	tmpFile := "/tmp/acorde_test_" + uuid.New().String() + ".db"
 	defer os.Remove(tmpFile)
@@ -61,6 +80,52 @@ func TestPutAndGet(t *testing.T) {
 	if len(retrieved.Tags) != 2 {
 		t.Errorf("Tags count mismatch: got %d, want 2", len(retrieved.Tags))
 	}
+	if retrieved.CreatedTime != entry.CreatedTime || retrieved.UpdatedTime != entry.UpdatedTime {
+		t.Errorf("wall times mismatch: got %d/%d, want %d/%d",
+			retrieved.CreatedTime, retrieved.UpdatedTime, entry.CreatedTime, entry.UpdatedTime)
+	}
+}
+
+func TestMigrateWallTimes(t *testing.T) {
+	path := t.TempDir() + "/old.db"
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	// Schema from before wall-clock times were stored
+	_, err = db.Exec(`
+		CREATE TABLE entries (
+			id TEXT PRIMARY KEY,
+			type TEXT NOT NULL,
+			content BLOB NOT NULL,
+			created_at INTEGER NOT NULL,
+			updated_at INTEGER NOT NULL,
+			deleted INTEGER NOT NULL DEFAULT 0
+		);
+		INSERT INTO entries VALUES ('` + uuid.New().String() + `', 'note', 'old', 1, 1, 0);
+	`)
+	db.Close()
+	if err != nil {
+		t.Fatalf("failed to create old schema: %v", err)
+	}
+
+	store, err := New(path)
+	if err != nil {
+		t.Fatalf("failed to open old database: %v", err)
+	}
+	defer store.Close()
+
+	entries, err := store.List(storage.ListFilter{})
+	if err != nil || len(entries) != 1 || entries[0].CreatedTime != 0 {
+		t.Fatalf("expected old entry without wall time, got %+v (%v)", entries, err)
+	}
+	entry := core.NewEntry(core.Note, []byte("new"), nil, 2)
+	if err := store.Put(entry); err != nil {
+		t.Fatalf("failed to put: %v", err)
+	}
+	if got, _ := store.Get(entry.ID); got.UpdatedTime != entry.UpdatedTime {
+		t.Errorf("expected wall time %d, got %d", entry.UpdatedTime, got.UpdatedTime)
+	}
 }
 
 func TestGetNotFound(t *testing.T) {
@@ -98,6 +163,42 @@ func TestPutIdempotent(t *testing.T) {
 	}
 }
 
+func TestPutTagChanges(t *testing.T) {
+	store, _ := New(":memory:")
+	defer store.Close()
+
+	// More tags than one multi-row statement holds, with a duplicate
+	tags := []string{"dup", "dup"}
+	for i := 0; i < 150; i++ {
+		tags = append(tags, fmt.Sprintf("tag%d", i))
+	}
+	entry := core.NewEntry(core.Note, []byte("x"), tags, 1)
+	if err := store.Put(entry); err != nil {
+		t.Fatalf("failed to put entry: %v", err)
+	}
+	retrieved, _ := store.Get(entry.ID)
+	if len(retrieved.Tags) != 151 {
+		t.Errorf("expected 151 tags, got %d", len(retrieved.Tags))
+	}
+
+	// Only the difference is written
+	entry.Tags = append([]string{"new"}, tags[10:]...)
+	if err := store.Put(entry); err != nil {
+		t.Fatalf("failed to update tags: %v", err)
+	}
+	retrieved, _ = store.Get(entry.ID)
+	sort.Strings(retrieved.Tags)
+	if len(retrieved.Tags) != 143 || retrieved.Tags[0] != "new" {
+		t.Errorf("unexpected tags after update: %d %v", len(retrieved.Tags), retrieved.Tags[:3])
+	}
+
+	entry.Tags = nil
+	store.Put(entry)
+	if retrieved, _ := store.Get(entry.ID); len(retrieved.Tags) != 0 {
+		t.Errorf("expected tags to be cleared, got %v", retrieved.Tags)
+	}
+}
+
 func TestList(t *testing.T) {
 	store, _ := New(":memory:")
 	defer store.Close()
@@ -135,6 +236,84 @@ func TestList(t *testing.T) {
 	}
 }
 
+func TestCountAndExists(t *testing.T) {
+	store, _ := New(":memory:")
+	defer store.Close()
+
+	e1 := core.NewEntry(core.Note, []byte("note 1"), []string{"work"}, 1)
+	e2 := core.NewEntry(core.Log, []byte("log 1"), []string{"personal"}, 2)
+	e3 := core.NewEntry(core.Note, []byte("note 2"), []string{"work"}, 3)
+	store.Put(e1)
+	store.Put(e2)
+	store.Put(e3)
+	store.Delete(e3.ID)
+
+	workTag := "work"
+	noteType := core.Note
+	tests := []struct {
+		filter storage.ListFilter
+		want   int
+	}{
+		{storage.ListFilter{}, 2},
+		{storage.ListFilter{Deleted: true}, 3},
+		{storage.ListFilter{Type: &noteType}, 1},
+		{storage.ListFilter{Tag: &workTag, Deleted: true}, 2},
+		{storage.ListFilter{Limit: 1, Offset: 1}, 2}, // Paging is ignored
+	}
+	for _, tt := range tests {
+		if n, err := store.Count(tt.filter); err != nil || n != tt.want {
+			t.Errorf("Count(%+v) = %d, %v; want %d", tt.filter, n, err, tt.want)
+		}
+	}
+
+	for id, want := range map[uuid.UUID]bool{e1.ID: true, e3.ID: false, uuid.New(): false} {
+		if found, err := store.Exists(id); err != nil || found != want {
+			t.Errorf("Exists(%s) = %v, %v; want %v", id, found, err, want)
+		}
+	}
+}
+
+func TestListArchived(t *testing.T) {
+	store, _ := New(":memory:")
+	defer store.Close()
+
+	live := core.NewEntry(core.Note, []byte("live"), nil, 1)
+	archived := core.NewEntry(core.Note, []byte("archived"), nil, 2)
+	archived.Archived, archived.ArchivedAt = true, 3
+	store.Put(live)
+	store.Put(archived)
+
+	tests := []struct {
+		filter storage.ListFilter
+		want   []uuid.UUID
+	}{
+		{storage.ListFilter{}, []uuid.UUID{live.ID}},
+		{storage.ListFilter{Archived: true}, []uuid.UUID{archived.ID, live.ID}},
+		{storage.ListFilter{OnlyArchived: true}, []uuid.UUID{archived.ID}},
+	}
+	for _, tt := range tests {
+		entries, err := store.List(tt.filter)
+		if err != nil {
+			t.Fatalf("List(%+v) failed: %v", tt.filter, err)
+		}
+		var got []uuid.UUID
+		for _, e := range entries {
+			got = append(got, e.ID)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("List(%+v) = %v, want %v", tt.filter, got, tt.want)
+		}
+	}
+
+	got, err := store.Get(archived.ID)
+	if err != nil || !got.Archived || got.ArchivedAt != 3 {
+		t.Errorf("expected archived at 3, got %+v (%v)", got, err)
+	}
+	if max, err := store.GetMaxTimestamp(); err != nil || max != 3 {
+		t.Errorf("expected max timestamp 3 (the archive), got %d (%v)", max, err)
+	}
+}
+
 func TestListWithTimeFilters(t *testing.T) {
 	store, _ := New(":memory:")
 	defer store.Close()
@@ -190,6 +369,54 @@ func TestListWithPagination(t *testing.T) {
 	}
 }
 
+func TestListSorting(t *testing.T) {
+	store, _ := New(":memory:")
+	defer store.Close()
+
+	// Created in order 1, 2, 3; updated in order 3, 1, 2
+	e1 := core.NewEntry(core.Note, []byte("1"), nil, 1)
+	e2 := core.NewEntry(core.Note, []byte("2"), nil, 2)
+	e3 := core.NewEntry(core.Note, []byte("3"), nil, 3)
+	e1.UpdatedAt, e2.UpdatedAt, e3.UpdatedAt = 20, 30, 10
+	store.Put(e1)
+	store.Put(e2)
+	store.Put(e3)
+	// Titled b, untitled, B (e3 ties with e1 and was updated before)
+	if err := store.SetTitles(map[uuid.UUID]string{e1.ID: "b", e2.ID: "", e3.ID: "B"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		filter storage.ListFilter
+		want   string
+	}{
+		{storage.ListFilter{}, "213"},
+		{storage.ListFilter{Ascending: true}, "312"},
+		{storage.ListFilter{Sort: storage.SortCreatedAt}, "321"},
+		{storage.ListFilter{Sort: storage.SortCreatedAt, Ascending: true, Limit: 2}, "12"},
+		{storage.ListFilter{Sort: storage.SortTitle}, "132"},
+		{storage.ListFilter{Sort: storage.SortTitle, Ascending: true}, "312"},
+		{storage.ListFilter{Sort: storage.SortTitle, Limit: 1, Offset: 1}, "3"},
+	}
+	for _, tt := range tests {
+		entries, err := store.List(tt.filter)
+		if err != nil {
+			t.Fatalf("failed to list %+v: %v", tt.filter, err)
+		}
+		got := ""
+		for _, entry := range entries {
+			got += string(entry.Content)
+		}
+		if got != tt.want {
+			t.Errorf("%+v: expected order %s, got %s", tt.filter, tt.want, got)
+		}
+	}
+
+	if _, err := store.List(storage.ListFilter{Sort: "content"}); err == nil {
+		t.Error("expected an error for an unknown sort field")
+	}
+}
+
 func TestDelete(t *testing.T) {
 	store, _ := New(":memory:")
 	defer store.Close()
@@ -231,6 +458,69 @@ func TestDeleteNotFound(t *testing.T) {
 	}
 }
 
+func TestFullTextIndex(t *testing.T) {
+	store, _ := New(":memory:")
+	defer store.Close()
+
+	if _, err := store.Search("milk", SearchOptions{}); !errors.Is(err, ErrFullTextUnavailable) {
+		t.Fatalf("expected search to be unavailable before the index is on, got %v", err)
+	}
+
+	before := core.NewEntry(core.Note, []byte("buy milk and eggs"), nil, 1)
+	store.Put(before)
+	err := store.SetFullTextIndex(true)
+	if errors.Is(err, ErrFullTextUnavailable) {
+		t.Skip("SQLite built without FTS5 (-tags sqlite_fts5)")
+	}
+	if err != nil {
+		t.Fatalf("SetFullTextIndex failed: %v", err)
+	}
+
+	search := func(query string) []uuid.UUID {
+		t.Helper()
+		entries, err := store.Search(query, SearchOptions{})
+		if err != nil {
+			t.Fatalf("search %q failed: %v", query, err)
+		}
+		var ids []uuid.UUID
+		for _, entry := range entries {
+			ids = append(ids, entry.ID)
+		}
+		return ids
+	}
+
+	// Entries written before the index was on are indexed
+	if ids := search("milk"); len(ids) != 1 || ids[0] != before.ID {
+		t.Errorf("expected the existing entry, got %v", ids)
+	}
+
+	// ...and writes keep it up to date
+	after := core.NewEntry(core.Note, []byte("walk the dog"), nil, 2)
+	store.Put(after)
+	before.Content, before.UpdatedAt = []byte("buy bread"), 3
+	store.Put(before)
+	if ids := search("dog"); len(ids) != 1 || ids[0] != after.ID {
+		t.Errorf("expected the new entry, got %v", ids)
+	}
+	if ids := search("milk"); len(ids) != 0 {
+		t.Errorf("expected replaced content to be unindexed, got %v", ids)
+	}
+	store.Delete(after.ID)
+	if ids := search("dog"); len(ids) != 0 {
+		t.Errorf("expected deleted entries to be left out, got %v", ids)
+	}
+
+	// Turning the index off drops it
+	if err := store.SetFullTextIndex(false); err != nil {
+		t.Fatalf("SetFullTextIndex(false) failed: %v", err)
+	}
+	var n int
+	store.db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name LIKE 'entries_fts%'`).Scan(&n)
+	if n != 0 {
+		t.Errorf("expected the index and its triggers dropped, %d left", n)
+	}
+}
+
 func TestApplyBatch(t *testing.T) {
 	store, _ := New(":memory:")
 	defer store.Close()
@@ -0,0 +1,262 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/amaydixit11/acorde/internal/core"
+)
+
+// maxTagChunk is the most tags written by one multi-row statement. Tag
+// writes are split into power-of-two chunks so their statements can all
+// be prepared up front.
+const maxTagChunk = 64
+
+// Frequently used statements
+const (
+	upsertEntrySQL = `
+		INSERT INTO entries (id, type, content, created_at, updated_at, deleted, created_time, updated_time, archived, archived_at, schema_version, author, collection, collection_at, namespace)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			type = excluded.type,
+			content = excluded.content,
+			updated_at = excluded.updated_at,
+			deleted = excluded.deleted,
+			updated_time = excluded.updated_time,
+			archived = excluded.archived,
+			archived_at = excluded.archived_at,
+			schema_version = excluded.schema_version,
+			author = excluded.author,
+			collection = excluded.collection,
+			collection_at = excluded.collection_at,
+			namespace = excluded.namespace`
+	getEntrySQL = `
+		SELECT id, type, content, created_at, updated_at, deleted, created_time, updated_time, archived, archived_at, schema_version, author, collection, collection_at, namespace
+		FROM entries
+		WHERE id = ?`
+	getTagsSQL      = "SELECT tag FROM tags WHERE entry_id = ?"
+	deleteEntrySQL  = "UPDATE entries SET deleted = 1 WHERE id = ?"
+	setTitleSQL     = "UPDATE entries SET sort_title = ? WHERE id = ? AND sort_title != ?"
+	existsSQL       = "SELECT EXISTS(SELECT 1 FROM entries WHERE id = ? AND deleted = 0)"
+	idPrefixSQL     = "SELECT id FROM entries WHERE id >= ? AND id < ? || '~' AND deleted = 0 ORDER BY id LIMIT ?"
+	maxTimestampSQL = "SELECT MAX(MAX(updated_at), MAX(archived_at), MAX(collection_at)) FROM entries"
+	namespacesSQL   = "SELECT namespace, COUNT(*) FROM entries WHERE deleted = 0 GROUP BY namespace ORDER BY namespace"
+)
+
+// stmtCache holds prepared statements keyed by their SQL text. Only
+// queries from a bounded set (fixed statements, filter combinations,
+// chunked tag writes) should go through it.
+type stmtCache struct {
+	db    *sql.DB
+	mu    sync.Mutex
+	stmts map[string]*sql.Stmt
+}
+
+func newStmtCache(db *sql.DB) *stmtCache {
+	return &stmtCache{db: db, stmts: make(map[string]*sql.Stmt)}
+}
+
+// get returns the prepared statement for query, preparing it on first use.
+// Preparing waits for a connection, so it happens without c.mu held: a
+// transaction holding the only connection may need c.mu to finish.
+func (c *stmtCache) get(query string) (*sql.Stmt, error) {
+	c.mu.Lock()
+	stmt, ok := c.stmts[query]
+	c.mu.Unlock()
+	if ok {
+		return stmt, nil
+	}
+
+	stmt, err := c.db.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if existing, ok := c.stmts[query]; ok {
+		stmt.Close() // Prepared concurrently
+		return existing, nil
+	}
+	c.stmts[query] = stmt
+	return stmt, nil
+}
+
+// prepare prepares queries ahead of use. Statements used inside
+// transactions must be prepared this way: preparing while a transaction
+// holds the connection would open another one (a separate database for
+// ":memory:").
+func (c *stmtCache) prepare(queries ...string) error {
+	for _, query := range queries {
+		if _, err := c.get(query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// close releases all prepared statements
+func (c *stmtCache) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for query, stmt := range c.stmts {
+		stmt.Close()
+		delete(c.stmts, query)
+	}
+}
+
+// txStatements lists the statements used inside transactions
+func txStatements() []string {
+	queries := []string{upsertEntrySQL, getTagsSQL, deleteEntrySQL, setTitleSQL}
+	for n := 1; n <= maxTagChunk; n *= 2 {
+		queries = append(queries, insertTagsSQL(n), deleteTagsSQL(n))
+	}
+	return queries
+}
+
+// txStmt returns a prepared statement bound to tx, falling back to one
+// prepared on tx itself for statements not prepared up front
+func (s *SQLiteStore) txStmt(tx *sql.Tx, query string) (*sql.Stmt, error) {
+	s.stmts.mu.Lock()
+	stmt, ok := s.stmts.stmts[query]
+	s.stmts.mu.Unlock()
+	if !ok {
+		return tx.Prepare(query)
+	}
+	return tx.Stmt(stmt), nil
+}
+
+// insertTagsSQL inserts n tags for one entry
+func insertTagsSQL(n int) string {
+	return "INSERT INTO tags (entry_id, tag) VALUES " + strings.Repeat("(?, ?),", n-1) + "(?, ?)"
+}
+
+// deleteTagsSQL deletes n tags of one entry
+func deleteTagsSQL(n int) string {
+	return "DELETE FROM tags WHERE entry_id = ? AND tag IN (" + strings.Repeat("?,", n-1) + "?)"
+}
+
+// tagChunk returns the size of the next chunk for n remaining tags: the
+// largest power of two not above n or maxTagChunk
+func tagChunk(n int) int {
+	chunk := 1
+	for chunk*2 <= n && chunk*2 <= maxTagChunk {
+		chunk *= 2
+	}
+	return chunk
+}
+
+// putEntry upserts an entry inside tx. Tags are diffed against the stored
+// set so unchanged tags are not rewritten.
+func (s *SQLiteStore) putEntry(tx *sql.Tx, entry core.Entry) error {
+	upsert, err := s.txStmt(tx, upsertEntrySQL)
+	if err != nil {
+		return err
+	}
+	id := entry.ID.String()
+	if _, err := upsert.Exec(id, string(entry.Type), entry.Content, entry.CreatedAt, entry.UpdatedAt,
+		boolToInt(entry.Deleted), entry.CreatedTime, entry.UpdatedTime,
+		boolToInt(entry.Archived), entry.ArchivedAt, entry.SchemaVersion, entry.Author,
+		collectionColumn(entry.Collection), entry.CollectionAt, entry.Namespace); err != nil {
+		return fmt.Errorf("failed to upsert entry: %w", err)
+	}
+
+	existing, err := s.loadTags(tx, id)
+	if err != nil {
+		return err
+	}
+	added, removed := diffTags(existing, entry.Tags)
+	if err := s.deleteTags(tx, id, removed); err != nil {
+		return err
+	}
+	return s.insertTags(tx, id, added)
+}
+
+// loadTags reads an entry's stored tags inside tx
+func (s *SQLiteStore) loadTags(tx *sql.Tx, id string) ([]string, error) {
+	stmt, err := s.txStmt(tx, getTagsSQL)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := stmt.Query(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tags: %w", err)
+	}
+	defer rows.Close()
+
+	var tags []string
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, fmt.Errorf("failed to scan tag: %w", err)
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+// insertTags adds tags with multi-row INSERTs
+func (s *SQLiteStore) insertTags(tx *sql.Tx, id string, tags []string) error {
+	for len(tags) > 0 {
+		n := tagChunk(len(tags))
+		stmt, err := s.txStmt(tx, insertTagsSQL(n))
+		if err != nil {
+			return err
+		}
+		args := make([]interface{}, 0, 2*n)
+		for _, tag := range tags[:n] {
+			args = append(args, id, tag)
+		}
+		if _, err := stmt.Exec(args...); err != nil {
+			return fmt.Errorf("failed to insert tags: %w", err)
+		}
+		tags = tags[n:]
+	}
+	return nil
+}
+
+// deleteTags removes tags with multi-value DELETEs
+func (s *SQLiteStore) deleteTags(tx *sql.Tx, id string, tags []string) error {
+	for len(tags) > 0 {
+		n := tagChunk(len(tags))
+		stmt, err := s.txStmt(tx, deleteTagsSQL(n))
+		if err != nil {
+			return err
+		}
+		args := make([]interface{}, 0, n+1)
+		args = append(args, id)
+		for _, tag := range tags[:n] {
+			args = append(args, tag)
+		}
+		if _, err := stmt.Exec(args...); err != nil {
+			return fmt.Errorf("failed to delete tags: %w", err)
+		}
+		tags = tags[n:]
+	}
+	return nil
+}
+
+// diffTags returns the tags to add and remove to turn old into new
+// (duplicates in new are written once)
+func diffTags(old, new []string) (added, removed []string) {
+	have := make(map[string]bool, len(old))
+	for _, tag := range old {
+		have[tag] = true
+	}
+	want := make(map[string]bool, len(new))
+	for _, tag := range new {
+		if !want[tag] && !have[tag] {
+			added = append(added, tag)
+		}
+		want[tag] = true
+	}
+	for _, tag := range old {
+		if !want[tag] {
+			removed = append(removed, tag)
+		}
+	}
+	return added, removed
+}
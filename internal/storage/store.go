@@ -1,19 +1,63 @@
 package storage
 
 import (
+	"database/sql"
+
 	"github.com/amaydixit11/acorde/internal/core"
 	"github.com/google/uuid"
 )
 
 // ListFilter specifies criteria for filtering entries
 type ListFilter struct {
-	Type      *core.EntryType // Filter by entry type
-	Tag       *string         // Filter by tag
-	Since     *uint64         // Entries updated after this time
-	Until     *uint64         // Entries updated before this time
-	Deleted   bool            // Include deleted entries
-	Limit     int             // Max number of results (0 = no limit)
-	Offset    int             // Skip first N results
+	Type         *core.EntryType // Filter by entry type
+	Tag          *string         // Filter by tag
+	Since        *uint64         // Entries updated after this time
+	Until        *uint64         // Entries updated before this time
+	Deleted      bool            // Include deleted entries
+	Archived     bool            // Include archived entries
+	OnlyArchived bool            // Only archived entries
+	Collections  []uuid.UUID     // Only entries filed in one of these (uuid.Nil = in none; nil = any)
+	Namespace    *string         // Only entries in this namespace (nil = any)
+	Limit        int             // Max number of results (0 = no limit)
+	Offset       int             // Skip first N results
+
+	Sort      SortField // Order by this field ("" = SortUpdatedAt)
+	Ascending bool      // Oldest first instead of newest first
+
+	WithoutContent bool // Leave Content nil, for metadata-only listing
+}
+
+// SortField is a field List orders entries by
+type SortField string
+
+const (
+	SortUpdatedAt SortField = "updated_at"
+	SortCreatedAt SortField = "created_at"
+
+	// SortTitle orders by the titles stored with SetTitles,
+	// case-insensitively, untitled entries last either way
+	SortTitle SortField = "title"
+)
+
+// AggregateFilter selects and groups the entries Aggregate counts.
+// Entries without a wall-clock creation time are left out, and so, with
+// Path, are entries whose content has no number there.
+type AggregateFilter struct {
+	Type  *core.EntryType // Filter by entry type
+	Tag   *string         // Filter by tag
+	Since int64           // Created at or after, Unix ms (0 = unbounded)
+	Until int64           // Created before, Unix ms (0 = unbounded)
+	Slot  int64           // Group width in ms, from the Unix epoch
+	Path  string          // JSON path of a field to total ("" = count only)
+}
+
+// AggregateRow is one group of entries
+type AggregateRow struct {
+	Start int64 // Unix ms, a multiple of Slot
+	Count int
+	Sum   float64
+	Min   float64
+	Max   float64
 }
 
 // OperationType represents the type of batch operation
@@ -43,18 +87,49 @@ type Store interface {
 	
 	// List returns entries matching the filter
 	List(filter ListFilter) ([]core.Entry, error)
+
+	// Count returns the number of entries matching the filter, ignoring
+	// its Limit, Offset and Sort
+	Count(filter ListFilter) (int, error)
+
+	// Exists reports whether a live (not deleted) entry is stored
+	Exists(id uuid.UUID) (bool, error)
+
+	// SetTitles stores the titles entries sort by with SortTitle. Titles
+	// are plaintext: only store them for vaults whose content is.
+	SetTitles(titles map[uuid.UUID]string) error
 	
 	// Delete marks an entry as deleted (tombstone)
 	// This is a logical delete for CRDT purposes
 	Delete(id uuid.UUID) error
 	
+	// PutWith stores an entry and runs fn in the same transaction, so
+	// rows fn writes commit or roll back with the entry
+	PutWith(entry core.Entry, fn func(tx *sql.Tx) error) error
+
 	// ApplyBatch applies multiple operations atomically
 	ApplyBatch(ops []Operation) error
 	
-	// GetMaxTimestamp returns the highest UpdatedAt timestamp in storage
+	// GetMaxTimestamp returns the highest UpdatedAt or ArchivedAt timestamp in storage
 	// Used for clock recovery after restart
 	GetMaxTimestamp() (uint64, error)
+
+	// Aggregate groups live entries by wall-clock creation time
+	Aggregate(filter AggregateFilter) ([]AggregateRow, error)
+
+	// Namespaces counts live entries by namespace ("" = the default one)
+	Namespaces() (map[string]int, error)
+
+	// IDsWithPrefix returns up to limit IDs of live entries whose string
+	// form starts with prefix (lowercase hex digits and '-')
+	IDsWithPrefix(prefix string, limit int) ([]uuid.UUID, error)
+
+	// Ping checks that the database is reachable and answers queries
+	Ping() error
 	
+	// Flush makes every committed write durable in the database file
+	Flush() error
+
 	// Close releases all resources
 	Close() error
 }
@@ -1,10 +1,8 @@
 package sync
 
 import (
-	"crypto/sha256"
-	"encoding/json"
-
 	"github.com/amaydixit11/acorde/internal/crdt"
+	"github.com/libp2p/go-libp2p/core/peer"
 )
 
 // Syncable defines the interface an engine must implement for sync
@@ -17,6 +15,19 @@ type Syncable interface {
 	ApplySyncState(state crdt.ReplicaState) error
 }
 
+// MergeReporter is a Syncable that reports what each merge did
+type MergeReporter interface {
+	// MergeSyncState is ApplySyncState returning the merge's stats
+	MergeSyncState(state crdt.ReplicaState) (crdt.MergeStats, error)
+}
+
+// PeerMergeReporter is a MergeReporter told which authenticated peer sent
+// each state, so the engine can check that peer's writes against its ACLs
+// rather than the authors the state names
+type PeerMergeReporter interface {
+	MergeSyncStateFrom(from string, state crdt.ReplicaState) (crdt.MergeStats, error)
+}
+
 // EngineAdapter adapts a Syncable engine for the sync service
 type EngineAdapter struct {
 	engine Syncable
@@ -37,10 +48,26 @@ func (a *EngineAdapter) ApplyState(state crdt.ReplicaState) error {
 	return a.engine.ApplySyncState(state)
 }
 
+// MergeState merges remote state into local, returning the merge's
+// stats. Engines that are not MergeReporters are timed here, and report
+// no changed entries.
+func (a *EngineAdapter) MergeState(state crdt.ReplicaState) (crdt.MergeStats, error) {
+	if reporter, ok := a.engine.(MergeReporter); ok {
+		return reporter.MergeSyncState(state)
+	}
+	return timeMerge(state, a.engine.ApplySyncState)
+}
+
+// MergeStateFrom is MergeState for state sent by the peer from, passed on
+// to engines that are PeerMergeReporters
+func (a *EngineAdapter) MergeStateFrom(from peer.ID, state crdt.ReplicaState) (crdt.MergeStats, error) {
+	if reporter, ok := a.engine.(PeerMergeReporter); ok {
+		return reporter.MergeSyncStateFrom(from.String(), state)
+	}
+	return a.MergeState(state)
+}
+
 // StateHash returns a hash of current state for quick comparison
 func (a *EngineAdapter) StateHash() []byte {
-	state := a.engine.GetSyncState()
-	data, _ := json.Marshal(state)
-	hash := sha256.Sum256(data)
-	return hash[:]
+	return ComputeStateHash(a.engine.GetSyncState())
 }
@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	gosync "sync"
+	"time"
 
 	"github.com/libp2p/go-libp2p/core/peer"
 )
@@ -13,22 +15,26 @@ import (
 // Allowlist manages trusted peers
 type Allowlist struct {
 	peers   map[peer.ID]AllowedPeer
-	mu      gosync.RWMutex
+	mu      gosync.Mutex
 	path    string
-	strict  bool // If true, reject unknown peers
+	strict  bool                 // If true, reject unknown peers
+	revoked map[peer.ID]struct{} // Always rejected, strict or not
+	modTime time.Time            // Of the file as last loaded
 }
 
 // AllowedPeer contains info about a trusted peer
 type AllowedPeer struct {
-	PeerID    string `json:"peer_id"`
-	Name      string `json:"name,omitempty"`
-	AddedAt   int64  `json:"added_at"`
+	PeerID    string   `json:"peer_id"`
+	Name      string   `json:"name,omitempty"`
+	AddedAt   int64    `json:"added_at"`
 	Addresses []string `json:"addresses,omitempty"`
+	DeviceKey []byte   `json:"device_key,omitempty"` // X25519 public key for key grants
 }
 
 // allowlistFile is the storage format
 type allowlistFile struct {
-	Peers []AllowedPeer `json:"peers"`
+	Peers   []AllowedPeer `json:"peers"`
+	Revoked []string      `json:"revoked,omitempty"`
 }
 
 // NewAllowlist creates a new allowlist, loading from disk if exists
@@ -36,9 +42,10 @@ func NewAllowlist(dataDir string, strict bool) (*Allowlist, error) {
 	path := filepath.Join(dataDir, "peers.json")
 	
 	al := &Allowlist{
-		peers:  make(map[peer.ID]AllowedPeer),
-		path:   path,
-		strict: strict,
+		peers:   make(map[peer.ID]AllowedPeer),
+		path:    path,
+		strict:  strict,
+		revoked: make(map[peer.ID]struct{}),
 	}
 
 	// Load existing allowlist
@@ -49,35 +56,107 @@ func NewAllowlist(dataDir string, strict bool) (*Allowlist, error) {
 	return al, nil
 }
 
-// Add adds a peer to the allowlist
+// Add adds a peer to the allowlist. Adding a revoked peer (re-pairing it)
+// lifts the revocation.
 func (al *Allowlist) Add(peerID peer.ID, name string, addresses []string) error {
 	al.mu.Lock()
 	defer al.mu.Unlock()
+	al.refresh()
 
 	al.peers[peerID] = AllowedPeer{
 		PeerID:    peerID.String(),
 		Name:      name,
 		AddedAt:   0, // Will be set on save
 		Addresses: addresses,
+		DeviceKey: al.peers[peerID].DeviceKey,
 	}
+	delete(al.revoked, peerID)
 
 	return al.save()
 }
 
+// SetDeviceKey records the X25519 public key a peer uses for key grants
+func (al *Allowlist) SetDeviceKey(peerID peer.ID, key []byte) error {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	al.refresh()
+
+	p, ok := al.peers[peerID]
+	if !ok {
+		p = AllowedPeer{PeerID: peerID.String()}
+	}
+	p.DeviceKey = key
+	al.peers[peerID] = p
+	return al.save()
+}
+
+// SetAddresses records the addresses a peer is reachable at, if it is in
+// the allowlist. It reports whether they changed.
+func (al *Allowlist) SetAddresses(peerID peer.ID, addresses []string) (bool, error) {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	al.refresh()
+
+	p, ok := al.peers[peerID]
+	if !ok || slices.Equal(p.Addresses, addresses) {
+		return false, nil
+	}
+	p.Addresses = addresses
+	al.peers[peerID] = p
+	return true, al.save()
+}
+
+// Get returns a peer's allowlist entry
+func (al *Allowlist) Get(peerID peer.ID) (AllowedPeer, bool) {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	al.refresh()
+
+	p, ok := al.peers[peerID]
+	return p, ok
+}
+
+// Revoke removes a peer and rejects it from now on, even when the
+// allowlist is not strict
+func (al *Allowlist) Revoke(peerID peer.ID) error {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	al.refresh()
+
+	delete(al.peers, peerID)
+	al.revoked[peerID] = struct{}{}
+	return al.save()
+}
+
+// IsRevoked reports whether a peer has been revoked
+func (al *Allowlist) IsRevoked(peerID peer.ID) bool {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	al.refresh()
+
+	_, ok := al.revoked[peerID]
+	return ok
+}
+
 // Remove removes a peer from the allowlist
 func (al *Allowlist) Remove(peerID peer.ID) error {
 	al.mu.Lock()
 	defer al.mu.Unlock()
+	al.refresh()
 
 	delete(al.peers, peerID)
 	return al.save()
 }
 
-// IsAllowed checks if a peer is in the allowlist
+// IsAllowed checks if a peer is in the allowlist and not revoked
 func (al *Allowlist) IsAllowed(peerID peer.ID) bool {
-	al.mu.RLock()
-	defer al.mu.RUnlock()
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	al.refresh()
 
+	if _, ok := al.revoked[peerID]; ok {
+		return false
+	}
 	if !al.strict {
 		return true // Accept all peers if not strict
 	}
@@ -88,8 +167,9 @@ func (al *Allowlist) IsAllowed(peerID peer.ID) bool {
 
 // List returns all allowed peers
 func (al *Allowlist) List() []AllowedPeer {
-	al.mu.RLock()
-	defer al.mu.RUnlock()
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	al.refresh()
 
 	result := make([]AllowedPeer, 0, len(al.peers))
 	for _, p := range al.peers {
@@ -98,8 +178,22 @@ func (al *Allowlist) List() []AllowedPeer {
 	return result
 }
 
+// refresh reloads the allowlist if another process (e.g. `acorde device
+// revoke` next to a running daemon) changed the file
+func (al *Allowlist) refresh() {
+	info, err := os.Stat(al.path)
+	if err != nil || info.ModTime().Equal(al.modTime) {
+		return
+	}
+	al.load()
+}
+
 // load reads the allowlist from disk
 func (al *Allowlist) load() error {
+	info, err := os.Stat(al.path)
+	if err != nil {
+		return err
+	}
 	data, err := os.ReadFile(al.path)
 	if err != nil {
 		return err
@@ -110,6 +204,7 @@ func (al *Allowlist) load() error {
 		return err
 	}
 
+	al.peers = make(map[peer.ID]AllowedPeer, len(file.Peers))
 	for _, p := range file.Peers {
 		peerID, err := peer.Decode(p.PeerID)
 		if err != nil {
@@ -117,6 +212,13 @@ func (al *Allowlist) load() error {
 		}
 		al.peers[peerID] = p
 	}
+	al.revoked = make(map[peer.ID]struct{}, len(file.Revoked))
+	for _, id := range file.Revoked {
+		if peerID, err := peer.Decode(id); err == nil {
+			al.revoked[peerID] = struct{}{}
+		}
+	}
+	al.modTime = info.ModTime()
 
 	return nil
 }
@@ -134,18 +236,28 @@ func (al *Allowlist) save() error {
 	for _, p := range al.peers {
 		file.Peers = append(file.Peers, p)
 	}
+	for peerID := range al.revoked {
+		file.Revoked = append(file.Revoked, peerID.String())
+	}
 
 	data, err := json.MarshalIndent(file, "", "  ")
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(al.path, data, 0600)
+	if err := os.WriteFile(al.path, data, 0600); err != nil {
+		return err
+	}
+	if info, err := os.Stat(al.path); err == nil {
+		al.modTime = info.ModTime()
+	}
+	return nil
 }
 
 // Count returns the number of allowed peers
 func (al *Allowlist) Count() int {
-	al.mu.RLock()
-	defer al.mu.RUnlock()
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	al.refresh()
 	return len(al.peers)
 }
@@ -0,0 +1,229 @@
+package sync
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/amaydixit11/acorde/internal/blob"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Blob transfer: entries sync through the state exchange, but the blobs
+// of File entries are fetched separately, in chunks. The fetching peer
+// asks for the blob's manifest (chunk size and the SHA-256 of each
+// chunk), then for each chunk it lacks. Chunks are verified as they
+// arrive and kept until the whole blob is assembled and matches its CID,
+// so an interrupted transfer resumes where it stopped.
+
+// blobRequest asks for a blob's manifest (Chunk < 0) or one chunk
+type blobRequest struct {
+	CID       blob.CID `json:"cid"`
+	ChunkSize int      `json:"chunk_size"`
+	Chunk     int      `json:"chunk"`
+}
+
+// blobResponse answers a blobRequest. A chunk's bytes follow it,
+// length-prefixed.
+type blobResponse struct {
+	Manifest *blob.Manifest `json:"manifest,omitempty"`
+	Error    string         `json:"error,omitempty"`
+}
+
+// maxManifestFrame bounds manifest responses (about 16 GB of 256 KB
+// chunks)
+const maxManifestFrame = 8 << 20
+
+// blobRequestTimeout bounds each request of a blob transfer
+const blobRequestTimeout = 30 * time.Second
+
+// FetchBlob fetches a blob from a peer in chunks, resuming a transfer
+// interrupted before, and stores it once it matches its CID. Blobs
+// already stored are not fetched again.
+func (s *p2pService) FetchBlob(ctx context.Context, peerID peer.ID, cid blob.CID) error {
+	blobs := s.config.Blobs
+	if blobs == nil {
+		return errors.New("blob transfer is disabled")
+	}
+	if blobs.Has(cid) {
+		return nil
+	}
+	if !s.checkAllowlist(peerID) {
+		return fmt.Errorf("peer %s is not allowed", peerID)
+	}
+
+	stream, err := s.transport.Dial(ctx, peerID, BlobProtocolID)
+	if err != nil {
+		return fmt.Errorf("failed to open blob stream: %w", err)
+	}
+	defer stream.Close()
+
+	req := blobRequest{CID: cid, ChunkSize: s.config.BlobChunkSize, Chunk: -1}
+	resp, err := s.blobRoundTrip(stream, req)
+	if err != nil {
+		return err
+	}
+	if resp.Manifest == nil || resp.Manifest.CID != cid {
+		return fmt.Errorf("peer sent no manifest for blob %s", cid)
+	}
+	if err := blobs.StartDownload(*resp.Manifest); err != nil {
+		return err
+	}
+	missing, err := blobs.MissingChunks(cid)
+	if err != nil {
+		return err
+	}
+
+	for _, i := range missing {
+		req.ChunkSize, req.Chunk = resp.Manifest.ChunkSize, i
+		if _, err := s.blobRoundTrip(stream, req); err != nil {
+			return err
+		}
+		data, err := readChunk(stream, resp.Manifest.ChunkSize)
+		if err != nil {
+			return fmt.Errorf("failed to read chunk %d: %w", i, err)
+		}
+		if err := blobs.PutChunk(cid, i, data); err != nil {
+			return err
+		}
+		atomic.AddInt64(&s.blobChunks, 1)
+	}
+
+	if err := blobs.FinishDownload(cid); err != nil {
+		return err
+	}
+	atomic.AddInt64(&s.blobsFetched, 1)
+	s.logger.Infof("fetched blob %s from %s (%d of %d chunks)", cid[:8], peerID.String()[:8],
+		len(missing), len(resp.Manifest.Chunks))
+	return nil
+}
+
+// blobRoundTrip sends a request and reads its response
+func (s *p2pService) blobRoundTrip(stream Stream, req blobRequest) (blobResponse, error) {
+	stream.SetDeadline(time.Now().Add(blobRequestTimeout))
+	if err := writeFrame(stream, &req); err != nil {
+		return blobResponse{}, fmt.Errorf("failed to send blob request: %w", err)
+	}
+	var resp blobResponse
+	if err := readBlobFrame(stream, &resp); err != nil {
+		return blobResponse{}, fmt.Errorf("failed to read blob response: %w", err)
+	}
+	if resp.Error != "" {
+		return blobResponse{}, errors.New(resp.Error)
+	}
+	return resp, nil
+}
+
+// handleBlobStream serves blob manifests and chunks to allowed peers
+func (s *p2pService) handleBlobStream(stream Stream) {
+	defer stream.Close()
+
+	from := stream.RemotePeer()
+	if !s.checkAllowlist(from) {
+		s.logger.Errorf("rejected blob request from unauthorized peer %s", from)
+		return
+	}
+
+	for {
+		stream.SetDeadline(time.Now().Add(blobRequestTimeout))
+		var req blobRequest
+		if err := readFrame(stream, &req); err != nil {
+			return // Done, or the peer went away
+		}
+		chunkSize := req.ChunkSize
+		if chunkSize <= 0 {
+			chunkSize = s.config.BlobChunkSize
+		}
+
+		if req.Chunk < 0 {
+			m, err := s.config.Blobs.Manifest(req.CID, chunkSize)
+			if err != nil {
+				writeFrame(stream, &blobResponse{Error: err.Error()})
+				return
+			}
+			if err := writeFrame(stream, &blobResponse{Manifest: &m}); err != nil {
+				return
+			}
+			continue
+		}
+
+		data, err := s.config.Blobs.ReadChunk(req.CID, chunkSize, req.Chunk)
+		if err != nil {
+			writeFrame(stream, &blobResponse{Error: err.Error()})
+			return
+		}
+		if err := writeFrame(stream, &blobResponse{}); err != nil {
+			return
+		}
+		if err := writeChunk(stream, data); err != nil {
+			return
+		}
+	}
+}
+
+// fetchWantedBlobs fetches the blobs Config.WantBlobs reports missing
+// from connected peers, trying each until one has the blob
+func (s *p2pService) fetchWantedBlobs() {
+	if !s.fetchingBlobs.CompareAndSwap(false, true) {
+		return // Still fetching since the last round
+	}
+	defer s.fetchingBlobs.Store(false)
+
+	for _, cid := range s.config.WantBlobs() {
+		for _, peerID := range s.Peers() {
+			if !s.transport.Connected(peerID) {
+				continue
+			}
+			ctx, cancel := context.WithTimeout(s.ctx, 10*time.Minute)
+			err := s.FetchBlob(ctx, peerID, cid)
+			cancel()
+			if err == nil {
+				break
+			}
+			s.logger.Debugf("blob %s from %s: %v", cid[:8], peerID.String()[:8], err)
+			if s.ctx.Err() != nil {
+				return
+			}
+		}
+	}
+}
+
+// readBlobFrame reads a length-prefixed JSON value, allowing frames as
+// large as a manifest
+func readBlobFrame(r io.Reader, v interface{}) error {
+	data, err := readChunk(r, maxManifestFrame)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// writeChunk writes length-prefixed bytes
+func writeChunk(w io.Writer, data []byte) error {
+	if err := binary.Write(w, binary.BigEndian, uint32(len(data))); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// readChunk reads length-prefixed bytes of at most max bytes
+func readChunk(r io.Reader, max int) ([]byte, error) {
+	var length uint32
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+	if int64(length) > int64(max) {
+		return nil, fmt.Errorf("blob frame too large: %d bytes", length)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
@@ -0,0 +1,424 @@
+package sync
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/amaydixit11/acorde/internal/crdt"
+	vcrypto "github.com/amaydixit11/acorde/pkg/crypto"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// BundleExt is the file extension of sync bundles
+const BundleExt = ".acorde"
+
+// bundleVersion is the version of the bundle file format
+const bundleVersion = 1
+
+var (
+	// ErrBundleSignature is returned for a bundle whose signature does not
+	// verify: it was altered, or not created by the peer it names
+	ErrBundleSignature = errors.New("bundle signature is invalid")
+
+	// ErrUntrustedBundle is returned for a bundle signed by a peer that is
+	// not trusted
+	ErrUntrustedBundle = errors.New("bundle is not from a trusted peer")
+
+	// ErrBundleKey is returned for an encrypted bundle without the vault
+	// key it was encrypted with
+	ErrBundleKey = errors.New("bundle is encrypted with another vault key")
+)
+
+// bundleAAD binds encrypted bundle state to its purpose
+var bundleAAD = []byte("acorde bundle")
+
+// Bundle is replica state written to a file for offline sync, carried
+// between devices that are never online together (e.g. on a USB stick or
+// across an air gap). It is signed with the identity key of the device
+// that created it and, from an encrypted vault, encrypted with the vault
+// key. The signature covers the ciphertext, so it verifies without the key.
+type Bundle struct {
+	Version   int             `json:"version"`
+	Format    int             `json:"format"` // Data format of the state
+	Peer      string          `json:"peer"`   // Creator's peer ID
+	PublicKey []byte          `json:"public_key"`
+	Created   time.Time       `json:"created"`
+	Since     uint64          `json:"since,omitempty"`  // Changes after this time (0 = full state)
+	Clock     uint64          `json:"clock"`            // Creator's clock time
+	State     json.RawMessage `json:"state,omitempty"`  // crdt.ReplicaState, unless encrypted
+	Sealed    []byte          `json:"sealed,omitempty"` // Encrypted crdt.ReplicaState
+	Key       string          `json:"key,omitempty"`    // Fingerprint of the vault key it is encrypted with
+	Epoch     uint32          `json:"epoch,omitempty"`  // Epoch of that key (see vcrypto.EpochKey)
+	Signature []byte          `json:"signature"`
+}
+
+// BundleOptions configure NewBundle
+type BundleOptions struct {
+	Since    uint64       // The state holds the changes after this time (0 = full state)
+	VaultKey *vcrypto.Key // Encrypts the state (nil = plaintext)
+	KeyEpoch uint32       // Epoch of VaultKey
+}
+
+// NewBundle creates a bundle of state signed with key
+func NewBundle(state crdt.ReplicaState, key crypto.PrivKey, opts BundleOptions) (*Bundle, error) {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := crypto.MarshalPublicKey(key.GetPublic())
+	if err != nil {
+		return nil, err
+	}
+	id, err := peer.IDFromPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Bundle{
+		Version:   bundleVersion,
+		Format:    DataFormat,
+		Peer:      id.String(),
+		PublicKey: pub,
+		Created:   time.Now().UTC().Truncate(time.Second),
+		Since:     opts.Since,
+		Clock:     state.ClockTime,
+		State:     data,
+	}
+	if opts.VaultKey != nil {
+		if b.Sealed, err = vcrypto.Encrypt(*opts.VaultKey, data, bundleAAD); err != nil {
+			return nil, fmt.Errorf("failed to encrypt bundle: %w", err)
+		}
+		b.State = nil
+		b.Key = opts.VaultKey.Fingerprint()
+		b.Epoch = opts.KeyEpoch
+	}
+	if b.Signature, err = key.Sign(b.signedBytes()); err != nil {
+		return nil, fmt.Errorf("failed to sign bundle: %w", err)
+	}
+	return b, nil
+}
+
+// signedBytes is what the signature covers: every field but the public
+// key, which must match Peer
+func (b *Bundle) signedBytes() []byte {
+	stateHash := sha256.Sum256(b.State)
+	sealedHash := sha256.Sum256(b.Sealed)
+	buf := []byte("acorde bundle\n")
+	buf = binary.BigEndian.AppendUint32(buf, uint32(b.Version))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(b.Format))
+	buf = append(buf, b.Peer...)
+	buf = append(buf, 0)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(b.Created.Unix()))
+	buf = binary.BigEndian.AppendUint64(buf, b.Since)
+	buf = binary.BigEndian.AppendUint64(buf, b.Clock)
+	buf = append(buf, stateHash[:]...)
+	buf = append(buf, sealedHash[:]...)
+	buf = append(buf, b.Key...)
+	if b.Epoch != 0 { // Bundles from before key epochs have none
+		buf = binary.BigEndian.AppendUint32(append(buf, 0), b.Epoch)
+	}
+	return buf
+}
+
+// Verify checks that the bundle was created by the peer it names and has
+// not been altered since
+func (b *Bundle) Verify() error {
+	if b.Version != bundleVersion {
+		return fmt.Errorf("unsupported bundle version %d", b.Version)
+	}
+	pub, err := crypto.UnmarshalPublicKey(b.PublicKey)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBundleSignature, err)
+	}
+	id, err := peer.IDFromPublicKey(pub)
+	if err != nil || id.String() != b.Peer {
+		return fmt.Errorf("%w: key does not belong to %s", ErrBundleSignature, b.Peer)
+	}
+	if ok, err := pub.Verify(b.signedBytes(), b.Signature); err != nil || !ok {
+		return ErrBundleSignature
+	}
+	return nil
+}
+
+// Encrypted reports whether the state is encrypted with a vault key
+func (b *Bundle) Encrypted() bool {
+	return b.Sealed != nil
+}
+
+// ReplicaState decrypts (with vaultKey, if the bundle is encrypted) and
+// decodes the bundle's state. Bundles in a data format this build does not
+// understand are refused.
+func (b *Bundle) ReplicaState(vaultKey *vcrypto.Key) (crdt.ReplicaState, error) {
+	var state crdt.ReplicaState
+	if b.Format > DataFormat || b.Format < MinDataFormat {
+		return state, fmt.Errorf("%w: bundle uses format %d, we support %d-%d",
+			ErrIncompatibleVersion, b.Format, MinDataFormat, DataFormat)
+	}
+
+	data := []byte(b.State)
+	if b.Encrypted() {
+		if vaultKey == nil || vaultKey.Fingerprint() != b.Key {
+			return state, fmt.Errorf("%w (key epoch %d)", ErrBundleKey, b.Epoch)
+		}
+		var err error
+		if data, err = vcrypto.Decrypt(*vaultKey, b.Sealed, bundleAAD); err != nil {
+			return state, fmt.Errorf("failed to decrypt bundle: %w", err)
+		}
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("failed to decode bundle state: %w", err)
+	}
+	return state, nil
+}
+
+// BundleOpener checks who signed bundles and decrypts them
+type BundleOpener struct {
+	Trusted  func(peer.ID) bool // Signers to accept (nil = any)
+	VaultKey *vcrypto.Key       // For encrypted bundles
+
+	// RetiredKeys open bundles encrypted with the vault key of an earlier
+	// epoch, before a key rotation
+	RetiredKeys []vcrypto.EpochKey
+}
+
+// Open verifies a bundle and returns its state, if its signer is trusted
+func (o BundleOpener) Open(b *Bundle) (crdt.ReplicaState, error) {
+	if err := b.Verify(); err != nil {
+		return crdt.ReplicaState{}, err
+	}
+	id, err := peer.Decode(b.Peer)
+	if err != nil {
+		return crdt.ReplicaState{}, fmt.Errorf("%w: %v", ErrBundleSignature, err)
+	}
+	if o.Trusted != nil && !o.Trusted(id) {
+		return crdt.ReplicaState{}, fmt.Errorf("%w: %s", ErrUntrustedBundle, b.Peer)
+	}
+	return b.ReplicaState(o.KeyFor(b))
+}
+
+// KeyFor returns the vault key an encrypted bundle names: the current
+// one, or the retired key of its epoch
+func (o BundleOpener) KeyFor(b *Bundle) *vcrypto.Key {
+	if !b.Encrypted() || (o.VaultKey != nil && o.VaultKey.Fingerprint() == b.Key) {
+		return o.VaultKey
+	}
+	if key, err := vcrypto.KeyForEpoch(o.RetiredKeys, b.Epoch); err == nil {
+		return &key
+	}
+	return o.VaultKey
+}
+
+// WriteBundle writes b to path, atomically
+func WriteBundle(path string, b *Bundle) error {
+	data, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// ReadBundle reads the bundle at path and verifies its signature
+func ReadBundle(path string) (*Bundle, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var b Bundle
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("%s: not a sync bundle: %w", path, err)
+	}
+	if err := b.Verify(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &b, nil
+}
+
+// OfflineTransport carries replica state between devices that are not
+// online at the same time, as bundles: files on a USB stick, or a
+// Bluetooth LE link between a phone and a laptop. There is no session as
+// with SyncService; each side sends what it has and merges what it finds.
+type OfflineTransport interface {
+	// Sent returns the clock time of the newest state this device sent,
+	// so the next bundle only carries later changes (0 = none sent)
+	Sent() (uint64, error)
+
+	// Send delivers a bundle
+	Send(b *Bundle) error
+
+	// Receive returns the verified bundles other devices delivered
+	Receive() ([]*Bundle, error)
+}
+
+// DeltaSyncable is a Syncable that can also export only recent changes
+type DeltaSyncable interface {
+	Syncable
+
+	// GetSyncDelta returns the CRDT changes after since
+	GetSyncDelta(since uint64) crdt.ReplicaState
+}
+
+// SendBundle sends a bundle of the changes t has not carried yet, or of
+// the full state if full is set, encrypted with vaultKey if not nil
+func SendBundle(t OfflineTransport, source DeltaSyncable, key crypto.PrivKey, vaultKey *vcrypto.EpochKey, full bool) (*Bundle, error) {
+	var opts BundleOptions
+	if vaultKey != nil {
+		opts.VaultKey, opts.KeyEpoch = &vaultKey.Key, vaultKey.Epoch
+	}
+	if !full {
+		var err error
+		if opts.Since, err = t.Sent(); err != nil {
+			return nil, err
+		}
+	}
+	b, err := NewBundle(source.GetSyncDelta(opts.Since), key, opts)
+	if err != nil {
+		return nil, err
+	}
+	return b, t.Send(b)
+}
+
+// ReceiveBundles merges every bundle t received into target, oldest
+// first, and returns them. Every bundle must open, or none is merged.
+func ReceiveBundles(t OfflineTransport, target Syncable, opener BundleOpener) ([]*Bundle, error) {
+	bundles, err := t.Receive()
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(bundles, func(i, j int) bool {
+		return bundles[i].Created.Before(bundles[j].Created)
+	})
+	states := make([]crdt.ReplicaState, len(bundles))
+	for i, b := range bundles {
+		var err error
+		if states[i], err = opener.Open(b); err != nil {
+			return nil, err
+		}
+	}
+	for i, b := range bundles {
+		if err := MergeBundleState(target, b, states[i]); err != nil {
+			return nil, fmt.Errorf("failed to merge bundle from %s: %w", b.Peer, err)
+		}
+	}
+	return bundles, nil
+}
+
+// MergeBundleState merges the state of an opened bundle into target, as
+// sent by the peer that signed it
+func MergeBundleState(target Syncable, b *Bundle, state crdt.ReplicaState) error {
+	if reporter, ok := target.(PeerMergeReporter); ok {
+		_, err := reporter.MergeSyncStateFrom(b.Peer, state)
+		return err
+	}
+	return target.ApplySyncState(state)
+}
+
+// DirTransport is an OfflineTransport over a directory: a USB stick moved
+// between devices, or a folder they take turns to reach. Each device
+// leaves its bundles there, named after its peer ID, and reads those of
+// the others. Old bundles may be deleted once every device merged them.
+type DirTransport struct {
+	dir  string
+	self peer.ID
+}
+
+// NewDirTransport creates a transport over dir for the device self
+func NewDirTransport(dir string, self peer.ID) *DirTransport {
+	return &DirTransport{dir: dir, self: self}
+}
+
+// Sent returns the clock time of the newest bundle self left in the
+// directory
+func (t *DirTransport) Sent() (uint64, error) {
+	paths, err := t.bundlePaths()
+	if err != nil {
+		return 0, err
+	}
+	var sent uint64
+	for _, path := range paths {
+		if !t.own(path) {
+			continue
+		}
+		b, err := ReadBundle(path)
+		if err != nil {
+			return 0, err
+		}
+		if b.Peer == t.self.String() && b.Clock > sent {
+			sent = b.Clock
+		}
+	}
+	return sent, nil
+}
+
+// Send writes b to the directory as <peer>-<unix nanoseconds>.acorde
+func (t *DirTransport) Send(b *Bundle) error {
+	if err := os.MkdirAll(t.dir, 0700); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%d%s", b.Peer, time.Now().UnixNano(), BundleExt)
+	return WriteBundle(filepath.Join(t.dir, name), b)
+}
+
+// Receive reads and verifies the bundles other devices left in the
+// directory. A bundle that does not verify fails the whole receive.
+func (t *DirTransport) Receive() ([]*Bundle, error) {
+	paths, err := t.bundlePaths()
+	if err != nil {
+		return nil, err
+	}
+	var bundles []*Bundle
+	for _, path := range paths {
+		if t.own(path) {
+			continue
+		}
+		b, err := ReadBundle(path)
+		if err != nil {
+			return nil, err
+		}
+		if b.Peer != t.self.String() {
+			bundles = append(bundles, b)
+		}
+	}
+	return bundles, nil
+}
+
+// Path returns the directory
+func (t *DirTransport) Path() string {
+	return t.dir
+}
+
+// bundlePaths lists the bundle files in the directory (none if it does
+// not exist yet)
+func (t *DirTransport) bundlePaths() ([]string, error) {
+	entries, err := os.ReadDir(t.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), BundleExt) {
+			paths = append(paths, filepath.Join(t.dir, entry.Name()))
+		}
+	}
+	return paths, nil
+}
+
+// own reports whether a bundle file is named as one of self's
+func (t *DirTransport) own(path string) bool {
+	return strings.HasPrefix(filepath.Base(path), t.self.String()+"-")
+}
@@ -0,0 +1,234 @@
+package sync
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/amaydixit11/acorde/internal/core"
+	"github.com/amaydixit11/acorde/internal/crdt"
+	vcrypto "github.com/amaydixit11/acorde/pkg/crypto"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// bundleTestEngine implements DeltaSyncable over a replica
+type bundleTestEngine struct {
+	replica *crdt.Replica
+}
+
+func (e *bundleTestEngine) GetSyncState() crdt.ReplicaState {
+	return e.replica.State()
+}
+
+func (e *bundleTestEngine) GetSyncDelta(since uint64) crdt.ReplicaState {
+	delta := e.replica.DeltaState(since)
+	return crdt.ReplicaState{Entries: delta.Entries, Tags: delta.Tags, ACLs: delta.ACLs, Acks: delta.Acks, ClockTime: delta.ClockTime}
+}
+
+func (e *bundleTestEngine) ApplySyncState(state crdt.ReplicaState) error {
+	temp := crdt.NewReplica(core.NewClockWithTime(state.ClockTime))
+	temp.LoadState(state)
+	e.replica.Merge(temp)
+	return nil
+}
+
+func newBundleDevice(t *testing.T) (*bundleTestEngine, crypto.PrivKey, peer.ID) {
+	key, _, err := crypto.GenerateEd25519Key(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := peer.IDFromPrivateKey(key)
+	return &bundleTestEngine{replica: crdt.NewReplica(core.NewClock())}, key, id
+}
+
+func TestBundleSignature(t *testing.T) {
+	device, key, id := newBundleDevice(t)
+	device.replica.AddEntry(core.Note, []byte("hello"), []string{"a"})
+
+	b, err := NewBundle(device.GetSyncState(), key, BundleOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Peer != id.String() {
+		t.Errorf("expected bundle from %s, got %s", id, b.Peer)
+	}
+	path := filepath.Join(t.TempDir(), "b"+BundleExt)
+	if err := WriteBundle(path, b); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadBundle(path)
+	if err != nil {
+		t.Fatalf("ReadBundle failed: %v", err)
+	}
+	if state, err := read.ReplicaState(nil); err != nil || len(state.Entries) != 1 {
+		t.Errorf("expected 1 entry, got %+v (%v)", state, err)
+	}
+
+	// Altered state, or a bundle claiming to be from another peer
+	tampered := *b
+	tampered.State = json.RawMessage(`{"entries":[]}`)
+	if err := tampered.Verify(); !errors.Is(err, ErrBundleSignature) {
+		t.Errorf("expected ErrBundleSignature for altered state, got %v", err)
+	}
+	_, _, other := newBundleDevice(t)
+	tampered = *b
+	tampered.Peer = other.String()
+	if err := tampered.Verify(); !errors.Is(err, ErrBundleSignature) {
+		t.Errorf("expected ErrBundleSignature for another peer, got %v", err)
+	}
+
+	// Open verifies too, whoever is trusted
+	tampered = *b
+	tampered.State = json.RawMessage(`{"entries":[]}`)
+	opener := BundleOpener{Trusted: func(peer.ID) bool { return true }}
+	if _, err := opener.Open(&tampered); !errors.Is(err, ErrBundleSignature) {
+		t.Errorf("expected Open to refuse the altered bundle, got %v", err)
+	}
+	if state, err := opener.Open(b); err != nil || len(state.Entries) != 1 {
+		t.Errorf("expected Open to return 1 entry, got %+v (%v)", state, err)
+	}
+
+	newer := *b
+	newer.Format = DataFormat + 1
+	if _, err := newer.ReplicaState(nil); !errors.Is(err, ErrIncompatibleVersion) {
+		t.Errorf("expected ErrIncompatibleVersion, got %v", err)
+	}
+}
+
+func TestEncryptedBundle(t *testing.T) {
+	device, key, id := newBundleDevice(t)
+	device.replica.AddEntry(core.Note, []byte("secret"), []string{"private"})
+	vaultKey, _ := vcrypto.GenerateKey()
+
+	b, err := NewBundle(device.GetSyncState(), key, BundleOptions{VaultKey: &vaultKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !b.Encrypted() || b.State != nil || b.Key != vaultKey.Fingerprint() {
+		t.Fatalf("expected only encrypted state, got %+v", b)
+	}
+	if err := b.Verify(); err != nil {
+		t.Errorf("encrypted bundle should verify without the vault key: %v", err)
+	}
+
+	opener := BundleOpener{VaultKey: &vaultKey, Trusted: func(p peer.ID) bool { return p == id }}
+	if state, err := opener.Open(b); err != nil || len(state.Entries) != 1 {
+		t.Errorf("expected 1 entry, got %+v (%v)", state, err)
+	}
+	other, _ := vcrypto.GenerateKey()
+	if _, err := (BundleOpener{VaultKey: &other}).Open(b); !errors.Is(err, ErrBundleKey) {
+		t.Errorf("expected ErrBundleKey for another vault key, got %v", err)
+	}
+	if _, err := (BundleOpener{}).Open(b); !errors.Is(err, ErrBundleKey) {
+		t.Errorf("expected ErrBundleKey without a vault key, got %v", err)
+	}
+	untrusted := BundleOpener{VaultKey: &vaultKey, Trusted: func(peer.ID) bool { return false }}
+	if _, err := untrusted.Open(b); !errors.Is(err, ErrUntrustedBundle) {
+		t.Errorf("expected ErrUntrustedBundle, got %v", err)
+	}
+
+	// The key fingerprint is signed too
+	tampered := *b
+	tampered.Key = other.Fingerprint()
+	if err := tampered.Verify(); !errors.Is(err, ErrBundleSignature) {
+		t.Errorf("expected ErrBundleSignature, got %v", err)
+	}
+}
+
+func TestBundleKeyEpochs(t *testing.T) {
+	device, key, _ := newBundleDevice(t)
+	device.replica.AddEntry(core.Note, []byte("secret"), nil)
+	oldKey, _ := vcrypto.GenerateKey()
+	newKey, _ := vcrypto.GenerateKey()
+
+	old, err := NewBundle(device.GetSyncState(), key, BundleOptions{VaultKey: &oldKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewBundle(device.GetSyncState(), key, BundleOptions{VaultKey: &newKey, KeyEpoch: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if old.Epoch != 0 || b.Epoch != 1 {
+		t.Fatalf("expected epochs 0 and 1, got %d and %d", old.Epoch, b.Epoch)
+	}
+
+	// After the rotation, bundles of either epoch open
+	opener := BundleOpener{VaultKey: &newKey, RetiredKeys: []vcrypto.EpochKey{{Epoch: 0, Key: oldKey}}}
+	for _, bundle := range []*Bundle{old, b} {
+		if state, err := opener.Open(bundle); err != nil || len(state.Entries) != 1 {
+			t.Errorf("epoch %d: expected 1 entry, got %+v (%v)", bundle.Epoch, state, err)
+		}
+	}
+	if _, err := (BundleOpener{VaultKey: &newKey}).Open(old); !errors.Is(err, ErrBundleKey) {
+		t.Errorf("expected ErrBundleKey without the retired key, got %v", err)
+	}
+
+	// The epoch is signed too
+	tampered := *b
+	tampered.Epoch = 0
+	if err := tampered.Verify(); !errors.Is(err, ErrBundleSignature) {
+		t.Errorf("expected ErrBundleSignature, got %v", err)
+	}
+}
+
+func TestDirTransport(t *testing.T) {
+	dir := t.TempDir()
+	laptop, laptopKey, laptopID := newBundleDevice(t)
+	phone, phoneKey, phoneID := newBundleDevice(t)
+	toLaptop, toPhone := NewDirTransport(dir, laptopID), NewDirTransport(dir, phoneID)
+
+	laptop.replica.AddEntry(core.Note, []byte("one"), nil)
+	b, err := SendBundle(toLaptop, laptop, laptopKey, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Since != 0 {
+		t.Errorf("first bundle should hold the full state, has changes since %d", b.Since)
+	}
+
+	// The laptop does not merge its own bundles
+	if got, _ := ReceiveBundles(toLaptop, laptop, BundleOpener{}); len(got) != 0 {
+		t.Errorf("laptop received %d of its own bundles", len(got))
+	}
+
+	phone.replica.AddEntry(core.Note, []byte("two"), nil)
+	if _, err := SendBundle(toPhone, phone, phoneKey, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ReceiveBundles(toPhone, phone, BundleOpener{}); err != nil || len(got) != 1 {
+		t.Fatalf("expected the laptop's bundle, got %d (%v)", len(got), err)
+	}
+	if got, err := ReceiveBundles(toLaptop, laptop, BundleOpener{}); err != nil || len(got) != 1 {
+		t.Fatalf("expected the phone's bundle, got %d (%v)", len(got), err)
+	}
+	if len(laptop.replica.ListEntries()) != 2 || len(phone.replica.ListEntries()) != 2 {
+		t.Errorf("devices did not converge: %d and %d entries",
+			len(laptop.replica.ListEntries()), len(phone.replica.ListEntries()))
+	}
+
+	// Later bundles only carry new changes
+	laptop.replica.AddEntry(core.Note, []byte("three"), nil)
+	b, err = SendBundle(toLaptop, laptop, laptopKey, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state, _ := b.ReplicaState(nil); b.Since == 0 || len(state.Entries) != 1 {
+		t.Errorf("expected a delta of 1 entry, got %d since %d", len(state.Entries), b.Since)
+	}
+	if b, _ = SendBundle(toLaptop, laptop, laptopKey, nil, true); b.Since != 0 {
+		t.Errorf("full bundle has changes since %d", b.Since)
+	}
+
+	// A forged bundle stops the receive
+	forged := *b
+	forged.State = json.RawMessage(`{"entries":[]}`)
+	data, _ := json.Marshal(forged)
+	os.WriteFile(filepath.Join(dir, laptopID.String()+"-1"+BundleExt), data, 0600)
+	if _, err := ReceiveBundles(toPhone, phone, BundleOpener{}); !errors.Is(err, ErrBundleSignature) {
+		t.Errorf("expected ErrBundleSignature, got %v", err)
+	}
+}
@@ -0,0 +1,214 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"github.com/amaydixit11/acorde/internal/crdt"
+)
+
+// ChaosConfig injects network faults into sync traffic so that retries,
+// the session tie-breaker and CRDT merges can be tested under message
+// loss, latency, duplication and reordering. Never enable it in production.
+type ChaosConfig struct {
+	// DropRate is the probability that an outgoing sync message is lost.
+	// The stream is reset, so the peer sees a failed sync.
+	DropRate float64
+
+	// DuplicateRate is the probability that a received state is applied
+	// twice
+	DuplicateRate float64
+
+	// ReorderRate is the probability that a received state is held back
+	// and applied after the next one
+	ReorderRate float64
+
+	// MinDelay and MaxDelay bound the random latency added before each
+	// outgoing sync message
+	MinDelay time.Duration
+	MaxDelay time.Duration
+
+	// Seed makes fault decisions reproducible
+	// Default: 0 (seeded from the clock)
+	Seed int64
+}
+
+// ChaosStats counts injected faults
+type ChaosStats struct {
+	Dropped    int64
+	Delayed    int64
+	Duplicated int64
+	Reordered  int64
+}
+
+// errChaosDropped is returned when chaos drops an outgoing message
+var errChaosDropped = errors.New("message dropped by chaos injection")
+
+// ParseChaosConfig parses a comma-separated fault spec such as
+// "drop=0.1,dup=0.05,reorder=0.2,delay=10ms-200ms,seed=42". A single
+// delay value is a fixed latency.
+func ParseChaosConfig(spec string) (*ChaosConfig, error) {
+	cfg := &ChaosConfig{}
+	for _, field := range strings.Split(spec, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid chaos option %q", field)
+		}
+
+		var err error
+		switch key {
+		case "drop":
+			cfg.DropRate, err = parseRate(value)
+		case "dup":
+			cfg.DuplicateRate, err = parseRate(value)
+		case "reorder":
+			cfg.ReorderRate, err = parseRate(value)
+		case "delay":
+			min, max, _ := strings.Cut(value, "-")
+			if max == "" {
+				max = min
+			}
+			if cfg.MinDelay, err = time.ParseDuration(min); err == nil {
+				cfg.MaxDelay, err = time.ParseDuration(max)
+			}
+			if err == nil && cfg.MaxDelay < cfg.MinDelay {
+				err = fmt.Errorf("max delay below min delay")
+			}
+		case "seed":
+			cfg.Seed, err = strconv.ParseInt(value, 10, 64)
+		default:
+			return nil, fmt.Errorf("unknown chaos option %q", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid chaos option %q: %w", field, err)
+		}
+	}
+	return cfg, nil
+}
+
+// parseRate parses a probability between 0 and 1
+func parseRate(value string) (float64, error) {
+	rate, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+	if rate < 0 || rate > 1 {
+		return 0, fmt.Errorf("rate must be between 0 and 1")
+	}
+	return rate, nil
+}
+
+// chaos wraps the sync transport with fault injection. A nil *chaos
+// passes everything through unchanged.
+type chaos struct {
+	cfg ChaosConfig
+
+	mu    gosync.Mutex
+	rng   *rand.Rand
+	held  *crdt.ReplicaState // State waiting to be delivered out of order
+	stats ChaosStats
+}
+
+// newChaos returns nil when cfg is nil, disabling fault injection
+func newChaos(cfg *ChaosConfig) *chaos {
+	if cfg == nil {
+		return nil
+	}
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &chaos{cfg: *cfg, rng: rand.New(rand.NewSource(seed))}
+}
+
+// roll reports whether an event with the given probability happens
+func (c *chaos) roll(rate float64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return rate > 0 && c.rng.Float64() < rate
+}
+
+// delay picks a latency between MinDelay and MaxDelay
+func (c *chaos) delay() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	d := c.cfg.MinDelay
+	if spread := c.cfg.MaxDelay - c.cfg.MinDelay; spread > 0 {
+		d += time.Duration(c.rng.Int63n(int64(spread)))
+	}
+	if d > 0 {
+		c.stats.Delayed++
+	}
+	return d
+}
+
+// send writes msg to the stream after a random delay, or resets the
+// stream to simulate a lost message
+func (c *chaos) send(stream Stream, msg *Message) error {
+	if c == nil {
+		return writeMessage(stream, msg)
+	}
+	time.Sleep(c.delay())
+	if c.roll(c.cfg.DropRate) {
+		c.mu.Lock()
+		c.stats.Dropped++
+		c.mu.Unlock()
+		stream.Reset()
+		return errChaosDropped
+	}
+	return writeMessage(stream, msg)
+}
+
+// apply delivers a received state, possibly twice, and possibly holding
+// it back until the next state arrives (which is then delivered first)
+func (c *chaos) apply(state crdt.ReplicaState, apply func(crdt.ReplicaState) error) error {
+	if c == nil {
+		return apply(state)
+	}
+
+	c.mu.Lock()
+	held := c.held
+	if held == nil && c.cfg.ReorderRate > 0 && c.rng.Float64() < c.cfg.ReorderRate {
+		c.held = &state
+		c.stats.Reordered++
+		c.mu.Unlock()
+		return nil
+	}
+	c.held = nil
+	c.mu.Unlock()
+
+	if err := apply(state); err != nil {
+		return err
+	}
+	if c.roll(c.cfg.DuplicateRate) {
+		c.mu.Lock()
+		c.stats.Duplicated++
+		c.mu.Unlock()
+		if err := apply(state); err != nil {
+			return err
+		}
+	}
+	if held != nil {
+		return apply(*held)
+	}
+	return nil
+}
+
+// snapshot returns the fault counters
+func (c *chaos) snapshot() ChaosStats {
+	if c == nil {
+		return ChaosStats{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
@@ -0,0 +1,186 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	gosync "sync"
+	"testing"
+	"time"
+
+	"github.com/amaydixit11/acorde/internal/core"
+	"github.com/amaydixit11/acorde/internal/crdt"
+)
+
+// lockedProvider serializes access to a mock provider, since chaos
+// delivers states from concurrent streams
+type lockedProvider struct {
+	mu gosync.Mutex
+	*mockStateProvider
+}
+
+func (p *lockedProvider) GetState() crdt.ReplicaState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.mockStateProvider.GetState()
+}
+
+func (p *lockedProvider) ApplyState(state crdt.ReplicaState) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.mockStateProvider.ApplyState(state)
+}
+
+func (p *lockedProvider) StateHash() []byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.mockStateProvider.StateHash()
+}
+
+func (p *lockedProvider) add(content string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.replica.AddEntry(core.Note, []byte(content), nil)
+}
+
+func TestParseChaosConfig(t *testing.T) {
+	cfg, err := ParseChaosConfig("drop=0.1, dup=0.05,reorder=0.2,delay=10ms-200ms,seed=42")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	want := ChaosConfig{
+		DropRate:      0.1,
+		DuplicateRate: 0.05,
+		ReorderRate:   0.2,
+		MinDelay:      10 * time.Millisecond,
+		MaxDelay:      200 * time.Millisecond,
+		Seed:          42,
+	}
+	if *cfg != want {
+		t.Errorf("expected %+v, got %+v", want, *cfg)
+	}
+
+	cfg, err = ParseChaosConfig("delay=50ms")
+	if err != nil || cfg.MinDelay != 50*time.Millisecond || cfg.MaxDelay != 50*time.Millisecond {
+		t.Errorf("expected fixed 50ms delay, got %+v (%v)", cfg, err)
+	}
+
+	for _, spec := range []string{"drop=2", "drop", "loss=0.1", "delay=1s-10ms", "seed=x"} {
+		if _, err := ParseChaosConfig(spec); err == nil {
+			t.Errorf("expected error for %q", spec)
+		}
+	}
+}
+
+func TestChaosApplyReorderAndDuplicate(t *testing.T) {
+	c := newChaos(&ChaosConfig{ReorderRate: 1, DuplicateRate: 1, Seed: 1})
+
+	var got []uint64
+	apply := func(state crdt.ReplicaState) error {
+		got = append(got, state.ClockTime)
+		return nil
+	}
+
+	// The first state is held back, then delivered after the second
+	c.apply(crdt.ReplicaState{ClockTime: 1}, apply)
+	if len(got) != 0 {
+		t.Fatalf("expected first state to be held, got %v", got)
+	}
+	c.apply(crdt.ReplicaState{ClockTime: 2}, apply)
+	if fmt.Sprint(got) != "[2 2 1]" {
+		t.Errorf("expected [2 2 1], got %v", got)
+	}
+
+	stats := c.snapshot()
+	if stats.Reordered != 1 || stats.Duplicated != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	// A nil chaos delivers states unchanged
+	got = nil
+	var none *chaos
+	none.apply(crdt.ReplicaState{ClockTime: 3}, apply)
+	if fmt.Sprint(got) != "[3]" {
+		t.Errorf("expected [3], got %v", got)
+	}
+}
+
+// TestP2PSyncUnderChaos has two peers edit concurrently and sync with each
+// other at the same time over a lossy, slow, duplicating and reordering
+// transport, and checks that they still converge.
+func TestP2PSyncUnderChaos(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping chaos sync in short mode")
+	}
+
+	providers := []*lockedProvider{
+		{mockStateProvider: newMockProvider()},
+		{mockStateProvider: newMockProvider()},
+	}
+	var services []*p2pService
+	for i, provider := range providers {
+		cfg := DefaultConfig()
+		cfg.EnableMDNS = false
+		cfg.ListenAddrs = []string{"/ip4/127.0.0.1/tcp/0"}
+		cfg.Chaos = &ChaosConfig{
+			DropRate:      0.3,
+			DuplicateRate: 0.3,
+			ReorderRate:   0.3,
+			MaxDelay:      20 * time.Millisecond,
+			Seed:          int64(i + 1),
+		}
+		svc, err := NewP2PService(provider, cfg)
+		if err != nil {
+			t.Fatalf("failed to create service: %v", err)
+		}
+		services = append(services, svc.(*p2pService))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	for _, svc := range services {
+		if err := svc.Start(ctx); err != nil {
+			t.Fatalf("failed to start: %v", err)
+		}
+		defer svc.Stop()
+	}
+	if err := services[1].host.Connect(ctx, services[0].host.Peerstore().PeerInfo(services[0].host.ID())); err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+
+	for round := 0; ; round++ {
+		if round < 10 {
+			providers[0].add(fmt.Sprintf("a%d", round))
+			providers[1].add(fmt.Sprintf("b%d", round))
+		} else if bytes.Equal(providers[0].StateHash(), providers[1].StateHash()) {
+			break
+		}
+		if ctx.Err() != nil {
+			t.Fatalf("peers did not converge after %d rounds", round)
+		}
+
+		// Both sides initiate at once; failures are expected and retried
+		var wg gosync.WaitGroup
+		for i, svc := range services {
+			wg.Add(1)
+			go func(svc *p2pService, other *p2pService) {
+				defer wg.Done()
+				svc.SyncWith(ctx, other.host.ID())
+			}(svc, services[1-i])
+		}
+		wg.Wait()
+	}
+
+	if n := len(providers[0].replica.ListEntries()); n != 20 {
+		t.Errorf("expected 20 entries, got %d", n)
+	}
+	var faults ChaosStats
+	for _, svc := range services {
+		m := svc.Metrics()
+		faults.Dropped += m.Chaos.Dropped
+		faults.Reordered += m.Chaos.Reordered
+	}
+	if faults.Dropped == 0 || faults.Reordered == 0 {
+		t.Errorf("expected injected faults, got %+v", faults)
+	}
+}
@@ -3,5 +3,17 @@ package sync
 // ProtocolID is the libp2p protocol identifier for acorde sync
 const ProtocolID = "/acorde/sync/1.0.0"
 
+// PairProtocolID is the libp2p protocol identifier for redeeming invites
+const PairProtocolID = "/acorde/pair/1.0.0"
+
+// RekeyProtocolID is the libp2p protocol identifier for key grants
+const RekeyProtocolID = "/acorde/rekey/1.0.0"
+
+// BlobProtocolID is the libp2p protocol identifier for blob transfer
+const BlobProtocolID = "/acorde/blob/1.0.0"
+
+// PEXProtocolID is the libp2p protocol identifier for peer exchange
+const PEXProtocolID = "/acorde/pex/1.0.0"
+
 // ServiceName is the service name for mDNS discovery
 const ServiceName = "acorde"
@@ -0,0 +1,244 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SyncEngine runs the sync protocol over streams of any Transport: it
+// exchanges state hashes, negotiates a data format and sends or merges
+// states. Deciding which peers to sync with, and when, is left to the
+// service driving it.
+type SyncEngine struct {
+	provider StateProvider
+	config   Config
+	logger   Logger
+	chaos    *chaos      // Fault injection (nil = disabled)
+	sessions *sessionLog // nil unless Config.SessionLog is set
+	tracer   trace.Tracer
+	merges   mergeMetrics
+
+	syncAttempts    int64
+	syncSuccesses   int64
+	syncFailures    int64
+	versionRefusals int64
+	downgrades      int64
+}
+
+// NewSyncEngine returns a sync engine for the state of provider. Of cfg
+// it uses Namespaces, StateBudget, SlowMerge, SessionLog, Chaos, Logger
+// and TracerProvider.
+func NewSyncEngine(provider StateProvider, cfg Config) *SyncEngine {
+	if cfg.Namespaces != nil {
+		provider = namespaceProvider{provider, cfg.Namespaces}
+	}
+	if cfg.SlowMerge == 0 {
+		cfg.SlowMerge = DefaultSlowMerge
+	}
+	if cfg.StateBudget <= 0 {
+		cfg.StateBudget = DefaultStateBudget
+	}
+	if cfg.StateBudget > MaxStateBudget {
+		cfg.StateBudget = MaxStateBudget
+	}
+	logger := cfg.Logger
+	if logger == nil {
+		logger = noopLogger{}
+	}
+	return &SyncEngine{
+		provider: provider,
+		config:   cfg,
+		logger:   logger,
+		chaos:    newChaos(cfg.Chaos),
+		sessions: newSessionLog(cfg, logger),
+		tracer:   newTracer(cfg.TracerProvider),
+	}
+}
+
+// Metrics returns the engine's counters; the service adds its own
+func (e *SyncEngine) Metrics() SyncMetrics {
+	return SyncMetrics{
+		SyncAttempts:    atomic.LoadInt64(&e.syncAttempts),
+		SyncSuccesses:   atomic.LoadInt64(&e.syncSuccesses),
+		SyncFailures:    atomic.LoadInt64(&e.syncFailures),
+		VersionRefusals: atomic.LoadInt64(&e.versionRefusals),
+		Downgrades:      atomic.LoadInt64(&e.downgrades),
+		Merges:          e.merges.snapshot(),
+		Chaos:           e.chaos.snapshot(),
+	}
+}
+
+// Sessions returns the recorded sync sessions, oldest first, or nil
+// unless Config.SessionLog is set
+func (e *SyncEngine) Sessions() []Session {
+	return e.sessions.list()
+}
+
+// SyncWith runs a sync session with a peer over a stream dialed on t
+func (e *SyncEngine) SyncWith(ctx context.Context, t Transport, peerID peer.ID) (err error) {
+	atomic.AddInt64(&e.syncAttempts, 1)
+	defer func() {
+		if err != nil {
+			atomic.AddInt64(&e.syncFailures, 1)
+		} else {
+			atomic.AddInt64(&e.syncSuccesses, 1)
+		}
+	}()
+
+	sessionID := GenerateSessionID()
+	ctx, span := e.tracer.Start(ctx, "acorde.sync.Session",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(sessionAttributes(sessionID, peerID, true)...))
+	defer func() { endSpan(span, err) }()
+
+	rec := e.sessions.start(sessionID, peerID, true, e.provider.StateHash)
+	defer func() { rec.finish(err, e.provider.StateHash) }()
+
+	e.emit(Event{Type: EventSyncStarted, Peer: peerID, SessionID: sessionID, Outgoing: true})
+	changed := 0
+	defer func() { e.sessionEnded(sessionID, peerID, true, changed, err) }()
+
+	// Open stream to peer
+	stream, err := t.Dial(ctx, peerID, ProtocolID)
+	if err != nil {
+		return fmt.Errorf("failed to open stream: %w", err)
+	}
+	defer stream.Close()
+
+	// Set deadline
+	stream.SetDeadline(time.Now().Add(30 * time.Second))
+
+	// Send our state hash with session ID
+	msg := &Message{
+		Type:      MsgStateHash,
+		SessionID: sessionID,
+		StateHash: e.provider.StateHash(),
+	}
+	if err := e.send(stream, msg); err != nil {
+		return fmt.Errorf("failed to send state hash: %w", err)
+	}
+	rec.message(true, msg)
+
+	// Read response
+	resp, err := readMessage(stream)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	rec.message(false, resp)
+
+	// Agree on a data format before touching any state
+	if resp.Type == MsgRefuse {
+		atomic.AddInt64(&e.versionRefusals, 1)
+		return fmt.Errorf("%w: refused by peer: %s", ErrIncompatibleVersion, resp.Reason)
+	}
+	format, err := negotiateFormat(versionOf(resp))
+	if err != nil {
+		atomic.AddInt64(&e.versionRefusals, 1)
+		return err
+	}
+
+	// Handle response
+	switch resp.Type {
+	case MsgState, MsgStateChunk:
+		// Apply remote state, merging each chunk as it arrives
+		received, merged, err := e.receiveState(stream, resp, rec)
+		changed = merged
+		if err != nil {
+			return err
+		}
+		e.logger.Infof("synced with peer %s (received %d bytes)", peerID.String()[:8], received)
+
+	case MsgStateRequest:
+		// They want our state - send it
+		return e.sendState(stream, sessionID, format, resp, rec)
+	}
+
+	// MsgStateHash: hashes match, nothing to do
+	return nil
+}
+
+// Serve answers a sync session a peer opened on stream, and closes it.
+// The caller checks that the peer may sync.
+func (e *SyncEngine) Serve(ctx context.Context, stream Stream) {
+	defer stream.Close()
+
+	// Set deadline
+	stream.SetDeadline(time.Now().Add(30 * time.Second))
+	from := stream.RemotePeer()
+
+	// Read incoming message
+	msg, err := readMessage(stream)
+	if err != nil {
+		return
+	}
+	_, span := e.tracer.Start(ctx, "acorde.sync.Session",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(sessionAttributes(msg.SessionID, from, false)...))
+	defer func() { endSpan(span, err) }()
+
+	rec := e.sessions.start(msg.SessionID, from, false, e.provider.StateHash)
+	rec.message(false, msg)
+	defer func() { rec.finish(err, e.provider.StateHash) }()
+
+	e.emit(Event{Type: EventSyncStarted, Peer: from, SessionID: msg.SessionID})
+	changed := 0
+	defer func() { e.sessionEnded(msg.SessionID, from, false, changed, err) }()
+
+	// Refuse clearly rather than send a state the peer cannot read
+	format, err := negotiateFormat(versionOf(msg))
+	if err != nil {
+		atomic.AddInt64(&e.versionRefusals, 1)
+		e.logger.Errorf("refusing sync with %s: %v", from.String()[:8], err)
+		refuse := &Message{Type: MsgRefuse, SessionID: msg.SessionID, Reason: err.Error()}
+		e.send(stream, refuse)
+		rec.message(true, refuse)
+		return
+	}
+
+	var resp *Message
+
+	switch msg.Type {
+	case MsgStateHash:
+		// Compare hashes (of the state as the peer would see it)
+		ourHash := e.stateHash(format)
+		theirHash := msg.StateHash
+
+		if string(ourHash) == string(theirHash) {
+			// States identical - respond with our hash as acknowledgement
+			resp = &Message{
+				Type:      MsgStateHash,
+				SessionID: msg.SessionID,
+				StateHash: ourHash,
+			}
+		} else {
+			// Hashes differ - send our full state
+			// CRDT merge will combine both states correctly
+			err = e.sendState(stream, msg.SessionID, format, msg, rec)
+		}
+
+	case MsgStateRequest:
+		// Send full state
+		err = e.sendState(stream, msg.SessionID, format, msg, rec)
+
+	case MsgState, MsgStateChunk:
+		// Apply incoming state
+		_, changed, err = e.receiveState(stream, msg, rec)
+		resp = &Message{
+			Type:      MsgStateHash,
+			SessionID: msg.SessionID,
+			StateHash: e.stateHash(format),
+		}
+	}
+
+	if resp != nil {
+		if sendErr := e.send(stream, resp); sendErr != nil && err == nil {
+			err = sendErr
+		}
+		rec.message(true, resp)
+	}
+}
@@ -0,0 +1,78 @@
+package sync
+
+import (
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// EventType is the kind of a sync lifecycle Event
+type EventType string
+
+const (
+	// EventPeerConnected and EventPeerDisconnected report the first
+	// connection with a peer opening and the last one closing
+	EventPeerConnected    EventType = "peer_connected"
+	EventPeerDisconnected EventType = "peer_disconnected"
+
+	// EventSyncStarted reports a sync session with a peer starting, and
+	// EventSyncFinished or EventSyncFailed its end
+	EventSyncStarted  EventType = "sync_started"
+	EventSyncFinished EventType = "sync_finished"
+	EventSyncFailed   EventType = "sync_failed"
+)
+
+// Event reports a change in the connections or sync sessions of a
+// service, for apps to show sync progress (see Config.OnEvent)
+type Event struct {
+	Type      EventType
+	Peer      peer.ID
+	SessionID string // For session events
+	Outgoing  bool   // The session was started by this device
+	Changed   int    // Entries the session's merges changed, for EventSyncFinished
+	Err       error  // For EventSyncFailed
+	Time      time.Time
+}
+
+// emit passes an event to Config.OnEvent, if set
+func (e *SyncEngine) emit(event Event) {
+	if e.config.OnEvent == nil {
+		return
+	}
+	event.Time = time.Now()
+	e.config.OnEvent(event)
+}
+
+// sessionEnded emits the end of a session: finished, with the entries it
+// changed, or failed
+func (e *SyncEngine) sessionEnded(sessionID string, p peer.ID, outgoing bool, changed int, err error) {
+	event := Event{Peer: p, SessionID: sessionID, Outgoing: outgoing, Changed: changed}
+	if err != nil {
+		event.Type, event.Err = EventSyncFailed, err
+	} else {
+		event.Type = EventSyncFinished
+	}
+	e.emit(event)
+}
+
+// connectionChanged emits a peer connecting or disconnecting, once per
+// change however many connections the transport reports
+func (s *p2pService) connectionChanged(p peer.ID, connected bool) {
+	s.connectedMu.Lock()
+	was := s.connected[p]
+	if connected {
+		s.connected[p] = true
+	} else {
+		delete(s.connected, p)
+	}
+	s.connectedMu.Unlock()
+	if was == connected {
+		return
+	}
+
+	event := Event{Type: EventPeerConnected, Peer: p}
+	if !connected {
+		event.Type = EventPeerDisconnected
+	}
+	s.engine.emit(event)
+}
@@ -0,0 +1,130 @@
+package sync
+
+import (
+	"context"
+	gosync "sync"
+	"testing"
+	"time"
+
+	"github.com/amaydixit11/acorde/internal/core"
+	"github.com/amaydixit11/acorde/internal/crdt"
+)
+
+// countingMerger is a StateMerger counting the entries a merge adds as
+// changed
+type countingMerger struct {
+	*mockStateProvider
+}
+
+func (p countingMerger) MergeState(state crdt.ReplicaState) (crdt.MergeStats, error) {
+	before := len(p.replica.ListAllEntries())
+	stats, err := timeMerge(state, p.ApplyState)
+	stats.Changed = len(p.replica.ListAllEntries()) - before
+	return stats, err
+}
+
+// eventLog records the events of a service
+type eventLog struct {
+	mu     gosync.Mutex
+	events []Event
+}
+
+func (l *eventLog) record(event Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, event)
+}
+
+func (l *eventLog) types() []EventType {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	types := make([]EventType, len(l.events))
+	for i, event := range l.events {
+		types[i] = event.Type
+	}
+	return types
+}
+
+func TestSyncEvents(t *testing.T) {
+	network := NewMemoryNetwork()
+	provider1, provider2 := newMockProvider(), newMockProvider()
+	id1, id2 := newPeerID(t), newPeerID(t)
+	log1, log2 := &eventLog{}, &eventLog{}
+
+	cfg := DefaultConfig()
+	cfg.EnableMDNS = false
+	cfg.OnEvent = log1.record
+	svc1, err := NewService(countingMerger{provider1}, network.Transport(id1), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.OnEvent = log2.record
+	svc2, err := NewService(countingMerger{provider2}, network.Transport(id2), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, svc := range []SyncService{svc1, svc2} {
+		if err := svc.Start(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer svc2.Stop()
+
+	provider1.replica.AddEntry(core.Note, []byte("one"), nil)
+	provider1.replica.AddEntry(core.Note, []byte("two"), nil)
+	if err := svc2.SyncWith(ctx, id1); err != nil {
+		t.Fatal(err)
+	}
+
+	// The session starts before the dial connects
+	want := []EventType{EventSyncStarted, EventPeerConnected, EventSyncFinished}
+	if got := log2.types(); !equalTypes(got, want) {
+		t.Fatalf("expected %v on the dialing side, got %v", want, got)
+	}
+	log2.mu.Lock()
+	finished := log2.events[2]
+	log2.mu.Unlock()
+	if finished.Peer != id1 || !finished.Outgoing || finished.Changed != 2 || finished.SessionID == "" {
+		t.Errorf("expected an outgoing session with id1 changing 2 entries, got %+v", finished)
+	}
+
+	// The serving side ends its session after answering
+	want = []EventType{EventPeerConnected, EventSyncStarted, EventSyncFinished}
+	deadline := time.Now().Add(2 * time.Second)
+	for !equalTypes(log1.types(), want) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := log1.types(); !equalTypes(got, want) {
+		t.Fatalf("expected %v on the serving side, got %v", want, got)
+	}
+
+	svc1.Stop()
+	if got := log2.types(); got[len(got)-1] != EventPeerDisconnected {
+		t.Errorf("expected id1 to disconnect, got %v", got)
+	}
+
+	// A failed session is reported with its error
+	if err := svc2.SyncWith(ctx, id1); err == nil {
+		t.Fatal("expected the sync with a stopped peer to fail")
+	}
+	log2.mu.Lock()
+	defer log2.mu.Unlock()
+	if last := log2.events[len(log2.events)-1]; last.Type != EventSyncFailed || last.Err == nil {
+		t.Errorf("expected a failed session, got %+v", last)
+	}
+}
+
+func equalTypes(a, b []EventType) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
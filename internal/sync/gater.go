@@ -0,0 +1,106 @@
+package sync
+
+import (
+	gosync "sync"
+	"sync/atomic"
+
+	"github.com/libp2p/go-libp2p/core/connmgr"
+	"github.com/libp2p/go-libp2p/core/control"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// allowlistGater refuses connections with peers the allowlist rejects, at
+// dial and accept time, instead of letting them connect and rejecting
+// their streams. Streams are still checked too, since the gater has to let
+// some unknown peers in (see InterceptSecured).
+type allowlistGater struct {
+	allowlist *Allowlist
+	invites   *InviteRegistry // Pending invites let unknown peers in to pair (nil = none)
+
+	// Inviters being paired with, which are not in the allowlist until
+	// pairing succeeds
+	pairing gosync.Map // peer.ID -> struct{}
+
+	gatedDials   int64
+	gatedAccepts int64
+}
+
+var _ connmgr.ConnectionGater = (*allowlistGater)(nil)
+
+func newAllowlistGater(allowlist *Allowlist, invites *InviteRegistry) *allowlistGater {
+	return &allowlistGater{allowlist: allowlist, invites: invites}
+}
+
+// InterceptPeerDial refuses to dial peers the allowlist rejects
+func (g *allowlistGater) InterceptPeerDial(p peer.ID) bool {
+	if g.allowOutbound(p) {
+		return true
+	}
+	atomic.AddInt64(&g.gatedDials, 1)
+	return false
+}
+
+func (g *allowlistGater) InterceptAddrDial(peer.ID, multiaddr.Multiaddr) bool {
+	return true
+}
+
+// InterceptAccept lets inbound connections through to the handshake,
+// which authenticates the peer
+func (g *allowlistGater) InterceptAccept(network.ConnMultiaddrs) bool {
+	return true
+}
+
+// InterceptSecured refuses authenticated connections with peers the
+// allowlist rejects. While redeemable invites are pending, any peer may
+// connect inbound to redeem one; its sync streams are still refused until
+// pairing adds it to the allowlist.
+func (g *allowlistGater) InterceptSecured(dir network.Direction, p peer.ID, _ network.ConnMultiaddrs) bool {
+	if dir == network.DirOutbound {
+		if g.allowOutbound(p) {
+			return true
+		}
+		atomic.AddInt64(&g.gatedDials, 1)
+		return false
+	}
+	if g.allowlist.IsAllowed(p) || (g.invites != nil && g.invites.HasPending()) {
+		return true
+	}
+	atomic.AddInt64(&g.gatedAccepts, 1)
+	return false
+}
+
+func (g *allowlistGater) InterceptUpgraded(network.Conn) (bool, control.DisconnectReason) {
+	return true, 0
+}
+
+func (g *allowlistGater) allowOutbound(p peer.ID) bool {
+	if _, ok := g.pairing.Load(p); ok {
+		return true
+	}
+	return g.allowlist.IsAllowed(p)
+}
+
+// startPairing lets connections to an inviter through until the returned
+// function is called
+func (g *allowlistGater) startPairing(p peer.ID) func() {
+	g.pairing.Store(p, struct{}{})
+	return func() { g.pairing.Delete(p) }
+}
+
+// dials returns the number of refused outbound connections
+func (g *allowlistGater) dials() int64 {
+	if g == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&g.gatedDials)
+}
+
+// accepts returns the number of refused inbound connections
+func (g *allowlistGater) accepts() int64 {
+	if g == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&g.gatedAccepts)
+}
@@ -0,0 +1,87 @@
+package sync
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func TestAllowlistGater(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	start := func(cfg Config) *p2pService {
+		t.Helper()
+		cfg.EnableMDNS = false
+		svc, err := NewP2PService(newMockProvider(), cfg)
+		if err != nil {
+			t.Fatalf("failed to create service: %v", err)
+		}
+		if err := svc.Start(ctx); err != nil {
+			t.Fatalf("failed to start: %v", err)
+		}
+		t.Cleanup(func() { svc.Stop() })
+		return svc.(*p2pService)
+	}
+	strict := func() Config {
+		cfg := DefaultConfig()
+		cfg.AllowlistPath = t.TempDir()
+		cfg.InvitesPath = cfg.AllowlistPath
+		cfg.StrictAllowlist = true
+		return cfg
+	}
+	inviter := start(strict())
+	joiner := start(strict())
+	stranger := start(DefaultConfig())
+	inviterInfo := peer.AddrInfo{ID: inviter.host.ID(), Addrs: inviter.host.Addrs()}
+
+	// Unknown peers are refused at accept time, and strict peers refuse
+	// to dial unknown peers
+	if stillConnected(ctx, stranger, inviterInfo) {
+		t.Error("expected an unknown peer to be refused")
+	}
+	if got := inviter.Metrics().GatedAccepts; got == 0 {
+		t.Error("expected a gated accept")
+	}
+	if err := joiner.host.Connect(ctx, inviterInfo); err == nil {
+		t.Error("expected a dial to an unknown peer to be refused")
+	}
+	if got := joiner.Metrics().GatedDials; got == 0 {
+		t.Error("expected a gated dial")
+	}
+
+	// Pending invites let the joiner in to pair, after which both sides
+	// know each other
+	invite, _ := CreateInviteWithOptions(inviter.host, InviteOptions{Expiry: time.Hour, OneTime: true})
+	inviter.invites.Add(PendingInvite{ID: invite.ID, ExpiresAt: invite.ExpiresAt, OneTime: true})
+	if _, err := joiner.Pair(ctx, invite, ""); err != nil {
+		t.Fatalf("pair failed: %v", err)
+	}
+	if !inviter.allowlist.IsAllowed(joiner.host.ID()) || !joiner.allowlist.IsAllowed(inviter.host.ID()) {
+		t.Error("expected pairing to allowlist both peers")
+	}
+
+	// The one-time invite is used up, so strangers are refused again
+	if stillConnected(ctx, stranger, inviterInfo) {
+		t.Error("expected an unknown peer to be refused after pairing")
+	}
+}
+
+// stillConnected connects to a peer and reports whether the connection
+// survives. The dialer's handshake can finish before the other side
+// refuses it, so Connect may succeed for a moment.
+func stillConnected(ctx context.Context, from *p2pService, to peer.AddrInfo) bool {
+	if err := from.host.Connect(ctx, to); err != nil {
+		return false
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if len(from.host.Network().ConnsToPeer(to.ID)) == 0 {
+			return false
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return true
+}
@@ -0,0 +1,293 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	gosync "sync"
+	"time"
+
+	"github.com/amaydixit11/acorde/internal/sharing"
+	vcrypto "github.com/amaydixit11/acorde/pkg/crypto"
+	"github.com/google/uuid"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// KeyGrant carries a rotated vault key to one device, wrapped with X25519
+// ECDH between the sender's and recipient's device keys (see
+// sharing.ShareKeyWith). The rotation ID stands in for the entry ID in the
+// key derivation. The key's epoch travels with it, so both devices name
+// content sealed with it alike.
+type KeyGrant struct {
+	RotationID uuid.UUID `json:"rotation_id"`
+	Peer       string    `json:"peer"`            // Recipient (outgoing) or sender (incoming)
+	Key        []byte    `json:"key"`             // Wrapped vault key
+	Epoch      uint32    `json:"epoch,omitempty"` // Of the key (0 = not sent: the next one)
+	SenderKey  []byte    `json:"sender_key"`      // Sender's X25519 public key
+	CreatedAt  int64     `json:"created_at"`
+}
+
+// NewKeyGrant wraps key for the peer whose device public key is
+// recipientKey
+func NewKeyGrant(rotationID uuid.UUID, to peer.ID, key vcrypto.EpochKey, sender *sharing.KeyPair, recipientKey []byte) (KeyGrant, error) {
+	if len(recipientKey) != 32 {
+		return KeyGrant{}, errors.New("invalid device key")
+	}
+	shared, err := sharing.ShareKeyWith(&sharing.EntryKey{Key: key.Key, EntryID: rotationID}, sender.Private, sharing.PeerID(recipientKey))
+	if err != nil {
+		return KeyGrant{}, err
+	}
+	return KeyGrant{
+		RotationID: rotationID,
+		Peer:       to.String(),
+		Key:        shared.EncryptedKey,
+		Epoch:      key.Epoch,
+		SenderKey:  sender.Public[:],
+		CreatedAt:  time.Now().Unix(),
+	}, nil
+}
+
+// Open unwraps the vault key with the recipient's device key
+func (g KeyGrant) Open(recipient *sharing.KeyPair) (vcrypto.EpochKey, error) {
+	if len(g.SenderKey) != 32 {
+		return vcrypto.EpochKey{}, errors.New("invalid sender key")
+	}
+	key, err := sharing.RecoverSharedKey(&sharing.ShareableKey{EncryptedKey: g.Key}, g.RotationID, recipient.Private, sharing.PeerID(g.SenderKey))
+	if err != nil {
+		return vcrypto.EpochKey{}, err
+	}
+	return vcrypto.EpochKey{Epoch: g.Epoch, Key: *key}, nil
+}
+
+// GrantStore keeps key grants in <dir>/grants.json: outgoing grants until
+// the recipient acknowledges them, incoming grants until the keystore has
+// been updated with the new key. Like InviteRegistry, the file is re-read
+// on every operation so the CLI and a running daemon can share it.
+type GrantStore struct {
+	path string
+	mu   gosync.Mutex
+}
+
+// grantsFile is the storage format
+type grantsFile struct {
+	Outgoing []KeyGrant `json:"outgoing,omitempty"`
+	Incoming []KeyGrant `json:"incoming,omitempty"`
+}
+
+// NewGrantStore creates a grant store in dir
+func NewGrantStore(dir string) *GrantStore {
+	return &GrantStore{path: filepath.Join(dir, "grants.json")}
+}
+
+// AddOutgoing queues grants for delivery, replacing older grants to the
+// same peers
+func (g *GrantStore) AddOutgoing(grants ...KeyGrant) error {
+	return g.update(func(f *grantsFile) {
+		for _, grant := range grants {
+			f.Outgoing = append(removeGrants(f.Outgoing, grant.Peer, uuid.Nil), grant)
+		}
+	})
+}
+
+// Outgoing returns grants awaiting delivery
+func (g *GrantStore) Outgoing() ([]KeyGrant, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	f, err := g.load()
+	return f.Outgoing, err
+}
+
+// RemoveOutgoing drops a delivered grant
+func (g *GrantStore) RemoveOutgoing(peerID string, rotationID uuid.UUID) error {
+	return g.update(func(f *grantsFile) {
+		f.Outgoing = removeGrants(f.Outgoing, peerID, rotationID)
+	})
+}
+
+// RemovePeer drops all grants to or from a peer (e.g. when it is revoked)
+func (g *GrantStore) RemovePeer(peerID string) error {
+	return g.update(func(f *grantsFile) {
+		f.Outgoing = removeGrants(f.Outgoing, peerID, uuid.Nil)
+		f.Incoming = removeGrants(f.Incoming, peerID, uuid.Nil)
+	})
+}
+
+// AddIncoming records a received grant, ignoring duplicates
+func (g *GrantStore) AddIncoming(grant KeyGrant) error {
+	return g.update(func(f *grantsFile) {
+		f.Incoming = append(removeGrants(f.Incoming, grant.Peer, grant.RotationID), grant)
+	})
+}
+
+// Incoming returns received grants, oldest first
+func (g *GrantStore) Incoming() ([]KeyGrant, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	f, err := g.load()
+	return f.Incoming, err
+}
+
+// ClearIncoming drops all received grants
+func (g *GrantStore) ClearIncoming() error {
+	return g.update(func(f *grantsFile) {
+		f.Incoming = nil
+	})
+}
+
+// update applies fn to the stored grants and saves them
+func (g *GrantStore) update(fn func(*grantsFile)) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	f, err := g.load()
+	if err != nil {
+		return err
+	}
+	fn(&f)
+	return g.save(f)
+}
+
+// load reads the grants file
+func (g *GrantStore) load() (grantsFile, error) {
+	var f grantsFile
+	data, err := os.ReadFile(g.path)
+	if os.IsNotExist(err) {
+		return f, nil
+	}
+	if err != nil {
+		return f, err
+	}
+	err = json.Unmarshal(data, &f)
+	return f, err
+}
+
+// save writes the grants file
+func (g *GrantStore) save(f grantsFile) error {
+	if err := os.MkdirAll(filepath.Dir(g.path), 0700); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(g.path, data, 0600)
+}
+
+// removeGrants filters out grants for peerID (and rotationID, unless Nil)
+func removeGrants(grants []KeyGrant, peerID string, rotationID uuid.UUID) []KeyGrant {
+	kept := grants[:0]
+	for _, grant := range grants {
+		if grant.Peer == peerID && (rotationID == uuid.Nil || grant.RotationID == rotationID) {
+			continue
+		}
+		kept = append(kept, grant)
+	}
+	return kept
+}
+
+// rekeyResponse acknowledges a key grant
+type rekeyResponse struct {
+	Error string `json:"error,omitempty"`
+}
+
+// handleRekeyStream accepts a key grant from a trusted peer. The sender
+// must be allowlisted with a known device key; the grant is unwrapped with
+// that key rather than one supplied on the wire.
+func (s *p2pService) handleRekeyStream(stream Stream) {
+	defer stream.Close()
+	stream.SetDeadline(time.Now().Add(30 * time.Second))
+
+	from := stream.RemotePeer()
+	var grant KeyGrant
+	if err := readFrame(stream, &grant); err != nil {
+		return
+	}
+
+	key, err := s.acceptGrant(from, grant)
+	if err != nil {
+		s.logger.Errorf("rejected key grant from %s: %v", from.String()[:8], err)
+		writeFrame(stream, &rekeyResponse{Error: err.Error()})
+		return
+	}
+	writeFrame(stream, &rekeyResponse{})
+	s.logger.Infof("received rotated vault key from %s", from.String()[:8])
+
+	if s.config.OnKeyGrant != nil {
+		if err := s.config.OnKeyGrant(from, key); err != nil {
+			s.logger.Errorf("failed to apply rotated key: %v", err)
+		}
+	}
+}
+
+// acceptGrant validates and stores an incoming grant
+func (s *p2pService) acceptGrant(from peer.ID, grant KeyGrant) (vcrypto.EpochKey, error) {
+	if s.allowlist == nil || !s.allowlist.IsAllowed(from) {
+		return vcrypto.EpochKey{}, errors.New("peer is not trusted")
+	}
+	p, ok := s.allowlist.Get(from)
+	if !ok || len(p.DeviceKey) != 32 {
+		return vcrypto.EpochKey{}, errors.New("no device key on record for peer")
+	}
+
+	grant.Peer = from.String()
+	grant.SenderKey = p.DeviceKey
+	key, err := grant.Open(s.config.DeviceKey)
+	if err != nil {
+		return vcrypto.EpochKey{}, err
+	}
+	if err := s.grants.AddIncoming(grant); err != nil {
+		return vcrypto.EpochKey{}, fmt.Errorf("failed to store grant: %w", err)
+	}
+	return key, nil
+}
+
+// deliverGrants sends queued grants to connected recipients
+func (s *p2pService) deliverGrants() {
+	grants, err := s.grants.Outgoing()
+	if err != nil {
+		s.logger.Errorf("failed to load key grants: %v", err)
+		return
+	}
+	for _, grant := range grants {
+		to, err := peer.Decode(grant.Peer)
+		if err != nil || !s.transport.Connected(to) {
+			continue
+		}
+		if err := s.sendGrant(s.ctx, to, grant); err != nil {
+			s.logger.Errorf("key grant to %s failed: %v", to.String()[:8], err)
+			continue
+		}
+		s.grants.RemoveOutgoing(grant.Peer, grant.RotationID)
+		s.logger.Infof("delivered rotated vault key to %s", to.String()[:8])
+	}
+}
+
+// sendGrant delivers one grant and waits for the acknowledgement
+func (s *p2pService) sendGrant(ctx context.Context, to peer.ID, grant KeyGrant) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	stream, err := s.transport.Dial(ctx, to, RekeyProtocolID)
+	if err != nil {
+		return fmt.Errorf("failed to open rekey stream: %w", err)
+	}
+	defer stream.Close()
+	stream.SetDeadline(time.Now().Add(30 * time.Second))
+
+	if err := writeFrame(stream, &grant); err != nil {
+		return err
+	}
+	var resp rekeyResponse
+	if err := readFrame(stream, &resp); err != nil {
+		return err
+	}
+	if resp.Error != "" {
+		return errors.New(resp.Error)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/amaydixit11/acorde/internal/sharing"
+	vcrypto "github.com/amaydixit11/acorde/pkg/crypto"
+	"github.com/google/uuid"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func TestKeyGrantAfterRevocation(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	received := make(chan vcrypto.EpochKey, 1)
+	start := func(dir string, onGrant bool) *p2pService {
+		kp, err := sharing.LoadOrCreateKeyPair(dir + "/device.key")
+		if err != nil {
+			t.Fatalf("failed to create device key: %v", err)
+		}
+		cfg := DefaultConfig()
+		cfg.EnableMDNS = false
+		cfg.SyncInterval = time.Hour
+		cfg.AllowlistPath = dir
+		cfg.InvitesPath = dir
+		cfg.GrantsPath = dir
+		cfg.DeviceKey = kp
+		if onGrant {
+			cfg.OnKeyGrant = func(_ peer.ID, key vcrypto.EpochKey) error {
+				received <- key
+				return nil
+			}
+		}
+		svc, err := NewP2PService(newMockProvider(), cfg)
+		if err != nil {
+			t.Fatalf("failed to create service: %v", err)
+		}
+		if err := svc.Start(ctx); err != nil {
+			t.Fatalf("failed to start: %v", err)
+		}
+		t.Cleanup(func() { svc.Stop() })
+		return svc.(*p2pService)
+	}
+	inviter := start(t.TempDir(), false)
+	joiner := start(t.TempDir(), true)
+
+	// Pairing exchanges device keys
+	invite, _ := CreateInviteWithOptions(inviter.host, InviteOptions{Expiry: time.Hour, OneTime: true})
+	inviter.invites.Add(PendingInvite{ID: invite.ID, ExpiresAt: invite.ExpiresAt, OneTime: true})
+	if _, err := joiner.Pair(ctx, invite, ""); err != nil {
+		t.Fatalf("pair failed: %v", err)
+	}
+	p, ok := inviter.allowlist.Get(joiner.host.ID())
+	if !ok || !bytes.Equal(p.DeviceKey, joiner.config.DeviceKey.Public[:]) {
+		t.Fatalf("inviter did not record joiner's device key: %+v", p)
+	}
+
+	// The inviter rotates and queues a grant for the joiner
+	newKey := vcrypto.EpochKey{Epoch: 3, Key: [32]byte{9, 9, 9}}
+	grant, err := NewKeyGrant(uuid.New(), joiner.host.ID(), newKey, inviter.config.DeviceKey, p.DeviceKey)
+	if err != nil {
+		t.Fatalf("failed to create grant: %v", err)
+	}
+	inviter.grants.AddOutgoing(grant)
+	inviter.deliverGrants()
+
+	select {
+	case key := <-received:
+		if key != newKey {
+			t.Errorf("received wrong key of epoch %d", key.Epoch)
+		}
+	case <-ctx.Done():
+		t.Fatal("grant was not delivered")
+	}
+	if out, _ := inviter.grants.Outgoing(); len(out) != 0 {
+		t.Errorf("delivered grant still queued: %d", len(out))
+	}
+	in, _ := joiner.grants.Incoming()
+	if len(in) != 1 {
+		t.Fatalf("expected 1 stored incoming grant, got %d", len(in))
+	}
+	if key, err := in[0].Open(joiner.config.DeviceKey); err != nil || key != newKey {
+		t.Errorf("stored grant does not open: %v", err)
+	}
+
+	// A revoked device is refused even without a strict allowlist
+	if err := inviter.allowlist.Revoke(joiner.host.ID()); err != nil {
+		t.Fatalf("revoke failed: %v", err)
+	}
+	if inviter.allowlist.IsAllowed(joiner.host.ID()) {
+		t.Error("revoked peer should not be allowed")
+	}
+	if err := inviter.SyncWith(ctx, joiner.host.ID()); err == nil {
+		t.Error("sync with revoked peer should fail")
+	}
+
+	// Revocation survives a reload
+	al, _ := NewAllowlist(inviter.config.AllowlistPath, false)
+	if !al.IsRevoked(joiner.host.ID()) {
+		t.Error("revocation was not persisted")
+	}
+}
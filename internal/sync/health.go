@@ -0,0 +1,211 @@
+package sync
+
+import (
+	"encoding/json"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"sort"
+	gosync "sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Peer statuses reported in PeerHealth
+const (
+	PeerOK          = "ok"
+	PeerBackingOff  = "backing_off"
+	PeerQuarantined = "quarantined"
+)
+
+// Backoff defaults (see Config)
+const (
+	DefaultMaxBackoff      = 5 * time.Minute
+	DefaultQuarantineAfter = 10
+	DefaultQuarantineFor   = time.Hour
+)
+
+// PeerHealth is a peer's sync record. Peers that keep failing (e.g. a
+// different vault, or corrupt state) are retried less and less often,
+// then quarantined for a while.
+type PeerHealth struct {
+	PeerID              string    `json:"peer_id"`
+	Status              string    `json:"status"` // PeerOK, PeerBackingOff or PeerQuarantined
+	Successes           int64     `json:"successes"`
+	Failures            int64     `json:"failures"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	LastError           string    `json:"last_error,omitempty"`
+	LastSuccess         time.Time `json:"last_success,omitzero"`
+	LastFailure         time.Time `json:"last_failure,omitzero"`
+	NextAttempt         time.Time `json:"next_attempt,omitzero"` // Periodic syncs wait until then
+}
+
+// healthFile is where the daemon publishes peer health for `acorde peers`
+const healthFile = "peer-health.json"
+
+// healthTracker keeps PeerHealth for every peer synced with, and decides
+// when failing peers are retried
+type healthTracker struct {
+	interval        time.Duration // Backoff after the first failure
+	maxBackoff      time.Duration
+	quarantineAfter int
+	quarantineFor   time.Duration
+	path            string // "" = not published
+
+	mu      gosync.Mutex
+	peers   map[peer.ID]*PeerHealth
+	changed bool      // A status changed since the last save
+	dirty   bool      // Counters changed since the last save
+	saved   time.Time // Of the last save
+}
+
+func newHealthTracker(cfg Config) *healthTracker {
+	t := &healthTracker{
+		interval:        cfg.SyncInterval,
+		maxBackoff:      cfg.MaxBackoff,
+		quarantineAfter: cfg.QuarantineAfter,
+		quarantineFor:   cfg.QuarantineFor,
+		peers:           make(map[peer.ID]*PeerHealth),
+	}
+	if cfg.HealthPath != "" {
+		t.path = filepath.Join(cfg.HealthPath, healthFile)
+	}
+	if t.maxBackoff <= 0 {
+		t.maxBackoff = DefaultMaxBackoff
+	}
+	if t.quarantineAfter <= 0 {
+		t.quarantineAfter = DefaultQuarantineAfter
+	}
+	if t.quarantineFor <= 0 {
+		t.quarantineFor = DefaultQuarantineFor
+	}
+	return t
+}
+
+func (t *healthTracker) get(p peer.ID) *PeerHealth {
+	h, ok := t.peers[p]
+	if !ok {
+		h = &PeerHealth{PeerID: p.String(), Status: PeerOK}
+		t.peers[p] = h
+	}
+	return h
+}
+
+// record updates a peer's health with the outcome of a sync
+func (t *healthTracker) record(p peer.ID, err error, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	h := t.get(p)
+	status := h.Status
+	if err == nil {
+		h.Successes++
+		h.ConsecutiveFailures = 0
+		h.LastSuccess = now
+		h.NextAttempt = time.Time{}
+		h.Status = PeerOK
+	} else {
+		h.Failures++
+		h.ConsecutiveFailures++
+		h.LastError = err.Error()
+		h.LastFailure = now
+		if h.ConsecutiveFailures >= t.quarantineAfter {
+			h.Status = PeerQuarantined
+			h.NextAttempt = now.Add(t.quarantineFor)
+		} else {
+			h.Status = PeerBackingOff
+			h.NextAttempt = now.Add(t.backoff(h.ConsecutiveFailures))
+		}
+	}
+	t.dirty = true
+	t.changed = t.changed || h.Status != status || err != nil
+}
+
+// backoff returns the delay after n consecutive failures: the sync
+// interval doubled for each failure, capped, with jitter so that peers
+// failing together do not retry together
+func (t *healthTracker) backoff(n int) time.Duration {
+	d := t.interval
+	for i := 1; i < n && d < t.maxBackoff; i++ {
+		d *= 2
+	}
+	d = min(d, t.maxBackoff)
+	return d/2 + rand.N(d/2+1)
+}
+
+// due reports whether a periodic sync with a peer may run
+func (t *healthTracker) due(p peer.ID, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	h, ok := t.peers[p]
+	return !ok || !now.Before(h.NextAttempt)
+}
+
+// reset forgets a peer's failures, e.g. after pairing with it again
+func (t *healthTracker) reset(p peer.ID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if h, ok := t.peers[p]; ok && h.Status != PeerOK {
+		h.ConsecutiveFailures = 0
+		h.NextAttempt = time.Time{}
+		h.Status = PeerOK
+		t.changed, t.dirty = true, true
+	}
+}
+
+// list returns every peer's health, by peer ID
+func (t *healthTracker) list() []PeerHealth {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	result := make([]PeerHealth, 0, len(t.peers))
+	for _, h := range t.peers {
+		result = append(result, *h)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].PeerID < result[j].PeerID })
+	return result
+}
+
+// maybeSave publishes peer health: right away after a status change or
+// failure, otherwise at most once a minute, so that steady successful
+// syncs do not rewrite the file every interval
+func (t *healthTracker) maybeSave(now time.Time) error {
+	if t.path == "" {
+		return nil
+	}
+	t.mu.Lock()
+	save := t.changed || (t.dirty && now.Sub(t.saved) >= time.Minute)
+	if save {
+		t.changed, t.dirty, t.saved = false, false, now
+	}
+	t.mu.Unlock()
+	if !save {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(t.list(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(t.path, data, 0600)
+}
+
+// LoadPeerHealth reads the peer health a daemon using dir as
+// Config.HealthPath last published
+func LoadPeerHealth(dir string) ([]PeerHealth, error) {
+	data, err := os.ReadFile(filepath.Join(dir, healthFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var list []PeerHealth
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
@@ -0,0 +1,63 @@
+package sync
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func TestHealthBackoffAndQuarantine(t *testing.T) {
+	dir := t.TempDir()
+	tracker := newHealthTracker(Config{
+		SyncInterval:    time.Second,
+		MaxBackoff:      8 * time.Second,
+		QuarantineAfter: 6,
+		QuarantineFor:   time.Hour,
+		HealthPath:      dir,
+	})
+	p := peer.ID("peer")
+	now := time.Now()
+	fail := errors.New("wrong vault")
+
+	if !tracker.due(p, now) {
+		t.Fatal("unknown peers should be due")
+	}
+
+	// Delays double from the interval, with jitter, up to the cap
+	for n, want := range []time.Duration{1, 2, 4, 8, 8} {
+		tracker.record(p, fail, now)
+		h := tracker.list()[0]
+		delay := h.NextAttempt.Sub(now)
+		if h.Status != PeerBackingOff || delay < want*time.Second/2 || delay > want*time.Second {
+			t.Errorf("failure %d: got %s, delay %v; want backing off within %v", n+1, h.Status, delay, want*time.Second)
+		}
+		if tracker.due(p, now) || !tracker.due(p, h.NextAttempt) {
+			t.Errorf("failure %d: peer should be due exactly at its next attempt", n+1)
+		}
+	}
+
+	tracker.record(p, fail, now)
+	if h := tracker.list()[0]; h.Status != PeerQuarantined || h.NextAttempt != now.Add(time.Hour) || h.LastError != fail.Error() {
+		t.Errorf("expected quarantine after 6 failures, got %+v", h)
+	}
+
+	// Published for `acorde peers list`
+	if err := tracker.maybeSave(now); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadPeerHealth(dir)
+	if err != nil || len(loaded) != 1 || loaded[0].Status != PeerQuarantined || loaded[0].Failures != 6 {
+		t.Errorf("unexpected published health %+v (%v)", loaded, err)
+	}
+
+	tracker.reset(p)
+	if !tracker.due(p, now) {
+		t.Error("reset should lift the quarantine")
+	}
+	tracker.record(p, nil, now)
+	if h := tracker.list()[0]; h.Status != PeerOK || h.ConsecutiveFailures != 0 || h.Failures != 6 || h.Successes != 1 {
+		t.Errorf("unexpected health after success: %+v", h)
+	}
+}
@@ -2,9 +2,13 @@ package sync
 
 import (
 	"crypto/ed25519"
+	"crypto/rand"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -29,10 +33,41 @@ type PeerInvite struct {
 	ExpiresAt int64    `json:"e"`    // Expiry timestamp
 	Signature []byte   `json:"s"`    // Signature over above fields
 	Key       []byte   `json:"y,omitempty"` // Encryption key (optional)
+	KeyEpoch  uint32   `json:"ye,omitempty"` // Epoch of Key
+
+	// Trust is the inviter's allowlist, imported on pairing (optional,
+	// signed on its own by the same key)
+	Trust *TrustBundle `json:"t,omitempty"`
+
+	// Redeemable invites are tracked by the inviter and paired over
+	// PairProtocolID (see Pair) instead of trusting the code alone
+	ID      string `json:"i,omitempty"`   // Invite ID registered with the inviter
+	OneTime bool   `json:"o,omitempty"`   // Can be redeemed once
+	PIN     bool   `json:"pin,omitempty"` // Requires the out-of-band PIN
+}
+
+// InviteOptions configures CreateInviteWithOptions
+type InviteOptions struct {
+	Expiry  time.Duration
+	OneTime bool // Inviter accepts a single redemption
+	PIN     bool // Joiner must enter the PIN shown on the inviting device
+}
+
+// IsRedeemable reports whether the invite must be redeemed with the
+// inviter through the pairing protocol
+func (i *PeerInvite) IsRedeemable() bool {
+	return i.ID != ""
 }
 
 // CreateInvite generates a signed invite for this host
 func CreateInvite(h host.Host, expiry time.Duration) (*PeerInvite, error) {
+	return CreateInviteWithOptions(h, InviteOptions{Expiry: expiry})
+}
+
+// CreateInviteWithOptions generates a signed invite. One-time and PIN
+// invites get an ID; register them with an InviteRegistry so the inviter's
+// sync service can redeem them.
+func CreateInviteWithOptions(h host.Host, opts InviteOptions) (*PeerInvite, error) {
 	now := time.Now()
 
 	// Get addresses (limit to 2 most useful ones for QR size)
@@ -68,7 +103,16 @@ func CreateInvite(h host.Host, expiry time.Duration) (*PeerInvite, error) {
 		Addresses: addrStrs,
 		PublicKey: pubKeyBytes,
 		CreatedAt: now.Unix(),
-		ExpiresAt: now.Add(expiry).Unix(),
+		ExpiresAt: now.Add(opts.Expiry).Unix(),
+		OneTime:   opts.OneTime,
+		PIN:       opts.PIN,
+	}
+	if opts.OneTime || opts.PIN {
+		id := make([]byte, 16)
+		if _, err := rand.Read(id); err != nil {
+			return nil, fmt.Errorf("failed to generate invite ID: %w", err)
+		}
+		invite.ID = hex.EncodeToString(id)
 	}
 
 	// Sign the invite
@@ -95,6 +139,9 @@ func (i *PeerInvite) signableData() []byte {
 		i.CreatedAt,
 		i.ExpiresAt,
 	)
+	if i.IsRedeemable() {
+		data += fmt.Sprintf("|%s|%t|%t", i.ID, i.OneTime, i.PIN)
+	}
 	return []byte(data)
 }
 
@@ -107,33 +154,78 @@ func (i *PeerInvite) Encode() (string, error) {
 	return InvitePrefix + base64.RawURLEncoding.EncodeToString(data), nil
 }
 
-// ToQR generates a QR code PNG for the invite
+// QRSize is the default width and height of invite QR PNGs
+const QRSize = 256
+
+// ParseQRLevel parses a QR error correction level: low, medium, high or
+// highest. Higher levels survive more damage but make denser codes.
+func ParseQRLevel(s string) (qrcode.RecoveryLevel, error) {
+	switch strings.ToLower(s) {
+	case "", "low":
+		return qrcode.Low, nil
+	case "medium":
+		return qrcode.Medium, nil
+	case "high":
+		return qrcode.High, nil
+	case "highest":
+		return qrcode.Highest, nil
+	}
+	return qrcode.Low, fmt.Errorf("invalid QR level %q (use low, medium, high or highest)", s)
+}
+
+// ToQR generates a QR code PNG of the invite's minimal code
 func (i *PeerInvite) ToQR() ([]byte, error) {
-	// Use minimal format for QR: just peer ID and first address
-	minimalCode := i.ToMinimalCode()
-	return qrcode.Encode(minimalCode, qrcode.Low, 256)
+	return i.ToQRWith(qrcode.Low, QRSize)
+}
+
+// ToQRWith generates a size×size QR code PNG of the invite's minimal code
+// at an error correction level
+func (i *PeerInvite) ToQRWith(level qrcode.RecoveryLevel, size int) ([]byte, error) {
+	return qrcode.Encode(i.ToMinimalCode(), level, size)
 }
 
 // ToQRString generates an ASCII art QR code for terminal display
 func (i *PeerInvite) ToQRString() (string, error) {
-	minimalCode := i.ToMinimalCode()
-	qr, err := qrcode.New(minimalCode, qrcode.Low)
+	return i.ToQRStringWith(qrcode.Low, false)
+}
+
+// ToQRStringWith generates an ASCII art QR code at an error correction
+// level. Inverse swaps dark and light, for terminals with a light
+// background.
+func (i *PeerInvite) ToQRStringWith(level qrcode.RecoveryLevel, inverse bool) (string, error) {
+	qr, err := qrcode.New(i.ToMinimalCode(), level)
 	if err != nil {
 		return "", err
 	}
-	return qr.ToSmallString(false), nil
+	return qr.ToSmallString(inverse), nil
 }
 
-// ToMinimalCode returns a short code for QR: acorde://PEERID@ADDR
+// ToMinimalCode returns a short code for QR codes:
+//
+//	acorde://PEERID@ADDR[,ADDR]?c=CREATED&e=EXPIRES&s=SIGNATURE[&i=ID&o=1&pin=1]
+//
+// It has every signed field, so ParseInvite verifies it like a full code.
+// The public key is derived from the peer ID, and an embedded vault key
+// and trust bundle are left out.
 func (i *PeerInvite) ToMinimalCode() string {
-	addr := ""
-	if len(i.Addresses) > 0 {
-		addr = i.Addresses[0]
+	q := url.Values{}
+	q.Set("c", strconv.FormatInt(i.CreatedAt, 10))
+	q.Set("e", strconv.FormatInt(i.ExpiresAt, 10))
+	q.Set("s", base64.RawURLEncoding.EncodeToString(i.Signature))
+	if i.IsRedeemable() {
+		q.Set("i", i.ID)
+		if i.OneTime {
+			q.Set("o", "1")
+		}
+		if i.PIN {
+			q.Set("pin", "1")
+		}
 	}
-	return fmt.Sprintf("%s%s@%s", InvitePrefix, i.PeerID, addr)
+	return fmt.Sprintf("%s%s@%s?%s", InvitePrefix, i.PeerID, strings.Join(i.Addresses, ","), q.Encode())
 }
 
-// ParseInvite decodes and validates an invite string
+// ParseInvite decodes and validates an invite string: a full code from
+// Encode or a minimal code from ToMinimalCode
 func ParseInvite(s string) (*PeerInvite, error) {
 	// Remove prefix
 	if !strings.HasPrefix(s, InvitePrefix) {
@@ -141,16 +233,15 @@ func ParseInvite(s string) (*PeerInvite, error) {
 	}
 	data := strings.TrimPrefix(s, InvitePrefix)
 
-	// Decode base64
-	jsonData, err := base64.RawURLEncoding.DecodeString(data)
-	if err != nil {
-		return nil, fmt.Errorf("invalid invite encoding: %w", err)
+	var invite *PeerInvite
+	var err error
+	if strings.Contains(data, "@") {
+		invite, err = parseMinimalCode(data)
+	} else {
+		invite, err = parseFullCode(data)
 	}
-
-	// Parse JSON
-	var invite PeerInvite
-	if err := json.Unmarshal(jsonData, &invite); err != nil {
-		return nil, fmt.Errorf("invalid invite data: %w", err)
+	if err != nil {
+		return nil, err
 	}
 
 	// Check expiry
@@ -178,9 +269,79 @@ func ParseInvite(s string) (*PeerInvite, error) {
 		return nil, fmt.Errorf("peer ID mismatch")
 	}
 
+	if invite.Trust != nil {
+		if err := invite.Trust.Verify(); err != nil {
+			return nil, err
+		}
+		if invite.Trust.Signer != invite.PeerID {
+			return nil, fmt.Errorf("trust bundle not signed by the inviter")
+		}
+	}
+
+	return invite, nil
+}
+
+// parseFullCode decodes the base64 JSON of a full code
+func parseFullCode(data string) (*PeerInvite, error) {
+	// Decode base64
+	jsonData, err := base64.RawURLEncoding.DecodeString(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid invite encoding: %w", err)
+	}
+
+	// Parse JSON
+	var invite PeerInvite
+	if err := json.Unmarshal(jsonData, &invite); err != nil {
+		return nil, fmt.Errorf("invalid invite data: %w", err)
+	}
 	return &invite, nil
 }
 
+// parseMinimalCode decodes a minimal code (without the prefix)
+func parseMinimalCode(data string) (*PeerInvite, error) {
+	head, query, _ := strings.Cut(data, "?")
+	peerID, addrs, _ := strings.Cut(head, "@")
+	q, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid invite data: %w", err)
+	}
+	if !q.Has("s") {
+		return nil, fmt.Errorf("invalid invite data: unsigned code (create a new invite)")
+	}
+
+	invite := &PeerInvite{
+		PeerID:  peerID,
+		ID:      q.Get("i"),
+		OneTime: q.Get("o") == "1",
+		PIN:     q.Get("pin") == "1",
+	}
+	if addrs != "" {
+		invite.Addresses = strings.Split(addrs, ",")
+	}
+	if invite.CreatedAt, err = strconv.ParseInt(q.Get("c"), 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid invite data: %w", err)
+	}
+	if invite.ExpiresAt, err = strconv.ParseInt(q.Get("e"), 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid invite data: %w", err)
+	}
+	if invite.Signature, err = base64.RawURLEncoding.DecodeString(q.Get("s")); err != nil {
+		return nil, fmt.Errorf("invalid invite encoding: %w", err)
+	}
+
+	id, err := peer.Decode(peerID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid peer ID: %w", err)
+	}
+	pubKey, err := id.ExtractPublicKey()
+	if err != nil {
+		return nil, fmt.Errorf("invalid peer ID: %w", err)
+	}
+	if invite.PublicKey, err = crypto.MarshalPublicKey(pubKey); err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	return invite, nil
+}
+
 // ToPeerAddrInfo converts the invite to libp2p peer address info
 func (i *PeerInvite) ToPeerAddrInfo() (*peer.AddrInfo, error) {
 	peerID, err := peer.Decode(i.PeerID)
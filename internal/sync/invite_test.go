@@ -1,6 +1,7 @@
 package sync
 
 import (
+	"strings"
 	"testing"
 	"time"
 
@@ -89,6 +90,47 @@ func TestInviteQRGeneration(t *testing.T) {
 	}
 }
 
+func TestMinimalCodeRoundTrip(t *testing.T) {
+	h, _ := libp2p.New()
+	defer h.Close()
+
+	invite, err := CreateInviteWithOptions(h, InviteOptions{Expiry: time.Hour, OneTime: true, PIN: true})
+	if err != nil {
+		t.Fatalf("failed to create invite: %v", err)
+	}
+	code := invite.ToMinimalCode()
+
+	parsed, err := ParseInvite(code)
+	if err != nil {
+		t.Fatalf("failed to parse minimal code %s: %v", code, err)
+	}
+	if parsed.PeerID != invite.PeerID || parsed.ID != invite.ID || !parsed.OneTime || !parsed.PIN ||
+		parsed.ExpiresAt != invite.ExpiresAt || len(parsed.Addresses) != len(invite.Addresses) {
+		t.Errorf("minimal code lost data: %+v", parsed)
+	}
+
+	// Tampering breaks the signature, and unsigned legacy codes are rejected
+	tampered := strings.Replace(code, "o=1", "o=0", 1)
+	if _, err := ParseInvite(tampered); err == nil {
+		t.Error("expected a tampered code to be rejected")
+	}
+	legacy := InvitePrefix + invite.PeerID + "@" + invite.Addresses[0]
+	if _, err := ParseInvite(legacy); err == nil {
+		t.Error("expected an unsigned code to be rejected")
+	}
+}
+
+func TestParseQRLevel(t *testing.T) {
+	for _, s := range []string{"", "low", "Medium", "high", "highest"} {
+		if _, err := ParseQRLevel(s); err != nil {
+			t.Errorf("ParseQRLevel(%q): %v", s, err)
+		}
+	}
+	if _, err := ParseQRLevel("max"); err == nil {
+		t.Error("expected an unknown level to be rejected")
+	}
+}
+
 // mockStateProvider from p2p_test.go
 type inviteTestProvider struct {
 	replica *crdt.Replica
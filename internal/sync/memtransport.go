@@ -0,0 +1,205 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	gosync "sync"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// ErrUnreachable is returned by MemoryNetwork transports for a peer that
+// is not on the network, or no longer
+var ErrUnreachable = errors.New("peer is unreachable")
+
+// MemoryNetwork connects in-process transports, for tests and for
+// embedding several vaults in one process. Streams are synchronous pipes
+// and peers are who they joined the network as.
+type MemoryNetwork struct {
+	mu      gosync.Mutex
+	nodes   map[peer.ID]*memoryTransport
+	serving gosync.WaitGroup // Handlers of open streams
+}
+
+// NewMemoryNetwork returns an empty in-process network
+func NewMemoryNetwork() *MemoryNetwork {
+	return &MemoryNetwork{nodes: make(map[peer.ID]*memoryTransport)}
+}
+
+// Transport joins the network as a peer and returns its transport. A peer
+// already on the network is replaced.
+func (n *MemoryNetwork) Transport(id peer.ID) Transport {
+	t := &memoryTransport{
+		id:        id,
+		network:   n,
+		handlers:  make(map[string]func(Stream)),
+		connected: make(map[peer.ID]bool),
+	}
+	n.mu.Lock()
+	n.nodes[id] = t
+	n.mu.Unlock()
+	return t
+}
+
+// Wait waits until the handlers of every stream opened so far return, so
+// a test can check both ends of a session once its client is done
+func (n *MemoryNetwork) Wait() {
+	n.serving.Wait()
+}
+
+// node returns the transport of a peer on the network
+func (n *MemoryNetwork) node(id peer.ID) (*memoryTransport, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	t, ok := n.nodes[id]
+	return t, ok
+}
+
+// leave takes a transport off the network
+func (n *MemoryNetwork) leave(t *memoryTransport) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.nodes[t.id] == t {
+		delete(n.nodes, t.id)
+	}
+}
+
+// memoryTransport is a peer's Transport on a MemoryNetwork
+type memoryTransport struct {
+	id      peer.ID
+	network *MemoryNetwork
+
+	mu        gosync.Mutex
+	handlers  map[string]func(Stream)
+	connected map[peer.ID]bool
+	notify    func(p peer.ID, connected bool)
+	closed    bool
+}
+
+func (t *memoryTransport) ID() peer.ID {
+	return t.id
+}
+
+func (t *memoryTransport) Addrs() []string {
+	return []string{"memory:" + t.id.String()}
+}
+
+func (t *memoryTransport) Handle(protocol string, handler func(Stream)) {
+	t.mu.Lock()
+	t.handlers[protocol] = handler
+	t.mu.Unlock()
+}
+
+func (t *memoryTransport) Connect(ctx context.Context, pi peer.AddrInfo) error {
+	_, err := t.connect(pi.ID)
+	return err
+}
+
+// connect marks both ends connected and returns the remote transport
+func (t *memoryTransport) connect(p peer.ID) (*memoryTransport, error) {
+	remote, ok := t.network.node(p)
+	if !ok || remote.isClosed() || t.isClosed() {
+		return nil, fmt.Errorf("%w: %s", ErrUnreachable, p)
+	}
+	t.setConnected(p, true)
+	remote.setConnected(t.id, true)
+	return remote, nil
+}
+
+func (t *memoryTransport) Connected(p peer.ID) bool {
+	t.mu.Lock()
+	connected := t.connected[p]
+	t.mu.Unlock()
+	if !connected {
+		return false
+	}
+	remote, ok := t.network.node(p)
+	return ok && !remote.isClosed()
+}
+
+func (t *memoryTransport) Notify(fn func(p peer.ID, connected bool)) {
+	t.mu.Lock()
+	t.notify = fn
+	t.mu.Unlock()
+}
+
+func (t *memoryTransport) Dial(ctx context.Context, p peer.ID, protocol string) (Stream, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	remote, err := t.connect(p)
+	if err != nil {
+		return nil, err
+	}
+	remote.mu.Lock()
+	handler := remote.handlers[protocol]
+	remote.mu.Unlock()
+	if handler == nil {
+		return nil, fmt.Errorf("peer %s does not support protocol %s", p, protocol)
+	}
+
+	local, other := net.Pipe()
+	t.network.serving.Add(1)
+	go func() {
+		defer t.network.serving.Done()
+		handler(memoryStream{Conn: other, remote: t.id})
+	}()
+	return memoryStream{Conn: local, remote: p}, nil
+}
+
+func (t *memoryTransport) Close() error {
+	t.mu.Lock()
+	t.closed = true
+	peers := t.connected
+	t.connected = make(map[peer.ID]bool)
+	notify := t.notify
+	t.mu.Unlock()
+
+	t.network.leave(t)
+	for p := range peers {
+		if remote, ok := t.network.node(p); ok {
+			remote.setConnected(t.id, false)
+		}
+		if notify != nil {
+			notify(p, false)
+		}
+	}
+	return nil
+}
+
+func (t *memoryTransport) isClosed() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.closed
+}
+
+func (t *memoryTransport) setConnected(p peer.ID, connected bool) {
+	t.mu.Lock()
+	changed := t.connected[p] != connected
+	if connected {
+		t.connected[p] = true
+	} else {
+		delete(t.connected, p)
+	}
+	notify := t.notify
+	t.mu.Unlock()
+	if changed && notify != nil {
+		notify(p, connected)
+	}
+}
+
+// memoryStream is one end of a pipe between two memory transports
+type memoryStream struct {
+	net.Conn
+	remote peer.ID
+}
+
+func (s memoryStream) RemotePeer() peer.ID {
+	return s.remote
+}
+
+func (s memoryStream) Reset() error {
+	return s.Conn.Close()
+}
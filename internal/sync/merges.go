@@ -0,0 +1,106 @@
+package sync
+
+import (
+	gosync "sync"
+	"time"
+
+	"github.com/amaydixit11/acorde/internal/crdt"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// DefaultSlowMerge is the default Config.SlowMerge
+const DefaultSlowMerge = time.Second
+
+// StateMerger is a StateProvider that reports what merging a state did,
+// for SyncMetrics.Merges. EngineAdapter is one.
+type StateMerger interface {
+	MergeState(state crdt.ReplicaState) (crdt.MergeStats, error)
+}
+
+// PeerStateMerger is a StateMerger told which authenticated peer sent
+// each state. EngineAdapter is one.
+type PeerStateMerger interface {
+	MergeStateFrom(from peer.ID, state crdt.ReplicaState) (crdt.MergeStats, error)
+}
+
+// MergeMetrics sums the merges of states received from peers. A state
+// streamed in chunks counts as one merge.
+type MergeMetrics struct {
+	Merges      int64
+	SlowMerges  int64         // Merges that took longer than Config.SlowMerge
+	Duration    time.Duration // Time spent merging
+	MaxDuration time.Duration // Longest merge
+
+	Compared   int64 // Entries of received states compared with local ones
+	Changed    int64 // Entries merges added or modified
+	Tombstones int64 // Deleted entries in received states
+}
+
+// mergeMetrics accumulates MergeMetrics
+type mergeMetrics struct {
+	mu gosync.Mutex
+	m  MergeMetrics
+}
+
+func (m *mergeMetrics) snapshot() MergeMetrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.m
+}
+
+// record adds a merge, reporting whether it was slow
+func (m *mergeMetrics) record(stats crdt.MergeStats, slow time.Duration) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.m.Merges++
+	m.m.Duration += stats.Duration
+	if stats.Duration > m.m.MaxDuration {
+		m.m.MaxDuration = stats.Duration
+	}
+	m.m.Compared += int64(stats.Compared)
+	m.m.Changed += int64(stats.Changed)
+	m.m.Tombstones += int64(stats.Tombstones)
+	if slow <= 0 || stats.Duration <= slow {
+		return false
+	}
+	m.m.SlowMerges++
+	return true
+}
+
+// mergeState merges a remote state, or a chunk of one, sent by from into
+// the provider's and adds the merge's stats to total
+func (e *SyncEngine) mergeState(from peer.ID, state crdt.ReplicaState, total *crdt.MergeStats) error {
+	var stats crdt.MergeStats
+	var err error
+	if merger, ok := e.provider.(PeerStateMerger); ok {
+		stats, err = merger.MergeStateFrom(from, state)
+	} else if merger, ok := e.provider.(StateMerger); ok {
+		stats, err = merger.MergeState(state)
+	} else {
+		stats, err = timeMerge(state, e.provider.ApplyState)
+	}
+	total.Duration += stats.Duration
+	total.Compared += stats.Compared
+	total.Changed += stats.Changed
+	total.Tombstones += stats.Tombstones
+	return err
+}
+
+// recordMerge adds the merge of a state received from a peer to the
+// metrics, logging it if it was slow
+func (e *SyncEngine) recordMerge(from peer.ID, stats crdt.MergeStats) {
+	if !e.merges.record(stats, e.config.SlowMerge) {
+		return
+	}
+	e.logger.Infof("slow merge of state from %s: %s (%d entries compared, %d changed, %d tombstones)",
+		from.String()[:8], stats.Duration.Round(time.Millisecond), stats.Compared, stats.Changed, stats.Tombstones)
+}
+
+// timeMerge merges state with apply, timing it. Changed is not known.
+func timeMerge(state crdt.ReplicaState, apply func(crdt.ReplicaState) error) (crdt.MergeStats, error) {
+	started := time.Now()
+	stats := crdt.NewMergeStats(state)
+	err := apply(state)
+	stats.Duration = time.Since(started)
+	return stats, err
+}
@@ -0,0 +1,102 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	gosync "sync"
+	"testing"
+	"time"
+
+	"github.com/amaydixit11/acorde/internal/core"
+	"github.com/amaydixit11/acorde/internal/crdt"
+)
+
+// slowMerger is a StateMerger taking at least delay per merge
+type slowMerger struct {
+	*mockStateProvider
+	delay time.Duration
+}
+
+func (p slowMerger) MergeState(state crdt.ReplicaState) (crdt.MergeStats, error) {
+	return timeMerge(state, func(state crdt.ReplicaState) error {
+		time.Sleep(p.delay)
+		return p.ApplyState(state)
+	})
+}
+
+// lineLogger records the lines logged
+type lineLogger struct {
+	mu    gosync.Mutex
+	lines []string
+}
+
+func (l *lineLogger) Debugf(format string, v ...interface{}) {}
+func (l *lineLogger) Errorf(format string, v ...interface{}) {}
+func (l *lineLogger) Infof(format string, v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func TestMergeMetrics(t *testing.T) {
+	network := NewMemoryNetwork()
+	provider1 := newMockProvider()
+	provider2 := slowMerger{newMockProvider(), 30 * time.Millisecond}
+	id1, id2 := newPeerID(t), newPeerID(t)
+
+	cfg := DefaultConfig()
+	cfg.EnableMDNS = false
+	svc1, err := NewService(provider1, network.Transport(id1), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := &lineLogger{}
+	cfg.Logger = logger
+	cfg.SlowMerge = 10 * time.Millisecond
+	svc2, err := NewService(provider2, network.Transport(id2), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, svc := range []SyncService{svc1, svc2} {
+		if err := svc.Start(ctx); err != nil {
+			t.Fatal(err)
+		}
+		defer svc.Stop()
+	}
+
+	provider1.replica.AddEntry(core.Note, []byte("kept"), nil)
+	gone := provider1.replica.AddEntry(core.Note, []byte("gone"), nil)
+	if err := provider1.replica.DeleteEntry(gone.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// svc1 answers with its state, which svc2 merges
+	if err := svc2.SyncWith(ctx, id1); err != nil {
+		t.Fatal(err)
+	}
+	m := svc2.Metrics().Merges
+	if m.Merges != 1 || m.Compared != 2 || m.Tombstones != 1 || m.SlowMerges != 1 {
+		t.Errorf("unexpected merge metrics %+v", m)
+	}
+	if m.Duration < 30*time.Millisecond || m.MaxDuration != m.Duration {
+		t.Errorf("expected the merge to be timed, got %+v", m)
+	}
+
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	var logged bool
+	for _, line := range logger.lines {
+		logged = logged || strings.HasPrefix(line, "slow merge of state from "+id1.String()[:8])
+	}
+	if !logged {
+		t.Errorf("expected the slow merge to be logged, got %q", logger.lines)
+	}
+
+	if m := svc1.Metrics().Merges; m.Merges != 0 {
+		t.Errorf("expected no merges on svc1, got %+v", m)
+	}
+}
@@ -0,0 +1,83 @@
+package sync
+
+import (
+	"slices"
+
+	"github.com/amaydixit11/acorde/internal/core"
+	"github.com/amaydixit11/acorde/internal/crdt"
+	"github.com/google/uuid"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// namespaceProvider limits a StateProvider to some namespaces (see
+// Config.Namespaces): peers get only their part of our state, and the
+// rest of theirs is dropped before merging (see incoming)
+type namespaceProvider struct {
+	StateProvider
+	namespaces []string
+}
+
+// GetState returns the namespaces' part of the state
+func (p namespaceProvider) GetState() crdt.ReplicaState {
+	return p.StateProvider.GetState().InNamespaces(p.namespaces)
+}
+
+// ApplyState merges the namespaces' part of a remote state
+func (p namespaceProvider) ApplyState(state crdt.ReplicaState) error {
+	return p.StateProvider.ApplyState(p.incoming(state))
+}
+
+// MergeState is ApplyState returning the merge's stats
+func (p namespaceProvider) MergeState(state crdt.ReplicaState) (crdt.MergeStats, error) {
+	state = p.incoming(state)
+	if merger, ok := p.StateProvider.(StateMerger); ok {
+		return merger.MergeState(state)
+	}
+	return timeMerge(state, p.StateProvider.ApplyState)
+}
+
+// MergeStateFrom is MergeState for state sent by the peer from
+func (p namespaceProvider) MergeStateFrom(from peer.ID, state crdt.ReplicaState) (crdt.MergeStats, error) {
+	if merger, ok := p.StateProvider.(PeerStateMerger); ok {
+		return merger.MergeStateFrom(from, p.incoming(state))
+	}
+	return p.MergeState(state)
+}
+
+// incoming returns the part of a remote state to merge: the namespaces'
+// elements, less those of entries held locally in another namespace, which
+// a peer could otherwise overwrite or move into the namespaces
+func (p namespaceProvider) incoming(state crdt.ReplicaState) crdt.ReplicaState {
+	state = state.InNamespaces(p.namespaces)
+	if len(state.Entries) == 0 {
+		return state
+	}
+
+	outside := make(map[uuid.UUID]bool)
+	for _, elem := range p.StateProvider.GetState().Entries {
+		if !slices.Contains(p.namespaces, elem.Entry.Namespace) {
+			outside[elem.Entry.ID] = true
+		}
+	}
+	if len(outside) == 0 {
+		return state
+	}
+
+	state.Entries = slices.DeleteFunc(state.Entries, func(elem crdt.LWWElement) bool {
+		return outside[elem.Entry.ID]
+	})
+	for id := range outside {
+		delete(state.Tags, id)
+		delete(state.ACLs, id)
+	}
+	state.Acks = slices.DeleteFunc(state.Acks, func(ack core.Ack) bool {
+		return outside[ack.EntryID]
+	})
+	return state
+}
+
+// StateHash hashes the namespaces' part of the state, so peers limited
+// to the same namespaces see equal hashes once in sync
+func (p namespaceProvider) StateHash() []byte {
+	return ComputeStateHash(p.GetState())
+}
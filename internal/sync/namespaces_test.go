@@ -0,0 +1,104 @@
+package sync
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/amaydixit11/acorde/internal/core"
+	"github.com/google/uuid"
+)
+
+func TestSyncNamespaces(t *testing.T) {
+	network := NewMemoryNetwork()
+	provider1, provider2 := newMockProvider(), newMockProvider()
+	id1, id2 := newPeerID(t), newPeerID(t)
+
+	cfg := DefaultConfig()
+	cfg.EnableMDNS = false
+	svc1, err := NewService(provider1, network.Transport(id1), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Namespaces = []string{"team"}
+	svc2, err := NewService(provider2, network.Transport(id2), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, svc := range []SyncService{svc1, svc2} {
+		if err := svc.Start(ctx); err != nil {
+			t.Fatal(err)
+		}
+		defer svc.Stop()
+	}
+
+	shared := provider1.replica.AddEntryNamespaced(uuid.New(), "team", core.Note, []byte("shared"), []string{"a"}, 0, 0)
+	provider1.replica.AddEntry(core.Note, []byte("private"), nil)
+	mine := provider2.replica.AddEntryNamespaced(uuid.New(), "team", core.Note, []byte("mine"), nil, 0, 0)
+	provider2.replica.AddEntry(core.Note, []byte("kept"), nil)
+
+	if err := svc2.SyncWith(ctx, id1); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc1.SyncWith(ctx, id2); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := provider2.replica.ListEntries()
+	if len(entries) != 3 {
+		t.Fatalf("expected the team entry and node 2's own, got %+v", entries)
+	}
+	if got, err := provider2.replica.GetEntry(shared.ID); err != nil || got.Namespace != "team" || len(got.Tags) != 1 {
+		t.Errorf("expected the team entry with its tags, got %+v, %v", got, err)
+	}
+	entries = provider1.replica.ListEntries()
+	if len(entries) != 3 {
+		t.Fatalf("expected node 2's team entry only, got %d entries", len(entries))
+	}
+	if _, err := provider1.replica.GetEntry(mine.ID); err != nil {
+		t.Errorf("expected node 2's team entry, got %v", err)
+	}
+
+	// Tombstones keep the entry's namespace, so deletions sync too
+	if err := provider1.replica.DeleteEntry(shared.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc2.SyncWith(ctx, id1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider2.replica.GetEntry(shared.ID); err == nil {
+		t.Error("expected the deletion of the team entry to sync")
+	}
+}
+
+func TestSyncNamespacesKeepOtherEntries(t *testing.T) {
+	local, remote := newMockProvider(), newMockProvider()
+	p := namespaceProvider{local, []string{"team"}}
+
+	// A peer sends an entry we hold outside the namespaces as one of them,
+	// written after ours
+	private := local.replica.AddEntryNamespaced(uuid.New(), "private", core.Note, []byte("private"), []string{"p"}, 0, 0)
+	for i := 0; i < 3; i++ {
+		remote.replica.AddEntry(core.Note, []byte("tick"), nil)
+	}
+	remote.replica.AddEntryNamespaced(private.ID, "team", core.Note, []byte("moved"), []string{"t"}, 0, 0)
+	shared := remote.replica.AddEntryNamespaced(uuid.New(), "team", core.Note, []byte("shared"), nil, 0, 0)
+
+	if _, err := p.MergeState(remote.GetState()); err != nil {
+		t.Fatal(err)
+	}
+	got, err := local.replica.GetEntry(private.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Namespace != "private" || string(got.Content) != "private" || !slices.Equal(got.Tags, []string{"p"}) {
+		t.Errorf("expected the private entry untouched, got %+v", got)
+	}
+	if _, err := local.replica.GetEntry(shared.ID); err != nil {
+		t.Errorf("expected the team entry merged, got %v", err)
+	}
+}
@@ -2,46 +2,66 @@ package sync
 
 import (
 	"context"
+	"errors"
 	"crypto/sha256"
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"io"
+	"sort"
 	gosync "sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/amaydixit11/acorde/internal/blob"
+	"github.com/amaydixit11/acorde/internal/core"
 	"github.com/amaydixit11/acorde/internal/crdt"
+	"github.com/google/uuid"
 	"github.com/libp2p/go-libp2p"
 	"github.com/libp2p/go-libp2p/core/host"
-	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
-	"github.com/libp2p/go-libp2p/core/protocol"
 	"github.com/libp2p/go-libp2p/p2p/discovery/mdns"
 	"github.com/multiformats/go-multiaddr"
 )
 
-// p2pService implements SyncService using libp2p
+// p2pService implements SyncService on a Transport, libp2p unless
+// created with NewService
 type p2pService struct {
-	host     host.Host
-	provider StateProvider
-	config   Config
-	logger   Logger
+	transport Transport
+	host      host.Host   // libp2p host (nil on other transports)
+	engine    *SyncEngine // Runs the sync protocol
+	config    Config
+	logger    Logger
 
 	allowlist    *Allowlist
+	gater        *allowlistGater // Refuses disallowed peers (nil = no allowlist or not libp2p)
+	invites      *InviteRegistry // Redeemable invites (nil = pairing disabled)
+	grants       *GrantStore     // Key grants (nil = disabled)
 	mdnsService  mdns.Service
-	dhtDiscovery *DHTDiscovery
+	dhtDiscovery *DHTDiscovery // Guarded by powerMu
 	peers        map[peer.ID]struct{}
 	peersMu      gosync.RWMutex
+	connected    map[peer.ID]bool // Peers the transport reported connected
+	connectedMu  gosync.Mutex
+	health       *healthTracker
+	pexed        map[peer.ID]time.Time // Last peer exchange by peer
+	pexMu        gosync.Mutex
+
+	// Power mode (see SetPowerMode); powerCh wakes the sync loop
+	power   PowerMode
+	running bool
+	powerMu gosync.Mutex
+	powerCh chan struct{}
 
 	// Active sync sessions to prevent duplicates
 	activeSyncs   map[string]struct{}
 	activeSyncsMu gosync.Mutex
 
 	// Metrics
-	syncAttempts  int64
-	syncSuccesses int64
-	syncFailures  int64
+	blobsFetched int64
+	blobChunks   int64
+
+	fetchingBlobs atomic.Bool // A fetchWantedBlobs round is running
 
 	ctx    context.Context
 	cancel context.CancelFunc
@@ -65,6 +85,11 @@ func NewP2PService(provider StateProvider, cfg Config) (SyncService, error) {
 		listenAddrs[i] = ma
 	}
 
+	s, err := newService(provider, cfg)
+	if err != nil {
+		return nil, err
+	}
+
 	opts := []libp2p.Option{
 		libp2p.ListenAddrs(listenAddrs...),
 	}
@@ -72,17 +97,58 @@ func NewP2PService(provider StateProvider, cfg Config) (SyncService, error) {
 		opts = append(opts, libp2p.Identity(cfg.PrivateKey))
 	}
 
+	// Refuse peers the allowlist rejects before they connect
+	if s.allowlist != nil {
+		s.gater = newAllowlistGater(s.allowlist, s.invites)
+		opts = append(opts, libp2p.ConnectionGater(s.gater))
+	}
+
 	// Create libp2p host
 	h, err := libp2p.New(opts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create libp2p host: %w", err)
 	}
+	s.host = h
+	s.transport = NewLibp2pTransport(h)
+	return s, nil
+}
+
+// NewService creates a sync service on any transport, such as a
+// MemoryNetwork's. Discovery needs libp2p, so EnableMDNS and EnableDHT
+// must be off: peers are added with ConnectPeer or Pair. ListenAddrs and
+// PrivateKey are the transport's business and are ignored.
+func NewService(provider StateProvider, transport Transport, cfg Config) (SyncService, error) {
+	if cfg.EnableMDNS || cfg.EnableDHT {
+		return nil, errors.New("mDNS and DHT discovery need the libp2p transport")
+	}
+	s, err := newService(provider, cfg)
+	if err != nil {
+		return nil, err
+	}
+	s.transport = transport
+	return s, nil
+}
 
+// newService sets up a service from cfg, without its transport
+func newService(provider StateProvider, cfg Config) (*p2pService, error) {
 	logger := cfg.Logger
 	if logger == nil {
 		logger = noopLogger{}
+		cfg.Logger = logger
 	}
 
+	power, err := ParsePowerMode(string(cfg.PowerMode))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.BlobChunkSize <= 0 {
+		cfg.BlobChunkSize = blob.DefaultChunkSize
+	}
+	if cfg.LowPowerInterval <= 0 {
+		cfg.LowPowerInterval = DefaultLowPowerInterval
+	}
+	engine := NewSyncEngine(provider, cfg)
+	cfg.StateBudget = engine.config.StateBudget
 
 	var allowlist *Allowlist
 	if cfg.AllowlistPath != "" {
@@ -91,17 +157,32 @@ func NewP2PService(provider StateProvider, cfg Config) (SyncService, error) {
 			return nil, fmt.Errorf("failed to load allowlist: %w", err)
 		}
 		allowlist = al
-		allowlist = al
 		logger.Infof("Allowlist enabled (strict=%v): %d peers loaded", cfg.StrictAllowlist, al.Count())
 	}
 
+	var invites *InviteRegistry
+	if cfg.InvitesPath != "" {
+		invites = NewInviteRegistry(cfg.InvitesPath)
+	}
+
+	var grants *GrantStore
+	if cfg.GrantsPath != "" && cfg.DeviceKey != nil {
+		grants = NewGrantStore(cfg.GrantsPath)
+	}
+
 	return &p2pService{
-		host:        h,
-		provider:    provider,
+		engine:      engine,
 		config:      cfg,
 		logger:      logger,
 		allowlist:   allowlist,
+		invites:     invites,
+		grants:      grants,
 		peers:       make(map[peer.ID]struct{}),
+		connected:   make(map[peer.ID]bool),
+		health:      newHealthTracker(cfg),
+		pexed:       make(map[peer.ID]time.Time),
+		power:       power,
+		powerCh:     make(chan struct{}, 1),
 		activeSyncs: make(map[string]struct{}),
 	}, nil
 }
@@ -110,8 +191,21 @@ func NewP2PService(provider StateProvider, cfg Config) (SyncService, error) {
 func (s *p2pService) Start(ctx context.Context) error {
 	s.ctx, s.cancel = context.WithCancel(ctx)
 
-	// Register protocol handler
-	s.host.SetStreamHandler(protocol.ID(ProtocolID), s.handleStream)
+	// Register protocol handlers
+	s.transport.Notify(s.connectionChanged)
+	s.transport.Handle(ProtocolID, s.handleStream)
+	if s.invites != nil {
+		s.transport.Handle(PairProtocolID, s.handlePairStream)
+	}
+	if s.grants != nil {
+		s.transport.Handle(RekeyProtocolID, s.handleRekeyStream)
+	}
+	if s.config.Blobs != nil {
+		s.transport.Handle(BlobProtocolID, s.handleBlobStream)
+	}
+	if s.pexEnabled() {
+		s.transport.Handle(PEXProtocolID, s.handlePEXStream)
+	}
 
 	// Start mDNS discovery
 	if s.config.EnableMDNS {
@@ -136,26 +230,22 @@ func (s *p2pService) Start(ctx context.Context) error {
 		s.logger.Infof("mDNS discovery enabled")
 	}
 
-	// Start DHT discovery
-	if s.config.EnableDHT {
-		bootstrapPeers := GetDefaultBootstrapPeers()
-		dhtDiscovery, err := NewDHTDiscovery(s.host, bootstrapPeers, s.logger)
-		if err != nil {
-			return fmt.Errorf("failed to create DHT: %w", err)
-		}
-		if err := dhtDiscovery.Start(s.HandlePeerFound); err != nil {
-			return fmt.Errorf("failed to start DHT: %w", err)
+	// Start DHT discovery, unless saving power
+	s.powerMu.Lock()
+	s.running = true
+	if s.config.EnableDHT && s.power != PowerLow {
+		if err := s.startDHT(); err != nil {
+			s.powerMu.Unlock()
+			return err
 		}
-		s.dhtDiscovery = dhtDiscovery
-		s.dhtDiscovery = dhtDiscovery
-		s.logger.Infof("DHT discovery enabled (global)")
 	}
+	s.powerMu.Unlock()
 
 	// Start periodic sync
 	s.wg.Add(1)
 	go s.syncLoop()
 
-	s.logger.Infof("sync service started, listening on %v", s.host.Addrs())
+	s.logger.Infof("sync service started, listening on %v", s.transport.Addrs())
 	return nil
 }
 
@@ -170,11 +260,12 @@ func (s *p2pService) Stop() error {
 		s.mdnsService.Close()
 	}
 
-	if s.dhtDiscovery != nil {
-		s.dhtDiscovery.Stop()
-	}
+	s.powerMu.Lock()
+	s.running = false
+	s.stopDHT()
+	s.powerMu.Unlock()
 
-	return s.host.Close()
+	return s.transport.Close()
 }
 
 // Peers returns the list of connected peers
@@ -191,14 +282,26 @@ func (s *p2pService) Peers() []peer.ID {
 
 // Metrics returns sync statistics
 func (s *p2pService) Metrics() SyncMetrics {
-	return SyncMetrics{
-		SyncAttempts:  atomic.LoadInt64(&s.syncAttempts),
-		SyncSuccesses: atomic.LoadInt64(&s.syncSuccesses),
-		SyncFailures:  atomic.LoadInt64(&s.syncFailures),
-	}
+	m := s.engine.Metrics()
+	m.BlobsFetched = atomic.LoadInt64(&s.blobsFetched)
+	m.BlobChunksFetched = atomic.LoadInt64(&s.blobChunks)
+	m.GatedDials = s.gater.dials()
+	m.GatedAccepts = s.gater.accepts()
+	return m
+}
+
+// PeerHealth returns the sync record of every peer synced with
+func (s *p2pService) PeerHealth() []PeerHealth {
+	return s.health.list()
 }
 
-// GetHost returns the underlying libp2p host
+// Sessions returns the recorded sync sessions, oldest first, or nil
+// unless Config.SessionLog is set
+func (s *p2pService) Sessions() []Session {
+	return s.engine.Sessions()
+}
+
+// GetHost returns the underlying libp2p host, or nil on other transports
 func (s *p2pService) GetHost() host.Host {
 	return s.host
 }
@@ -217,25 +320,20 @@ func (s *p2pService) ConnectPeer(invite *PeerInvite) error {
 		}
 	}
 
-	// Parse addresses
-	peerInfo := peer.AddrInfo{ID: peerID}
-	for _, addrStr := range invite.Addresses {
-		ma, err := multiaddr.NewMultiaddr(addrStr)
-		if err != nil {
-			continue
-		}
-		peerInfo.Addrs = append(peerInfo.Addrs, ma)
-	}
+	// Pairing again gives a failing peer a fresh start
+	s.health.reset(peerID)
 
-	if len(peerInfo.Addrs) == 0 {
-		return fmt.Errorf("no valid addresses in invite")
+	// Parse addresses
+	peerInfo, err := invite.addrInfo()
+	if err != nil {
+		return err
 	}
 
 	// Connect
 	ctx, cancel := context.WithTimeout(s.ctx, 10*time.Second)
 	defer cancel()
 
-	if err := s.host.Connect(ctx, peerInfo); err != nil {
+	if err := s.transport.Connect(ctx, peerInfo); err != nil {
 		return fmt.Errorf("failed to connect to peer: %w", err)
 	}
 
@@ -254,15 +352,14 @@ func (s *p2pService) checkAllowlist(p peer.ID) bool {
 }
 
 // SyncWith triggers a sync with a specific peer
-func (s *p2pService) SyncWith(parentCtx context.Context, peerID peer.ID) error {
+func (s *p2pService) SyncWith(parentCtx context.Context, peerID peer.ID) (err error) {
 	// 1. Enforce timeout to prevent memory leaks in activeSyncs
 	ctx, cancel := context.WithTimeout(parentCtx, 2*time.Minute)
 	defer cancel()
 
-	atomic.AddInt64(&s.syncAttempts, 1)
-
-	// Generate session ID
-	sessionID := GenerateSessionID()
+	if !s.checkAllowlist(peerID) {
+		return fmt.Errorf("peer %s is not allowed", peerID)
+	}
 
 	// Check for active sync with this peer
 	// Session ID prevents duplicate syncs
@@ -325,85 +422,27 @@ func (s *p2pService) SyncWith(parentCtx context.Context, peerID peer.ID) error {
 		delete(s.activeSyncs, peerID.String())
 		s.activeSyncsMu.Unlock()
 	}()
+	defer func() { s.health.record(peerID, err, time.Now()) }()
 
-	// Open stream to peer
-	stream, err := s.host.NewStream(ctx, peerID, protocol.ID(ProtocolID))
-	if err != nil {
-		atomic.AddInt64(&s.syncFailures, 1)
-		return fmt.Errorf("failed to open stream: %w", err)
-	}
-	defer stream.Close()
-
-	// Set deadline
-	stream.SetDeadline(time.Now().Add(30 * time.Second))
-
-	// Send our state hash with session ID
-	hash := s.provider.StateHash()
-	msg := &Message{
-		Type:      MsgStateHash,
-		SessionID: sessionID,
-		StateHash: hash,
-	}
-
-	if err := writeMessage(stream, msg); err != nil {
-		atomic.AddInt64(&s.syncFailures, 1)
-		return fmt.Errorf("failed to send state hash: %w", err)
+	if err := s.engine.SyncWith(ctx, s.transport, peerID); err != nil {
+		return err
 	}
-
-	// Read response
-	resp, err := readMessage(stream)
-	if err != nil {
-		atomic.AddInt64(&s.syncFailures, 1)
-		return fmt.Errorf("failed to read response: %w", err)
-	}
-
-	// Handle response
-	switch resp.Type {
-	case MsgStateHash:
-		// Hashes match, nothing to do
-		atomic.AddInt64(&s.syncSuccesses, 1)
-		return nil
-
-	case MsgState:
-		// Apply remote state
-		var state crdt.ReplicaState
-		if err := json.Unmarshal(resp.State, &state); err != nil {
-			atomic.AddInt64(&s.syncFailures, 1)
-			return fmt.Errorf("failed to decode state: %w", err)
-		}
-		if err := s.provider.ApplyState(state); err != nil {
-			atomic.AddInt64(&s.syncFailures, 1)
-			return err
-		}
-		atomic.AddInt64(&s.syncSuccesses, 1)
-		s.logger.Infof("synced with peer %s (received %d bytes)", peerID.String()[:8], len(resp.State))
-		return nil
-
-	case MsgStateRequest:
-		// They want our state - send it
-		state := s.provider.GetState()
-		stateData, _ := json.Marshal(state)
-		stateMsg := &Message{
-			Type:      MsgState,
-			SessionID: sessionID,
-			State:     stateData,
-		}
-		if err := writeMessage(stream, stateMsg); err != nil {
-			atomic.AddInt64(&s.syncFailures, 1)
-			return fmt.Errorf("failed to send state: %w", err)
+	if s.pexEnabled() && s.pexTrusted(peerID) && s.pexDue(peerID, time.Now()) {
+		if err := s.exchangePeers(ctx, peerID); err != nil {
+			s.logger.Errorf("peer exchange with %s failed: %v", peerID.String()[:8], err)
 		}
-		atomic.AddInt64(&s.syncSuccesses, 1)
-		return nil
 	}
-
-	atomic.AddInt64(&s.syncSuccesses, 1)
 	return nil
 }
 
 // HandlePeerFound is called by mDNS when a peer is discovered
 func (s *p2pService) HandlePeerFound(pi peer.AddrInfo) {
 	// Skip self
-	if pi.ID == s.host.ID() {
+	if pi.ID == s.transport.ID() {
+		return
+	}
+	// Skip revoked devices
+	if s.allowlist != nil && s.allowlist.IsRevoked(pi.ID) {
 		return
 	}
 
@@ -418,7 +457,7 @@ func (s *p2pService) HandlePeerFound(pi peer.AddrInfo) {
 	}
 
 	// Connect to peer
-	if err := s.host.Connect(s.ctx, pi); err != nil {
+	if err := s.transport.Connect(s.ctx, pi); err != nil {
 		// Connection failed, remove from peers
 		s.peersMu.Lock()
 		delete(s.peers, pi.ID)
@@ -426,7 +465,11 @@ func (s *p2pService) HandlePeerFound(pi peer.AddrInfo) {
 		return
 	}
 
-	// Trigger sync
+	// Trigger sync, unless the peer is backing off after failures or
+	// saving power (it is synced with the next batch)
+	if !s.health.due(pi.ID, time.Now()) || s.PowerMode() == PowerLow {
+		return
+	}
 	go func() {
 		s.logger.Debugf("starting sync with new peer %s", pi.ID.String()[:8])
 		if err := s.SyncWith(s.ctx, pi.ID); err != nil {
@@ -436,78 +479,15 @@ func (s *p2pService) HandlePeerFound(pi peer.AddrInfo) {
 }
 
 // handleStream handles incoming sync requests
-func (s *p2pService) handleStream(stream network.Stream) {
-	defer stream.Close()
-
-	// Set deadline
-	stream.SetDeadline(time.Now().Add(30 * time.Second))
-
+func (s *p2pService) handleStream(stream Stream) {
 	// Check allowlist if enabled
-	if !s.checkAllowlist(stream.Conn().RemotePeer()) {
-		s.logger.Errorf("rejected connection from unauthorized peer %s", stream.Conn().RemotePeer())
-		return
-	}
-	s.logger.Debugf("handling stream from %s", stream.Conn().RemotePeer().String()[:8])
-
-	// Read incoming message
-	msg, err := readMessage(stream)
-	if err != nil {
+	if !s.checkAllowlist(stream.RemotePeer()) {
+		s.logger.Errorf("rejected connection from unauthorized peer %s", stream.RemotePeer())
+		stream.Close()
 		return
 	}
-
-	var resp *Message
-
-	switch msg.Type {
-	case MsgStateHash:
-		// Compare hashes
-		ourHash := s.provider.StateHash()
-		theirHash := msg.StateHash
-
-		if string(ourHash) == string(theirHash) {
-			// States identical - respond with our hash as acknowledgement
-			resp = &Message{
-				Type:      MsgStateHash,
-				SessionID: msg.SessionID,
-				StateHash: ourHash,
-			}
-			// Hashes differ - send our full state
-			
-			// CRDT merge will combine both states correctly
-			state := s.provider.GetState()
-			stateData, _ := json.Marshal(state)
-			resp = &Message{
-				Type:      MsgState,
-				SessionID: msg.SessionID,
-				State:     stateData,
-			}
-		}
-
-	case MsgStateRequest:
-		// Send full state
-		state := s.provider.GetState()
-		stateData, _ := json.Marshal(state)
-		resp = &Message{
-			Type:      MsgState,
-			SessionID: msg.SessionID,
-			State:     stateData,
-		}
-
-	case MsgState:
-		// Apply incoming state
-		var state crdt.ReplicaState
-		if err := json.Unmarshal(msg.State, &state); err == nil {
-			s.provider.ApplyState(state)
-		}
-		resp = &Message{
-			Type:      MsgStateHash,
-			SessionID: msg.SessionID,
-			StateHash: s.provider.StateHash(),
-		}
-	}
-
-	if resp != nil {
-		writeMessage(stream, resp)
-	}
+	s.logger.Debugf("handling stream from %s", stream.RemotePeer().String()[:8])
+	s.engine.Serve(s.ctx, stream)
 }
 
 // shouldSendState determines which peer should send state (deterministic tie-breaker)
@@ -528,15 +508,20 @@ func shouldSendState(ourHash, theirHash []byte) bool {
 func (s *p2pService) syncLoop() {
 	defer s.wg.Done()
 
-	ticker := time.NewTicker(s.config.SyncInterval)
+	ticker := time.NewTicker(s.syncInterval())
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-s.ctx.Done():
 			return
-		case <-ticker.C:
+		case <-s.powerCh:
+			ticker.Reset(s.syncInterval())
+		case now := <-ticker.C:
 			for _, peerID := range s.Peers() {
+				if !s.health.due(peerID, now) {
+					continue // Backing off or quarantined
+				}
 				peerID := peerID // Capture for goroutine
 				go func() {
 					s.logger.Debugf("periodic sync executing for %s", peerID.String()[:8])
@@ -545,10 +530,22 @@ func (s *p2pService) syncLoop() {
 					}
 				}()
 			}
+			if s.grants != nil {
+				go s.deliverGrants()
+			}
+			if s.config.Blobs != nil && s.config.WantBlobs != nil {
+				go s.fetchWantedBlobs()
+			}
+			if err := s.health.maybeSave(now); err != nil {
+				s.logger.Errorf("failed to save peer health: %v", err)
+			}
 		}
 	}
 }
 
+// maxMessageSize bounds sync messages (see MaxStateBudget)
+const maxMessageSize = 10 * 1024 * 1024
+
 // writeMessage writes a length-prefixed message to the stream
 func writeMessage(w io.Writer, msg *Message) error {
 	data, err := msg.Encode()
@@ -576,7 +573,7 @@ func readMessage(r io.Reader) (*Message, error) {
 	}
 
 	// Sanity check
-	if length > 10*1024*1024 { // 10MB max
+	if length > maxMessageSize {
 		return nil, fmt.Errorf("message too large: %d bytes", length)
 	}
 
@@ -589,9 +586,48 @@ func readMessage(r io.Reader) (*Message, error) {
 	return DecodeMessage(data)
 }
 
-// ComputeStateHash computes a hash of the replica state
+// ComputeStateHash computes a hash of the replica state. Slices built
+// from map iteration are sorted first, so equal states hash equally.
 func ComputeStateHash(state crdt.ReplicaState) []byte {
-	data, _ := json.Marshal(state)
+	data, _ := json.Marshal(canonicalState(state))
 	hash := sha256.Sum256(data)
 	return hash[:]
 }
+
+// canonicalState returns a copy of state with entries, tag tokens and
+// acks in a fixed order
+func canonicalState(state crdt.ReplicaState) crdt.ReplicaState {
+	entries := append([]crdt.LWWElement(nil), state.Entries...)
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Entry.ID.String() < entries[j].Entry.ID.String()
+	})
+	state.Entries = entries
+
+	tags := make(map[uuid.UUID]crdt.TagSetState, len(state.Tags))
+	for id, set := range state.Tags {
+		tags[id] = crdt.TagSetState{Adds: sortedTokens(set.Adds), Removes: sortedTokens(set.Removes)}
+	}
+	state.Tags = tags
+
+	acks := append([]core.Ack(nil), state.Acks...)
+	sort.Slice(acks, func(i, j int) bool {
+		if acks[i].EntryID != acks[j].EntryID {
+			return acks[i].EntryID.String() < acks[j].EntryID.String()
+		}
+		return acks[i].Peer < acks[j].Peer
+	})
+	state.Acks = acks
+	return state
+}
+
+// sortedTokens returns a sorted copy of tokens
+func sortedTokens(tokens []crdt.TagToken) []crdt.TagToken {
+	sorted := append([]crdt.TagToken(nil), tokens...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Tag != sorted[j].Tag {
+			return sorted[i].Tag < sorted[j].Tag
+		}
+		return sorted[i].Token.String() < sorted[j].Token.String()
+	})
+	return sorted
+}
@@ -1,10 +1,13 @@
 package sync
 
 import (
+	"bytes"
 	"context"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/amaydixit11/acorde/internal/blob"
 	"github.com/amaydixit11/acorde/internal/core"
 	"github.com/amaydixit11/acorde/internal/crdt"
 )
@@ -124,3 +127,203 @@ func TestP2PSyncBetweenPeers(t *testing.T) {
 		t.Errorf("expected 'from peer 1', got '%s'", string(entries[0].Content))
 	}
 }
+
+func TestLowPowerBatchesSyncs(t *testing.T) {
+	provider1 := newMockProvider()
+	provider2 := newMockProvider()
+
+	cfg := DefaultConfig()
+	cfg.EnableMDNS = false
+	cfg.SyncInterval = 50 * time.Millisecond
+	svc1, err := NewP2PService(provider1, cfg)
+	if err != nil {
+		t.Fatalf("failed to create svc1: %v", err)
+	}
+	cfg.PowerMode = PowerLow
+	cfg.LowPowerInterval = time.Hour
+	svc2, err := NewP2PService(provider2, cfg)
+	if err != nil {
+		t.Fatalf("failed to create svc2: %v", err)
+	}
+	if err := svc2.SetPowerMode("turbo"); err == nil {
+		t.Error("expected an error for an unknown power mode")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := svc1.Start(ctx); err != nil {
+		t.Fatalf("failed to start svc1: %v", err)
+	}
+	defer svc1.Stop()
+	if err := svc2.Start(ctx); err != nil {
+		t.Fatalf("failed to start svc2: %v", err)
+	}
+	defer svc2.Stop()
+
+	provider1.replica.AddEntry(core.Note, []byte("from peer 1"), []string{"test"})
+
+	// A peer found in low power mode waits for the next batch
+	p2p1 := svc1.(*p2pService)
+	svc2.(*p2pService).HandlePeerFound(p2p1.host.Peerstore().PeerInfo(p2p1.host.ID()))
+	time.Sleep(200 * time.Millisecond)
+	if attempts := svc2.Metrics().SyncAttempts; attempts != 0 {
+		t.Fatalf("expected no syncs in low power mode, got %d", attempts)
+	}
+
+	// Back to normal, it is synced every SyncInterval
+	if err := svc2.SetPowerMode(PowerNormal); err != nil {
+		t.Fatal(err)
+	}
+	if svc2.PowerMode() != PowerNormal {
+		t.Errorf("PowerMode() = %s, want normal", svc2.PowerMode())
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(provider2.replica.ListEntries()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("peer was not synced after leaving low power mode")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestFetchBlobResumes(t *testing.T) {
+	store1, err := blob.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	store2, err := blob.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := bytes.Repeat([]byte("attachment data "), 1000) // 16000 bytes
+	cid, err := store1.PutWithSubdir(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := DefaultConfig()
+	cfg.EnableMDNS = false
+	cfg.BlobChunkSize = 1024
+	cfg.Blobs = store1
+	svc1, err := NewP2PService(newMockProvider(), cfg)
+	if err != nil {
+		t.Fatalf("failed to create svc1: %v", err)
+	}
+	cfg.Blobs = store2
+	svc2, err := NewP2PService(newMockProvider(), cfg)
+	if err != nil {
+		t.Fatalf("failed to create svc2: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := svc1.Start(ctx); err != nil {
+		t.Fatalf("failed to start svc1: %v", err)
+	}
+	defer svc1.Stop()
+	if err := svc2.Start(ctx); err != nil {
+		t.Fatalf("failed to start svc2: %v", err)
+	}
+	defer svc2.Stop()
+
+	p2p1 := svc1.(*p2pService)
+	if err := svc2.(*p2pService).host.Connect(ctx, p2p1.host.Peerstore().PeerInfo(p2p1.host.ID())); err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+
+	// An interrupted transfer: the first 10 of 16 chunks arrived
+	m, err := store1.Manifest(cid, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store2.StartDownload(m); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := store2.PutChunk(cid, i, data[i*1024:(i+1)*1024]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := svc2.FetchBlob(ctx, p2p1.host.ID(), cid); err != nil {
+		t.Fatalf("FetchBlob failed: %v", err)
+	}
+	got, err := store2.Get(cid)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("fetched blob does not match (err %v)", err)
+	}
+	if m := svc2.Metrics(); m.BlobsFetched != 1 || m.BlobChunksFetched != 6 {
+		t.Errorf("fetched %d blobs in %d chunks, want 1 in 6", m.BlobsFetched, m.BlobChunksFetched)
+	}
+
+	// Stored blobs are not fetched again
+	if err := svc2.FetchBlob(ctx, p2p1.host.ID(), cid); err != nil {
+		t.Fatal(err)
+	}
+	if m := svc2.Metrics(); m.BlobChunksFetched != 6 {
+		t.Errorf("refetched a stored blob: %d chunks", m.BlobChunksFetched)
+	}
+
+	// Unknown blobs fail with the peer's error
+	if err := svc2.FetchBlob(ctx, p2p1.host.ID(), blob.CID(strings.Repeat("0", 64))); err == nil {
+		t.Error("expected an error for a blob the peer lacks")
+	}
+}
+
+func TestStreamedStateSync(t *testing.T) {
+	big, small := newMockProvider(), newMockProvider()
+	for i := 0; i < 40; i++ {
+		content := []byte(strings.Repeat("x", 200))
+		big.replica.AddEntry(core.Note, content, []string{"bulk"})
+	}
+
+	cfg := DefaultConfig()
+	cfg.EnableMDNS = false
+	server, err := NewP2PService(big, cfg)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	cfg.StateBudget = 2048
+	cfg.SessionLog = -1
+	client, err := NewP2PService(small, cfg)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, s := range []SyncService{server, client} {
+		if err := s.Start(ctx); err != nil {
+			t.Fatalf("failed to start: %v", err)
+		}
+		defer s.Stop()
+	}
+	host := server.(*p2pService).host
+	if err := client.(*p2pService).host.Connect(ctx, host.Peerstore().PeerInfo(host.ID())); err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+
+	if err := client.SyncWith(ctx, host.ID()); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	if got := len(small.replica.ListEntries()); got != 40 {
+		t.Fatalf("expected 40 entries, got %d", got)
+	}
+	if !bytes.Equal(big.StateHash(), small.StateHash()) {
+		t.Error("expected states to converge")
+	}
+
+	// The state arrived in chunks within the client's budget
+	chunks := 0
+	for _, m := range client.Sessions()[0].Messages {
+		if m.Type == "state_chunk" && !m.Sent {
+			chunks++
+			if m.StateSize > cfg.StateBudget {
+				t.Errorf("chunk of %d bytes exceeds the %d byte budget", m.StateSize, cfg.StateBudget)
+			}
+		}
+	}
+	if chunks < 2 {
+		t.Errorf("expected the state in several chunks, got %d", chunks)
+	}
+}
@@ -0,0 +1,430 @@
+package sync
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	gosync "sync"
+	"time"
+
+	vcrypto "github.com/amaydixit11/acorde/pkg/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// MaxPINAttempts is how many wrong PINs revoke an invite
+const MaxPINAttempts = 3
+
+// PINDigits is the length of generated pairing PINs
+const PINDigits = 6
+
+var (
+	ErrInviteNotFound = errors.New("invite not found or already used")
+	ErrInviteExpired  = errors.New("invite expired")
+	ErrPINRequired    = errors.New("invite requires a PIN")
+	ErrPINMismatch    = errors.New("incorrect PIN")
+)
+
+// PendingInvite is the inviter's record of a redeemable invite
+type PendingInvite struct {
+	ID        string `json:"id"`
+	ExpiresAt int64  `json:"expires_at"`
+	OneTime   bool   `json:"one_time"`
+	PIN       string `json:"pin,omitempty"`
+	ShareKey  bool   `json:"share_key"` // Send the vault key after confirmation
+	Attempts  int    `json:"attempts"`  // Failed PIN attempts
+	Redeemed  int    `json:"redeemed"`  // Successful redemptions
+}
+
+// InviteRegistry tracks redeemable invites in <dir>/invites.json. The file
+// is re-read on every operation so invites created by `acorde invite` are
+// seen by a running daemon.
+type InviteRegistry struct {
+	path string
+	mu   gosync.Mutex
+}
+
+// NewInviteRegistry creates a registry stored in dir
+func NewInviteRegistry(dir string) *InviteRegistry {
+	return &InviteRegistry{path: filepath.Join(dir, "invites.json")}
+}
+
+// Add registers an invite
+func (r *InviteRegistry) Add(inv PendingInvite) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	invites, err := r.load()
+	if err != nil {
+		return err
+	}
+	invites[inv.ID] = inv
+	return r.save(invites)
+}
+
+// HasPending reports whether any invite can still be redeemed
+func (r *InviteRegistry) HasPending() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	invites, err := r.load()
+	return err == nil && len(invites) > 0
+}
+
+// Revoke removes an invite
+func (r *InviteRegistry) Revoke(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	invites, err := r.load()
+	if err != nil {
+		return err
+	}
+	delete(invites, id)
+	return r.save(invites)
+}
+
+// Redeem validates a redemption attempt. check is called with the invite
+// and reports whether the joiner proved knowledge of the PIN. Wrong PINs
+// count towards MaxPINAttempts; one-time invites are removed on success.
+func (r *InviteRegistry) Redeem(id string, check func(PendingInvite) bool) (PendingInvite, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	invites, err := r.load()
+	if err != nil {
+		return PendingInvite{}, err
+	}
+
+	inv, ok := invites[id]
+	if !ok {
+		return PendingInvite{}, ErrInviteNotFound
+	}
+	if time.Now().Unix() > inv.ExpiresAt {
+		delete(invites, id)
+		r.save(invites)
+		return PendingInvite{}, ErrInviteExpired
+	}
+
+	if !check(inv) {
+		inv.Attempts++
+		if inv.Attempts >= MaxPINAttempts {
+			delete(invites, id)
+		} else {
+			invites[id] = inv
+		}
+		if err := r.save(invites); err != nil {
+			return PendingInvite{}, err
+		}
+		return PendingInvite{}, ErrPINMismatch
+	}
+
+	inv.Redeemed++
+	if inv.OneTime {
+		delete(invites, id)
+	} else {
+		invites[id] = inv
+	}
+	if err := r.save(invites); err != nil {
+		return PendingInvite{}, err
+	}
+	return inv, nil
+}
+
+// load reads the registry, dropping expired invites
+func (r *InviteRegistry) load() (map[string]PendingInvite, error) {
+	invites := make(map[string]PendingInvite)
+
+	data, err := os.ReadFile(r.path)
+	if os.IsNotExist(err) {
+		return invites, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var list []PendingInvite
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	now := time.Now().Unix()
+	for _, inv := range list {
+		if now <= inv.ExpiresAt {
+			invites[inv.ID] = inv
+		}
+	}
+	return invites, nil
+}
+
+// save writes the registry to disk
+func (r *InviteRegistry) save(invites map[string]PendingInvite) error {
+	if err := os.MkdirAll(filepath.Dir(r.path), 0700); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	list := make([]PendingInvite, 0, len(invites))
+	for _, inv := range invites {
+		list = append(list, inv)
+	}
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(r.path, data, 0600)
+}
+
+// GeneratePIN returns a random numeric PIN of PINDigits digits
+func GeneratePIN() (string, error) {
+	max := big.NewInt(1)
+	for i := 0; i < PINDigits; i++ {
+		max.Mul(max, big.NewInt(10))
+	}
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", PINDigits, n), nil
+}
+
+// pairRequest is sent by the joiner to redeem an invite
+type pairRequest struct {
+	InviteID  string `json:"invite_id"`
+	Proof     []byte `json:"proof,omitempty"`      // pinProof("joiner", ...)
+	DeviceKey []byte `json:"device_key,omitempty"` // Joiner's X25519 public key
+}
+
+// pairResponse is the inviter's answer
+type pairResponse struct {
+	Error     string `json:"error,omitempty"`
+	Confirm   []byte `json:"confirm,omitempty"`    // pinProof("inviter", ...)
+	Key       []byte `json:"key,omitempty"`        // Vault key, after confirmation
+	Epoch     uint32 `json:"epoch,omitempty"`      // Of the vault key
+	DeviceKey []byte `json:"device_key,omitempty"` // Inviter's X25519 public key
+}
+
+// pinProof binds the PIN to both authenticated peer IDs and the invite.
+// Proofs only travel over libp2p's encrypted, mutually authenticated
+// channel, so an attacker holding the invite code must guess the PIN
+// online against the inviter, which revokes the invite after
+// MaxPINAttempts failures.
+func pinProof(pin, role, inviteID string, inviter, joiner peer.ID) []byte {
+	mac := hmac.New(sha256.New, []byte(pin))
+	fmt.Fprintf(mac, "acorde-pair|%s|%s|%s|%s", role, inviteID, inviter, joiner)
+	return mac.Sum(nil)
+}
+
+// handlePairStream redeems an invite for a joining peer
+func (s *p2pService) handlePairStream(stream Stream) {
+	defer stream.Close()
+	stream.SetDeadline(time.Now().Add(30 * time.Second))
+
+	joiner := stream.RemotePeer()
+	var req pairRequest
+	if err := readFrame(stream, &req); err != nil {
+		return
+	}
+
+	inv, err := s.invites.Redeem(req.InviteID, func(inv PendingInvite) bool {
+		if inv.PIN == "" {
+			return true
+		}
+		expected := pinProof(inv.PIN, "joiner", inv.ID, s.transport.ID(), joiner)
+		return hmac.Equal(req.Proof, expected)
+	})
+	if err != nil {
+		s.logger.Errorf("rejected pairing from %s: %v", joiner.String()[:8], err)
+		writeFrame(stream, &pairResponse{Error: err.Error()})
+		return
+	}
+
+	if s.allowlist != nil {
+		if err := s.allowlist.Add(joiner, "", nil); err != nil {
+			writeFrame(stream, &pairResponse{Error: "failed to add peer to allowlist"})
+			return
+		}
+		if len(req.DeviceKey) == 32 {
+			s.allowlist.SetDeviceKey(joiner, req.DeviceKey)
+		}
+	}
+
+	resp := &pairResponse{DeviceKey: s.deviceKey()}
+	if inv.PIN != "" {
+		resp.Confirm = pinProof(inv.PIN, "inviter", inv.ID, s.transport.ID(), joiner)
+	}
+	if inv.ShareKey {
+		resp.Key, resp.Epoch = s.config.VaultKey, s.config.VaultKeyEpoch
+	}
+	writeFrame(stream, resp)
+	s.logger.Infof("paired with %s (invite %s)", joiner.String()[:8], inv.ID[:8])
+}
+
+// Pair redeems an invite and connects to the inviter. Redeemable invites
+// go through the pairing protocol: the PIN is proven in both directions
+// and the vault key is received only after the inviter has confirmed it.
+// It returns the vault key and its epoch, if the inviter shared one. The
+// invite's trust bundle, if any, is imported into the allowlist once
+// paired.
+func (s *p2pService) Pair(ctx context.Context, invite *PeerInvite, pin string) (*vcrypto.EpochKey, error) {
+	if !invite.IsRedeemable() {
+		key, err := vaultKey(invite.Key, invite.KeyEpoch)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.ConnectPeer(invite); err != nil {
+			return key, err
+		}
+		return key, s.importTrust(invite)
+	}
+	if invite.PIN && pin == "" {
+		return nil, ErrPINRequired
+	}
+
+	peerInfo, err := invite.addrInfo()
+	if err != nil {
+		return nil, err
+	}
+	if s.gater != nil {
+		defer s.gater.startPairing(peerInfo.ID)()
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	if err := s.transport.Connect(ctx, peerInfo); err != nil {
+		return nil, fmt.Errorf("failed to connect to peer: %w", err)
+	}
+
+	stream, err := s.transport.Dial(ctx, peerInfo.ID, PairProtocolID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open pairing stream: %w", err)
+	}
+	defer stream.Close()
+	stream.SetDeadline(time.Now().Add(30 * time.Second))
+
+	req := &pairRequest{InviteID: invite.ID, DeviceKey: s.deviceKey()}
+	if invite.PIN {
+		req.Proof = pinProof(pin, "joiner", invite.ID, peerInfo.ID, s.transport.ID())
+	}
+	if err := writeFrame(stream, req); err != nil {
+		return nil, fmt.Errorf("failed to send pairing request: %w", err)
+	}
+
+	var resp pairResponse
+	if err := readFrame(stream, &resp); err != nil {
+		return nil, fmt.Errorf("failed to read pairing response: %w", err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("pairing rejected: %s", resp.Error)
+	}
+	if invite.PIN {
+		expected := pinProof(pin, "inviter", invite.ID, peerInfo.ID, s.transport.ID())
+		if !hmac.Equal(resp.Confirm, expected) {
+			return nil, errors.New("inviter failed PIN confirmation")
+		}
+	}
+
+	key, err := vaultKey(resp.Key, resp.Epoch)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.ConnectPeer(invite); err != nil {
+		return nil, err
+	}
+	if s.allowlist != nil && len(resp.DeviceKey) == 32 {
+		if err := s.allowlist.SetDeviceKey(peerInfo.ID, resp.DeviceKey); err != nil {
+			return nil, fmt.Errorf("failed to record device key: %w", err)
+		}
+	}
+	return key, s.importTrust(invite)
+}
+
+// vaultKey returns a vault key received when pairing (nil if none was)
+func vaultKey(key []byte, epoch uint32) (*vcrypto.EpochKey, error) {
+	if len(key) == 0 {
+		return nil, nil
+	}
+	if len(key) != vcrypto.KeySize {
+		return nil, errors.New("invalid vault key size received")
+	}
+	received := &vcrypto.EpochKey{Epoch: epoch}
+	copy(received.Key[:], key)
+	return received, nil
+}
+
+// importTrust imports the trust bundle of an invite that was paired
+func (s *p2pService) importTrust(invite *PeerInvite) error {
+	if s.allowlist == nil || invite.Trust == nil {
+		return nil
+	}
+	added, err := s.allowlist.ImportTrust(invite.Trust, s.transport.ID())
+	if err != nil {
+		return fmt.Errorf("failed to import trusted peers: %w", err)
+	}
+	s.logger.Infof("trusted %d peers of %s", added, invite.PeerID[:8])
+	return nil
+}
+
+// deviceKey returns this device's X25519 public key, if configured
+func (s *p2pService) deviceKey() []byte {
+	if s.config.DeviceKey == nil {
+		return nil
+	}
+	return s.config.DeviceKey.Public[:]
+}
+
+// addrInfo returns the invite's peer ID and parsed addresses
+func (i *PeerInvite) addrInfo() (peer.AddrInfo, error) {
+	peerID, err := peer.Decode(i.PeerID)
+	if err != nil {
+		return peer.AddrInfo{}, fmt.Errorf("invalid peer ID: %w", err)
+	}
+
+	info := peer.AddrInfo{ID: peerID}
+	for _, addrStr := range i.Addresses {
+		ma, err := multiaddr.NewMultiaddr(addrStr)
+		if err != nil {
+			continue
+		}
+		info.Addrs = append(info.Addrs, ma)
+	}
+	if len(info.Addrs) == 0 {
+		return peer.AddrInfo{}, fmt.Errorf("no valid addresses in invite")
+	}
+	return info, nil
+}
+
+// writeFrame writes a length-prefixed JSON value
+func writeFrame(w io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, uint32(len(data))); err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// readFrame reads a length-prefixed JSON value
+func readFrame(r io.Reader, v interface{}) error {
+	var length uint32
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return err
+	}
+	if length > 64*1024 {
+		return fmt.Errorf("pairing message too large: %d bytes", length)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
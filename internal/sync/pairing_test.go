@@ -0,0 +1,114 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func startPairingPeers(t *testing.T, ctx context.Context, vaultKey []byte) (*p2pService, *p2pService) {
+	t.Helper()
+
+	cfg := DefaultConfig()
+	cfg.EnableMDNS = false
+	cfg.InvitesPath = t.TempDir()
+	cfg.VaultKey, cfg.VaultKeyEpoch = vaultKey, 2
+	inviter, err := NewP2PService(newMockProvider(), cfg)
+	if err != nil {
+		t.Fatalf("failed to create inviter: %v", err)
+	}
+
+	cfg = DefaultConfig()
+	cfg.EnableMDNS = false
+	joiner, err := NewP2PService(newMockProvider(), cfg)
+	if err != nil {
+		t.Fatalf("failed to create joiner: %v", err)
+	}
+
+	for _, svc := range []SyncService{inviter, joiner} {
+		if err := svc.Start(ctx); err != nil {
+			t.Fatalf("failed to start: %v", err)
+		}
+		t.Cleanup(func() { svc.Stop() })
+	}
+	return inviter.(*p2pService), joiner.(*p2pService)
+}
+
+func TestPairWithPIN(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	vaultKey := bytes.Repeat([]byte{7}, 32)
+	inviter, joiner := startPairingPeers(t, ctx, vaultKey)
+
+	invite, err := CreateInviteWithOptions(inviter.host, InviteOptions{Expiry: time.Hour, OneTime: true, PIN: true})
+	if err != nil {
+		t.Fatalf("failed to create invite: %v", err)
+	}
+	if len(invite.Key) != 0 || !invite.IsRedeemable() {
+		t.Fatalf("expected a redeemable invite without embedded key: %+v", invite)
+	}
+	pin, _ := GeneratePIN()
+	if len(pin) != PINDigits {
+		t.Fatalf("unexpected PIN %q", pin)
+	}
+	inviter.invites.Add(PendingInvite{ID: invite.ID, ExpiresAt: invite.ExpiresAt, OneTime: true, PIN: pin, ShareKey: true})
+
+	// Round trip through the encoded form so the signature covers the new fields
+	code, _ := invite.Encode()
+	if invite, err = ParseInvite(code); err != nil {
+		t.Fatalf("failed to parse invite: %v", err)
+	}
+
+	if _, err := joiner.Pair(ctx, invite, ""); err != ErrPINRequired {
+		t.Errorf("expected ErrPINRequired, got %v", err)
+	}
+	if _, err := joiner.Pair(ctx, invite, "000000x"); err == nil || !strings.Contains(err.Error(), ErrPINMismatch.Error()) {
+		t.Errorf("expected PIN mismatch, got %v", err)
+	}
+
+	key, err := joiner.Pair(ctx, invite, pin)
+	if err != nil {
+		t.Fatalf("pair failed: %v", err)
+	}
+	if key == nil || !bytes.Equal(key.Key[:], vaultKey) || key.Epoch != 2 {
+		t.Errorf("expected vault key of epoch 2 after confirmation, got %+v", key)
+	}
+
+	// One-time invites cannot be replayed
+	if _, err := joiner.Pair(ctx, invite, pin); err == nil || !strings.Contains(err.Error(), ErrInviteNotFound.Error()) {
+		t.Errorf("expected replay to fail, got %v", err)
+	}
+}
+
+func TestPairRevokesAfterWrongPINs(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	inviter, joiner := startPairingPeers(t, ctx, nil)
+
+	invite, _ := CreateInviteWithOptions(inviter.host, InviteOptions{Expiry: time.Hour, PIN: true})
+	inviter.invites.Add(PendingInvite{ID: invite.ID, ExpiresAt: invite.ExpiresAt, PIN: "123456"})
+
+	for i := 0; i < MaxPINAttempts; i++ {
+		if _, err := joiner.Pair(ctx, invite, "654321"); err == nil {
+			t.Fatal("pair should fail with wrong PIN")
+		}
+	}
+	if _, err := joiner.Pair(ctx, invite, "123456"); err == nil || !strings.Contains(err.Error(), ErrInviteNotFound.Error()) {
+		t.Errorf("expected invite to be revoked, got %v", err)
+	}
+}
+
+func TestInviteSignatureCoversRedemptionFields(t *testing.T) {
+	inviter, _ := startPairingPeers(t, context.Background(), nil)
+
+	invite, _ := CreateInviteWithOptions(inviter.host, InviteOptions{Expiry: time.Hour, OneTime: true, PIN: true})
+	invite.PIN = false // Strip the PIN requirement
+	code, _ := invite.Encode()
+	if _, err := ParseInvite(code); err == nil {
+		t.Error("tampered invite should fail signature verification")
+	}
+}
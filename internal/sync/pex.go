@@ -0,0 +1,147 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// PEXInterval is how often peer lists are exchanged with a peer
+const PEXInterval = 5 * time.Minute
+
+// pexMessage is a peer list: the sender, with the addresses it listens
+// on, and the peers of its allowlist
+type pexMessage struct {
+	Peers []pexPeer `json:"peers"`
+}
+
+// pexPeer is a peer in a pexMessage
+type pexPeer struct {
+	PeerID    string   `json:"peer_id"`
+	Addresses []string `json:"addresses,omitempty"`
+}
+
+// pexEnabled reports whether peer exchange is on
+func (s *p2pService) pexEnabled() bool {
+	return s.config.EnablePEX && s.allowlist != nil
+}
+
+// pexTrusted reports whether peer lists are exchanged with a peer: one
+// in the allowlist, and not revoked
+func (s *p2pService) pexTrusted(p peer.ID) bool {
+	_, ok := s.allowlist.Get(p)
+	return ok && !s.allowlist.IsRevoked(p)
+}
+
+// pexDue reports whether peer lists are due to be exchanged with a peer,
+// and marks them exchanged
+func (s *p2pService) pexDue(p peer.ID, now time.Time) bool {
+	s.pexMu.Lock()
+	defer s.pexMu.Unlock()
+	if last, ok := s.pexed[p]; ok && now.Sub(last) < PEXInterval {
+		return false
+	}
+	s.pexed[p] = now
+	return true
+}
+
+// peerList returns this device's peer list
+func (s *p2pService) peerList() *pexMessage {
+	msg := &pexMessage{Peers: []pexPeer{{
+		PeerID:    s.transport.ID().String(),
+		Addresses: s.transport.Addrs(),
+	}}}
+	for _, p := range s.allowlist.List() {
+		if len(p.Addresses) > 0 {
+			msg.Peers = append(msg.Peers, pexPeer{PeerID: p.PeerID, Addresses: p.Addresses})
+		}
+	}
+	return msg
+}
+
+// handlePEXStream answers a peer's list with this device's
+func (s *p2pService) handlePEXStream(stream Stream) {
+	defer stream.Close()
+	stream.SetDeadline(time.Now().Add(30 * time.Second))
+
+	from := stream.RemotePeer()
+	if !s.pexTrusted(from) {
+		return
+	}
+	var msg pexMessage
+	if err := readFrame(stream, &msg); err != nil {
+		return
+	}
+	if err := writeFrame(stream, s.peerList()); err != nil {
+		return
+	}
+	s.pexDue(from, time.Now()) // Exchanged: no need to start one back
+	s.applyPeerList(from, &msg)
+}
+
+// exchangePeers swaps peer lists with a peer
+func (s *p2pService) exchangePeers(ctx context.Context, to peer.ID) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	stream, err := s.transport.Dial(ctx, to, PEXProtocolID)
+	if err != nil {
+		return fmt.Errorf("failed to open peer exchange stream: %w", err)
+	}
+	defer stream.Close()
+	stream.SetDeadline(time.Now().Add(30 * time.Second))
+
+	if err := writeFrame(stream, s.peerList()); err != nil {
+		return err
+	}
+	var msg pexMessage
+	if err := readFrame(stream, &msg); err != nil {
+		return err
+	}
+	s.applyPeerList(to, &msg)
+	return nil
+}
+
+// applyPeerList records the addresses of the allowlisted peers in a
+// peer's list and dials those not connected. Other peers are ignored with
+// a strict allowlist, else connected to like discovered ones.
+func (s *p2pService) applyPeerList(from peer.ID, msg *pexMessage) {
+	updated := 0
+	for _, p := range msg.Peers {
+		id, err := peer.Decode(p.PeerID)
+		if err != nil || id == s.transport.ID() || len(p.Addresses) == 0 || s.allowlist.IsRevoked(id) {
+			continue
+		}
+		if _, known := s.allowlist.Get(id); known {
+			changed, err := s.allowlist.SetAddresses(id, p.Addresses)
+			if err != nil {
+				s.logger.Errorf("failed to record addresses of %s: %v", id.String()[:8], err)
+			}
+			if changed {
+				updated++
+			}
+		} else if s.config.StrictAllowlist {
+			continue
+		}
+		if !s.transport.Connected(id) {
+			go s.HandlePeerFound(pexAddrInfo(id, p.Addresses))
+		}
+	}
+	if updated > 0 {
+		s.logger.Infof("peer exchange with %s updated the addresses of %d peers", from.String()[:8], updated)
+	}
+}
+
+// pexAddrInfo returns a peer's ID with the addresses that parse
+func pexAddrInfo(id peer.ID, addrs []string) peer.AddrInfo {
+	info := peer.AddrInfo{ID: id}
+	for _, addr := range addrs {
+		if ma, err := multiaddr.NewMultiaddr(addr); err == nil {
+			info.Addrs = append(info.Addrs, ma)
+		}
+	}
+	return info
+}
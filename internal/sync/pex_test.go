@@ -0,0 +1,79 @@
+package sync
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func TestPeerExchange(t *testing.T) {
+	network := NewMemoryNetwork()
+	idA, idB, idC, idD := newPeerID(t), newPeerID(t), newPeerID(t), newPeerID(t)
+	fresh := []string{"/ip4/10.0.0.3/tcp/4001"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	start := func(id peer.ID, trusted map[peer.ID][]string) *p2pService {
+		cfg := DefaultConfig()
+		cfg.EnableMDNS = false
+		cfg.EnablePEX = true
+		cfg.StrictAllowlist = true
+		cfg.AllowlistPath = t.TempDir()
+		al, err := NewAllowlist(cfg.AllowlistPath, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for p, addrs := range trusted {
+			al.Add(p, "", addrs)
+		}
+		svc, err := NewService(newMockProvider(), network.Transport(id), cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := svc.Start(ctx); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { svc.Stop() })
+		return svc.(*p2pService)
+	}
+
+	// A knows where C and D are; B has a stale address for C and has
+	// never heard of D
+	start(idA, map[peer.ID][]string{idB: nil, idC: fresh, idD: {"/ip4/10.0.0.4/tcp/4001"}})
+	b := start(idB, map[peer.ID][]string{idA: nil, idC: {"/ip4/192.168.1.9/tcp/4001"}})
+	start(idC, map[peer.ID][]string{idA: nil, idB: nil})
+
+	if err := b.SyncWith(ctx, idA); err != nil {
+		t.Fatal(err)
+	}
+
+	if p, _ := b.allowlist.Get(idC); !slices.Equal(p.Addresses, fresh) {
+		t.Errorf("expected C's address from A, got %v", p.Addresses)
+	}
+	if _, ok := b.allowlist.Get(idD); ok {
+		t.Error("expected a peer B does not trust to be left out")
+	}
+	if p, _ := b.allowlist.Get(idA); len(p.Addresses) != 1 || p.Addresses[0] != "memory:"+idA.String() {
+		t.Errorf("expected A's own addresses, got %v", p.Addresses)
+	}
+
+	// B dials C at its new address
+	deadline := time.Now().Add(5 * time.Second)
+	for !b.transport.Connected(idC) {
+		if time.Now().After(deadline) {
+			t.Fatal("expected B to connect to C")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if b.transport.Connected(idD) {
+		t.Error("expected B not to connect to an untrusted peer")
+	}
+
+	// Lists are exchanged at most every PEXInterval
+	if b.pexDue(idA, time.Now()) {
+		t.Error("expected the next exchange with A to wait")
+	}
+}
@@ -0,0 +1,111 @@
+package sync
+
+import (
+	"fmt"
+	"time"
+)
+
+// PowerMode trades sync latency for battery and data use
+type PowerMode string
+
+const (
+	// PowerNormal syncs every SyncInterval and as soon as peers are found
+	PowerNormal PowerMode = "normal"
+
+	// PowerLow is for devices on battery or a metered network: syncs are
+	// batched every LowPowerInterval (newly discovered peers wait for the
+	// next batch) and the DHT is stopped
+	PowerLow PowerMode = "low"
+)
+
+// DefaultLowPowerInterval is the sync interval in PowerLow
+const DefaultLowPowerInterval = 5 * time.Minute
+
+// ParsePowerMode parses a power mode name ("" is PowerNormal)
+func ParsePowerMode(s string) (PowerMode, error) {
+	switch mode := PowerMode(s); mode {
+	case "":
+		return PowerNormal, nil
+	case PowerNormal, PowerLow:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown power mode %q (use normal or low)", s)
+	}
+}
+
+// SetPowerMode switches power mode, for host applications following
+// OS battery and network signals. The sync interval changes at once
+// and the DHT (if enabled) is stopped or restarted.
+func (s *p2pService) SetPowerMode(mode PowerMode) error {
+	mode, err := ParsePowerMode(string(mode))
+	if err != nil {
+		return err
+	}
+
+	s.powerMu.Lock()
+	defer s.powerMu.Unlock()
+
+	if mode == s.power {
+		return nil
+	}
+	s.power = mode
+	s.logger.Infof("power mode: %s", mode)
+
+	// Wake the sync loop to pick up the new interval
+	select {
+	case s.powerCh <- struct{}{}:
+	default:
+	}
+
+	if !s.running || !s.config.EnableDHT {
+		return nil
+	}
+	if mode == PowerLow {
+		s.stopDHT()
+		return nil
+	}
+	return s.startDHT()
+}
+
+// PowerMode returns the current power mode
+func (s *p2pService) PowerMode() PowerMode {
+	s.powerMu.Lock()
+	defer s.powerMu.Unlock()
+	return s.power
+}
+
+// syncInterval is the delay between periodic syncs in the current
+// power mode
+func (s *p2pService) syncInterval() time.Duration {
+	if s.PowerMode() == PowerLow {
+		return s.config.LowPowerInterval
+	}
+	return s.config.SyncInterval
+}
+
+// startDHT starts DHT discovery, with s.powerMu held
+func (s *p2pService) startDHT() error {
+	bootstrapPeers := GetDefaultBootstrapPeers()
+	dhtDiscovery, err := NewDHTDiscovery(s.host, bootstrapPeers, s.logger)
+	if err != nil {
+		return fmt.Errorf("failed to create DHT: %w", err)
+	}
+	if err := dhtDiscovery.Start(s.HandlePeerFound); err != nil {
+		dhtDiscovery.Stop()
+		return fmt.Errorf("failed to start DHT: %w", err)
+	}
+	s.dhtDiscovery = dhtDiscovery
+	s.logger.Infof("DHT discovery enabled (global)")
+	return nil
+}
+
+// stopDHT stops DHT discovery, with s.powerMu held
+func (s *p2pService) stopDHT() {
+	if s.dhtDiscovery == nil {
+		return
+	}
+	if err := s.dhtDiscovery.Stop(); err != nil {
+		s.logger.Errorf("failed to stop DHT: %v", err)
+	}
+	s.dhtDiscovery = nil
+}
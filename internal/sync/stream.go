@@ -0,0 +1,207 @@
+package sync
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/amaydixit11/acorde/internal/core"
+	"github.com/amaydixit11/acorde/internal/crdt"
+	"github.com/google/uuid"
+)
+
+// Streaming state transfer: instead of one message holding the whole
+// state, a peer that speaks ProtocolStreaming is sent a series of
+// MsgStateChunk messages, each a partial state within the budget the
+// peer advertised. The receiver merges (and persists) each chunk as it
+// arrives, so it only ever holds one. Entries travel with their tags;
+// tag sets without an entry, ACLs and acks follow the entries, so entries
+// are screened against the ACLs held before the sync as with a whole
+// state. CRDT merges commute, so a stream cut short leaves a consistent
+// partial merge that the next sync completes.
+
+// DefaultStateBudget is the default Config.StateBudget
+const DefaultStateBudget = 4 << 20
+
+// MaxStateBudget is the largest state budget: a chunk, base64-encoded in
+// its message, must stay under the 10MB message limit
+const MaxStateBudget = 7 << 20
+
+// chunkOverhead is the room kept in each chunk for the state's envelope
+const chunkOverhead = 256
+
+// keySize is the encoded size of a UUID map key, quoted, with its colon
+const keySize = 39
+
+// stateTimeout bounds each message of a state transfer
+const stateTimeout = 30 * time.Second
+
+// sendState sends our state to a peer using format: streamed in chunks
+// within the peer's budget, or whole to peers that predate streaming
+func (e *SyncEngine) sendState(stream Stream, sessionID string, format int, theirs *Message, rec *sessionRecorder) error {
+	if versionOf(theirs).protocol < ProtocolStreaming {
+		msg := &Message{Type: MsgState, SessionID: sessionID, State: e.encodeState(format)}
+		if err := e.send(stream, msg); err != nil {
+			return fmt.Errorf("failed to send state: %w", err)
+		}
+		rec.message(true, msg)
+		return nil
+	}
+
+	return chunkState(e.outgoingState(format), stateBudget(theirs.Budget), func(data []byte, more bool) error {
+		msg := &Message{Type: MsgStateChunk, SessionID: sessionID, State: data, More: more}
+		stream.SetDeadline(time.Now().Add(stateTimeout))
+		if err := e.send(stream, msg); err != nil {
+			return fmt.Errorf("failed to send state chunk: %w", err)
+		}
+		rec.message(true, msg)
+		return nil
+	})
+}
+
+// receiveState merges the state msg carries, reading and merging the
+// chunks that follow it if the state is streamed. Returns the bytes of
+// state received and the entries the merge changed. The merge is recorded in the metrics once the whole
+// state is merged.
+func (e *SyncEngine) receiveState(stream Stream, msg *Message, rec *sessionRecorder) (int, int, error) {
+	rec.beforeMerge(e.provider.GetState)
+	received := 0
+	var stats crdt.MergeStats
+	merge := func(state crdt.ReplicaState) error {
+		return e.mergeState(stream.RemotePeer(), state, &stats)
+	}
+	for {
+		var state crdt.ReplicaState
+		if err := json.Unmarshal(msg.State, &state); err != nil {
+			return received, stats.Changed, fmt.Errorf("failed to decode state: %w", err)
+		}
+		if err := e.chaos.apply(state, merge); err != nil {
+			return received, stats.Changed, err
+		}
+		received += len(msg.State)
+		if msg.Type != MsgStateChunk || !msg.More {
+			break
+		}
+
+		stream.SetDeadline(time.Now().Add(stateTimeout))
+		next, err := readMessage(stream)
+		if err != nil {
+			return received, stats.Changed, fmt.Errorf("failed to read state chunk: %w", err)
+		}
+		rec.message(false, next)
+		if next.Type != MsgStateChunk {
+			return received, stats.Changed, fmt.Errorf("expected a state chunk, got %s", next.Type)
+		}
+		msg = next
+	}
+	rec.afterMerge(e.provider.GetState)
+	e.recordMerge(stream.RemotePeer(), stats)
+	return received, stats.Changed, nil
+}
+
+// stateBudget returns the chunk size for a peer that advertised budget
+func stateBudget(budget int) int {
+	if budget <= 0 {
+		return DefaultStateBudget
+	}
+	if budget > MaxStateBudget {
+		return MaxStateBudget
+	}
+	return budget
+}
+
+// chunkState splits state into partial states, each encoding to at most
+// budget bytes unless a single entry is larger, and passes them to emit
+// in order; more is false for the last. Every chunk carries the clock.
+func chunkState(state crdt.ReplicaState, budget int, emit func(data []byte, more bool) error) error {
+	chunk := crdt.ReplicaState{ClockTime: state.ClockTime}
+	size := chunkOverhead
+
+	flush := func(more bool) error {
+		data, err := json.Marshal(chunk)
+		if err != nil {
+			return fmt.Errorf("failed to encode state chunk: %w", err)
+		}
+		chunk = crdt.ReplicaState{ClockTime: state.ClockTime}
+		size = chunkOverhead
+		return emit(data, more)
+	}
+	// add puts an item of n encoded bytes in the chunk, first sending the
+	// chunk if the item does not fit
+	add := func(n int, put func()) error {
+		if size > chunkOverhead && size+n > budget {
+			if err := flush(true); err != nil {
+				return err
+			}
+		}
+		put()
+		size += n
+		return nil
+	}
+	putTags := func(id uuid.UUID, tags crdt.TagSetState) {
+		if chunk.Tags == nil {
+			chunk.Tags = make(map[uuid.UUID]crdt.TagSetState)
+		}
+		chunk.Tags[id] = tags
+	}
+
+	for _, elem := range state.Entries {
+		elem := elem
+		tags, hasTags := state.Tags[elem.Entry.ID]
+		n := encodedSize(elem)
+		if hasTags {
+			n += encodedSize(tags) + keySize
+		}
+		if err := add(n, func() {
+			chunk.Entries = append(chunk.Entries, elem)
+			if hasTags {
+				putTags(elem.Entry.ID, tags)
+			}
+		}); err != nil {
+			return err
+		}
+	}
+
+	held := make(map[uuid.UUID]bool, len(state.Entries))
+	for _, elem := range state.Entries {
+		held[elem.Entry.ID] = true
+	}
+	for id, tags := range state.Tags {
+		if held[id] {
+			continue
+		}
+		id, tags := id, tags
+		n := encodedSize(tags) + keySize
+		if err := add(n, func() { putTags(id, tags) }); err != nil {
+			return err
+		}
+	}
+
+	for id, entryACL := range state.ACLs {
+		id, entryACL := id, entryACL
+		n := encodedSize(entryACL) + keySize
+		if err := add(n, func() {
+			if chunk.ACLs == nil {
+				chunk.ACLs = make(map[uuid.UUID]core.ACL)
+			}
+			chunk.ACLs[id] = entryACL
+		}); err != nil {
+			return err
+		}
+	}
+
+	for _, ack := range state.Acks {
+		ack := ack
+		if err := add(encodedSize(ack), func() { chunk.Acks = append(chunk.Acks, ack) }); err != nil {
+			return err
+		}
+	}
+
+	return flush(false)
+}
+
+// encodedSize returns the length of v encoded as JSON, with a separator
+func encodedSize(v interface{}) int {
+	data, _ := json.Marshal(v)
+	return len(data) + 1
+}
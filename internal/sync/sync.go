@@ -1,7 +1,9 @@
 // Package sync provides peer-to-peer synchronization for acorde.
 //
-// It uses libp2p for networking and mDNS for local peer discovery.
-// The protocol uses state-based sync with hash comparison for efficiency.
+// It uses libp2p for networking and mDNS for local peer discovery by
+// default; other transports plug in through Transport (see NewService).
+// The protocol, run by SyncEngine, uses state-based sync with hash
+// comparison for efficiency.
 package sync
 
 import (
@@ -12,10 +14,14 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/amaydixit11/acorde/internal/blob"
 	"github.com/amaydixit11/acorde/internal/crdt"
+	"github.com/amaydixit11/acorde/internal/sharing"
+	vcrypto "github.com/amaydixit11/acorde/pkg/crypto"
 	"github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/libp2p/go-libp2p/core/peer"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Config contains configuration for the SyncService
@@ -28,6 +34,36 @@ type Config struct {
 	// Default: 5 seconds
 	SyncInterval time.Duration
 
+	// PowerMode is the initial power mode (see SyncService.SetPowerMode);
+	// LowPowerInterval is how often to sync in PowerLow
+	// Default: PowerNormal, DefaultLowPowerInterval
+	PowerMode        PowerMode
+	LowPowerInterval time.Duration
+
+	// MaxBackoff caps the delay before retrying a failing peer, which
+	// starts at SyncInterval and doubles with each consecutive failure
+	// Default: 5 minutes
+	MaxBackoff time.Duration
+
+	// QuarantineAfter consecutive failures quarantine a peer: periodic
+	// syncs skip it for QuarantineFor
+	// Default: 10 failures, 1 hour
+	QuarantineAfter int
+	QuarantineFor   time.Duration
+
+	// HealthPath is the directory peer health is published to
+	// (peer-health.json), for LoadPeerHealth
+	// Default: "" (not published)
+	HealthPath string
+
+	// SessionLog records the last SessionLog sync sessions (messages,
+	// state hashes, entries applied) for debugging; -1 keeps
+	// DefaultSessionLog. SessionLogPath is the directory they are
+	// published to (sync-sessions.json), for LoadSessions.
+	// Default: 0 (off), "" (not published)
+	SessionLog     int
+	SessionLogPath string
+
 	// EnableMDNS enables mDNS for LAN peer discovery
 	// Default: true
 	EnableMDNS bool
@@ -44,9 +80,91 @@ type Config struct {
 	// Default: false (accept all)
 	StrictAllowlist bool
 
+	// EnablePEX exchanges peer lists with allowlisted peers after syncing
+	// with them (at most every PEXInterval), so address changes spread
+	// through the mesh. Peers already in the allowlist get the new
+	// addresses and are dialed at them; with StrictAllowlist other peers
+	// are ignored, else they are connected to like discovered ones.
+	// Default: false (needs AllowlistPath)
+	EnablePEX bool
+
+	// InvitesPath is the directory holding redeemable invites (invites.json).
+	// When set, peers can pair with one-time and PIN invites.
+	// Default: "" (pairing protocol disabled)
+	InvitesPath string
+
+	// VaultKey is sent to peers that redeem an invite created with key
+	// sharing, after PIN confirmation
+	// Optional
+	VaultKey []byte
+
+	// VaultKeyEpoch is the epoch of VaultKey, sent with it
+	VaultKeyEpoch uint32
+
+	// DeviceKey is this device's X25519 key pair. Its public half is
+	// exchanged during pairing; it unwraps key grants after a key rotation.
+	// Optional (no key grants without it)
+	DeviceKey *sharing.KeyPair
+
+	// GrantsPath is the directory holding key grants (grants.json).
+	// Queued outgoing grants are delivered to peers as they connect.
+	// Default: "" (key grants disabled)
+	GrantsPath string
+
+	// OnKeyGrant is called with the new vault key and its epoch after a
+	// trusted peer rotated it. The grant stays in GrantsPath until the
+	// keystore is updated (see GrantStore.ClearIncoming).
+	// Optional
+	OnKeyGrant func(from peer.ID, key vcrypto.EpochKey) error
+
+	// OnEvent is called as peers connect and disconnect and as sync
+	// sessions start and end, from the goroutines running them; it must
+	// not block.
+	// Optional
+	OnEvent func(Event)
+
+	// Blobs is the blob store blobs are served from and fetched into.
+	// Peers fetch blobs in verified chunks of BlobChunkSize bytes,
+	// resuming interrupted transfers (see SyncService.FetchBlob).
+	// Default: nil (blob transfer disabled), blob.DefaultChunkSize
+	Blobs         *blob.Store
+	BlobChunkSize int
+
+	// WantBlobs returns the blobs to fetch from peers, e.g. those of
+	// synced File entries; it is polled every sync interval. Blobs
+	// already stored are skipped.
+	// Optional
+	WantBlobs func() []blob.CID
+
+	// StateBudget bounds the memory, in bytes, a remote state takes while
+	// it is received. Peers stream larger states in chunks of at most this
+	// size, each merged as it arrives, so a device with little RAM can
+	// sync with a big vault. Capped at MaxStateBudget.
+	// Default: DefaultStateBudget
+	StateBudget int
+
+	// Namespaces limits sync to entries of these namespaces ("" is the
+	// default one): others are neither sent to peers nor merged from them
+	// Default: nil (all namespaces)
+	Namespaces []string
+
+	// SlowMerge is how long merging a state received from a peer may
+	// take before the merge is logged and counted in
+	// SyncMetrics.Merges.SlowMerges; negative disables logging
+	// Default: DefaultSlowMerge
+	SlowMerge time.Duration
+
+	// Chaos injects message drops, delays, duplication and reordering
+	// into sync traffic. For testing only.
+	// Default: nil (disabled)
+	Chaos *ChaosConfig
+
 	// Logger for sync events (optional)
 	Logger Logger
 
+	// TracerProvider receives a span per sync session (optional)
+	TracerProvider trace.TracerProvider
+
 	// PrivateKey is the identity key for the host
 	// Optional (generated if nil)
 	PrivateKey crypto.PrivKey
@@ -89,11 +207,36 @@ type SyncService interface {
 	// Metrics returns sync statistics
 	Metrics() SyncMetrics
 
-	// GetHost returns the underlying libp2p host
+	// PeerHealth returns the sync record of every peer synced with
+	PeerHealth() []PeerHealth
+
+	// Sessions returns the recorded sync sessions, oldest first (see
+	// Config.SessionLog)
+	Sessions() []Session
+
+	// GetHost returns the underlying libp2p host (nil on other
+	// transports)
 	GetHost() host.Host
 
 	// ConnectPeer connects to a peer from an invite
 	ConnectPeer(invite *PeerInvite) error
+
+	// SetPowerMode switches between PowerNormal and PowerLow (longer
+	// sync interval, batched syncs, no DHT), e.g. on battery or metered
+	// network signals from the OS
+	SetPowerMode(mode PowerMode) error
+
+	// PowerMode returns the current power mode
+	PowerMode() PowerMode
+
+	// FetchBlob fetches a blob from a peer in verified chunks, resuming
+	// an interrupted transfer. Blobs already stored are not fetched.
+	FetchBlob(ctx context.Context, peerID peer.ID, cid blob.CID) error
+
+	// Pair redeems an invite with its creator (verifying the PIN, if
+	// required) and connects to it. Returns the vault key and its epoch
+	// if shared (nil if not).
+	Pair(ctx context.Context, invite *PeerInvite, pin string) (*vcrypto.EpochKey, error)
 }
 
 // SyncMetrics provides sync statistics
@@ -101,6 +244,28 @@ type SyncMetrics struct {
 	SyncAttempts  int64
 	SyncSuccesses int64
 	SyncFailures  int64
+
+	// VersionRefusals counts syncs abandoned because the peers share no
+	// data format; Downgrades counts states stripped for older peers
+	VersionRefusals int64
+	Downgrades      int64
+
+	// GatedDials and GatedAccepts count outbound and inbound connections
+	// refused because the allowlist rejects the peer
+	GatedDials   int64
+	GatedAccepts int64
+
+	// BlobsFetched counts blobs fetched from peers; BlobChunksFetched
+	// counts the chunks transferred for them
+	BlobsFetched      int64
+	BlobChunksFetched int64
+
+	// Merges sums the merges of states received from peers: their
+	// duration, entries compared and changed, and tombstones seen
+	Merges MergeMetrics
+
+	// Chaos counts injected faults (zero unless Config.Chaos is set)
+	Chaos ChaosStats
 }
 
 // StateProvider provides CRDT state for sync
@@ -123,6 +288,8 @@ const (
 	MsgStateHash    MessageType = 1 // Exchange state hashes
 	MsgStateRequest MessageType = 2 // Request full state
 	MsgState        MessageType = 3 // Full state payload
+	MsgRefuse       MessageType = 4 // No common data format (see Reason)
+	MsgStateChunk   MessageType = 5 // Part of a streamed state (see More)
 )
 
 // Message is a sync protocol message
@@ -131,6 +298,14 @@ type Message struct {
 	SessionID string      `json:"session_id,omitempty"` // Prevents duplicate sync operations
 	StateHash []byte      `json:"state_hash,omitempty"`
 	State     []byte      `json:"state,omitempty"` // JSON-encoded ReplicaState
+	More      bool        `json:"more,omitempty"`  // More state chunks follow this one
+
+	// Version negotiation (absent from legacy peers, see versionOf)
+	Version   int    `json:"version,omitempty"`    // Protocol version
+	Format    int    `json:"format,omitempty"`     // Newest data format understood
+	MinFormat int    `json:"min_format,omitempty"` // Oldest data format accepted
+	Reason    string `json:"reason,omitempty"`     // Why a sync was refused
+	Budget    int    `json:"budget,omitempty"`     // Largest state chunk accepted, in bytes
 }
 
 // Encode serializes the message to bytes
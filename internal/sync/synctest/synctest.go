@@ -0,0 +1,274 @@
+// Package synctest runs the sync protocol between in-process replicas, so
+// sync behavior can be tested deterministically and without libp2p hosts
+// or sleeps. A Cluster connects N state providers over a MemoryNetwork;
+// the test drives sync sessions or rounds itself and checks convergence.
+package synctest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/amaydixit11/acorde/internal/core"
+	"github.com/amaydixit11/acorde/internal/crdt"
+	"github.com/amaydixit11/acorde/internal/sync"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// ErrPartitioned is returned for sessions between partitioned nodes
+var ErrPartitioned = errors.New("nodes are partitioned")
+
+// Node is one replica of a Cluster
+type Node struct {
+	ID       peer.ID
+	Provider sync.StateProvider
+	Engine   *sync.SyncEngine
+
+	transport sync.Transport
+}
+
+// Cluster connects replicas over a MemoryNetwork. Sessions run one at a
+// time and only when the test asks, so runs are repeatable.
+type Cluster struct {
+	t       testing.TB
+	network *sync.MemoryNetwork
+	nodes   []*Node
+	cut     map[[2]int]bool // Links between partitioned nodes
+}
+
+// New connects a node for each provider. Node i's peer ID is derived from
+// i, so it is the same on every run. The network closes with the test.
+func New(t testing.TB, providers ...sync.StateProvider) *Cluster {
+	return NewWithConfig(t, sync.DefaultConfig(), providers...)
+}
+
+// NewWithConfig is New with the sync engines configured by cfg, e.g. to
+// inject faults with a seeded Config.Chaos
+func NewWithConfig(t testing.TB, cfg sync.Config, providers ...sync.StateProvider) *Cluster {
+	t.Helper()
+	c := &Cluster{
+		t:       t,
+		network: sync.NewMemoryNetwork(),
+		cut:     make(map[[2]int]bool),
+	}
+	for i, provider := range providers {
+		key, _, err := crypto.GenerateEd25519Key(rand.New(rand.NewSource(int64(i))))
+		if err != nil {
+			t.Fatalf("failed to create key of node %d: %v", i, err)
+		}
+		id, err := peer.IDFromPrivateKey(key)
+		if err != nil {
+			t.Fatalf("failed to derive peer ID of node %d: %v", i, err)
+		}
+
+		n := &Node{
+			ID:        id,
+			Provider:  provider,
+			Engine:    sync.NewSyncEngine(provider, cfg),
+			transport: c.network.Transport(id),
+		}
+		n.transport.Handle(sync.ProtocolID, func(stream sync.Stream) {
+			n.Engine.Serve(context.Background(), stream)
+		})
+		c.nodes = append(c.nodes, n)
+	}
+	t.Cleanup(func() {
+		for _, n := range c.nodes {
+			n.transport.Close()
+		}
+		c.network.Wait()
+	})
+	return c
+}
+
+// Len returns the number of nodes
+func (c *Cluster) Len() int {
+	return len(c.nodes)
+}
+
+// Node returns node i
+func (c *Cluster) Node(i int) *Node {
+	return c.nodes[i]
+}
+
+// Sync runs one session from node from to node to, like
+// SyncService.SyncWith, and returns once both ends are done. Node from
+// receives node to's state if they differ. Partitioned nodes fail with
+// ErrPartitioned.
+func (c *Cluster) Sync(from, to int) error {
+	if c.cut[link(from, to)] {
+		return fmt.Errorf("%w: nodes %d and %d", ErrPartitioned, from, to)
+	}
+	n := c.nodes[from]
+	err := n.Engine.SyncWith(context.Background(), n.transport, c.nodes[to].ID)
+	c.network.Wait()
+	return err
+}
+
+// Round runs a session from every node to every other it can reach, in
+// node order, and returns the first error
+func (c *Cluster) Round() error {
+	var first error
+	for from := range c.nodes {
+		for to := range c.nodes {
+			if from == to || c.cut[link(from, to)] {
+				continue
+			}
+			if err := c.Sync(from, to); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+// Converge runs rounds until every node holds the same state, and fails
+// the test if that takes more than maxRounds. It returns the number of
+// rounds run.
+func (c *Cluster) Converge(maxRounds int) int {
+	c.t.Helper()
+	for round := 0; round < maxRounds; round++ {
+		if c.Converged() {
+			return round
+		}
+		if err := c.Round(); err != nil {
+			c.t.Fatalf("round %d failed: %v", round+1, err)
+		}
+	}
+	if !c.Converged() {
+		c.t.Fatalf("not converged after %d rounds: %s", maxRounds, c.hashes())
+	}
+	return maxRounds
+}
+
+// Converged reports whether every node holds the same state
+func (c *Cluster) Converged() bool {
+	for _, n := range c.nodes[1:] {
+		if string(n.Provider.StateHash()) != string(c.nodes[0].Provider.StateHash()) {
+			return false
+		}
+	}
+	return true
+}
+
+// Partition cuts the links between the given groups of nodes; nodes left
+// out of every group stay connected to all
+func (c *Cluster) Partition(groups ...[]int) {
+	for g, group := range groups {
+		for _, other := range groups[g+1:] {
+			for _, i := range group {
+				for _, j := range other {
+					c.cut[link(i, j)] = true
+				}
+			}
+		}
+	}
+}
+
+// Heal restores every link cut by Partition
+func (c *Cluster) Heal() {
+	c.cut = make(map[[2]int]bool)
+}
+
+// hashes describes each node's state hash, for failure messages
+func (c *Cluster) hashes() string {
+	parts := make([]string, len(c.nodes))
+	for i, n := range c.nodes {
+		parts[i] = fmt.Sprintf("node %d: %x", i, n.Provider.StateHash()[:4])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// link identifies the link between two nodes either way round
+func link(i, j int) [2]int {
+	if i > j {
+		i, j = j, i
+	}
+	return [2]int{i, j}
+}
+
+// Replica is a StateProvider holding a bare CRDT replica, for tests of the
+// protocol that need no engine
+type Replica struct {
+	*crdt.Replica
+}
+
+// NewReplica returns an empty replica
+func NewReplica() *Replica {
+	return &Replica{crdt.NewReplica(core.NewClock())}
+}
+
+// GetState returns the replica's state
+func (r *Replica) GetState() crdt.ReplicaState {
+	return r.State()
+}
+
+// ApplyState merges a remote state into the replica
+func (r *Replica) ApplyState(state crdt.ReplicaState) error {
+	remote := crdt.NewReplica(core.NewClockWithTime(state.ClockTime))
+	remote.LoadState(state)
+	r.Merge(remote)
+	return nil
+}
+
+// StateHash returns the hash of the replica's state
+func (r *Replica) StateHash() []byte {
+	return sync.ComputeStateHash(r.State())
+}
+
+// PayloadEngine is the sync side of an engine: its state as a payload,
+// and merging a peer's
+type PayloadEngine interface {
+	GetSyncPayload() ([]byte, error)
+	ApplyRemotePayload(payload []byte) error
+}
+
+// EngineProvider adapts an engine to a StateProvider, so a Cluster can
+// sync full engines (storage, encryption, ACLs) over the protocol
+type EngineProvider struct {
+	Engine PayloadEngine
+}
+
+// GetState returns the engine's state, or an empty one if it is locked
+func (p EngineProvider) GetState() crdt.ReplicaState {
+	var state crdt.ReplicaState
+	if payload, err := p.Engine.GetSyncPayload(); err == nil {
+		json.Unmarshal(payload, &state)
+	}
+	return state
+}
+
+// ApplyState merges a remote state into the engine
+func (p EngineProvider) ApplyState(state crdt.ReplicaState) error {
+	payload, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return p.Engine.ApplyRemotePayload(payload)
+}
+
+// MergeStateFrom merges a remote state into the engine as sent by from,
+// if the engine checks senders (see engine.Engine.MergeRemotePayloadFrom)
+func (p EngineProvider) MergeStateFrom(from peer.ID, state crdt.ReplicaState) (crdt.MergeStats, error) {
+	merger, ok := p.Engine.(interface {
+		MergeRemotePayloadFrom(from string, payload []byte) (crdt.MergeStats, error)
+	})
+	if !ok {
+		return crdt.MergeStats{}, p.ApplyState(state)
+	}
+	payload, err := json.Marshal(state)
+	if err != nil {
+		return crdt.MergeStats{}, err
+	}
+	return merger.MergeRemotePayloadFrom(from.String(), payload)
+}
+
+// StateHash returns the hash of the engine's state
+func (p EngineProvider) StateHash() []byte {
+	return sync.ComputeStateHash(p.GetState())
+}
@@ -0,0 +1,51 @@
+package synctest
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/amaydixit11/acorde/internal/core"
+	"github.com/amaydixit11/acorde/internal/sync"
+)
+
+func TestClusterConverges(t *testing.T) {
+	replicas := []*Replica{NewReplica(), NewReplica(), NewReplica(), NewReplica()}
+	providers := make([]sync.StateProvider, len(replicas))
+	for i, r := range replicas {
+		r.AddEntry(core.Note, []byte{byte('a' + i)}, nil)
+		providers[i] = r
+	}
+	c := New(t, providers...)
+	if c.Node(0).ID != New(t, NewReplica()).Node(0).ID {
+		t.Error("expected peer IDs to be the same on every run")
+	}
+
+	// Split in two halves: each converges on its own
+	c.Partition([]int{0, 1}, []int{2, 3})
+	if err := c.Sync(0, 2); !errors.Is(err, ErrPartitioned) {
+		t.Fatalf("expected ErrPartitioned, got %v", err)
+	}
+	if err := c.Round(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(replicas[0].ListEntries()); n != 2 {
+		t.Errorf("expected 2 entries within the partition, got %d", n)
+	}
+	if c.Converged() {
+		t.Error("expected the halves to differ")
+	}
+
+	// Healed, every node ends up with every entry
+	c.Heal()
+	if rounds := c.Converge(3); rounds != 1 {
+		t.Errorf("expected 1 round to converge, took %d", rounds)
+	}
+	for i, r := range replicas {
+		if n := len(r.ListEntries()); n != 4 {
+			t.Errorf("node %d: expected 4 entries, got %d", i, n)
+		}
+	}
+	if m := c.Node(0).Engine.Metrics(); m.SyncFailures != 0 || m.SyncSuccesses != 4 {
+		t.Errorf("unexpected metrics %+v", m)
+	}
+}
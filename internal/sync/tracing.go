@@ -0,0 +1,36 @@
+package sync
+
+import (
+	"github.com/libp2p/go-libp2p/core/peer"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// tracerName is the instrumentation name of sync session spans
+const tracerName = "github.com/amaydixit11/acorde/sync"
+
+func newTracer(provider trace.TracerProvider) trace.Tracer {
+	if provider == nil {
+		provider = noop.NewTracerProvider()
+	}
+	return provider.Tracer(tracerName)
+}
+
+// endSpan ends a span, recording err
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func sessionAttributes(sessionID string, p peer.ID, outbound bool) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("acorde.sync.session_id", sessionID),
+		attribute.String("acorde.sync.peer", p.String()),
+		attribute.Bool("acorde.sync.outbound", outbound),
+	}
+}
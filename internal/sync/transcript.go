@@ -0,0 +1,223 @@
+package sync
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	gosync "sync"
+	"time"
+
+	"github.com/amaydixit11/acorde/internal/crdt"
+	"github.com/google/uuid"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// DefaultSessionLog is how many sessions Config.SessionLog keeps when
+// enabled with a size of -1
+const DefaultSessionLog = 100
+
+// sessionsFile is where the daemon publishes sessions for `acorde sync log`
+const sessionsFile = "sync-sessions.json"
+
+// Session is the transcript of a sync session, recorded in sync debug
+// mode (see Config.SessionLog)
+type Session struct {
+	ID             string           `json:"id"`
+	Peer           string           `json:"peer"`
+	Outbound       bool             `json:"outbound"` // We started it
+	Started        time.Time        `json:"started"`
+	Duration       time.Duration    `json:"duration_ns"`
+	HashBefore     string           `json:"hash_before"` // Our state hash, hex
+	HashAfter      string           `json:"hash_after"`
+	EntriesApplied int              `json:"entries_applied"` // Entries the merge added or changed
+	Messages       []SessionMessage `json:"messages"`
+	Error          string           `json:"error,omitempty"`
+}
+
+// SessionMessage is a message sent or received during a session
+type SessionMessage struct {
+	At        time.Time `json:"at"`
+	Sent      bool      `json:"sent"`
+	Type      string    `json:"type"`
+	StateHash string    `json:"state_hash,omitempty"` // Hex
+	StateSize int       `json:"state_size,omitempty"` // Bytes of state sent
+	Format    int       `json:"format,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+}
+
+// String returns the wire message type's name
+func (t MessageType) String() string {
+	switch t {
+	case MsgStateHash:
+		return "state_hash"
+	case MsgStateRequest:
+		return "state_request"
+	case MsgState:
+		return "state"
+	case MsgRefuse:
+		return "refuse"
+	case MsgStateChunk:
+		return "state_chunk"
+	}
+	return "unknown"
+}
+
+// sessionLog keeps the latest sessions in a ring buffer, optionally
+// published to a file
+type sessionLog struct {
+	mu       gosync.Mutex
+	sessions []Session // Ring buffer
+	next     int       // Index of the oldest session once full
+	path     string    // "" = not published
+	logger   Logger
+}
+
+// newSessionLog returns nil (recording disabled) unless cfg.SessionLog is
+// set
+func newSessionLog(cfg Config, logger Logger) *sessionLog {
+	size := cfg.SessionLog
+	if size < 0 {
+		size = DefaultSessionLog
+	}
+	if size == 0 {
+		return nil
+	}
+	l := &sessionLog{sessions: make([]Session, 0, size), logger: logger}
+	if cfg.SessionLogPath != "" {
+		l.path = filepath.Join(cfg.SessionLogPath, sessionsFile)
+	}
+	return l
+}
+
+// start begins recording a session. It returns nil when recording is
+// disabled; sessionRecorder methods do nothing on nil.
+func (l *sessionLog) start(id string, p peer.ID, outbound bool, hash func() []byte) *sessionRecorder {
+	if l == nil {
+		return nil
+	}
+	return &sessionRecorder{log: l, session: Session{
+		ID:         id,
+		Peer:       p.String(),
+		Outbound:   outbound,
+		Started:    time.Now(),
+		HashBefore: hex.EncodeToString(hash()),
+	}}
+}
+
+// add stores a finished session, replacing the oldest when full
+func (l *sessionLog) add(s Session) {
+	l.mu.Lock()
+	if len(l.sessions) < cap(l.sessions) {
+		l.sessions = append(l.sessions, s)
+	} else {
+		l.sessions[l.next] = s
+		l.next = (l.next + 1) % len(l.sessions)
+	}
+	l.mu.Unlock()
+
+	if l.path == "" {
+		return
+	}
+	data, err := json.MarshalIndent(l.list(), "", "  ")
+	if err == nil {
+		err = os.WriteFile(l.path, data, 0600)
+	}
+	if err != nil {
+		l.logger.Errorf("failed to save sync sessions: %v", err)
+	}
+}
+
+// list returns the recorded sessions, oldest first
+func (l *sessionLog) list() []Session {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	result := make([]Session, 0, len(l.sessions))
+	result = append(result, l.sessions[l.next:]...)
+	return append(result, l.sessions[:l.next]...)
+}
+
+// LoadSessions reads the sessions a daemon using dir as
+// Config.SessionLogPath last published, oldest first
+func LoadSessions(dir string) ([]Session, error) {
+	data, err := os.ReadFile(filepath.Join(dir, sessionsFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var sessions []Session
+	if err := json.Unmarshal(data, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// sessionRecorder records one session
+type sessionRecorder struct {
+	log     *sessionLog
+	session Session
+	before  map[uuid.UUID]uint64 // Entry versions before a merge
+}
+
+// message records a message sent or received
+func (r *sessionRecorder) message(sent bool, msg *Message) {
+	if r == nil || msg == nil {
+		return
+	}
+	m := SessionMessage{
+		At:        time.Now(),
+		Sent:      sent,
+		Type:      msg.Type.String(),
+		StateSize: len(msg.State),
+		Format:    msg.Format,
+		Reason:    msg.Reason,
+	}
+	if len(msg.StateHash) > 0 {
+		m.StateHash = hex.EncodeToString(msg.StateHash)
+	}
+	r.session.Messages = append(r.session.Messages, m)
+}
+
+// beforeMerge notes the entry versions a merge starts from
+func (r *sessionRecorder) beforeMerge(state func() crdt.ReplicaState) {
+	if r == nil {
+		return
+	}
+	local := state()
+	r.before = make(map[uuid.UUID]uint64, len(local.Entries))
+	for _, e := range local.Entries {
+		r.before[e.Entry.ID] = e.Timestamp
+	}
+}
+
+// afterMerge counts the entries the merge added or changed
+func (r *sessionRecorder) afterMerge(state func() crdt.ReplicaState) {
+	if r == nil || r.before == nil {
+		return
+	}
+	for _, e := range state().Entries {
+		if ts, ok := r.before[e.Entry.ID]; !ok || ts != e.Timestamp {
+			r.session.EntriesApplied++
+		}
+	}
+	r.before = nil
+}
+
+// finish records the outcome and stores the session
+func (r *sessionRecorder) finish(err error, hash func() []byte) {
+	if r == nil {
+		return
+	}
+	r.session.Duration = time.Since(r.session.Started)
+	r.session.HashAfter = hex.EncodeToString(hash())
+	if err != nil {
+		r.session.Error = err.Error()
+	}
+	r.log.add(r.session)
+}
@@ -0,0 +1,109 @@
+package sync
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/amaydixit11/acorde/internal/core"
+)
+
+func TestSessionLogRing(t *testing.T) {
+	dir := t.TempDir()
+	log := newSessionLog(Config{SessionLog: 3, SessionLogPath: dir}, noopLogger{})
+	for i := range 5 {
+		log.add(Session{ID: fmt.Sprint(i)})
+	}
+
+	var ids []string
+	for _, s := range log.list() {
+		ids = append(ids, s.ID)
+	}
+	if fmt.Sprint(ids) != "[2 3 4]" {
+		t.Errorf("expected the last 3 sessions oldest first, got %v", ids)
+	}
+
+	loaded, err := LoadSessions(dir)
+	if err != nil || len(loaded) != 3 || loaded[2].ID != "4" {
+		t.Errorf("unexpected published sessions %+v (%v)", loaded, err)
+	}
+
+	if newSessionLog(Config{}, nil) != nil {
+		t.Error("session log should be off by default")
+	}
+	var off *sessionLog
+	off.start("x", "", true, nil).finish(nil, nil) // No-op when off
+	if off.list() != nil {
+		t.Error("expected no sessions when off")
+	}
+}
+
+func TestSessionTranscript(t *testing.T) {
+	provider1, provider2 := newMockProvider(), newMockProvider()
+	cfg := DefaultConfig()
+	cfg.EnableMDNS = false
+	cfg.SessionLog = 10
+
+	svc1, err := NewP2PService(provider1, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc2, err := NewP2PService(provider2, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := svc1.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer svc1.Stop()
+	if err := svc2.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer svc2.Stop()
+
+	provider1.replica.AddEntry(core.Note, []byte("one"), nil)
+	provider1.replica.AddEntry(core.Note, []byte("two"), nil)
+	before := hex.EncodeToString(provider2.StateHash())
+
+	p2p1 := svc1.(*p2pService)
+	p2p2 := svc2.(*p2pService)
+	if err := p2p2.host.Connect(ctx, p2p1.host.Peerstore().PeerInfo(p2p1.host.ID())); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc2.SyncWith(ctx, p2p1.host.ID()); err != nil {
+		t.Fatal(err)
+	}
+
+	sessions := svc2.Sessions()
+	if len(sessions) != 1 {
+		t.Fatalf("expected 1 outbound session, got %d", len(sessions))
+	}
+	s := sessions[0]
+	if !s.Outbound || s.Peer != p2p1.host.ID().String() || s.Error != "" {
+		t.Errorf("unexpected session %+v", s)
+	}
+	if s.HashBefore != before || s.HashAfter != hex.EncodeToString(provider2.StateHash()) || s.HashBefore == s.HashAfter {
+		t.Errorf("unexpected hashes %s → %s", s.HashBefore, s.HashAfter)
+	}
+	if s.EntriesApplied != 2 {
+		t.Errorf("expected 2 entries applied, got %d", s.EntriesApplied)
+	}
+	if len(s.Messages) != 2 || !s.Messages[0].Sent || s.Messages[0].Type != "state_hash" ||
+		s.Messages[1].Sent || s.Messages[1].Type != "state_chunk" || s.Messages[1].StateSize == 0 {
+		t.Errorf("unexpected messages %+v", s.Messages)
+	}
+
+	// The other side records the same session, inbound
+	deadline := time.Now().Add(2 * time.Second)
+	for len(svc1.Sessions()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	inbound := svc1.Sessions()
+	if len(inbound) != 1 || inbound[0].ID != s.ID || inbound[0].Outbound || inbound[0].EntriesApplied != 0 {
+		t.Errorf("unexpected inbound sessions %+v", inbound)
+	}
+}
@@ -0,0 +1,133 @@
+package sync
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// Transport carries the streams of the sync, pairing, rekey and blob
+// protocols between peers. The protocols themselves (see SyncEngine) only
+// read and write streams, so a transport other than libp2p, such as a
+// WebSocket relay or MemoryNetwork in tests, can be plugged in with
+// NewService.
+type Transport interface {
+	// ID returns this device's peer ID
+	ID() peer.ID
+
+	// Addrs returns the addresses peers can reach this device at
+	Addrs() []string
+
+	// Handle serves incoming streams of a protocol with handler, which
+	// must close them
+	Handle(protocol string, handler func(Stream))
+
+	// Connect connects to a peer at the given addresses
+	Connect(ctx context.Context, pi peer.AddrInfo) error
+
+	// Connected reports whether a connection with a peer is open
+	Connected(p peer.ID) bool
+
+	// Notify calls fn as connections with peers open (connected true) and
+	// close. A peer may be reported connected again while connected.
+	Notify(fn func(p peer.ID, connected bool))
+
+	// Dial opens a stream of a protocol to a connected or reachable peer
+	Dial(ctx context.Context, p peer.ID, protocol string) (Stream, error)
+
+	// Close closes every connection and stops serving streams
+	Close() error
+}
+
+// Stream is a bidirectional stream with a peer whose identity the
+// transport authenticated
+type Stream interface {
+	io.ReadWriteCloser
+
+	// RemotePeer returns the authenticated peer at the other end
+	RemotePeer() peer.ID
+
+	// SetDeadline bounds the reads and writes that follow
+	SetDeadline(t time.Time) error
+
+	// Reset closes the stream abruptly, failing the peer's reads and
+	// writes rather than ending them cleanly
+	Reset() error
+}
+
+// libp2pTransport is the Transport of a libp2p host, whose connections
+// are authenticated by the peers' identity keys
+type libp2pTransport struct {
+	host host.Host
+}
+
+// NewLibp2pTransport returns the Transport of a libp2p host
+func NewLibp2pTransport(h host.Host) Transport {
+	return &libp2pTransport{host: h}
+}
+
+func (t *libp2pTransport) ID() peer.ID {
+	return t.host.ID()
+}
+
+func (t *libp2pTransport) Addrs() []string {
+	addrs := make([]string, len(t.host.Addrs()))
+	for i, addr := range t.host.Addrs() {
+		addrs[i] = addr.String()
+	}
+	return addrs
+}
+
+func (t *libp2pTransport) Handle(proto string, handler func(Stream)) {
+	t.host.SetStreamHandler(protocol.ID(proto), func(stream network.Stream) {
+		handler(libp2pStream{stream})
+	})
+}
+
+func (t *libp2pTransport) Connect(ctx context.Context, pi peer.AddrInfo) error {
+	return t.host.Connect(ctx, pi)
+}
+
+func (t *libp2pTransport) Connected(p peer.ID) bool {
+	return t.host.Network().Connectedness(p) == network.Connected
+}
+
+func (t *libp2pTransport) Notify(fn func(p peer.ID, connected bool)) {
+	t.host.Network().Notify(&network.NotifyBundle{
+		ConnectedF: func(n network.Network, c network.Conn) {
+			fn(c.RemotePeer(), true)
+		},
+		DisconnectedF: func(n network.Network, c network.Conn) {
+			// Other connections with the peer may remain
+			if n.Connectedness(c.RemotePeer()) != network.Connected {
+				fn(c.RemotePeer(), false)
+			}
+		},
+	})
+}
+
+func (t *libp2pTransport) Dial(ctx context.Context, p peer.ID, proto string) (Stream, error) {
+	stream, err := t.host.NewStream(ctx, p, protocol.ID(proto))
+	if err != nil {
+		return nil, err
+	}
+	return libp2pStream{stream}, nil
+}
+
+func (t *libp2pTransport) Close() error {
+	return t.host.Close()
+}
+
+// libp2pStream is a libp2p stream as a Stream
+type libp2pStream struct {
+	network.Stream
+}
+
+func (s libp2pStream) RemotePeer() peer.ID {
+	return s.Conn().RemotePeer()
+}
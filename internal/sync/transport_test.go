@@ -0,0 +1,91 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/amaydixit11/acorde/internal/core"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func newPeerID(t *testing.T) peer.ID {
+	t.Helper()
+	key, _, err := crypto.GenerateEd25519Key(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := peer.IDFromPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestMemoryTransportSync(t *testing.T) {
+	network := NewMemoryNetwork()
+	provider1, provider2 := newMockProvider(), newMockProvider()
+	id1, id2 := newPeerID(t), newPeerID(t)
+
+	cfg := DefaultConfig()
+	if _, err := NewService(provider1, network.Transport(id1), cfg); err == nil {
+		t.Fatal("expected mDNS to be refused without libp2p")
+	}
+	cfg.EnableMDNS = false
+	cfg.AllowlistPath = t.TempDir()
+	cfg.StrictAllowlist = true
+
+	svc1, err := NewService(provider1, network.Transport(id1), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.AllowlistPath = t.TempDir()
+	svc2, err := NewService(provider2, network.Transport(id2), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, svc := range []SyncService{svc1, svc2} {
+		if err := svc.Start(ctx); err != nil {
+			t.Fatal(err)
+		}
+		defer svc.Stop()
+	}
+	if svc1.GetHost() != nil {
+		t.Error("expected no libp2p host")
+	}
+
+	provider1.replica.AddEntry(core.Note, []byte("from peer 1"), nil)
+	provider2.replica.AddEntry(core.Note, []byte("from peer 2"), nil)
+
+	// Strangers are refused by the strict allowlist on both ends
+	if err := svc2.SyncWith(ctx, id1); err == nil {
+		t.Fatal("expected the sync to be refused")
+	}
+	svc1.(*p2pService).allowlist.Add(id2, "", nil)
+	svc2.(*p2pService).allowlist.Add(id1, "", nil)
+
+	// svc1 answers with its state, then svc1 syncs back
+	if err := svc2.SyncWith(ctx, id1); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	if err := svc1.SyncWith(ctx, id2); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	if n1, n2 := len(provider1.replica.ListEntries()), len(provider2.replica.ListEntries()); n1 != 2 || n2 != 2 {
+		t.Errorf("expected both replicas to hold 2 entries, got %d and %d", n1, n2)
+	}
+	if m := svc2.Metrics(); m.SyncSuccesses != 1 || m.SyncFailures != 0 {
+		t.Errorf("unexpected metrics %+v", m)
+	}
+
+	// A peer that left the network is unreachable
+	svc1.Stop()
+	if err := svc2.SyncWith(ctx, id1); !errors.Is(err, ErrUnreachable) {
+		t.Errorf("expected ErrUnreachable, got %v", err)
+	}
+}
@@ -0,0 +1,174 @@
+package sync
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// TrustBundle is a device's allowlist, signed with its identity key, for
+// a new device to import: pairing with one device then trusts the whole
+// mesh. Bundles can be exported to a file or embedded in invites.
+type TrustBundle struct {
+	Signer    string        `json:"signer"`               // Peer ID of the exporting device
+	PublicKey []byte        `json:"public_key"`           // Its public key
+	DeviceKey []byte        `json:"device_key,omitempty"` // Its X25519 public key for key grants
+	CreatedAt int64         `json:"created_at"`           // Unix timestamp
+	Peers     []TrustedPeer `json:"peers"`
+	Signature []byte        `json:"signature,omitempty"` // Over the fields above
+}
+
+// TrustedPeer is a peer in a trust bundle
+type TrustedPeer struct {
+	PeerID    string   `json:"peer_id"`
+	Name      string   `json:"name,omitempty"`
+	Addresses []string `json:"addresses,omitempty"`
+	DeviceKey []byte   `json:"device_key,omitempty"` // X25519 public key for key grants
+}
+
+// NewTrustBundle signs a bundle of peers with a device's identity key,
+// along with its device key (nil if none). The signer itself is left out
+// of the peers: importing a bundle trusts its signer anyway.
+func NewTrustBundle(key crypto.PrivKey, deviceKey []byte, peers []AllowedPeer) (*TrustBundle, error) {
+	signer, err := peer.IDFromPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid identity key: %w", err)
+	}
+	pubKey, err := crypto.MarshalPublicKey(key.GetPublic())
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal public key: %w", err)
+	}
+
+	bundle := &TrustBundle{
+		Signer:    signer.String(),
+		PublicKey: pubKey,
+		DeviceKey: deviceKey,
+		CreatedAt: time.Now().Unix(),
+		Peers:     make([]TrustedPeer, 0, len(peers)),
+	}
+	for _, p := range peers {
+		if p.PeerID == bundle.Signer {
+			continue
+		}
+		bundle.Peers = append(bundle.Peers, TrustedPeer{
+			PeerID:    p.PeerID,
+			Name:      p.Name,
+			Addresses: p.Addresses,
+			DeviceKey: p.DeviceKey,
+		})
+	}
+	sort.Slice(bundle.Peers, func(i, j int) bool {
+		return bundle.Peers[i].PeerID < bundle.Peers[j].PeerID
+	})
+
+	data, err := bundle.signableData()
+	if err != nil {
+		return nil, err
+	}
+	if bundle.Signature, err = key.Sign(data); err != nil {
+		return nil, fmt.Errorf("failed to sign trust bundle: %w", err)
+	}
+	return bundle, nil
+}
+
+// ParseTrustBundle decodes and verifies a bundle written by Encode
+func ParseTrustBundle(data []byte) (*TrustBundle, error) {
+	var bundle TrustBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return nil, fmt.Errorf("invalid trust bundle: %w", err)
+	}
+	if err := bundle.Verify(); err != nil {
+		return nil, err
+	}
+	return &bundle, nil
+}
+
+// Encode serializes the bundle as JSON
+func (b *TrustBundle) Encode() ([]byte, error) {
+	return json.MarshalIndent(b, "", "  ")
+}
+
+// Verify checks the bundle's signature, that it was signed by its Signer,
+// and that its peer IDs are valid
+func (b *TrustBundle) Verify() error {
+	pubKey, err := crypto.UnmarshalPublicKey(b.PublicKey)
+	if err != nil {
+		return fmt.Errorf("invalid trust bundle public key: %w", err)
+	}
+	data, err := b.signableData()
+	if err != nil {
+		return err
+	}
+	if valid, err := pubKey.Verify(data, b.Signature); err != nil || !valid {
+		return fmt.Errorf("invalid trust bundle signature")
+	}
+
+	signer, err := peer.IDFromPublicKey(pubKey)
+	if err != nil {
+		return fmt.Errorf("failed to derive peer ID: %w", err)
+	}
+	if signer.String() != b.Signer {
+		return fmt.Errorf("trust bundle signer mismatch")
+	}
+	for _, p := range b.Peers {
+		if _, err := peer.Decode(p.PeerID); err != nil {
+			return fmt.Errorf("invalid peer ID in trust bundle: %w", err)
+		}
+	}
+	return nil
+}
+
+// signableData returns the data that gets signed: the bundle's JSON
+// without its signature
+func (b *TrustBundle) signableData() ([]byte, error) {
+	unsigned := *b
+	unsigned.Signature = nil
+	data, err := json.Marshal(unsigned)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte("acorde-trust|"), data...), nil
+}
+
+// ImportTrust adds the signer and peers of a verified bundle to the
+// allowlist, except self and revoked peers. Peers already trusted keep
+// their entries, filling in a name, addresses or device key they lack.
+// It returns the number of peers added.
+func (al *Allowlist) ImportTrust(b *TrustBundle, self peer.ID) (int, error) {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	al.refresh()
+
+	peers := append([]TrustedPeer{{PeerID: b.Signer, DeviceKey: b.DeviceKey}}, b.Peers...)
+	added := 0
+	for _, p := range peers {
+		peerID, err := peer.Decode(p.PeerID)
+		if err != nil || peerID == self {
+			continue
+		}
+		if _, ok := al.revoked[peerID]; ok {
+			continue
+		}
+
+		existing, ok := al.peers[peerID]
+		if !ok {
+			existing = AllowedPeer{PeerID: p.PeerID, AddedAt: time.Now().Unix()}
+			added++
+		}
+		if existing.Name == "" {
+			existing.Name = p.Name
+		}
+		if len(existing.Addresses) == 0 {
+			existing.Addresses = p.Addresses
+		}
+		if len(existing.DeviceKey) == 0 && len(p.DeviceKey) == 32 {
+			existing.DeviceKey = p.DeviceKey
+		}
+		al.peers[peerID] = existing
+	}
+	return added, al.save()
+}
@@ -0,0 +1,103 @@
+package sync
+
+import (
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func TestTrustBundle(t *testing.T) {
+	key, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	signer, _ := peer.IDFromPrivateKey(key)
+	laptop, phone, revoked, joiner := newPeerID(t), newPeerID(t), newPeerID(t), newPeerID(t)
+
+	bundle, err := NewTrustBundle(key, nil, []AllowedPeer{
+		{PeerID: laptop.String(), Name: "laptop", Addresses: []string{"/ip4/10.0.0.2/tcp/4001"}},
+		{PeerID: phone.String()},
+		{PeerID: revoked.String()},
+		{PeerID: joiner.String()},
+		{PeerID: signer.String()},
+	})
+	if err != nil {
+		t.Fatalf("NewTrustBundle failed: %v", err)
+	}
+	if len(bundle.Peers) != 4 {
+		t.Errorf("expected the signer left out of 4 peers, got %d", len(bundle.Peers))
+	}
+
+	data, _ := bundle.Encode()
+	parsed, err := ParseTrustBundle(data)
+	if err != nil {
+		t.Fatalf("ParseTrustBundle failed: %v", err)
+	}
+
+	// Tampering breaks the signature
+	tampered := *parsed
+	tampered.Peers = append([]TrustedPeer{{PeerID: newPeerID(t).String()}}, parsed.Peers...)
+	if err := tampered.Verify(); err == nil {
+		t.Error("expected a tampered bundle to fail verification")
+	}
+
+	al, err := NewAllowlist(t.TempDir(), true)
+	if err != nil {
+		t.Fatalf("failed to create allowlist: %v", err)
+	}
+	al.Add(phone, "phone", nil)
+	al.Revoke(revoked)
+
+	added, err := al.ImportTrust(parsed, joiner)
+	if err != nil {
+		t.Fatalf("ImportTrust failed: %v", err)
+	}
+	if added != 2 {
+		t.Errorf("expected the signer and laptop added, got %d", added)
+	}
+	for _, id := range []peer.ID{signer, laptop, phone} {
+		if !al.IsAllowed(id) {
+			t.Errorf("expected %s to be allowed", id)
+		}
+	}
+	if al.IsAllowed(revoked) {
+		t.Error("expected a revoked peer to stay revoked")
+	}
+	if _, ok := al.Get(joiner); ok {
+		t.Error("expected the importing device to be left out")
+	}
+	if p, _ := al.Get(laptop); p.Name != "laptop" || len(p.Addresses) != 1 {
+		t.Errorf("expected the laptop's name and address, got %+v", p)
+	}
+}
+
+func TestInviteWithTrustBundle(t *testing.T) {
+	h, err := libp2p.New()
+	if err != nil {
+		t.Fatalf("failed to create host: %v", err)
+	}
+	defer h.Close()
+
+	invite, _ := CreateInvite(h, time.Hour)
+	invite.Trust, _ = NewTrustBundle(h.Peerstore().PrivKey(h.ID()), nil, []AllowedPeer{{PeerID: newPeerID(t).String()}})
+	code, _ := invite.Encode()
+	parsed, err := ParseInvite(code)
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	if parsed.Trust == nil || len(parsed.Trust.Peers) != 1 {
+		t.Errorf("expected the trust bundle in the invite, got %+v", parsed.Trust)
+	}
+
+	// A bundle signed by another device is refused
+	other, _, _ := crypto.GenerateEd25519Key(rand.Reader)
+	invite.Trust, _ = NewTrustBundle(other, nil, nil)
+	code, _ = invite.Encode()
+	if _, err := ParseInvite(code); err == nil {
+		t.Error("expected a bundle from another signer to be refused")
+	}
+}
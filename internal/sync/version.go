@@ -0,0 +1,122 @@
+package sync
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/amaydixit11/acorde/internal/crdt"
+)
+
+// ProtocolVersion is the sync protocol version this build speaks. Peers
+// that send no version predate negotiation and are treated as version 1.
+const ProtocolVersion = 3
+
+// ProtocolStreaming is the first protocol version that receives states
+// streamed in chunks (MsgStateChunk); older peers get them whole
+const ProtocolStreaming = 3
+
+// Data formats of the ReplicaState payload. Each adds fields to the one
+// before it; a newer peer strips them when syncing with an older one.
+const (
+	FormatBase = 1 // Entries and tags
+	FormatACLs = 2 // Adds ACLs
+	FormatAcks = 3 // Adds delivery acks
+)
+
+// DataFormat is the newest data format this build understands
+const DataFormat = FormatAcks
+
+// MinDataFormat is the oldest data format this build accepts. States in
+// older formats lose information this build relies on.
+const MinDataFormat = FormatBase
+
+// ErrIncompatibleVersion is returned when two peers share no data format
+var ErrIncompatibleVersion = errors.New("incompatible sync version")
+
+// peerVersion is what a peer advertised in its first message
+type peerVersion struct {
+	protocol  int
+	format    int
+	minFormat int
+}
+
+// versionOf reads the version a message advertises. Legacy peers send no
+// version and only understand the base format.
+func versionOf(msg *Message) peerVersion {
+	v := peerVersion{protocol: msg.Version, format: msg.Format, minFormat: msg.MinFormat}
+	if v.protocol == 0 {
+		v.protocol = 1
+	}
+	if v.format == 0 {
+		v.format = FormatBase
+	}
+	if v.minFormat == 0 {
+		v.minFormat = FormatBase
+	}
+	return v
+}
+
+// stamp advertises this build's versions on an outgoing message
+func (m *Message) stamp() {
+	m.Version = ProtocolVersion
+	m.Format = DataFormat
+	m.MinFormat = MinDataFormat
+}
+
+// negotiateFormat picks the newest data format both sides understand
+func negotiateFormat(theirs peerVersion) (int, error) {
+	format := DataFormat
+	if theirs.format < format {
+		format = theirs.format
+	}
+	if format < MinDataFormat || format < theirs.minFormat {
+		return 0, fmt.Errorf("%w: peer supports formats %d-%d, we support %d-%d",
+			ErrIncompatibleVersion, theirs.minFormat, theirs.format, MinDataFormat, DataFormat)
+	}
+	return format, nil
+}
+
+// downgradeState strips the fields a peer using format does not know
+func downgradeState(state crdt.ReplicaState, format int) crdt.ReplicaState {
+	if format < FormatAcks {
+		state.Acks = nil
+	}
+	if format < FormatACLs {
+		state.ACLs = nil
+	}
+	return state
+}
+
+// send stamps msg with our versions and state budget and writes it to
+// the stream
+func (e *SyncEngine) send(stream Stream, msg *Message) error {
+	msg.stamp()
+	msg.Budget = e.config.StateBudget
+	return e.chaos.send(stream, msg)
+}
+
+// stateHash hashes our state as a peer using format would see it
+func (e *SyncEngine) stateHash(format int) []byte {
+	if format >= DataFormat {
+		return e.provider.StateHash()
+	}
+	return ComputeStateHash(downgradeState(e.provider.GetState(), format))
+}
+
+// outgoingState returns our state as a peer using format reads it
+func (e *SyncEngine) outgoingState(format int) crdt.ReplicaState {
+	state := e.provider.GetState()
+	if format < DataFormat {
+		atomic.AddInt64(&e.downgrades, 1)
+		state = downgradeState(state, format)
+	}
+	return state
+}
+
+// encodeState serializes our state for a peer using format
+func (e *SyncEngine) encodeState(format int) []byte {
+	data, _ := json.Marshal(e.outgoingState(format))
+	return data
+}
@@ -0,0 +1,142 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/amaydixit11/acorde/internal/core"
+	"github.com/amaydixit11/acorde/internal/crdt"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		peer    peerVersion
+		want    int
+		wantErr bool
+	}{
+		{"same", peerVersion{ProtocolVersion, DataFormat, MinDataFormat}, DataFormat, false},
+		{"legacy", versionOf(&Message{}), FormatBase, false},
+		{"older", peerVersion{2, FormatACLs, FormatBase}, FormatACLs, false},
+		{"newer", peerVersion{3, DataFormat + 1, FormatBase}, DataFormat, false},
+		{"too new", peerVersion{3, DataFormat + 2, DataFormat + 1}, 0, true},
+		{"too old", peerVersion{1, MinDataFormat - 1, MinDataFormat - 1}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := negotiateFormat(tt.peer)
+			if tt.wantErr {
+				if !errors.Is(err, ErrIncompatibleVersion) {
+					t.Errorf("expected ErrIncompatibleVersion, got %v", err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("expected format %d, got %d (%v)", tt.want, got, err)
+			}
+		})
+	}
+}
+
+// newVersionedReplica returns a replica holding an entry with an ACL and an ack
+func newVersionedReplica() *crdt.Replica {
+	replica := crdt.NewReplica(core.NewClock())
+	entry := replica.AddEntry(core.Note, []byte("versioned"), []string{"tag"})
+	replica.SetACL(core.ACL{EntryID: entry.ID, Owner: "peer-a", Timestamp: 1})
+	replica.SetAck(core.Ack{EntryID: entry.ID, Peer: "peer-b", Version: 1, Timestamp: 1})
+	return replica
+}
+
+func TestDowngradeState(t *testing.T) {
+	state := newVersionedReplica().State()
+
+	acls := downgradeState(state, FormatACLs)
+	if len(acls.ACLs) != 1 || len(acls.Acks) != 0 {
+		t.Errorf("format %d: expected ACLs without acks, got %d ACLs and %d acks", FormatACLs, len(acls.ACLs), len(acls.Acks))
+	}
+
+	base := downgradeState(state, FormatBase)
+	if len(base.Entries) != 1 || len(base.Tags) != 1 || base.ACLs != nil || base.Acks != nil {
+		t.Errorf("format %d: expected only entries and tags, got %+v", FormatBase, base)
+	}
+
+	if full := downgradeState(state, DataFormat); len(full.ACLs) != 1 || len(full.Acks) != 1 {
+		t.Errorf("current format should keep every field")
+	}
+}
+
+// TestSyncVersionNegotiation talks to a sync service over a raw stream as
+// a legacy peer and as a peer sharing no data format
+func TestSyncVersionNegotiation(t *testing.T) {
+	provider := &mockStateProvider{replica: newVersionedReplica()}
+	cfg := DefaultConfig()
+	cfg.EnableMDNS = false
+	cfg.ListenAddrs = []string{"/ip4/127.0.0.1/tcp/0"}
+
+	svc, err := NewP2PService(provider, cfg)
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+	client, err := NewP2PService(newMockProvider(), cfg)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, s := range []SyncService{svc, client} {
+		if err := s.Start(ctx); err != nil {
+			t.Fatalf("failed to start: %v", err)
+		}
+		defer s.Stop()
+	}
+	server := svc.(*p2pService)
+	host := client.(*p2pService).host
+	if err := host.Connect(ctx, server.host.Peerstore().PeerInfo(server.host.ID())); err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+
+	exchange := func(msg *Message) *Message {
+		stream, err := host.NewStream(ctx, server.host.ID(), protocol.ID(ProtocolID))
+		if err != nil {
+			t.Fatalf("failed to open stream: %v", err)
+		}
+		defer stream.Close()
+		if err := writeMessage(stream, msg); err != nil {
+			t.Fatalf("failed to write: %v", err)
+		}
+		resp, err := readMessage(stream)
+		if err != nil {
+			t.Fatalf("failed to read: %v", err)
+		}
+		return resp
+	}
+
+	// A legacy peer (no version fields) gets the base format only
+	resp := exchange(&Message{Type: MsgStateRequest})
+	if resp.Type != MsgState || resp.Version != ProtocolVersion {
+		t.Fatalf("expected versioned state, got type %d version %d", resp.Type, resp.Version)
+	}
+	var state crdt.ReplicaState
+	if err := json.Unmarshal(resp.State, &state); err != nil {
+		t.Fatalf("failed to decode state: %v", err)
+	}
+	if len(state.Entries) != 1 || state.ACLs != nil || state.Acks != nil {
+		t.Errorf("expected stripped state, got %d entries, %d ACLs, %d acks", len(state.Entries), len(state.ACLs), len(state.Acks))
+	}
+
+	// A peer whose oldest format is newer than ours is refused
+	resp = exchange(&Message{Type: MsgStateHash, Version: 3, Format: DataFormat + 2, MinFormat: DataFormat + 1})
+	if resp.Type != MsgRefuse || resp.Reason == "" {
+		t.Errorf("expected refusal with reason, got type %d %q", resp.Type, resp.Reason)
+	}
+
+	m := svc.Metrics()
+	if m.Downgrades != 1 || m.VersionRefusals != 1 {
+		t.Errorf("expected 1 downgrade and 1 refusal, got %+v", m)
+	}
+}
@@ -0,0 +1,171 @@
+// Package templates implements entry templates: named content skeletons
+// with a type and default tags that new entries are created from, filling
+// in {{variables}} such as the date or a title.
+package templates
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Tag marks the config entries holding templates
+const Tag = "template"
+
+// kind identifies template content among config entries
+const kind = "template"
+
+// ErrMissingVariable is returned by Render for a variable it was not
+// given a value for
+var ErrMissingVariable = errors.New("missing template variable")
+
+// templateName is what template names may contain
+var templateName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// variable matches a {{name}} placeholder; other text in braces is kept
+// as is
+var variable = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// builtins are the variables Render fills in from the current time unless
+// given other values
+var builtins = map[string]func(time.Time) string{
+	"date":     func(t time.Time) string { return t.Format("2006-01-02") },
+	"time":     func(t time.Time) string { return t.Format("15:04") },
+	"datetime": func(t time.Time) string { return t.Format(time.RFC3339) },
+	"weekday":  func(t time.Time) string { return t.Weekday().String() },
+}
+
+// Template is a named skeleton for new entries. Content and tags may hold
+// {{variables}}: the built-in date, time, datetime and weekday, or any
+// other name, such as {{title}}, whose value is given when the template
+// is used.
+type Template struct {
+	ID      uuid.UUID `json:"-"` // ID of the config entry holding the template
+	Name    string    `json:"name"`
+	Type    string    `json:"type"`
+	Content string    `json:"content"`
+	Tags    []string  `json:"tags,omitempty"`
+}
+
+// templateContent is the content of a config entry holding a template
+type templateContent struct {
+	Kind string `json:"kind"`
+	Template
+}
+
+// ValidateName checks that a template name is non-empty and made of
+// letters, digits, '_', '.' and '-'
+func ValidateName(name string) error {
+	if !templateName.MatchString(name) {
+		return fmt.Errorf("invalid template name %q: use letters, digits, '_', '.' and '-'", name)
+	}
+	return nil
+}
+
+// Validate checks the template's name, defaults its type to note and
+// drops empty and duplicate tags
+func (t *Template) Validate() error {
+	if err := ValidateName(t.Name); err != nil {
+		return err
+	}
+	if t.Type == "" {
+		t.Type = "note"
+	}
+	tags := make([]string, 0, len(t.Tags))
+	for _, tag := range t.Tags {
+		if tag = strings.TrimSpace(tag); tag != "" && !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	t.Tags = tags
+	return nil
+}
+
+// Encode returns the content of a config entry holding the template
+func Encode(t Template) ([]byte, error) {
+	return json.Marshal(templateContent{Kind: kind, Template: t})
+}
+
+// Decode parses and validates the content of a config entry holding a
+// template
+func Decode(id uuid.UUID, content []byte) (Template, error) {
+	var tc templateContent
+	if err := json.Unmarshal(content, &tc); err != nil {
+		return Template{}, fmt.Errorf("invalid template: %w", err)
+	}
+	if tc.Kind != kind {
+		return Template{}, fmt.Errorf("not a template: kind %q", tc.Kind)
+	}
+	t := tc.Template
+	t.ID = id
+	if err := t.Validate(); err != nil {
+		return Template{}, err
+	}
+	return t, nil
+}
+
+// Sort orders templates by name, then ID
+func Sort(list []Template) {
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Name != list[j].Name {
+			return list[i].Name < list[j].Name
+		}
+		return list[i].ID.String() < list[j].ID.String()
+	})
+}
+
+// Variables returns the variables the template needs values for, in the
+// order they first appear: every one but the built-ins
+func (t *Template) Variables() []string {
+	var names []string
+	for _, text := range append([]string{t.Content}, t.Tags...) {
+		for _, m := range variable.FindAllStringSubmatch(text, -1) {
+			if _, builtin := builtins[m[1]]; !builtin && !slices.Contains(names, m[1]) {
+				names = append(names, m[1])
+			}
+		}
+	}
+	return names
+}
+
+// Render fills in the template's variables, from vars or else the
+// built-ins at now, and returns the content and tags of a new entry.
+// Variables without a value fail with ErrMissingVariable; tags that
+// render empty are dropped.
+func (t *Template) Render(vars map[string]string, now time.Time) (string, []string, error) {
+	var missing []string
+	expand := func(text string) string {
+		return variable.ReplaceAllStringFunc(text, func(placeholder string) string {
+			name := variable.FindStringSubmatch(placeholder)[1]
+			if value, ok := vars[name]; ok {
+				return value
+			}
+			if builtin, ok := builtins[name]; ok {
+				return builtin(now)
+			}
+			if !slices.Contains(missing, name) {
+				missing = append(missing, name)
+			}
+			return placeholder
+		})
+	}
+
+	content := expand(t.Content)
+	tags := make([]string, 0, len(t.Tags))
+	for _, tag := range t.Tags {
+		if tag = strings.TrimSpace(expand(tag)); tag != "" && !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	if len(missing) > 0 {
+		return "", nil, fmt.Errorf("%w: %s", ErrMissingVariable, strings.Join(missing, ", "))
+	}
+	return content, tags, nil
+}
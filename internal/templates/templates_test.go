@@ -0,0 +1,67 @@
+package templates
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestRender(t *testing.T) {
+	tmpl := Template{
+		Name:    "meeting",
+		Content: "# {{ title }} ({{date}}, {{weekday}})\n\nAttendees: {{who}}\n{{not a variable}}",
+		Tags:    []string{"meeting", "{{project}}", "{{date}}"},
+	}
+	if err := tmpl.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if tmpl.Type != "note" {
+		t.Errorf("expected the type to default to note, got %q", tmpl.Type)
+	}
+	if got, want := tmpl.Variables(), []string{"title", "who", "project"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Variables = %q, want %q", got, want)
+	}
+
+	now := time.Date(2024, 3, 15, 9, 30, 0, 0, time.UTC)
+	content, tags, err := tmpl.Render(map[string]string{"title": "Standup", "who": "ana, bo", "project": ""}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "# Standup (2024-03-15, Friday)\n\nAttendees: ana, bo\n{{not a variable}}"; content != want {
+		t.Errorf("content = %q, want %q", content, want)
+	}
+	if want := []string{"meeting", "2024-03-15"}; !reflect.DeepEqual(tags, want) {
+		t.Errorf("tags = %q, want %q", tags, want)
+	}
+
+	_, _, err = tmpl.Render(map[string]string{"title": "Standup"}, now)
+	if !errors.Is(err, ErrMissingVariable) || err.Error() != "missing template variable: who, project" {
+		t.Errorf("expected the missing variables to be named, got %v", err)
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	tmpl := Template{Name: "daily", Type: "log", Content: "{{date}}", Tags: []string{"journal", "journal", " "}}
+	content, err := Encode(tmpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := uuid.New()
+	decoded, err := Decode(id, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.ID != id || decoded.Name != "daily" || decoded.Type != "log" || !reflect.DeepEqual(decoded.Tags, []string{"journal"}) {
+		t.Errorf("unexpected template %+v", decoded)
+	}
+
+	if _, err := Decode(id, []byte(`{"kind":"rule","name":"daily"}`)); err == nil {
+		t.Error("expected other config content to be rejected")
+	}
+	if _, err := Decode(id, []byte(`{"kind":"template","name":"no spaces"}`)); err == nil {
+		t.Error("expected an invalid name to be rejected")
+	}
+}
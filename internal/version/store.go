@@ -4,12 +4,18 @@ package version
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// ErrNotFound is returned by GetVersion for an unknown version
+var ErrNotFound = errors.New("version not found")
+
 // Version represents a historical version of an entry
 type Version struct {
 	ID        int64     `json:"id"`
@@ -25,7 +31,7 @@ type Version struct {
 type Diff struct {
 	OldVersion   int64  `json:"old_version"`
 	NewVersion   int64  `json:"new_version"`
-	ContentDiff  string `json:"content_diff,omitempty"`
+	ContentDiff  string `json:"content_diff,omitempty"` // Line diff, see diffLines
 	TagsAdded    []string `json:"tags_added,omitempty"`
 	TagsRemoved  []string `json:"tags_removed,omitempty"`
 }
@@ -64,16 +70,31 @@ func (s *Store) initSchema() error {
 
 		CREATE INDEX IF NOT EXISTS idx_versions_entry_id ON entry_versions(entry_id);
 		CREATE INDEX IF NOT EXISTS idx_versions_timestamp ON entry_versions(timestamp);
+		CREATE INDEX IF NOT EXISTS idx_versions_created_at ON entry_versions(created_at);
 	`
 	_, err := s.db.Exec(schema)
 	return err
 }
 
+// execer is a *sql.DB or a *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
 // SaveVersion saves a new version of an entry
 func (s *Store) SaveVersion(entryID uuid.UUID, content []byte, tags []string, timestamp uint64, author string) error {
+	return s.saveVersion(s.db, entryID, content, tags, timestamp, author)
+}
+
+// SaveVersionTx saves a new version of an entry inside tx
+func (s *Store) SaveVersionTx(tx *sql.Tx, entryID uuid.UUID, content []byte, tags []string, timestamp uint64, author string) error {
+	return s.saveVersion(tx, entryID, content, tags, timestamp, author)
+}
+
+func (s *Store) saveVersion(db execer, entryID uuid.UUID, content []byte, tags []string, timestamp uint64, author string) error {
 	tagsJSON, _ := json.Marshal(tags)
 
-	_, err := s.db.Exec(`
+	_, err := db.Exec(`
 		INSERT INTO entry_versions (entry_id, content, tags, timestamp, created_at, author)
 		VALUES (?, ?, ?, ?, ?, ?)
 	`, entryID.String(), content, tagsJSON, timestamp, time.Now().Unix(), author)
@@ -84,20 +105,136 @@ func (s *Store) SaveVersion(entryID uuid.UUID, content []byte, tags []string, ti
 
 	// Prune old versions if limit set
 	if s.maxVersions > 0 {
-		return s.pruneVersions(entryID)
+		return s.pruneVersions(db, entryID)
 	}
 
 	return nil
 }
 
+// SaveVersions saves several versions in a single transaction.
+// Only EntryID, Content, Tags, Timestamp, CreatedAt (zero = now) and
+// Author are used.
+func (s *Store) SaveVersions(versions []Version) error {
+	if len(versions) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO entry_versions (entry_id, content, tags, timestamp, created_at, author)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare version insert: %w", err)
+	}
+	defer stmt.Close()
+
+	now := time.Now().Unix()
+	touched := make(map[uuid.UUID]struct{})
+	for _, v := range versions {
+		tagsJSON, _ := json.Marshal(v.Tags)
+		createdAt := now
+		if !v.CreatedAt.IsZero() {
+			createdAt = v.CreatedAt.Unix()
+		}
+		if _, err := stmt.Exec(v.EntryID.String(), v.Content, tagsJSON, v.Timestamp, createdAt, v.Author); err != nil {
+			return fmt.Errorf("failed to save version: %w", err)
+		}
+		touched[v.EntryID] = struct{}{}
+	}
+
+	// Prune old versions if limit set
+	if s.maxVersions > 0 {
+		for entryID := range touched {
+			if _, err := tx.Exec(`
+				DELETE FROM entry_versions 
+				WHERE entry_id = ? AND id NOT IN (
+					SELECT id FROM entry_versions 
+					WHERE entry_id = ? 
+					ORDER BY timestamp DESC 
+					LIMIT ?
+				)
+			`, entryID.String(), entryID.String(), s.maxVersions); err != nil {
+				return fmt.Errorf("failed to prune versions: %w", err)
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// RewriteContent replaces the content of every stored version with the
+// result of fn, in a single transaction (used when re-encrypting history
+// after a key rotation). Rows for which fn returns an error are left as is.
+func (s *Store) RewriteContent(fn func(entryID uuid.UUID, content []byte) ([]byte, error)) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT id, entry_id, content FROM entry_versions`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read versions: %w", err)
+	}
+
+	type rewrite struct {
+		id      int64
+		content []byte
+	}
+	var rewrites []rewrite
+	for rows.Next() {
+		var id int64
+		var entryIDStr string
+		var content []byte
+		if err := rows.Scan(&id, &entryIDStr, &content); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		entryID, err := uuid.Parse(entryIDStr)
+		if err != nil {
+			continue
+		}
+		if updated, err := fn(entryID, content); err == nil {
+			rewrites = append(rewrites, rewrite{id: id, content: updated})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, r := range rewrites {
+		if _, err := tx.Exec(`UPDATE entry_versions SET content = ? WHERE id = ?`, r.content, r.id); err != nil {
+			return 0, fmt.Errorf("failed to rewrite version: %w", err)
+		}
+	}
+	return len(rewrites), tx.Commit()
+}
+
 // GetHistory returns all versions of an entry, newest first
 func (s *Store) GetHistory(entryID uuid.UUID) ([]Version, error) {
+	return s.GetHistoryPage(entryID, 0, 0)
+}
+
+// GetHistoryPage returns up to limit versions of an entry (0 = all),
+// newest first, skipping the newest offset
+func (s *Store) GetHistoryPage(entryID uuid.UUID, limit, offset int) ([]Version, error) {
+	if limit <= 0 {
+		limit = -1 // No limit
+	}
 	rows, err := s.db.Query(`
 		SELECT id, entry_id, content, tags, timestamp, created_at, author
 		FROM entry_versions
 		WHERE entry_id = ?
-		ORDER BY timestamp DESC
-	`, entryID.String())
+		ORDER BY timestamp DESC, id DESC
+		LIMIT ? OFFSET ?
+	`, entryID.String(), limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get history: %w", err)
 	}
@@ -143,7 +280,7 @@ func (s *Store) GetVersion(entryID uuid.UUID, versionID int64) (*Version, error)
 	`, entryID.String(), versionID).Scan(&v.ID, &entryIDStr, &v.Content, &tagsJSON, &v.Timestamp, &createdAtUnix, &author)
 
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("version not found")
+		return nil, ErrNotFound
 	}
 	if err != nil {
 		return nil, err
@@ -201,6 +338,161 @@ func (s *Store) GetVersionCount(entryID uuid.UUID) (int, error) {
 	return count, err
 }
 
+// Totals returns the number of stored versions and of entries that have
+// any
+func (s *Store) Totals() (versions, entries int, err error) {
+	err = s.db.QueryRow(`
+		SELECT COUNT(*), COUNT(DISTINCT entry_id) FROM entry_versions
+	`).Scan(&versions, &entries)
+	return versions, entries, err
+}
+
+// FirstSavedAt returns the wall-clock time of the oldest stored version of an entry.
+// Returns false if the entry has no stored versions.
+func (s *Store) FirstSavedAt(entryID uuid.UUID) (time.Time, bool) {
+	var createdAt sql.NullInt64
+	err := s.db.QueryRow(`
+		SELECT MIN(created_at) FROM entry_versions WHERE entry_id = ?
+	`, entryID.String()).Scan(&createdAt)
+	if err != nil || !createdAt.Valid {
+		return time.Time{}, false
+	}
+	return time.Unix(createdAt.Int64, 0), true
+}
+
+// SavedSpan is when the oldest and newest stored versions of an entry
+// were saved
+type SavedSpan struct {
+	First time.Time
+	Last  time.Time
+}
+
+// spanChunk bounds the IDs per query, below SQLite's variable limit
+const spanChunk = 500
+
+// SavedSpans returns the SavedSpan of each of ids that has stored versions
+func (s *Store) SavedSpans(ids []uuid.UUID) (map[uuid.UUID]SavedSpan, error) {
+	spans := make(map[uuid.UUID]SavedSpan, len(ids))
+	for start := 0; start < len(ids); start += spanChunk {
+		chunk := ids[start:min(start+spanChunk, len(ids))]
+		args := make([]interface{}, len(chunk))
+		for i, id := range chunk {
+			args[i] = id.String()
+		}
+
+		rows, err := s.db.Query(`
+			SELECT entry_id, MIN(created_at), MAX(created_at) FROM entry_versions
+			WHERE entry_id IN (?`+strings.Repeat(", ?", len(chunk)-1)+`)
+			GROUP BY entry_id
+		`, args...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read version times: %w", err)
+		}
+		for rows.Next() {
+			var idStr string
+			var first, last int64
+			if err := rows.Scan(&idStr, &first, &last); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan version times: %w", err)
+			}
+			if id, err := uuid.Parse(idStr); err == nil {
+				spans[id] = SavedSpan{First: time.Unix(first, 0), Last: time.Unix(last, 0)}
+			}
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return spans, nil
+}
+
+// AuthorActivity is an author of versions of an entry: the time the
+// newest of them was saved, and how many there are
+type AuthorActivity struct {
+	Author   string
+	LastEdit time.Time
+	Edits    int
+}
+
+// RecentAuthors returns the authors of an entry's versions saved at or
+// after since, most recent first. Versions without an author are left out.
+func (s *Store) RecentAuthors(entryID uuid.UUID, since time.Time) ([]AuthorActivity, error) {
+	rows, err := s.db.Query(`
+		SELECT author, MAX(created_at), COUNT(*)
+		FROM entry_versions
+		WHERE entry_id = ? AND created_at >= ? AND author IS NOT NULL AND author != ''
+		GROUP BY author
+		ORDER BY MAX(created_at) DESC, author
+	`, entryID.String(), since.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recent authors: %w", err)
+	}
+	defer rows.Close()
+
+	var authors []AuthorActivity
+	for rows.Next() {
+		var a AuthorActivity
+		var lastUnix int64
+		if err := rows.Scan(&a.Author, &lastUnix, &a.Edits); err != nil {
+			return nil, err
+		}
+		a.LastEdit = time.Unix(lastUnix, 0)
+		authors = append(authors, a)
+	}
+	return authors, rows.Err()
+}
+
+// Between returns up to limit versions of any entry (0 = all) saved at
+// or after since and before until (zero = unbounded), most recently saved
+// first, skipping the newest offset
+func (s *Store) Between(since, until time.Time, limit, offset int) ([]Version, error) {
+	if limit <= 0 {
+		limit = -1 // No limit
+	}
+	query := `
+		SELECT id, entry_id, content, tags, timestamp, created_at, author
+		FROM entry_versions
+		WHERE created_at >= ?`
+	args := []interface{}{since.Unix()}
+	if since.IsZero() {
+		args[0] = int64(0)
+	}
+	if !until.IsZero() {
+		query += ` AND created_at < ?`
+		args = append(args, until.Unix())
+	}
+	query += `
+		ORDER BY created_at DESC, id DESC
+		LIMIT ? OFFSET ?`
+	rows, err := s.db.Query(query, append(args, limit, offset)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get versions: %w", err)
+	}
+	defer rows.Close()
+
+	var versions []Version
+	for rows.Next() {
+		var v Version
+		var entryIDStr string
+		var tagsJSON []byte
+		var createdAtUnix int64
+		var author sql.NullString
+		if err := rows.Scan(&v.ID, &entryIDStr, &v.Content, &tagsJSON, &v.Timestamp, &createdAtUnix, &author); err != nil {
+			return nil, err
+		}
+		v.EntryID, _ = uuid.Parse(entryIDStr)
+		v.CreatedAt = time.Unix(createdAtUnix, 0)
+		json.Unmarshal(tagsJSON, &v.Tags)
+		if author.Valid {
+			v.Author = author.String
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
 // DeleteVersions removes all versions for an entry
 func (s *Store) DeleteVersions(entryID uuid.UUID) error {
 	_, err := s.db.Exec(`DELETE FROM entry_versions WHERE entry_id = ?`, entryID.String())
@@ -208,8 +500,8 @@ func (s *Store) DeleteVersions(entryID uuid.UUID) error {
 }
 
 // pruneVersions removes old versions beyond the limit
-func (s *Store) pruneVersions(entryID uuid.UUID) error {
-	_, err := s.db.Exec(`
+func (s *Store) pruneVersions(db execer, entryID uuid.UUID) error {
+	_, err := db.Exec(`
 		DELETE FROM entry_versions 
 		WHERE entry_id = ? AND id NOT IN (
 			SELECT id FROM entry_versions 
@@ -228,9 +520,8 @@ func ComputeDiff(old, new *Version) *Diff {
 		NewVersion: new.ID,
 	}
 
-	// Simple content diff (just show if changed)
 	if string(old.Content) != string(new.Content) {
-		diff.ContentDiff = "content changed"
+		diff.ContentDiff = diffLines(string(old.Content), string(new.Content))
 	}
 
 	// Compute tag changes
@@ -255,6 +546,54 @@ func ComputeDiff(old, new *Version) *Diff {
 			diff.TagsRemoved = append(diff.TagsRemoved, t)
 		}
 	}
+	sort.Strings(diff.TagsAdded)
+	sort.Strings(diff.TagsRemoved)
 
 	return diff
 }
+
+// maxDiffCells bounds the line comparison table of diffLines
+const maxDiffCells = 4 << 20
+
+// diffLines returns a line diff of two texts: each line prefixed with
+// "-" (removed), "+" (added) or " " (kept). Texts too long to compare
+// line by line get "content changed".
+func diffLines(old, new string) string {
+	a, b := strings.Split(old, "\n"), strings.Split(new, "\n")
+	if (len(a)+1)*(len(b)+1) > maxDiffCells {
+		return "content changed"
+	}
+
+	// lcs[i][j] is the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var sb strings.Builder
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			sb.WriteString(" " + a[i] + "\n")
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			sb.WriteString("-" + a[i] + "\n")
+			i++
+		default:
+			sb.WriteString("+" + b[j] + "\n")
+			j++
+		}
+	}
+	return sb.String()
+}
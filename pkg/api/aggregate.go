@@ -0,0 +1,97 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/amaydixit11/acorde/pkg/engine"
+)
+
+// AggregateResponse is the response of GET /aggregate
+type AggregateResponse struct {
+	Bucket   engine.Bucket            `json:"bucket"`
+	Agg      engine.AggregateFunc     `json:"agg"`
+	Field    string                   `json:"field,omitempty"`
+	Timezone string                   `json:"timezone"`
+	Buckets  []engine.AggregateBucket `json:"buckets"`
+}
+
+// handleAggregate handles
+// GET /aggregate?bucket=day&agg=count&field=...&type=...&tag=...&since=...&until=...&tz=...
+func (s *Server) handleAggregate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := r.URL.Query()
+	bucket := engine.Bucket(params.Get("bucket"))
+	if bucket == "" {
+		bucket = engine.BucketDay
+	}
+	agg := engine.Aggregation{
+		Func:  engine.AggregateFunc(params.Get("agg")),
+		Field: params.Get("field"),
+	}
+	if agg.Func == "" {
+		agg.Func = engine.AggCount
+	}
+
+	loc := time.UTC
+	if tz := params.Get("tz"); tz != "" {
+		l, err := time.LoadLocation(tz)
+		if err != nil {
+			http.Error(w, "Invalid tz", http.StatusBadRequest)
+			return
+		}
+		loc = l
+	}
+	filter := engine.AggregateFilter{Location: loc}
+	if t := params.Get("type"); t != "" {
+		entryType := engine.EntryType(t)
+		filter.Type = &entryType
+	}
+	if tag := params.Get("tag"); tag != "" {
+		filter.Tag = &tag
+	}
+	var err error
+	if filter.Since, err = parseAggregateTime(params.Get("since"), loc); err != nil {
+		http.Error(w, "Invalid since: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if filter.Until, err = parseAggregateTime(params.Get("until"), loc); err != nil {
+		http.Error(w, "Invalid until: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	buckets, err := s.engine.Aggregate(filter, bucket, agg)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, AggregateResponse{
+		Bucket:   bucket,
+		Agg:      agg.Func,
+		Field:    agg.Field,
+		Timezone: loc.String(),
+		Buckets:  buckets,
+	})
+}
+
+// parseAggregateTime parses an RFC 3339 time, or a YYYY-MM-DD date at
+// midnight in loc ("" is the zero time)
+func parseAggregateTime(s string, loc *time.Location) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", s, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("use RFC 3339 or YYYY-MM-DD")
+	}
+	return t, nil
+}
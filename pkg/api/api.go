@@ -3,36 +3,108 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/amaydixit11/acorde/pkg/engine"
 	"github.com/google/uuid"
+	"golang.org/x/time/rate"
 )
 
 // Server is the HTTP API server
 type Server struct {
-	engine    engine.Engine
-	mux       *http.ServeMux
-	peerCount func() int
+	engine     engine.Engine
+	mux        *http.ServeMux
+	syncStatus func() SyncStatus
+	blobs      engine.BlobStore // nil = file content not served
+	blobRate   *rate.Limiter    // Bandwidth shared by blob responses (nil = unlimited)
+	pairing    Pairing          // nil = /sync endpoints disabled
+	token      string           // Bearer token required by every request ("" = none)
+
+	namespaceTokens map[string]string // Tokens limited to a namespace, to their namespace
+
+	syncSessions func() []SyncSession // nil = /sync/sessions disabled
+
+	started   time.Time
+	readiness []ReadinessCheck // Checked by /readyz after the database
+}
+
+// SyncStatus describes the state of the sync service running alongside
+// the API server (daemon mode). It is reported under "sync" in /status.
+type SyncStatus struct {
+	PeerCount     int   `json:"peer_count"`
+	SyncAttempts  int64 `json:"sync_attempts"`
+	SyncSuccesses int64 `json:"sync_successes"`
+	SyncFailures  int64 `json:"sync_failures"`
+	GatedDials    int64 `json:"gated_dials"`   // Connections to disallowed peers refused
+	GatedAccepts  int64 `json:"gated_accepts"` // Connections from disallowed peers refused
+
+	// PeerHealth counts the peers synced with by health status (ok,
+	// backing_off, quarantined)
+	PeerHealth map[string]int `json:"peer_health,omitempty"`
+
+	// Merges sums the merges of states received from peers
+	Merges MergeStatus `json:"merges"`
+}
+
+// MergeStatus sums the merges of states received from peers
+type MergeStatus struct {
+	Merges        int64 `json:"merges"`
+	SlowMerges    int64 `json:"slow_merges"`     // Over the daemon's slow merge threshold
+	DurationMS    int64 `json:"duration_ms"`     // Time spent merging
+	MaxDurationMS int64 `json:"max_duration_ms"` // Longest merge
+	Compared      int64 `json:"entries_compared"`
+	Changed       int64 `json:"entries_changed"`
+	Tombstones    int64 `json:"tombstones"`
 }
 
-// New creates a new API server
-func New(e engine.Engine, peerCount func() int) *Server {
+// New creates a new API server.
+// syncStatus is optional; pass nil when no sync service shares the engine.
+func New(e engine.Engine, syncStatus func() SyncStatus) *Server {
 	s := &Server{
-		engine:    e,
-		mux:       http.NewServeMux(),
-		peerCount: peerCount,
+		engine:     e,
+		mux:        http.NewServeMux(),
+		syncStatus: syncStatus,
+		started:    time.Now(),
 	}
 	s.setupRoutes()
 	return s
 }
 
+// SetBlobStore lets the server serve the blobs and thumbnails of File
+// entries, from the vault's blob store
+func (s *Server) SetBlobStore(blobs engine.BlobStore) {
+	s.blobs = blobs
+}
+
 func (s *Server) setupRoutes() {
 	s.mux.HandleFunc("/entries", s.handleEntries)
 	s.mux.HandleFunc("/entries/", s.handleEntry)
+	s.mux.HandleFunc("/search", s.handleSearch)
+	s.mux.HandleFunc("/quickopen", s.handleQuickOpen)
+	s.mux.HandleFunc("/aggregate", s.handleAggregate)
+	s.mux.HandleFunc("/timeline", s.handleTimeline)
 	s.mux.HandleFunc("/status", s.handleStatus)
+	s.mux.HandleFunc("/stats", s.handleStats)
 	s.mux.HandleFunc("/events", s.handleEvents)
+	s.mux.HandleFunc("/groups", s.handleGroups)
+	s.mux.HandleFunc("/groups/", s.handleGroups)
+	s.mux.HandleFunc("/collections", s.handleCollections)
+	s.mux.HandleFunc("/collections/", s.handleCollections)
+	s.mux.HandleFunc("/templates", s.handleTemplates)
+	s.mux.HandleFunc("/templates/", s.handleTemplates)
+	s.mux.HandleFunc("/webhooks", s.handleWebhooks)
+	s.mux.HandleFunc("/webhooks/", s.handleWebhooks)
+	s.mux.HandleFunc("/sync/", s.handleSync)
+	s.mux.HandleFunc("/sync/sessions", s.handleSyncSessions)
+	s.mux.HandleFunc("/healthz", s.handleHealthz)
+	s.mux.HandleFunc("/readyz", s.handleReadyz)
 }
 
 // ServeHTTP implements http.Handler
@@ -40,12 +112,24 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// CORS headers
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Range, If-None-Match")
 
 	if r.Method == http.MethodOptions {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
+	if namespace, ok := s.tokenNamespace(r); ok {
+		if !namespacedRoute(r) {
+			http.Error(w, "Not available to namespace tokens", http.StatusForbidden)
+			return
+		}
+		r = withNamespace(r, namespace)
+	} else if !s.authorized(r) && r.URL.Path != "/healthz" && r.URL.Path != "/readyz" {
+		// Probes carry no token
+		w.Header().Set("WWW-Authenticate", `Bearer realm="acorde"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
 
 	s.mux.ServeHTTP(w, r)
 }
@@ -55,19 +139,21 @@ func (s *Server) ListenAndServe(addr string) error {
 	return http.ListenAndServe(addr, s)
 }
 
-// handleEntries handles GET /entries and POST /entries
+// handleEntries handles GET, POST and DELETE /entries
 func (s *Server) handleEntries(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
 		s.listEntries(w, r)
 	case http.MethodPost:
 		s.createEntry(w, r)
+	case http.MethodDelete:
+		s.deleteEntries(w, r)
 	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
 
-// handleEntry handles GET/PUT/DELETE /entries/:id
+// handleEntry handles GET/PUT/PATCH/DELETE /entries/:id
 func (s *Server) handleEntry(w http.ResponseWriter, r *http.Request) {
 	// Extract ID from path
 	path := strings.TrimPrefix(r.URL.Path, "/entries/")
@@ -75,18 +161,59 @@ func (s *Server) handleEntry(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Missing entry ID", http.StatusBadRequest)
 		return
 	}
+	path, action, _ := strings.Cut(path, "/")
 
 	id, err := uuid.Parse(path)
 	if err != nil {
 		http.Error(w, "Invalid entry ID", http.StatusBadRequest)
 		return
 	}
+	if !s.inNamespace(r, id) {
+		http.Error(w, "entry not found: "+id.String(), http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case action == "share" && r.Method == http.MethodPost:
+		s.shareEntry(w, r, id)
+		return
+	case strings.HasPrefix(action, "groups/"):
+		s.entryGroup(w, r, id, strings.TrimPrefix(action, "groups/"))
+		return
+	case action == "acks" && r.Method == http.MethodGet:
+		s.entryAcks(w, r, id)
+		return
+	case action == "events" && r.Method == http.MethodGet:
+		s.entryEvents(w, r, id)
+		return
+	case (action == "archive" || action == "unarchive") && r.Method == http.MethodPost:
+		s.archiveEntry(w, r, id, action == "archive")
+		return
+	case action == "move" && r.Method == http.MethodPost:
+		s.moveEntry(w, r, id)
+		return
+	case (action == "blob" || action == "thumbnail") && (r.Method == http.MethodGet || r.Method == http.MethodHead):
+		s.entryBlob(w, r, id, action == "thumbnail")
+		return
+	case action == "rendered" && r.Method == http.MethodGet:
+		s.renderedEntry(w, r, id)
+		return
+	case strings.HasPrefix(action, "versions") || action == "diff" || action == "editors" || strings.HasPrefix(action, "restore/"):
+		action, rest, _ := strings.Cut(action, "/")
+		s.handleVersions(w, r, id, action, rest)
+		return
+	case action != "":
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
 
 	switch r.Method {
 	case http.MethodGet:
 		s.getEntry(w, r, id)
 	case http.MethodPut:
 		s.updateEntry(w, r, id)
+	case http.MethodPatch:
+		s.patchEntry(w, r, id)
 	case http.MethodDelete:
 		s.deleteEntry(w, r, id)
 	default:
@@ -98,46 +225,184 @@ func (s *Server) listEntries(w http.ResponseWriter, r *http.Request) {
 	filter := engine.ListFilter{}
 
 	// Parse query params
-	if t := r.URL.Query().Get("type"); t != "" {
+	params := r.URL.Query()
+	if t := params.Get("type"); t != "" {
 		entryType := engine.EntryType(t)
 		filter.Type = &entryType
 	}
-	if tag := r.URL.Query().Get("tag"); tag != "" {
+	if tag := params.Get("tag"); tag != "" {
 		filter.Tag = &tag
 	}
+	if namespace, ok := requestNamespace(r); ok {
+		filter.Namespace = &namespace
+	} else if params.Has("namespace") {
+		namespace := params.Get("namespace")
+		filter.Namespace = &namespace
+	}
+	if d := params.Get("deleted"); d != "" {
+		deleted, err := strconv.ParseBool(d)
+		if err != nil {
+			http.Error(w, "Invalid deleted", http.StatusBadRequest)
+			return
+		}
+		filter.Deleted = deleted
+	}
+	if c := params.Get("collection"); c != "" {
+		collection, err := s.collectionRef(c)
+		if err != nil {
+			collectionError(w, err)
+			return
+		}
+		filter.Collection = &collection
+		filter.Subcollections = params.Get("recursive") == "true"
+	}
+	switch params.Get("archived") {
+	case "", "false":
+	case "true":
+		filter.Archived = true
+	case "only":
+		filter.OnlyArchived = true
+	default:
+		http.Error(w, "Invalid archived (use true, false or only)", http.StatusBadRequest)
+		return
+	}
+	for name, bound := range map[string]**uint64{"since": &filter.Since, "until": &filter.Until} {
+		if v := params.Get(name); v != "" {
+			t, err := strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				http.Error(w, "Invalid "+name+" (use a logical clock time)", http.StatusBadRequest)
+				return
+			}
+			*bound = &t
+		}
+	}
+	switch sort := engine.SortField(params.Get("sort")); sort {
+	case "", engine.SortUpdatedAt, engine.SortCreatedAt, engine.SortTitle:
+		filter.Sort = sort
+	default:
+		http.Error(w, "Invalid sort (use created_at, updated_at or title)", http.StatusBadRequest)
+		return
+	}
+	switch params.Get("order") {
+	case "", "desc":
+	case "asc":
+		filter.Ascending = true
+	default:
+		http.Error(w, "Invalid order (use asc or desc)", http.StatusBadRequest)
+		return
+	}
+	if l := params.Get("limit"); l != "" {
+		limit, err := strconv.Atoi(l)
+		if err != nil || limit < 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = limit
+	}
+	if o := params.Get("offset"); o != "" {
+		offset, err := strconv.Atoi(o)
+		if err != nil || offset < 0 {
+			http.Error(w, "Invalid offset", http.StatusBadRequest)
+			return
+		}
+		filter.Offset = offset
+	}
+	if c := params.Get("content"); c != "" {
+		content, err := strconv.ParseBool(c)
+		if err != nil {
+			http.Error(w, "Invalid content", http.StatusBadRequest)
+			return
+		}
+		filter.WithoutContent = !content
+	}
 
-	entries, err := s.engine.ListEntries(filter)
+	listed, err := s.engine.ListEntriesChecked(filter)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	// Pages carry the total, for pagination
+	if filter.Limit > 0 || filter.Offset > 0 {
+		if total, err := s.engine.Count(filter); err == nil {
+			w.Header().Set("X-Total-Count", strconv.Itoa(total))
+			w.Header().Set("Access-Control-Expose-Headers", "X-Total-Count, X-Acorde-Corrupt-Entries")
+		}
+	}
+
+	// Entries that do not decrypt are left out and named in a header
+	if len(listed.Corrupt) > 0 {
+		ids := make([]string, len(listed.Corrupt))
+		for i, c := range listed.Corrupt {
+			ids[i] = c.ID.String()
+		}
+		w.Header().Set("X-Acorde-Corrupt-Entries", strings.Join(ids, ","))
+	}
+
+	entries := listed.Entries
+	for i, entry := range entries {
+		entries[i] = masked(r, entry)
+	}
 	respondJSON(w, http.StatusOK, entries)
 }
 
 func (s *Server) createEntry(w http.ResponseWriter, r *http.Request) {
+	if name := r.URL.Query().Get("template"); name != "" {
+		s.createFromTemplate(w, r, name)
+		return
+	}
+
 	var req struct {
-		Type    string   `json:"type"`
-		Content string   `json:"content"`
-		Tags    []string `json:"tags"`
+		Type      string   `json:"type"`
+		Content   string   `json:"content"`
+		Tags      []string `json:"tags"`
+		Namespace string   `json:"namespace"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
+	if namespace, ok := requestNamespace(r); ok {
+		if req.Namespace != "" && req.Namespace != namespace {
+			http.Error(w, "Token is limited to namespace "+strconv.Quote(namespace), http.StatusForbidden)
+			return
+		}
+		req.Namespace = namespace
+	}
 
 	entry, err := s.engine.AddEntry(engine.AddEntryInput{
-		Type:    engine.EntryType(req.Type),
-		Content: []byte(req.Content),
-		Tags:    req.Tags,
+		Type:      engine.EntryType(req.Type),
+		Content:   []byte(req.Content),
+		Tags:      req.Tags,
+		Namespace: req.Namespace,
 	})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		http.Error(w, err.Error(), entryErrorStatus(err, http.StatusBadRequest))
 		return
 	}
 
-	respondJSON(w, http.StatusCreated, entry)
+	respondJSON(w, http.StatusCreated, masked(r, entry))
+}
+
+// entryErrorStatus maps an error adding or updating an entry to a status
+func entryErrorStatus(err error, fallback int) int {
+	if errors.Is(err, engine.ErrLimitExceeded) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return fallback
+}
+
+// masked hides the secrets of a credential entry unless the request has
+// ?reveal=true
+func masked(r *http.Request, entry engine.Entry) engine.Entry {
+	if entry.Type != engine.Credential {
+		return entry
+	}
+	if reveal, _ := strconv.ParseBool(r.URL.Query().Get("reveal")); !reveal {
+		entry.Content = engine.MaskCredential(entry.Content)
+	}
+	return entry
 }
 
 func (s *Server) getEntry(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
@@ -147,7 +412,7 @@ func (s *Server) getEntry(w http.ResponseWriter, r *http.Request, id uuid.UUID)
 		return
 	}
 
-	respondJSON(w, http.StatusOK, entry)
+	respondJSON(w, http.StatusOK, masked(r, entry))
 }
 
 func (s *Server) updateEntry(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
@@ -171,13 +436,72 @@ func (s *Server) updateEntry(w http.ResponseWriter, r *http.Request, id uuid.UUI
 	}
 
 	if err := s.engine.UpdateEntry(id, input); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), entryErrorStatus(err, http.StatusInternalServerError))
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// patchEntry handles PATCH /entries/:id with a JSON Patch
+// (application/json-patch+json), a JSON Merge Patch
+// (application/merge-patch+json), or, as application/json,
+// {"patch": [...] or "merge": {...}, "add_tags": [...], "remove_tags": [...]}
+func (s *Server) patchEntry(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+	var patch engine.EntryPatch
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/json-patch+json":
+		if err := json.NewDecoder(r.Body).Decode(&patch.JSONPatch); err != nil || patch.JSONPatch == nil {
+			http.Error(w, "Invalid JSON Patch: expected an array of operations", http.StatusBadRequest)
+			return
+		}
+	case "application/merge-patch+json":
+		body, err := io.ReadAll(r.Body)
+		if err != nil || !json.Valid(body) {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		patch.MergePatch = body
+	case "application/json", "":
+		var req struct {
+			Patch      []engine.PatchOperation `json:"patch"`
+			Merge      json.RawMessage         `json:"merge"`
+			AddTags    []string                `json:"add_tags"`
+			RemoveTags []string                `json:"remove_tags"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		patch = engine.EntryPatch{JSONPatch: req.Patch, AddTags: req.AddTags, RemoveTags: req.RemoveTags}
+		if req.Merge != nil {
+			patch.MergePatch = req.Merge
+		}
+	default:
+		http.Error(w, "Unsupported patch type (use application/json-patch+json or application/merge-patch+json)", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	entry, err := s.engine.PatchEntry(id, patch)
+	if err != nil {
+		status := http.StatusInternalServerError
+		var notFound engine.ErrNotFound
+		switch {
+		case errors.As(err, &notFound):
+			status = http.StatusNotFound
+		case errors.Is(err, engine.ErrPatchTestFailed):
+			status = http.StatusConflict
+		case errors.Is(err, engine.ErrInvalidPatch), errors.Is(err, engine.ErrSchemaValidation):
+			status = http.StatusUnprocessableEntity
+		}
+		http.Error(w, err.Error(), entryErrorStatus(err, status))
+		return
+	}
+
+	respondJSON(w, http.StatusOK, masked(r, entry))
+}
+
 func (s *Server) deleteEntry(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
 	if err := s.engine.DeleteEntry(id); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -187,28 +511,250 @@ func (s *Server) deleteEntry(w http.ResponseWriter, r *http.Request, id uuid.UUI
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// deleteEntries handles DELETE /entries?query=..., deleting the entries
+// the query matches and returning how many
+func (s *Server) deleteEntries(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("query")
+	if query == "" {
+		http.Error(w, "Missing query", http.StatusBadRequest)
+		return
+	}
+
+	n, err := s.engine.DeleteQuery(query)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, engine.ErrInvalidQuery) {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]int{"deleted": n})
+}
+
+// archiveEntry handles POST /entries/:id/archive and
+// POST /entries/:id/unarchive, returning the entry
+func (s *Server) archiveEntry(w http.ResponseWriter, r *http.Request, id uuid.UUID, archive bool) {
+	set := s.engine.UnarchiveEntry
+	if archive {
+		set = s.engine.ArchiveEntry
+	}
+	err := set(id)
+	var entry engine.Entry
+	if err == nil {
+		entry, err = s.engine.GetEntry(id)
+	}
+	if err != nil {
+		status := http.StatusInternalServerError
+		var notFound engine.ErrNotFound
+		if errors.As(err, &notFound) {
+			status = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, masked(r, entry))
+}
+
+// shareEntry handles POST /entries/:id/share {"peers": [...]}
+func (s *Server) shareEntry(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+	var req struct {
+		Peers []string `json:"peers"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Peers) == 0 {
+		http.Error(w, "Invalid JSON: peers required", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.engine.ShareEntry(id, req.Peers); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// entryAcks handles GET /entries/:id/acks
+func (s *Server) entryAcks(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+	acks, err := s.engine.EntryAcks(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, acks)
+}
+
+// handleSearch handles GET /search?q=...&type=...&tag=...&limit=...&offset=...&facets=true&mode=fuzzy&archived=true
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := r.URL.Query()
+	opts := engine.SearchOptions{
+		Tags:   params["tag"],
+		Facets: params.Get("facets") == "true",
+
+		Archived: params.Get("archived") == "true",
+	}
+	switch mode := engine.SearchMode(params.Get("mode")); mode {
+	case engine.SearchExact, engine.SearchPrefix, engine.SearchFuzzy:
+		opts.Mode = mode
+	default:
+		http.Error(w, "Invalid mode (use prefix or fuzzy)", http.StatusBadRequest)
+		return
+	}
+	if t := params.Get("type"); t != "" {
+		entryType := engine.EntryType(t)
+		opts.Type = &entryType
+	}
+	if l := params.Get("limit"); l != "" {
+		limit, err := strconv.Atoi(l)
+		if err != nil || limit < 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		opts.Limit = limit
+	}
+	if o := params.Get("offset"); o != "" {
+		offset, err := strconv.Atoi(o)
+		if err != nil || offset < 0 {
+			http.Error(w, "Invalid offset", http.StatusBadRequest)
+			return
+		}
+		opts.Offset = offset
+	}
+
+	result, err := s.engine.Search(params.Get("q"), opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, result)
+}
+
+// handleQuickOpen handles GET /quickopen?q=...&limit=...
+func (s *Server) handleQuickOpen(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit := 20
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	results, err := s.engine.QuickOpen(r.URL.Query().Get("q"), limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if results == nil {
+		results = []engine.QuickOpenResult{}
+	}
+
+	respondJSON(w, http.StatusOK, results)
+}
+
 func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	entries, _ := s.engine.ListEntries(engine.ListFilter{})
+	count, _ := s.engine.Count(engine.ListFilter{})
 
+	cache := s.engine.CacheStats()
 	status := map[string]interface{}{
 		"status":      "ok",
-		"entry_count": len(entries),
+		"entry_count": count,
+		"cache": map[string]interface{}{
+			"hits":     cache.Hits,
+			"misses":   cache.Misses,
+			"hit_rate": cache.HitRate(),
+			"size":     cache.Size,
+		},
 	}
+	if quarantined, err := s.engine.Quarantined(); err == nil {
+		status["quarantined"] = len(quarantined)
+	}
+	status["encryption"] = s.engine.EncryptionStatus()
+	status["dropped_events"] = s.engine.DroppedEvents()
 
-	if s.peerCount != nil {
-		status["peer_count"] = s.peerCount()
+	if s.syncStatus != nil {
+		sync := s.syncStatus()
+		status["peer_count"] = sync.PeerCount
+		status["sync"] = sync
 	}
 
 	respondJSON(w, http.StatusOK, status)
 }
 
+// handleEvents handles GET /events?overflow=...&buffer=...
 func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
-	// Server-Sent Events
+	params := r.URL.Query()
+	if namespace, ok := requestNamespace(r); ok {
+		if params.Has("overflow") || params.Has("buffer") {
+			http.Error(w, "overflow and buffer are not available to namespace tokens", http.StatusBadRequest)
+			return
+		}
+		s.streamEvents(w, r, s.engine.WatchQuery(engine.ListFilter{Namespace: &namespace, Archived: true}))
+		return
+	}
+
+	opts := engine.SubscriptionOptions{Overflow: engine.OverflowPolicy(params.Get("overflow"))}
+	if opts.Overflow == engine.OverflowBlock {
+		// A slow client would hold up every write
+		http.Error(w, "Invalid overflow: block is not available over SSE", http.StatusBadRequest)
+		return
+	}
+	if b := params.Get("buffer"); b != "" {
+		n, err := strconv.Atoi(b)
+		if err != nil || n < 1 || n > MaxEventBuffer {
+			http.Error(w, fmt.Sprintf("Invalid buffer (1 to %d)", MaxEventBuffer), http.StatusBadRequest)
+			return
+		}
+		opts.BufferSize = n
+	}
+	sub, err := s.engine.SubscribeWithOptions(opts)
+	if err != nil {
+		http.Error(w, "Invalid overflow: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.streamEvents(w, r, sub)
+}
+
+// entryEvents streams the events of one entry. The entry need not exist
+// yet: it may be created later or arrive through sync.
+func (s *Server) entryEvents(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+	s.streamEvents(w, r, s.engine.Watch(id))
+}
+
+// MaxEventBuffer is the largest buffer GET /events?buffer= accepts
+const MaxEventBuffer = 10000
+
+// overflowEvent is the data of the last SSE event of a stream closed by
+// engine.OverflowClose
+type overflowEvent struct {
+	Error   string `json:"error"`
+	Dropped uint64 `json:"dropped"`
+}
+
+// streamEvents sends the events of sub as Server-Sent Events until the
+// client goes away, then closes sub
+func (s *Server) streamEvents(w http.ResponseWriter, r *http.Request, sub engine.Subscription) {
+	defer sub.Close()
+
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
@@ -218,14 +764,21 @@ func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "SSE not supported", http.StatusInternalServerError)
 		return
 	}
+	// Send the headers now: the client knows it is subscribed
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
 
-	sub := s.engine.Subscribe()
-	defer sub.Close()
-
+	events := sub.Events()
 	for {
 		select {
-		case event, ok := <-sub.Events():
+		case event, ok := <-events:
 			if !ok {
+				if err := sub.Err(); err != nil {
+					// Closed by OverflowClose: the client should resync
+					data, _ := json.Marshal(overflowEvent{Error: err.Error(), Dropped: sub.Dropped()})
+					fmt.Fprintf(w, "event: overflow\ndata: %s\n\n", data)
+					flusher.Flush()
+				}
 				return
 			}
 			data, _ := json.Marshal(event)
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/amaydixit11/acorde/pkg/engine"
+	"github.com/google/uuid"
+)
+
+// handleCollections handles GET/POST /collections and
+// GET/PATCH/DELETE /collections/:id
+func (s *Server) handleCollections(w http.ResponseWriter, r *http.Request) {
+	ref := strings.Trim(strings.TrimPrefix(r.URL.Path, "/collections"), "/")
+	if ref == "" {
+		switch r.Method {
+		case http.MethodGet:
+			collections, err := s.engine.ListCollections()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			respondJSON(w, http.StatusOK, collections)
+		case http.MethodPost:
+			s.createCollection(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	id, err := uuid.Parse(ref)
+	if err != nil {
+		http.Error(w, "Invalid collection ID", http.StatusBadRequest)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		collection, err := s.engine.GetCollection(id)
+		if err != nil {
+			collectionError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, collection)
+	case http.MethodPatch:
+		s.updateCollection(w, r, id)
+	case http.MethodDelete:
+		if err := s.engine.DeleteCollection(id); err != nil {
+			collectionError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// createCollection handles POST /collections {"name": ..., "parent": ...}
+// with parent a collection ID or path (none = at the top level)
+func (s *Server) createCollection(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name   string `json:"name"`
+		Parent string `json:"parent"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+		http.Error(w, "Invalid JSON: name required", http.StatusBadRequest)
+		return
+	}
+	parent, err := s.collectionRef(req.Parent)
+	if err != nil {
+		collectionError(w, err)
+		return
+	}
+	collection, err := s.engine.CreateCollection(req.Name, parent)
+	if err != nil {
+		collectionError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusCreated, collection)
+}
+
+// updateCollection handles PATCH /collections/:id {"name": ..., "parent": ...},
+// renaming the collection and moving it into parent ("/" = to the top
+// level); either may be left out
+func (s *Server) updateCollection(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+	var req struct {
+		Name   *string `json:"name"`
+		Parent *string `json:"parent"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	collection, err := s.engine.GetCollection(id)
+	if err == nil && req.Parent != nil {
+		var parent uuid.UUID
+		if parent, err = s.collectionRef(*req.Parent); err == nil {
+			collection, err = s.engine.MoveCollection(id, parent)
+		}
+	}
+	if err == nil && req.Name != nil {
+		collection, err = s.engine.RenameCollection(id, *req.Name)
+	}
+	if err != nil {
+		collectionError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, collection)
+}
+
+// moveEntry handles POST /entries/:id/move {"collection": ...}, filing the
+// entry in a collection given by ID or path ("" or "/" = in none), and
+// returns the entry
+func (s *Server) moveEntry(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+	var req struct {
+		Collection string `json:"collection"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	collection, err := s.collectionRef(req.Collection)
+	if err == nil {
+		err = s.engine.MoveEntry(id, collection)
+	}
+	var entry engine.Entry
+	if err == nil {
+		entry, err = s.engine.GetEntry(id)
+	}
+	if err != nil {
+		collectionError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, masked(r, entry))
+}
+
+// collectionRef returns the ID of a collection given by ID or by path
+// ("" and "/" are the top level, uuid.Nil)
+func (s *Server) collectionRef(ref string) (uuid.UUID, error) {
+	if id, err := uuid.Parse(ref); err == nil {
+		return id, nil
+	}
+	if ref == "" {
+		return uuid.Nil, nil
+	}
+	collection, err := s.engine.ResolveCollection(ref)
+	return collection.ID, err
+}
+
+// collectionError responds with the status matching a collection
+// operation error
+func collectionError(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	var notFound engine.ErrNotFound
+	switch {
+	case errors.Is(err, engine.ErrCollectionNotFound), errors.As(err, &notFound):
+		status = http.StatusNotFound
+	case errors.Is(err, engine.ErrCollectionExists), errors.Is(err, engine.ErrCollectionNotEmpty):
+		status = http.StatusConflict
+	}
+	http.Error(w, err.Error(), status)
+}
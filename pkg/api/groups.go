@@ -0,0 +1,128 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/amaydixit11/acorde/pkg/engine"
+	"github.com/google/uuid"
+)
+
+// handleGroups handles GET/POST /groups and GET/PATCH/DELETE /groups/:name
+func (s *Server) handleGroups(w http.ResponseWriter, r *http.Request) {
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/groups"), "/")
+	if name == "" {
+		switch r.Method {
+		case http.MethodGet:
+			groups, err := s.engine.ListGroups()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if groups == nil {
+				groups = []engine.Group{}
+			}
+			respondJSON(w, http.StatusOK, groups)
+		case http.MethodPost:
+			s.createGroup(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		group, err := s.engine.GetGroup(name)
+		if err != nil {
+			groupError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, group)
+	case http.MethodPatch:
+		var req struct {
+			Add    []string `json:"add"`
+			Remove []string `json:"remove"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		group, err := s.engine.UpdateGroup(name, req.Add, req.Remove)
+		if err != nil {
+			groupError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, group)
+	case http.MethodDelete:
+		if err := s.engine.DeleteGroup(name); err != nil {
+			groupError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// createGroup handles POST /groups {"name": ..., "members": [...]}
+func (s *Server) createGroup(w http.ResponseWriter, r *http.Request) {
+	var req engine.Group
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+		http.Error(w, "Invalid JSON: name required", http.StatusBadRequest)
+		return
+	}
+	group, err := s.engine.CreateGroup(req.Name, req.Members)
+	if err != nil {
+		groupError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusCreated, group)
+}
+
+// entryGroup handles POST /entries/:id/groups/:name {"write": bool} and
+// DELETE /entries/:id/groups/:name, granting and revoking a group's
+// access to an entry
+func (s *Server) entryGroup(w http.ResponseWriter, r *http.Request, id uuid.UUID, name string) {
+	var err error
+	switch r.Method {
+	case http.MethodPost:
+		var req struct {
+			Write bool `json:"write"`
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+		}
+		err = s.engine.GrantGroup(id, name, req.Write)
+	case http.MethodDelete:
+		err = s.engine.RevokeGroup(id, name)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		groupError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// groupError responds with the status matching a group operation error
+func groupError(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	var notFound engine.ErrNotFound
+	switch {
+	case errors.Is(err, engine.ErrGroupNotFound), errors.As(err, &notFound):
+		status = http.StatusNotFound
+	case errors.Is(err, engine.ErrGroupExists):
+		status = http.StatusConflict
+	case errors.Is(err, engine.ErrACLDisabled):
+		status = http.StatusForbidden
+	}
+	http.Error(w, err.Error(), status)
+}
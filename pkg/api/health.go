@@ -0,0 +1,92 @@
+package api
+
+import (
+	"net/http"
+	"time"
+)
+
+// Readiness statuses reported by GET /readyz
+const (
+	Ready    = "ready"     // Every check passes
+	Degraded = "degraded"  // Only non-critical checks fail; still serving
+	NotReady = "not_ready" // A critical check fails (503)
+)
+
+// ReadinessCheck is a dependency GET /readyz checks. Check returns nil
+// when it is healthy. A failing Critical check makes the server not
+// ready; any other failing check only degrades it.
+type ReadinessCheck struct {
+	Name     string
+	Critical bool
+	Check    func() error
+}
+
+// HealthResponse is the response of GET /healthz
+type HealthResponse struct {
+	Status string    `json:"status"` // Always "ok"
+	Since  time.Time `json:"since"`  // When the server was created
+	Uptime float64   `json:"uptime_seconds"`
+}
+
+// ReadinessResponse is the response of GET /readyz
+type ReadinessResponse struct {
+	Status string                 `json:"status"` // Ready, Degraded or NotReady
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+// CheckResult is the outcome of one readiness check
+type CheckResult struct {
+	OK       bool   `json:"ok"`
+	Critical bool   `json:"critical"`
+	Error    string `json:"error,omitempty"`
+}
+
+// AddReadinessCheck adds a check to GET /readyz, after the built-in
+// critical "database" check
+func (s *Server) AddReadinessCheck(check ReadinessCheck) {
+	s.readiness = append(s.readiness, check)
+}
+
+// handleHealthz handles GET /healthz: the process is up and serving
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	respondJSON(w, http.StatusOK, HealthResponse{
+		Status: "ok",
+		Since:  s.started,
+		Uptime: time.Since(s.started).Seconds(),
+	})
+}
+
+// handleReadyz handles GET /readyz: 200 when ready or degraded, 503 when
+// a critical dependency fails
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	resp := ReadinessResponse{Status: Ready, Checks: make(map[string]CheckResult)}
+	checks := append([]ReadinessCheck{{Name: "database", Critical: true, Check: s.engine.Ping}}, s.readiness...)
+	for _, check := range checks {
+		result := CheckResult{OK: true, Critical: check.Critical}
+		if err := check.Check(); err != nil {
+			result = CheckResult{Critical: check.Critical, Error: err.Error()}
+			switch {
+			case check.Critical:
+				resp.Status = NotReady
+			case resp.Status == Ready:
+				resp.Status = Degraded
+			}
+		}
+		resp.Checks[check.Name] = result
+	}
+
+	status := http.StatusOK
+	if resp.Status == NotReady {
+		status = http.StatusServiceUnavailable
+	}
+	respondJSON(w, status, resp)
+}
@@ -0,0 +1,197 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amaydixit11/acorde/pkg/engine"
+)
+
+// newNamespaceServer returns a server with an admin token and a token
+// limited to namespace "team-a", over an engine holding one entry in each
+// of "team-a" and "team-b"
+func newNamespaceServer(t *testing.T) (*Server, engine.Engine, engine.Entry, engine.Entry) {
+	t.Helper()
+	e, err := engine.New(engine.Config{InMemory: true})
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+	t.Cleanup(func() { e.Close() })
+
+	own, err := e.AddEntry(engine.AddEntryInput{Type: engine.Note, Content: []byte("a"), Namespace: "team-a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := e.AddEntry(engine.AddEntryInput{Type: engine.Note, Content: []byte("b"), Namespace: "team-b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := New(e, nil)
+	s.SetAuthToken("admin")
+	s.SetNamespaceToken("team-a-token", "team-a")
+	return s, e, own, other
+}
+
+// do serves a request made with token and returns the response
+func do(s *Server, token, method, path, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	return w
+}
+
+func TestNamespaceTokenEntries(t *testing.T) {
+	s, _, own, other := newNamespaceServer(t)
+
+	if w := do(s, "team-a-token", http.MethodGet, "/entries/"+own.ID.String(), ""); w.Code != http.StatusOK {
+		t.Errorf("own namespace: expected 200, got %d", w.Code)
+	}
+	// Entries of other namespaces don't exist for the token
+	for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodDelete} {
+		if w := do(s, "team-a-token", method, "/entries/"+other.ID.String(), `{"content":"x"}`); w.Code != http.StatusNotFound {
+			t.Errorf("%s other namespace: expected 404, got %d", method, w.Code)
+		}
+	}
+	if w := do(s, "admin", http.MethodGet, "/entries/"+other.ID.String(), ""); w.Code != http.StatusOK {
+		t.Errorf("admin token: expected 200, got %d", w.Code)
+	}
+
+	w := do(s, "team-a-token", http.MethodGet, "/entries", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("list: expected 200, got %d", w.Code)
+	}
+	var listed []engine.Entry
+	if err := json.NewDecoder(w.Body).Decode(&listed); err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 1 || listed[0].ID != own.ID {
+		t.Errorf("list: expected only the team-a entry, got %+v", listed)
+	}
+}
+
+func TestNamespaceTokenWikiLinks(t *testing.T) {
+	s, e, _, other := newNamespaceServer(t)
+
+	// Titles shared across namespaces resolve to the token's entry
+	e.AddEntry(engine.AddEntryInput{Type: engine.Note, Content: []byte("# Plans\nb"), Namespace: "team-b"})
+	plans, _ := e.AddEntry(engine.AddEntryInput{Type: engine.Note, Content: []byte("# Plans\na"), Namespace: "team-a"})
+	page, err := e.AddEntry(engine.AddEntryInput{
+		Type:      engine.Note,
+		Content:   []byte("[[b]] [[" + other.ID.String() + "]] [[Plans]]"),
+		Namespace: "team-a",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := do(s, "team-a-token", http.MethodGet, "/entries/"+page.ID.String()+"/rendered", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	html := w.Body.String()
+	if strings.Contains(html, other.ID.String()+"/rendered") || strings.Count(html, "wikilink missing") != 2 {
+		t.Errorf("expected links to team-b entries unresolved, got %s", html)
+	}
+	if !strings.Contains(html, "/entries/"+plans.ID.String()+"/rendered") {
+		t.Errorf("expected [[Plans]] to resolve to the team-a entry, got %s", html)
+	}
+
+	w = do(s, "admin", http.MethodGet, "/entries/"+page.ID.String()+"/rendered", "")
+	if html := w.Body.String(); strings.Count(html, `class="wikilink"`) != 3 {
+		t.Errorf("admin token: expected every link resolved, got %s", html)
+	}
+}
+
+func TestNamespaceTokenCreate(t *testing.T) {
+	s, e, _, _ := newNamespaceServer(t)
+
+	w := do(s, "team-a-token", http.MethodPost, "/entries", `{"type":"note","content":"x","namespace":"team-b"}`)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("create in another namespace: expected 403, got %d", w.Code)
+	}
+	b := "team-b"
+	if entries, _ := e.ListEntries(engine.ListFilter{Namespace: &b}); len(entries) != 1 {
+		t.Errorf("expected team-b to keep 1 entry, got %d", len(entries))
+	}
+
+	// Without a namespace, entries are created in the token's
+	w = do(s, "team-a-token", http.MethodPost, "/entries", `{"type":"note","content":"x"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d", w.Code)
+	}
+	var created engine.Entry
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	if created.Namespace != "team-a" {
+		t.Errorf("expected the entry in team-a, got %q", created.Namespace)
+	}
+}
+
+func TestNamespaceTokenForbiddenRoutes(t *testing.T) {
+	s, _, _, _ := newNamespaceServer(t)
+
+	for _, tt := range []struct{ method, path string }{
+		{http.MethodGet, "/search?q=a"},
+		{http.MethodGet, "/collections"},
+		{http.MethodPost, "/sync/invite"},
+	} {
+		if w := do(s, "team-a-token", tt.method, tt.path, ""); w.Code != http.StatusForbidden {
+			t.Errorf("%s %s: expected 403, got %d", tt.method, tt.path, w.Code)
+		}
+	}
+	if w := do(s, "admin", http.MethodGet, "/collections", ""); w.Code != http.StatusOK {
+		t.Errorf("admin token: expected 200 from /collections, got %d", w.Code)
+	}
+}
+
+func TestNamespaceTokenEvents(t *testing.T) {
+	s, e, _, _ := newNamespaceServer(t)
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/events", nil)
+	req.Header.Set("Authorization", "Bearer team-a-token")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+
+	events := make(chan engine.Event, 10)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+				var event engine.Event
+				json.Unmarshal([]byte(data), &event)
+				events <- event
+			}
+		}
+		close(events)
+	}()
+
+	// The headers came once subscribed: a change in another namespace
+	// first, then one in the token's
+	e.AddEntry(engine.AddEntryInput{Type: engine.Note, Content: []byte("b2"), Namespace: "team-b"})
+	own, _ := e.AddEntry(engine.AddEntryInput{Type: engine.Note, Content: []byte("a2"), Namespace: "team-a"})
+
+	select {
+	case event := <-events:
+		if event.EntryID != own.ID {
+			t.Errorf("expected the first event for the team-a entry, got %+v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event received")
+	}
+}
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Pairing creates and redeems sync invites for the /sync endpoints. The
+// daemon implements it with its sync service.
+type Pairing interface {
+	Invite(req InviteRequest) (Invite, error)
+	Pair(ctx context.Context, req PairRequest) (PairResult, error)
+}
+
+// InviteRequest is the body of POST /sync/invite
+type InviteRequest struct {
+	Expiry  string `json:"expiry,omitempty"` // Go duration, e.g. "1h" ("" = 24h)
+	OneTime bool   `json:"one_time,omitempty"`
+	PIN     bool   `json:"pin,omitempty"`
+	QRLevel string `json:"qr_level,omitempty"` // low (default), medium, high or highest
+	QRSize  int    `json:"qr_size,omitempty"`  // Pixels (0 = 256)
+}
+
+// Invite is the response to POST /sync/invite
+type Invite struct {
+	Code      string    `json:"code"`      // Short code, encoded in the QR; pairs like FullCode
+	FullCode  string    `json:"full_code"` // Also carries an embedded vault key, if any
+	ExpiresAt time.Time `json:"expires_at"`
+	PIN       string    `json:"pin,omitempty"` // To tell the joiner out of band
+	OneTime   bool      `json:"one_time"`
+	QR        []byte    `json:"qr_png"` // Base64 PNG of the short code
+}
+
+// PairRequest is the body of POST /sync/pair
+type PairRequest struct {
+	Code string `json:"code"`
+	PIN  string `json:"pin,omitempty"`
+	// Password protecting the vault key, if the inviter shares one and this
+	// vault has none yet
+	Password string `json:"password,omitempty"`
+}
+
+// PairResult is the response to POST /sync/pair
+type PairResult struct {
+	PeerID           string `json:"peer_id"`
+	VaultKeyReceived bool   `json:"vault_key_received"`
+	// The key was stored; restart the daemon to open the vault with it
+	VaultKeyStored bool `json:"vault_key_stored"`
+}
+
+// SetPairing enables the /sync pairing endpoints. They also need an auth
+// token (see SetAuthToken), since pairing grants a device the vault.
+func (s *Server) SetPairing(p Pairing) {
+	s.pairing = p
+}
+
+// SetAuthToken requires every request to carry the token as
+// "Authorization: Bearer <token>". An empty token disables auth, unless
+// namespace tokens are set (see SetNamespaceToken).
+func (s *Server) SetAuthToken(token string) {
+	s.token = token
+}
+
+// authorized checks a request's bearer token
+func (s *Server) authorized(r *http.Request) bool {
+	if s.token == "" {
+		return len(s.namespaceTokens) == 0
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+// maxQRSize bounds the qr_size of invite requests
+const maxQRSize = 2048
+
+// handleSync handles POST /sync/invite, /sync/invite.png and /sync/pair
+func (s *Server) handleSync(w http.ResponseWriter, r *http.Request) {
+	action := strings.TrimPrefix(r.URL.Path, "/sync/")
+	if action != "invite" && action != "invite.png" && action != "pair" {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.pairing == nil {
+		http.Error(w, "Pairing not available (run the daemon with sync)", http.StatusServiceUnavailable)
+		return
+	}
+	if s.token == "" {
+		http.Error(w, "Pairing requires an API token", http.StatusForbidden)
+		return
+	}
+
+	if action != "pair" {
+		var req InviteRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+		}
+		if req.Expiry != "" {
+			if d, err := time.ParseDuration(req.Expiry); err != nil || d <= 0 {
+				http.Error(w, "Invalid expiry", http.StatusBadRequest)
+				return
+			}
+		}
+		switch strings.ToLower(req.QRLevel) {
+		case "", "low", "medium", "high", "highest":
+		default:
+			http.Error(w, "Invalid qr_level", http.StatusBadRequest)
+			return
+		}
+		if req.QRSize < 0 || req.QRSize > maxQRSize {
+			http.Error(w, "Invalid qr_size", http.StatusBadRequest)
+			return
+		}
+		invite, err := s.pairing.Invite(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if action == "invite" {
+			respondJSON(w, http.StatusCreated, invite)
+			return
+		}
+
+		// The image alone, with the rest of the invite in headers
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Access-Control-Expose-Headers", "X-Acorde-Invite-Code, X-Acorde-Invite-Expires, X-Acorde-Invite-Pin")
+		w.Header().Set("X-Acorde-Invite-Code", invite.Code)
+		w.Header().Set("X-Acorde-Invite-Expires", invite.ExpiresAt.UTC().Format(time.RFC3339))
+		if invite.PIN != "" {
+			w.Header().Set("X-Acorde-Invite-Pin", invite.PIN)
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write(invite.QR)
+		return
+	}
+
+	var req PairRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		http.Error(w, "Invalid JSON: code required", http.StatusBadRequest)
+		return
+	}
+	result, err := s.pairing.Pair(r.Context(), req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	respondJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/amaydixit11/acorde/pkg/engine"
+	"github.com/google/uuid"
+)
+
+// RenderedEntry is the response of GET /entries/:id/rendered?format=json
+type RenderedEntry struct {
+	ID    uuid.UUID `json:"id"`
+	Title string    `json:"title"`
+	HTML  string    `json:"html"`
+}
+
+// renderedEntry handles GET /entries/:id/rendered: a note's Markdown as
+// sanitized HTML, with fenced code highlighted and [[wiki links]]
+// resolved to the rendered entries they name (in the namespace of a
+// namespace token). Returns the HTML fragment, or with ?format=json a
+// RenderedEntry.
+func (s *Server) renderedEntry(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "html" && format != "json" {
+		http.Error(w, "Invalid format (use html or json)", http.StatusBadRequest)
+		return
+	}
+
+	entry, err := s.engine.GetEntry(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if entry.Type != engine.Note {
+		http.Error(w, "Only note entries can be rendered", http.StatusUnprocessableEntity)
+		return
+	}
+
+	html := engine.RenderMarkdown(entry.Content, engine.RenderOptions{
+		Highlight: true,
+		WikiLink: func(target string) (string, bool) {
+			// Namespace tokens see links only to their namespace's entries
+			linked, ok := engine.ResolveWikiLinkWhere(s.engine, target, func(id uuid.UUID) bool {
+				return s.inNamespace(r, id)
+			})
+			if !ok {
+				return "", false
+			}
+			return "/entries/" + linked.String() + "/rendered", true
+		},
+	})
+
+	if format == "json" {
+		respondJSON(w, http.StatusOK, RenderedEntry{ID: entry.ID, Title: engine.ExtractTitle(entry.Content), HTML: html})
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(html))
+}
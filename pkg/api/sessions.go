@@ -0,0 +1,79 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// SyncSession is the transcript of a sync session, recorded when the
+// daemon runs in sync debug mode
+type SyncSession struct {
+	ID             string        `json:"id"`
+	Peer           string        `json:"peer"`
+	Outbound       bool          `json:"outbound"` // This daemon started it
+	Started        time.Time     `json:"started"`
+	Duration       time.Duration `json:"duration_ns"`
+	HashBefore     string        `json:"hash_before"` // State hash, hex
+	HashAfter      string        `json:"hash_after"`
+	EntriesApplied int           `json:"entries_applied"`
+	Messages       []SyncMessage `json:"messages"`
+	Error          string        `json:"error,omitempty"`
+}
+
+// SyncMessage is a message sent or received during a sync session
+type SyncMessage struct {
+	At        time.Time `json:"at"`
+	Sent      bool      `json:"sent"`
+	Type      string    `json:"type"`
+	StateHash string    `json:"state_hash,omitempty"`
+	StateSize int       `json:"state_size,omitempty"`
+	Format    int       `json:"format,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+}
+
+// SetSyncSessions enables GET /sync/sessions, serving the sessions the
+// func returns, oldest first
+func (s *Server) SetSyncSessions(sessions func() []SyncSession) {
+	s.syncSessions = sessions
+}
+
+// handleSyncSessions handles GET /sync/sessions[?peer=ID&limit=N]
+func (s *Server) handleSyncSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.syncSessions == nil {
+		http.Error(w, "Session log not enabled (run the daemon with --sync-log)", http.StatusServiceUnavailable)
+		return
+	}
+
+	limit := 0
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	sessions := s.syncSessions()
+	if p := r.URL.Query().Get("peer"); p != "" {
+		filtered := sessions[:0:0]
+		for _, session := range sessions {
+			if session.Peer == p {
+				filtered = append(filtered, session)
+			}
+		}
+		sessions = filtered
+	}
+	if limit > 0 && len(sessions) > limit {
+		sessions = sessions[len(sessions)-limit:]
+	}
+	if sessions == nil {
+		sessions = []SyncSession{}
+	}
+	respondJSON(w, http.StatusOK, sessions)
+}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/amaydixit11/acorde/pkg/engine"
+)
+
+// Stats is the response of GET /stats: engine.VaultStats, with the state
+// of the sync service when one shares the engine
+type Stats struct {
+	engine.VaultStats
+	Sync *SyncStatus `json:"sync,omitempty"`
+}
+
+// handleStats handles GET /stats, the data of a vault dashboard in one
+// payload
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	vault, err := s.engine.Stats()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	stats := Stats{VaultStats: vault}
+	if s.syncStatus != nil {
+		sync := s.syncStatus()
+		stats.Sync = &sync
+	}
+	respondJSON(w, http.StatusOK, stats)
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/amaydixit11/acorde/pkg/engine"
+)
+
+// handleTemplates handles GET /templates and GET/PUT/DELETE
+// /templates/:name
+func (s *Server) handleTemplates(w http.ResponseWriter, r *http.Request) {
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/templates"), "/")
+	if name == "" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		list, err := s.engine.ListTemplates()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if list == nil {
+			list = []engine.Template{}
+		}
+		respondJSON(w, http.StatusOK, list)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		tmpl, err := s.engine.GetTemplate(name)
+		if err != nil {
+			templateError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, tmpl)
+	case http.MethodPut:
+		var req engine.Template
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		req.Name = name
+		tmpl, err := s.engine.SaveTemplate(req)
+		if err != nil {
+			templateError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, tmpl)
+	case http.MethodDelete:
+		if err := s.engine.DeleteTemplate(name); err != nil {
+			templateError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// createFromTemplate handles POST /entries?template=:name
+// {"vars": {...}, "tags": [...]}
+func (s *Server) createFromTemplate(w http.ResponseWriter, r *http.Request, name string) {
+	var req struct {
+		Vars map[string]string `json:"vars"`
+		Tags []string          `json:"tags"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+	}
+	entry, err := s.engine.AddFromTemplate(name, req.Vars, req.Tags)
+	if err != nil {
+		if errors.Is(err, engine.ErrTemplateNotFound) {
+			templateError(w, err)
+			return
+		}
+		http.Error(w, err.Error(), entryErrorStatus(err, http.StatusBadRequest))
+		return
+	}
+	respondJSON(w, http.StatusCreated, masked(r, entry))
+}
+
+// templateError responds with the status matching a template operation
+// error
+func templateError(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	if errors.Is(err, engine.ErrTemplateNotFound) {
+		status = http.StatusNotFound
+	}
+	http.Error(w, err.Error(), status)
+}
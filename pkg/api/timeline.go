@@ -0,0 +1,63 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/amaydixit11/acorde/pkg/engine"
+)
+
+// DefaultTimelineLimit is the number of events GET /timeline returns
+// without ?limit
+const DefaultTimelineLimit = 50
+
+// TimelineResponse is the response of GET /timeline
+type TimelineResponse struct {
+	Events []engine.TimelineEvent `json:"events"` // Most recent first
+	Limit  int                    `json:"limit"`
+}
+
+// handleTimeline handles
+// GET /timeline?since=...&until=...&type=...&author=...&limit=...
+func (s *Server) handleTimeline(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := r.URL.Query()
+	limit := DefaultTimelineLimit
+	if l := params.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	filter := engine.TimelineFilter{Author: params.Get("author")}
+	if t := params.Get("type"); t != "" {
+		entryType := engine.EntryType(t)
+		filter.Type = &entryType
+	}
+	var err error
+	if filter.Since, err = parseAggregateTime(params.Get("since"), time.UTC); err != nil {
+		http.Error(w, "Invalid since: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if filter.Until, err = parseAggregateTime(params.Get("until"), time.UTC); err != nil {
+		http.Error(w, "Invalid until: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	events, err := s.engine.Timeline(filter, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if events == nil {
+		events = []engine.TimelineEvent{}
+	}
+	respondJSON(w, http.StatusOK, TimelineResponse{Events: events, Limit: limit})
+}
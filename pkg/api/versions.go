@@ -0,0 +1,196 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/amaydixit11/acorde/pkg/engine"
+	"github.com/google/uuid"
+)
+
+// DefaultVersionsLimit is the page size of GET /entries/:id/versions
+// without ?limit
+const DefaultVersionsLimit = 50
+
+// DefaultEditorsWindow is the window of GET /entries/:id/editors without
+// ?window
+const DefaultEditorsWindow = 5 * time.Minute
+
+// VersionsResponse is the response of GET /entries/:id/versions
+type VersionsResponse struct {
+	Versions []engine.Version `json:"versions"` // Newest first
+	Total    int              `json:"total"`    // Versions stored
+	Limit    int              `json:"limit"`
+	Offset   int              `json:"offset"`
+}
+
+// handleVersions routes /entries/:id/versions[/:vid], /diff, /editors
+// and /restore/:vid
+func (s *Server) handleVersions(w http.ResponseWriter, r *http.Request, id uuid.UUID, action, rest string) {
+	switch {
+	case action == "versions" && rest == "" && r.Method == http.MethodGet:
+		s.listVersions(w, r, id)
+	case action == "versions" && rest != "" && r.Method == http.MethodGet:
+		if vid, ok := parseVersionID(w, rest); ok {
+			s.getVersion(w, r, id, vid)
+		}
+	case action == "diff" && rest == "" && r.Method == http.MethodGet:
+		s.diffVersions(w, r, id)
+	case action == "editors" && rest == "" && r.Method == http.MethodGet:
+		s.recentEditors(w, r, id)
+	case action == "restore" && rest != "" && r.Method == http.MethodPost:
+		if vid, ok := parseVersionID(w, rest); ok {
+			s.restoreVersion(w, r, id, vid)
+		}
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+	}
+}
+
+// listVersions handles GET /entries/:id/versions?limit=...&offset=...
+func (s *Server) listVersions(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+	limit, offset := DefaultVersionsLimit, 0
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	if o := r.URL.Query().Get("offset"); o != "" {
+		n, err := strconv.Atoi(o)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid offset", http.StatusBadRequest)
+			return
+		}
+		offset = n
+	}
+
+	versions, total, err := s.engine.History(id, limit, offset)
+	if err != nil {
+		http.Error(w, err.Error(), versionErrorStatus(err))
+		return
+	}
+	if versions == nil {
+		versions = []engine.Version{}
+	}
+	if s.maskVersions(r, id) {
+		for i := range versions {
+			versions[i].Content = engine.MaskCredential(versions[i].Content)
+		}
+	}
+	respondJSON(w, http.StatusOK, VersionsResponse{Versions: versions, Total: total, Limit: limit, Offset: offset})
+}
+
+// getVersion handles GET /entries/:id/versions/:vid
+func (s *Server) getVersion(w http.ResponseWriter, r *http.Request, id uuid.UUID, vid int64) {
+	v, err := s.engine.GetVersion(id, vid)
+	if err != nil {
+		http.Error(w, err.Error(), versionErrorStatus(err))
+		return
+	}
+	if s.maskVersions(r, id) {
+		v.Content = engine.MaskCredential(v.Content)
+	}
+	respondJSON(w, http.StatusOK, v)
+}
+
+// diffVersions handles GET /entries/:id/diff?from=...&to=...
+func (s *Server) diffVersions(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+	from, err1 := strconv.ParseInt(r.URL.Query().Get("from"), 10, 64)
+	to, err2 := strconv.ParseInt(r.URL.Query().Get("to"), 10, 64)
+	if err1 != nil || err2 != nil {
+		http.Error(w, "Invalid from/to: version IDs required", http.StatusBadRequest)
+		return
+	}
+
+	if !s.maskVersions(r, id) {
+		diff, err := s.engine.DiffVersions(id, from, to)
+		if err != nil {
+			http.Error(w, err.Error(), versionErrorStatus(err))
+			return
+		}
+		respondJSON(w, http.StatusOK, diff)
+		return
+	}
+
+	// Diff the masked versions, so secrets don't show in the content diff
+	old, err := s.engine.GetVersion(id, from)
+	if err != nil {
+		http.Error(w, err.Error(), versionErrorStatus(err))
+		return
+	}
+	new, err := s.engine.GetVersion(id, to)
+	if err != nil {
+		http.Error(w, err.Error(), versionErrorStatus(err))
+		return
+	}
+	old.Content, new.Content = engine.MaskCredential(old.Content), engine.MaskCredential(new.Content)
+	respondJSON(w, http.StatusOK, engine.ComputeVersionDiff(&old, &new))
+}
+
+// recentEditors handles GET /entries/:id/editors?window=...
+func (s *Server) recentEditors(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+	window := DefaultEditorsWindow
+	if v := r.URL.Query().Get("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			http.Error(w, "Invalid window", http.StatusBadRequest)
+			return
+		}
+		window = d
+	}
+
+	editors, err := s.engine.RecentEditors(id, window)
+	if err != nil {
+		http.Error(w, err.Error(), versionErrorStatus(err))
+		return
+	}
+	respondJSON(w, http.StatusOK, editors)
+}
+
+// restoreVersion handles POST /entries/:id/restore/:vid
+func (s *Server) restoreVersion(w http.ResponseWriter, r *http.Request, id uuid.UUID, vid int64) {
+	entry, err := s.engine.RestoreVersion(id, vid)
+	if err != nil {
+		status := versionErrorStatus(err)
+		if status == http.StatusInternalServerError {
+			status = entryErrorStatus(err, status)
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	respondJSON(w, http.StatusOK, masked(r, entry))
+}
+
+// maskVersions reports whether versions of an entry are returned with
+// credential secrets masked: for credential entries, and entries that
+// can't be looked up (e.g. deleted), unless the request has ?reveal=true
+func (s *Server) maskVersions(r *http.Request, id uuid.UUID) bool {
+	if reveal, _ := strconv.ParseBool(r.URL.Query().Get("reveal")); reveal {
+		return false
+	}
+	entry, err := s.engine.GetEntry(id)
+	return err != nil || entry.Type == engine.Credential
+}
+
+func parseVersionID(w http.ResponseWriter, s string) (int64, bool) {
+	vid, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid version ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return vid, true
+}
+
+// versionErrorStatus is 404 for unknown entries and versions
+func versionErrorStatus(err error) int {
+	var notFound engine.ErrNotFound
+	if errors.As(err, &notFound) || errors.Is(err, engine.ErrVersionNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+)
+
+// handleWebhooks handles GET /webhooks, GET /webhooks/:id/stats and
+// POST /webhooks/:id/enable. Webhook configs, which hold secrets, are
+// not served.
+func (s *Server) handleWebhooks(w http.ResponseWriter, r *http.Request) {
+	hooks := s.engine.Hooks()
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/webhooks"), "/")
+	if path == "" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		respondJSON(w, http.StatusOK, hooks.Stats())
+		return
+	}
+
+	id, action, _ := strings.Cut(path, "/")
+	switch {
+	case action == "stats" && r.Method == http.MethodGet:
+		stats, ok := hooks.WebhookStats(id)
+		if !ok {
+			http.Error(w, "Webhook not found", http.StatusNotFound)
+			return
+		}
+		respondJSON(w, http.StatusOK, stats)
+	case action == "enable" && r.Method == http.MethodPost:
+		if err := hooks.EnableWebhook(id); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+	}
+}
@@ -0,0 +1,78 @@
+package crypto
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Argon2Params are the Argon2id parameters that derive the key wrapping
+// the master key from the password. They are stored in the key file, so
+// each vault can be tuned to its machine.
+type Argon2Params struct {
+	Memory      uint32 `json:"mem"`     // KiB
+	Iterations  uint32 `json:"time"`    // Passes over memory
+	Parallelism uint8  `json:"threads"` // Lanes
+}
+
+// DefaultArgon2Params follow the OWASP recommendation: 64 MiB, 3 passes,
+// 2 lanes
+var DefaultArgon2Params = Argon2Params{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+}
+
+// MinArgon2Memory is the least memory, in KiB, Validate accepts
+const MinArgon2Memory = 8 * 1024
+
+// Validate checks that the parameters are usable and not trivially weak
+func (p Argon2Params) Validate() error {
+	if p.Iterations < 1 {
+		return fmt.Errorf("argon2: need at least 1 iteration")
+	}
+	if p.Parallelism < 1 {
+		return fmt.Errorf("argon2: need at least 1 thread")
+	}
+	if p.Memory < MinArgon2Memory {
+		return fmt.Errorf("argon2: need at least %d MiB of memory", MinArgon2Memory/1024)
+	}
+	return nil
+}
+
+func (p Argon2Params) String() string {
+	return fmt.Sprintf("Argon2id %d MiB, %d passes, %d threads", p.Memory/1024, p.Iterations, p.Parallelism)
+}
+
+// deriveArgon2 derives a key from a password with Argon2id
+func deriveArgon2(password, salt []byte, p Argon2Params) Key {
+	var k Key
+	copy(k[:], argon2.IDKey(password, salt, p.Iterations, p.Memory, p.Parallelism, KeySize))
+	return k
+}
+
+// BenchmarkArgon2 picks the number of passes that makes Argon2id with the
+// given memory (KiB) and parallelism take about target on this machine.
+// It returns at least one pass, however slow that is.
+func BenchmarkArgon2(target time.Duration, memory uint32, parallelism uint8) Argon2Params {
+	p := Argon2Params{Memory: memory, Iterations: 1, Parallelism: parallelism}
+	salt := make([]byte, SaltSize)
+
+	// Time one pass, best of two to skip warm-up
+	var pass time.Duration
+	for i := 0; i < 2; i++ {
+		start := time.Now()
+		deriveArgon2([]byte("benchmark"), salt, p)
+		if d := time.Since(start); i == 0 || d < pass {
+			pass = d
+		}
+	}
+
+	if pass > 0 {
+		if n := (target + pass/2) / pass; n > 1 {
+			p.Iterations = uint32(min(n, 1000))
+		}
+	}
+	return p
+}
@@ -2,11 +2,12 @@ package crypto
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 
-	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/chacha20poly1305"
 )
 
@@ -24,6 +25,18 @@ var (
 // Key represents a 32-byte encryption key
 type Key [KeySize]byte
 
+// Fingerprint identifies the key without revealing it: 16 hex digits of
+// a SHA-256 hash of the key
+func (k Key) Fingerprint() string {
+	sum := sha256.Sum256(append([]byte("acorde key fingerprint\x00"), k[:]...))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Wipe zeroes the key in memory
+func (k *Key) Wipe() {
+	clear(k[:])
+}
+
 // GenerateKey creates a new random key
 func GenerateKey() (Key, error) {
 	var k Key
@@ -34,16 +47,9 @@ func GenerateKey() (Key, error) {
 }
 
 // DeriveKey derives a key from a password and salt using Argon2id
+// with DefaultArgon2Params
 func DeriveKey(password, salt []byte) Key {
-	var k Key
-	// Argon2id parameters (OWASP recommendations)
-	// Time: 3 passes
-	// Memory: 64 MB (64 * 1024)
-	// Threads: 2
-	// KeyLen: 32 bytes
-	dk := argon2.IDKey(password, salt, 3, 64*1024, 2, KeySize)
-	copy(k[:], dk)
-	return k
+	return deriveArgon2(password, salt, DefaultArgon2Params)
 }
 
 // Encrypt encrypts plaintext using XChaCha20-Poly1305
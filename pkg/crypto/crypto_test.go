@@ -2,7 +2,13 @@ package crypto
 
 import (
 	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestEncryption(t *testing.T) {
@@ -118,3 +124,432 @@ func TestKeyStore(t *testing.T) {
 		t.Error("keys should match across instances")
 	}
 }
+
+func TestKeyStoreEpochs(t *testing.T) {
+	store := NewFileKeyStore(t.TempDir())
+	password := []byte("secret")
+	if err := store.Initialize(password); err != nil {
+		t.Fatalf("initialize failed: %v", err)
+	}
+	first, _ := store.Unlock(password)
+	if store.Epoch() != 0 {
+		t.Errorf("new vault should be at epoch 0, got %d", store.Epoch())
+	}
+
+	second, _ := GenerateKey()
+	third, _ := GenerateKey()
+	for _, k := range []Key{second, second, third} {
+		if err := store.Rekey(password, k); err != nil {
+			t.Fatalf("rekey failed: %v", err)
+		}
+	}
+	if store.Epoch() != 2 {
+		t.Errorf("expected epoch 2 after two rotations, got %d", store.Epoch())
+	}
+
+	keys, err := NewFileKeyStore(store.dir).Keyring(password)
+	if err != nil {
+		t.Fatalf("keyring failed: %v", err)
+	}
+	want := []EpochKey{{0, first}, {1, second}, {2, third}}
+	if len(keys) != len(want) {
+		t.Fatalf("expected %d keys, got %d", len(want), len(keys))
+	}
+	for i := range want {
+		if keys[i] != want[i] {
+			t.Errorf("key %d: expected epoch %d, got epoch %d", i, want[i].Epoch, keys[i].Epoch)
+		}
+	}
+
+	if k, err := KeyForEpoch(keys, 1); err != nil || k != second {
+		t.Errorf("expected the key of epoch 1, got %v", err)
+	}
+	if _, err := KeyForEpoch(keys, 7); !errors.Is(err, ErrUnknownEpoch) {
+		t.Errorf("expected ErrUnknownEpoch, got %v", err)
+	}
+	if _, err := store.Keyring([]byte("wrong")); err == nil {
+		t.Error("keyring should fail with wrong password")
+	}
+
+	// Keys from other devices keep the epoch they have there
+	joined := NewFileKeyStore(t.TempDir())
+	if err := joined.InitializeWithEpochKey(password, EpochKey{Epoch: 2, Key: third}); err != nil {
+		t.Fatalf("initialize failed: %v", err)
+	}
+	fourth, _ := GenerateKey()
+	if err := joined.AdoptKey(password, EpochKey{Epoch: 5, Key: fourth}); err != nil {
+		t.Fatalf("adopt failed: %v", err)
+	}
+	if keys, _ := joined.Keyring(password); len(keys) != 2 || keys[0] != (EpochKey{2, third}) || keys[1] != (EpochKey{5, fourth}) {
+		t.Errorf("expected epochs 2 and 5, got %d keys", len(keys))
+	}
+}
+
+func TestCipherProviders(t *testing.T) {
+	key, _ := GenerateKey()
+	plaintext := []byte("Hello, World!")
+	aad := []byte("metadata")
+
+	for _, p := range []CipherProvider{XChaCha20Poly1305{}, AESGCM{}} {
+		ciphertext, err := p.Encrypt(key, plaintext, aad)
+		if err != nil {
+			t.Fatalf("%s: encrypt failed: %v", p.Name(), err)
+		}
+		decrypted, err := p.Decrypt(key, ciphertext, aad)
+		if err != nil || !bytes.Equal(plaintext, decrypted) {
+			t.Errorf("%s: round trip failed: %v", p.Name(), err)
+		}
+		if _, err := p.Decrypt(key, ciphertext, []byte("wrong_aad")); err != ErrDecrypt {
+			t.Errorf("%s: expected ErrDecrypt for wrong AAD, got %v", p.Name(), err)
+		}
+	}
+
+	// Ciphertexts are not interchangeable
+	ciphertext, _ := (AESGCM{}).Encrypt(key, plaintext, aad)
+	if _, err := (XChaCha20Poly1305{}).Decrypt(key, ciphertext, aad); err == nil {
+		t.Error("default cipher should not open AES-GCM ciphertext")
+	}
+
+	salt, _ := GenerateSalt()
+	var p AESGCM
+	if p.DeriveKey([]byte("pw"), salt) != p.DeriveKey([]byte("pw"), salt) {
+		t.Error("key derivation should be deterministic")
+	}
+}
+
+func TestKeyStoreWithCipher(t *testing.T) {
+	tmpDir := t.TempDir()
+	store := NewFileKeyStoreWithCipher(tmpDir, AESGCM{})
+	password := []byte("secret")
+
+	if err := store.Initialize(password); err != nil {
+		t.Fatalf("initialize failed: %v", err)
+	}
+	key, err := store.Unlock(password)
+	if err != nil {
+		t.Fatalf("unlock failed: %v", err)
+	}
+	key2, err := NewFileKeyStoreWithCipher(tmpDir, AESGCM{}).Unlock(password)
+	if err != nil || key != key2 {
+		t.Fatalf("re-unlock failed: %v", err)
+	}
+
+	// A keystore configured for another cipher refuses the file
+	if _, err := NewFileKeyStore(tmpDir).Unlock(password); err == nil {
+		t.Error("unlock should fail with a different cipher")
+	}
+}
+
+// fakeSealer stands in for a hardware device: it only unseals blobs it sealed
+type fakeSealer struct {
+	secrets map[string][]byte
+}
+
+func (f *fakeSealer) Name() string { return "fake" }
+
+func (f *fakeSealer) Seal(secret []byte) ([]byte, error) {
+	handle, _ := GenerateSalt()
+	f.secrets[string(handle)] = append([]byte(nil), secret...)
+	return handle, nil
+}
+
+func (f *fakeSealer) Unseal(blob []byte) ([]byte, error) {
+	secret, ok := f.secrets[string(blob)]
+	if !ok {
+		return nil, ErrDecrypt
+	}
+	return secret, nil
+}
+
+func TestHardwareKeyStore(t *testing.T) {
+	tmpDir := t.TempDir()
+	device := &fakeSealer{secrets: make(map[string][]byte)}
+	password := []byte("secret")
+
+	store := NewHardwareKeyStore(tmpDir, device)
+	if err := store.Initialize(password); err != nil {
+		t.Fatalf("initialize failed: %v", err)
+	}
+	if got := store.Protection(); got != "hardware (fake)" {
+		t.Errorf("unexpected protection %q", got)
+	}
+
+	key, err := store.Unlock(password)
+	if err != nil {
+		t.Fatalf("unlock failed: %v", err)
+	}
+	if _, err := store.Unlock([]byte("wrong")); err == nil {
+		t.Error("unlock should fail with wrong password")
+	}
+
+	// A plain keystore finds the sealer through the registry
+	if _, err := NewFileKeyStore(tmpDir).Unlock(password); err == nil {
+		t.Error("unlock should fail while the sealer is unregistered")
+	}
+	RegisterSealer(device)
+	key2, err := NewFileKeyStore(tmpDir).Unlock(password)
+	if err != nil || key != key2 {
+		t.Fatalf("unlock via registry failed: %v", err)
+	}
+
+	// The key file is useless without the original device
+	other := NewHardwareKeyStore(tmpDir, &fakeSealer{secrets: make(map[string][]byte)})
+	if _, err := other.Unlock(password); err == nil {
+		t.Error("unlock should fail on a different device")
+	}
+
+	// Rekey keeps hardware protection
+	newKey, _ := GenerateKey()
+	if err := store.Rekey([]byte("wrong"), newKey); err == nil {
+		t.Error("rekey should fail with wrong password")
+	}
+	if err := store.Rekey(password, newKey); err != nil {
+		t.Fatalf("rekey failed: %v", err)
+	}
+	if got := store.Protection(); got != "hardware (fake)" {
+		t.Errorf("rekey changed protection to %q", got)
+	}
+	key3, err := store.Unlock(password)
+	if err != nil || key3 != newKey {
+		t.Fatalf("unlock after rekey failed: %v", err)
+	}
+}
+
+func TestDefaultSealer(t *testing.T) {
+	sealer, err := DefaultSealer()
+	if runtime.GOOS == "darwin" {
+		if !errors.Is(err, ErrHardwareUnsupported) {
+			t.Fatalf("expected ErrHardwareUnsupported, got %v", err)
+		}
+		if _, err := LookupSealer(TPMSealerName); err == nil {
+			t.Error("no TPM sealer should be registered")
+		}
+		// Hardware protection fails instead of falling back to a password
+		store := NewHardwareKeyStore(t.TempDir(), nil)
+		if err := store.Initialize([]byte("secret")); !errors.Is(err, ErrHardwareUnsupported) {
+			t.Errorf("expected ErrHardwareUnsupported, got %v", err)
+		}
+		return
+	}
+	if err != nil || sealer.Name() != TPMSealerName {
+		t.Fatalf("expected the TPM sealer, got %v, %v", sealer, err)
+	}
+	if _, err := LookupSealer(TPMSealerName); err != nil {
+		t.Errorf("TPM sealer should be registered: %v", err)
+	}
+}
+
+func TestShamir(t *testing.T) {
+	key, _ := GenerateKey()
+	shares, err := SplitKey(key, 5, 3)
+	if err != nil {
+		t.Fatalf("split failed: %v", err)
+	}
+	if len(shares) != 5 {
+		t.Fatalf("got %d shares, want 5", len(shares))
+	}
+
+	// Any three shares rebuild the key
+	for _, pick := range [][]int{{0, 1, 2}, {4, 2, 0}, {1, 3, 4}} {
+		var subset []Share
+		for _, i := range pick {
+			subset = append(subset, shares[i])
+		}
+		got, err := CombineShares(subset)
+		if err != nil || got != key {
+			t.Errorf("combine %v failed: %v", pick, err)
+		}
+	}
+	if _, err := CombineShares(shares[:2]); err == nil {
+		t.Error("combine should fail below the threshold")
+	}
+	if _, err := CombineShares([]Share{shares[0], shares[0], shares[1]}); err == nil {
+		t.Error("combine should reject a repeated share")
+	}
+	other, _ := SplitKey(key, 5, 3)
+	other[0].SetID = shares[0].SetID + 1
+	if _, err := CombineShares([]Share{shares[0], shares[1], other[0]}); err != ErrShareMismatch {
+		t.Errorf("mixed sets: got %v, want ErrShareMismatch", err)
+	}
+
+	if _, err := SplitKey(key, 3, 4); err == nil {
+		t.Error("split should reject a threshold above the share count")
+	}
+	if _, err := SplitKey(key, 3, 1); err == nil {
+		t.Error("split should reject a threshold of 1")
+	}
+
+	// Words round trip, and forgive case and shortening
+	words := shares[3].Words()
+	parsed, err := ParseShare(strings.ToUpper(words))
+	if err != nil || parsed != shares[3] {
+		t.Fatalf("parse failed: %v", err)
+	}
+	var short []string
+	for _, w := range strings.Fields(words) {
+		short = append(short, shareWordKey(w))
+	}
+	if parsed, err := ParseShare(strings.Join(short, "  ")); err != nil || parsed != shares[3] {
+		t.Errorf("parse of shortened words failed: %v", err)
+	}
+
+	// A swapped word is caught
+	fields := strings.Fields(words)
+	fields[10] = shareWords[shareWordIndex[shareWordKey(fields[10])]+1]
+	if _, err := ParseShare(strings.Join(fields, " ")); err != ErrShareChecksum {
+		t.Errorf("typo: got %v, want ErrShareChecksum", err)
+	}
+	if _, err := ParseShare("acid acorn"); err == nil {
+		t.Error("parse should reject a short share")
+	}
+}
+
+func TestRecoveryShares(t *testing.T) {
+	tmpDir := t.TempDir()
+	store := NewFileKeyStore(tmpDir)
+	password := []byte("secret")
+	if err := store.Initialize(password); err != nil {
+		t.Fatalf("initialize failed: %v", err)
+	}
+	key, _ := store.Unlock(password)
+
+	if _, err := store.CreateRecoveryShares([]byte("wrong"), 3, 2); err == nil {
+		t.Error("creating shares should fail with wrong password")
+	}
+	shares, err := store.CreateRecoveryShares(password, 3, 2)
+	if err != nil {
+		t.Fatalf("create shares failed: %v", err)
+	}
+	if n, k := store.Recovery(); n != 3 || k != 2 {
+		t.Errorf("Recovery() = %d, %d; want 3, 2", n, k)
+	}
+
+	// Shares of another key are rejected
+	otherKey, _ := GenerateKey()
+	forged, _ := SplitKey(otherKey, 3, 2)
+	for i := range forged {
+		forged[i].SetID = shares[0].SetID
+	}
+	if _, err := store.Recover(forged[:2], []byte("new")); err == nil {
+		t.Error("recover should reject shares of another key")
+	}
+
+	// Recover sets a new password and keeps the shares valid
+	got, err := store.Recover([]Share{shares[2], shares[0]}, []byte("new"))
+	if err != nil || got != key {
+		t.Fatalf("recover failed: %v", err)
+	}
+	if _, err := store.Unlock(password); err == nil {
+		t.Error("old password should no longer unlock")
+	}
+	if k, err := store.Unlock([]byte("new")); err != nil || k != key {
+		t.Fatalf("unlock with new password failed: %v", err)
+	}
+	if n, _ := store.Recovery(); n != 3 {
+		t.Error("recover should keep the recovery set")
+	}
+
+	// A lost key file is rebuilt from the shares
+	if err := os.Remove(filepath.Join(tmpDir, KeyFileName)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Recover(shares[1:], []byte("again")); err != nil {
+		t.Fatalf("recover without key file failed: %v", err)
+	}
+	if k, err := store.Unlock([]byte("again")); err != nil || k != key {
+		t.Fatalf("unlock of rebuilt key file failed: %v", err)
+	}
+	if _, k := store.Recovery(); k != 2 {
+		t.Error("rebuilt key file should keep the recovery set")
+	}
+
+	// Rekey retires the shares
+	shares, _ = store.CreateRecoveryShares([]byte("again"), 3, 2)
+	if err := store.Rekey([]byte("again"), otherKey); err != nil {
+		t.Fatalf("rekey failed: %v", err)
+	}
+	if _, err := store.Recover(shares[:2], []byte("new")); err == nil {
+		t.Error("recover should fail after rekey")
+	}
+}
+
+func TestPasswordStrength(t *testing.T) {
+	for _, weak := range []string{"", "password", "P@ssw0rd", "qwerty123", "aaaaaaaaaaaa", "abcdef2019", "Monkey1"} {
+		s, err := CheckPassword([]byte(weak), MinPasswordEntropy)
+		if err == nil {
+			t.Errorf("%q passed the policy (%.1f bits)", weak, s.Entropy)
+		}
+		if _, ok := err.(*ErrWeakPassword); !ok {
+			t.Errorf("%q: got %v, want *ErrWeakPassword", weak, err)
+		}
+		if s.Score > 1 {
+			t.Errorf("%q scored %d", weak, s.Score)
+		}
+	}
+	for _, strong := range []string{"kT7pQ2mZ9wR4", "x9#Lq2!vZp7@", "cobalt lantern drifts over seven quiet fields"} {
+		if s, err := CheckPassword([]byte(strong), MinPasswordEntropy); err != nil || s.Score < 3 {
+			t.Errorf("%q: score %d, %v", strong, s.Score, err)
+		}
+	}
+
+	if s := EstimateStrength([]byte("password")); s.Warning == "" {
+		t.Error("a common password should come with a warning")
+	}
+	if _, err := CheckPassword([]byte("pw"), 0); err != nil {
+		t.Errorf("a zero policy should accept any password: %v", err)
+	}
+}
+
+func TestArgon2Params(t *testing.T) {
+	tmpDir := t.TempDir()
+	store := NewFileKeyStore(tmpDir)
+	if err := store.SetArgon2Params(Argon2Params{Memory: 1024, Iterations: 1, Parallelism: 1}); err == nil {
+		t.Error("too little memory should be rejected")
+	}
+	custom := Argon2Params{Memory: MinArgon2Memory, Iterations: 2, Parallelism: 1}
+	if err := store.SetArgon2Params(custom); err != nil {
+		t.Fatal(err)
+	}
+
+	password := []byte("secret")
+	if err := store.Initialize(password); err != nil {
+		t.Fatalf("initialize failed: %v", err)
+	}
+	if got, ok := store.Argon2Params(); !ok || got != custom {
+		t.Errorf("key file params = %+v, want %+v", got, custom)
+	}
+
+	// Another store reads the parameters from the key file, and keeps them
+	// on rekey
+	other := NewFileKeyStore(tmpDir)
+	if _, err := other.Unlock(password); err != nil {
+		t.Fatalf("unlock failed: %v", err)
+	}
+	newKey, _ := GenerateKey()
+	if err := other.Rekey(password, newKey); err != nil {
+		t.Fatalf("rekey failed: %v", err)
+	}
+	if got, _ := other.Argon2Params(); got != custom {
+		t.Errorf("rekey changed params to %+v", got)
+	}
+	if key, err := other.Unlock(password); err != nil || key != newKey {
+		t.Fatalf("unlock after rekey failed: %v", err)
+	}
+
+	// New key files default to the OWASP parameters
+	plain := NewFileKeyStore(t.TempDir())
+	if err := plain.Initialize(password); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := plain.Argon2Params(); got != DefaultArgon2Params {
+		t.Errorf("default params = %+v", got)
+	}
+
+	p := BenchmarkArgon2(time.Millisecond, MinArgon2Memory, 1)
+	if p.Iterations < 1 || p.Memory != MinArgon2Memory || p.Parallelism != 1 {
+		t.Errorf("benchmark returned %+v", p)
+	}
+	if err := p.Validate(); err != nil {
+		t.Errorf("benchmarked params invalid: %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package crypto
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// EpochKey is a vault key with its epoch: 0 for the key the vault was
+// created with, one more for each key rotation. Data sealed before a
+// rotation names the epoch of its key, so it can still be opened.
+type EpochKey struct {
+	Epoch uint32
+	Key   Key
+}
+
+// previousKey is a key retired by rotation, wrapped with the current
+// master key
+type previousKey struct {
+	Epoch       uint32 `json:"epoch"`
+	Fingerprint string `json:"fingerprint"`
+	Data        string `json:"data"`
+}
+
+// keyring is the key file's record of key epochs
+type keyring struct {
+	epoch    uint32     // Epoch of the current master key
+	previous []EpochKey // Retired keys, oldest first
+}
+
+// epochAAD binds a wrapped previous key to its epoch
+func epochAAD(epoch uint32) []byte {
+	return []byte("acorde key epoch " + strconv.FormatUint(uint64(epoch), 10))
+}
+
+// wrapPrevious wraps retired keys with the master key
+func (s *FileKeyStore) wrapPrevious(masterKey Key, previous []EpochKey) ([]previousKey, error) {
+	wrapped := make([]previousKey, len(previous))
+	for i, k := range previous {
+		data, err := s.cipher.Encrypt(masterKey, k.Key[:], epochAAD(k.Epoch))
+		if err != nil {
+			return nil, err
+		}
+		wrapped[i] = previousKey{
+			Epoch:       k.Epoch,
+			Fingerprint: k.Key.Fingerprint(),
+			Data:        base64.StdEncoding.EncodeToString(data),
+		}
+	}
+	return wrapped, nil
+}
+
+// keyring unwraps the retired keys of a key file with its master key
+func (s *FileKeyStore) keyring(masterKey Key, kf keyFileStruct) (keyring, error) {
+	ring := keyring{epoch: kf.Epoch, previous: make([]EpochKey, len(kf.Previous))}
+	for i, p := range kf.Previous {
+		data, err := base64.StdEncoding.DecodeString(p.Data)
+		if err != nil {
+			return keyring{}, err
+		}
+		plaintext, err := s.cipher.Decrypt(masterKey, data, epochAAD(p.Epoch))
+		if err != nil || len(plaintext) != KeySize {
+			return keyring{}, fmt.Errorf("key file: previous key of epoch %d does not open", p.Epoch)
+		}
+		ring.previous[i].Epoch = p.Epoch
+		copy(ring.previous[i].Key[:], plaintext)
+		clear(plaintext)
+	}
+	return ring, nil
+}
+
+// Keyring returns every vault key the key file holds, oldest first: the
+// keys retired by Rekey, then the current master key
+func (s *FileKeyStore) Keyring(password []byte) ([]EpochKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	kf, err := s.readKeyFile()
+	if err != nil {
+		return nil, err
+	}
+	masterKey, err := s.unlock(password, kf)
+	if err != nil {
+		return nil, err
+	}
+	ring, err := s.keyring(masterKey, kf)
+	if err != nil {
+		return nil, err
+	}
+	return append(ring.previous, EpochKey{Epoch: ring.epoch, Key: masterKey}), nil
+}
+
+// Epoch returns the epoch of the current master key, or 0 if the store is
+// not initialized
+func (s *FileKeyStore) Epoch() uint32 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	kf, err := s.readKeyFile()
+	if err != nil {
+		return 0
+	}
+	return kf.Epoch
+}
+
+// ErrUnknownEpoch is returned for data sealed with a key of an epoch the
+// keyring does not hold
+var ErrUnknownEpoch = errors.New("no key for this epoch")
+
+// KeyForEpoch returns the key of an epoch from a keyring
+func KeyForEpoch(keys []EpochKey, epoch uint32) (Key, error) {
+	for _, k := range keys {
+		if k.Epoch == epoch {
+			return k.Key, nil
+		}
+	}
+	return Key{}, fmt.Errorf("%w %d", ErrUnknownEpoch, epoch)
+}
@@ -0,0 +1,79 @@
+package crypto
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrHardwareUnsupported is returned for hardware key protection on a
+// platform without a default sealer (macOS: no TPM)
+var ErrHardwareUnsupported = errors.New("hardware key protection is not supported on this platform")
+
+// Sealer binds a small secret to a hardware device (TPM, Secure Enclave,
+// security key) so it can only be recovered on that device.
+type Sealer interface {
+	// Name identifies the sealer in key files, e.g. "tpm2"
+	Name() string
+
+	// Seal protects secret and returns an opaque blob safe to store on disk
+	Seal(secret []byte) ([]byte, error)
+
+	// Unseal recovers the secret from a blob produced by Seal
+	Unseal(blob []byte) ([]byte, error)
+}
+
+var (
+	sealersMu sync.RWMutex
+	sealers   = make(map[string]Sealer)
+)
+
+func init() {
+	if s := platformSealer(); s != nil {
+		sealers[s.Name()] = s
+	}
+}
+
+// DefaultSealer returns the hardware sealer of this platform: the TPM on
+// Linux and Windows. There is none on macOS (ErrHardwareUnsupported).
+func DefaultSealer() (Sealer, error) {
+	if s := platformSealer(); s != nil {
+		return s, nil
+	}
+	return nil, ErrHardwareUnsupported
+}
+
+// unsupportedSealer stands in for a missing default sealer, so a key
+// store asked for hardware protection fails rather than writing a
+// password-only key file
+type unsupportedSealer struct{}
+
+func (unsupportedSealer) Name() string                  { return "unsupported" }
+func (unsupportedSealer) Seal([]byte) ([]byte, error)   { return nil, ErrHardwareUnsupported }
+func (unsupportedSealer) Unseal([]byte) ([]byte, error) { return nil, ErrHardwareUnsupported }
+
+// RegisterSealer makes a sealer available to key stores by name, so
+// hardware-protected key files can be unlocked without configuring it
+// explicitly. It replaces any sealer registered under the same name.
+func RegisterSealer(s Sealer) {
+	sealersMu.Lock()
+	defer sealersMu.Unlock()
+	sealers[s.Name()] = s
+}
+
+// LookupSealer returns the registered sealer with the given name
+func LookupSealer(name string) (Sealer, error) {
+	sealersMu.RLock()
+	defer sealersMu.RUnlock()
+	s, ok := sealers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown hardware sealer %q", name)
+	}
+	return s, nil
+}
+
+// sealedKey is the hardware layer recorded in the key file
+type sealedKey struct {
+	Sealer string `json:"sealer"`
+	Blob   string `json:"blob"` // Sealed key-encryption key
+}
@@ -0,0 +1,123 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"io"
+)
+
+// CipherProvider abstracts the authenticated encryption and password-based
+// key derivation used for vault content. Deployments that require specific
+// algorithms (e.g. AES-GCM from a FIPS 140 module) can supply their own.
+type CipherProvider interface {
+	// Name identifies the algorithm suite, e.g. "xchacha20poly1305"
+	Name() string
+
+	// Encrypt seals plaintext, binding it to aad. The output must be
+	// self-contained (carry its own nonce).
+	Encrypt(key Key, plaintext, aad []byte) ([]byte, error)
+
+	// Decrypt opens ciphertext produced by Encrypt with the same key and aad.
+	// It returns ErrDecrypt on authentication failure.
+	Decrypt(key Key, ciphertext, aad []byte) ([]byte, error)
+
+	// DeriveKey derives a key from a password and salt
+	DeriveKey(password, salt []byte) Key
+}
+
+// Provider names
+const (
+	XChaCha20Poly1305Name = "xchacha20poly1305"
+	AESGCMName            = "aes256gcm-pbkdf2"
+)
+
+// DefaultCipher is the provider used when none is configured
+var DefaultCipher CipherProvider = XChaCha20Poly1305{}
+
+// XChaCha20Poly1305 is the default provider: XChaCha20-Poly1305 with
+// Argon2id key derivation
+type XChaCha20Poly1305 struct{}
+
+func (XChaCha20Poly1305) Name() string { return XChaCha20Poly1305Name }
+
+func (XChaCha20Poly1305) Encrypt(key Key, plaintext, aad []byte) ([]byte, error) {
+	return Encrypt(key, plaintext, aad)
+}
+
+func (XChaCha20Poly1305) Decrypt(key Key, ciphertext, aad []byte) ([]byte, error) {
+	return Decrypt(key, ciphertext, aad)
+}
+
+func (XChaCha20Poly1305) DeriveKey(password, salt []byte) Key {
+	return DeriveKey(password, salt)
+}
+
+// pbkdf2Iterations follows the OWASP recommendation for PBKDF2-HMAC-SHA256
+const pbkdf2Iterations = 600000
+
+// AESGCM uses AES-256-GCM with PBKDF2-HMAC-SHA256 key derivation, both from
+// the Go standard library, so it runs on the validated module when the binary
+// is built or run in FIPS 140 mode (GODEBUG=fips140=on).
+// Format: [Nonce 12][Ciphertext ...][Tag 16]
+type AESGCM struct{}
+
+func (AESGCM) Name() string { return AESGCMName }
+
+func (AESGCM) Encrypt(key Key, plaintext, aad []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func (AESGCM) Decrypt(key Key, ciphertext, aad []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+
+	nonce := ciphertext[:aead.NonceSize()]
+	plaintext, err := aead.Open(nil, nonce, ciphertext[aead.NonceSize():], aad)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+func (AESGCM) DeriveKey(password, salt []byte) Key {
+	var k Key
+	dk, err := pbkdf2.Key(sha256.New, string(password), salt, pbkdf2Iterations, KeySize)
+	if err != nil {
+		// Only possible in FIPS mode with a password or salt that is too
+		// short; callers generate SaltSize salts, so this is a misuse
+		panic(fmt.Sprintf("crypto: pbkdf2: %v", err))
+	}
+	copy(k[:], dk)
+	return k
+}
+
+func newGCM(key Key) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AEAD: %w", err)
+	}
+	return aead, nil
+}
@@ -0,0 +1,259 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Recovery shares split the master key with Shamir's secret sharing over
+// GF(256): any Threshold of the shares rebuild the key, fewer reveal
+// nothing about it.
+
+const (
+	shareVersion  = 1
+	shareChecksum = 2
+	// shareLen is the encoded size of a share: version, set ID, threshold,
+	// index, the key share and a checksum
+	shareLen = 1 + 2 + 1 + 1 + KeySize + shareChecksum
+)
+
+var (
+	ErrShareChecksum = errors.New("recovery share is mistyped or damaged")
+	ErrShareMismatch = errors.New("recovery shares are from different sets")
+)
+
+// Share is one recovery share of a master key
+type Share struct {
+	SetID     uint16 // Random ID shared by the shares of one split
+	Threshold int    // Shares needed to rebuild the key
+	Index     int    // 1-based; the x coordinate of the share
+	Value     [KeySize]byte
+}
+
+// SplitKey splits key into the given number of shares, any threshold of
+// which rebuild it with CombineShares
+func SplitKey(key Key, shares, threshold int) ([]Share, error) {
+	if threshold < 2 || threshold > shares || shares > 255 {
+		return nil, fmt.Errorf("invalid recovery shares: need 2 <= threshold (%d) <= shares (%d) <= 255", threshold, shares)
+	}
+
+	var id [2]byte
+	if _, err := io.ReadFull(rand.Reader, id[:]); err != nil {
+		return nil, err
+	}
+	out := make([]Share, shares)
+	for i := range out {
+		out[i] = Share{SetID: binary.BigEndian.Uint16(id[:]), Threshold: threshold, Index: i + 1}
+	}
+
+	// One random polynomial per key byte, with the byte as its constant term
+	coeffs := make([]byte, threshold)
+	for b := range key {
+		coeffs[0] = key[b]
+		if _, err := io.ReadFull(rand.Reader, coeffs[1:]); err != nil {
+			return nil, err
+		}
+		for i := range out {
+			out[i].Value[b] = gfEval(coeffs, byte(out[i].Index))
+		}
+	}
+	return out, nil
+}
+
+// CombineShares rebuilds a key from at least Threshold shares of one split.
+// A wrong set of shares can not be detected here; callers check the result
+// against something derived from the real key.
+func CombineShares(shares []Share) (Key, error) {
+	var key Key
+	if len(shares) == 0 {
+		return key, errors.New("no recovery shares")
+	}
+
+	first := shares[0]
+	seen := make(map[int]bool, len(shares))
+	for _, s := range shares {
+		if s.SetID != first.SetID || s.Threshold != first.Threshold {
+			return key, ErrShareMismatch
+		}
+		if s.Index < 1 || s.Index > 255 {
+			return key, fmt.Errorf("invalid recovery share index %d", s.Index)
+		}
+		if seen[s.Index] {
+			return key, fmt.Errorf("recovery share %d given twice", s.Index)
+		}
+		seen[s.Index] = true
+	}
+	if len(shares) < first.Threshold {
+		return key, fmt.Errorf("need %d recovery shares, have %d", first.Threshold, len(shares))
+	}
+	shares = shares[:first.Threshold]
+
+	// Lagrange interpolation at x = 0
+	for i, si := range shares {
+		xi := byte(si.Index)
+		weight := byte(1)
+		for j, sj := range shares {
+			if i != j {
+				xj := byte(sj.Index)
+				weight = gfMul(weight, gfDiv(xj, xj^xi))
+			}
+		}
+		for b := range key {
+			key[b] ^= gfMul(weight, si.Value[b])
+		}
+	}
+	return key, nil
+}
+
+// Words encodes the share as words from a fixed 256-word list, one per
+// byte, with a checksum that catches typos
+func (s Share) Words() string {
+	buf := make([]byte, 0, shareLen)
+	buf = append(buf, shareVersion)
+	buf = binary.BigEndian.AppendUint16(buf, s.SetID)
+	buf = append(buf, byte(s.Threshold), byte(s.Index))
+	buf = append(buf, s.Value[:]...)
+	sum := sha256.Sum256(buf)
+	buf = append(buf, sum[:shareChecksum]...)
+
+	words := make([]string, len(buf))
+	for i, b := range buf {
+		words[i] = shareWords[b]
+	}
+	return strings.Join(words, " ")
+}
+
+// ParseShare decodes a share written by Share.Words. Case and spacing do
+// not matter, and each word may be cut to its first four letters.
+func ParseShare(words string) (Share, error) {
+	var s Share
+	fields := strings.Fields(strings.ToLower(words))
+	if len(fields) != shareLen {
+		return s, fmt.Errorf("recovery share has %d words, want %d", len(fields), shareLen)
+	}
+
+	buf := make([]byte, len(fields))
+	for i, w := range fields {
+		b, ok := shareWordIndex[shareWordKey(w)]
+		if !ok || !strings.HasPrefix(shareWords[b], w) {
+			return s, fmt.Errorf("unknown word %q in recovery share", w)
+		}
+		buf[i] = b
+	}
+
+	body := buf[:shareLen-shareChecksum]
+	sum := sha256.Sum256(body)
+	if string(sum[:shareChecksum]) != string(buf[len(body):]) {
+		return s, ErrShareChecksum
+	}
+	if body[0] != shareVersion {
+		return s, fmt.Errorf("unsupported recovery share version %d", body[0])
+	}
+
+	s.SetID = binary.BigEndian.Uint16(body[1:3])
+	s.Threshold = int(body[3])
+	s.Index = int(body[4])
+	copy(s.Value[:], body[5:])
+	if s.Index == 0 || s.Threshold < 2 {
+		return s, ErrShareChecksum
+	}
+	return s, nil
+}
+
+// GF(256) with the AES polynomial x^8 + x^4 + x^3 + x + 1, generator 3
+var gfExp, gfLog [256]byte
+
+func init() {
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		gfExp[i] = x
+		gfLog[x] = byte(i)
+		// x *= 3
+		hi := x & 0x80
+		x2 := x << 1
+		if hi != 0 {
+			x2 ^= 0x1b
+		}
+		x ^= x2
+	}
+	gfExp[255] = gfExp[0]
+
+	for i, w := range shareWords {
+		shareWordIndex[shareWordKey(w)] = byte(i)
+	}
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[(int(gfLog[a])+int(gfLog[b]))%255]
+}
+
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return gfExp[(int(gfLog[a])-int(gfLog[b])+255)%255]
+}
+
+// gfEval evaluates the polynomial with the given coefficients at x
+func gfEval(coeffs []byte, x byte) byte {
+	var y byte
+	for i := len(coeffs) - 1; i >= 0; i-- {
+		y = gfMul(y, x) ^ coeffs[i]
+	}
+	return y
+}
+
+// shareWordKey is the lookup key for a share word: its first four letters,
+// which are unique in the list
+func shareWordKey(w string) string {
+	if len(w) > 4 {
+		return w[:4]
+	}
+	return w
+}
+
+var shareWordIndex = make(map[string]byte, len(shareWords))
+
+// shareWords encodes share bytes. Every word has a unique four-letter prefix.
+var shareWords = [256]string{
+	"acid", "acorn", "actor", "adult", "agent", "alarm", "alley", "amber",
+	"angle", "ankle", "apple", "apron", "arena", "armor", "arrow", "aspen",
+	"atlas", "attic", "award", "badge", "bagel", "baker", "bamboo", "banjo",
+	"barn", "basin", "basket", "beach", "beard", "beaver", "bench", "berry",
+	"birch", "bison", "blade", "blanket", "blaze", "blossom", "board", "bonus",
+	"boot", "bottle", "bowl", "branch", "bread", "bridge", "broom", "brush",
+	"bucket", "buffalo", "bugle", "cabin", "cable", "cactus", "camel", "candle",
+	"canoe", "canyon", "cargo", "carpet", "castle", "cedar", "cellar", "chalk",
+	"cherry", "chess", "chimney", "cider", "circus", "clay", "cliff", "clover",
+	"coast", "cobra", "comet", "copper", "coral", "cotton", "crane", "crater",
+	"crayon", "creek", "cricket", "crown", "cup", "curtain", "dagger", "daisy",
+	"delta", "desert", "diamond", "dinner", "doctor", "dolphin", "donkey", "dragon",
+	"drum", "echo", "elbow", "ember", "engine", "falcon", "feather", "fence",
+	"fern", "ferry", "fiddle", "finch", "flag", "flame", "forest", "fossil",
+	"fox", "frog", "galaxy", "garden", "garlic", "gate", "geyser", "ginger",
+	"glacier", "globe", "goat", "grape", "gravel", "guitar", "hammer", "harbor",
+	"harp", "hawk", "hazel", "helmet", "heron", "hill", "honey", "hornet",
+	"island", "ivory", "jacket", "jaguar", "jelly", "jewel", "jungle", "kayak",
+	"kernel", "kettle", "kitten", "koala", "ladder", "lake", "lantern", "laser",
+	"lemon", "lever", "lily", "lion", "lizard", "llama", "lobster", "locket",
+	"lotus", "magnet", "maple", "marble", "meadow", "melon", "mirror", "monkey",
+	"moose", "mosaic", "motor", "mountain", "mule", "museum", "needle", "nickel",
+	"noodle", "oasis", "ocean", "olive", "onion", "orange", "orbit", "orchid",
+	"otter", "owl", "oyster", "paddle", "panda", "panther", "parrot", "peach",
+	"pebble", "pelican", "pencil", "pepper", "piano", "pigeon", "pilot", "pine",
+	"planet", "pocket", "pony", "poppy", "potato", "prism", "pumpkin", "puzzle",
+	"quartz", "quill", "rabbit", "radar", "radio", "raven", "ribbon", "river",
+	"robin", "rocket", "rose", "ruby", "saddle", "salmon", "satin", "scarf",
+	"shell", "shovel", "silver", "sled", "snail", "sparrow", "spider", "spruce",
+	"squid", "stamp", "statue", "stone", "summit", "swan", "table", "tiger",
+	"toast", "tomato", "tulip", "tunnel", "turtle", "umbrella", "valley", "velvet",
+	"violin", "walnut", "whale", "willow", "window", "wolf", "yacht", "zebra",
+}
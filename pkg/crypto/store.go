@@ -1,6 +1,9 @@
 package crypto
 
 import (
+	"cmp"
+	"crypto/hmac"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -8,8 +11,6 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
-
-	"golang.org/x/crypto/argon2"
 )
 
 const KeyFileName = "keys.json"
@@ -33,27 +34,107 @@ type KeyStore interface {
 
 // FileKeyStore implements KeyStore using a file
 type FileKeyStore struct {
-	dir string
-	mu  sync.RWMutex
+	dir    string
+	cipher CipherProvider
+	sealer Sealer // Hardware protection for new key files (nil = password only)
+	argon2 *Argon2Params
+	mu     sync.RWMutex
 }
 
 // keyFileStruct is the JSON structure for the key file
 type keyFileStruct struct {
-	Salt      string `json:"salt"`
-	Ciphertext string `json:"data"` // Encrypted master key
-	Params    params `json:"params"`
+	Salt       string       `json:"salt"`
+	Ciphertext string       `json:"data"`               // Encrypted master key
+	Params     Argon2Params `json:"params,omitzero"`    // Argon2id parameters (default cipher only)
+	Cipher     string       `json:"cipher,omitempty"`   // CipherProvider name; empty means the default
+	Hardware   *sealedKey   `json:"hardware,omitempty"` // Set when data is also wrapped by a hardware-sealed key
+	Recovery   *recovery    `json:"recovery,omitempty"` // Set when recovery shares were made for this key
+
+	Epoch    uint32        `json:"epoch,omitempty"`    // Epoch of the master key (see EpochKey)
+	Previous []previousKey `json:"previous,omitempty"` // Keys retired by Rekey, oldest first
 }
 
-type params struct {
-	Memory      uint32 `json:"mem"`
-	Iterations  uint32 `json:"time"`
-	Parallelism uint8  `json:"threads"`
+// recovery records the recovery shares made for the master key, so that
+// Recover can tell a wrong set of shares from the right one
+type recovery struct {
+	SetID     uint16 `json:"set"`
+	Shares    int    `json:"shares,omitempty"`
+	Threshold int    `json:"threshold"`
+	Check     string `json:"check"` // recoveryCheck of the master key
 }
 
 // NewFileKeyStore creates a new filesystem-backed KeyStore.
 // The key file will be stored at <dir>/keys.json.
 func NewFileKeyStore(dir string) *FileKeyStore {
-	return &FileKeyStore{dir: dir}
+	return NewFileKeyStoreWithCipher(dir, nil)
+}
+
+// NewFileKeyStoreWithCipher creates a KeyStore that wraps the master key
+// with the given provider. A nil provider uses DefaultCipher.
+func NewFileKeyStoreWithCipher(dir string, cipher CipherProvider) *FileKeyStore {
+	if cipher == nil {
+		cipher = DefaultCipher
+	}
+	return &FileKeyStore{dir: dir, cipher: cipher}
+}
+
+// NewHardwareKeyStore creates a KeyStore whose key file additionally
+// requires a hardware device to unlock: the password-wrapped master key is
+// encrypted with a random key sealed by sealer (nil = DefaultSealer), so
+// the key file alone is useless off this machine. Without a default
+// sealer, writing the key file fails with ErrHardwareUnsupported.
+//
+// Any FileKeyStore can unlock a hardware-protected key file as long as the
+// sealer named in it is registered (see RegisterSealer).
+func NewHardwareKeyStore(dir string, sealer Sealer) *FileKeyStore {
+	if sealer == nil {
+		var err error
+		if sealer, err = DefaultSealer(); err != nil {
+			sealer = unsupportedSealer{}
+		}
+	}
+	s := NewFileKeyStore(dir)
+	s.sealer = sealer
+	return s
+}
+
+// SetArgon2Params sets the Argon2id parameters for key files written from
+// now on, by Initialize, Rekey and Recover. Without it, new key files use
+// DefaultArgon2Params and rewritten ones keep theirs. Only the default
+// cipher uses Argon2id.
+func (s *FileKeyStore) SetArgon2Params(p Argon2Params) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.argon2 = &p
+	return nil
+}
+
+// Argon2Params returns the Argon2id parameters of the key file, if it uses
+// the default cipher
+func (s *FileKeyStore) Argon2Params() (Argon2Params, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	kf, err := s.readKeyFile()
+	if err != nil || kf.Cipher != "" {
+		return Argon2Params{}, false
+	}
+	return kf.Params, true
+}
+
+// kdfParams returns the Argon2id parameters to write a key file with,
+// given the one it replaces, if any
+func (s *FileKeyStore) kdfParams(old *keyFileStruct) Argon2Params {
+	switch {
+	case s.argon2 != nil:
+		return *s.argon2
+	case old != nil && old.Params != (Argon2Params{}):
+		return old.Params
+	}
+	return DefaultArgon2Params
 }
 
 func (s *FileKeyStore) Initialize(password []byte) error {
@@ -64,60 +145,201 @@ func (s *FileKeyStore) Initialize(password []byte) error {
 		return fmt.Errorf("keystore already initialized")
 	}
 
-	// 1. Generate master key
+	// Generate master key
 	masterKey, err := GenerateKey()
 	if err != nil {
 		return err
 	}
 
-	// 2. Generate salt for password wrapper
-	salt, err := GenerateSalt()
-	if err != nil {
-		return err
+	return s.writeKeyFile(password, masterKey, s.sealer, s.kdfParams(nil), keyring{})
+}
+
+func (s *FileKeyStore) InitializeWithKey(password []byte, masterKey Key) error {
+	return s.InitializeWithEpochKey(password, EpochKey{Key: masterKey})
+}
+
+// InitializeWithEpochKey is InitializeWithKey for a key received from
+// another device, kept at the epoch it has there: content sealed with it
+// names that epoch
+func (s *FileKeyStore) InitializeWithEpochKey(password []byte, key EpochKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.isInitialized() {
+		return fmt.Errorf("keystore already initialized")
 	}
 
-	// 3. Derive wrapper key from password
-	wrapperKey := DeriveKey(password, salt)
+	return s.writeKeyFile(password, key.Key, s.sealer, s.kdfParams(nil), keyring{epoch: key.Epoch})
+}
 
-	// 4. Encrypt master key with wrapper key
-	// Use path as AAD to prevent file substitution
-	aad := []byte(filepath.Base(s.dir)) 
-	encryptedKey, err := Encrypt(wrapperKey, masterKey[:], aad)
+// Rekey replaces the stored master key after a key rotation. The password
+// must unlock the current key file; cipher, hardware protection and,
+// unless set with SetArgon2Params, Argon2id parameters are kept as they are.
+// The replaced key is kept, wrapped with the new one, and the new key
+// starts the next epoch (see Keyring).
+func (s *FileKeyStore) Rekey(password []byte, masterKey Key) error {
+	return s.AdoptKey(password, EpochKey{Key: masterKey})
+}
+
+// AdoptKey is Rekey for a key rotated on another device, which starts the
+// epoch it has there. Epoch 0, from devices that do not send epochs,
+// means the next one.
+func (s *FileKeyStore) AdoptKey(password []byte, key EpochKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kf, err := s.readKeyFile()
 	if err != nil {
 		return err
 	}
-
-	// 5. Save to file
-	kf := keyFileStruct{
-		Salt:       base64.StdEncoding.EncodeToString(salt),
-		Ciphertext: base64.StdEncoding.EncodeToString(encryptedKey),
-		Params: params{
-			Memory:      64 * 1024,
-			Iterations:  3,
-			Parallelism: 2,
-		},
+	current, err := s.unlock(password, kf)
+	if err != nil {
+		return err
 	}
-
-	data, err := json.MarshalIndent(kf, "", "  ")
+	ring, err := s.keyring(current, kf)
 	if err != nil {
 		return err
 	}
+	if key.Key != current {
+		ring.previous = append(ring.previous, EpochKey{Epoch: ring.epoch, Key: current})
+		ring.epoch = cmp.Or(key.Epoch, ring.epoch+1)
+	}
 
-	if err := os.MkdirAll(s.dir, 0700); err != nil {
-		return err
+	var sealer Sealer
+	if kf.Hardware != nil {
+		if sealer, err = s.sealerFor(kf.Hardware.Sealer); err != nil {
+			return err
+		}
 	}
+	return s.writeKeyFile(password, key.Key, sealer, s.kdfParams(&kf), ring)
+}
 
-	return os.WriteFile(filepath.Join(s.dir, KeyFileName), data, 0600)
+// CreateRecoveryShares splits the master key into recovery shares, any
+// threshold of which can replace the password with Recover. The password
+// must unlock the key file. Making new shares retires the previous set,
+// and so does Rekey: shares of an old key would not open the vault.
+func (s *FileKeyStore) CreateRecoveryShares(password []byte, shares, threshold int) ([]Share, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kf, err := s.readKeyFile()
+	if err != nil {
+		return nil, err
+	}
+	masterKey, err := s.unlock(password, kf)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := SplitKey(masterKey, shares, threshold)
+	if err != nil {
+		return nil, err
+	}
+	kf.Recovery = &recovery{
+		SetID:     out[0].SetID,
+		Shares:    shares,
+		Threshold: threshold,
+		Check:     recoveryCheck(masterKey, out[0].SetID),
+	}
+	if err := s.saveKeyFile(kf); err != nil {
+		return nil, err
+	}
+	return out, nil
 }
 
-func (s *FileKeyStore) InitializeWithKey(password []byte, masterKey Key) error {
+// Recover rebuilds the master key from recovery shares and protects it
+// with a new password, replacing the forgotten one. If the key file still
+// exists the shares must match the set recorded in it; hardware protection
+// is kept if the sealer is still available. Without a key file, a new one
+// is written with the recovered key. Either way the shares stay valid.
+func (s *FileKeyStore) Recover(shares []Share, newPassword []byte) (Key, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	masterKey, err := CombineShares(shares)
+	if err != nil {
+		return Key{}, err
+	}
+
+	sealer := s.sealer
+	var old *keyFileStruct
+	var rec *recovery
+	var ring keyring
 	if s.isInitialized() {
-		return fmt.Errorf("keystore already initialized")
+		kf, err := s.readKeyFile()
+		if err != nil {
+			return Key{}, err
+		}
+		if kf.Recovery == nil {
+			return Key{}, errors.New("no recovery shares were made for this vault")
+		}
+		if shares[0].SetID != kf.Recovery.SetID {
+			return Key{}, errors.New("recovery shares are not from this vault's current set")
+		}
+		if recoveryCheck(masterKey, kf.Recovery.SetID) != kf.Recovery.Check {
+			return Key{}, errors.New("recovery shares do not rebuild this vault's key")
+		}
+		if kf.Hardware != nil {
+			if hw, err := s.sealerFor(kf.Hardware.Sealer); err == nil {
+				sealer = hw
+			}
+		}
+		if ring, err = s.keyring(masterKey, kf); err != nil {
+			return Key{}, err
+		}
+		rec = kf.Recovery
+		old = &kf
+	} else {
+		// The shares stay valid for the rebuilt key file; how many were made
+		// is not known
+		rec = &recovery{
+			SetID:     shares[0].SetID,
+			Threshold: shares[0].Threshold,
+			Check:     recoveryCheck(masterKey, shares[0].SetID),
+		}
 	}
 
+	if err := s.writeKeyFile(newPassword, masterKey, sealer, s.kdfParams(old), ring); err != nil {
+		return Key{}, err
+	}
+	kf, err := s.readKeyFile()
+	if err != nil {
+		return Key{}, err
+	}
+	kf.Recovery = rec
+	if err := s.saveKeyFile(kf); err != nil {
+		return Key{}, err
+	}
+	return masterKey, nil
+}
+
+// Recovery reports how many recovery shares exist for the key and how many
+// are needed, or 0, 0 if none were made. shares is 0 if the key file was
+// rebuilt by Recover, which does not know how many were made.
+func (s *FileKeyStore) Recovery() (shares, threshold int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	kf, err := s.readKeyFile()
+	if err != nil || kf.Recovery == nil {
+		return 0, 0
+	}
+	return kf.Recovery.Shares, kf.Recovery.Threshold
+}
+
+// recoveryCheck derives a short value from the master key that tells
+// whether recovered shares rebuilt the right key, without revealing it
+func recoveryCheck(masterKey Key, setID uint16) string {
+	mac := hmac.New(sha256.New, masterKey[:])
+	mac.Write([]byte("acorde recovery"))
+	mac.Write([]byte{byte(setID >> 8), byte(setID)})
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// writeKeyFile encrypts the master key with a password-derived wrapper key,
+// and with a key sealed by sealer if non-nil, and persists it with the
+// keys of ring wrapped by it. kdf applies to the default cipher only.
+func (s *FileKeyStore) writeKeyFile(password []byte, masterKey Key, sealer Sealer, kdf Argon2Params, ring keyring) error {
 	// 1. Generate salt for password wrapper
 	salt, err := GenerateSalt()
 	if err != nil {
@@ -125,30 +347,59 @@ func (s *FileKeyStore) InitializeWithKey(password []byte, masterKey Key) error {
 	}
 
 	// 2. Derive wrapper key from password
-	// Use standard params for new keys
-	params := params{
-		Memory:      64 * 1024,
-		Iterations:  3,
-		Parallelism: 2,
+	kf := keyFileStruct{
+		Salt: base64.StdEncoding.EncodeToString(salt),
+	}
+	if s.cipher.Name() == XChaCha20Poly1305Name {
+		kf.Params = kdf
+	} else {
+		kf.Cipher = s.cipher.Name()
+	}
+	wrapperKey, err := s.wrapperKey(password, salt, kf)
+	if err != nil {
+		return err
 	}
-	dk := argon2.IDKey(password, salt, params.Iterations, params.Memory, params.Parallelism, KeySize)
-	wrapperKey := Key{}
-	copy(wrapperKey[:], dk)
 
 	// 3. Encrypt master key with wrapper key
+	// Use path as AAD to prevent file substitution
 	aad := []byte(filepath.Base(s.dir))
-	encryptedKey, err := Encrypt(wrapperKey, masterKey[:], aad)
+	encryptedKey, err := s.cipher.Encrypt(wrapperKey, masterKey[:], aad)
 	if err != nil {
 		return err
 	}
 
-	// 4. Save to file
-	kf := keyFileStruct{
-		Salt:       base64.StdEncoding.EncodeToString(salt),
-		Ciphertext: base64.StdEncoding.EncodeToString(encryptedKey),
-		Params:     params,
+	// 4. Wrap again with a hardware-sealed key, if configured
+	if sealer != nil {
+		kek, err := GenerateKey()
+		if err != nil {
+			return err
+		}
+		blob, err := sealer.Seal(kek[:])
+		if err != nil {
+			return fmt.Errorf("failed to seal key with %s: %w", sealer.Name(), err)
+		}
+		if encryptedKey, err = s.cipher.Encrypt(kek, encryptedKey, aad); err != nil {
+			return err
+		}
+		kf.Hardware = &sealedKey{
+			Sealer: sealer.Name(),
+			Blob:   base64.StdEncoding.EncodeToString(blob),
+		}
 	}
+	kf.Ciphertext = base64.StdEncoding.EncodeToString(encryptedKey)
 
+	// 5. Keep the keys of earlier epochs
+	kf.Epoch = ring.epoch
+	if kf.Previous, err = s.wrapPrevious(masterKey, ring.previous); err != nil {
+		return err
+	}
+
+	// 6. Save to file
+	return s.saveKeyFile(kf)
+}
+
+// saveKeyFile writes the key file
+func (s *FileKeyStore) saveKeyFile(kf keyFileStruct) error {
 	data, err := json.MarshalIndent(kf, "", "  ")
 	if err != nil {
 		return err
@@ -161,22 +412,53 @@ func (s *FileKeyStore) InitializeWithKey(password []byte, masterKey Key) error {
 	return os.WriteFile(filepath.Join(s.dir, KeyFileName), data, 0600)
 }
 
+// wrapperKey derives the key that wraps the master key. The default cipher
+// uses the Argon2id parameters stored in the key file; other providers use
+// their own DeriveKey.
+func (s *FileKeyStore) wrapperKey(password, salt []byte, kf keyFileStruct) (Key, error) {
+	name := kf.Cipher
+	if name == "" {
+		name = XChaCha20Poly1305Name
+	}
+	if name != s.cipher.Name() {
+		return Key{}, fmt.Errorf("key file uses cipher %q, keystore configured for %q", name, s.cipher.Name())
+	}
+
+	if kf.Cipher != "" {
+		return s.cipher.DeriveKey(password, salt), nil
+	}
+	if err := kf.Params.Validate(); err != nil {
+		return Key{}, fmt.Errorf("key file: %w", err)
+	}
+	return deriveArgon2(password, salt, kf.Params), nil
+}
+
 func (s *FileKeyStore) Unlock(password []byte) (Key, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	var k Key
-
 	// 1. Read file
-	data, err := os.ReadFile(filepath.Join(s.dir, KeyFileName))
+	kf, err := s.readKeyFile()
 	if err != nil {
-		return k, err
+		return Key{}, err
 	}
+	return s.unlock(password, kf)
+}
 
+// readKeyFile loads and parses the key file
+func (s *FileKeyStore) readKeyFile() (keyFileStruct, error) {
 	var kf keyFileStruct
-	if err := json.Unmarshal(data, &kf); err != nil {
-		return k, err
+	data, err := os.ReadFile(filepath.Join(s.dir, KeyFileName))
+	if err != nil {
+		return kf, err
 	}
+	err = json.Unmarshal(data, &kf)
+	return kf, err
+}
+
+// unlock decrypts the master key from a parsed key file
+func (s *FileKeyStore) unlock(password []byte, kf keyFileStruct) (Key, error) {
+	var k Key
 
 	// 2. Decode fields
 	salt, err := base64.StdEncoding.DecodeString(kf.Salt)
@@ -188,22 +470,23 @@ func (s *FileKeyStore) Unlock(password []byte) (Key, error) {
 		return k, err
 	}
 
-	// 3. Derive wrapper key
-	// Ensure params from file are used if possible (currently hardcoded in DeriveKey, 
-	// so we actually need to update DeriveKey to accept params OR just validate they match defaults for now.
-	// Since DeriveKey API is fixed to constants, we should probably update DeriveKey or validate params.
-	// For now, let's validate parallelism/memory/iterations match what we expect.
-	// If we want to support changing params, we need to pass them to Argon2.
-	
-	// Better fix: Update DeriveKey to take params, or just use the values from json.
-	// Let's use the values from JSON.
-	dk := argon2.IDKey(password, salt, kf.Params.Iterations, kf.Params.Memory, kf.Params.Parallelism, KeySize)
-	wrapperKey := Key{}
-	copy(wrapperKey[:], dk)
-
-	// 4. Decrypt master key
 	aad := []byte(filepath.Base(s.dir))
-	plaintext, err := Decrypt(wrapperKey, ciphertext, aad)
+
+	// 3. Remove the hardware layer, if any
+	if kf.Hardware != nil {
+		if ciphertext, err = s.unseal(kf.Hardware, ciphertext, aad); err != nil {
+			return k, err
+		}
+	}
+
+	// 4. Derive wrapper key using the parameters recorded in the file
+	wrapperKey, err := s.wrapperKey(password, salt, kf)
+	if err != nil {
+		return k, err
+	}
+
+	// 5. Decrypt master key
+	plaintext, err := s.cipher.Decrypt(wrapperKey, ciphertext, aad)
 	if err != nil {
 		return k, errors.New("incorrect password or corrupted key file")
 	}
@@ -216,6 +499,59 @@ func (s *FileKeyStore) Unlock(password []byte) (Key, error) {
 	return k, nil
 }
 
+// unseal recovers the hardware-sealed key and decrypts the outer layer
+func (s *FileKeyStore) unseal(hw *sealedKey, ciphertext, aad []byte) ([]byte, error) {
+	sealer, err := s.sealerFor(hw.Sealer)
+	if err != nil {
+		return nil, err
+	}
+
+	blob, err := base64.StdEncoding.DecodeString(hw.Blob)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := sealer.Unseal(blob)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unseal key with %s: %w", hw.Sealer, err)
+	}
+	if len(secret) != KeySize {
+		return nil, errors.New("invalid sealed key size")
+	}
+
+	var kek Key
+	copy(kek[:], secret)
+	plaintext, err := s.cipher.Decrypt(kek, ciphertext, aad)
+	if err != nil {
+		return nil, errors.New("hardware key does not match key file")
+	}
+	return plaintext, nil
+}
+
+// sealerFor returns the configured sealer if it has the given name, or the
+// registered one
+func (s *FileKeyStore) sealerFor(name string) (Sealer, error) {
+	if s.sealer != nil && s.sealer.Name() == name {
+		return s.sealer, nil
+	}
+	return LookupSealer(name)
+}
+
+// Protection describes how the key file is protected: "password", or
+// "hardware (<sealer>)". It returns "" if the store is not initialized.
+func (s *FileKeyStore) Protection() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	kf, err := s.readKeyFile()
+	if err != nil {
+		return ""
+	}
+	if kf.Hardware != nil {
+		return fmt.Sprintf("hardware (%s)", kf.Hardware.Sealer)
+	}
+	return "password"
+}
+
 func (s *FileKeyStore) IsInitialized() bool {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
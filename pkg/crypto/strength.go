@@ -0,0 +1,299 @@
+package crypto
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// MinPasswordEntropy is the default password policy, in bits: a password
+// below it is refused where a policy applies (see CheckPassword)
+const MinPasswordEntropy = 40
+
+// PasswordStrength estimates how hard a password is to guess
+type PasswordStrength struct {
+	Entropy     float64  `json:"entropy_bits"` // log2 of the estimated guesses
+	Score       int      `json:"score"`        // 0 (too guessable) to 4 (very strong)
+	Warning     string   `json:"warning,omitempty"`
+	Suggestions []string `json:"suggestions,omitempty"`
+}
+
+// ErrWeakPassword is returned by CheckPassword for a password below the
+// policy
+type ErrWeakPassword struct {
+	Strength PasswordStrength
+	Min      float64
+}
+
+func (e *ErrWeakPassword) Error() string {
+	msg := fmt.Sprintf("password too weak: about %.0f bits, need %.0f", e.Strength.Entropy, e.Min)
+	if e.Strength.Warning != "" {
+		msg += " (" + e.Strength.Warning + ")"
+	}
+	return msg
+}
+
+// CheckPassword estimates the strength of a password and returns an
+// *ErrWeakPassword if it is below minEntropy bits. A minEntropy of 0
+// accepts any password.
+func CheckPassword(password []byte, minEntropy float64) (PasswordStrength, error) {
+	s := EstimateStrength(password)
+	if s.Entropy < minEntropy {
+		return s, &ErrWeakPassword{Strength: s, Min: minEntropy}
+	}
+	return s, nil
+}
+
+// EstimateStrength estimates the strength of a password the way zxcvbn
+// does, on a small scale: it splits the password into the cheapest run of
+// guessable patterns (common passwords and words, also capitalized or in
+// l33t, keyboard rows, sequences, repeats and years) and brute-forced
+// characters, and adds up their guesses.
+func EstimateStrength(password []byte) PasswordStrength {
+	runes := []rune(string(password))
+	n := len(runes)
+	lower := []rune(strings.ToLower(string(password)))
+	charBits := math.Log2(float64(charsetSize(runes)))
+
+	// best[i] is the fewest bits to guess runes[:i], the last pattern of
+	// which is how[i] (empty for a brute-forced character) from from[i]
+	best := make([]float64, n+1)
+	how := make([]string, n+1)
+	from := make([]int, n+1)
+	for i := 1; i <= n; i++ {
+		best[i] = math.Inf(1)
+	}
+	for i := 0; i < n; i++ {
+		if bits := best[i] + charBits; bits < best[i+1] {
+			best[i+1], how[i+1], from[i+1] = bits, "", i
+		}
+		for _, m := range matchesAt(runes, lower, i) {
+			if bits := best[i] + m.bits; bits < best[i+m.length] {
+				best[i+m.length], how[i+m.length], from[i+m.length] = bits, m.kind, i
+			}
+		}
+	}
+
+	s := PasswordStrength{Entropy: best[n]}
+	if n == 0 {
+		s.Entropy = 0
+	}
+	switch {
+	case s.Entropy < 20:
+		s.Score = 0
+	case s.Entropy < 35:
+		s.Score = 1
+	case s.Entropy < MinPasswordEntropy+10:
+		s.Score = 2
+	case s.Entropy < 65:
+		s.Score = 3
+	default:
+		s.Score = 4
+	}
+
+	kinds := map[string]bool{}
+	for i := n; i > 0; i = from[i] {
+		kinds[how[i]] = true
+	}
+	switch {
+	case n == 0:
+		s.Warning = "the password is empty"
+	case kinds["common"] && s.Score < 3:
+		s.Warning = "this is a commonly used password"
+	case kinds["word"] && s.Score < 3:
+		s.Warning = "a single word is easy to guess"
+	case kinds["keyboard"] && s.Score < 3:
+		s.Warning = "keyboard patterns are easy to guess"
+	case kinds["sequence"] && s.Score < 3:
+		s.Warning = "sequences like abc or 123 are easy to guess"
+	case kinds["repeat"] && s.Score < 3:
+		s.Warning = "repeated characters are easy to guess"
+	case kinds["year"] && s.Score < 3:
+		s.Warning = "years are easy to guess"
+	}
+	if s.Score < 3 {
+		s.Suggestions = append(s.Suggestions, "use several unrelated words, or a longer passphrase")
+		if n < 12 {
+			s.Suggestions = append(s.Suggestions, "add more characters: length matters most")
+		}
+	}
+	return s
+}
+
+// patternMatch is a guessable pattern found in a password
+type patternMatch struct {
+	kind   string
+	length int
+	bits   float64
+}
+
+// matchesAt returns the patterns starting at position i
+func matchesAt(runes, lower []rune, i int) []patternMatch {
+	var out []patternMatch
+	rest := string(lower[i:])
+
+	// Common passwords and words, by rank, also capitalized or in l33t
+	unleet := []rune(strings.Map(unleetRune, rest))
+	for rank, w := range commonWords {
+		kind := "word"
+		if rank < commonPasswords {
+			kind = "common"
+		}
+		l := len([]rune(w))
+		if l > len(unleet) || string(unleet[:l]) != w {
+			continue
+		}
+		bits := math.Log2(float64(rank + 1))
+		if string(lower[i:i+l]) != w {
+			bits++ // l33t
+		}
+		if string(runes[i:i+l]) != string(lower[i:i+l]) {
+			bits++ // Capitalized
+		}
+		out = append(out, patternMatch{kind, l, bits})
+	}
+
+	// Keyboard rows and alphabetic or numeric sequences, either direction
+	for _, seq := range sequences {
+		if l := runLength(lower[i:], seq.chars); l >= 3 {
+			out = append(out, patternMatch{seq.kind, l, math.Log2(float64(len(seq.chars))) + math.Log2(float64(l)) + 1})
+		}
+	}
+
+	// Repeats of one character
+	l := 1
+	for i+l < len(runes) && runes[i+l] == runes[i] {
+		l++
+	}
+	if l >= 3 {
+		out = append(out, patternMatch{"repeat", l, math.Log2(float64(charsetSize(runes[i:i+1]))) + math.Log2(float64(l))})
+	}
+
+	// Years 1900-2099
+	if len(runes)-i >= 4 {
+		y := string(runes[i : i+4])
+		if (strings.HasPrefix(y, "19") || strings.HasPrefix(y, "20")) && isDigits(y) {
+			out = append(out, patternMatch{"year", 4, math.Log2(200)})
+		}
+	}
+	return out
+}
+
+// runLength is how many runes from the start of s follow chars, forwards
+// or backwards, one step at a time
+func runLength(s []rune, chars string) int {
+	set := []rune(chars)
+	pos := -1
+	for j, c := range set {
+		if len(s) > 0 && c == s[0] {
+			pos = j
+			break
+		}
+	}
+	if pos < 0 || len(s) < 2 {
+		return 0
+	}
+
+	var best int
+	for _, dir := range []int{1, -1} {
+		l := 1
+		for p := pos + dir; l < len(s) && p >= 0 && p < len(set) && set[p] == s[l]; p += dir {
+			l++
+		}
+		best = max(best, l)
+	}
+	return best
+}
+
+// charsetSize is the size of the character classes a password uses, the
+// space a brute-force search covers
+func charsetSize(runes []rune) int {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range runes {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < 128 && unicode.IsPrint(r):
+			symbol = true
+		default:
+			other = true
+		}
+	}
+	size := 0
+	for _, class := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.used {
+			size += class.size
+		}
+	}
+	return max(size, 1)
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// unleetRune undoes common l33t substitutions
+func unleetRune(r rune) rune {
+	switch r {
+	case '4', '@':
+		return 'a'
+	case '3':
+		return 'e'
+	case '1', '!':
+		return 'i'
+	case '0':
+		return 'o'
+	case '5', '$':
+		return 's'
+	case '7':
+		return 't'
+	}
+	return r
+}
+
+var sequences = []struct {
+	kind  string
+	chars string
+}{
+	{"sequence", "abcdefghijklmnopqrstuvwxyz"},
+	{"sequence", "0123456789"},
+	{"keyboard", "qwertyuiop"},
+	{"keyboard", "asdfghjkl"},
+	{"keyboard", "zxcvbnm"},
+	{"keyboard", "1234567890"},
+}
+
+// commonPasswords is how many of commonWords, from the start, are
+// passwords rather than words
+const commonPasswords = 40
+
+// commonWords are common passwords, then common words, most common first
+var commonWords = []string{
+	"password", "qwerty", "letmein", "dragon", "monkey", "iloveyou", "admin",
+	"welcome", "login", "abc123", "football", "baseball", "master", "sunshine",
+	"shadow", "princess", "trustno1", "superman", "batman", "starwars",
+	"whatever", "freedom", "hello", "charlie", "michael", "jennifer", "jordan",
+	"hunter", "ranger", "buster", "soccer", "hockey", "killer", "pepper",
+	"secret", "changeme", "access", "flower", "cheese", "ninja",
+	"love", "time", "life", "world", "house", "money", "summer", "winter",
+	"spring", "autumn", "happy", "family", "friend", "music", "computer",
+	"internet", "garden", "orange", "purple", "yellow", "silver", "golden",
+	"angel", "heart", "peace", "power", "magic", "tiger", "apple", "banana",
+	"cookie", "chocolate", "coffee", "pizza", "rainbow", "dream", "light",
+	"night", "star", "moon", "sun", "water", "fire", "earth", "storm",
+	"thunder", "phoenix", "knight", "king", "queen", "prince", "lucky",
+	"forever", "vault", "acorde",
+}
@@ -0,0 +1,131 @@
+package crypto
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/google/go-tpm/legacy/tpm2"
+	"github.com/google/go-tpm/tpmutil"
+)
+
+// TPMSealerName is the key file name of the TPM 2.0 sealer
+const TPMSealerName = "tpm2"
+
+// TPMSealer seals secrets to the machine's TPM 2.0 under the storage
+// hierarchy. The primary key is re-derived from the owner seed on every use,
+// so nothing but the sealed blob needs to be stored. The owner hierarchy is
+// assumed to have an empty password (the default on Linux and Windows).
+type TPMSealer struct {
+	// Path is the TPM device or simulator socket.
+	// Empty uses /dev/tpmrm0 (then /dev/tpm0) on Linux and TBS on Windows;
+	// macOS has no TPM and needs a simulator socket.
+	Path string
+}
+
+// srkTemplate is the storage root key template: an ECC P-256 restricted
+// decryption key, as recommended by the TCG provisioning guidance
+var srkTemplate = tpm2.Public{
+	Type:       tpm2.AlgECC,
+	NameAlg:    tpm2.AlgSHA256,
+	Attributes: tpm2.FlagStorageDefault | tpm2.FlagNoDA,
+	ECCParameters: &tpm2.ECCParams{
+		Symmetric: &tpm2.SymScheme{Alg: tpm2.AlgAES, KeyBits: 128, Mode: tpm2.AlgCFB},
+		CurveID:   tpm2.CurveNISTP256,
+	},
+}
+
+// sealTemplate is a keyed-hash object holding caller data, usable only
+// under the parent it was created with on this TPM
+var sealTemplate = tpm2.Public{
+	Type:       tpm2.AlgKeyedHash,
+	NameAlg:    tpm2.AlgSHA256,
+	Attributes: tpm2.FlagFixedTPM | tpm2.FlagFixedParent | tpm2.FlagUserWithAuth | tpm2.FlagNoDA,
+	KeyedHashParameters: &tpm2.KeyedHashParams{
+		Alg: tpm2.AlgNull,
+	},
+}
+
+func (TPMSealer) Name() string { return TPMSealerName }
+
+// Seal creates a sealed data object under the storage root key.
+// Blob format: [len 2][public][len 2][private]
+func (s TPMSealer) Seal(secret []byte) ([]byte, error) {
+	rw, srk, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	defer rw.Close()
+	defer tpm2.FlushContext(rw, srk)
+
+	private, public, _, _, _, err := tpm2.CreateKeyWithSensitive(rw, srk, tpm2.PCRSelection{}, "", "", sealTemplate, secret)
+	if err != nil {
+		return nil, fmt.Errorf("tpm: failed to seal: %w", err)
+	}
+
+	blob := make([]byte, 0, 4+len(public)+len(private))
+	blob = binary.BigEndian.AppendUint16(blob, uint16(len(public)))
+	blob = append(blob, public...)
+	blob = binary.BigEndian.AppendUint16(blob, uint16(len(private)))
+	blob = append(blob, private...)
+	return blob, nil
+}
+
+// Unseal loads the sealed object and returns its data. It fails on any
+// other TPM, or if the TPM has been cleared.
+func (s TPMSealer) Unseal(blob []byte) ([]byte, error) {
+	public, rest, err := splitU16(blob)
+	if err != nil {
+		return nil, err
+	}
+	private, _, err := splitU16(rest)
+	if err != nil {
+		return nil, err
+	}
+
+	rw, srk, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	defer rw.Close()
+	defer tpm2.FlushContext(rw, srk)
+
+	handle, _, err := tpm2.Load(rw, srk, "", public, private)
+	if err != nil {
+		return nil, fmt.Errorf("tpm: failed to load sealed key (different or cleared TPM?): %w", err)
+	}
+	defer tpm2.FlushContext(rw, handle)
+
+	secret, err := tpm2.Unseal(rw, handle, "")
+	if err != nil {
+		return nil, fmt.Errorf("tpm: failed to unseal: %w", err)
+	}
+	return secret, nil
+}
+
+// open connects to the TPM and creates the storage root key
+func (s TPMSealer) open() (io.ReadWriteCloser, tpmutil.Handle, error) {
+	rw, err := openTPM(s.Path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("tpm: failed to open device: %w", err)
+	}
+
+	srk, _, err := tpm2.CreatePrimary(rw, tpm2.HandleOwner, tpm2.PCRSelection{}, "", "", srkTemplate)
+	if err != nil {
+		rw.Close()
+		return nil, 0, fmt.Errorf("tpm: failed to create storage key: %w", err)
+	}
+	return rw, srk, nil
+}
+
+func splitU16(b []byte) ([]byte, []byte, error) {
+	if len(b) < 2 {
+		return nil, nil, errors.New("tpm: malformed sealed blob")
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return nil, nil, errors.New("tpm: malformed sealed blob")
+	}
+	return b[2 : 2+n], b[2+n:], nil
+}
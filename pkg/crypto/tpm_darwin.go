@@ -0,0 +1,19 @@
+package crypto
+
+import (
+	"io"
+
+	"github.com/google/go-tpm/legacy/tpm2"
+)
+
+// Macs have no TPM (the Secure Enclave does not seal arbitrary data), so
+// there is no default sealer
+func platformSealer() Sealer { return nil }
+
+// openTPM connects to a TPM simulator socket at path: there is no device
+func openTPM(path string) (io.ReadWriteCloser, error) {
+	if path == "" {
+		return nil, ErrHardwareUnsupported
+	}
+	return tpm2.OpenTPM(path)
+}
@@ -0,0 +1,20 @@
+//go:build !windows && !darwin
+
+package crypto
+
+import (
+	"io"
+
+	"github.com/google/go-tpm/legacy/tpm2"
+)
+
+func platformSealer() Sealer { return TPMSealer{} }
+
+// openTPM connects to the TPM device (or simulator socket) at path, or the
+// default device when path is empty
+func openTPM(path string) (io.ReadWriteCloser, error) {
+	if path == "" {
+		return tpm2.OpenTPM()
+	}
+	return tpm2.OpenTPM(path)
+}
@@ -0,0 +1,18 @@
+package crypto
+
+import (
+	"errors"
+	"io"
+
+	"github.com/google/go-tpm/legacy/tpm2"
+)
+
+func platformSealer() Sealer { return TPMSealer{} }
+
+// openTPM connects to the TPM through TPM Base Services
+func openTPM(path string) (io.ReadWriteCloser, error) {
+	if path != "" {
+		return nil, errors.New("TPM device paths are not supported on Windows")
+	}
+	return tpm2.OpenTPM()
+}
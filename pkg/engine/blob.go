@@ -1,6 +1,10 @@
 package engine
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
+
 	"github.com/amaydixit11/acorde/internal/blob"
 )
 
@@ -14,6 +18,10 @@ type BlobStore interface {
 	
 	// GetBlob retrieves a blob by its content ID
 	GetBlob(cid CID) ([]byte, error)
+
+	// OpenBlob opens a blob for reading parts of it, without verifying
+	// its content ID
+	OpenBlob(cid CID) (io.ReadSeekCloser, error)
 	
 	// HasBlob checks if a blob exists
 	HasBlob(cid CID) bool
@@ -44,6 +52,10 @@ func (b *blobWrapper) GetBlob(cid CID) ([]byte, error) {
 	return b.store.Get(cid)
 }
 
+func (b *blobWrapper) OpenBlob(cid CID) (io.ReadSeekCloser, error) {
+	return b.store.Open(cid)
+}
+
 func (b *blobWrapper) HasBlob(cid CID) bool {
 	return b.store.Has(cid)
 }
@@ -51,3 +63,27 @@ func (b *blobWrapper) HasBlob(cid CID) bool {
 func (b *blobWrapper) DeleteBlob(cid CID) error {
 	return b.store.Delete(cid)
 }
+
+// FileContent is the content of a File entry: a reference to a blob, with
+// metadata detected when it was stored
+type FileContent = blob.FileContent
+
+// ParseFileContent parses the content of a File entry
+func ParseFileContent(content []byte) (FileContent, error) {
+	var fc FileContent
+	if err := json.Unmarshal(content, &fc); err != nil {
+		return FileContent{}, fmt.Errorf("invalid file entry content: %w", err)
+	}
+	if fc.CID == "" {
+		return FileContent{}, fmt.Errorf("invalid file entry content: no blob CID")
+	}
+	return fc, nil
+}
+
+// StoreFile stores data in blobs, detecting its MIME type and, for images,
+// storing a thumbnail as a derived blob. Marshal the result as the content
+// of a File entry. A thumbnail that cannot be made is left out. Blobs are
+// stored in the clear: Engine.StoreFile seals them on encrypted vaults.
+func StoreFile(blobs BlobStore, name string, data []byte) (FileContent, error) {
+	return blob.StoreFile(blobs.StoreBlob, name, data)
+}
@@ -19,11 +19,14 @@
 package engine
 
 import (
+	"fmt"
+	"sync"
 	"time"
 
 	impl "github.com/amaydixit11/acorde/internal/engine"
 	"github.com/amaydixit11/acorde/pkg/crypto"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // EntryType represents the category of an entry
@@ -35,12 +38,27 @@ const (
 	Log        EntryType = "log"
 	File       EntryType = "file"
 	EventEntry EntryType = "event"
+
+	// ConfigEntry entries hold vault configuration that syncs, such as
+	// auto-tagging rules (see Engine.AddRule)
+	ConfigEntry EntryType = "config"
+
+	// Credential entries hold logins (see CredentialSchema and
+	// ImportPasswords); display their content with MaskCredential
+	Credential EntryType = "credential"
+
+	// Task, Contact and Bookmark entries are validated against
+	// TaskSchema, ContactSchema and BookmarkSchema with
+	// Config.BuiltinSchemas
+	Task     EntryType = "task"
+	Contact  EntryType = "contact"
+	Bookmark EntryType = "bookmark"
 )
 
 // IsValid checks if the entry type is valid
 func (t EntryType) IsValid() bool {
 	switch t {
-	case Note, Log, File, EventEntry:
+	case Note, Log, File, EventEntry, ConfigEntry, Credential, Task, Contact, Bookmark:
 		return true
 	default:
 		return false
@@ -55,10 +73,198 @@ type Entry struct {
 	Type      EntryType `json:"type"`
 	Content   []byte    `json:"content"` // Opaque to acorde
 	Tags      []string  `json:"tags"`    // Never nil, use []string{} for no tags
-	CreatedAt uint64    `json:"created_at"` // Logical time (Lamport)
-	UpdatedAt uint64    `json:"updated_at"` // Logical time (Lamport)
+	CreatedAt uint64    `json:"created_at"` // Logical time (Lamport or HLC, see Config.Clock)
+	UpdatedAt uint64    `json:"updated_at"` // Logical time (Lamport or HLC, see Config.Clock)
 	Deleted   bool      `json:"deleted"`    // Tombstone for CRDT
+	Archived  bool      `json:"archived"`   // Hidden from default lists and search
 	Owner     string    `json:"owner"`      // PeerID of creator/owner
+
+	// Human-readable wall-clock times from the device that made the
+	// change. Zero for entries written before they were recorded.
+	CreatedTime time.Time `json:"created_time,omitzero"`
+	UpdatedTime time.Time `json:"updated_time,omitzero"`
+
+	// SchemaVersion is the version of its type's schema the content
+	// matches (see RegisterSchemaVersion); 0 if unknown
+	SchemaVersion int `json:"schema_version,omitempty"`
+
+	// Author is the PeerID of the device that made the last change to
+	// the content, tags or deletion ("" if unknown). Once ACLs are
+	// enforced, merges only accept changes whose author may write.
+	Author string `json:"author,omitempty"`
+
+	// Collection is the ID of the collection the entry is filed in
+	// (uuid.Nil if none, see Engine.MoveEntry)
+	Collection uuid.UUID `json:"collection,omitzero"`
+
+	// Namespace is the tenant namespace the entry was created in ("" =
+	// the default one, see AddEntryInput.Namespace). It never changes.
+	Namespace string `json:"namespace,omitempty"`
+
+	// Title is the display title of the content: a JSON object's title,
+	// name or service property, else the first line of text without
+	// Markdown heading markers ("" if none). Lists without content take it
+	// from an in-memory index, so it is "" while the vault is locked.
+	Title string `json:"title,omitempty"`
+}
+
+// Ack records that a device received an entry through sync
+type Ack struct {
+	EntryID    uuid.UUID `json:"entry_id"`
+	Peer       string    `json:"peer"`        // PeerID of the receiving device
+	Version    uint64    `json:"version"`     // UpdatedAt of the version received
+	ReceivedAt time.Time `json:"received_at"` // When the device merged it
+}
+
+// CacheStats reports decrypted entry cache usage
+type CacheStats = impl.CacheStats
+
+// VaultStats summarizes a vault for dashboards (see Engine.Stats)
+type VaultStats = impl.VaultStats
+
+// EntryStats, StorageStats and VersionStats are the sections of VaultStats
+type (
+	EntryStats   = impl.EntryStats
+	StorageStats = impl.StorageStats
+	VersionStats = impl.VersionStats
+)
+
+// StatsActivityDays is how many days of creation activity Stats reports
+const StatsActivityDays = impl.StatsActivityDays
+
+// Editor is another device that changed an entry recently (see
+// Engine.RecentEditors)
+type Editor = impl.Editor
+
+// TimelineEvent is a create, update or deletion of an entry (see
+// Engine.Timeline)
+type TimelineEvent = impl.TimelineEvent
+
+// TimelineAction is what a TimelineEvent did to its entry
+type TimelineAction = impl.TimelineAction
+
+const (
+	TimelineCreate = impl.TimelineCreate
+	TimelineUpdate = impl.TimelineUpdate
+	TimelineDelete = impl.TimelineDelete
+)
+
+// TimelineFilter selects the events Engine.Timeline returns
+type TimelineFilter struct {
+	Since  time.Time  // At or after (zero = unbounded)
+	Until  time.Time  // Before (zero = unbounded)
+	Type   *EntryType // Only changes to entries of this type
+	Author string     // Only changes made by this peer ID
+}
+
+// QuarantinedEntry is an entry version a merge rejected because its
+// timestamp was implausibly far ahead of the local clock or its sender
+// may not write the entry, or an ACL change (EntryType "acl") from a
+// peer that doesn't own the entry
+type QuarantinedEntry = impl.QuarantinedEntry
+
+// EntryPatch is a partial update for Engine.PatchEntry: a JSON Patch or a
+// JSON Merge Patch of the content, and tags to add and remove
+type EntryPatch = impl.EntryPatch
+
+// PatchOperation is a JSON Patch (RFC 6902) operation
+type PatchOperation = impl.PatchOperation
+
+// LogRecord is a log entry to add with Engine.AppendLog
+type LogRecord = impl.LogRecord
+
+// Batch makes the changes of an Engine.Bulk call. Only changes made
+// through it are coalesced; changes made through the engine while the
+// bulk operation runs (by other goroutines, API requests or sync) are
+// delivered and saved as usual.
+type Batch interface {
+	AddEntry(input AddEntryInput) (Entry, error)
+	UpdateEntry(id uuid.UUID, input UpdateEntryInput) error
+	DeleteEntry(id uuid.UUID) error
+	ArchiveEntry(id uuid.UUID) error
+	UnarchiveEntry(id uuid.UUID) error
+	AppendLog(records []LogRecord) ([]uuid.UUID, error)
+}
+
+// AggregateBucket is one time bucket of an aggregation
+type AggregateBucket = impl.AggregateBucket
+
+// Aggregation is what Engine.Aggregate computes, and on which field
+type Aggregation = impl.Aggregation
+
+// Bucket is the width of aggregation time buckets
+type Bucket = impl.Bucket
+
+const (
+	BucketHour  = impl.BucketHour
+	BucketDay   = impl.BucketDay
+	BucketWeek  = impl.BucketWeek
+	BucketMonth = impl.BucketMonth
+)
+
+// AggregateFunc is the function Engine.Aggregate computes per bucket
+type AggregateFunc = impl.AggregateFunc
+
+const (
+	AggCount = impl.AggCount
+	AggSum   = impl.AggSum
+	AggAvg   = impl.AggAvg
+	AggMin   = impl.AggMin
+	AggMax   = impl.AggMax
+)
+
+// DefaultMaxClockSkew is the default of Config.MaxClockSkew
+const DefaultMaxClockSkew = impl.DefaultMaxClockSkew
+
+// ClockKind selects how changes are timestamped (see Config.Clock)
+type ClockKind = impl.ClockKind
+
+// Clock kinds
+const (
+	ClockLamport ClockKind = "lamport"
+	ClockHybrid  ClockKind = "hybrid"
+)
+
+// IDKind selects how the IDs of new entries are generated (see
+// Config.IDs)
+type IDKind = impl.IDKind
+
+// ID kinds
+const (
+	IDRandom IDKind = "uuid4"
+	IDTime   IDKind = "uuid7"
+	IDULID   IDKind = "ulid"
+)
+
+// Durability selects when committed writes reach the disk (see
+// Config.Durability)
+type Durability = impl.Durability
+
+// Durability modes
+const (
+	DurabilitySync    Durability = "sync"
+	DurabilityRelaxed Durability = "relaxed"
+)
+
+// MergeStats describes the merge of a sync payload (see
+// Engine.MergeRemotePayload)
+type MergeStats = impl.MergeStats
+
+// MinIDPrefix is the shortest ID prefix Engine.ResolveID accepts
+const MinIDPrefix = impl.MinIDPrefix
+
+// MaxNamespaceLength is the longest namespace name
+const MaxNamespaceLength = impl.MaxNamespaceLength
+
+// DeleteBatchSize is the most tombstones Engine.DeleteWhere and
+// DeleteQuery store in one transaction
+const DeleteBatchSize = impl.DeleteBatchSize
+
+// ValidateNamespace checks a namespace name: "" (the default namespace),
+// or up to MaxNamespaceLength lowercase letters, digits, '-', '_' and
+// '.', starting with a letter or digit. Errors wrap ErrInvalidNamespace.
+func ValidateNamespace(namespace string) error {
+	return impl.ValidateNamespace(namespace)
 }
 
 // AddEntryInput contains parameters for adding a new entry
@@ -68,6 +274,11 @@ type AddEntryInput struct {
 	Content []byte
 	Tags    []string
 	Public  bool
+
+	// Namespace partitions a vault shared by several tenants, such as the
+	// users of a hub: lists, API tokens and sync can be limited to one.
+	// "" is the default namespace.
+	Namespace string
 }
 
 // UpdateEntryInput contains parameters for updating an entry.
@@ -86,10 +297,89 @@ type ListFilter struct {
 	Deleted bool // Include deleted entries
 	Limit   int  // Max results (0 = no limit)
 	Offset  int  // Skip first N results
+
+	Archived     bool // Include archived entries
+	OnlyArchived bool // Only archived entries
+
+	// Collection lists only the entries filed in a collection (uuid.Nil =
+	// entries filed in none); with Subcollections, also those filed in
+	// the collections below it
+	Collection     *uuid.UUID
+	Subcollections bool
+
+	// Namespace lists only the entries of a namespace ("" = the default
+	// one; nil = every namespace)
+	Namespace *string
+
+	Sort      SortField // Order by this field ("" = SortUpdatedAt)
+	Ascending bool      // Oldest first instead of newest first
+
+	// WithoutContent lists metadata only, for list views of large
+	// encrypted vaults: content is neither read from the database nor
+	// decrypted, and Entry.Content is nil. Such a list works while the
+	// vault is locked and reports no corrupt entries.
+	WithoutContent bool
+}
+
+// ListResult is the result of Engine.ListEntriesChecked
+type ListResult struct {
+	Entries []Entry
+	Corrupt []CorruptEntry // Skipped: their content does not decrypt
+}
+
+// Changes is the result of Engine.ChangesSince
+type Changes struct {
+	Entries []Entry        // Added, updated, archived or moved entries
+	Deleted []Tombstone    // Deleted entries
+	Corrupt []CorruptEntry // Changed entries whose content does not decrypt
+	Cursor  uint64         // Replica clock time to pass to the next ChangesSince
+}
+
+// Tombstone records the deletion of an entry
+type Tombstone = impl.Tombstone
+
+// CorruptEntry is an entry, or a version in its history, whose content
+// does not decrypt with the vault's keys
+type CorruptEntry = impl.CorruptEntry
+
+// Collection is a named folder in the vault's collection tree that
+// entries are filed in (see Engine.CreateCollection and Engine.MoveEntry)
+type Collection = impl.Collection
+
+// IntegrityReport is the result of Engine.VerifyIntegrity
+type IntegrityReport = impl.IntegrityReport
+
+// EncryptionStatus is the result of Engine.EncryptionStatus
+type EncryptionStatus = impl.EncryptionStatus
+
+// SortField is a field entries are listed by: a logical clock time, or
+// the title
+type SortField = impl.SortField
+
+const (
+	SortUpdatedAt = impl.SortUpdatedAt
+	SortCreatedAt = impl.SortCreatedAt
+	SortTitle     = impl.SortTitle // Sorted in the database, or by the title index if encrypted
+)
+
+// AggregateFilter selects the entries Engine.Aggregate groups, by
+// wall-clock creation time. Entries without one are left out.
+type AggregateFilter struct {
+	Type  *EntryType
+	Tag   *string
+	Since time.Time // Created at or after (zero = unbounded)
+	Until time.Time // Created before (zero = unbounded)
+
+	// Location buckets start in (nil = time.Local)
+	Location *time.Location
 }
 
 // Engine is the main interface for acorde.
 // Products embed this interface to interact with acorde.
+//
+// An Engine is safe for concurrent use by multiple goroutines, such as API
+// handlers and the sync service sharing it. A sequence of calls (GetEntry,
+// then UpdateEntry) is not atomic: use PatchEntry for read-modify-writes.
 type Engine interface {
 	// Entry lifecycle
 	AddEntry(input AddEntryInput) (Entry, error)
@@ -97,24 +387,418 @@ type Engine interface {
 	UpdateEntry(id uuid.UUID, input UpdateEntryInput) error
 	DeleteEntry(id uuid.UUID) error
 
+	// DeleteEntries deletes entries by ID, in batches like DeleteWhere,
+	// and returns how many it deleted. An unknown ID deletes nothing;
+	// entries already deleted are skipped.
+	DeleteEntries(ids []uuid.UUID) (int, error)
+
+	// DeleteWhere deletes the live entries matching filter, ignoring its
+	// Limit, Offset and Sort, and returns how many it deleted. Tombstones
+	// are stored DeleteBatchSize at a time, each batch in one
+	// transaction; on error, the batches before it stay deleted.
+	DeleteWhere(filter ListFilter) (int, error)
+
+	// DeleteQuery deletes the live entries a query matches (see Query),
+	// in batches like DeleteWhere. Invalid queries return ErrInvalidQuery.
+	DeleteQuery(query string) (int, error)
+
+	// Query returns the entries matching a query string, such as
+	// type = "note" AND tag = "work" ORDER BY updated_at DESC LIMIT 20.
+	// Invalid queries return ErrInvalidQuery.
+	Query(query string) (QueryResult, error)
+
+	// ResolveID returns the ID of the live entry whose ID starts with
+	// prefix, at least MinIDPrefix hex digits such as "8f3a"
+	// (ErrUnknownID if none does, ErrAmbiguousID if several do). A full
+	// ID is returned as is.
+	ResolveID(prefix string) (uuid.UUID, error)
+
+	// Resolve returns the ID of the entry a reference names: a full ID,
+	// an ID prefix, title:<text> (exact title first, then a title
+	// containing text), tag:<tag>, or any non-hex text as a title. An
+	// ambiguous reference fails with ErrAmbiguousID, whose message lists
+	// the candidates.
+	Resolve(ref string) (uuid.UUID, error)
+
 	// Querying
 	ListEntries(filter ListFilter) ([]Entry, error)
 
+	// ListEntriesChecked is ListEntries that also reports the entries it
+	// skipped because their content does not decrypt (ListEntries skips
+	// them silently rather than failing the whole list)
+	ListEntriesChecked(filter ListFilter) (ListResult, error)
+
+	// Count returns how many entries ListEntries would return for the
+	// filter without its Limit and Offset, e.g. for a total in pagination.
+	// It is counted in the database without loading or decrypting
+	// entries, so entries that do not decrypt are included, and it works
+	// while the vault is locked.
+	Count(filter ListFilter) (int, error)
+
+	// Exists reports whether a live entry, archived or not, has the ID,
+	// without loading or decrypting it
+	Exists(id uuid.UUID) (bool, error)
+
+	// Namespaces counts live entries by namespace, without decrypting
+	// anything ("" = the default namespace)
+	Namespaces() (map[string]int, error)
+
+	// VerifyIntegrity reads every live entry and its version history from
+	// storage and reports those whose content does not decrypt
+	VerifyIntegrity() (IntegrityReport, error)
+
 	// Sync hooks (called by transport layer)
 	GetSyncPayload() ([]byte, error)
 	ApplyRemotePayload(payload []byte) error
 
-	// Events - Subscribe to change notifications
+	// MergeRemotePayload is ApplyRemotePayload returning what the merge
+	// did: how long it took, the entries compared and changed and the
+	// tombstones the payload held
+	MergeRemotePayload(payload []byte) (MergeStats, error)
+
+	// MergeRemotePayloadFrom is MergeRemotePayload for a payload sent by
+	// the authenticated peer from. Once ACLs are enforced, only versions
+	// from peers allowed to write an entry replace the local one; ACL
+	// changes are only taken from the entry's owner. MergeRemotePayload
+	// checks them as from an unknown peer.
+	MergeRemotePayloadFrom(from string, payload []byte) (MergeStats, error)
+
+	// GetSyncDelta is GetSyncPayload holding only the changes after since,
+	// a replica clock time (e.g. the clock_time of an earlier payload).
+	// Changes merged from other devices with older timestamps are left out.
+	GetSyncDelta(since uint64) ([]byte, error)
+
+	// ChangesSince returns the entries changed after since, a replica
+	// clock time (0 for all, or the Cursor of earlier Changes), and the
+	// entries deleted, oldest change first, for host applications to
+	// replicate or back up incrementally. Like GetSyncDelta, changes
+	// merged from other devices with older timestamps are left out.
+	ChangesSince(since uint64) (Changes, error)
+
+	// Events - Subscribe to change notifications. Subscribe buffers
+	// DefaultSubscriptionBuffer events and drops new ones while the
+	// buffer is full (OverflowDropNewest).
 	Subscribe() Subscription
 
+	// SubscribeWithOptions subscribes to the events opts selects, with
+	// its own buffer size and overflow policy: drop the newest or oldest
+	// events, block the writer for a while, or close the subscription
+	// with ErrSubscriptionOverflow so the subscriber can resynchronize
+	// (e.g. with ChangesSince). Events are never lost unawares: every
+	// event not delivered counts in Subscription.Dropped.
+	SubscribeWithOptions(opts SubscriptionOptions) (Subscription, error)
+
+	// DroppedEvents returns how many events subscriptions (including
+	// Watch, WatchQuery and SSE clients) did not deliver because their
+	// buffer was full, since the engine was opened
+	DroppedEvents() uint64
+
+	// Watch subscribes to the changes of one entry, including changes
+	// merged from peers
+	Watch(id uuid.UUID) Subscription
+
+	// WatchQuery subscribes to the changes of entries matching filter
+	// (Limit, Offset and sort order are ignored). An entry that stops
+	// matching, e.g. loses the tag or is deleted, gets one last event.
+	WatchQuery(filter ListFilter) Subscription
+
+	// PublishSyncEvent publishes a sync lifecycle event (EventPeerConnected
+	// to EventSyncFailed) to subscribers, SSE clients and hooks, for apps
+	// to show sync progress. The sync service running alongside the
+	// engine reports them; other events return ErrNotSyncEvent.
+	PublishSyncEvent(event Event) error
+
+	// Hooks returns the engine's webhooks and callbacks, fired for local
+	// and merged changes. Webhooks registered with Backfill are also sent
+	// the existing entries.
+	Hooks() *HookManager
+
+	// Bulk runs fn in bulk mode: the events and hooks of the changes fn
+	// makes through b are coalesced per entry and delivered, together
+	// with batched version writes and search indexing, when fn returns.
+	// Use it for imports and other large batches of changes.
+	Bulk(fn func(b Batch) error) error
+
+	// ArchiveEntry hides an entry from ListEntries, Search and QuickOpen
+	// unless they ask for archived entries. It is kept, synced and
+	// editable; the archive state merges independently of edits.
+	ArchiveEntry(id uuid.UUID) error
+
+	// UnarchiveEntry restores an archived entry
+	UnarchiveEntry(id uuid.UUID) error
+
+	// PatchEntry partially updates an entry with a JSON Patch or merge
+	// patch of its JSON content and tag additions and removals, validated
+	// and applied like UpdateEntry, and returns the updated entry
+	PatchEntry(id uuid.UUID, patch EntryPatch) (Entry, error)
+
+	// RegisterSchema registers a JSON schema (version 1) that AddEntry
+	// and UpdateEntry validate content of entryType against
+	RegisterSchema(entryType string, schemaJSON []byte) error
+
+	// RegisterSchemaVersion registers a newer version of entryType's
+	// schema. Entries record the version they were written against;
+	// migrator (nil = none) upgrades older content as it is read, when the
+	// entry is next updated, or for all entries with MigrateType.
+	RegisterSchemaVersion(entryType string, version int, schemaJSON []byte, migrator SchemaMigrator) error
+
+	// MigrateType upgrades the stored entries of entryType written against
+	// an older schema version, returning how many were migrated
+	MigrateType(entryType string) (int, error)
+
+	// StoreFile stores data in the vault's blob store, with its MIME type
+	// and, for images, a thumbnail. Add the result, marshaled, as the
+	// content of a File entry. On encrypted vaults the blobs are sealed
+	// with a key derived from the vault key for this file alone, held in
+	// the FileContent (and so encrypted with the entry), so equal files
+	// are not deduplicated; read them with FileContent.Open or
+	// NewReader. Fails with ErrLocked while the vault is locked.
+	StoreFile(name string, data []byte) (FileContent, error)
+
+	// CopyEntryTo copies an entry to another open vault under the same ID,
+	// with its version history, ACL and, for File entries, blobs, and
+	// returns the copy. Content and history are re-encrypted with the
+	// destination's vault key; per-entry sharing does not carry over.
+	// Fails with ErrEntryExists if the destination already has the entry.
+	CopyEntryTo(id uuid.UUID, dst Engine) (Entry, error)
+
+	// MoveEntryTo is CopyEntryTo that then deletes the entry and its
+	// history from this vault, removing the copy again if that fails
+	MoveEntryTo(id uuid.UUID, dst Engine) (Entry, error)
+
+	// AppendLog adds a batch of log entries in one transaction, for
+	// high-volume streams such as metrics. Extensions, rules, limits and
+	// schemas apply, and the batch is added whole or not at all; the
+	// entries get no version history or ACL row, and the batch produces
+	// one EventAppended event instead of an event and a webhook per entry.
+	AppendLog(records []LogRecord) ([]uuid.UUID, error)
+
+	// Aggregate counts entries, or sums, averages or bounds a numeric field
+	// of their JSON content, per hour, day, week or month of wall-clock
+	// creation time, including empty buckets in the range.
+	Aggregate(filter AggregateFilter, bucket Bucket, agg Aggregation) ([]AggregateBucket, error)
+
+	// Search performs full-text search, optionally with facet counts
+	Search(query string, opts SearchOptions) (SearchResult, error)
+
+	// QuickOpen fuzzy-matches entry titles and metadata
+	QuickOpen(query string, limit int) ([]QuickOpenResult, error)
+
+	// RotateKey switches to a new vault key, of the next epoch, and
+	// re-encrypts all entries and version history with it. The old key
+	// stays readable for content peers wrote before they received the new
+	// key.
+	RotateKey(newKey crypto.Key) error
+
+	// AdoptKey switches to a key rotated on another device, at the epoch
+	// it has there, re-encrypting only content still sealed with a retired
+	// key
+	AdoptKey(newKey crypto.EpochKey) error
+
+	// Lock wipes the vault key and decrypted content (cache, search
+	// indexes) from memory and publishes EventLocked. Until Unlock,
+	// reading or writing encrypted content fails with ErrLocked; sync
+	// keeps running. ErrNotEncrypted on unencrypted vaults.
+	Lock() error
+
+	// Unlock restores the vault key after Lock, rebuilds the search
+	// indexes and publishes EventUnlocked. ErrWrongKey for another key.
+	Unlock(key crypto.Key) error
+
+	// EncryptionStatus reports whether the vault is encrypted and locked,
+	// and the fingerprint of its key
+	EncryptionStatus() EncryptionStatus
+
+	// ShareEntry shares a single entry with peers without sharing the
+	// vault key: the entry is encrypted with its own key, wrapped for each
+	// peer's device key (see Config.PeerKeys) and delivered by sync.
+	// Recipients decrypt it transparently; only the owner may share.
+	ShareEntry(id uuid.UUID, peerIDs []string) error
+
+	// EntryAcks lists the devices that acknowledged receiving an entry,
+	// with the newest version each has seen (see Config.EnableAcks)
+	EntryAcks(id uuid.UUID) ([]Ack, error)
+
+	// History returns up to limit versions of an entry (0 = all), newest
+	// first, skipping the newest offset, and how many versions are
+	// stored. Content is decrypted; deleted entries keep their history.
+	History(id uuid.UUID, limit, offset int) ([]Version, int, error)
+
+	// GetVersion returns one version of an entry (ErrVersionNotFound if
+	// the entry has no such version)
+	GetVersion(id uuid.UUID, versionID int64) (Version, error)
+
+	// DiffVersions compares two versions of an entry: a line diff of the
+	// content and the tags added and removed
+	DiffVersions(id uuid.UUID, from, to int64) (VersionDiff, error)
+
+	// RestoreVersion updates an entry to the content and tags of one of
+	// its versions, as UpdateEntry does, and returns the entry
+	RestoreVersion(id uuid.UUID, versionID int64) (Entry, error)
+
+	// RecentEditors returns the other devices that changed an entry
+	// within window of now, most recent first, e.g. to warn "also edited
+	// on laptop 2 minutes ago". Changes merged through sync count at the
+	// time they were made on their device.
+	RecentEditors(id uuid.UUID, window time.Duration) ([]Editor, error)
+
+	// Timeline returns up to limit changes (0 = all) across the vault,
+	// most recent first, for activity feeds: creates and updates from
+	// version history and deletions, each with the entry's title and the
+	// device that made it. Merged changes count at the time they were
+	// made on their device.
+	Timeline(filter TimelineFilter, limit int) ([]TimelineEvent, error)
+
+	// Quarantined lists the entry versions merges rejected because their
+	// timestamps were too far ahead of the local clock (see
+	// Config.MaxClockSkew) or their senders may not write the entry, and
+	// the ACL changes rejected as not from the owner, most recently seen
+	// first
+	Quarantined() ([]QuarantinedEntry, error)
+
+	// ClearQuarantine forgets quarantined versions
+	ClearQuarantine() error
+
+	// Prefetch loads entries into the decrypted entry cache ahead of
+	// reads, skipping those cached, unknown, unreadable or corrupt, and
+	// returns the number loaded. GetEntry also prefetches the entries an
+	// entry links to and from (see Config.DisablePrefetch).
+	Prefetch(ids []uuid.UUID) int
+
+	// CacheStats reports hits and misses of the decrypted entry cache
+	CacheStats() CacheStats
+
+	// Stats summarizes the vault in one call: entry counts by type and
+	// tag, entries created per day over the last StatsActivityDays days,
+	// disk usage of the database, search index and blobs, and version
+	// history counts
+	Stats() (VaultStats, error)
+
+	// Ping checks that the vault database is reachable and answers
+	// queries, e.g. for readiness probes. It fails once the engine is
+	// closed.
+	Ping() error
+
+	// AddRule stores an auto-tagging rule as a config entry, so it syncs
+	// to every device of the vault. Rules apply to entries added or
+	// updated from then on.
+	AddRule(rule Rule) (Rule, error)
+
+	// ListRules returns the vault's rules in the order they apply
+	ListRules() ([]Rule, error)
+
+	// RemoveRule deletes a rule
+	RemoveRule(id uuid.UUID) error
+
+	// CreateGroup stores a named group of peer IDs as a config entry, so
+	// it syncs to every device of the vault (ErrGroupExists if the name
+	// is taken)
+	CreateGroup(name string, members []string) (Group, error)
+
+	// ListGroups returns the vault's groups by name
+	ListGroups() ([]Group, error)
+
+	// GetGroup returns a group (ErrGroupNotFound if there is none)
+	GetGroup(name string) (Group, error)
+
+	// UpdateGroup adds and removes members of a group
+	UpdateGroup(name string, add, remove []string) (Group, error)
+
+	// DeleteGroup deletes a group; ACLs referring to it no longer grant
+	// anyone access through it
+	DeleteGroup(name string) error
+
+	// GrantGroup lets a group's members read an entry, or read and write
+	// it. Membership is resolved when access is checked, so the grant
+	// follows changes to the group. Requires ownership of the entry.
+	GrantGroup(id uuid.UUID, name string, write bool) error
+
+	// RevokeGroup removes a group's access to an entry
+	RevokeGroup(id uuid.UUID, name string) error
+
+	// CreateCollection stores a named collection in parent (uuid.Nil =
+	// at the top level) as a config entry, so it syncs to every device
+	// of the vault (ErrCollectionExists if parent has one of that name)
+	CreateCollection(name string, parent uuid.UUID) (Collection, error)
+
+	// ListCollections returns the vault's collections ordered by path
+	ListCollections() ([]Collection, error)
+
+	// GetCollection returns a collection (ErrCollectionNotFound if there
+	// is none)
+	GetCollection(id uuid.UUID) (Collection, error)
+
+	// ResolveCollection returns the collection at a path such as
+	// "/work/projects"; "/" is the top level, with a nil ID
+	ResolveCollection(path string) (Collection, error)
+
+	// RenameCollection renames a collection
+	RenameCollection(id uuid.UUID, name string) (Collection, error)
+
+	// MoveCollection moves a collection, with everything below it, into
+	// parent (ErrCollectionCycle for a move below itself)
+	MoveCollection(id, parent uuid.UUID) (Collection, error)
+
+	// DeleteCollection deletes a collection holding no entries or
+	// collections (ErrCollectionNotEmpty otherwise)
+	DeleteCollection(id uuid.UUID) error
+
+	// MoveEntry files an entry in a collection (uuid.Nil = in none). An
+	// entry is in at most one collection, whatever its tags; moves merge
+	// independently of edits.
+	MoveEntry(id, collection uuid.UUID) error
+
+	// SaveTemplate stores a template as a config entry, so it syncs to
+	// every device of the vault, replacing any template of the same name
+	SaveTemplate(tmpl Template) (Template, error)
+
+	// ListTemplates returns the vault's templates by name
+	ListTemplates() ([]Template, error)
+
+	// GetTemplate returns a template (ErrTemplateNotFound if there is
+	// none)
+	GetTemplate(name string) (Template, error)
+
+	// DeleteTemplate deletes a template
+	DeleteTemplate(name string) error
+
+	// AddFromTemplate adds an entry from a template, filling in its
+	// variables from vars (date, time, datetime and weekday default to
+	// now; ErrMissingVariable for others without a value) and adding
+	// tags to the template's own
+	AddFromTemplate(name string, vars map[string]string, tags []string) (Entry, error)
+
+	// SaveSchema stores a JSON schema for an entry type as a config
+	// entry, so it persists and syncs to every device of the vault, and
+	// registers it. Config, file and credential entries cannot have one.
+	SaveSchema(entryType string, definition []byte) (StoredSchema, error)
+
+	// ListSchemas returns the schemas saved in the vault by entry type
+	ListSchemas() ([]StoredSchema, error)
+
+	// GetSchema returns the schema saved for an entry type
+	// (ErrSchemaNotFound if there is none)
+	GetSchema(entryType string) (StoredSchema, error)
+
+	// DeleteSchema deletes the schema saved for an entry type, restoring
+	// its built-in schema if it has one
+	DeleteSchema(entryType string) error
+
+	// ValidateContent checks content against the schema registered for an
+	// entry type without writing anything (ErrNoSchema if it has none)
+	ValidateContent(entryType string, content []byte) (ValidationResult, error)
+
 	// Lifecycle
+
+	// Close stops extensions and releases the vault, flushing every
+	// committed write to the database file
 	Close() error
 }
 
 // Config contains configuration options for the engine
 type Config struct {
 	// DataDir is the directory for storing vault data.
-	// If empty, defaults to ~/.acorde
+	// If empty, defaults to DefaultDataDir()
 	DataDir string
 
 	// InMemory creates a temporary in-memory database.
@@ -123,14 +807,186 @@ type Config struct {
 
 	// EncryptionKey is the key for encrypting entry content.
 	EncryptionKey *crypto.Key
+
+	// KeyEpoch is the epoch of EncryptionKey (see crypto.EpochKey).
+	// Entry content and version history name the epoch of the key they
+	// are sealed with, and are opened with that key, so it must be the
+	// keystore's (crypto.FileKeyStore.Epoch) once the key was rotated.
+	KeyEpoch uint32
+
+	// Cipher encrypts entry content when EncryptionKey is set.
+	// Defaults to crypto.DefaultCipher (XChaCha20-Poly1305); use
+	// crypto.AESGCM{} or a custom provider where specific algorithms
+	// are required. All peers sharing a vault must use the same cipher.
+	Cipher crypto.CipherProvider
+
+	// DisableSearch turns off the full-text search index.
+	// Search then falls back to a substring scan without facets.
+	DisableSearch bool
+
+	// SearchAnalyzer is the Bleve analyzer for entry content, e.g.
+	// "standard" (default), "simple", "web" or "en" (English stemming).
+	// Changing it rebuilds the search index on next open.
+	SearchAnalyzer string
+
+	// RetiredKeys are previous vault keys with their epochs, oldest
+	// first, kept to read content encrypted before a key rotation. Content
+	// still sealed with one of them is re-encrypted with EncryptionKey on
+	// open.
+	RetiredKeys []crypto.EpochKey
+
+	// PeerKeys resolves a peer ID to its X25519 device public key (the
+	// daemon uses the keys exchanged at pairing). Required for ShareEntry;
+	// when set, the owner's key on entries shared with us is checked too.
+	PeerKeys func(peerID string) ([]byte, error)
+
+	// EnableAcks makes this device acknowledge entries it receives through
+	// sync. Acks sync back so the author can see, via EntryAcks, which
+	// devices have received a change.
+	EnableAcks bool
+
+	// CacheSize is the number of decrypted entries kept in memory for
+	// GetEntry and ListEntries. 0 uses a default of 1024; negative
+	// disables the cache.
+	CacheSize int
+
+	// DisablePrefetch stops GetEntry from loading the entries an entry
+	// links to and from with [[wiki links]] into the cache in the
+	// background, for UIs that open an entry then its neighbours.
+	DisablePrefetch bool
+
+	// Clock timestamps changes. ClockLamport (default) is a pure logical
+	// counter; ClockHybrid is a hybrid logical clock whose timestamps
+	// follow wall time, so last-writer-wins picks the most recent change
+	// across devices. The two interoperate within a vault.
+	Clock ClockKind
+
+	// IDs generates the IDs of new entries. IDRandom (default) makes
+	// random UUIDv4s; IDTime (UUIDv7) and IDULID make IDs that start with
+	// their creation time, so they sort by age and new entries land
+	// together in storage indexes. All are UUIDs: vaults can mix them,
+	// and existing IDs never change.
+	IDs IDKind
+
+	// MaxClockSkew is how far ahead of local wall time a merged timestamp
+	// may be. A peer with a broken clock could otherwise push versions
+	// that win every last-writer-wins conflict; merges quarantine them
+	// instead (see Engine.Quarantined). 0 uses DefaultMaxClockSkew (24h);
+	// negative disables the check.
+	MaxClockSkew time.Duration
+
+	// MaxLogicalSkew also quarantines Lamport timestamps more than this
+	// many ticks ahead of the local clock. 0 (default) disables it, since
+	// a new device legitimately starts far behind.
+	MaxLogicalSkew uint64
+
+	// OnQuarantine is called for each entry version a merge quarantines,
+	// e.g. to log it
+	OnQuarantine func(QuarantinedEntry)
+
+	// MaxContentSize, MaxTagsPerEntry and MaxTagLength (in characters)
+	// limit entries; AddEntry and UpdateEntry return a *LimitError
+	// (errors.Is ErrLimitExceeded) beyond them. 0 uses the defaults (16
+	// MiB, 256 tags, 256 characters); negative removes the limit.
+	MaxContentSize  int
+	MaxTagsPerEntry int
+	MaxTagLength    int
+
+	// StrictSchemas makes AddEntry and AppendLog return ErrNoSchema for
+	// entry types without a registered schema, so every device writing to
+	// the vault keeps to the same data shapes. ConfigEntry and File
+	// entries, whose content the engine defines, are exempt; entries
+	// merged from peers are never refused.
+	StrictSchemas bool
+
+	// BuiltinSchemas registers TaskSchema, ContactSchema and
+	// BookmarkSchema for the Task, Contact and Bookmark entry types
+	// (CredentialSchema is always registered). RegisterSchema can
+	// replace them.
+	BuiltinSchemas bool
+
+	// DisableACL turns entry ACLs off for single-user vaults: new
+	// entries get no ACL and reads and writes are never checked against
+	// one. Without it a vault starts in single-user mode too, with no
+	// checks, until an entry is shared with a peer (ShareEntry here, or
+	// shared ACLs arriving through sync); from then on every read and
+	// write is checked. With it, ShareEntry returns ErrACLDisabled.
+	DisableACL bool
+
+	// DisableBlobRouting makes AddEntry and UpdateEntry reject content
+	// over MaxContentSize. By default, on vaults on disk, such content is
+	// stored in the blob store (see Engine.StoreFile) and added as, or
+	// updated into, a File entry referencing it (see ParseFileContent).
+	DisableBlobRouting bool
+
+	// Extensions customize the engine, called in order (see Extension)
+	Extensions []Extension
+
+	// LazyLoad opens the vault without loading every entry into memory:
+	// entries are loaded as they are read, written or merged, while
+	// ListEntries, Search and QuickOpen keep reading storage. Startup is
+	// faster and memory smaller for big vaults serving reads (e.g. acorde
+	// serve); the first sync payload or key rotation loads everything.
+	LazyLoad bool
+
+	// Durability selects when writes reach the disk. DurabilitySync
+	// (default) syncs every commit, so a write that returned survives a
+	// power loss. DurabilityRelaxed syncs only at checkpoints: writes are
+	// faster and the vault stays consistent, but a power loss can undo
+	// the last ones. Either way AddEntry and UpdateEntry store an entry
+	// with its version and ACL in one transaction, and Close flushes
+	// everything to the database file. In-memory vaults ignore it.
+	Durability Durability
+
+	// TracerProvider, when set, receives OpenTelemetry spans: one per
+	// entry operation (AddEntry, GetEntry, UpdateEntry, PatchEntry,
+	// DeleteEntry, ListEntries, AppendLog, Aggregate, Search) and merge,
+	// with the SQLite queries they run as child spans. nil disables
+	// tracing.
+	TracerProvider trace.TracerProvider
+}
+
+// DefaultDataDir returns the data directory used when Config.DataDir is
+// empty: ~/.acorde, or %APPDATA%\acorde on Windows (~/.acorde still wins
+// there if it already exists).
+func DefaultDataDir() (string, error) {
+	return impl.DefaultDataDir()
 }
 
 // New creates a new acorde Engine with the given configuration.
 func New(cfg Config) (Engine, error) {
 	internalEngine, err := impl.New(impl.Config{
-		DataDir:       cfg.DataDir,
-		InMemory:      cfg.InMemory,
-		EncryptionKey: cfg.EncryptionKey,
+		DataDir:        cfg.DataDir,
+		InMemory:       cfg.InMemory,
+		EncryptionKey:  cfg.EncryptionKey,
+		KeyEpoch:       cfg.KeyEpoch,
+		Cipher:         cfg.Cipher,
+		DisableSearch:  cfg.DisableSearch,
+		SearchAnalyzer: cfg.SearchAnalyzer,
+		RetiredKeys:    cfg.RetiredKeys,
+		PeerKeys:       cfg.PeerKeys,
+		EnableAcks:     cfg.EnableAcks,
+		CacheSize:      cfg.CacheSize,
+		Clock:          cfg.Clock,
+		IDs:            cfg.IDs,
+		MaxClockSkew:   cfg.MaxClockSkew,
+		MaxLogicalSkew: cfg.MaxLogicalSkew,
+		OnQuarantine:   cfg.OnQuarantine,
+		Extensions:     toInternalExtensions(cfg.Extensions),
+		LazyLoad:       cfg.LazyLoad,
+		Durability:     cfg.Durability,
+
+		MaxContentSize:     cfg.MaxContentSize,
+		MaxTagsPerEntry:    cfg.MaxTagsPerEntry,
+		MaxTagLength:       cfg.MaxTagLength,
+		DisableBlobRouting: cfg.DisableBlobRouting,
+		DisablePrefetch:    cfg.DisablePrefetch,
+
+		StrictSchemas:  cfg.StrictSchemas,
+		BuiltinSchemas: cfg.BuiltinSchemas,
+		DisableACL:     cfg.DisableACL,
+
+		TracerProvider: cfg.TracerProvider,
 	})
 	if err != nil {
 		return nil, err
@@ -144,18 +1000,78 @@ type engineWrapper struct {
 }
 
 func (w *engineWrapper) AddEntry(input AddEntryInput) (Entry, error) {
-	entry, err := w.impl.AddEntry(impl.AddEntryInput{
-		Type:    toInternalEntryType(input.Type),
-		Content: input.Content,
-		Tags:    input.Tags,
-		Public:  input.Public,
-	})
+	entry, err := w.impl.AddEntry(toInternalAddEntryInput(input))
 	if err != nil {
 		return Entry{}, err
 	}
 	return fromInternalEntry(entry), nil
 }
 
+func (w *engineWrapper) PatchEntry(id uuid.UUID, patch EntryPatch) (Entry, error) {
+	entry, err := w.impl.PatchEntry(id, patch)
+	if err != nil {
+		return Entry{}, convertError(err)
+	}
+	return fromInternalEntry(entry), nil
+}
+
+func (w *engineWrapper) RegisterSchema(entryType string, schemaJSON []byte) error {
+	return w.impl.RegisterSchema(entryType, schemaJSON)
+}
+
+func (w *engineWrapper) RegisterSchemaVersion(entryType string, version int, schemaJSON []byte, migrator SchemaMigrator) error {
+	return w.impl.RegisterSchemaVersion(entryType, version, schemaJSON, migrator)
+}
+
+func (w *engineWrapper) MigrateType(entryType string) (int, error) {
+	n, err := w.impl.MigrateType(entryType)
+	return n, convertError(err)
+}
+
+func (w *engineWrapper) StoreFile(name string, data []byte) (FileContent, error) {
+	return w.impl.StoreFile(name, data)
+}
+
+func (w *engineWrapper) CopyEntryTo(id uuid.UUID, dst Engine) (Entry, error) {
+	return w.transfer(id, dst, w.impl.CopyEntryTo)
+}
+
+func (w *engineWrapper) MoveEntryTo(id uuid.UUID, dst Engine) (Entry, error) {
+	return w.transfer(id, dst, w.impl.MoveEntryTo)
+}
+
+func (w *engineWrapper) transfer(id uuid.UUID, dst Engine, fn func(uuid.UUID, impl.Engine) (impl.Entry, error)) (Entry, error) {
+	to, ok := dst.(*engineWrapper)
+	if !ok {
+		return Entry{}, fmt.Errorf("unsupported destination engine %T", dst)
+	}
+	entry, err := fn(id, to.impl)
+	if err != nil {
+		return Entry{}, convertError(err)
+	}
+	return fromInternalEntry(entry), nil
+}
+
+func (w *engineWrapper) AppendLog(records []LogRecord) ([]uuid.UUID, error) {
+	return w.impl.AppendLog(records)
+}
+
+func (w *engineWrapper) Aggregate(filter AggregateFilter, bucket Bucket, agg Aggregation) ([]AggregateBucket, error) {
+	var internalType *impl.EntryType
+	if filter.Type != nil {
+		t := toInternalEntryType(*filter.Type)
+		internalType = &t
+	}
+
+	return w.impl.Aggregate(impl.AggregateFilter{
+		Type:     internalType,
+		Tag:      filter.Tag,
+		Since:    filter.Since,
+		Until:    filter.Until,
+		Location: filter.Location,
+	}, bucket, agg)
+}
+
 func (w *engineWrapper) GetEntry(id uuid.UUID) (Entry, error) {
 	entry, err := w.impl.GetEntry(id)
 	if err != nil {
@@ -164,25 +1080,96 @@ func (w *engineWrapper) GetEntry(id uuid.UUID) (Entry, error) {
 	return fromInternalEntry(entry), nil
 }
 
+func (w *engineWrapper) ResolveID(prefix string) (uuid.UUID, error) {
+	return w.impl.ResolveID(prefix)
+}
+
+func (w *engineWrapper) Resolve(ref string) (uuid.UUID, error) {
+	return w.impl.Resolve(ref)
+}
+
 func (w *engineWrapper) UpdateEntry(id uuid.UUID, input UpdateEntryInput) error {
-	return convertError(w.impl.UpdateEntry(id, impl.UpdateEntryInput{
-		Content: input.Content,
-		Tags:    input.Tags,
-	}))
+	return convertError(w.impl.UpdateEntry(id, toInternalUpdateEntryInput(input)))
 }
 
 func (w *engineWrapper) DeleteEntry(id uuid.UUID) error {
 	return convertError(w.impl.DeleteEntry(id))
 }
 
+func (w *engineWrapper) DeleteEntries(ids []uuid.UUID) (int, error) {
+	n, err := w.impl.DeleteEntries(ids)
+	return n, convertError(err)
+}
+
+func (w *engineWrapper) DeleteWhere(filter ListFilter) (int, error) {
+	n, err := w.impl.DeleteWhere(toInternalFilter(filter))
+	return n, convertError(err)
+}
+
+func (w *engineWrapper) ArchiveEntry(id uuid.UUID) error {
+	return convertError(w.impl.ArchiveEntry(id))
+}
+
+func (w *engineWrapper) UnarchiveEntry(id uuid.UUID) error {
+	return convertError(w.impl.UnarchiveEntry(id))
+}
+
 func (w *engineWrapper) ListEntries(filter ListFilter) ([]Entry, error) {
+	result, err := w.ListEntriesChecked(filter)
+	return result.Entries, err
+}
+
+func (w *engineWrapper) ListEntriesChecked(filter ListFilter) (ListResult, error) {
+	listed, err := w.impl.ListEntriesChecked(toInternalFilter(filter))
+	if err != nil {
+		return ListResult{}, err
+	}
+
+	result := ListResult{Entries: make([]Entry, len(listed.Entries)), Corrupt: listed.Corrupt}
+	for i, e := range listed.Entries {
+		result.Entries[i] = fromInternalEntry(e)
+	}
+	return result, nil
+}
+
+func (w *engineWrapper) Count(filter ListFilter) (int, error) {
+	return w.impl.Count(toInternalFilter(filter))
+}
+
+func (w *engineWrapper) Namespaces() (map[string]int, error) {
+	return w.impl.Namespaces()
+}
+
+func (w *engineWrapper) Exists(id uuid.UUID) (bool, error) {
+	return w.impl.Exists(id)
+}
+
+func (w *engineWrapper) ChangesSince(since uint64) (Changes, error) {
+	changes, err := w.impl.ChangesSince(since)
+	if err != nil {
+		return Changes{}, err
+	}
+
+	result := Changes{
+		Entries: make([]Entry, len(changes.Entries)),
+		Deleted: changes.Deleted,
+		Corrupt: changes.Corrupt,
+		Cursor:  changes.Cursor,
+	}
+	for i, e := range changes.Entries {
+		result.Entries[i] = fromInternalEntry(e)
+	}
+	return result, nil
+}
+
+func toInternalFilter(filter ListFilter) impl.ListFilter {
 	var internalType *impl.EntryType
 	if filter.Type != nil {
 		t := toInternalEntryType(*filter.Type)
 		internalType = &t
 	}
 
-	entries, err := w.impl.ListEntries(impl.ListFilter{
+	return impl.ListFilter{
 		Type:    internalType,
 		Tag:     filter.Tag,
 		Since:   filter.Since,
@@ -190,26 +1177,310 @@ func (w *engineWrapper) ListEntries(filter ListFilter) ([]Entry, error) {
 		Deleted: filter.Deleted,
 		Limit:   filter.Limit,
 		Offset:  filter.Offset,
-	})
-	if err != nil {
-		return nil, err
-	}
 
-	result := make([]Entry, len(entries))
-	for i, e := range entries {
-		result[i] = fromInternalEntry(e)
+		Archived:     filter.Archived,
+		OnlyArchived: filter.OnlyArchived,
+
+		Collection:     filter.Collection,
+		Subcollections: filter.Subcollections,
+
+		Namespace: filter.Namespace,
+
+		Sort:      filter.Sort,
+		Ascending: filter.Ascending,
+
+		WithoutContent: filter.WithoutContent,
 	}
-	return result, nil
+}
+
+func (w *engineWrapper) VerifyIntegrity() (IntegrityReport, error) {
+	return w.impl.VerifyIntegrity()
 }
 
 func (w *engineWrapper) GetSyncPayload() ([]byte, error) {
 	return w.impl.GetSyncPayload()
 	}
 
+func (w *engineWrapper) GetSyncDelta(since uint64) ([]byte, error) {
+	return w.impl.GetSyncDelta(since)
+}
+
 func (w *engineWrapper) ApplyRemotePayload(payload []byte) error {
 	return w.impl.ApplyRemotePayload(payload)
 }
 
+func (w *engineWrapper) MergeRemotePayload(payload []byte) (MergeStats, error) {
+	return w.impl.MergeRemotePayload(payload)
+}
+
+func (w *engineWrapper) MergeRemotePayloadFrom(from string, payload []byte) (MergeStats, error) {
+	return w.impl.MergeRemotePayloadFrom(from, payload)
+}
+
+func (w *engineWrapper) Bulk(fn func(b Batch) error) error {
+	return w.impl.Bulk(func(b impl.Batch) error {
+		return fn(batchWrapper{impl: b})
+	})
+}
+
+// batchWrapper wraps an internal Batch and converts types
+type batchWrapper struct {
+	impl impl.Batch
+}
+
+func (b batchWrapper) AddEntry(input AddEntryInput) (Entry, error) {
+	entry, err := b.impl.AddEntry(toInternalAddEntryInput(input))
+	if err != nil {
+		return Entry{}, err
+	}
+	return fromInternalEntry(entry), nil
+}
+
+func (b batchWrapper) UpdateEntry(id uuid.UUID, input UpdateEntryInput) error {
+	return convertError(b.impl.UpdateEntry(id, toInternalUpdateEntryInput(input)))
+}
+
+func (b batchWrapper) DeleteEntry(id uuid.UUID) error {
+	return convertError(b.impl.DeleteEntry(id))
+}
+
+func (b batchWrapper) ArchiveEntry(id uuid.UUID) error {
+	return convertError(b.impl.ArchiveEntry(id))
+}
+
+func (b batchWrapper) UnarchiveEntry(id uuid.UUID) error {
+	return convertError(b.impl.UnarchiveEntry(id))
+}
+
+func (b batchWrapper) AppendLog(records []LogRecord) ([]uuid.UUID, error) {
+	return b.impl.AppendLog(records)
+}
+
+func (w *engineWrapper) RotateKey(newKey crypto.Key) error {
+	return w.impl.RotateKey(newKey)
+}
+
+func (w *engineWrapper) AdoptKey(newKey crypto.EpochKey) error {
+	return w.impl.AdoptKey(newKey)
+}
+
+func (w *engineWrapper) Lock() error {
+	return w.impl.Lock()
+}
+
+func (w *engineWrapper) Unlock(key crypto.Key) error {
+	return w.impl.Unlock(key)
+}
+
+func (w *engineWrapper) EncryptionStatus() EncryptionStatus {
+	return w.impl.EncryptionStatus()
+}
+
+func (w *engineWrapper) ShareEntry(id uuid.UUID, peerIDs []string) error {
+	return convertError(w.impl.ShareEntry(id, peerIDs))
+}
+
+func (w *engineWrapper) EntryAcks(id uuid.UUID) ([]Ack, error) {
+	acks, err := w.impl.EntryAcks(id)
+	if err != nil {
+		return nil, convertError(err)
+	}
+	result := make([]Ack, len(acks))
+	for i, a := range acks {
+		result[i] = Ack{
+			EntryID:    a.EntryID,
+			Peer:       a.Peer,
+			Version:    a.Version,
+			ReceivedAt: time.Unix(a.ReceivedAt, 0),
+		}
+	}
+	return result, nil
+}
+
+func (w *engineWrapper) History(id uuid.UUID, limit, offset int) ([]Version, int, error) {
+	versions, total, err := w.impl.History(id, limit, offset)
+	return versions, total, convertError(err)
+}
+
+func (w *engineWrapper) GetVersion(id uuid.UUID, versionID int64) (Version, error) {
+	v, err := w.impl.GetVersion(id, versionID)
+	return v, convertError(err)
+}
+
+func (w *engineWrapper) DiffVersions(id uuid.UUID, from, to int64) (VersionDiff, error) {
+	diff, err := w.impl.DiffVersions(id, from, to)
+	return diff, convertError(err)
+}
+
+func (w *engineWrapper) RestoreVersion(id uuid.UUID, versionID int64) (Entry, error) {
+	entry, err := w.impl.RestoreVersion(id, versionID)
+	if err != nil {
+		return Entry{}, convertError(err)
+	}
+	return fromInternalEntry(entry), nil
+}
+
+func (w *engineWrapper) RecentEditors(id uuid.UUID, window time.Duration) ([]Editor, error) {
+	editors, err := w.impl.RecentEditors(id, window)
+	return editors, convertError(err)
+}
+
+func (w *engineWrapper) Timeline(filter TimelineFilter, limit int) ([]TimelineEvent, error) {
+	var internalType *impl.EntryType
+	if filter.Type != nil {
+		t := toInternalEntryType(*filter.Type)
+		internalType = &t
+	}
+
+	events, err := w.impl.Timeline(impl.TimelineFilter{
+		Since:  filter.Since,
+		Until:  filter.Until,
+		Type:   internalType,
+		Author: filter.Author,
+	}, limit)
+	return events, convertError(err)
+}
+
+func (w *engineWrapper) AddRule(rule Rule) (Rule, error) {
+	return w.impl.AddRule(rule)
+}
+
+func (w *engineWrapper) ListRules() ([]Rule, error) {
+	return w.impl.ListRules()
+}
+
+func (w *engineWrapper) RemoveRule(id uuid.UUID) error {
+	return convertError(w.impl.RemoveRule(id))
+}
+
+func (w *engineWrapper) CreateGroup(name string, members []string) (Group, error) {
+	return w.impl.CreateGroup(name, members)
+}
+
+func (w *engineWrapper) ListGroups() ([]Group, error) {
+	return w.impl.ListGroups()
+}
+
+func (w *engineWrapper) GetGroup(name string) (Group, error) {
+	return w.impl.GetGroup(name)
+}
+
+func (w *engineWrapper) UpdateGroup(name string, add, remove []string) (Group, error) {
+	return w.impl.UpdateGroup(name, add, remove)
+}
+
+func (w *engineWrapper) DeleteGroup(name string) error {
+	return convertError(w.impl.DeleteGroup(name))
+}
+
+func (w *engineWrapper) GrantGroup(id uuid.UUID, name string, write bool) error {
+	return convertError(w.impl.GrantGroup(id, name, write))
+}
+
+func (w *engineWrapper) RevokeGroup(id uuid.UUID, name string) error {
+	return convertError(w.impl.RevokeGroup(id, name))
+}
+
+func (w *engineWrapper) CreateCollection(name string, parent uuid.UUID) (Collection, error) {
+	return w.impl.CreateCollection(name, parent)
+}
+
+func (w *engineWrapper) ListCollections() ([]Collection, error) {
+	return w.impl.ListCollections()
+}
+
+func (w *engineWrapper) GetCollection(id uuid.UUID) (Collection, error) {
+	return w.impl.GetCollection(id)
+}
+
+func (w *engineWrapper) ResolveCollection(path string) (Collection, error) {
+	return w.impl.ResolveCollection(path)
+}
+
+func (w *engineWrapper) RenameCollection(id uuid.UUID, name string) (Collection, error) {
+	return w.impl.RenameCollection(id, name)
+}
+
+func (w *engineWrapper) MoveCollection(id, parent uuid.UUID) (Collection, error) {
+	return w.impl.MoveCollection(id, parent)
+}
+
+func (w *engineWrapper) DeleteCollection(id uuid.UUID) error {
+	return convertError(w.impl.DeleteCollection(id))
+}
+
+func (w *engineWrapper) MoveEntry(id, collection uuid.UUID) error {
+	return convertError(w.impl.MoveEntry(id, collection))
+}
+
+func (w *engineWrapper) SaveTemplate(tmpl Template) (Template, error) {
+	return w.impl.SaveTemplate(tmpl)
+}
+
+func (w *engineWrapper) ListTemplates() ([]Template, error) {
+	return w.impl.ListTemplates()
+}
+
+func (w *engineWrapper) GetTemplate(name string) (Template, error) {
+	return w.impl.GetTemplate(name)
+}
+
+func (w *engineWrapper) DeleteTemplate(name string) error {
+	return convertError(w.impl.DeleteTemplate(name))
+}
+
+func (w *engineWrapper) AddFromTemplate(name string, vars map[string]string, tags []string) (Entry, error) {
+	entry, err := w.impl.AddFromTemplate(name, vars, tags)
+	if err != nil {
+		return Entry{}, err
+	}
+	return fromInternalEntry(entry), nil
+}
+
+func (w *engineWrapper) SaveSchema(entryType string, definition []byte) (StoredSchema, error) {
+	return w.impl.SaveSchema(entryType, definition)
+}
+
+func (w *engineWrapper) ListSchemas() ([]StoredSchema, error) {
+	return w.impl.ListSchemas()
+}
+
+func (w *engineWrapper) GetSchema(entryType string) (StoredSchema, error) {
+	return w.impl.GetSchema(entryType)
+}
+
+func (w *engineWrapper) DeleteSchema(entryType string) error {
+	return convertError(w.impl.DeleteSchema(entryType))
+}
+
+func (w *engineWrapper) ValidateContent(entryType string, content []byte) (ValidationResult, error) {
+	return w.impl.ValidateContent(entryType, content)
+}
+
+func (w *engineWrapper) Quarantined() ([]QuarantinedEntry, error) {
+	return w.impl.Quarantined()
+}
+
+func (w *engineWrapper) ClearQuarantine() error {
+	return w.impl.ClearQuarantine()
+}
+
+func (w *engineWrapper) Prefetch(ids []uuid.UUID) int {
+	return w.impl.Prefetch(ids)
+}
+
+func (w *engineWrapper) CacheStats() CacheStats {
+	return w.impl.CacheStats()
+}
+
+func (w *engineWrapper) Stats() (VaultStats, error) {
+	return w.impl.Stats()
+}
+
+func (w *engineWrapper) Ping() error {
+	return w.impl.Ping()
+}
+
 func (w *engineWrapper) Close() error {
 	return w.impl.Close()
 }
@@ -217,40 +1488,162 @@ func (w *engineWrapper) Close() error {
 // Subscribe returns a subscription for change events
 func (w *engineWrapper) Subscribe() Subscription {
 	internalSub := w.impl.Subscribe()
-	return &subscriptionWrapper{impl: internalSub}
+	return newSubscriptionWrapper(internalSub)
+}
+
+// SubscribeWithOptions returns a subscription to the events opts selects
+func (w *engineWrapper) SubscribeWithOptions(opts SubscriptionOptions) (Subscription, error) {
+	var events []impl.EventType
+	for _, t := range opts.Events {
+		events = append(events, impl.EventType(t))
+	}
+	internalSub, err := w.impl.SubscribeWithOptions(impl.SubscriptionOptions{
+		Events:       events,
+		EntryType:    opts.EntryType,
+		EntryID:      opts.EntryID,
+		BufferSize:   opts.BufferSize,
+		Overflow:     opts.Overflow,
+		BlockTimeout: opts.BlockTimeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newSubscriptionWrapper(internalSub), nil
+}
+
+func (w *engineWrapper) DroppedEvents() uint64 {
+	return w.impl.DroppedEvents()
+}
+
+func (w *engineWrapper) Hooks() *HookManager {
+	return w.impl.Hooks()
+}
+
+func (w *engineWrapper) Watch(id uuid.UUID) Subscription {
+	return newSubscriptionWrapper(w.impl.Watch(id))
+}
+
+func (w *engineWrapper) WatchQuery(filter ListFilter) Subscription {
+	return newSubscriptionWrapper(w.impl.WatchQuery(toInternalFilter(filter)))
+}
+
+func (w *engineWrapper) PublishSyncEvent(event Event) error {
+	return w.impl.PublishSyncEvent(impl.Event{
+		Type:      impl.EventType(event.Type),
+		Timestamp: event.Timestamp,
+		Count:     event.Count,
+		PeerID:    event.PeerID,
+		Error:     event.Error,
+	})
 }
 
 // Subscription wraps internal subscription
 type Subscription interface {
 	Events() <-chan Event
 	Close()
+
+	// Dropped returns how many matching events were not delivered because
+	// the subscription's buffer was full (see OverflowPolicy)
+	Dropped() uint64
+
+	// Err returns ErrSubscriptionOverflow once OverflowClose closed the
+	// subscription, and nil otherwise
+	Err() error
 }
 
+// SubscriptionOptions selects the events of Engine.SubscribeWithOptions
+// and says what happens when the subscriber falls behind
+type SubscriptionOptions struct {
+	Events    []EventType // Only these event types (nil = all)
+	EntryType string      // Only events of entries of this type ("" = all)
+	EntryID   uuid.UUID   // Only events of this entry (uuid.Nil = all)
+
+	BufferSize   int            // Events buffered (0 = DefaultSubscriptionBuffer)
+	Overflow     OverflowPolicy // When the buffer is full ("" = OverflowDropNewest)
+	BlockTimeout time.Duration  // Longest wait of OverflowBlock (0 = DefaultBlockTimeout)
+}
+
+// OverflowPolicy is what a subscription does with an event when its
+// buffer is full: OverflowDropNewest drops it (the default),
+// OverflowDropOldest drops the oldest buffered event instead,
+// OverflowBlock makes the change that published it wait up to
+// BlockTimeout for room, and OverflowClose closes the subscription with
+// ErrSubscriptionOverflow
+type OverflowPolicy = impl.OverflowPolicy
+
+const (
+	OverflowDropNewest = impl.OverflowDropNewest
+	OverflowDropOldest = impl.OverflowDropOldest
+	OverflowBlock      = impl.OverflowBlock
+	OverflowClose      = impl.OverflowClose
+)
+
+// DefaultSubscriptionBuffer and DefaultBlockTimeout are the defaults of
+// SubscriptionOptions.BufferSize and BlockTimeout
+const (
+	DefaultSubscriptionBuffer = impl.DefaultSubscriptionBuffer
+	DefaultBlockTimeout       = impl.DefaultBlockTimeout
+)
+
 type subscriptionWrapper struct {
 	impl impl.Subscription
+	once sync.Once
+	ch   chan Event
+	done chan struct{} // Closed by Close, so convert stops forwarding
+	stop sync.Once
+}
+
+func newSubscriptionWrapper(sub impl.Subscription) *subscriptionWrapper {
+	return &subscriptionWrapper{impl: sub, done: make(chan struct{})}
 }
 
 func (s *subscriptionWrapper) Events() <-chan Event {
-	// We need to convert internal events to public events
-	ch := make(chan Event, 100)
+	// Converted once, so repeated calls share the channel
+	s.once.Do(s.convert)
+	return s.ch
+}
+
+// convert forwards internal events to public events
+func (s *subscriptionWrapper) convert() {
+	// Unbuffered: events wait in the internal buffer, where the overflow
+	// policy applies
+	ch := make(chan Event)
+	s.ch = ch
 	go func() {
+		defer close(ch)
 		for e := range s.impl.Events() {
-			ch <- Event{
+			event := Event{
 				Type:      EventType(e.Type),
 				EntryID:   e.EntryID,
 				EntryType: e.EntryType,
 				Timestamp: e.Timestamp,
+				Origin:    e.Origin,
+				Count:     e.Count,
+				PeerID:    e.PeerID,
+				Error:     e.Error,
+			}
+			select {
+			case ch <- event:
+			case <-s.done:
+				return
 			}
 		}
-		close(ch)
 	}()
-	return ch
 }
 
 func (s *subscriptionWrapper) Close() {
+	s.stop.Do(func() { close(s.done) })
 	s.impl.Close()
 }
 
+func (s *subscriptionWrapper) Dropped() uint64 {
+	return s.impl.Dropped()
+}
+
+func (s *subscriptionWrapper) Err() error {
+	return s.impl.Err()
+}
+
 // Event types
 type EventType string
 
@@ -259,17 +1652,67 @@ const (
 	EventUpdated EventType = "updated"
 	EventDeleted EventType = "deleted"
 	EventSynced  EventType = "synced"
+
+	// EventArchived and EventUnarchived report Engine.ArchiveEntry and
+	// Engine.UnarchiveEntry (or the same changes merged from a peer)
+	EventArchived   EventType = "archived"
+	EventUnarchived EventType = "unarchived"
+
+	// EventAppended reports a batch of log entries added by
+	// Engine.AppendLog, with their count (EntryID is nil)
+	EventAppended EventType = "appended"
+
+	// EventLocked and EventUnlocked report Engine.Lock and Engine.Unlock
+	// (EntryID is nil)
+	EventLocked   EventType = "locked"
+	EventUnlocked EventType = "unlocked"
+
+	// Sync lifecycle events (see Engine.PublishSyncEvent): a peer
+	// connecting or disconnecting, and a sync session with it starting
+	// and finishing, with the entries it changed as Count, or failing
+	// (EntryID is nil)
+	EventPeerConnected    EventType = "peer_connected"
+	EventPeerDisconnected EventType = "peer_disconnected"
+	EventSyncStarted      EventType = "sync_started"
+	EventSyncFinished     EventType = "sync_finished"
+	EventSyncFailed       EventType = "sync_failed"
 )
 
+// OriginRemote is the Event.Origin of changes that arrived through sync
+const OriginRemote = "remote"
+
 // Event represents a change notification
 type Event struct {
 	Type      EventType `json:"type"`
 	EntryID   uuid.UUID `json:"entry_id"`
 	EntryType string    `json:"entry_type,omitempty"`
 	Timestamp time.Time `json:"timestamp"`
+	Origin    string    `json:"origin,omitempty"` // "remote" for merged changes, empty for local
+
+	Count int `json:"count,omitempty"` // Entries appended (EventAppended) or changed by a sync session (EventSyncFinished)
+
+	PeerID string `json:"peer_id,omitempty"` // For sync lifecycle events
+	Error  string `json:"error,omitempty"`   // For EventSyncFailed
 }
 
 // Type conversion helpers
+func toInternalAddEntryInput(input AddEntryInput) impl.AddEntryInput {
+	return impl.AddEntryInput{
+		Type:      toInternalEntryType(input.Type),
+		Content:   input.Content,
+		Tags:      input.Tags,
+		Public:    input.Public,
+		Namespace: input.Namespace,
+	}
+}
+
+func toInternalUpdateEntryInput(input UpdateEntryInput) impl.UpdateEntryInput {
+	return impl.UpdateEntryInput{
+		Content: input.Content,
+		Tags:    input.Tags,
+	}
+}
+
 func toInternalEntryType(t EntryType) impl.EntryType {
 	return impl.EntryType(t)
 }
@@ -287,6 +1730,16 @@ func fromInternalEntry(e impl.Entry) Entry {
 		CreatedAt: e.CreatedAt,
 		UpdatedAt: e.UpdatedAt,
 		Deleted:   e.Deleted,
+		Archived:  e.Archived,
 		Owner:     e.Owner,
+
+		CreatedTime: e.CreatedTime,
+		UpdatedTime: e.UpdatedTime,
+
+		SchemaVersion: e.SchemaVersion,
+		Author:        e.Author,
+		Collection:    e.Collection,
+		Namespace:     e.Namespace,
+		Title:         e.Title,
 	}
 }
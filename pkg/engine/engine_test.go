@@ -1,8 +1,24 @@
 package engine_test
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/amaydixit11/acorde/internal/sharing"
+	"github.com/amaydixit11/acorde/pkg/api"
+	"github.com/amaydixit11/acorde/pkg/crypto"
 	"github.com/amaydixit11/acorde/pkg/engine"
 	"github.com/google/uuid"
 )
@@ -131,17 +147,1186 @@ func TestErrorTypes(t *testing.T) {
 }
 
 func TestEntryTypeValidation(t *testing.T) {
-	validTypes := []engine.EntryType{engine.Note, engine.Log, engine.File, engine.EventEntry}
+	validTypes := []engine.EntryType{engine.Note, engine.Log, engine.File, engine.EventEntry,
+		engine.Task, engine.Contact, engine.Bookmark}
 	for _, t := range validTypes {
 		if !t.IsValid() {
 			panic("expected valid type: " + string(t))
 		}
 	}
 
-	invalidTypes := []engine.EntryType{"invalid", "", "task"}
+	invalidTypes := []engine.EntryType{"invalid", "", "todo"}
 	for _, t := range invalidTypes {
 		if t.IsValid() {
 			panic("expected invalid type: " + string(t))
 		}
 	}
 }
+
+func TestQuery(t *testing.T) {
+	e, err := engine.New(engine.Config{InMemory: true})
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+	defer e.Close()
+
+	q, ok := e.(interface {
+		Query(string) (engine.QueryResult, error)
+	})
+	if !ok {
+		t.Fatal("engine does not support Query")
+	}
+
+	e.AddEntry(engine.AddEntryInput{Type: engine.Note, Content: []byte("a"), Tags: []string{"work"}})
+	e.AddEntry(engine.AddEntryInput{Type: engine.Note, Content: []byte("b"), Tags: []string{"archived"}})
+	e.AddEntry(engine.AddEntryInput{Type: engine.Log, Content: []byte("c"), Tags: []string{"work"}})
+	e.AddEntry(engine.AddEntryInput{Type: engine.File, Content: []byte("d")})
+
+	result, err := q.Query(`type IN ("note", "log") AND NOT tag = "archived" ORDER BY created_at`)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if result.Count != 2 || string(result.Entries[0].Content) != "a" || string(result.Entries[1].Content) != "c" {
+		t.Errorf("unexpected result: %+v", result.Entries)
+	}
+
+	result, err = q.Query(`ORDER BY created_at DESC LIMIT 1 OFFSET 1`)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if result.Count != 1 || string(result.Entries[0].Content) != "c" {
+		t.Errorf("unexpected paged result: %+v", result.Entries)
+	}
+
+	// Type and tag narrow what is loaded; LIMIT still applies to matches
+	result, err = q.Query(`type = "note" AND tag = "work" LIMIT 5`)
+	if err != nil || result.Count != 1 || string(result.Entries[0].Content) != "a" {
+		t.Errorf("unexpected type and tag result: %+v (%v)", result.Entries, err)
+	}
+	result, err = q.Query(`type = "note" AND content = "b" ORDER BY created_at LIMIT 1`)
+	if err != nil || result.Count != 1 || string(result.Entries[0].Content) != "b" {
+		t.Errorf("expected LIMIT after the content filter, got %+v (%v)", result.Entries, err)
+	}
+	if result, _ = q.Query(`type = "recipe"`); result.Count != 0 {
+		t.Errorf("expected no entries of an unknown type, got %+v", result.Entries)
+	}
+
+	if _, err := q.Query(`type = "note" AND bogus = 1`); err == nil {
+		t.Error("expected error for unknown field")
+	}
+}
+
+func TestDeleteQuery(t *testing.T) {
+	e, err := engine.New(engine.Config{InMemory: true})
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+	defer e.Close()
+
+	e.AddEntry(engine.AddEntryInput{Type: engine.Log, Content: []byte("a"), Tags: []string{"debug"}})
+	e.AddEntry(engine.AddEntryInput{Type: engine.Log, Content: []byte("b"), Tags: []string{"debug"}})
+	e.AddEntry(engine.AddEntryInput{Type: engine.Log, Content: []byte("c")})
+	note, _ := e.AddEntry(engine.AddEntryInput{Type: engine.Note, Content: []byte("d"), Tags: []string{"debug"}})
+
+	n, err := e.DeleteQuery(`type = "log" AND tag = "debug"`)
+	if err != nil {
+		t.Fatalf("DeleteQuery failed: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 deleted, got %d", n)
+	}
+	if entries, _ := e.ListEntries(engine.ListFilter{}); len(entries) != 2 {
+		t.Errorf("expected 2 entries left, got %d", len(entries))
+	}
+	if _, err := e.GetEntry(note.ID); err != nil {
+		t.Errorf("expected the note to be kept: %v", err)
+	}
+
+	if _, err := e.DeleteQuery(`type = `); !errors.Is(err, engine.ErrInvalidQuery) {
+		t.Errorf("expected ErrInvalidQuery, got %v", err)
+	}
+}
+
+func TestSearchFacets(t *testing.T) {
+	e, err := engine.New(engine.Config{InMemory: true})
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+	defer e.Close()
+
+	e.AddEntry(engine.AddEntryInput{Type: engine.Note, Content: []byte("weekly meeting notes"), Tags: []string{"work"}})
+	e.AddEntry(engine.AddEntryInput{Type: engine.Note, Content: []byte("meeting with the landlord"), Tags: []string{"home"}})
+	e.AddEntry(engine.AddEntryInput{Type: engine.Log, Content: []byte("meeting ran long"), Tags: []string{"work"}})
+	removed, _ := e.AddEntry(engine.AddEntryInput{Type: engine.Note, Content: []byte("cancelled meeting"), Tags: []string{"work"}})
+	e.DeleteEntry(removed.ID)
+
+	result, err := e.Search("meeting", engine.SearchOptions{Facets: true})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if result.Count != 3 || result.Total != 3 {
+		t.Fatalf("expected 3 hits, got count=%d total=%d", result.Count, result.Total)
+	}
+	if result.Facets == nil {
+		t.Fatal("expected facets")
+	}
+	counts := func(facets []engine.FacetCount) map[string]int {
+		m := make(map[string]int)
+		for _, f := range facets {
+			m[f.Term] = f.Count
+		}
+		return m
+	}
+	if types := counts(result.Facets.Types); types["note"] != 2 || types["log"] != 1 {
+		t.Errorf("unexpected type facets: %v", result.Facets.Types)
+	}
+	if tags := counts(result.Facets.Tags); tags["work"] != 2 || tags["home"] != 1 {
+		t.Errorf("unexpected tag facets: %v", result.Facets.Tags)
+	}
+	if len(result.Facets.Months) != 1 || result.Facets.Months[0].Count != 3 {
+		t.Errorf("unexpected month facets: %v", result.Facets.Months)
+	}
+
+	// Field-scoped query
+	result, err = e.Search(`tag:work content:"meeting notes"`, engine.SearchOptions{})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if result.Count != 1 || string(result.Entries[0].Content) != "weekly meeting notes" {
+		t.Errorf("unexpected scoped result: %+v", result.Entries)
+	}
+
+	// Filters
+	note := engine.Note
+	result, _ = e.Search("meeting", engine.SearchOptions{Type: &note, Tags: []string{"work"}})
+	if result.Count != 1 {
+		t.Errorf("expected 1 filtered hit, got %d", result.Count)
+	}
+}
+
+func TestSearchModesAndQuickOpen(t *testing.T) {
+	e, err := engine.New(engine.Config{InMemory: true})
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+	defer e.Close()
+
+	notes, _ := e.AddEntry(engine.AddEntryInput{Type: engine.Note, Content: []byte("# Meeting notes\nagenda for tuesday")})
+	e.AddEntry(engine.AddEntryInput{Type: engine.Note, Content: []byte("Grocery list\nmilk, eggs")})
+	removed, _ := e.AddEntry(engine.AddEntryInput{Type: engine.Note, Content: []byte("Monthly team notes")})
+	e.DeleteEntry(removed.ID)
+
+	// Prefix mode
+	result, err := e.Search("meet", engine.SearchOptions{Mode: engine.SearchPrefix})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if result.Count != 1 || result.Entries[0].ID != notes.ID {
+		t.Errorf("expected prefix match, got %+v", result.Entries)
+	}
+	if result, _ = e.Search("meet", engine.SearchOptions{}); result.Count != 0 {
+		t.Errorf("exact mode should not match a prefix, got %d hits", result.Count)
+	}
+
+	// Fuzzy mode tolerates typos
+	result, err = e.Search("meetng", engine.SearchOptions{Fuzzy: true})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if result.Count != 1 || result.Entries[0].ID != notes.ID {
+		t.Errorf("expected fuzzy match, got %+v", result.Entries)
+	}
+
+	// Quick-open matches titles by subsequence
+	matches, err := e.QuickOpen("mtg nts", 10)
+	if err != nil {
+		t.Fatalf("QuickOpen failed: %v", err)
+	}
+	if len(matches) != 1 || matches[0].ID != notes.ID || matches[0].Title != "Meeting notes" {
+		t.Fatalf("unexpected quick-open matches: %+v", matches)
+	}
+
+	// Titles follow updates
+	newContent := []byte("Standup minutes")
+	e.UpdateEntry(notes.ID, engine.UpdateEntryInput{Content: &newContent})
+	if matches, _ = e.QuickOpen("mtg nts", 10); len(matches) != 0 {
+		t.Errorf("expected no matches after rename, got %+v", matches)
+	}
+	if matches, _ = e.QuickOpen("stnd", 10); len(matches) != 1 {
+		t.Errorf("expected renamed entry to match, got %+v", matches)
+	}
+}
+
+func TestCustomCipher(t *testing.T) {
+	dir := t.TempDir()
+	key, _ := crypto.GenerateKey()
+
+	e, err := engine.New(engine.Config{DataDir: dir, EncryptionKey: &key, Cipher: crypto.AESGCM{}})
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+	entry, err := e.AddEntry(engine.AddEntryInput{Type: engine.Note, Content: []byte("classified")})
+	if err != nil {
+		t.Fatalf("AddEntry failed: %v", err)
+	}
+	e.Close()
+
+	// Reopen with the same cipher
+	e, err = engine.New(engine.Config{DataDir: dir, EncryptionKey: &key, Cipher: crypto.AESGCM{}})
+	if err != nil {
+		t.Fatalf("failed to reopen engine: %v", err)
+	}
+	got, err := e.GetEntry(entry.ID)
+	if err != nil || string(got.Content) != "classified" {
+		t.Errorf("expected decrypted content, got %q (%v)", got.Content, err)
+	}
+	e.Close()
+
+	// The default cipher cannot read it
+	e, err = engine.New(engine.Config{DataDir: dir, EncryptionKey: &key})
+	if err != nil {
+		t.Fatalf("failed to reopen engine: %v", err)
+	}
+	defer e.Close()
+	if got, err := e.GetEntry(entry.ID); err == nil {
+		t.Errorf("expected decryption failure with another cipher, got %q", got.Content)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	dir := t.TempDir()
+	oldKey, _ := crypto.GenerateKey()
+	newKey, _ := crypto.GenerateKey()
+
+	e, err := engine.New(engine.Config{DataDir: dir, EncryptionKey: &oldKey})
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+	entry, _ := e.AddEntry(engine.AddEntryInput{Type: engine.Note, Content: []byte("v1")})
+	content := []byte("v2")
+	e.UpdateEntry(entry.ID, engine.UpdateEntryInput{Content: &content})
+
+	if err := e.RotateKey(newKey); err != nil {
+		t.Fatalf("RotateKey failed: %v", err)
+	}
+	if got, err := e.GetEntry(entry.ID); err != nil || string(got.Content) != "v2" {
+		t.Errorf("expected content after rotation, got %q (%v)", got.Content, err)
+	}
+	e.Close()
+
+	// Everything was re-encrypted: the new key alone, at the next epoch,
+	// reads it
+	e, err = engine.New(engine.Config{DataDir: dir, EncryptionKey: &newKey, KeyEpoch: 1})
+	if err != nil {
+		t.Fatalf("failed to reopen engine: %v", err)
+	}
+	if got, err := e.GetEntry(entry.ID); err != nil || string(got.Content) != "v2" {
+		t.Errorf("expected content with new key, got %q (%v)", got.Content, err)
+	}
+	e.Close()
+
+	// The old key no longer reads it
+	e, _ = engine.New(engine.Config{DataDir: dir, EncryptionKey: &oldKey})
+	if _, err := e.GetEntry(entry.ID); err == nil {
+		t.Error("old key should not decrypt rotated content")
+	}
+	e.Close()
+
+	plain, _ := engine.New(engine.Config{InMemory: true})
+	defer plain.Close()
+	if err := plain.RotateKey(newKey); !errors.Is(err, engine.ErrNotEncrypted) {
+		t.Errorf("expected ErrNotEncrypted, got %v", err)
+	}
+}
+
+func TestLockUnlock(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	retired, _ := crypto.GenerateKey()
+	e, err := engine.New(engine.Config{InMemory: true, EncryptionKey: &key, RetiredKeys: []crypto.EpochKey{{Key: retired}}})
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+	defer e.Close()
+
+	entry, _ := e.AddEntry(engine.AddEntryInput{Type: engine.Note, Content: []byte("# Groceries\nmilk")})
+	e.GetEntry(entry.ID) // Cached
+
+	status := e.EncryptionStatus()
+	if !status.Enabled || status.Locked || status.Fingerprint != key.Fingerprint() || status.RetiredKeys != 1 {
+		t.Errorf("unexpected status %+v", status)
+	}
+
+	sub := e.Subscribe()
+	defer sub.Close()
+	events := sub.Events()
+
+	if err := e.Lock(); err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+	if err := e.Lock(); err != nil {
+		t.Errorf("locking twice should be a no-op: %v", err)
+	}
+	if ev := <-events; ev.Type != engine.EventLocked {
+		t.Errorf("expected locked event, got %s", ev.Type)
+	}
+	status = e.EncryptionStatus()
+	if !status.Locked || status.Fingerprint != key.Fingerprint() {
+		t.Errorf("unexpected locked status %+v", status)
+	}
+
+	// Nothing decrypted is served while locked, cache included
+	if _, err := e.GetEntry(entry.ID); !errors.Is(err, engine.ErrLocked) {
+		t.Errorf("GetEntry: expected ErrLocked, got %v", err)
+	}
+	if _, err := e.ListEntries(engine.ListFilter{}); !errors.Is(err, engine.ErrLocked) {
+		t.Errorf("ListEntries: expected ErrLocked, got %v", err)
+	}
+	if _, err := e.AddEntry(engine.AddEntryInput{Type: engine.Note, Content: []byte("x")}); !errors.Is(err, engine.ErrLocked) {
+		t.Errorf("AddEntry: expected ErrLocked, got %v", err)
+	}
+	if _, err := e.Search("milk", engine.SearchOptions{}); !errors.Is(err, engine.ErrLocked) {
+		t.Errorf("Search: expected ErrLocked, got %v", err)
+	}
+	if matches, _ := e.QuickOpen("groceries", 10); len(matches) != 0 {
+		t.Errorf("QuickOpen found %d titles while locked", len(matches))
+	}
+
+	other, _ := crypto.GenerateKey()
+	if err := e.Unlock(other); !errors.Is(err, engine.ErrWrongKey) {
+		t.Errorf("Unlock with another key: expected ErrWrongKey, got %v", err)
+	}
+	if err := e.Unlock(key); err != nil {
+		t.Fatalf("Unlock failed: %v", err)
+	}
+	if ev := <-events; ev.Type != engine.EventUnlocked {
+		t.Errorf("expected unlocked event, got %s", ev.Type)
+	}
+
+	if got, err := e.GetEntry(entry.ID); err != nil || string(got.Content) != "# Groceries\nmilk" {
+		t.Errorf("expected content after unlock, got %q (%v)", got.Content, err)
+	}
+	if results, err := e.Search("milk", engine.SearchOptions{}); err != nil || results.Total != 1 {
+		t.Errorf("expected search rebuilt after unlock, got %+v (%v)", results, err)
+	}
+	if matches, _ := e.QuickOpen("groceries", 10); len(matches) != 1 {
+		t.Errorf("expected quick-open rebuilt after unlock, got %d", len(matches))
+	}
+	if status := e.EncryptionStatus(); status.Locked || status.RetiredKeys != 1 {
+		t.Errorf("retired keys not restored: %+v", status)
+	}
+
+	plain, _ := engine.New(engine.Config{InMemory: true})
+	defer plain.Close()
+	if err := plain.Lock(); !errors.Is(err, engine.ErrNotEncrypted) {
+		t.Errorf("expected ErrNotEncrypted, got %v", err)
+	}
+	if status := plain.EncryptionStatus(); status.Enabled {
+		t.Errorf("unexpected status %+v", status)
+	}
+}
+
+func TestAdoptRotatedKey(t *testing.T) {
+	dir := t.TempDir()
+	oldKey, _ := crypto.GenerateKey()
+	newKey, _ := crypto.GenerateKey()
+
+	// A device that was offline during the rotation opens with the new
+	// key and the retired one
+	e, _ := engine.New(engine.Config{DataDir: dir, EncryptionKey: &oldKey})
+	offline, _ := e.AddEntry(engine.AddEntryInput{Type: engine.Note, Content: []byte("offline edit")})
+	e.Close()
+
+	e, err := engine.New(engine.Config{DataDir: dir, EncryptionKey: &newKey, KeyEpoch: 1, RetiredKeys: []crypto.EpochKey{{Key: oldKey}}})
+	if err != nil {
+		t.Fatalf("failed to reopen engine: %v", err)
+	}
+	if got, err := e.GetEntry(offline.ID); err != nil || string(got.Content) != "offline edit" {
+		t.Errorf("expected content via retired key, got %q (%v)", got.Content, err)
+	}
+
+	// A running device adopts a key rotated elsewhere
+	newerKey, _ := crypto.GenerateKey()
+	if err := e.AdoptKey(crypto.EpochKey{Epoch: 4, Key: newerKey}); err != nil {
+		t.Fatalf("AdoptKey failed: %v", err)
+	}
+	if status := e.EncryptionStatus(); status.Epoch != 4 {
+		t.Errorf("expected the rotating device's epoch 4, got %d", status.Epoch)
+	}
+	e.Close()
+
+	e, _ = engine.New(engine.Config{DataDir: dir, EncryptionKey: &newerKey, KeyEpoch: 4})
+	defer e.Close()
+	if got, err := e.GetEntry(offline.ID); err != nil || string(got.Content) != "offline edit" {
+		t.Errorf("expected re-encrypted content, got %q (%v)", got.Content, err)
+	}
+}
+
+func TestShareEntry(t *testing.T) {
+	dirA, dirB := t.TempDir(), t.TempDir()
+	keyA, _ := crypto.GenerateKey()
+	keyB, _ := crypto.GenerateKey()
+
+	// Each device has its own vault key; device keys are created on open
+	peerKeys := make(map[string][]byte)
+	resolve := func(peerID string) ([]byte, error) {
+		if key, ok := peerKeys[peerID]; ok {
+			return key, nil
+		}
+		return nil, errors.New("unknown peer")
+	}
+	a, err := engine.New(engine.Config{DataDir: dirA, EncryptionKey: &keyA, PeerKeys: resolve})
+	if err != nil {
+		t.Fatalf("failed to create engine A: %v", err)
+	}
+	defer func() { a.Close() }() // Reopened below
+	b, err := engine.New(engine.Config{DataDir: dirB, EncryptionKey: &keyB, PeerKeys: resolve})
+	if err != nil {
+		t.Fatalf("failed to create engine B: %v", err)
+	}
+	defer b.Close()
+
+	shared, _ := a.AddEntry(engine.AddEntryInput{Type: engine.Note, Content: []byte("for B")})
+	private, _ := a.AddEntry(engine.AddEntryInput{Type: engine.Note, Content: []byte("A only")})
+	own, _ := b.AddEntry(engine.AddEntryInput{Type: engine.Note, Content: []byte("B's note")})
+	for dir, owner := range map[string]string{dirA: shared.Owner, dirB: own.Owner} {
+		kp, _ := sharing.LoadOrCreateKeyPair(filepath.Join(dir, "device.key"))
+		peerKeys[owner] = kp.Public[:]
+	}
+
+	if err := a.ShareEntry(shared.ID, []string{"unknown"}); err == nil {
+		t.Error("sharing with a peer without a device key should fail")
+	}
+	if err := a.ShareEntry(shared.ID, []string{own.Owner}); err != nil {
+		t.Fatalf("ShareEntry failed: %v", err)
+	}
+	if err := b.ShareEntry(shared.ID, []string{own.Owner}); err == nil {
+		t.Error("only the owner should be able to share")
+	}
+
+	sync := func() {
+		payload, _ := a.GetSyncPayload()
+		if _, err := b.MergeRemotePayloadFrom(shared.Owner, payload); err != nil {
+			t.Fatalf("sync failed: %v", err)
+		}
+	}
+	sync()
+
+	got, err := b.GetEntry(shared.ID)
+	if err != nil || string(got.Content) != "for B" {
+		t.Fatalf("B should read the shared entry, got %q (%v)", got.Content, err)
+	}
+	if _, err := b.GetEntry(private.ID); err == nil {
+		t.Error("B should not read unshared entries")
+	}
+	list, err := b.ListEntries(engine.ListFilter{})
+	if err != nil {
+		t.Fatalf("ListEntries on B failed: %v", err)
+	}
+	if len(list) != 2 {
+		t.Errorf("expected B to list its own and the shared entry, got %d", len(list))
+	}
+
+	// Updates by the owner stay readable for the recipient
+	content := []byte("for B, edited")
+	a.UpdateEntry(shared.ID, engine.UpdateEntryInput{Content: &content})
+	sync()
+	if got, _ := b.GetEntry(shared.ID); string(got.Content) != "for B, edited" {
+		t.Errorf("expected updated shared content, got %q", got.Content)
+	}
+
+	// The owner still reads it after reopening
+	a.Close()
+	a, err = engine.New(engine.Config{DataDir: dirA, EncryptionKey: &keyA})
+	if err != nil {
+		t.Fatalf("failed to reopen engine A: %v", err)
+	}
+	if got, err := a.GetEntry(shared.ID); err != nil || string(got.Content) != "for B, edited" {
+		t.Errorf("owner should read shared entry, got %q (%v)", got.Content, err)
+	}
+}
+
+func TestEntryAcks(t *testing.T) {
+	a, err := engine.New(engine.Config{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("failed to create engine A: %v", err)
+	}
+	defer a.Close()
+	dirB := t.TempDir()
+	b, err := engine.New(engine.Config{DataDir: dirB, EnableAcks: true})
+	if err != nil {
+		t.Fatalf("failed to create engine B: %v", err)
+	}
+	defer func() { b.Close() }() // Reopened below
+
+	entry, _ := a.AddEntry(engine.AddEntryInput{Type: engine.Note, Content: []byte("hello"), Public: true})
+	if acks, err := a.EntryAcks(entry.ID); err != nil || len(acks) != 0 {
+		t.Fatalf("expected no acks before sync, got %v (%v)", acks, err)
+	}
+
+	sync := func(from, to engine.Engine) {
+		payload, _ := from.GetSyncPayload()
+		if err := to.ApplyRemotePayload(payload); err != nil {
+			t.Fatalf("sync failed: %v", err)
+		}
+	}
+	sync(a, b)
+	sync(b, a)
+
+	acks, err := a.EntryAcks(entry.ID)
+	if err != nil || len(acks) != 1 {
+		t.Fatalf("expected 1 ack on the author, got %v (%v)", acks, err)
+	}
+	self, _ := b.AddEntry(engine.AddEntryInput{Type: engine.Note})
+	if acks[0].Peer != self.Owner || acks[0].Version != entry.UpdatedAt {
+		t.Errorf("unexpected ack %+v", acks[0])
+	}
+
+	// An update is acknowledged with its new version
+	content := []byte("hello again")
+	a.UpdateEntry(entry.ID, engine.UpdateEntryInput{Content: &content})
+	updated, _ := a.GetEntry(entry.ID)
+	sync(a, b)
+	sync(b, a)
+	if acks, _ := a.EntryAcks(entry.ID); len(acks) != 1 || acks[0].Version != updated.UpdatedAt {
+		t.Errorf("expected ack of the updated version, got %+v", acks)
+	}
+
+	// Acks are persisted
+	b.Close()
+	b, err = engine.New(engine.Config{DataDir: dirB, EnableAcks: true})
+	if err != nil {
+		t.Fatalf("failed to reopen engine B: %v", err)
+	}
+	if acks, _ := b.EntryAcks(entry.ID); len(acks) != 1 {
+		t.Errorf("expected ack after reopen, got %d", len(acks))
+	}
+
+	// A did not enable acks, so B's entry is not acknowledged
+	if acks, _ := b.EntryAcks(self.ID); len(acks) != 0 {
+		t.Errorf("expected no acks from A, got %+v", acks)
+	}
+}
+
+func TestOpenWhileIndexInUse(t *testing.T) {
+	dir := t.TempDir()
+	e1, err := engine.New(engine.Config{DataDir: dir})
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+	defer e1.Close()
+	e1.AddEntry(engine.AddEntryInput{Type: engine.Note, Content: []byte("shared notes")})
+
+	// A second process (e.g. the CLI while the daemon runs) falls back to a
+	// private in-memory index instead of blocking on the on-disk one
+	e2, err := engine.New(engine.Config{DataDir: dir})
+	if err != nil {
+		t.Fatalf("failed to open engine while index in use: %v", err)
+	}
+	defer e2.Close()
+
+	result, err := e2.Search("shared", engine.SearchOptions{})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if result.Count != 1 {
+		t.Errorf("expected 1 hit from fallback index, got %d", result.Count)
+	}
+}
+
+func TestIndexCatchesUpAfterSharedOpen(t *testing.T) {
+	dir := t.TempDir()
+	e1, err := engine.New(engine.Config{DataDir: dir})
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+	edited, _ := e1.AddEntry(engine.AddEntryInput{Type: engine.Note, Content: []byte("alpha notes")})
+	deleted, _ := e1.AddEntry(engine.AddEntryInput{Type: engine.Note, Content: []byte("beta notes")})
+
+	// Changes made by a second process while e1 holds the on-disk index
+	// never reach it, and leave the entry count as it was
+	e2, err := engine.New(engine.Config{DataDir: dir})
+	if err != nil {
+		t.Fatalf("failed to open engine while index in use: %v", err)
+	}
+	content := []byte("gamma notes")
+	if err := e2.UpdateEntry(edited.ID, engine.UpdateEntryInput{Content: &content}); err != nil {
+		t.Fatalf("failed to update: %v", err)
+	}
+	if err := e2.DeleteEntry(deleted.ID); err != nil {
+		t.Fatalf("failed to delete: %v", err)
+	}
+	e2.AddEntry(engine.AddEntryInput{Type: engine.Note, Content: []byte("delta notes")})
+	e2.Close()
+	e1.Close()
+
+	e3, err := engine.New(engine.Config{DataDir: dir})
+	if err != nil {
+		t.Fatalf("failed to reopen engine: %v", err)
+	}
+	defer e3.Close()
+	for query, want := range map[string]int{"alpha": 0, "beta": 0, "gamma": 1, "delta": 1, "notes": 2} {
+		result, err := e3.Search(query, engine.SearchOptions{})
+		if err != nil {
+			t.Fatalf("Search(%q) failed: %v", query, err)
+		}
+		if result.Count != want {
+			t.Errorf("Search(%q): expected %d hits, got %d", query, want, result.Count)
+		}
+	}
+}
+
+func TestHybridClock(t *testing.T) {
+	if _, err := engine.New(engine.Config{InMemory: true, Clock: "vector"}); err == nil {
+		t.Fatal("expected error for unknown clock")
+	}
+
+	dir := t.TempDir()
+	e, err := engine.New(engine.Config{DataDir: dir, Clock: engine.ClockHybrid})
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+
+	before := time.Now().Add(-time.Second)
+	entry, err := e.AddEntry(engine.AddEntryInput{Type: engine.Note, Content: []byte("hlc")})
+	if err != nil {
+		t.Fatalf("failed to add entry: %v", err)
+	}
+	// HLC timestamps carry wall time (milliseconds in the high 48 bits)
+	if wall := time.UnixMilli(int64(entry.CreatedAt >> 16)); wall.Before(before) || wall.After(time.Now()) {
+		t.Errorf("expected HLC timestamp near now, got %d (%v)", entry.CreatedAt, wall)
+	}
+	if entry.CreatedTime.Before(before) || entry.CreatedTime.After(time.Now()) {
+		t.Errorf("expected wall-clock creation time near now, got %v", entry.CreatedTime)
+	}
+
+	content := []byte("hlc edited")
+	if err := e.UpdateEntry(entry.ID, engine.UpdateEntryInput{Content: &content}); err != nil {
+		t.Fatalf("failed to update: %v", err)
+	}
+	e.Close()
+
+	// Wall times survive a restart, and a Lamport engine keeps ordering
+	e, err = engine.New(engine.Config{DataDir: dir})
+	if err != nil {
+		t.Fatalf("failed to reopen engine: %v", err)
+	}
+	defer e.Close()
+	got, err := e.GetEntry(entry.ID)
+	if err != nil {
+		t.Fatalf("failed to get entry: %v", err)
+	}
+	if !got.CreatedTime.Equal(entry.CreatedTime) || got.UpdatedTime.Before(got.CreatedTime) {
+		t.Errorf("wall times lost: created %v, updated %v", got.CreatedTime, got.UpdatedTime)
+	}
+	content = []byte("lamport edit")
+	if err := e.UpdateEntry(entry.ID, engine.UpdateEntryInput{Content: &content}); err != nil {
+		t.Fatalf("failed to update: %v", err)
+	}
+	if again, _ := e.GetEntry(entry.ID); again.UpdatedAt <= got.UpdatedAt {
+		t.Errorf("expected Lamport update after HLC time %d, got %d", got.UpdatedAt, again.UpdatedAt)
+	}
+}
+
+// recordingExtension logs its hook calls and can transform or reject
+type recordingExtension struct {
+	engine.BaseExtension
+	name     string
+	log      *[]string
+	startErr error
+	before   func(content []byte) ([]byte, error)
+	merged   []engine.MergeChange
+}
+
+func (x *recordingExtension) Name() string { return x.name }
+
+func (x *recordingExtension) OnStart(engine.Engine) error {
+	*x.log = append(*x.log, x.name+".start")
+	return x.startErr
+}
+
+func (x *recordingExtension) OnStop() error {
+	*x.log = append(*x.log, x.name+".stop")
+	return nil
+}
+
+func (x *recordingExtension) BeforeAdd(input *engine.AddEntryInput) error {
+	*x.log = append(*x.log, x.name+".add")
+	if x.before == nil {
+		return nil
+	}
+	content, err := x.before(input.Content)
+	input.Content = content
+	return err
+}
+
+func (x *recordingExtension) BeforeUpdate(current engine.Entry, input *engine.UpdateEntryInput) error {
+	*x.log = append(*x.log, x.name+".update:"+string(current.Content))
+	if x.before == nil || input.Content == nil {
+		return nil
+	}
+	content, err := x.before(*input.Content)
+	input.Content = &content
+	return err
+}
+
+func (x *recordingExtension) AfterMerge(changes []engine.MergeChange) {
+	x.merged = append(x.merged, changes...)
+}
+
+func TestExtensions(t *testing.T) {
+	var log []string
+	errRejected := errors.New("rejected")
+	upper := &recordingExtension{name: "upper", log: &log, before: func(c []byte) ([]byte, error) {
+		return []byte(strings.ToUpper(string(c))), nil
+	}}
+	guard := &recordingExtension{name: "guard", log: &log, before: func(c []byte) ([]byte, error) {
+		if strings.Contains(string(c), "SECRET") {
+			return c, errRejected
+		}
+		return c, nil
+	}}
+
+	e, err := engine.New(engine.Config{InMemory: true, Extensions: []engine.Extension{upper, guard}})
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+
+	// Transforms apply in order, and later extensions see them
+	entry, err := e.AddEntry(engine.AddEntryInput{Type: engine.Note, Content: []byte("hello")})
+	if err != nil {
+		t.Fatalf("failed to add entry: %v", err)
+	}
+	if got, _ := e.GetEntry(entry.ID); string(got.Content) != "HELLO" {
+		t.Errorf("expected transformed content, got %q", got.Content)
+	}
+
+	// The first error rejects the change
+	content := []byte("a secret")
+	err = e.UpdateEntry(entry.ID, engine.UpdateEntryInput{Content: &content})
+	var extErr *engine.ExtensionError
+	if !errors.Is(err, errRejected) || !errors.As(err, &extErr) || extErr.Extension != "guard" {
+		t.Fatalf("expected rejection by guard, got %v", err)
+	}
+	if got, _ := e.GetEntry(entry.ID); string(got.Content) != "HELLO" {
+		t.Errorf("rejected update was written: %q", got.Content)
+	}
+
+	// Merged changes skip before hooks and are reported after the merge
+	remote, _ := engine.New(engine.Config{InMemory: true})
+	defer remote.Close()
+	remote.AddEntry(engine.AddEntryInput{Type: engine.Note, Content: []byte("secret from afar")})
+	payload, _ := remote.GetSyncPayload()
+	if err := e.ApplyRemotePayload(payload); err != nil {
+		t.Fatalf("failed to merge: %v", err)
+	}
+	if len(upper.merged) != 1 || upper.merged[0].Type != engine.EventCreated || string(upper.merged[0].Entry.Content) != "secret from afar" {
+		t.Errorf("unexpected merge changes: %+v", upper.merged)
+	}
+
+	e.Close()
+	want := []string{
+		"upper.start", "guard.start",
+		"upper.add", "guard.add",
+		"upper.update:HELLO", "guard.update:HELLO",
+		"guard.stop", "upper.stop",
+	}
+	if !reflect.DeepEqual(log, want) {
+		t.Errorf("hook calls:\n got %v\nwant %v", log, want)
+	}
+
+	// A failing OnStart fails New and stops extensions already started
+	log = nil
+	failing := &recordingExtension{name: "failing", log: &log, startErr: errRejected}
+	if _, err := engine.New(engine.Config{InMemory: true, Extensions: []engine.Extension{upper, failing}}); !errors.Is(err, errRejected) {
+		t.Fatalf("expected OnStart error, got %v", err)
+	}
+	if want := []string{"upper.start", "failing.start", "upper.stop"}; !reflect.DeepEqual(log, want) {
+		t.Errorf("hook calls:\n got %v\nwant %v", log, want)
+	}
+}
+
+func TestRules(t *testing.T) {
+	a, _ := engine.New(engine.Config{InMemory: true})
+	defer a.Close()
+	b, _ := engine.New(engine.Config{InMemory: true})
+	defer b.Close()
+
+	if _, err := a.AddRule(engine.Rule{Type: "log"}); err == nil {
+		t.Error("expected a rule without actions to be rejected")
+	}
+	rule, err := a.AddRule(engine.Rule{Name: "errors", Type: "log", Pattern: "(?i)error", AddTags: []string{"errors"}})
+	if err != nil {
+		t.Fatalf("failed to add rule: %v", err)
+	}
+
+	entry, _ := a.AddEntry(engine.AddEntryInput{Type: engine.Log, Content: []byte("ERROR: disk full"), Tags: []string{"ops"}})
+	if !reflect.DeepEqual(slices.Sorted(slices.Values(entry.Tags)), []string{"errors", "ops"}) {
+		t.Errorf("expected rule tags on add, got %v", entry.Tags)
+	}
+	quiet, _ := a.AddEntry(engine.AddEntryInput{Type: engine.Log, Content: []byte("all good")})
+	content := []byte("error again")
+	if err := a.UpdateEntry(quiet.ID, engine.UpdateEntryInput{Content: &content}); err != nil {
+		t.Fatalf("failed to update: %v", err)
+	}
+	if got, _ := a.GetEntry(quiet.ID); !reflect.DeepEqual(got.Tags, []string{"errors"}) {
+		t.Errorf("expected rule tags on update, got %v", got.Tags)
+	}
+
+	// Rules sync as config entries
+	payload, _ := a.GetSyncPayload()
+	if err := b.ApplyRemotePayload(payload); err != nil {
+		t.Fatalf("failed to sync: %v", err)
+	}
+	synced, err := b.ListRules()
+	if err != nil || len(synced) != 1 || synced[0].ID != rule.ID {
+		t.Fatalf("expected the rule on the other device, got %v (%v)", synced, err)
+	}
+	if added, _ := b.AddEntry(engine.AddEntryInput{Type: engine.Log, Content: []byte("error")}); len(added.Tags) != 1 {
+		t.Errorf("expected synced rule to apply, got tags %v", added.Tags)
+	}
+
+	if err := a.RemoveRule(entry.ID); err == nil {
+		t.Error("expected RemoveRule to refuse an ordinary entry")
+	}
+	if err := a.RemoveRule(rule.ID); err != nil {
+		t.Fatalf("failed to remove rule: %v", err)
+	}
+	if added, _ := a.AddEntry(engine.AddEntryInput{Type: engine.Log, Content: []byte("error")}); len(added.Tags) != 0 {
+		t.Errorf("removed rule still applies: %v", added.Tags)
+	}
+}
+
+func TestImportEntries(t *testing.T) {
+	src, _ := engine.New(engine.Config{InMemory: true})
+	defer src.Close()
+	dst, _ := engine.New(engine.Config{InMemory: true})
+	defer dst.Close()
+
+	note, _ := src.AddEntry(engine.AddEntryInput{Type: engine.Note, Content: []byte("note"), Tags: []string{"work"}})
+	src.AddEntry(engine.AddEntryInput{Type: engine.Log, Content: []byte("log")})
+
+	export, err := engine.ExportEntries(src, engine.ExportFilter{Types: []string{"note", "log"}})
+	if err != nil || len(export) != 2 {
+		t.Fatalf("expected 2 entries to export, got %d (%v)", len(export), err)
+	}
+	if export, _ := engine.ExportEntries(src, engine.ExportFilter{Since: time.Now().Add(time.Hour)}); len(export) != 0 {
+		t.Errorf("expected no entries created in the future, got %d", len(export))
+	}
+
+	opts := engine.ImportOptions{Filter: engine.ExportFilter{Tags: []string{"work"}}, DryRun: true}
+	result, err := engine.ImportEntries(dst, export, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Imported != 1 || result.Skipped != 1 {
+		t.Errorf("unexpected dry run result: %+v", result)
+	}
+	if entries, _ := dst.ListEntries(engine.ListFilter{}); len(entries) != 0 {
+		t.Errorf("dry run changed the vault: %d entries", len(entries))
+	}
+
+	// Colliding IDs are skipped by default
+	result, _ = engine.ImportEntries(src, export, engine.ImportOptions{})
+	if result.Imported != 0 || result.Skipped != 2 {
+		t.Errorf("expected collisions to be skipped, got %+v", result)
+	}
+
+	export[0].Content, export[1].Content = "changed", "changed"
+	result, _ = engine.ImportEntries(src, export, engine.ImportOptions{OnCollision: engine.CollisionOverwrite})
+	if result.Imported != 2 {
+		t.Errorf("expected collisions to overwrite, got %+v", result)
+	}
+	if got, _ := src.GetEntry(note.ID); string(got.Content) != "changed" || !reflect.DeepEqual(got.Tags, []string{"work"}) {
+		t.Errorf("expected overwritten entry, got %q %v", got.Content, got.Tags)
+	}
+
+	engine.ImportEntries(src, export, engine.ImportOptions{OnCollision: engine.CollisionDuplicate})
+	if entries, _ := src.ListEntries(engine.ListFilter{}); len(entries) != 4 {
+		t.Errorf("expected duplicates to be added, got %d entries", len(entries))
+	}
+
+	if _, err := engine.ImportEntries(src, export, engine.ImportOptions{OnCollision: "merge"}); err == nil {
+		t.Error("expected an unknown collision policy to be rejected")
+	}
+}
+
+func TestImportDedup(t *testing.T) {
+	e, _ := engine.New(engine.Config{InMemory: true})
+	defer e.Close()
+
+	note, _ := e.AddEntry(engine.AddEntryInput{Type: engine.Note, Content: []byte("same"), Tags: []string{"a"}})
+	export := []engine.ExportEntry{
+		{ID: note.ID.String(), Type: "note", Content: "same", Tags: []string{"b"}},
+		{ID: uuid.NewString(), Type: "note", Content: "same", Tags: []string{"c"}}, // Regenerated ID
+		{ID: uuid.NewString(), Type: "log", Content: "same"},                      // Other type
+		{ID: uuid.NewString(), Type: "log", Content: "same"},                      // Duplicate within the import
+	}
+
+	result, err := engine.ImportEntries(e, export, engine.ImportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.MatchedByID != 1 || result.MatchedByContent != 2 || result.Skipped != 3 || result.Imported != 1 {
+		t.Errorf("unexpected result: %+v", result)
+	}
+
+	result, _ = engine.ImportEntries(e, export[:2], engine.ImportOptions{
+		OnCollision: engine.CollisionMergeTags,
+		OnDuplicate: engine.CollisionMergeTags,
+	})
+	if result.Merged != 2 || result.Imported != 0 {
+		t.Errorf("expected tags to be merged, got %+v", result)
+	}
+	if got, _ := e.GetEntry(note.ID); !reflect.DeepEqual(slices.Sorted(slices.Values(got.Tags)), []string{"a", "b", "c"}) {
+		t.Errorf("expected merged tags, got %v", got.Tags)
+	}
+
+	result, _ = engine.ImportEntries(e, export[1:2], engine.ImportOptions{OnDuplicate: engine.CollisionDuplicate})
+	if result.Imported != 1 || result.MatchedByContent != 1 {
+		t.Errorf("expected the duplicate to be created, got %+v", result)
+	}
+	if entries, _ := e.ListEntries(engine.ListFilter{}); len(entries) != 3 {
+		t.Errorf("expected 3 entries, got %d", len(entries))
+	}
+}
+
+// TestConcurrentAPIAndSync drives one engine from API handlers, direct
+// calls and sync with a second engine at the same time; run with -race
+func TestConcurrentAPIAndSync(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	e1, err := engine.New(engine.Config{InMemory: true, EncryptionKey: &key})
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+	defer e1.Close()
+	e2, err := engine.New(engine.Config{InMemory: true, EncryptionKey: &key})
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+	defer e2.Close()
+
+	server := httptest.NewServer(api.New(e1, nil))
+	defer server.Close()
+
+	sub := e1.Subscribe()
+	defer sub.Close()
+	go func() {
+		for range sub.Events() {
+		}
+	}()
+
+	const rounds = 30
+	var wg sync.WaitGroup
+	run := func(fn func(i int) error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				if err := fn(i); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+
+	for _, e := range []engine.Engine{e1, e2} {
+		e := e
+		run(func(i int) error {
+			entry, err := e.AddEntry(engine.AddEntryInput{Type: engine.Note, Content: []byte(fmt.Sprintf("note %d", i)), Tags: []string{"a"}})
+			if err != nil {
+				return err
+			}
+			content := []byte(fmt.Sprintf("edited note %d", i))
+			return e.UpdateEntry(entry.ID, engine.UpdateEntryInput{Content: &content, Tags: &[]string{"b"}})
+		})
+		run(func(int) error {
+			if _, err := e.ListEntries(engine.ListFilter{}); err != nil {
+				return err
+			}
+			_, err := e.Search("note", engine.SearchOptions{})
+			return err
+		})
+	}
+	run(func(i int) error {
+		body := strings.NewReader(fmt.Sprintf(`{"type":"note","content":"api %d"}`, i))
+		resp, err := http.Post(server.URL+"/entries", "application/json", body)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated {
+			return fmt.Errorf("POST /entries: %s", resp.Status)
+		}
+		return nil
+	})
+	run(func(int) error {
+		for _, path := range []string{"/entries", "/search?q=note", "/status", "/aggregate"} {
+			resp, err := http.Get(server.URL + path)
+			if err != nil {
+				return err
+			}
+			resp.Body.Close()
+		}
+		return nil
+	})
+	run(func(int) error {
+		payload, err := e1.GetSyncPayload()
+		if err != nil {
+			return err
+		}
+		if err := e2.ApplyRemotePayload(payload); err != nil {
+			return err
+		}
+		if payload, err = e2.GetSyncPayload(); err != nil {
+			return err
+		}
+		return e1.ApplyRemotePayload(payload)
+	})
+	wg.Wait()
+
+	payload, _ := e1.GetSyncPayload()
+	e2.ApplyRemotePayload(payload)
+	payload, _ = e2.GetSyncPayload()
+	e1.ApplyRemotePayload(payload)
+
+	list1, _ := e1.ListEntries(engine.ListFilter{})
+	list2, _ := e2.ListEntries(engine.ListFilter{})
+	if len(list1) != 3*rounds || len(list2) != 3*rounds {
+		t.Errorf("expected %d entries on both engines, got %d and %d", 3*rounds, len(list1), len(list2))
+	}
+}
+
+func TestVersionHistory(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	e, err := engine.New(engine.Config{InMemory: true, EncryptionKey: &key})
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+	defer e.Close()
+
+	entry, _ := e.AddEntry(engine.AddEntryInput{Type: engine.Note, Content: []byte("one\ntwo"), Tags: []string{"a"}})
+	for _, content := range []string{"one\nthree", "one\nthree\nfour"} {
+		c := []byte(content)
+		if err := e.UpdateEntry(entry.ID, engine.UpdateEntryInput{Content: &c, Tags: &[]string{"b"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	page, total, err := e.History(entry.ID, 2, 0)
+	if err != nil || total != 3 || len(page) != 2 || string(page[0].Content) != "one\nthree\nfour" {
+		t.Fatalf("unexpected first page %v of %d: %v", page, total, err)
+	}
+	rest, _, _ := e.History(entry.ID, 2, 2)
+	if len(rest) != 1 || string(rest[0].Content) != "one\ntwo" {
+		t.Fatalf("unexpected second page %v", rest)
+	}
+	first := rest[0].ID
+
+	diff, err := e.DiffVersions(entry.ID, first, page[1].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff.ContentDiff != " one\n-two\n+three\n" || !slices.Equal(diff.TagsAdded, []string{"b"}) || !slices.Equal(diff.TagsRemoved, []string{"a"}) {
+		t.Errorf("unexpected diff %+v", diff)
+	}
+	if _, err := e.GetVersion(entry.ID, 9999); !errors.Is(err, engine.ErrVersionNotFound) {
+		t.Errorf("expected ErrVersionNotFound, got %v", err)
+	}
+
+	// Over HTTP
+	server := httptest.NewServer(api.New(e, nil))
+	defer server.Close()
+	base := server.URL + "/entries/" + entry.ID.String()
+
+	resp, err := http.Get(base + "/versions?limit=1&offset=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var versions api.VersionsResponse
+	json.NewDecoder(resp.Body).Decode(&versions)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || versions.Total != 3 || len(versions.Versions) != 1 || string(versions.Versions[0].Content) != "one\nthree" {
+		t.Errorf("unexpected versions %d %+v", resp.StatusCode, versions)
+	}
+
+	resp, _ = http.Get(base + "/diff?from=" + strconv.FormatInt(first, 10) + "&to=" + strconv.FormatInt(page[0].ID, 10))
+	var httpDiff engine.VersionDiff
+	json.NewDecoder(resp.Body).Decode(&httpDiff)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || httpDiff.ContentDiff != " one\n-two\n+three\n+four\n" {
+		t.Errorf("unexpected diff %d %+v", resp.StatusCode, httpDiff)
+	}
+
+	resp, _ = http.Get(base + "/versions/9999")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown version, got %d", resp.StatusCode)
+	}
+
+	resp, _ = http.Post(base+"/restore/"+strconv.FormatInt(first, 10), "", nil)
+	var restored engine.Entry
+	json.NewDecoder(resp.Body).Decode(&restored)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(restored.Content) != "one\ntwo" || !slices.Equal(restored.Tags, []string{"a"}) {
+		t.Errorf("unexpected restore %d %+v", resp.StatusCode, restored)
+	}
+	if _, total, _ := e.History(entry.ID, 0, 0); total != 4 {
+		t.Errorf("restoring should save a new version, got %d", total)
+	}
+}
+
+func TestRenderedEntry(t *testing.T) {
+	e, err := engine.New(engine.Config{InMemory: true})
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+	defer e.Close()
+
+	recipes, _ := e.AddEntry(engine.AddEntryInput{Type: engine.Note, Content: []byte("# Recipes\npancakes")})
+	note, _ := e.AddEntry(engine.AddEntryInput{Type: engine.Note, Content: []byte(
+		"# Groceries\nSee [[recipes]] and [[Missing]] <script>x</script>\n\n```go\nfunc main() {}\n```")})
+	login, err := e.AddEntry(engine.AddEntryInput{Type: engine.Credential, Content: []byte(`{"service":"GitHub","username":"alice","password":"secret"}`)})
+	if err != nil {
+		t.Fatalf("failed to add credential: %v", err)
+	}
+
+	server := httptest.NewServer(api.New(e, nil))
+	defer server.Close()
+	get := func(path string) (int, string, string) {
+		t.Helper()
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, resp.Header.Get("Content-Type"), string(body)
+	}
+
+	status, contentType, body := get("/entries/" + note.ID.String() + "/rendered")
+	if status != http.StatusOK || contentType != "text/html; charset=utf-8" {
+		t.Fatalf("got %d %s: %s", status, contentType, body)
+	}
+	for _, want := range []string{
+		"<h1>Groceries</h1>",
+		`<a class="wikilink" href="/entries/` + recipes.ID.String() + `/rendered">recipes</a>`,
+		`<span class="wikilink missing">Missing</span>`,
+		"&lt;script&gt;",
+		`<span class="hl-kw">func</span> main()`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("rendered note is missing %s:\n%s", want, body)
+		}
+	}
+
+	_, _, body = get("/entries/" + recipes.ID.String() + "/rendered?format=json")
+	var rendered api.RenderedEntry
+	if err := json.Unmarshal([]byte(body), &rendered); err != nil || rendered.Title != "Recipes" || rendered.HTML != "<h1>Recipes</h1>\n<p>pancakes</p>\n" {
+		t.Errorf("unexpected JSON %s: %v", body, err)
+	}
+
+	if status, _, _ := get("/entries/" + login.ID.String() + "/rendered"); status != http.StatusUnprocessableEntity {
+		t.Errorf("rendering a credential got %d, want 422", status)
+	}
+}
@@ -1,7 +1,11 @@
 package engine
 
 import (
+	"errors"
+
+	impl "github.com/amaydixit11/acorde/internal/engine"
 	"github.com/amaydixit11/acorde/internal/storage"
+	"github.com/amaydixit11/acorde/internal/templates"
 	"github.com/google/uuid"
 )
 
@@ -32,6 +36,118 @@ func (e ErrDeleted) Error() string {
 	return "cannot update deleted entry: " + e.ID.String()
 }
 
+// ErrNotEncrypted is returned by RotateKey, AdoptKey, Lock and Unlock on
+// vaults opened without an EncryptionKey
+var ErrNotEncrypted = impl.ErrNotEncrypted
+
+// ErrLocked is returned by reads and writes of encrypted content, and
+// by Search, while the vault is locked (see Engine.Lock)
+var ErrLocked = impl.ErrLocked
+
+// ErrNoBlobStore is returned by Engine.StoreFile on in-memory vaults
+var ErrNoBlobStore = impl.ErrNoBlobStore
+
+// ErrWrongKey is returned by Engine.Unlock for a key that is not the
+// vault's
+var ErrWrongKey = impl.ErrWrongKey
+
+// ErrNotShared is returned when reading a shared entry this device was
+// not given a key for
+var ErrNotShared = impl.ErrNotShared
+
+// ErrVersionNotFound is returned by GetVersion, DiffVersions and
+// RestoreVersion for a version the entry doesn't have
+var ErrVersionNotFound = impl.ErrVersionNotFound
+
+// ErrACLDisabled is returned by ShareEntry when Config.DisableACL is set
+var ErrACLDisabled = impl.ErrACLDisabled
+
+// ErrGroupNotFound is returned for a group the vault does not have
+var ErrGroupNotFound = impl.ErrGroupNotFound
+
+// ErrGroupExists is returned by CreateGroup for a group name already
+// taken
+var ErrGroupExists = impl.ErrGroupExists
+
+// ErrAmbiguousID is returned by ResolveID and Resolve for a reference
+// matching several entries
+var ErrAmbiguousID = impl.ErrAmbiguousID
+
+// ErrUnknownID is returned by ResolveID and Resolve for a reference
+// matching no entry
+var ErrUnknownID = impl.ErrUnknownID
+
+// ErrCollectionNotFound is returned for a collection the vault does not
+// have
+var ErrCollectionNotFound = impl.ErrCollectionNotFound
+
+// ErrCollectionExists is returned for a collection name already taken in
+// the parent collection
+var ErrCollectionExists = impl.ErrCollectionExists
+
+// ErrCollectionNotEmpty is returned by DeleteCollection for a collection
+// holding entries or collections
+var ErrCollectionNotEmpty = impl.ErrCollectionNotEmpty
+
+// ErrCollectionCycle is returned by MoveCollection for a move into the
+// collection itself or below it
+var ErrCollectionCycle = impl.ErrCollectionCycle
+
+// ErrTemplateNotFound is returned for a template the vault does not have
+var ErrTemplateNotFound = impl.ErrTemplateNotFound
+
+// ErrMissingVariable is returned by AddFromTemplate for a template
+// variable it was given no value for; the message names them
+var ErrMissingVariable = templates.ErrMissingVariable
+
+// ErrSchemaValidation is returned by AddEntry and UpdateEntry when content
+// does not match the schema registered for its entry type
+var ErrSchemaValidation = impl.ErrSchemaValidation
+
+// ErrSchemaNotFound is returned for an entry type without a schema saved
+// in the vault
+var ErrSchemaNotFound = impl.ErrSchemaNotFound
+
+// ErrNoSchema is returned by AddEntry and AppendLog, with
+// Config.StrictSchemas, for entry types that have no registered schema
+var ErrNoSchema = impl.ErrNoSchema
+
+// ErrInvalidNamespace is returned by AddEntry for a namespace name
+// ValidateNamespace refuses
+var ErrInvalidNamespace = impl.ErrInvalidNamespace
+
+// ErrNotSyncEvent is returned by PublishSyncEvent for events that are
+// not sync lifecycle events
+var ErrNotSyncEvent = impl.ErrNotSyncEvent
+
+// ErrInvalidQuery is returned by Query and DeleteQuery, wrapped with the
+// reason, for queries that do not parse
+var ErrInvalidQuery = errors.New("invalid query")
+
+// ErrLimitExceeded is returned, wrapped in a *LimitError, by AddEntry and
+// UpdateEntry when an entry exceeds Config.MaxContentSize,
+// MaxTagsPerEntry or MaxTagLength
+var ErrLimitExceeded = impl.ErrLimitExceeded
+
+// ErrInvalidPatch is returned by PatchEntry when a patch is malformed or
+// does not apply to the entry's content
+var ErrInvalidPatch = impl.ErrInvalidPatch
+
+// ErrPatchTestFailed is returned by PatchEntry when a JSON Patch "test"
+// operation does not match the entry's content
+var ErrPatchTestFailed = impl.ErrPatchTestFailed
+
+// ErrEntryExists is returned by CopyEntryTo and MoveEntryTo when the
+// destination vault already has the entry
+var ErrEntryExists = impl.ErrEntryExists
+
+// ErrSubscriptionOverflow is the Err of a subscription that OverflowClose
+// closed because its buffer was full
+var ErrSubscriptionOverflow = impl.ErrSubscriptionOverflow
+
+// LimitError reports which limit an entry exceeded
+type LimitError = impl.LimitError
+
 // convertError converts internal errors to public error types
 func convertError(err error) error {
 	if err == nil {
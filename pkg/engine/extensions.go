@@ -0,0 +1,125 @@
+package engine
+
+import (
+	impl "github.com/amaydixit11/acorde/internal/engine"
+)
+
+// Extension adds behavior to the engine without forking it: auto-tagging,
+// content transforms, external indexers. Register extensions with
+// Config.Extensions. Embed BaseExtension to implement only the hooks you
+// need.
+//
+// Ordering and errors:
+//   - Hooks are called synchronously, in registration order (OnStop in
+//     reverse order), on the goroutine making the change.
+//   - BeforeAdd and BeforeUpdate may modify the input; later extensions
+//     see it modified. They run before schema validation and encryption.
+//     The first error rejects the change, later extensions are skipped and
+//     the caller gets an *ExtensionError wrapping it.
+//   - AfterMerge runs once changes received through sync are persisted
+//     and published. It cannot fail the merge. Before hooks do not run for
+//     merged changes, which were accepted on the device that made them.
+//   - An OnStart error fails New; extensions already started are stopped.
+type Extension interface {
+	// Name identifies the extension in errors
+	Name() string
+
+	// OnStart is called once the engine is open, before New returns
+	OnStart(e Engine) error
+
+	// OnStop is called by Close while the engine is still usable
+	OnStop() error
+
+	// BeforeAdd may modify or reject a new entry
+	BeforeAdd(input *AddEntryInput) error
+
+	// BeforeUpdate may modify or reject an update of current
+	BeforeUpdate(current Entry, input *UpdateEntryInput) error
+
+	// AfterMerge is told about entries a sync created, updated or deleted
+	AfterMerge(changes []MergeChange)
+}
+
+// BaseExtension implements every hook of Extension but Name as a no-op
+type BaseExtension struct{}
+
+func (BaseExtension) OnStart(Engine) error                        { return nil }
+func (BaseExtension) OnStop() error                               { return nil }
+func (BaseExtension) BeforeAdd(*AddEntryInput) error              { return nil }
+func (BaseExtension) BeforeUpdate(Entry, *UpdateEntryInput) error { return nil }
+func (BaseExtension) AfterMerge([]MergeChange)                    {}
+
+// MergeChange is an entry a merge created, updated or deleted. Content is
+// plaintext, or nil if this device cannot decrypt it.
+type MergeChange struct {
+	Type  EventType
+	Entry Entry
+}
+
+// ExtensionError is returned when an extension hook fails. errors.Is and
+// errors.As see through it to the extension's error.
+type ExtensionError = impl.ExtensionError
+
+// extensionAdapter presents a public Extension to the internal engine
+type extensionAdapter struct {
+	ext Extension
+}
+
+func toInternalExtensions(exts []Extension) []impl.Extension {
+	if len(exts) == 0 {
+		return nil
+	}
+	adapted := make([]impl.Extension, len(exts))
+	for i, ext := range exts {
+		adapted[i] = extensionAdapter{ext}
+	}
+	return adapted
+}
+
+func (a extensionAdapter) Name() string {
+	return a.ext.Name()
+}
+
+func (a extensionAdapter) OnStart(e impl.Engine) error {
+	return a.ext.OnStart(&engineWrapper{impl: e})
+}
+
+func (a extensionAdapter) OnStop() error {
+	return a.ext.OnStop()
+}
+
+func (a extensionAdapter) BeforeAdd(input *impl.AddEntryInput) error {
+	in := AddEntryInput{
+		Type:    EntryType(input.Type),
+		Content: input.Content,
+		Tags:    input.Tags,
+		Public:  input.Public,
+	}
+	if err := a.ext.BeforeAdd(&in); err != nil {
+		return err
+	}
+	*input = impl.AddEntryInput{
+		Type:    toInternalEntryType(in.Type),
+		Content: in.Content,
+		Tags:    in.Tags,
+		Public:  in.Public,
+	}
+	return nil
+}
+
+func (a extensionAdapter) BeforeUpdate(current impl.Entry, input *impl.UpdateEntryInput) error {
+	in := UpdateEntryInput{Content: input.Content, Tags: input.Tags}
+	if err := a.ext.BeforeUpdate(fromInternalEntry(current), &in); err != nil {
+		return err
+	}
+	*input = impl.UpdateEntryInput{Content: in.Content, Tags: in.Tags}
+	return nil
+}
+
+func (a extensionAdapter) AfterMerge(changes []impl.MergeChange) {
+	out := make([]MergeChange, len(changes))
+	for i, change := range changes {
+		out[i] = MergeChange{Type: EventType(change.Type), Entry: fromInternalEntry(change.Entry)}
+	}
+	a.ext.AfterMerge(out)
+}
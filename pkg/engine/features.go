@@ -8,7 +8,9 @@ import (
 	"github.com/amaydixit11/acorde/internal/hooks"
 	"github.com/amaydixit11/acorde/internal/importer"
 	"github.com/amaydixit11/acorde/internal/query"
+	"github.com/amaydixit11/acorde/internal/rules"
 	"github.com/amaydixit11/acorde/internal/schema"
+	"github.com/amaydixit11/acorde/internal/templates"
 	"github.com/amaydixit11/acorde/internal/vault"
 	"github.com/amaydixit11/acorde/internal/version"
 )
@@ -32,6 +34,17 @@ type ValidationResult = schema.ValidationResult
 // ValidationError represents a validation error
 type ValidationError = schema.ValidationError
 
+// StoredSchema is an entry type's JSON schema saved in the vault (see
+// Engine.SaveSchema)
+type StoredSchema = schema.Stored
+
+// SchemaMigrator upgrades entry content written against an older version
+// of a schema (see Engine.RegisterSchemaVersion)
+type SchemaMigrator = schema.Migrator
+
+// SchemaMigratorFunc adapts a function to SchemaMigrator
+type SchemaMigratorFunc = schema.MigratorFunc
+
 // Predefined schemas
 var (
 	TaskSchema       = schema.TaskSchema
@@ -40,6 +53,28 @@ var (
 	CredentialSchema = schema.CredentialSchema
 )
 
+// ========== Auto-Tagging Rules ==========
+
+// Rule adds tags to, and fills in fields of, entries that match its
+// conditions when they are added or updated (see Engine.AddRule)
+type Rule = rules.Rule
+
+// ========== ACL Groups ==========
+
+// Group is a named set of peer IDs that entry ACLs grant access to as a
+// whole (see Engine.CreateGroup and Engine.GrantGroup)
+type Group = acl.Group
+
+// GroupRef returns the ACL reader or writer that stands for a group
+var GroupRef = acl.GroupRef
+
+// ========== Templates ==========
+
+// Template is a named skeleton for new entries: a type, content and tags
+// holding {{variables}} (see Engine.SaveTemplate and
+// Engine.AddFromTemplate)
+type Template = templates.Template
+
 // ========== Versioning & History ==========
 
 // VersionStore manages entry version history
@@ -102,6 +137,20 @@ const (
 	HookEventUpdate = hooks.EventUpdate
 	HookEventDelete = hooks.EventDelete
 	HookEventSync   = hooks.EventSync
+
+	HookEventArchive   = hooks.EventArchive
+	HookEventUnarchive = hooks.EventUnarchive
+
+	HookEventLock   = hooks.EventLock
+	HookEventUnlock = hooks.EventUnlock
+
+	HookEventPeerConnect    = hooks.EventPeerConnect
+	HookEventPeerDisconnect = hooks.EventPeerDisconnect
+	HookEventSyncStart      = hooks.EventSyncStart
+	HookEventSyncFinish     = hooks.EventSyncFinish
+	HookEventSyncFail       = hooks.EventSyncFail
+
+	HookEventWebhookDisabled = hooks.EventWebhookDisabled
 )
 
 // HookCallback is a function called on events
@@ -110,6 +159,19 @@ type HookCallback = hooks.Callback
 // WebhookConfig configures an HTTP webhook
 type WebhookConfig = hooks.WebhookConfig
 
+// WebhookStats describes the deliveries to a webhook (HookManager.Stats)
+type WebhookStats = hooks.WebhookStats
+
+// HookRedaction is how much entry content a webhook receives
+// (WebhookConfig.Redact)
+type HookRedaction = hooks.Redaction
+
+const (
+	RedactMask  = hooks.RedactMask  // Mask fields the schema marks sensitive (default)
+	RedactStrip = hooks.RedactStrip // No content
+	RedactNone  = hooks.RedactNone  // Content as it is
+)
+
 // ========== Import/Export ==========
 
 // Exporter handles exporting entries
@@ -146,6 +208,32 @@ const (
 // ImportResult contains import statistics
 type ImportResult = importer.ImportResult
 
+// PasswordFormat is a password manager export format (see
+// Importer.ImportPasswords)
+type PasswordFormat = importer.PasswordFormat
+
+const (
+	PasswordBitwarden = importer.PasswordBitwarden
+	Password1Password = importer.Password1Password
+	PasswordKeePass   = importer.PasswordKeePass
+)
+
+// CredentialContent is the content of a Credential entry
+type CredentialContent = importer.Credential
+
+// SensitiveFields lists the properties a JSON schema marks
+// "sensitive": true
+var SensitiveFields = schema.SensitiveFields
+
+// MaskFields masks the values of fields in JSON object content
+var MaskFields = schema.MaskFields
+
+// MaskCredential hides the password and TOTP secret of credential
+// content, for display
+func MaskCredential(content []byte) []byte {
+	return schema.MaskCredential(content)
+}
+
 // ========== Multi-Vault ==========
 
 // VaultManager manages multiple vaults
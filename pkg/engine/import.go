@@ -0,0 +1,225 @@
+package engine
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"slices"
+
+	"github.com/amaydixit11/acorde/internal/importer"
+	"github.com/google/uuid"
+)
+
+// ExportFilter selects entries by type, tag and creation date range for
+// export and import (see Exporter.Filter and Importer.Filter)
+type ExportFilter = importer.Filter
+
+// CollisionPolicy decides what ImportEntries does with an imported entry
+// that is already in the vault, by ID or by content
+type CollisionPolicy string
+
+const (
+	CollisionSkip      CollisionPolicy = "skip"       // Keep the vault's entry (default)
+	CollisionOverwrite CollisionPolicy = "overwrite"  // Replace its content and tags
+	CollisionMergeTags CollisionPolicy = "merge-tags" // Add the import's tags to it
+	CollisionDuplicate CollisionPolicy = "duplicate"  // Add the import as a new entry anyway
+)
+
+// ImportOptions configures ImportEntries
+type ImportOptions struct {
+	Filter      ExportFilter    // Entries to import (zero = all)
+	OnCollision CollisionPolicy // Entries whose ID is in the vault; "" = CollisionSkip
+	OnDuplicate CollisionPolicy // Other entries whose type and content are in the vault; "" = CollisionSkip
+	DryRun      bool            // Count what would happen without changing the vault
+}
+
+// ExportEntries returns the vault's entries, archived ones included, that
+// pass filter, ready for an Exporter
+func ExportEntries(e Engine, filter ExportFilter) ([]ExportEntry, error) {
+	listFilter := ListFilter{Archived: true}
+	if len(filter.Types) == 1 {
+		t := EntryType(filter.Types[0])
+		listFilter.Type = &t
+	}
+	if len(filter.Tags) == 1 {
+		listFilter.Tag = &filter.Tags[0]
+	}
+	entries, err := e.ListEntries(listFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	export := make([]ExportEntry, len(entries))
+	for i, entry := range entries {
+		export[i] = ExportEntry{
+			ID:        entry.ID.String(),
+			Type:      string(entry.Type),
+			Content:   string(entry.Content),
+			Tags:      entry.Tags,
+			CreatedAt: entry.CreatedAt,
+			UpdatedAt: entry.UpdatedAt,
+			Created:   entry.CreatedTime,
+			Updated:   entry.UpdatedTime,
+		}
+	}
+	return filter.Apply(export), nil
+}
+
+// ImportEntries adds entries that pass opts.Filter to the vault, in bulk
+// mode. Imported entries get new IDs. An entry whose ID is already in the
+// vault is handled by opts.OnCollision; otherwise one whose type and
+// content match a vault entry (or an entry imported before it) is handled
+// by opts.OnDuplicate. Entries that fail are counted and reported in the
+// result rather than stopping the import.
+func ImportEntries(e Engine, entries []ExportEntry, opts ImportOptions) (ImportResult, error) {
+	onCollision, err := collisionPolicy(opts.OnCollision)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	onDuplicate, err := collisionPolicy(opts.OnDuplicate)
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	result := ImportResult{TotalRead: len(entries)}
+	selected := opts.Filter.Apply(entries)
+	result.Skipped = len(entries) - len(selected)
+	if len(selected) == 0 {
+		return result, nil
+	}
+
+	existing, err := e.ListEntries(ListFilter{Archived: true})
+	if err != nil {
+		return result, err
+	}
+	byContent := make(map[contentKey]uuid.UUID, len(existing))
+	for _, entry := range existing {
+		byContent[keyOf(entry.Type, entry.Content)] = entry.ID
+	}
+
+	fail := func(entry ExportEntry, err error) {
+		result.Failed++
+		result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", entry.ID, err))
+	}
+
+	// resolve applies a policy to an imported entry matching the vault
+	// entry id. It reports whether the entry is done with.
+	resolve := func(b Batch, entry ExportEntry, id uuid.UUID, policy CollisionPolicy) bool {
+		switch policy {
+		case CollisionSkip:
+			result.Skipped++
+		case CollisionOverwrite, CollisionMergeTags:
+			var err error
+			if !opts.DryRun {
+				err = mergeEntry(e, b, id, entry, policy)
+			}
+			if err != nil {
+				fail(entry, err)
+			} else if policy == CollisionOverwrite {
+				result.Imported++
+			} else {
+				result.Merged++
+			}
+		default:
+			return false
+		}
+		return true
+	}
+
+	err = e.Bulk(func(b Batch) error {
+		for _, entry := range selected {
+			entryType := EntryType(entry.Type)
+			if !entryType.IsValid() {
+				fail(entry, ErrInvalidType{Type: entry.Type})
+				continue
+			}
+
+			key := keyOf(entryType, []byte(entry.Content))
+			if id, ok := existingID(e, entry.ID); ok {
+				result.MatchedByID++
+				if resolve(b, entry, id, onCollision) {
+					continue
+				}
+			} else if id, ok := byContent[key]; ok {
+				result.MatchedByContent++
+				if resolve(b, entry, id, onDuplicate) {
+					continue
+				}
+			}
+
+			id := uuid.Nil
+			if !opts.DryRun {
+				added, err := b.AddEntry(AddEntryInput{Type: entryType, Content: []byte(entry.Content), Tags: entry.Tags})
+				if err != nil {
+					fail(entry, err)
+					continue
+				}
+				id = added.ID
+			}
+			if _, ok := byContent[key]; !ok {
+				byContent[key] = id
+			}
+			result.Imported++
+		}
+		return nil
+	})
+	return result, err
+}
+
+// collisionPolicy checks a policy, defaulting to CollisionSkip
+func collisionPolicy(policy CollisionPolicy) (CollisionPolicy, error) {
+	switch policy {
+	case "":
+		return CollisionSkip, nil
+	case CollisionSkip, CollisionOverwrite, CollisionMergeTags, CollisionDuplicate:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown collision policy %q (use skip, overwrite, merge-tags or duplicate)", policy)
+}
+
+// contentKey identifies entries with the same type and content
+type contentKey struct {
+	Type EntryType
+	Hash [sha256.Size]byte
+}
+
+func keyOf(entryType EntryType, content []byte) contentKey {
+	return contentKey{Type: entryType, Hash: sha256.Sum256(content)}
+}
+
+// mergeEntry overwrites the vault entry id with an imported entry, or adds
+// the imported entry's tags to it
+func mergeEntry(e Engine, b Batch, id uuid.UUID, entry ExportEntry, policy CollisionPolicy) error {
+	if policy == CollisionOverwrite {
+		content, tags := []byte(entry.Content), entry.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+		return b.UpdateEntry(id, UpdateEntryInput{Content: &content, Tags: &tags})
+	}
+
+	current, err := e.GetEntry(id)
+	if err != nil {
+		return err
+	}
+	tags := slices.Clone(current.Tags)
+	for _, tag := range entry.Tags {
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) == len(current.Tags) {
+		return nil
+	}
+	return b.UpdateEntry(id, UpdateEntryInput{Tags: &tags})
+}
+
+// existingID parses an imported entry's ID and reports whether the vault
+// has an entry with it
+func existingID(e Engine, s string) (uuid.UUID, bool) {
+	id, err := uuid.Parse(s)
+	if err != nil {
+		return uuid.Nil, false
+	}
+	_, err = e.GetEntry(id)
+	return id, err == nil
+}
@@ -2,9 +2,11 @@ package engine
 
 import (
 	"fmt"
-	"regexp"
-	"strconv"
+	"sort"
 	"strings"
+
+	"github.com/amaydixit11/acorde/internal/query"
+	"github.com/google/uuid"
 )
 
 // QueryResult contains the result of a query
@@ -17,86 +19,182 @@ type QueryResult struct {
 // Query syntax:
 //   type = "note"
 //   tags CONTAINS "work"
+//   NOT tag = "archived"
+//   (type = "note" OR type = "log") AND tag = "work"
+//   type IN ("note", "log")
+//   content LIKE "%meeting%"
 //   created_at > 1700000000
 //   ORDER BY updated_at DESC
-//   LIMIT 20
+//   LIMIT 20 OFFSET 40
+//
+// Invalid syntax or unknown fields return an error.
 func (w *engineWrapper) Query(q string) (QueryResult, error) {
-	filter, err := parseQuery(q)
+	parsed, err := parseQuery(q)
 	if err != nil {
 		return QueryResult{}, err
 	}
 
+	// Deleted entries are only considered when the query asks about them
+	filter, paged := storeQueryFilter(parsed)
 	entries, err := w.ListEntries(filter)
 	if err != nil {
 		return QueryResult{}, err
 	}
 
+	var matched []Entry
+	for _, entry := range entries {
+		if parsed.Match(toQueryRecord(entry)) {
+			matched = append(matched, entry)
+		}
+	}
+
+	if !paged {
+		sortEntries(matched, parsed.OrderBy)
+
+		if parsed.Offset > 0 {
+			if parsed.Offset >= len(matched) {
+				matched = nil
+			} else {
+				matched = matched[parsed.Offset:]
+			}
+		}
+		if parsed.Limit > 0 && parsed.Limit < len(matched) {
+			matched = matched[:parsed.Limit]
+		}
+	}
+
 	return QueryResult{
-		Entries: entries,
-		Count:   len(entries),
+		Entries: matched,
+		Count:   len(matched),
 	}, nil
 }
 
-// parseQuery parses a simple query string into a ListFilter
-func parseQuery(q string) (ListFilter, error) {
-	filter := ListFilter{}
-
-	// Normalize whitespace
-	q = strings.TrimSpace(q)
-	if q == "" {
-		return filter, nil
+// DeleteQuery deletes the live entries a query matches. ORDER BY, LIMIT
+// and OFFSET pick which of them, as in Query.
+func (w *engineWrapper) DeleteQuery(q string) (int, error) {
+	result, err := w.Query(q)
+	if err != nil {
+		return 0, err
 	}
+	ids := make([]uuid.UUID, 0, len(result.Entries))
+	for _, entry := range result.Entries {
+		if !entry.Deleted {
+			ids = append(ids, entry.ID)
+		}
+	}
+	return w.DeleteEntries(ids)
+}
 
-	// Parse LIMIT
-	limitRe := regexp.MustCompile(`(?i)LIMIT\s+(\d+)`)
-	if m := limitRe.FindStringSubmatch(q); len(m) > 1 {
-		limit, _ := strconv.Atoi(m[1])
-		filter.Limit = limit
-		q = limitRe.ReplaceAllString(q, "")
+// parseQuery parses a query string, wrapping syntax errors in
+// ErrInvalidQuery
+func parseQuery(q string) (*query.Query, error) {
+	parsed, err := query.NewParser().Parse(q)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidQuery, err)
 	}
+	return parsed, nil
+}
 
-	// Parse ORDER BY (ignored for now, just remove it)
-	orderRe := regexp.MustCompile(`(?i)ORDER\s+BY\s+\w+(\s+(ASC|DESC))?`)
-	q = orderRe.ReplaceAllString(q, "")
+// storeQueryFilter returns the ListFilter that loads the entries a query
+// is evaluated against, narrowed by the type and tag every match must
+// have. When those are the whole WHERE clause and storage can order as
+// ORDER BY asks, LIMIT and OFFSET are applied by storage too, and paged
+// is true.
+func storeQueryFilter(parsed *query.Query) (filter ListFilter, paged bool) {
+	filter.Deleted = parsed.ReferencesField(query.FieldDeleted)
 
-	// Parse conditions
-	conditions := strings.Split(q, "AND")
-	for _, cond := range conditions {
-		cond = strings.TrimSpace(cond)
-		if cond == "" {
-			continue
+	pushdown := parsed.Pushdown()
+	if pushdown.Type != nil {
+		entryType := EntryType(*pushdown.Type)
+		if !entryType.IsValid() {
+			// Nothing matches: let the evaluator find that out
+			return filter, false
 		}
+		filter.Type = &entryType
+	}
+	filter.Tag = pushdown.Tag
 
-		// type = "note"
-		if m := regexp.MustCompile(`(?i)type\s*=\s*["']?(\w+)["']?`).FindStringSubmatch(cond); len(m) > 1 {
-			entryType := EntryType(m[1])
-			filter.Type = &entryType
-			continue
+	if !pushdown.Exact || len(parsed.OrderBy) > 1 {
+		return filter, false
+	}
+	if len(parsed.OrderBy) == 1 {
+		switch parsed.OrderBy[0].Field {
+		case query.FieldCreatedAt:
+			filter.Sort = SortCreatedAt
+		case query.FieldUpdatedAt:
+			filter.Sort = SortUpdatedAt
+		default:
+			return filter, false
 		}
+		filter.Ascending = !parsed.OrderBy[0].Desc
+	}
+	filter.Limit, filter.Offset = parsed.Limit, parsed.Offset
+	return filter, true
+}
 
-		// tags CONTAINS "work"
-		if m := regexp.MustCompile(`(?i)tags\s+CONTAINS\s+["']?(\w+)["']?`).FindStringSubmatch(cond); len(m) > 1 {
-			tag := m[1]
-			filter.Tag = &tag
-			continue
-		}
+// toQueryRecord converts an entry into the record form the query evaluator uses
+func toQueryRecord(e Entry) query.Record {
+	return query.Record{
+		ID:        e.ID.String(),
+		Type:      string(e.Type),
+		Tags:      e.Tags,
+		Content:   e.Content,
+		CreatedAt: e.CreatedAt,
+		UpdatedAt: e.UpdatedAt,
+		Deleted:   e.Deleted,
+	}
+}
 
-		// created_at > 1700000000
-		if m := regexp.MustCompile(`(?i)created_at\s*>\s*(\d+)`).FindStringSubmatch(cond); len(m) > 1 {
-			ts, _ := strconv.ParseUint(m[1], 10, 64)
-			filter.Since = &ts
-			continue
+// sortEntries orders entries by the ORDER BY clauses (storage order if none)
+func sortEntries(entries []Entry, order []query.OrderClause) {
+	if len(order) == 0 {
+		return
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		for _, o := range order {
+			cmp := compareEntryField(entries[i], entries[j], o.Field)
+			if cmp == 0 {
+				continue
+			}
+			if o.Desc {
+				return cmp > 0
+			}
+			return cmp < 0
 		}
+		return false
+	})
+}
 
-		// updated_at < 1700000000
-		if m := regexp.MustCompile(`(?i)updated_at\s*<\s*(\d+)`).FindStringSubmatch(cond); len(m) > 1 {
-			ts, _ := strconv.ParseUint(m[1], 10, 64)
-			filter.Until = &ts
-			continue
+func compareEntryField(a, b Entry, field string) int {
+	switch field {
+	case query.FieldCreatedAt:
+		return compareUint64(a.CreatedAt, b.CreatedAt)
+	case query.FieldUpdatedAt:
+		return compareUint64(a.UpdatedAt, b.UpdatedAt)
+	case query.FieldType:
+		return strings.Compare(string(a.Type), string(b.Type))
+	case query.FieldID:
+		return strings.Compare(a.ID.String(), b.ID.String())
+	case query.FieldDeleted:
+		if a.Deleted == b.Deleted {
+			return 0
 		}
+		if a.Deleted {
+			return 1
+		}
+		return -1
 	}
+	return 0
+}
 
-	return filter, nil
+func compareUint64(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
 }
 
 // QueryBuilder provides a fluent API for building queries
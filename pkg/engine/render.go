@@ -0,0 +1,58 @@
+package engine
+
+import (
+	"strings"
+
+	"github.com/amaydixit11/acorde/internal/markdown"
+	"github.com/amaydixit11/acorde/internal/search"
+	"github.com/google/uuid"
+)
+
+// RenderOptions configures RenderMarkdown: WikiLink resolves [[target]]
+// links to hrefs and Highlight marks up the syntax of fenced code
+type RenderOptions = markdown.Options
+
+// RenderMarkdown converts Markdown note content to HTML. Raw HTML is
+// escaped and links with unsafe schemes are dropped, so the result is
+// safe to embed as it is.
+func RenderMarkdown(content []byte, opts RenderOptions) string {
+	return markdown.Render(content, opts)
+}
+
+// ExtractTitle returns the title of note content: its first non-empty
+// line, without Markdown heading markers
+func ExtractTitle(content []byte) string {
+	return search.ExtractTitle(content)
+}
+
+// ResolveWikiLink finds the entry a [[target]] wiki link refers to: the
+// entry with that ID, or else one titled target, case-insensitively
+func ResolveWikiLink(e Engine, target string) (uuid.UUID, bool) {
+	return ResolveWikiLinkWhere(e, target, nil)
+}
+
+// ResolveWikiLinkWhere is ResolveWikiLink among the entries keep accepts
+// (nil = all), e.g. those of one namespace
+func ResolveWikiLinkWhere(e Engine, target string, keep func(uuid.UUID) bool) (uuid.UUID, bool) {
+	if keep == nil {
+		keep = func(uuid.UUID) bool { return true }
+	}
+	target = strings.TrimSpace(target)
+	if id, err := uuid.Parse(target); err == nil {
+		if _, err := e.GetEntry(id); err == nil && keep(id) {
+			return id, true
+		}
+		return uuid.Nil, false
+	}
+
+	matches, err := e.QuickOpen(target, 0)
+	if err != nil {
+		return uuid.Nil, false
+	}
+	for _, m := range matches {
+		if strings.EqualFold(m.Title, target) && keep(m.ID) {
+			return m.ID, true
+		}
+	}
+	return uuid.Nil, false
+}
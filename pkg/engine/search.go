@@ -1,30 +1,123 @@
 package engine
 
 import (
+	"errors"
 	"strings"
 
+	impl "github.com/amaydixit11/acorde/internal/engine"
 	"github.com/amaydixit11/acorde/internal/search"
 )
 
+// SearchMode selects how search terms are matched
+type SearchMode = search.Mode
+
+// Search modes
+const (
+	SearchExact  SearchMode = search.ModeExact  // Whole (analyzed) terms
+	SearchPrefix SearchMode = search.ModePrefix // "meet" matches "meeting"
+	SearchFuzzy  SearchMode = search.ModeFuzzy  // "meetng" matches "meeting"
+)
+
 // SearchOptions for full-text search
 type SearchOptions struct {
-	Type  *EntryType
-	Limit int
-	Fuzzy bool // Currently ignored, Bleve does fuzzy by default
+	Type   *EntryType
+	Tags   []string // Only entries carrying all of these tags
+	Limit  int
+	Offset int
+	Facets bool       // Compute facet counts by type, tag and month
+	Mode   SearchMode // Term matching mode (default exact)
+	Fuzzy  bool       // Shorthand for Mode: SearchFuzzy
+
+	Archived bool // Include archived entries
 }
 
+// QuickOpenResult is a quick-open match: the entry's title and metadata
+// with a relevance score (higher is better)
+type QuickOpenResult = search.TitleMatch
+
 // SearchResult represents search results
 type SearchResult struct {
-	Entries []Entry
-	Count   int
+	Entries []Entry       `json:"entries"`
+	Count   int           `json:"count"`
+	Total   int           `json:"total"`            // Matches ignoring Limit/Offset
+	Facets  *SearchFacets `json:"facets,omitempty"` // Set when SearchOptions.Facets is true
 }
 
-// Search performs full-text search on entry content using Bleve.
+// SearchFacets contains facet counts over all matches of a search
+type SearchFacets struct {
+	Types  []FacetCount `json:"types"`
+	Tags   []FacetCount `json:"tags"`
+	Months []FacetCount `json:"months"` // YYYY-MM the entry was first saved
+}
+
+// FacetCount is the number of matches for one facet term
+type FacetCount = search.FacetCount
+
+// Search performs full-text search on entries using the engine's Bleve index.
+// The query supports field scoping, e.g. tag:work content:"meeting notes";
+// bare terms match content and tags. All terms must match unless prefixed with -.
 func (w *engineWrapper) Search(query string, opts SearchOptions) (SearchResult, error) {
-	// For in-memory engines or when Bleve not available, fall back to substring
+	indexOpts := search.SearchOptions{
+		Tags:   opts.Tags,
+		Limit:  opts.Limit,
+		Offset: opts.Offset,
+		Facets: opts.Facets,
+		Mode:   opts.Mode,
+
+		Archived: opts.Archived,
+	}
+	if opts.Fuzzy {
+		indexOpts.Mode = SearchFuzzy
+	}
+	if opts.Type != nil {
+		indexOpts.Type = string(*opts.Type)
+	}
+
+	results, err := w.impl.Search(query, indexOpts)
+	if errors.Is(err, impl.ErrSearchDisabled) {
+		return w.substringSearch(query, opts)
+	}
+	if err != nil {
+		return SearchResult{}, err
+	}
+
+	matched := make([]Entry, 0, len(results.Hits))
+	for _, hit := range results.Hits {
+		entry, err := w.GetEntry(hit.ID)
+		if err != nil {
+			continue // Deleted or not readable
+		}
+		matched = append(matched, entry)
+	}
+
+	result := SearchResult{
+		Entries: matched,
+		Count:   len(matched),
+		Total:   int(results.Total),
+	}
+	if opts.Facets {
+		result.Facets = &SearchFacets{
+			Types:  results.Facets[search.FacetType],
+			Tags:   results.Facets[search.FacetTag],
+			Months: results.Facets[search.FacetMonth],
+		}
+	}
+	return result, nil
+}
+
+// QuickOpen fuzzy-matches entry titles (first line of content), types and
+// tags for a quick-open palette, e.g. "mtg nts" matches "Meeting notes".
+// limit <= 0 returns all matches.
+func (w *engineWrapper) QuickOpen(query string, limit int) ([]QuickOpenResult, error) {
+	return w.impl.QuickOpen(query, limit), nil
+}
+
+// substringSearch is used when the search index is disabled
+func (w *engineWrapper) substringSearch(query string, opts SearchOptions) (SearchResult, error) {
 	entries, err := w.ListEntries(ListFilter{
-		Type:  opts.Type,
-		Limit: 0, // Get all, then filter
+		Type:     opts.Type,
+		Limit:    0, // Get all, then filter
+		Archived: opts.Archived,
 	})
 	if err != nil {
 		return SearchResult{}, err
@@ -34,21 +127,50 @@ func (w *engineWrapper) Search(query string, opts SearchOptions) (SearchResult,
 	query = strings.ToLower(query)
 	var matched []Entry
 	for _, e := range entries {
+		if !hasAllTags(e.Tags, opts.Tags) {
+			continue
+		}
 		content := strings.ToLower(string(e.Content))
 		if strings.Contains(content, query) {
 			matched = append(matched, e)
-			if opts.Limit > 0 && len(matched) >= opts.Limit {
-				break
-			}
 		}
 	}
 
+	total := len(matched)
+	if opts.Offset > 0 {
+		if opts.Offset >= len(matched) {
+			matched = nil
+		} else {
+			matched = matched[opts.Offset:]
+		}
+	}
+	if opts.Limit > 0 && opts.Limit < len(matched) {
+		matched = matched[:opts.Limit]
+	}
+
 	return SearchResult{
 		Entries: matched,
 		Count:   len(matched),
+		Total:   total,
 	}, nil
 }
 
+func hasAllTags(tags, required []string) bool {
+	for _, r := range required {
+		found := false
+		for _, t := range tags {
+			if t == r {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
 // SearchWithBleve performs full-text search using a Bleve index.
 // The index must be created and maintained separately.
 func SearchWithBleve(idx *search.Index, query string, opts SearchOptions) ([]search.SearchResult, error) {
@@ -18,6 +18,7 @@ if ! command -v gcc >/dev/null 2>&1; then
     echo "   Ubuntu/Debian: sudo apt install build-essential"
     echo "   Fedora: sudo dnf groupinstall \"Development Tools\""
     echo "   macOS: xcode-select --install"
+    echo "   Windows: install MinGW-w64 (e.g. pacman -S mingw-w64-x86_64-gcc in MSYS2)"
     exit 1
 fi
 
@@ -28,7 +29,8 @@ mkdir -p build
 
 # Build
 echo "🚀 Compiling..."
-go build -ldflags="-s -w" -o build/acorde ./cmd/acorde
+BINARY="build/acorde$(go env GOEXE)" # acorde.exe on Windows
+go build -tags sqlite_fts5 -ldflags="-s -w" -o "$BINARY" ./cmd/acorde
 
-echo "✅ Build success! Binary is at: build/acorde"
-echo "   Run with: ./build/acorde daemon"
+echo "✅ Build success! Binary is at: $BINARY"
+echo "   Run with: ./$BINARY daemon"
@@ -0,0 +1,310 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/amaydixit11/acorde/internal/core"
+	"github.com/amaydixit11/acorde/internal/crdt"
+	"github.com/amaydixit11/acorde/internal/engine"
+	"github.com/amaydixit11/acorde/internal/sharing"
+	"github.com/amaydixit11/acorde/pkg/crypto"
+	"github.com/google/uuid"
+)
+
+// simulation drives several full engines (SQLite storage, encryption,
+// versioning, ACLs, per-entry sharing) with random operations and syncs
+type simulation struct {
+	t       *testing.T
+	rng     *rand.Rand
+	engines []engine.Engine
+	peers   []string           // Peer ID of each engine
+	devices map[string][]byte  // Peer ID → device public key
+	entries []uuid.UUID        // Every entry created so far
+	owners  map[uuid.UUID]int  // Entry → index of the creating engine
+	writers map[uuid.UUID]bool // Entries granted to all engines
+}
+
+// newSimulation opens n engines sharing a vault key, each with its own
+// data directory (and so its own peer ID and device key)
+func newSimulation(t *testing.T, rng *rand.Rand, n int) *simulation {
+	key, _ := crypto.GenerateKey()
+	sim := &simulation{
+		t:       t,
+		rng:     rng,
+		devices: make(map[string][]byte),
+		owners:  make(map[uuid.UUID]int),
+		writers: make(map[uuid.UUID]bool),
+	}
+	resolve := func(peerID string) ([]byte, error) {
+		if key, ok := sim.devices[peerID]; ok {
+			return key, nil
+		}
+		return nil, fmt.Errorf("unknown peer %s", peerID)
+	}
+
+	for i := 0; i < n; i++ {
+		dir := t.TempDir()
+		peerID := fmt.Sprintf("peer-%d", i)
+		if err := os.WriteFile(filepath.Join(dir, "node_id"), []byte(peerID), 0644); err != nil {
+			t.Fatalf("failed to write node ID: %v", err)
+		}
+		device, err := sharing.LoadOrCreateKeyPair(filepath.Join(dir, "device.key"))
+		if err != nil {
+			t.Fatalf("failed to create device key: %v", err)
+		}
+		sim.devices[peerID] = device.Public[:]
+
+		e, err := engine.New(engine.Config{
+			DataDir:       dir,
+			EncryptionKey: &key,
+			DisableSearch: true,
+			PeerKeys:      resolve,
+		})
+		if err != nil {
+			t.Fatalf("failed to create engine %d: %v", i, err)
+		}
+		t.Cleanup(func() { e.Close() })
+		sim.engines = append(sim.engines, e)
+		sim.peers = append(sim.peers, peerID)
+	}
+	return sim
+}
+
+// randomTags picks up to three tags from a small alphabet so tag sets
+// collide across engines
+func (s *simulation) randomTags() []string {
+	tags := []string{}
+	for i := s.rng.Intn(4); i > 0; i-- {
+		tags = append(tags, "t"+strconv.Itoa(s.rng.Intn(5)))
+	}
+	return tags
+}
+
+// step performs one random operation on a random engine
+func (s *simulation) step() {
+	i := s.rng.Intn(len(s.engines))
+	e := s.engines[i]
+
+	op := s.rng.Intn(100)
+	if len(s.entries) == 0 {
+		op = 0
+	}
+	var id uuid.UUID
+	if len(s.entries) > 0 {
+		id = s.entries[s.rng.Intn(len(s.entries))]
+	}
+
+	switch {
+	case op < 25: // Add
+		entry, err := e.AddEntry(engine.AddEntryInput{
+			Type:    core.Note,
+			Content: []byte(fmt.Sprintf("note %d from %s", s.rng.Int(), s.peers[i])),
+			Tags:    s.randomTags(),
+		})
+		if err != nil {
+			s.t.Fatalf("add on %s failed: %v", s.peers[i], err)
+		}
+		s.entries = append(s.entries, entry.ID)
+		s.owners[entry.ID] = i
+	case op < 45: // Update content
+		content := []byte(fmt.Sprintf("edit %d by %s", s.rng.Int(), s.peers[i]))
+		s.update(i, id, engine.UpdateEntryInput{Content: &content})
+	case op < 60: // Update tags
+		tags := s.randomTags()
+		s.update(i, id, engine.UpdateEntryInput{Tags: &tags})
+	case op < 67: // Delete
+		if _, err := e.GetEntry(id); err != nil {
+			break // Not synced here yet, or deleted
+		}
+		if allowed, _ := e.ACL().CheckWrite(id, s.peers[i]); !allowed {
+			break // Write grant not received yet
+		}
+		if err := e.DeleteEntry(id); err != nil {
+			s.t.Fatalf("delete on %s failed: %v", s.peers[i], err)
+		}
+	case op < 75: // Owner lets every engine write the entry
+		if s.owners[id] == i && !s.writers[id] {
+			s.grantWrite(i, id)
+		}
+	case op < 80: // Owner shares the entry with another engine
+		if s.owners[id] == i {
+			if _, err := e.GetEntry(id); err == nil {
+				to := s.peers[s.rng.Intn(len(s.peers))]
+				if err := e.ShareEntry(id, []string{to}); err != nil {
+					s.t.Fatalf("share on %s failed: %v", s.peers[i], err)
+				}
+			}
+		}
+	default: // One-way sync to another engine
+		s.sync(i, s.rng.Intn(len(s.engines)))
+	}
+}
+
+// update applies an update where the engine holds the entry and, as far
+// as it knows, may write it
+func (s *simulation) update(i int, id uuid.UUID, input engine.UpdateEntryInput) {
+	e := s.engines[i]
+	if _, err := e.GetEntry(id); err != nil {
+		return // Not synced here yet, or deleted
+	}
+	if allowed, _ := e.ACL().CheckWrite(id, s.peers[i]); !allowed {
+		return // Write grant not received yet
+	}
+	if err := e.UpdateEntry(id, input); err != nil {
+		s.t.Fatalf("update on %s failed: %v", s.peers[i], err)
+	}
+}
+
+// grantWrite adds every engine as a writer through the owner's replica,
+// so the grant syncs like any ACL change
+func (s *simulation) grantWrite(owner int, id uuid.UUID) {
+	e := s.engines[owner]
+	payload, _ := e.GetSyncPayload()
+	var state crdt.ReplicaState
+	if err := json.Unmarshal(payload, &state); err != nil {
+		s.t.Fatalf("failed to decode state: %v", err)
+	}
+	acl, ok := state.ACLs[id]
+	if !ok {
+		return
+	}
+	acl.Writers = append([]string(nil), s.peers...)
+	acl.Timestamp = state.ClockTime + 1
+
+	grant, _ := json.Marshal(crdt.ReplicaState{
+		ACLs:      map[uuid.UUID]core.ACL{id: acl},
+		ClockTime: acl.Timestamp,
+	})
+	if _, err := e.MergeRemotePayloadFrom(s.peers[owner], grant); err != nil {
+		s.t.Fatalf("grant failed: %v", err)
+	}
+	s.writers[id] = true
+}
+
+// sync sends engine from's state to engine to, as a sync session would:
+// from is the authenticated sender
+func (s *simulation) sync(from, to int) {
+	if from == to {
+		return
+	}
+	payload, err := s.engines[from].GetSyncPayload()
+	if err != nil {
+		s.t.Fatalf("payload from %s failed: %v", s.peers[from], err)
+	}
+	if _, err := s.engines[to].MergeRemotePayloadFrom(s.peers[from], payload); err != nil {
+		s.t.Fatalf("sync %s -> %s failed: %v", s.peers[from], s.peers[to], err)
+	}
+}
+
+// syncAll propagates every change to every engine: each engine sends its
+// state to every other, in random order. Relaying isn't enough, as a peer
+// only takes ACL changes from the owner and writes from writers.
+func (s *simulation) syncAll() {
+	for _, from := range s.rng.Perm(len(s.engines)) {
+		for _, to := range s.rng.Perm(len(s.engines)) {
+			s.sync(from, to)
+		}
+	}
+}
+
+// snapshot serializes what an application sees: every entry (decrypted,
+// including tombstones) and every ACL, in a canonical order
+func (s *simulation) snapshot(i int) []byte {
+	e := s.engines[i]
+	entries, err := e.ListEntries(engine.ListFilter{Deleted: true})
+	if err != nil {
+		s.t.Fatalf("list on %s failed: %v", s.peers[i], err)
+	}
+	for k := range entries {
+		sort.Strings(entries[k].Tags)
+	}
+	sort.Slice(entries, func(a, b int) bool { return entries[a].ID.String() < entries[b].ID.String() })
+
+	acls, err := e.ACL().List()
+	if err != nil {
+		s.t.Fatalf("ACL list on %s failed: %v", s.peers[i], err)
+	}
+	for k := range acls {
+		sort.Strings(acls[k].Readers)
+		sort.Strings(acls[k].Writers)
+	}
+	sort.Slice(acls, func(a, b int) bool { return acls[a].EntryID.String() < acls[b].EntryID.String() })
+
+	data, err := json.Marshal(struct {
+		Entries []engine.Entry
+		ACLs    []core.ACL
+	}{entries, acls})
+	if err != nil {
+		s.t.Fatalf("failed to encode snapshot: %v", err)
+	}
+	return data
+}
+
+// TestEngineConvergence runs random operations and syncs on several
+// engines and checks that, once every change has propagated, all of them
+// expose byte-identical entries and ACLs. Set ACORDE_SIM_SEED to replay a
+// failing run.
+func TestEngineConvergence(t *testing.T) {
+	seed := time.Now().UnixNano()
+	if env := os.Getenv("ACORDE_SIM_SEED"); env != "" {
+		seed, _ = strconv.ParseInt(env, 10, 64)
+	}
+	t.Logf("Convergence Seed: %d", seed)
+	rng := rand.New(rand.NewSource(seed))
+
+	runs, steps := 4, 150
+	if testing.Short() {
+		runs, steps = 1, 50
+	}
+	for run := 0; run < runs; run++ {
+		sim := newSimulation(t, rng, 3+rng.Intn(2))
+		for k := 0; k < steps; k++ {
+			sim.step()
+		}
+		sim.syncAll()
+
+		want := sim.snapshot(0)
+		for i := 1; i < len(sim.engines); i++ {
+			if got := sim.snapshot(i); !bytes.Equal(got, want) {
+				t.Fatalf("run %d: %s diverged from %s: %s", run, sim.peers[i], sim.peers[0], firstDifference(want, got))
+			}
+		}
+	}
+}
+
+// firstDifference describes the first entry or ACL that differs between
+// two snapshots
+func firstDifference(a, b []byte) string {
+	var sa, sb struct {
+		Entries []json.RawMessage
+		ACLs    []json.RawMessage
+	}
+	json.Unmarshal(a, &sa)
+	json.Unmarshal(b, &sb)
+	if len(sa.Entries) != len(sb.Entries) {
+		return fmt.Sprintf("%d entries vs %d", len(sa.Entries), len(sb.Entries))
+	}
+	for k := range sa.Entries {
+		if !bytes.Equal(sa.Entries[k], sb.Entries[k]) {
+			return fmt.Sprintf("entry\n  %s\nvs\n  %s", sa.Entries[k], sb.Entries[k])
+		}
+	}
+	if len(sa.ACLs) != len(sb.ACLs) {
+		return fmt.Sprintf("%d ACLs vs %d", len(sa.ACLs), len(sb.ACLs))
+	}
+	for k := range sa.ACLs {
+		if !bytes.Equal(sa.ACLs[k], sb.ACLs[k]) {
+			return fmt.Sprintf("ACL\n  %s\nvs\n  %s", sa.ACLs[k], sb.ACLs[k])
+		}
+	}
+	return "snapshots differ"
+}
@@ -0,0 +1,61 @@
+package integration
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/amaydixit11/acorde/internal/core"
+	"github.com/amaydixit11/acorde/internal/engine"
+	"github.com/amaydixit11/acorde/internal/sync"
+	"github.com/amaydixit11/acorde/internal/sync/synctest"
+)
+
+// TestSyncProtocolConvergence syncs full engines over the sync protocol
+// (hash exchange, format negotiation, chunked states) rather than by
+// handing payloads across
+func TestSyncProtocolConvergence(t *testing.T) {
+	sim := newSimulation(t, rand.New(rand.NewSource(1)), 3)
+	providers := make([]sync.StateProvider, len(sim.engines))
+	for i, e := range sim.engines {
+		providers[i] = synctest.EngineProvider{Engine: e}
+	}
+	cfg := sync.DefaultConfig()
+	cfg.StateBudget = 1024 // Stream states in several chunks
+	cluster := synctest.NewWithConfig(t, cfg, providers...)
+
+	for i, e := range sim.engines {
+		for k := 0; k < 5; k++ {
+			if _, err := e.AddEntry(engine.AddEntryInput{Type: core.Note, Content: []byte(sim.peers[i]), Tags: []string{"synced"}}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	cluster.Converge(3)
+
+	// An edit made while partitioned reaches everyone once healed
+	cluster.Partition([]int{0}, []int{1, 2})
+	entries, err := sim.engines[0].ListEntries(engine.ListFilter{})
+	if err != nil || len(entries) != 15 {
+		t.Fatalf("expected 15 entries, got %d (%v)", len(entries), err)
+	}
+	if err := sim.engines[0].DeleteEntry(entries[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := cluster.Round(); err != nil {
+		t.Fatal(err)
+	}
+	if cluster.Converged() {
+		t.Fatal("expected the partition to hold back the deletion")
+	}
+	cluster.Heal()
+	cluster.Converge(3)
+
+	for i, e := range sim.engines {
+		if _, err := e.GetEntry(entries[0].ID); err == nil {
+			t.Errorf("%s: expected the entry to be deleted", sim.peers[i])
+		}
+		if list, _ := e.ListEntries(engine.ListFilter{}); len(list) != 14 {
+			t.Errorf("%s: expected 14 entries, got %d", sim.peers[i], len(list))
+		}
+	}
+}